@@ -3,7 +3,7 @@ set -euo pipefail
 
 VERSION=$(git describe --tags --always --dirty 2>/dev/null || echo "dev")
 LDFLAGS="-X main.version=$VERSION"
-BINARIES=(ag-agent-claude ag-agent-codex ag-view-web ag-cli ag-scheduler)
+BINARIES=(ag-agent-claude ag-agent-codex ag-view-web ag-cli ag-scheduler ag-mcp ag-all)
 
 # Helper functions
 build_all() {
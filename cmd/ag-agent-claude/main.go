@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"phobos.org.uk/agency/internal/agent"
+	"phobos.org.uk/agency/internal/api"
 	"phobos.org.uk/agency/internal/config"
 )
 
@@ -17,9 +18,11 @@ var version = "dev"
 
 func main() {
 	configPath := flag.String("config", "", "Path to config file")
+	profile := flag.String("profile", "", "Config profile to apply (default: "+config.ProfileEnv+", or "+config.DefaultProfile+")")
 	port := flag.Int("port", 0, "Port to listen on (overrides config)")
 	bind := flag.String("bind", "", "Address to bind to (overrides config)")
 	showVersion := flag.Bool("version", false, "Show version")
+	flag.Var(config.NewSetFlag(config.EnvPrefix, &config.Config{}), "set", "Override a config key, e.g. -set claude.model=opus (repeatable; same as "+config.EnvPrefix+"CLAUDE_MODEL)")
 	flag.Parse()
 
 	if *showVersion {
@@ -32,13 +35,18 @@ func main() {
 	var err error
 
 	if *configPath != "" {
-		cfg, err = config.Load(*configPath)
+		cfg, err = config.LoadProfile(*configPath, *profile)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
 			os.Exit(1)
 		}
 	} else {
-		cfg = config.Default()
+		// Defaults, with any AGENCY_* overrides
+		cfg, err = config.ParseProfile(nil, *profile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
 	// Override port if specified
@@ -49,13 +57,56 @@ func main() {
 	if *bind != "" {
 		cfg.Bind = *bind
 	}
-	if cfg.Bind != "127.0.0.1" && cfg.Bind != "localhost" && cfg.Bind != "::1" {
-		fmt.Fprintf(os.Stderr, "Warning: agent bind=%q exposes unauthenticated endpoints. Prefer 127.0.0.1.\n", cfg.Bind)
+	if cfg.AuthToken == "" {
+		cfg.AuthToken = os.Getenv(api.AuthTokenEnv)
+	}
+	if cfg.AuthToken == "" && cfg.Bind != "127.0.0.1" && cfg.Bind != "localhost" && cfg.Bind != "::1" {
+		fmt.Fprintf(os.Stderr, "Warning: agent bind=%q exposes unauthenticated endpoints. Prefer 127.0.0.1 or set auth_token.\n", cfg.Bind)
 	}
 
 	// Create and start agent
 	a := agent.New(cfg, version)
 
+	// Hot-reload tier mappings, timeouts and prompts on SIGHUP and when the
+	// config file changes (interval from AG_AGENT_CONFIG_RELOAD_INTERVAL).
+	// PUT /config saves its changes to the file too.
+	if *configPath != "" {
+		a.SetConfigPath(*configPath)
+		reloadInterval := agent.DefaultConfigReloadInterval
+		if intervalStr := os.Getenv("AG_AGENT_CONFIG_RELOAD_INTERVAL"); intervalStr != "" {
+			if parsed, err := time.ParseDuration(intervalStr); err == nil {
+				if parsed < time.Second {
+					fmt.Fprintf(os.Stderr, "Warning: AG_AGENT_CONFIG_RELOAD_INTERVAL=%s is too small, using minimum 1s\n", intervalStr)
+					reloadInterval = time.Second
+				} else {
+					reloadInterval = parsed
+				}
+			} else {
+				fmt.Fprintf(os.Stderr, "Warning: Invalid AG_AGENT_CONFIG_RELOAD_INTERVAL=%s, using default %s: %v\n", intervalStr, reloadInterval, err)
+			}
+		}
+		go a.WatchConfig(context.Background(), *configPath, reloadInterval)
+
+		hupCh := make(chan os.Signal, 1)
+		signal.Notify(hupCh, syscall.SIGHUP)
+		go func() {
+			for range hupCh {
+				if err := a.ReloadConfig(*configPath); err != nil {
+					fmt.Fprintf(os.Stderr, "Config reload failed (keeping current config): %v\n", err)
+				}
+			}
+		}()
+	}
+
+	// Heartbeat to a web view on another machine, if configured
+	go a.RunRegistration(context.Background())
+
+	// Enforce sessions.max_total_bytes and sessions.max_age, if set
+	go a.RunSessionJanitor(context.Background())
+
+	// Archive the history to backup.destination, if set
+	go a.RunBackups(context.Background())
+
 	// Handle shutdown signals
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
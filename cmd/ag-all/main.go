@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"phobos.org.uk/agency/internal/scheduler"
+	"phobos.org.uk/agency/internal/supervisor"
+)
+
+var version = "dev"
+
+func main() {
+	configPath := flag.String("config", "", "Path to ag-all config file (default: web view and one claude agent)")
+	binDir := flag.String("bin-dir", "", "Directory holding the ag-* binaries (overrides config; default: beside ag-all)")
+	showVersion := flag.Bool("version", false, "Show version")
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println(version)
+		os.Exit(0)
+	}
+
+	cfg := supervisor.Default()
+	if *configPath != "" {
+		var err error
+		cfg, err = supervisor.Load(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *binDir != "" {
+		cfg.BinDir = *binDir
+	}
+	if cfg.BinDir == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error locating ag-all: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.BinDir = filepath.Dir(exe)
+	}
+
+	children := cfg.Children()
+	for _, child := range children {
+		if _, err := os.Stat(child.Path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s binary not found: %v (build with ./build.sh build or set -bin-dir)\n", child.Name, err)
+			os.Exit(1)
+		}
+	}
+
+	// The scheduler reaches the web view through its internal port, which
+	// only the scheduler's own config can point it at
+	if cfg.Scheduler.Config != "" {
+		schedCfg, err := scheduler.Load(cfg.Scheduler.Config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading scheduler config: %v\n", err)
+			os.Exit(1)
+		}
+		if want := cfg.DirectorURL(); !sameDirector(schedCfg.DirectorURL, want) {
+			fmt.Fprintf(os.Stderr, "Warning: scheduler director_url is %q; set it to %s to queue jobs through this web view\n", schedCfg.DirectorURL, want)
+		}
+	}
+
+	start, end := cfg.DiscoveryRange()
+	fmt.Fprintf(os.Stderr, "ag-all %s: dashboard at https://localhost:%d (discovery ports %d-%d)\n", version, cfg.Web.Port, start, end)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	sup := supervisor.New(children, supervisor.Options{
+		Output:     os.Stdout,
+		LogDir:     cfg.LogDir,
+		Backoff:    cfg.Restart.Backoff,
+		MaxBackoff: cfg.Restart.MaxBackoff,
+	})
+	if err := sup.Run(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// sameDirector reports whether a scheduler director_url points at want,
+// treating localhost and 127.0.0.1 alike.
+func sameDirector(got, want string) bool {
+	got = strings.Replace(strings.TrimRight(got, "/"), "://localhost:", "://127.0.0.1:", 1)
+	return got == want
+}
@@ -7,20 +7,56 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/director/cli"
+	"phobos.org.uk/agency/internal/report"
 	"phobos.org.uk/agency/internal/tlsutil"
 )
 
 var version = "dev"
 
+// settings holds flag defaults from the config file (cli.DefaultConfigPath)
+var settings *cli.Config
+
+// commands lists the subcommands and their flags for shell completion
+var commands = []cli.CompletionCommand{
+	{Name: "task", Description: "Submit a task to an agent", Flags: []string{"agent", "tier", "agent-kind", "timeout", "session", "token", "attach", "i", "auto", "director", "output"}},
+	{Name: "queue", Description: "Submit a task to the queue", Flags: []string{"director", "model", "tier", "agent-kind", "timeout", "source", "callback-url", "expires-after", "idempotency-key", "attach", "hold", "run-at", "i", "output"}},
+	{Name: "queue-status", Description: "Get queue status or specific queued task", Flags: []string{"director", "output"}},
+	{Name: "queue-cancel", Description: "Cancel a queued task", Flags: []string{"director", "output"}},
+	{Name: "status", Description: "Get status of an agent or component", Flags: []string{"url"}},
+	{Name: "discover", Description: "Discover running components", Flags: []string{"port-start", "port-end", "hosts", "hosts-file"}},
+	{Name: "top", Description: "Live terminal monitor of agents and the queue", Flags: []string{"director", "interval", "once"}},
+	{Name: "report", Description: "Write a standalone HTML activity report", Flags: []string{"director", "since", "out"}},
+	{Name: "history", Description: "Export an agent's task history as JSONL or CSV", Flags: []string{"agent", "format", "since", "out"}, Args: []string{"export"}},
+	{Name: "restore", Description: "Restore an agent's history and sessions from a backup", Flags: []string{"from", "agent", "token"}},
+	{Name: "completion", Description: "Print a shell completion script", Args: cli.CompletionShells},
+	{Name: "version", Description: "Show version"},
+	{Name: "help", Description: "Show help"},
+}
+
 func main() {
 	if len(os.Args) < 2 {
 		printUsage()
 		os.Exit(1)
 	}
 
+	cfg, err := cli.LoadConfig(cli.DefaultConfigPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	settings = cfg
+
 	switch os.Args[1] {
 	case "task":
 		taskCmd(os.Args[2:])
@@ -34,6 +70,16 @@ func main() {
 		statusCmd(os.Args[2:])
 	case "discover":
 		discoverCmd(os.Args[2:])
+	case "top":
+		topCmd(os.Args[2:])
+	case "report":
+		reportCmd(os.Args[2:])
+	case "history":
+		historyCmd(os.Args[2:])
+	case "restore":
+		restoreCmd(os.Args[2:])
+	case "completion":
+		completionCmd(os.Args[2:])
 	case "version":
 		fmt.Println(version)
 	case "help", "-h", "--help":
@@ -52,27 +98,51 @@ Usage:
   ag-cli <command> [flags]
 
 Commands:
-  task          Submit a task to an agent (direct)
-  queue         Submit a task to the queue (via director)
+  task          Submit a task to an agent (direct; -auto to pick one; -i for interactive)
+  queue         Submit a task to the queue (via director; -i for interactive)
   queue-status  Get queue status or specific queued task
   queue-cancel  Cancel a queued task
   status        Get status of an agent or component
-  discover      Discover running components
+  discover      Discover running components (-hosts to scan other machines)
+  top           Live terminal monitor of agents, the queue and recent tasks
+  report        Write a standalone HTML activity report
+  history       Export an agent's task history (history export; JSONL or CSV)
+  restore       Restore an agent's history and sessions from a backup archive
+  completion    Print a shell completion script (bash, zsh, fish)
   version       Show version
   help          Show this help
 
-Run 'ag-cli <command> -h' for command-specific help.`)
+Run 'ag-cli <command> -h' for command-specific help.
+
+Defaults for -director, -agent, -token and -output can be set in
+~/.config/agency/cli.yaml (or the file named by AG_CLI_CONFIG).`)
 }
 
 // taskCmd handles the 'task' subcommand
 func taskCmd(args []string) {
 	fs := flag.NewFlagSet("task", flag.ExitOnError)
-	agentURL := fs.String("agent", "https://localhost:9000", "Agent URL")
+	agentURL := fs.String("agent", settings.AgentURL, "Agent URL")
 	tier := fs.String("tier", "standard", "Model tier (fast, standard, heavy)")
 	agentKind := fs.String("agent-kind", "claude", "Agent kind (claude, codex)")
 	timeout := fs.Duration("timeout", 30*time.Minute, "Task timeout")
 	sessionID := fs.String("session", "", "Session ID to continue (optional)")
+	authToken := fs.String("token", defaultToken(), "Bearer token for agents with auth_token set (default from AG_AUTH_TOKEN or the config file)")
+	attach := fs.String("attach", "", "Comma-separated files to attach to the task (optional)")
+	interactiveMode := fs.Bool("i", false, "Interactive mode: read prompts from stdin into one session")
+	auto := fs.Bool("auto", false, "Pick an idle agent of -agent-kind from the director instead of -agent, queuing there if none is idle")
+	directorURL := fs.String("director", settings.DirectorURL, "Director URL, for -auto")
+	output := outputFlag(fs)
 	fs.Parse(args)
+	checkOutput(*output)
+
+	if *interactiveMode {
+		runInteractive(cli.New(*agentURL, cli.WithAuthToken(*authToken)), cli.InteractiveOptions{
+			Timeout:   *timeout,
+			Tier:      *tier,
+			AgentKind: *agentKind,
+		})
+		return
+	}
 
 	remaining := fs.Args()
 	if len(remaining) == 0 {
@@ -81,8 +151,51 @@ func taskCmd(args []string) {
 		os.Exit(1)
 	}
 	prompt := remaining[0]
+	// Sent with the submission so the task's records and logs can be traced
+	// back to this run
+	requestID := api.NewRequestID()
+
+	// queueInstead submits the task to the director queue, for -auto when no
+	// agent is free
+	queueInstead := func() {
+		queueReq := map[string]any{
+			"prompt":          prompt,
+			"timeout_seconds": int(timeout.Seconds()),
+			"source":          "cli",
+			"tier":            *tier,
+			"agent_kind":      *agentKind,
+		}
+		if *sessionID != "" {
+			queueReq["session_id"] = *sessionID
+		}
+		if *attach != "" {
+			queueReq["attachments"] = readAttachments(*attach)
+		}
+		submitToQueue(*directorURL, queueReq, requestID, *output)
+	}
+	if *auto {
+		picked, err := cli.PickIdleAgent(tlsutil.NewHTTPClient(30*time.Second, *directorURL), *directorURL, *agentKind, *tier)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error finding an agent: %v\n", err)
+			os.Exit(1)
+		}
+		if picked == "" {
+			fmt.Fprintf(os.Stderr, "No idle %s agent, queuing\n", *agentKind)
+			queueInstead()
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Using agent %s\n", picked)
+		*agentURL = picked
+	}
 
-	client := tlsutil.NewHTTPClient(5*time.Minute, *agentURL)
+	var reqs []cli.Requirement
+	if *attach != "" {
+		reqs = append(reqs, cli.Requirement{Capability: api.CapabilityAttachments, Flag: "-attach"})
+	}
+	requireCapabilities(*agentURL, reqs)
+
+	client := api.WithAuthToken(tlsutil.NewHTTPClient(5*time.Minute, *agentURL), *authToken)
+	submitClient := api.WithRequestID(client, requestID)
 
 	// Submit task
 	taskReq := map[string]any{
@@ -98,15 +211,24 @@ func taskCmd(args []string) {
 	if *sessionID != "" {
 		taskReq["session_id"] = *sessionID
 	}
+	if *attach != "" {
+		taskReq["attachments"] = readAttachments(*attach)
+	}
 	body, _ := json.Marshal(taskReq)
 
-	resp, err := client.Post(*agentURL+"/task", "application/json", bytes.NewReader(body))
+	resp, err := submitClient.Post(*agentURL+"/task", "application/json", bytes.NewReader(body))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error submitting task: %v\n", err)
 		os.Exit(1)
 	}
 	defer resp.Body.Close()
 
+	if *auto && resp.StatusCode == http.StatusConflict {
+		// Another client took the agent since the director last polled it
+		fmt.Fprintf(os.Stderr, "Agent %s became busy, queuing\n", *agentURL)
+		queueInstead()
+		return
+	}
 	if resp.StatusCode != http.StatusCreated {
 		respBody, _ := io.ReadAll(resp.Body)
 		fmt.Fprintf(os.Stderr, "Error: %s\n", respBody)
@@ -120,12 +242,19 @@ func taskCmd(args []string) {
 		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Fprintf(os.Stderr, "Task submitted: %s\n", taskResp.TaskID)
+	fmt.Fprintf(os.Stderr, "Task submitted: %s (request %s)\n", taskResp.TaskID, requestID)
 
 	// Poll for completion
 	result := pollForCompletion(client, *agentURL, taskResp.TaskID, time.Hour)
 
 	// Print result
+	if *output == cli.OutputJSON {
+		printJSON(result)
+		if result.ExitCode != nil && *result.ExitCode != 0 {
+			os.Exit(*result.ExitCode)
+		}
+		return
+	}
 	fmt.Printf("\n=== Task %s ===\n", result.TaskID)
 	fmt.Printf("State: %s\n", result.State)
 	fmt.Printf("Duration: %.2fs\n", result.DurationSeconds)
@@ -147,6 +276,52 @@ func taskCmd(args []string) {
 	}
 }
 
+// defaultToken returns the -token default: AG_AUTH_TOKEN, then the config
+// file's token.
+func defaultToken() string {
+	if token := os.Getenv(api.AuthTokenEnv); token != "" {
+		return token
+	}
+	return settings.Token
+}
+
+// outputFlag registers -output, defaulting to the config file's format.
+func outputFlag(fs *flag.FlagSet) *string {
+	return fs.String("output", settings.Output, "Output format (text, json)")
+}
+
+func checkOutput(output string) {
+	if err := cli.ValidateOutput(output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// printJSON pretty-prints v to stdout.
+func printJSON(v any) {
+	output, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Println(string(output))
+}
+
+// readAttachments reads a comma-separated list of files as task
+// attachments, named by their base names.
+func readAttachments(list string) []api.Attachment {
+	var attachments []api.Attachment
+	for _, path := range strings.Split(list, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading attachment: %v\n", err)
+			os.Exit(1)
+		}
+		attachments = append(attachments, api.Attachment{Name: filepath.Base(path), Data: data})
+	}
+	return attachments
+}
+
 type taskStatus struct {
 	TaskID          string         `json:"task_id"`
 	State           string         `json:"state"`
@@ -161,6 +336,7 @@ func pollForCompletion(client *http.Client, agentURL, taskID string, timeout tim
 	defer ticker.Stop()
 
 	deadline := time.After(timeout)
+	var lastOutput string
 
 	for {
 		select {
@@ -187,7 +363,13 @@ func pollForCompletion(client *http.Client, agentURL, taskID string, timeout tim
 				fmt.Fprintf(os.Stderr, "\n")
 				return &status
 			case "working", "queued":
-				fmt.Fprintf(os.Stderr, ".")
+				// Running tasks report their latest output text
+				if status.Output != "" && status.Output != lastOutput {
+					lastOutput = status.Output
+					fmt.Fprintf(os.Stderr, "\n> %s\n", latestLine(status.Output, 120))
+				} else {
+					fmt.Fprintf(os.Stderr, ".")
+				}
 			default:
 				fmt.Fprintf(os.Stderr, "\nUnknown state: %s\n", status.State)
 				os.Exit(1)
@@ -196,10 +378,20 @@ func pollForCompletion(client *http.Client, agentURL, taskID string, timeout tim
 	}
 }
 
+// latestLine returns the last non-blank line of text, cut to maxRunes.
+func latestLine(text string, maxRunes int) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	line := []rune(strings.TrimSpace(lines[len(lines)-1]))
+	if len(line) > maxRunes {
+		return string(line[:maxRunes-1]) + "…"
+	}
+	return string(line)
+}
+
 // statusCmd handles the 'status' subcommand
 func statusCmd(args []string) {
 	fs := flag.NewFlagSet("status", flag.ExitOnError)
-	url := fs.String("url", "https://localhost:9000", "Component URL")
+	url := fs.String("url", settings.AgentURL, "Component URL")
 	fs.Parse(args)
 
 	// Allow URL as positional arg
@@ -221,9 +413,7 @@ func statusCmd(args []string) {
 		os.Exit(1)
 	}
 
-	// Pretty print
-	output, _ := json.MarshalIndent(status, "", "  ")
-	fmt.Println(string(output))
+	printJSON(status)
 }
 
 // discoverCmd handles the 'discover' subcommand
@@ -231,57 +421,93 @@ func discoverCmd(args []string) {
 	fs := flag.NewFlagSet("discover", flag.ExitOnError)
 	portStart := fs.Int("port-start", 9000, "Start of port range")
 	portEnd := fs.Int("port-end", 9009, "End of port range")
+	hostList := fs.String("hosts", "localhost", "Comma-separated hosts to scan")
+	hostsFile := fs.String("hosts-file", "", "File listing hosts to scan, one per line (adds to -hosts)")
 	fs.Parse(args)
 
-	fmt.Printf("Scanning ports %d-%d...\n\n", *portStart, *portEnd)
-
-	found := 0
-	for port := *portStart; port <= *portEnd; port++ {
-		url := fmt.Sprintf("https://localhost:%d/status", port)
-		client := tlsutil.NewHTTPClient(500*time.Millisecond, url)
-		resp, err := client.Get(url)
+	hosts := cli.ParseHosts(*hostList)
+	if *hostsFile != "" {
+		fileHosts, err := cli.LoadHostsFile(*hostsFile)
 		if err != nil {
-			continue
+			fmt.Fprintf(os.Stderr, "Error reading hosts file: %v\n", err)
+			os.Exit(1)
 		}
+		hosts = cli.ParseHosts(strings.Join(append(hosts, fileHosts...), ","))
+	}
+	if len(hosts) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no hosts to scan\n")
+		os.Exit(1)
+	}
 
-		var status map[string]any
-		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
-			resp.Body.Close()
+	fmt.Printf("Scanning ports %d-%d on %d host(s)...\n\n", *portStart, *portEnd, len(hosts))
+
+	found, hostsFound := 0, 0
+	for _, scan := range cli.Discover(hosts, *portStart, *portEnd, 2*time.Second) {
+		if len(scan.Components) == 0 && scan.TLSErrors == 0 {
 			continue
 		}
-		resp.Body.Close()
-
-		found++
-		compType := status["type"]
-		if compType == nil {
-			compType = "unknown"
+		fmt.Printf("%s\n", scan.Host)
+		for _, c := range scan.Components {
+			compType := c.Status["type"]
+			if compType == nil {
+				compType = "unknown"
+			}
+			apiVersion := c.Status["api_version"]
+			if apiVersion == nil {
+				apiVersion = "-" // Predates API versioning
+			}
+			fmt.Printf("  :%d  type=%-10v agent_kind=%-7v state=%-10v version=%-10v api=%-2v interfaces=%v\n",
+				c.Port, compType, c.Status["agent_kind"], c.Status["state"], c.Status["version"], apiVersion, c.Status["interfaces"])
+			if caps, ok := c.Status["capabilities"].([]any); ok && len(caps) > 0 {
+				fmt.Printf("         capabilities=%v\n", caps)
+			}
 		}
-		agentKind := status["agent_kind"]
-		state := status["state"]
-		ver := status["version"]
-		interfaces := status["interfaces"]
-
-		fmt.Printf("  :%d  type=%-10v agent_kind=%-7v state=%-10v version=%-10v interfaces=%v\n",
-			port, compType, agentKind, state, ver, interfaces)
+		if scan.TLSErrors > 0 {
+			fmt.Printf("  %d port(s) presented an untrusted certificate; add %s to AGENCY_TLS_INSECURE_HOSTS to include them\n",
+				scan.TLSErrors, scan.Host)
+		}
+		if len(scan.Components) > 0 {
+			found += len(scan.Components)
+			hostsFound++
+		}
+		fmt.Println()
 	}
 
 	if found == 0 {
 		fmt.Println("No components found.")
 	} else {
-		fmt.Printf("\nFound %d component(s)\n", found)
+		fmt.Printf("Found %d component(s) on %d host(s)\n", found, hostsFound)
 	}
 }
 
 // queueCmd handles the 'queue' subcommand - submit task to queue
 func queueCmd(args []string) {
 	fs := flag.NewFlagSet("queue", flag.ExitOnError)
-	directorURL := fs.String("director", "http://localhost:8080", "Director URL")
+	directorURL := fs.String("director", settings.DirectorURL, "Director URL")
 	model := fs.String("model", "", "Model override (provider-specific)")
 	tier := fs.String("tier", "standard", "Model tier (fast, standard, heavy)")
 	agentKind := fs.String("agent-kind", "claude", "Agent kind (claude, codex)")
 	timeout := fs.Duration("timeout", 30*time.Minute, "Task timeout")
 	source := fs.String("source", "cli", "Source identifier")
+	callbackURL := fs.String("callback-url", "", "URL the director POSTs the result to when the task finishes (optional)")
+	expiresAfter := fs.Duration("expires-after", 0, "Expire the task if it has not been dispatched within this long (0 = never)")
+	idempotencyKey := fs.String("idempotency-key", "", "Key identifying this submission; repeats within 24h return the existing entry (optional)")
+	attach := fs.String("attach", "", "Comma-separated files to attach to the task (optional)")
+	runAt := fs.String("run-at", "", "Don't dispatch before this time: RFC 3339, or HH:MM for its next occurrence (optional)")
+	hold := fs.Bool("hold", false, "Queue the task held; it is not dispatched until released (POST /api/queue/{id}/release)")
+	interactiveMode := fs.Bool("i", false, "Interactive mode: read prompts from stdin into one session, queued via the director")
+	output := outputFlag(fs)
 	fs.Parse(args)
+	checkOutput(*output)
+
+	if *interactiveMode {
+		runInteractive(cli.New("", cli.WithDirectorURL(*directorURL)), cli.InteractiveOptions{
+			Timeout:   *timeout,
+			Tier:      *tier,
+			AgentKind: *agentKind,
+		})
+		return
+	}
 
 	remaining := fs.Args()
 	if len(remaining) == 0 {
@@ -291,8 +517,6 @@ func queueCmd(args []string) {
 	}
 	prompt := remaining[0]
 
-	client := tlsutil.NewHTTPClient(30*time.Second, *directorURL)
-
 	// Submit to queue
 	queueReq := map[string]any{
 		"prompt":          prompt,
@@ -308,9 +532,68 @@ func queueCmd(args []string) {
 	if *agentKind != "" {
 		queueReq["agent_kind"] = *agentKind
 	}
+	if *callbackURL != "" {
+		queueReq["callback_url"] = *callbackURL
+	}
+	if *expiresAfter > 0 {
+		queueReq["expires_after_seconds"] = int(expiresAfter.Seconds())
+	}
+	if *idempotencyKey != "" {
+		queueReq["idempotency_key"] = *idempotencyKey
+	}
+	if *attach != "" {
+		queueReq["attachments"] = readAttachments(*attach)
+	}
+	if *hold {
+		queueReq["hold"] = true
+	}
+	if *runAt != "" {
+		at, err := cli.ParseRunAt(*runAt, time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		queueReq["run_at"] = at.Format(time.RFC3339)
+	}
+
+	var reqs []cli.Requirement
+	if *callbackURL != "" {
+		reqs = append(reqs, cli.Requirement{Capability: api.CapabilityCallbacks, Flag: "-callback-url"})
+	}
+	if *idempotencyKey != "" {
+		reqs = append(reqs, cli.Requirement{Capability: api.CapabilityIdempotency, Flag: "-idempotency-key"})
+	}
+	if *runAt != "" {
+		reqs = append(reqs, cli.Requirement{Capability: api.CapabilityScheduledDispatch, Flag: "-run-at"})
+	}
+	if *hold {
+		reqs = append(reqs, cli.Requirement{Capability: api.CapabilityScheduledDispatch, Flag: "-hold"})
+	}
+	requireCapabilities(*directorURL, reqs)
+	submitToQueue(*directorURL, queueReq, api.NewRequestID(), *output)
+}
+
+// requireCapabilities exits if the component at baseURL reports that it lacks
+// a capability in reqs, so a flag isn't silently ignored by an older
+// component, and warns if it speaks a newer API than ag-cli.
+func requireCapabilities(baseURL string, reqs []cli.Requirement) {
+	warning, err := cli.CheckCapabilities(tlsutil.NewHTTPClient(5*time.Second, baseURL), baseURL, reqs)
+	if warning != "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// submitToQueue submits a task to the director queue under requestID and
+// prints its queue ID.
+func submitToQueue(directorURL string, queueReq map[string]any, requestID, output string) {
+	client := api.WithRequestID(tlsutil.NewHTTPClient(30*time.Second, directorURL), requestID)
 	body, _ := json.Marshal(queueReq)
 
-	resp, err := client.Post(*directorURL+"/api/queue/task", "application/json", bytes.NewReader(body))
+	resp, err := client.Post(directorURL+"/api/queue/task", "application/json", bytes.NewReader(body))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error submitting to queue: %v\n", err)
 		os.Exit(1)
@@ -324,29 +607,48 @@ func queueCmd(args []string) {
 		os.Exit(1)
 	}
 
-	if resp.StatusCode != http.StatusCreated {
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", respBody)
 		os.Exit(1)
 	}
 
 	var queueResp struct {
-		QueueID  string `json:"queue_id"`
-		Position int    `json:"position"`
-		State    string `json:"state"`
+		QueueID   string `json:"queue_id"`
+		Position  int    `json:"position"`
+		State     string `json:"state"`
+		Duplicate bool   `json:"duplicate"`
 	}
 	if err := json.Unmarshal(respBody, &queueResp); err != nil {
 		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("Queued: %s (position %d)\n", queueResp.QueueID, queueResp.Position)
+	if output == cli.OutputJSON {
+		printJSON(json.RawMessage(respBody))
+		return
+	}
+	if queueResp.Duplicate {
+		fmt.Printf("Already queued: %s (%s)\n", queueResp.QueueID, queueResp.State)
+		return
+	}
+	fmt.Printf("Queued: %s (position %d, request %s)\n", queueResp.QueueID, queueResp.Position, requestID)
+}
+
+// runInteractive runs an interactive session on stdin and stdout.
+func runInteractive(d *cli.Director, opts cli.InteractiveOptions) {
+	if err := d.Interactive(os.Stdin, os.Stdout, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 }
 
 // queueStatusCmd handles the 'queue-status' subcommand
 func queueStatusCmd(args []string) {
 	fs := flag.NewFlagSet("queue-status", flag.ExitOnError)
-	directorURL := fs.String("director", "http://localhost:8080", "Director URL")
+	directorURL := fs.String("director", settings.DirectorURL, "Director URL")
+	output := outputFlag(fs)
 	fs.Parse(args)
+	checkOutput(*output)
 
 	client := tlsutil.NewHTTPClient(10*time.Second, *directorURL)
 
@@ -373,8 +675,7 @@ func queueStatusCmd(args []string) {
 			os.Exit(1)
 		}
 
-		output, _ := json.MarshalIndent(task, "", "  ")
-		fmt.Println(string(output))
+		printJSON(task)
 		return
 	}
 
@@ -386,6 +687,16 @@ func queueStatusCmd(args []string) {
 	}
 	defer resp.Body.Close()
 
+	if *output == cli.OutputJSON {
+		var queue map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&queue); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+			os.Exit(1)
+		}
+		printJSON(queue)
+		return
+	}
+
 	var queue struct {
 		Depth            int     `json:"depth"`
 		MaxSize          int     `json:"max_size"`
@@ -427,8 +738,10 @@ func queueStatusCmd(args []string) {
 // queueCancelCmd handles the 'queue-cancel' subcommand
 func queueCancelCmd(args []string) {
 	fs := flag.NewFlagSet("queue-cancel", flag.ExitOnError)
-	directorURL := fs.String("director", "http://localhost:8080", "Director URL")
+	directorURL := fs.String("director", settings.DirectorURL, "Director URL")
+	output := outputFlag(fs)
 	fs.Parse(args)
+	checkOutput(*output)
 
 	remaining := fs.Args()
 	if len(remaining) == 0 {
@@ -457,15 +770,254 @@ func queueCancelCmd(args []string) {
 		QueueID       string `json:"queue_id"`
 		State         string `json:"state"`
 		WasDispatched bool   `json:"was_dispatched"`
+		AgentURL      string `json:"agent_url,omitempty"`
+		TaskID        string `json:"task_id,omitempty"`
+		Agent         *struct {
+			StatusCode int    `json:"status_code,omitempty"`
+			Message    string `json:"message,omitempty"`
+			State      string `json:"state,omitempty"`
+			Stopped    bool   `json:"stopped"`
+		} `json:"agent,omitempty"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
 		os.Exit(1)
 	}
 
-	if result.WasDispatched {
-		fmt.Printf("Cancelled %s (was dispatched to agent)\n", result.QueueID)
-	} else {
+	if *output == cli.OutputJSON {
+		printJSON(result)
+		return
+	}
+	switch {
+	case result.Agent == nil:
 		fmt.Printf("Cancelled %s\n", result.QueueID)
+	case result.Agent.Stopped:
+		fmt.Printf("Cancelled %s; agent task %s stopped (%s)\n", result.QueueID, result.TaskID, result.Agent.State)
+	case result.Agent.StatusCode == 0:
+		fmt.Printf("Cancelled %s, but agent %s could not be reached: %s\n", result.QueueID, result.AgentURL, result.Agent.Message)
+	case result.Agent.StatusCode == http.StatusOK:
+		fmt.Printf("Cancelled %s; agent task %s is still stopping\n", result.QueueID, result.TaskID)
+	default:
+		fmt.Printf("Cancelled %s; agent answered %d: %s\n", result.QueueID, result.Agent.StatusCode, result.Agent.Message)
+	}
+}
+
+// topCmd handles the 'top' subcommand
+func topCmd(args []string) {
+	fs := flag.NewFlagSet("top", flag.ExitOnError)
+	directorURL := fs.String("director", settings.DirectorURL, "Director URL")
+	interval := fs.Duration("interval", cli.DefaultTopInterval, "Refresh interval")
+	once := fs.Bool("once", false, "Print one snapshot and exit")
+	fs.Parse(args)
+
+	client := tlsutil.NewHTTPClient(10*time.Second, *directorURL)
+	width, _ := strconv.Atoi(os.Getenv("COLUMNS"))
+	if width <= 0 {
+		width = 120
+	}
+
+	if *once {
+		snap, err := cli.FetchTop(client, *directorURL)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		cli.RenderTop(os.Stdout, snap, *directorURL, time.Now(), width)
+		return
+	}
+
+	// Draw on the alternate screen so the terminal is restored on exit
+	fmt.Print("\033[?1049h\033[?25l")
+	restore := func() { fmt.Print("\033[?25h\033[?1049l") }
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		var frame bytes.Buffer
+		frame.WriteString("\033[H\033[2J")
+		if snap, err := cli.FetchTop(client, *directorURL); err != nil {
+			fmt.Fprintf(&frame, "ag-cli top - %s - %s\n\nError: %v\n", *directorURL, time.Now().Format("15:04:05"), err)
+		} else {
+			cli.RenderTop(&frame, snap, *directorURL, time.Now(), width)
+		}
+		frame.WriteString("\nCtrl-C to quit")
+		os.Stdout.Write(frame.Bytes())
+
+		select {
+		case <-stop:
+			restore()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// completionCmd handles the 'completion' subcommand
+func completionCmd(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: ag-cli completion bash|zsh|fish\n")
+		os.Exit(1)
+	}
+	if err := cli.WriteCompletion(os.Stdout, args[0], "ag-cli", commands); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// reportCmd handles the 'report' subcommand
+func reportCmd(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	directorURL := fs.String("director", settings.DirectorURL, "Director URL")
+	since := fs.String("since", "7d", "Lookback window (e.g. 7d, 24h)")
+	out := fs.String("out", "report.html", "Output file (- for stdout)")
+	fs.Parse(args)
+
+	window, err := report.ParseWindow(*since)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	client := tlsutil.NewHTTPClient(30*time.Second, *directorURL)
+	r, err := report.Collect(client, *directorURL, time.Now().Add(-window))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	for _, warning := range r.Errors {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating report: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := report.Render(w, r); err != nil {
+		fmt.Fprintf(os.Stderr, "Error rendering report: %v\n", err)
+		os.Exit(1)
+	}
+	if *out != "-" {
+		fmt.Fprintf(os.Stderr, "Report written to %s (%d tasks)\n", *out, r.TasksRun)
+	}
+}
+
+// historyCmd handles the 'history' subcommand
+func historyCmd(args []string) {
+	if len(args) == 0 || args[0] != "export" {
+		fmt.Fprintf(os.Stderr, "Usage: ag-cli history export [flags]\n")
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("history export", flag.ExitOnError)
+	agentURL := fs.String("agent", settings.AgentURL, "Agent URL")
+	format := fs.String("format", "jsonl", "Export format (jsonl, csv)")
+	since := fs.String("since", "", "Lookback window (e.g. 7d, 24h; default all retained history)")
+	out := fs.String("out", "-", "Output file (- for stdout)")
+	fs.Parse(args[1:])
+
+	query := url.Values{"format": {*format}}
+	if *since != "" {
+		window, err := report.ParseWindow(*since)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		query.Set("since", time.Now().Add(-window).UTC().Format(time.RFC3339))
+	}
+
+	requireCapabilities(*agentURL, []cli.Requirement{{Capability: api.CapabilityHistoryExport, Flag: "history export"}})
+	client := tlsutil.NewHTTPClient(5*time.Minute, *agentURL)
+	resp, err := client.Get(*agentURL + "/history/export?" + query.Encode())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		fmt.Fprintf(os.Stderr, "Error: %s\n", respBody)
+		os.Exit(1)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating export: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing export: %v\n", err)
+		os.Exit(1)
 	}
+	if *out != "-" {
+		fmt.Fprintf(os.Stderr, "History written to %s (%d bytes)\n", *out, n)
+	}
+}
+
+// restoreCmd handles the 'restore' subcommand
+func restoreCmd(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	from := fs.String("from", "", "Backup archive to restore (required)")
+	agentURL := fs.String("agent", settings.AgentURL, "Agent URL")
+	authToken := fs.String("token", defaultToken(), "Bearer token for agents with auth_token set (default from AG_AUTH_TOKEN or the config file)")
+	fs.Parse(args)
+
+	if *from == "" {
+		fmt.Fprintf(os.Stderr, "Usage: ag-cli restore -from backup.tar.gz [-agent URL]\n")
+		os.Exit(1)
+	}
+	f, err := os.Open(*from)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	requireCapabilities(*agentURL, []cli.Requirement{{Capability: api.CapabilityRestore, Flag: "restore"}})
+	client := api.WithAuthToken(tlsutil.NewHTTPClient(30*time.Minute, *agentURL), *authToken)
+	resp, err := client.Post(*agentURL+"/admin/restore", "application/gzip", f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", respBody)
+		os.Exit(1)
+	}
+
+	var result struct {
+		Prefix          string    `json:"prefix"`
+		CreatedAt       time.Time `json:"created_at"`
+		HistoryFiles    int       `json:"history_files"`
+		HistoryEntries  int       `json:"history_entries"`
+		Sessions        []string  `json:"sessions"`
+		SkippedSessions []string  `json:"skipped_sessions"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Restored %s backup from %s\n", result.Prefix, result.CreatedAt.Local().Format(time.DateTime))
+	fmt.Printf("History:  %d files added, %d entries\n", result.HistoryFiles, result.HistoryEntries)
+	fmt.Printf("Sessions: %d restored", len(result.Sessions))
+	if len(result.SkippedSessions) > 0 {
+		fmt.Printf(", %d already present (%s)", len(result.SkippedSessions), strings.Join(result.SkippedSessions, ", "))
+	}
+	fmt.Println()
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/mcp"
+)
+
+var version = "dev"
+
+func main() {
+	agentURL := flag.String("agent", "https://localhost:9000", "Agent URL for submit_task, task status and history")
+	directorURL := flag.String("director", "http://localhost:8080", "Director internal API URL for the queue")
+	authToken := flag.String("token", os.Getenv(api.AuthTokenEnv), "Bearer token for agents with auth_token set (default from AG_AUTH_TOKEN)")
+	showVersion := flag.Bool("version", false, "Show version")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "ag-mcp - Model Context Protocol server for Agency\n\n")
+		fmt.Fprintf(os.Stderr, "Speaks MCP over stdin/stdout. Register it with an MCP client such as Claude Desktop.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n  ag-mcp [flags]\n\nFlags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println(version)
+		os.Exit(0)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// stdout carries the protocol, so diagnostics go to stderr
+	server := mcp.New(mcp.Config{
+		AgentURL:    strings.TrimRight(*agentURL, "/"),
+		DirectorURL: strings.TrimRight(*directorURL, "/"),
+		AuthToken:   *authToken,
+		Version:     version,
+	})
+	if err := server.Serve(ctx, os.Stdin, os.Stdout); err != nil && ctx.Err() == nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
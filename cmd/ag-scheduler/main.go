@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
@@ -9,6 +10,8 @@ import (
 	"syscall"
 	"time"
 
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/config"
 	"phobos.org.uk/agency/internal/scheduler"
 )
 
@@ -18,7 +21,9 @@ func main() {
 	configPath := flag.String("config", "", "Path to config file (required)")
 	port := flag.Int("port", 0, "Port to listen on (overrides config)")
 	bind := flag.String("bind", "", "Address to bind to (overrides config)")
+	dryRun := flag.Bool("dry-run", false, "Print what each job would submit, as JSON, and exit without contacting agents")
 	showVersion := flag.Bool("version", false, "Show version")
+	flag.Var(config.NewSetFlag(scheduler.EnvPrefix, &scheduler.Config{}), "set", "Override a config key, e.g. -set director_url=https://localhost:8443 (repeatable; same as "+scheduler.EnvPrefix+"DIRECTOR_URL)")
 	flag.Parse()
 
 	if *showVersion {
@@ -39,6 +44,18 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *dryRun {
+		runs, err := cfg.DryRuns(time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(runs)
+		os.Exit(0)
+	}
+
 	// Override port if specified
 	if *port > 0 {
 		cfg.Port = *port
@@ -47,8 +64,11 @@ func main() {
 	if *bind != "" {
 		cfg.Bind = *bind
 	}
-	if cfg.Bind != "127.0.0.1" && cfg.Bind != "localhost" && cfg.Bind != "::1" {
-		fmt.Fprintf(os.Stderr, "Warning: scheduler bind=%q exposes unauthenticated endpoints. Prefer 127.0.0.1.\n", cfg.Bind)
+	if cfg.AuthToken == "" {
+		cfg.AuthToken = os.Getenv(api.AuthTokenEnv)
+	}
+	if cfg.AuthToken == "" && cfg.Bind != "127.0.0.1" && cfg.Bind != "localhost" && cfg.Bind != "::1" {
+		fmt.Fprintf(os.Stderr, "Warning: scheduler bind=%q exposes unauthenticated endpoints. Prefer 127.0.0.1 or set auth_token.\n", cfg.Bind)
 	}
 
 	// Parse config reload interval from environment (default: 60s, min: 1s)
@@ -5,13 +5,18 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/backup"
+	"phobos.org.uk/agency/internal/tlsutil"
 	"phobos.org.uk/agency/internal/view/web"
 )
 
@@ -23,11 +28,42 @@ func main() {
 	bind := flag.String("bind", "0.0.0.0", "Address to bind to")
 	portStart := flag.Int("port-start", 9000, "Discovery port range start")
 	portEnd := flag.Int("port-end", 9010, "Discovery port range end")
+	componentURLs := flag.String("agents", os.Getenv("AG_WEB_AGENTS"), "Comma-separated agent URLs polled besides the port range, e.g. ssh://user@gpu1:9000 for an agent bound to gpu1's loopback")
 	envFile := flag.String("env", "", "Path to .env file for token (default: .env in current dir)")
 	certFile := flag.String("cert", "", "Path to TLS certificate")
 	keyFile := flag.String("key", "", "Path to TLS private key")
 	accessLog := flag.String("access-log", "", "Path to access log file (logs all connection attempts)")
 	regenCert := flag.Bool("regen-cert", false, "Regenerate self-signed certificate")
+	acmeDomains := flag.String("acme-domains", os.Getenv("AG_ACME_DOMAINS"), "Comma-separated public hostnames to get Let's Encrypt certificates for instead of using -cert/-key (empty = disabled)")
+	acmeEmail := flag.String("acme-email", os.Getenv("AG_ACME_EMAIL"), "Contact email for the ACME account")
+	acmeDirectory := flag.String("acme-directory", os.Getenv("AG_ACME_DIRECTORY"), "ACME directory URL (default: Let's Encrypt production)")
+	acmeHTTPAddr := flag.String("acme-http-addr", os.Getenv("AG_ACME_HTTP_ADDR"), "Address for ACME HTTP-01 challenges, e.g. :80 (empty = TLS-ALPN-01 on -port, which must be reachable as 443)")
+	restartCmd := flag.String("restart-cmd", os.Getenv("AG_RESTART_CMD"), "Shell command that restarts one agent during rolling restarts (AGENCY_AGENT_URL/PORT/KIND/ID are set)")
+	queueMaxPerHour := flag.Int("queue-max-per-hour", envInt("AG_QUEUE_MAX_PER_HOUR"), "Maximum queued task dispatches per rolling hour (0=unlimited)")
+	authToken := flag.String("auth-token", os.Getenv(api.AuthTokenEnv), "Bearer token sent to agents and the scheduler when they require one (default from AG_AUTH_TOKEN)")
+	queueWindows := flag.String("queue-windows", os.Getenv("AG_QUEUE_WINDOWS"), "Daily dispatch windows per tier in local time, e.g. heavy=22:00-06:00 (* = all tiers)")
+	queueWeights := flag.String("queue-weights", os.Getenv("AG_QUEUE_WEIGHTS"), "Fair-share dispatch weights per source, e.g. web=4,cli=4,scheduler=1 (unlisted sources = 1)")
+	allowIPs := flag.String("allow-ips", os.Getenv("AG_WEB_ALLOW_IPS"), "Comma-separated CIDRs allowed to connect, e.g. a VPN range (empty = all; loopback is always allowed)")
+	denyIPs := flag.String("deny-ips", os.Getenv("AG_WEB_DENY_IPS"), "Comma-separated CIDRs refused before authentication (takes precedence over -allow-ips)")
+	trustedProxies := flag.String("trusted-proxies", os.Getenv("AG_WEB_TRUSTED_PROXIES"), "Comma-separated proxy CIDRs whose X-Real-IP/X-Forwarded-For headers are trusted (empty = none)")
+	githubSecret := flag.String("github-webhook-secret", os.Getenv("AG_GITHUB_WEBHOOK_SECRET"), "Secret for GitHub webhooks at /api/hooks/github (empty = disabled)")
+	githubToken := flag.String("github-token", os.Getenv("AG_GITHUB_TOKEN"), "GitHub token used to comment task results on issues (empty = no comments)")
+	githubLabel := flag.String("github-label", envOr("AG_GITHUB_LABEL", web.DefaultGitHubLabel), "Issue label that queues the issue as a task")
+	subtaskURL := flag.String("subtask-url", os.Getenv("AG_SUBTASK_URL"), "Director URL given to tasks for spawning subtasks (default: the internal port if set, else https://127.0.0.1:<port>)")
+	metricsInterval := flag.Duration("metrics-interval", envDuration("AG_METRICS_INTERVAL", web.DefaultMetricsInterval), "How often agent states, queue depth and throughput are sampled for /api/metrics/history")
+	promptRulesPath := flag.String("prompt-rules", os.Getenv("AG_PROMPT_RULES"), "YAML file of text to prepend or append to prompts by task source (empty = none)")
+	autoscaleCmd := flag.String("autoscale-cmd", os.Getenv("AG_AUTOSCALE_CMD"), "Shell command that starts (AGENCY_SCALE_DIRECTION=up) or stops (down, AGENCY_AGENT_URL/PORT set) one agent (empty = no autoscaling)")
+	autoscaleWebhook := flag.String("autoscale-webhook", os.Getenv("AG_AUTOSCALE_WEBHOOK"), "URL POSTed scaling requests as JSON, instead of -autoscale-cmd")
+	autoscaleUpDepth := flag.Int("autoscale-up-depth", envInt("AG_AUTOSCALE_UP_DEPTH"), "Queue depth that counts as a backlog (0 = default 5)")
+	autoscaleUpAfter := flag.Duration("autoscale-up-after", envDuration("AG_AUTOSCALE_UP_AFTER", web.DefaultAutoscaleUpAfter), "How long a backlog lasts before scaling up")
+	autoscaleDownAfter := flag.Duration("autoscale-down-after", envDuration("AG_AUTOSCALE_DOWN_AFTER", web.DefaultAutoscaleDownAfter), "How long the queue is empty with an idle agent before scaling down")
+	autoscaleMin := flag.Int("autoscale-min-agents", envInt("AG_AUTOSCALE_MIN_AGENTS"), "Never scale below this many agents")
+	autoscaleMax := flag.Int("autoscale-max-agents", envInt("AG_AUTOSCALE_MAX_AGENTS"), "Never scale above this many agents (0 = unlimited)")
+	backupDest := flag.String("backup-dest", os.Getenv("AG_BACKUP_DEST"), "Absolute directory or s3://bucket/prefix to archive sessions and the auth store to (empty = no backups)")
+	backupEndpoint := flag.String("backup-endpoint", os.Getenv("AG_BACKUP_ENDPOINT"), "S3-compatible endpoint URL, e.g. a MinIO server (default: AWS)")
+	backupRegion := flag.String("backup-region", os.Getenv("AG_BACKUP_REGION"), "S3 region (default: us-east-1)")
+	backupInterval := flag.Duration("backup-interval", envDuration("AG_BACKUP_INTERVAL", backup.DefaultInterval), "Time between backups")
+	backupRetain := flag.Int("backup-retain", envInt("AG_BACKUP_RETAIN"), "Backups kept (0 = default 7)")
 	showVersion := flag.Bool("version", false, "Show version")
 	flag.Parse()
 
@@ -36,6 +72,53 @@ func main() {
 		os.Exit(0)
 	}
 
+	dispatchWindows, err := web.ParseDispatchWindows(*queueWindows)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid -queue-windows: %v\n", err)
+		os.Exit(1)
+	}
+	sourceWeights, err := web.ParseSourceWeights(*queueWeights)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid -queue-weights: %v\n", err)
+		os.Exit(1)
+	}
+	ipFilter, err := web.ParseIPFilter(*allowIPs, *denyIPs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid IP filter: %v\n", err)
+		os.Exit(1)
+	}
+	proxies, err := web.ParseTrustedProxies(*trustedProxies)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid -trusted-proxies: %v\n", err)
+		os.Exit(1)
+	}
+	var promptRules web.PromptRules
+	if *promptRulesPath != "" {
+		promptRules, err = web.LoadPromptRules(*promptRulesPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -prompt-rules: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	for _, raw := range splitList(*componentURLs) {
+		if u, err := url.Parse(raw); err != nil || (u.Scheme != "https" && u.Scheme != tlsutil.SSHScheme) || u.Port() == "" {
+			fmt.Fprintf(os.Stderr, "Error: -agents entries must look like https://host:port or ssh://[user@]host:port, got %q\n", raw)
+			os.Exit(1)
+		}
+	}
+	if *autoscaleCmd != "" && *autoscaleWebhook != "" {
+		fmt.Fprintf(os.Stderr, "Error: set only one of -autoscale-cmd and -autoscale-webhook\n")
+		os.Exit(1)
+	}
+	if *autoscaleMax > 0 && *autoscaleMax < *autoscaleMin {
+		fmt.Fprintf(os.Stderr, "Error: -autoscale-max-agents must not be below -autoscale-min-agents\n")
+		os.Exit(1)
+	}
+	if *queueMaxPerHour < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -queue-max-per-hour must not be negative\n")
+		os.Exit(1)
+	}
+
 	// Determine cert paths
 	agencyRoot := os.Getenv("AGENCY_ROOT")
 	if agencyRoot == "" {
@@ -96,10 +179,50 @@ func main() {
 		PortEnd:         *portEnd,
 		RefreshInterval: time.Second,
 		AccessLogPath:   *accessLog,
+		RestartCommand:  *restartCmd,
+		AuthToken:       *authToken,
+		IPFilter:        ipFilter,
+		TrustedProxies:  proxies,
+		SubtaskURL:      *subtaskURL,
+		PromptRules:     promptRules,
+		MetricsInterval: *metricsInterval,
+		GitHub: web.GitHubConfig{
+			WebhookSecret: *githubSecret,
+			Token:         *githubToken,
+			Label:         *githubLabel,
+		},
+
+		QueueMaxDispatchesPerHour: *queueMaxPerHour,
+		QueueDispatchWindows:      dispatchWindows,
+		QueueSourceWeights:        sourceWeights,
+		ComponentURLs:             splitList(*componentURLs),
+		Autoscale: web.AutoscaleConfig{
+			Command:    *autoscaleCmd,
+			WebhookURL: *autoscaleWebhook,
+			UpDepth:    *autoscaleUpDepth,
+			UpAfter:    *autoscaleUpAfter,
+			DownAfter:  *autoscaleDownAfter,
+			MinAgents:  *autoscaleMin,
+			MaxAgents:  *autoscaleMax,
+		},
 		TLS: web.TLSConfig{
 			CertFile:     certPath,
 			KeyFile:      keyPath,
 			AutoGenerate: true,
+			ACME: web.ACMEConfig{
+				Domains:      splitList(*acmeDomains),
+				Email:        *acmeEmail,
+				CacheDir:     filepath.Join(agencyRoot, "web-director", "acme"),
+				DirectoryURL: *acmeDirectory,
+				HTTPAddr:     *acmeHTTPAddr,
+			},
+		},
+		Backup: backup.Options{
+			Destination: *backupDest,
+			Endpoint:    *backupEndpoint,
+			Region:      *backupRegion,
+			Interval:    *backupInterval,
+			Retain:      *backupRetain,
 		},
 	}
 
@@ -148,3 +271,38 @@ func loadEnvPassword(path string) string {
 	}
 	return ""
 }
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// envInt reads an integer flag default from the environment, or 0 if unset
+// or invalid.
+func envInt(name string) int {
+	n, _ := strconv.Atoi(os.Getenv(name))
+	return n
+}
+
+// envDuration reads a duration flag default from the environment, or
+// fallback if unset or invalid.
+func envDuration(name string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(name)); err == nil {
+		return d
+	}
+	return fallback
+}
+
+// envOr reads a flag default from the environment, or fallback if unset.
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
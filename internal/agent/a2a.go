@@ -0,0 +1,489 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/history"
+	"phobos.org.uk/agency/internal/taskstate"
+)
+
+// A2A (Agent2Agent protocol) compatibility: a JSON-RPC 2.0 endpoint at
+// POST /a2a exposing tasks/send, tasks/get, tasks/cancel and the streaming
+// tasks/sendSubscribe and tasks/resubscribe, plus an agent card at
+// /.well-known/agent.json, so third-party orchestrators can drive the agent
+// without an Agency-specific adapter.
+
+// JSON-RPC and A2A error codes
+const (
+	a2aErrParse            = -32700
+	a2aErrInvalidRequest   = -32600
+	a2aErrMethodNotFound   = -32601
+	a2aErrInvalidParams    = -32602
+	a2aErrInternal         = -32603
+	a2aErrServer           = -32000 // Agent busy or draining; data.error has the api.Error* code
+	a2aErrTaskNotFound     = -32001
+	a2aErrTaskNotCancel    = -32002
+	a2aErrPushNotSupported = -32003
+)
+
+// A2A task states
+const (
+	a2aStateSubmitted = "submitted"
+	a2aStateWorking   = "working"
+	a2aStateCompleted = "completed"
+	a2aStateCanceled  = "canceled"
+	a2aStateFailed    = "failed"
+	a2aStateUnknown   = "unknown"
+)
+
+// a2aPollInterval is how often streams check the task for changes
+var a2aPollInterval = time.Second
+
+type a2aRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type a2aResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *a2aError       `json:"error,omitempty"`
+}
+
+type a2aError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+type a2aPart struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+}
+
+type a2aMessage struct {
+	Role  string    `json:"role"`
+	Parts []a2aPart `json:"parts"`
+}
+
+type a2aTaskStatus struct {
+	State     string      `json:"state"`
+	Message   *a2aMessage `json:"message,omitempty"`
+	Timestamp string      `json:"timestamp,omitempty"`
+}
+
+type a2aArtifact struct {
+	Name      string    `json:"name,omitempty"`
+	Parts     []a2aPart `json:"parts"`
+	Index     int       `json:"index"`
+	LastChunk bool      `json:"lastChunk,omitempty"`
+}
+
+type a2aTask struct {
+	ID        string         `json:"id"`
+	SessionID string         `json:"sessionId,omitempty"`
+	Status    a2aTaskStatus  `json:"status"`
+	Artifacts []a2aArtifact  `json:"artifacts,omitempty"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+}
+
+// a2aSendParams are the params of tasks/send and tasks/sendSubscribe
+type a2aSendParams struct {
+	ID        string     `json:"id"`
+	SessionID string     `json:"sessionId"`
+	Message   a2aMessage `json:"message"`
+	Metadata  struct {
+		Tier           string `json:"tier"`
+		TimeoutSeconds int    `json:"timeout_seconds"`
+	} `json:"metadata"`
+}
+
+// a2aTaskIDParams are the params of tasks/get, tasks/cancel and tasks/resubscribe
+type a2aTaskIDParams struct {
+	ID string `json:"id"`
+}
+
+type a2aStatusUpdate struct {
+	ID     string        `json:"id"`
+	Status a2aTaskStatus `json:"status"`
+	Final  bool          `json:"final"`
+}
+
+type a2aArtifactUpdate struct {
+	ID       string      `json:"id"`
+	Artifact a2aArtifact `json:"artifact"`
+}
+
+// handleAgentCard serves the A2A agent card used for discovery.
+func (a *Agent) handleAgentCard(w http.ResponseWriter, r *http.Request) {
+	cfg := a.cfg()
+	card := map[string]any{
+		"name":        fmt.Sprintf("agency-%s-%s", a.agentKind, cfg.Name),
+		"description": fmt.Sprintf("Agency %s agent: runs coding tasks in a session workspace", a.agentKind),
+		"url":         "https://" + r.Host + "/a2a",
+		"version":     a.version,
+		"capabilities": map[string]bool{
+			"streaming":              true,
+			"pushNotifications":      false,
+			"stateTransitionHistory": false,
+		},
+		"defaultInputModes":  []string{"text"},
+		"defaultOutputModes": []string{"text"},
+		"skills": []map[string]any{{
+			"id":          "task",
+			"name":        "Run task",
+			"description": "Carry out a prompt with the agent's CLI. metadata.tier (fast, standard, heavy) and metadata.timeout_seconds are honoured; reuse sessionId to continue a conversation.",
+		}},
+	}
+	if cfg.AuthToken != "" {
+		card["authentication"] = map[string]any{"schemes": []string{"bearer"}}
+	}
+	api.WriteJSON(w, http.StatusOK, card)
+}
+
+// handleA2A dispatches an A2A JSON-RPC request.
+func (a *Agent) handleA2A(w http.ResponseWriter, r *http.Request) {
+	var req a2aRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeA2AError(w, nil, a2aErrParse, "Parse error: "+err.Error())
+		return
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		writeA2AError(w, req.ID, a2aErrInvalidRequest, "Invalid request: jsonrpc must be \"2.0\" and method is required")
+		return
+	}
+
+	switch req.Method {
+	case "tasks/send", "tasks/sendSubscribe":
+		var params a2aSendParams
+		if !decodeA2AParams(w, req, &params) {
+			return
+		}
+		taskID, rpcErr := a.startA2ATask(params, api.RequestIDFromContext(r.Context()))
+		if rpcErr != nil {
+			writeA2AResponse(w, a2aResponse{JSONRPC: "2.0", ID: req.ID, Error: rpcErr})
+			return
+		}
+		if req.Method == "tasks/sendSubscribe" {
+			a.streamA2ATask(w, r, req.ID, taskID)
+			return
+		}
+		a.writeA2ATask(w, req.ID, taskID)
+
+	case "tasks/get":
+		var params a2aTaskIDParams
+		if !decodeA2AParams(w, req, &params) {
+			return
+		}
+		a.writeA2ATask(w, req.ID, params.ID)
+
+	case "tasks/cancel":
+		var params a2aTaskIDParams
+		if !decodeA2AParams(w, req, &params) {
+			return
+		}
+		if _, err := a.cancelTask(params.ID); err != nil {
+			if errors.Is(err, errTaskCompleted) {
+				writeA2AError(w, req.ID, a2aErrTaskNotCancel, "Task cannot be canceled")
+				return
+			}
+			if _, ok := a.a2aTaskSnapshot(params.ID); ok {
+				// Finished and moved to history
+				writeA2AError(w, req.ID, a2aErrTaskNotCancel, "Task cannot be canceled")
+				return
+			}
+			writeA2AError(w, req.ID, a2aErrTaskNotFound, "Task not found")
+			return
+		}
+		a.writeA2ATask(w, req.ID, params.ID)
+
+	case "tasks/resubscribe":
+		var params a2aTaskIDParams
+		if !decodeA2AParams(w, req, &params) {
+			return
+		}
+		if _, ok := a.a2aTaskSnapshot(params.ID); !ok {
+			writeA2AError(w, req.ID, a2aErrTaskNotFound, "Task not found")
+			return
+		}
+		a.streamA2ATask(w, r, req.ID, params.ID)
+
+	case "tasks/pushNotification/set", "tasks/pushNotification/get":
+		writeA2AError(w, req.ID, a2aErrPushNotSupported, "Push notifications are not supported")
+
+	default:
+		writeA2AError(w, req.ID, a2aErrMethodNotFound, "Method not found: "+req.Method)
+	}
+}
+
+// startA2ATask starts a task from tasks/send params, returning its ID.
+func (a *Agent) startA2ATask(params a2aSendParams, requestID string) (string, *a2aError) {
+	invalid := func(msg string) (string, *a2aError) {
+		return "", &a2aError{Code: a2aErrInvalidParams, Message: msg}
+	}
+
+	var texts []string
+	for _, part := range params.Message.Parts {
+		if part.Type != "text" {
+			return invalid(fmt.Sprintf("unsupported part type %q: only text parts are accepted", part.Type))
+		}
+		texts = append(texts, part.Text)
+	}
+
+	if params.ID != "" {
+		if !isSafeSessionID(params.ID) {
+			return invalid("id contains invalid characters")
+		}
+		if _, exists := a.a2aTaskSnapshot(params.ID); exists {
+			return invalid(fmt.Sprintf("task %s already exists; send a new task with the same sessionId to continue", params.ID))
+		}
+	}
+
+	req := TaskRequest{
+		Prompt:         strings.TrimSpace(strings.Join(texts, "\n\n")),
+		Tier:           params.Metadata.Tier,
+		TimeoutSeconds: params.Metadata.TimeoutSeconds,
+		RequestID:      requestID,
+	}
+	// A sessionId continues a session this agent has run; any other value
+	// starts a new session, whose ID is returned in the task's sessionId
+	if params.SessionID != "" && isSafeSessionID(params.SessionID) {
+		if info, err := os.Stat(filepath.Join(a.cfg().SessionDir, params.SessionID)); err == nil && info.IsDir() {
+			req.SessionID = params.SessionID
+		}
+	}
+
+	task, err := a.startTask(req, params.ID)
+	if err != nil {
+		if err.Status == http.StatusBadRequest {
+			return invalid(err.Message)
+		}
+		code := a2aErrServer
+		if err.Status == http.StatusInternalServerError {
+			code = a2aErrInternal
+		}
+		data := map[string]string{"error": err.Code}
+		if err.CurrentTask != "" {
+			data["current_task"] = err.CurrentTask
+		}
+		return "", &a2aError{Code: code, Message: err.Message, Data: data}
+	}
+	return task.ID, nil
+}
+
+// writeA2ATask responds with the current state of a task.
+func (a *Agent) writeA2ATask(w http.ResponseWriter, rpcID json.RawMessage, taskID string) {
+	task, ok := a.a2aTaskSnapshot(taskID)
+	if !ok {
+		writeA2AError(w, rpcID, a2aErrTaskNotFound, "Task not found")
+		return
+	}
+	writeA2AResponse(w, a2aResponse{JSONRPC: "2.0", ID: rpcID, Result: task})
+}
+
+// streamA2ATask sends the task's status changes as server-sent events until
+// it finishes or the client goes away. The output artifact precedes the
+// final status event.
+func (a *Agent) streamA2ATask(w http.ResponseWriter, r *http.Request, rpcID json.RawMessage, taskID string) {
+	rc := http.NewResponseController(w)
+	// Tasks outlive the server's write timeout
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(result any) bool {
+		data, err := json.Marshal(a2aResponse{JSONRPC: "2.0", ID: rpcID, Result: result})
+		if err != nil {
+			return false
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	ticker := time.NewTicker(a2aPollInterval)
+	defer ticker.Stop()
+
+	lastState := ""
+	for {
+		task, ok := a.a2aTaskSnapshot(taskID)
+		if !ok {
+			return
+		}
+		if task.Status.State != lastState {
+			lastState = task.Status.State
+			final := isA2ATerminal(lastState)
+			if final {
+				for _, artifact := range task.Artifacts {
+					if !send(a2aArtifactUpdate{ID: task.ID, Artifact: artifact}) {
+						return
+					}
+				}
+			}
+			if !send(a2aStatusUpdate{ID: task.ID, Status: task.Status, Final: final}) || final {
+				return
+			}
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// a2aTaskSnapshot returns a task in A2A form, from memory while it runs or
+// from history once it has finished.
+func (a *Agent) a2aTaskSnapshot(taskID string) (a2aTask, bool) {
+	a.mu.RLock()
+	if task, ok := a.tasks[taskID]; ok {
+		snapshot := a2aTask{
+			ID:        task.ID,
+			SessionID: task.SessionID,
+			Status:    a2aTaskStatus{State: a2aState(task.State)},
+		}
+		timestamp := task.StartedAt
+		if task.CompletedAt != nil {
+			timestamp = task.CompletedAt
+		}
+		if timestamp != nil {
+			snapshot.Status.Timestamp = timestamp.Format(time.RFC3339)
+		}
+		if task.State.IsTerminal() {
+			var errMsg string
+			if task.Error != nil {
+				errMsg = task.Error.Message
+			}
+			fillA2AResult(&snapshot, task.Output, errMsg)
+			snapshot.Metadata = a2aMetadata(task.DurationSeconds, task.TokenUsage)
+		}
+		a.mu.RUnlock()
+		return snapshot, true
+	}
+	a.mu.RUnlock()
+
+	if a.history == nil {
+		return a2aTask{}, false
+	}
+	entry, err := a.history.Get(taskID)
+	if err != nil {
+		return a2aTask{}, false
+	}
+	return a2aTaskFromHistory(entry), true
+}
+
+// a2aTaskFromHistory converts a finished task's history entry.
+func a2aTaskFromHistory(entry *history.Entry) a2aTask {
+	snapshot := a2aTask{
+		ID:        entry.TaskID,
+		SessionID: entry.SessionID,
+		Status:    a2aTaskStatus{State: a2aState(taskstate.State(entry.State))},
+	}
+	if !entry.CompletedAt.IsZero() {
+		snapshot.Status.Timestamp = entry.CompletedAt.Format(time.RFC3339)
+	}
+	var errMsg string
+	if entry.Error != nil {
+		errMsg = entry.Error.Message
+	}
+	fillA2AResult(&snapshot, entry.Output, errMsg)
+	var usage *TokenUsage
+	if entry.TokenUsage != nil {
+		usage = &TokenUsage{Input: entry.TokenUsage.Input, Output: entry.TokenUsage.Output}
+	}
+	snapshot.Metadata = a2aMetadata(entry.DurationSeconds, usage)
+	return snapshot
+}
+
+// fillA2AResult adds a finished task's output as an artifact and any error as
+// the status message.
+func fillA2AResult(task *a2aTask, output, errMsg string) {
+	if output != "" {
+		task.Artifacts = []a2aArtifact{{
+			Name:      "output",
+			Parts:     []a2aPart{{Type: "text", Text: output}},
+			LastChunk: true,
+		}}
+	}
+	if errMsg != "" {
+		task.Status.Message = &a2aMessage{Role: "agent", Parts: []a2aPart{{Type: "text", Text: errMsg}}}
+	}
+}
+
+// a2aMetadata reports Agency-specific task details.
+func a2aMetadata(durationSeconds float64, usage *TokenUsage) map[string]any {
+	metadata := map[string]any{"duration_seconds": durationSeconds}
+	if usage != nil {
+		metadata["token_usage"] = *usage
+	}
+	return metadata
+}
+
+// a2aState maps task states onto A2A's.
+func a2aState(state taskstate.State) string {
+	switch state {
+	case taskstate.Queued:
+		return a2aStateSubmitted
+	case taskstate.Working:
+		return a2aStateWorking
+	case taskstate.Completed:
+		return a2aStateCompleted
+	case taskstate.Cancelled:
+		return a2aStateCanceled
+	case taskstate.Failed:
+		return a2aStateFailed
+	default:
+		return a2aStateUnknown
+	}
+}
+
+func isA2ATerminal(state string) bool {
+	switch state {
+	case a2aStateCompleted, a2aStateCanceled, a2aStateFailed:
+		return true
+	}
+	return false
+}
+
+// decodeA2AParams decodes the request params, responding with an error if
+// they are malformed.
+func decodeA2AParams(w http.ResponseWriter, req a2aRequest, v any) bool {
+	if len(req.Params) == 0 {
+		writeA2AError(w, req.ID, a2aErrInvalidParams, "params are required")
+		return false
+	}
+	if err := json.Unmarshal(req.Params, v); err != nil {
+		writeA2AError(w, req.ID, a2aErrInvalidParams, "Invalid params: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeA2AError(w http.ResponseWriter, id json.RawMessage, code int, msg string) {
+	writeA2AResponse(w, a2aResponse{JSONRPC: "2.0", ID: id, Error: &a2aError{Code: code, Message: msg}})
+}
+
+// writeA2AResponse writes a JSON-RPC response. JSON-RPC reports errors in the
+// body, so the HTTP status is always 200.
+func writeA2AResponse(w http.ResponseWriter, resp a2aResponse) {
+	if resp.ID == nil {
+		resp.ID = json.RawMessage("null")
+	}
+	api.WriteJSON(w, http.StatusOK, resp)
+}
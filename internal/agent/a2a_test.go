@@ -0,0 +1,211 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/config"
+)
+
+type a2aTestResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result a2aTask         `json:"result"`
+	Error  *a2aError       `json:"error"`
+}
+
+func a2aCall(t *testing.T, a *Agent, body string) a2aTestResponse {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/a2a", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp a2aTestResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), w.Body.String())
+	return resp
+}
+
+// newA2ATestAgent returns an agent whose CLI is a script printing "finished"
+// after delay.
+func newA2ATestAgent(t *testing.T, delay string) *Agent {
+	t.Helper()
+	tmpDir := t.TempDir()
+	mockPath := filepath.Join(tmpDir, "mock-claude")
+	script := "#!/bin/bash\nsleep " + delay + "\necho '{\"type\":\"result\",\"subtype\":\"success\",\"result\":\"finished\"}'\n"
+	require.NoError(t, os.WriteFile(mockPath, []byte(script), 0755))
+	t.Setenv("CLAUDE_BIN", mockPath)
+
+	promptsDir := filepath.Join(tmpDir, "prompts")
+	require.NoError(t, os.MkdirAll(promptsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "claude-prod.md"), []byte("# Test Instructions"), 0644))
+
+	cfg := config.Default()
+	cfg.SessionDir = filepath.Join(tmpDir, "sessions")
+	cfg.HistoryDir = filepath.Join(tmpDir, "history")
+	cfg.AgencyPromptsDir = promptsDir
+	return New(cfg, "test")
+}
+
+func TestA2AAgentCard(t *testing.T) {
+	t.Parallel()
+
+	a := New(config.Default(), "test-version")
+	req := httptest.NewRequest("GET", "/.well-known/agent.json", nil)
+	req.Host = "localhost:9000"
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var card struct {
+		URL          string          `json:"url"`
+		Version      string          `json:"version"`
+		Capabilities map[string]bool `json:"capabilities"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &card))
+	require.Equal(t, "https://localhost:9000/a2a", card.URL)
+	require.Equal(t, "test-version", card.Version)
+	require.True(t, card.Capabilities["streaming"])
+}
+
+func TestA2AProtocolErrors(t *testing.T) {
+	t.Parallel()
+
+	a := New(config.Default(), "test")
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"parse error", `{nope`, a2aErrParse},
+		{"wrong version", `{"jsonrpc":"1.0","id":1,"method":"tasks/get"}`, a2aErrInvalidRequest},
+		{"unknown method", `{"jsonrpc":"2.0","id":1,"method":"tasks/fly","params":{}}`, a2aErrMethodNotFound},
+		{"missing params", `{"jsonrpc":"2.0","id":1,"method":"tasks/get"}`, a2aErrInvalidParams},
+		{"unknown task", `{"jsonrpc":"2.0","id":1,"method":"tasks/get","params":{"id":"task-missing"}}`, a2aErrTaskNotFound},
+		{"cancel unknown task", `{"jsonrpc":"2.0","id":1,"method":"tasks/cancel","params":{"id":"task-missing"}}`, a2aErrTaskNotFound},
+		{"file part", `{"jsonrpc":"2.0","id":1,"method":"tasks/send","params":{"message":{"role":"user","parts":[{"type":"file"}]}}}`, a2aErrInvalidParams},
+		{"empty prompt", `{"jsonrpc":"2.0","id":1,"method":"tasks/send","params":{"message":{"role":"user","parts":[]}}}`, a2aErrInvalidParams},
+		{"unsafe id", `{"jsonrpc":"2.0","id":1,"method":"tasks/send","params":{"id":"../x","message":{"role":"user","parts":[{"type":"text","text":"hi"}]}}}`, a2aErrInvalidParams},
+		{"push notifications", `{"jsonrpc":"2.0","id":1,"method":"tasks/pushNotification/set","params":{}}`, a2aErrPushNotSupported},
+	}
+	for _, tt := range tests {
+		resp := a2aCall(t, a, tt.body)
+		require.NotNil(t, resp.Error, tt.name)
+		require.Equal(t, tt.code, resp.Error.Code, tt.name)
+	}
+}
+
+func TestA2ASendAndGet(t *testing.T) {
+	// Cannot use t.Parallel() with t.Setenv()
+	a := newA2ATestAgent(t, "0.2")
+
+	resp := a2aCall(t, a, `{"jsonrpc":"2.0","id":"req-1","method":"tasks/send","params":{
+		"id":"a2a-task-1",
+		"message":{"role":"user","parts":[{"type":"text","text":"do the thing"}]},
+		"metadata":{"tier":"fast"}}}`)
+	require.Nil(t, resp.Error)
+	require.JSONEq(t, `"req-1"`, string(resp.ID))
+	require.Equal(t, "a2a-task-1", resp.Result.ID)
+	require.NotEmpty(t, resp.Result.SessionID)
+	require.Contains(t, []string{a2aStateSubmitted, a2aStateWorking}, resp.Result.Status.State)
+
+	// The agent is busy until it finishes
+	busy := a2aCall(t, a, `{"jsonrpc":"2.0","id":2,"method":"tasks/send","params":{"message":{"role":"user","parts":[{"type":"text","text":"more"}]}}}`)
+	require.NotNil(t, busy.Error)
+	require.Equal(t, a2aErrServer, busy.Error.Code)
+
+	var task a2aTask
+	require.Eventually(t, func() bool {
+		task = a2aCall(t, a, `{"jsonrpc":"2.0","id":3,"method":"tasks/get","params":{"id":"a2a-task-1"}}`).Result
+		return task.Status.State == a2aStateCompleted
+	}, 5*time.Second, 50*time.Millisecond)
+	require.Len(t, task.Artifacts, 1)
+	require.Equal(t, "finished", task.Artifacts[0].Parts[0].Text)
+
+	// Finished tasks can't be cancelled or reused
+	cancel := a2aCall(t, a, `{"jsonrpc":"2.0","id":4,"method":"tasks/cancel","params":{"id":"a2a-task-1"}}`)
+	require.Equal(t, a2aErrTaskNotCancel, cancel.Error.Code)
+	reuse := a2aCall(t, a, `{"jsonrpc":"2.0","id":5,"method":"tasks/send","params":{"id":"a2a-task-1","message":{"role":"user","parts":[{"type":"text","text":"again"}]}}}`)
+	require.Equal(t, a2aErrInvalidParams, reuse.Error.Code)
+
+	// The session continues when its ID is sent back
+	next := a2aCall(t, a, `{"jsonrpc":"2.0","id":6,"method":"tasks/send","params":{"sessionId":"`+task.SessionID+`","message":{"role":"user","parts":[{"type":"text","text":"follow up"}]}}}`)
+	require.Nil(t, next.Error)
+	require.Equal(t, task.SessionID, next.Result.SessionID)
+	a.mu.RLock()
+	require.True(t, a.tasks[next.Result.ID].ResumeSession)
+	a.mu.RUnlock()
+	require.Eventually(t, func() bool {
+		return a2aCall(t, a, `{"jsonrpc":"2.0","id":7,"method":"tasks/get","params":{"id":"`+next.Result.ID+`"}}`).Result.Status.State == a2aStateCompleted
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestA2ACancel(t *testing.T) {
+	// Cannot use t.Parallel() with t.Setenv()
+	a := newA2ATestAgent(t, "10")
+
+	resp := a2aCall(t, a, `{"jsonrpc":"2.0","id":1,"method":"tasks/send","params":{"message":{"role":"user","parts":[{"type":"text","text":"long"}]}}}`)
+	require.Nil(t, resp.Error)
+	require.Eventually(t, func() bool {
+		return a2aCall(t, a, `{"jsonrpc":"2.0","id":3,"method":"tasks/get","params":{"id":"`+resp.Result.ID+`"}}`).Result.Status.State == a2aStateWorking
+	}, 5*time.Second, 20*time.Millisecond)
+
+	cancel := a2aCall(t, a, `{"jsonrpc":"2.0","id":2,"method":"tasks/cancel","params":{"id":"`+resp.Result.ID+`"}}`)
+	require.Nil(t, cancel.Error)
+	require.Equal(t, a2aStateCanceled, cancel.Result.Status.State)
+
+	require.Eventually(t, func() bool {
+		a.mu.RLock()
+		defer a.mu.RUnlock()
+		return a.state == StateIdle
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestA2ASendSubscribe(t *testing.T) {
+	// Cannot use t.Parallel() with t.Setenv()
+	a := newA2ATestAgent(t, "0.2")
+	a2aPollInterval = 20 * time.Millisecond
+	t.Cleanup(func() { a2aPollInterval = time.Second })
+
+	req := httptest.NewRequest("POST", "/a2a", strings.NewReader(`{"jsonrpc":"2.0","id":9,"method":"tasks/sendSubscribe","params":{
+		"message":{"role":"user","parts":[{"type":"text","text":"stream it"}]}}}`))
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req) // Returns once the task finishes
+
+	require.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	var events []map[string]json.RawMessage
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var resp struct {
+			ID     json.RawMessage            `json:"id"`
+			Result map[string]json.RawMessage `json:"result"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(data), &resp))
+		require.JSONEq(t, "9", string(resp.ID))
+		events = append(events, resp.Result)
+	}
+	require.GreaterOrEqual(t, len(events), 3)
+
+	// Status updates, then the output artifact, then the final status
+	last := events[len(events)-1]
+	require.JSONEq(t, "true", string(last["final"]))
+	var status a2aTaskStatus
+	require.NoError(t, json.Unmarshal(last["status"], &status))
+	require.Equal(t, a2aStateCompleted, status.State)
+
+	var artifact a2aArtifact
+	require.NoError(t, json.Unmarshal(events[len(events)-2]["artifact"], &artifact))
+	require.Equal(t, "finished", artifact.Parts[0].Text)
+
+	require.JSONEq(t, "false", string(events[0]["final"]))
+}
@@ -4,7 +4,10 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -22,11 +25,13 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/google/uuid"
 	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/backup"
 	"phobos.org.uk/agency/internal/config"
 	"phobos.org.uk/agency/internal/history"
 	"phobos.org.uk/agency/internal/logging"
 	"phobos.org.uk/agency/internal/stream"
 	"phobos.org.uk/agency/internal/taskstate"
+	"phobos.org.uk/agency/internal/tlsutil"
 )
 
 // State represents the agent's current state
@@ -36,6 +41,7 @@ const (
 	StateIdle       State = "idle"
 	StateWorking    State = "working"
 	StateCancelling State = "cancelling"
+	StateDraining   State = "draining" // Reported while no new tasks are accepted
 )
 
 // TaskState is an alias to taskstate.State for backward compatibility.
@@ -52,25 +58,46 @@ const (
 
 // Task represents a task execution
 type Task struct {
-	ID              string        `json:"task_id"`
-	State           TaskState     `json:"state"`
-	Prompt          string        `json:"-"`
-	Model           string        `json:"-"`
-	Timeout         time.Duration `json:"-"`
-	StartedAt       *time.Time    `json:"started_at,omitempty"`
-	CompletedAt     *time.Time    `json:"completed_at,omitempty"`
-	ExitCode        *int          `json:"exit_code,omitempty"`
-	Output          string        `json:"output,omitempty"`
-	Error           *TaskError    `json:"error,omitempty"`
-	SessionID       string        `json:"session_id,omitempty"`
-	ResumeSession   bool          `json:"-"` // True if continuing an existing session
-	WorkDir         string        `json:"-"` // Working directory for task execution
-	TokenUsage      *TokenUsage   `json:"token_usage,omitempty"`
-	DurationSeconds float64       `json:"duration_seconds,omitempty"`
+	ID              string           `json:"task_id"`
+	State           TaskState        `json:"state"`
+	Prompt          string           `json:"-"`
+	Model           string           `json:"-"`
+	Timeout         time.Duration    `json:"-"`
+	StartedAt       *time.Time       `json:"started_at,omitempty"`
+	CompletedAt     *time.Time       `json:"completed_at,omitempty"`
+	ExitCode        *int             `json:"exit_code,omitempty"`
+	Output          string           `json:"output,omitempty"`
+	Error           *TaskError       `json:"error,omitempty"`
+	SessionID       string           `json:"session_id,omitempty"`
+	ParentTaskID    string           `json:"parent_task_id,omitempty"` // Task that spawned this one as a subtask
+	RequestID       string           `json:"request_id,omitempty"`     // Correlates the task with the requests that led to it
+	RerunOf         string           `json:"rerun_of,omitempty"`       // Task this one re-runs
+	ResumeSession   bool             `json:"-"`                        // True if continuing an existing session
+	WorkDir         string           `json:"-"`                        // Working directory for task execution
+	Diff            string           `json:"-"`                        // Patch captured in worktree mode
+	TokenUsage      *TokenUsage      `json:"token_usage,omitempty"`
+	DurationSeconds float64          `json:"duration_seconds,omitempty"`
+	OutputTruncated bool             `json:"output_truncated,omitempty"` // CLI output exceeded output.max_bytes
+	OutputBytes     int64            `json:"output_bytes,omitempty"`     // Total CLI output size
+	CapturedBytes   int64            `json:"captured_bytes,omitempty"`   // CLI output kept in memory
+	Redactions      int              `json:"redactions,omitempty"`       // Secrets scrubbed from output and errors
+	spilled         bool             // Excess output was written to the history spill file
+	attachments     []api.Attachment // Written into the workdir when the task starts
+
+	api.RunnerOptions `json:"-"` // Per-task runner overrides (validated)
 
 	maxTurnsResumes int // Number of auto-resumes due to max_turns limit
 	cmd             *exec.Cmd
 	cancel          context.CancelFunc
+
+	hasEnv       bool     // Run with per-task env, which isn't persisted
+	cliSessionID string   // Session ID from the CLI's output, for resuming after a restart
+	timeline     timeline // Tool calls so far
+
+	agencyPrompt *history.PromptStamp // Agency prompt the latest run was given
+
+	tier           string // As requested, kept in history for re-runs
+	timeoutSeconds int    // As requested (0 = default), kept in history for re-runs
 }
 
 // TaskError represents an error during task execution
@@ -91,7 +118,12 @@ type TaskRequest struct {
 	Tier           string            `json:"tier,omitempty"`
 	TimeoutSeconds int               `json:"timeout_seconds,omitempty"`
 	SessionID      string            `json:"session_id,omitempty"`
-	Env            map[string]string `json:"env,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`            // Values of the form "secret:<name>" come from the secrets file
+	ParentTaskID   string            `json:"parent_task_id,omitempty"` // Set by the director for subtasks
+	Attachments    []api.Attachment  `json:"attachments,omitempty"`    // Files written to <workdir>/attachments
+	RequestID      string            `json:"-"`                        // From the X-Agency-Request-ID header
+	RerunOf        string            `json:"-"`                        // Set by POST /history/{id}/rerun
+	api.RunnerOptions
 }
 
 const maxSessionIDLen = 128
@@ -103,11 +135,18 @@ type StatusResponse struct {
 	Type          string           `json:"type"`
 	Interfaces    []string         `json:"interfaces"`
 	Version       string           `json:"version"`
+	AgentID       string           `json:"agent_id,omitempty"`
 	AgentKind     string           `json:"agent_kind"`
+	Tiers         []string         `json:"tiers,omitempty"` // Tiers explicitly configured (routing hint)
 	State         State            `json:"state"`
 	UptimeSeconds float64          `json:"uptime_seconds"`
 	CurrentTask   *api.CurrentTask `json:"current_task"`
 	Config        StatusConfig     `json:"config"`
+
+	APIVersion   int      `json:"api_version"`
+	Capabilities []string `json:"capabilities"`
+
+	Backup *backup.Status `json:"backup,omitempty"` // Set when backups are configured
 }
 
 // StatusConfig shows agent config in status
@@ -118,20 +157,30 @@ type StatusConfig struct {
 
 // Agent is the main agent server
 type Agent struct {
-	config    *config.Config
 	version   string
 	startTime time.Time
 	history   *history.Store
+	backups   *backup.Runner // nil = backups off
 	log       *logging.Logger
 	runner    Runner
 	agentKind string
 
 	mu          sync.RWMutex
 	state       State
+	draining    bool // Set by /drain; agent exits once idle
 	currentTask *Task
 	tasks       map[string]*Task
 
-	server *http.Server
+	server        *http.Server
+	stopCertWatch context.CancelFunc // Stops reloading the TLS certificate
+
+	cfgMu         sync.RWMutex
+	config        *config.Config // Replaced wholesale on reload; read via cfg()
+	configModTime time.Time      // Modification time of the last loaded config file
+	configPath    string         // File PUT /config saves to, if any
+	configUpdate  sync.Mutex     // Serializes PUT /config
+	promptUpdate  sync.Mutex     // Serializes PUT /prompts/{name}
+	restoreMu     sync.Mutex     // Held while POST /admin/restore runs
 }
 
 // New creates a new Agent
@@ -165,6 +214,17 @@ func NewWithRunner(cfg *config.Config, version string, runner Runner) *Agent {
 		MaxEntries: 1000,
 	})
 
+	// Resolve stable agent ID (persisted so it survives restarts)
+	if cfg.ID == "" {
+		id, err := loadOrCreateAgentID(config.DefaultAgentIDPath(cfg.Name, cfg.AgentKind))
+		if err != nil {
+			id = uuid.New().String()
+			log.Warn("failed to persist agent ID, using ephemeral ID", map[string]any{"error": err.Error()})
+		}
+		cfg.ID = id
+	}
+	addLogSinks(log, cfg.Log, "agent", cfg.ID)
+
 	// Initialize history store
 	var historyStore *history.Store
 	if cfg.HistoryDir != "" {
@@ -175,7 +235,7 @@ func NewWithRunner(cfg *config.Config, version string, runner Runner) *Agent {
 		}
 	}
 
-	return &Agent{
+	a := &Agent{
 		config:    cfg,
 		version:   version,
 		startTime: time.Now(),
@@ -186,6 +246,9 @@ func NewWithRunner(cfg *config.Config, version string, runner Runner) *Agent {
 		state:     StateIdle,
 		tasks:     make(map[string]*Task),
 	}
+	a.loadRedactor()
+	a.backups = a.newBackupRunner()
+	return a
 }
 
 // corsMiddleware adds CORS headers for cross-origin requests from the web view
@@ -193,8 +256,8 @@ func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Allow requests from any origin (local development)
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 		// Handle preflight requests
 		if r.Method == "OPTIONS" {
@@ -212,31 +275,65 @@ func (a *Agent) Router() chi.Router {
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RealIP)
 	r.Use(corsMiddleware)
+	r.Use(api.RequestID)
+	r.Use(api.RequireAuthToken(a.config.AuthToken))
 
 	r.Get("/status", a.handleStatus)
+	r.Get("/healthz", api.HandleHealthz)
+	r.Get("/readyz", api.ReadyzHandler(a.readinessChecks()...))
 	r.Post("/task", a.handleCreateTask)
 	r.Get("/task/{id}", a.handleGetTask)
 	r.Post("/task/{id}/cancel", a.handleCancelTask)
+	r.Get("/task/{id}/diff", a.handleGetTaskDiff)
 	r.Post("/shutdown", a.handleShutdown)
+	r.Post("/drain", a.handleDrain)
+	r.Get("/config", a.handleGetConfig)
+	r.Put("/config", a.handlePutConfig)
+	r.Get("/prompts", a.handleListPrompts)
+	r.Get("/prompts/{name}", a.handleGetPrompt)
+	r.Put("/prompts/{name}", a.handlePutPrompt)
+
+	// Session workdir endpoints
+	r.Get("/sessions", a.handleListSessions)
+	r.Get("/sessions/disk-usage", a.handleSessionDiskUsage)
+	r.Post("/sessions/cleanup", a.handleSessionCleanup)
+	r.Delete("/sessions/{id}", a.handleDeleteSession)
+
+	// Admin endpoints
+	r.Post("/admin/restore", a.handleRestore)
+
+	// A2A protocol endpoints
+	r.Get("/.well-known/agent.json", a.handleAgentCard)
+	r.Post("/a2a", a.handleA2A)
 
 	// History endpoints
 	r.Get("/history", a.handleListHistory)
+	r.Get("/history/diff", a.handleHistoryDiff)
+	r.Get("/history/export", a.handleExportHistory)
+	r.Get("/history/sessions", a.handleListHistorySessions)
+	r.Get("/history/sessions/{session_id}", a.handleGetHistorySession)
 	r.Get("/history/{id}", a.handleGetHistory)
+	r.Patch("/history/{id}", a.handlePatchHistory)
+	r.Post("/history/{id}/rerun", a.handleRerunTask)
 	r.Get("/history/{id}/debug", a.handleGetHistoryDebug)
+	r.Get("/history/{id}/spill", a.handleGetHistorySpill)
+	r.Get("/history/{id}/artifacts", a.handleListArtifacts)
+	r.Get("/history/{id}/artifacts/*", a.handleGetArtifact)
 
 	// Logging endpoints
 	r.Get("/logs", a.handleLogs)
 	r.Get("/logs/stats", a.handleLogStats)
+	r.Get("/logs/stream", a.handleLogStream)
 
 	return r
 }
 
 // Start starts the agent server
 func (a *Agent) Start() error {
-	addr := net.JoinHostPort(a.config.Bind, strconv.Itoa(a.config.Port))
+	addr := net.JoinHostPort(a.cfg().Bind, strconv.Itoa(a.cfg().Port))
 
 	// Setup TLS certificates
-	certDir := filepath.Join(a.config.SessionDir, ".certs")
+	certDir := filepath.Join(a.cfg().SessionDir, ".certs")
 	certPath := filepath.Join(certDir, "cert.pem")
 	keyPath := filepath.Join(certDir, "key.pem")
 
@@ -244,10 +341,24 @@ func (a *Agent) Start() error {
 		return fmt.Errorf("ensuring TLS cert: %w", err)
 	}
 
+	// Replacing the cert files takes effect without a restart
+	certs, err := tlsutil.NewCertReloader(certPath, keyPath)
+	if err != nil {
+		return err
+	}
+	watchCtx, stopCertWatch := context.WithCancel(context.Background())
+	a.stopCertWatch = stopCertWatch
+	go certs.Watch(watchCtx, tlsutil.DefaultCertCheckInterval)
+	tlsConfig := getTLSConfig()
+	tlsConfig.GetCertificate = certs.GetCertificate
+
+	// Before taking new work, settle any task the last run left behind
+	a.adoptInflightTask()
+
 	a.server = &http.Server{
 		Addr:              addr,
 		Handler:           a.Router(),
-		TLSConfig:         getTLSConfig(),
+		TLSConfig:         tlsConfig,
 		ReadHeaderTimeout: 5 * time.Second,
 		ReadTimeout:       30 * time.Second,
 		WriteTimeout:      30 * time.Second,
@@ -256,12 +367,18 @@ func (a *Agent) Start() error {
 	}
 
 	a.log.Info("agent starting", map[string]any{
-		"addr":    addr,
-		"version": a.version,
-		"model":   a.defaultModel(),
-		"tls":     "enabled",
+		"addr":     addr,
+		"agent_id": a.cfg().ID,
+		"version":  a.version,
+		"model":    a.defaultModel(),
+		"tls":      "enabled",
 	})
-	return a.server.ListenAndServeTLS(certPath, keyPath)
+	err = a.server.ListenAndServeTLS("", "")
+	if errors.Is(err, http.ErrServerClosed) {
+		// Clean exit after Shutdown (e.g. completed drain)
+		return nil
+	}
+	return err
 }
 
 // Shutdown gracefully shuts down the agent
@@ -279,10 +396,17 @@ func (a *Agent) Shutdown(ctx context.Context) error {
 	}
 	a.mu.Unlock()
 
+	if a.stopCertWatch != nil {
+		a.stopCertWatch()
+	}
+	var err error
 	if a.server != nil {
-		return a.server.Shutdown(ctx)
+		err = a.server.Shutdown(ctx)
 	}
-	return nil
+	if closeErr := a.log.Close(); closeErr != nil {
+		a.log.Warn("failed to close log sinks", map[string]any{"error": closeErr.Error()})
+	}
+	return err
 }
 
 // handleStatus returns the agent's current state, version, uptime, and config.
@@ -293,15 +417,27 @@ func (a *Agent) handleStatus(w http.ResponseWriter, r *http.Request) {
 
 	resp := StatusResponse{
 		Type:          api.TypeAgent,
-		Interfaces:    []string{api.InterfaceStatusable, api.InterfaceTaskable},
+		Interfaces:    []string{api.InterfaceStatusable, api.InterfaceTaskable, api.InterfaceConfigurable},
 		Version:       a.version,
+		AgentID:       a.cfg().ID,
 		AgentKind:     a.agentKind,
+		Tiers:         a.cfg().Tiers.Configured(),
 		State:         a.state,
 		UptimeSeconds: time.Since(a.startTime).Seconds(),
 		Config: StatusConfig{
-			Port:  a.config.Port,
+			Port:  a.cfg().Port,
 			Model: a.defaultModel(),
 		},
+		APIVersion:   api.APIVersion,
+		Capabilities: a.capabilities(),
+	}
+
+	if a.draining {
+		resp.State = StateDraining
+	}
+	if a.backups != nil {
+		status := a.backups.Status()
+		resp.Backup = &status
 	}
 
 	if a.currentTask != nil && a.currentTask.StartedAt != nil {
@@ -319,6 +455,58 @@ func (a *Agent) handleStatus(w http.ResponseWriter, r *http.Request) {
 	api.WriteJSON(w, http.StatusOK, resp)
 }
 
+// capabilities lists the optional features this agent supports. The timeline
+// is built from Claude's stream output, so Codex agents don't offer it.
+func (a *Agent) capabilities() []string {
+	caps := []string{
+		api.CapabilityA2A,
+		api.CapabilityAnnotations,
+		api.CapabilityArtifacts,
+		api.CapabilityAttachments,
+		api.CapabilityHistoryExport,
+		api.CapabilityLiveOutput,
+		api.CapabilityPrompts,
+		api.CapabilityRequestID,
+		api.CapabilityRerun,
+		api.CapabilityRestore,
+		api.CapabilityRunnerOptions,
+		api.CapabilitySSE,
+		api.CapabilityTaskEnv,
+	}
+	if a.agentKind == api.AgentKindClaude {
+		caps = append(caps, api.CapabilityTimeline)
+	}
+	return caps
+}
+
+// runnerEnviron returns the agent's environment for a task's CLI, without
+// the variables overriding agent config keys, which include the auth token,
+// and the fleet's AG_AUTH_TOKEN. A prompt-injected task could otherwise read
+// and leak them. Other AGENCY_ variables, such as AGENCY_ROOT, are kept.
+func runnerEnviron() []string {
+	strip := map[string]bool{api.AuthTokenEnv: true}
+	for _, name := range config.EnvNames(&config.Config{}, config.EnvPrefix) {
+		strip[name] = true
+	}
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if strip[name] {
+			continue
+		}
+		env = append(env, kv)
+	}
+	return env
+}
+
+// cfg returns the current configuration. The returned value must not be
+// modified; reloads swap in a new copy.
+func (a *Agent) cfg() *config.Config {
+	a.cfgMu.RLock()
+	defer a.cfgMu.RUnlock()
+	return a.config
+}
+
 func isSafeSessionID(sessionID string) bool {
 	if sessionID == "" || len(sessionID) > maxSessionIDLen {
 		return false
@@ -341,23 +529,23 @@ func (a *Agent) defaultModel() string {
 	}
 	switch a.runner.Kind() {
 	case api.AgentKindCodex:
-		return a.config.Codex.Model
+		return a.cfg().Codex.Model
 	default:
-		return a.config.Claude.Model
+		return a.cfg().Claude.Model
 	}
 }
 
 func (a *Agent) defaultTimeout() time.Duration {
 	switch a.runner.Kind() {
 	case api.AgentKindCodex:
-		return a.config.Codex.Timeout
+		return a.cfg().Codex.Timeout
 	default:
-		return a.config.Claude.Timeout
+		return a.cfg().Claude.Timeout
 	}
 }
 
 func (a *Agent) modelForTier(tier string) string {
-	if model := a.config.Tiers.Value(tier); model != "" {
+	if model := a.cfg().Tiers.Value(tier); model != "" {
 		return model
 	}
 	switch a.runner.Kind() {
@@ -386,57 +574,93 @@ func (a *Agent) resolveModel(tier string) (string, error) {
 	return model, nil
 }
 
-// loadAgencyPrompt loads the agency prompt file for this agent.
+// loadAgencyPrompt loads the agency prompt file for this agent, as found
+// by findAgencyPrompt, with a stamp identifying its version. Returns error if
+// no prompt file is found (forces proper installation).
+func (a *Agent) loadAgencyPrompt() (string, *history.PromptStamp, error) {
+	path, err := a.findAgencyPrompt()
+	if err != nil {
+		return "", nil, err
+	}
+	if mode := a.profile(); a.cfg().AgencyPromptFile == "" && mode != config.DefaultProfile && strings.HasSuffix(path, "-prod.md") {
+		a.log.Info("using prod agency prompt (dev variant not found)", map[string]any{
+			"prod_file": path,
+			"dev_file":  filepath.Join(filepath.Dir(path), fmt.Sprintf("%s-%s.md", a.agentKind, mode)),
+		})
+	}
+	return readAgencyPrompt(path)
+}
+
+// readAgencyPrompt reads the prompt file at path and stamps its version.
+func readAgencyPrompt(path string) (string, *history.PromptStamp, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("reading agency prompt file %s: %w", path, err)
+	}
+	sum := sha256.Sum256(data)
+	stamp := &history.PromptStamp{File: filepath.Base(path), Hash: hex.EncodeToString(sum[:])}
+	return string(data), stamp, nil
+}
+
+// profile returns the config profile in effect, which picks the agency
+// prompt variant.
+func (a *Agent) profile() string {
+	if profile := a.cfg().Profile; profile != "" {
+		return profile
+	}
+	return config.DefaultProfile
+}
+
+// findAgencyPrompt returns the agency prompt file for this agent.
 // It looks for the prompt file in this order:
 // 1. Explicit AgencyPromptFile from config
-// 2. <AgencyPromptsDir>/<agent_kind>-<mode>.md (e.g., claude-prod.md)
-// 3. <AgencyPromptsDir>/<agent_kind>-prod.md (fallback if dev variant missing)
-// Returns error if no prompt file is found (forces proper installation).
-func (a *Agent) loadAgencyPrompt() (string, error) {
+// 2. <AgencyPromptsDir>/<agent_kind>-<profile>.md (e.g., claude-prod.md)
+// 3. <AgencyPromptsDir>/<agent_kind>-prod.md (fallback if the profile's variant is missing)
+func (a *Agent) findAgencyPrompt() (string, error) {
 	// 1. Try explicit file path from config
-	if a.config.AgencyPromptFile != "" {
-		data, err := os.ReadFile(a.config.AgencyPromptFile)
-		if err != nil {
-			return "", fmt.Errorf("reading agency prompt file %s: %w", a.config.AgencyPromptFile, err)
+	if a.cfg().AgencyPromptFile != "" {
+		if _, err := os.Stat(a.cfg().AgencyPromptFile); err != nil {
+			return "", fmt.Errorf("reading agency prompt file %s: %w", a.cfg().AgencyPromptFile, err)
 		}
-		return string(data), nil
+		return a.cfg().AgencyPromptFile, nil
 	}
 
 	// 2. Determine prompts directory
-	promptsDir := a.config.AgencyPromptsDir
-	if promptsDir == "" {
-		promptsDir = config.DefaultPromptsPath()
-	}
+	promptsDir := a.promptsDir()
 
-	// 3. Try mode-specific file (e.g., claude-dev.md)
-	mode := config.AgencyMode()
+	// 3. Try profile-specific file (e.g., claude-dev.md)
+	mode := a.profile()
 	promptFile := filepath.Join(promptsDir, fmt.Sprintf("%s-%s.md", a.agentKind, mode))
-	if data, err := os.ReadFile(promptFile); err == nil {
-		return string(data), nil
+	if _, err := os.Stat(promptFile); err == nil {
+		return promptFile, nil
 	}
 
 	// 4. Fallback to prod variant if dev variant missing
-	if mode != "prod" {
+	if mode != config.DefaultProfile {
 		prodFile := filepath.Join(promptsDir, fmt.Sprintf("%s-prod.md", a.agentKind))
-		if data, err := os.ReadFile(prodFile); err == nil {
-			a.log.Info("using prod agency prompt (dev variant not found)", map[string]any{
-				"prod_file": prodFile,
-				"dev_file":  promptFile,
-			})
-			return string(data), nil
+		if _, err := os.Stat(prodFile); err == nil {
+			return prodFile, nil
 		}
 	}
 
 	return "", fmt.Errorf("agency prompt file not found: tried %s (install agency prompts to %s)", promptFile, promptsDir)
 }
 
+// buildPrompt returns the prompt for a run of task, and records the version
+// of the agency prompt it includes on the task.
 func (a *Agent) buildPrompt(task *Task) (string, error) {
 	// Load agency prompt fresh each task (allows hot-reload)
-	agencyPrompt, err := a.loadAgencyPrompt()
+	agencyPrompt, stamp, err := a.loadAgencyPrompt()
 	if err != nil {
 		return "", err
 	}
-	return agencyPrompt + "\n\n" + task.Prompt, nil
+	if exp := a.cfg().Experiment; exp.Enabled() {
+		agencyPrompt, stamp = a.applyExperiment(task, exp, agencyPrompt, stamp)
+	}
+	a.mu.Lock()
+	task.agencyPrompt = stamp
+	a.mu.Unlock()
+	return agencyPrompt + "\n\n" + task.Prompt + attachmentsNote(task.attachments), nil
 }
 
 func setTaskCompletion(task *Task, completedAt time.Time) {
@@ -446,6 +670,20 @@ func setTaskCompletion(task *Task, completedAt time.Time) {
 	}
 }
 
+// writeStartError writes the response for a task that couldn't start. A busy
+// agent also reports the task it is running.
+func writeStartError(w http.ResponseWriter, err *startError) {
+	if err.Code == api.ErrorAgentBusy {
+		api.WriteJSON(w, err.Status, map[string]any{
+			"error":        err.Code,
+			"message":      err.Message,
+			"current_task": err.CurrentTask,
+		})
+		return
+	}
+	api.WriteError(w, err.Status, err.Code, err.Message)
+}
+
 // handleCreateTask validates and queues a new task for execution.
 // Returns 201 Created with task_id on success.
 // Returns 400 if validation fails, 409 if agent is busy.
@@ -454,35 +692,97 @@ func (a *Agent) handleCreateTask(w http.ResponseWriter, r *http.Request) {
 	if !api.DecodeJSON(w, r, &req) {
 		return
 	}
+	req.RequestID = api.RequestIDFromContext(r.Context())
 
-	if req.Prompt == "" {
-		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, "prompt is required")
+	task, err := a.startTask(req, "")
+	if err != nil {
+		writeStartError(w, err)
 		return
 	}
 
+	api.WriteJSON(w, http.StatusCreated, map[string]any{
+		"task_id":    task.ID,
+		"session_id": task.SessionID,
+		"status":     "working",
+	})
+}
+
+// startError describes why a task could not be started.
+type startError struct {
+	Status      int    // HTTP status for the REST API
+	Code        string // api.Error* code
+	Message     string
+	CurrentTask string // Task holding the agent, for agent_busy
+}
+
+// startedTask identifies a task accepted by startTask.
+type startedTask struct {
+	ID        string
+	SessionID string
+}
+
+// startTask validates req and starts it in the background. taskID names the
+// task, or is empty to generate one.
+func (a *Agent) startTask(req TaskRequest, taskID string) (startedTask, *startError) {
+	invalid := func(msg string) (startedTask, *startError) {
+		return startedTask{}, &startError{Status: http.StatusBadRequest, Code: api.ErrorValidation, Message: msg}
+	}
+
+	if req.Prompt == "" {
+		return invalid("prompt is required")
+	}
+
 	if req.Tier != "" && !api.IsValidTier(req.Tier) {
-		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, "tier must be fast, standard, or heavy")
-		return
+		return invalid("tier must be fast, standard, or heavy")
 	}
 
 	if req.SessionID != "" && !isSafeSessionID(req.SessionID) {
-		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, "session_id contains invalid characters")
-		return
+		return invalid("session_id contains invalid characters")
+	}
+	if req.ParentTaskID != "" && !isSafeSessionID(req.ParentTaskID) {
+		return invalid("parent_task_id contains invalid characters")
+	}
+
+	if !a.cfg().Policy.IsEmpty() && !a.runner.SupportsAllowedTools() {
+		return startedTask{}, &startError{
+			Status:  http.StatusInternalServerError,
+			Code:    "configuration_error",
+			Message: fmt.Sprintf("tool policy is not supported by %s agents", a.agentKind),
+		}
+	}
+
+	if err := a.validateRunnerOptions(req.RunnerOptions); err != nil {
+		return invalid(err.Error())
+	}
+	if err := a.validateAttachments(req.Attachments); err != nil {
+		return invalid(err.Error())
+	}
+	env, envErr := a.resolveEnv(req.Env)
+	if envErr != nil {
+		return startedTask{}, envErr
 	}
 
 	a.mu.Lock()
+	if a.draining {
+		a.mu.Unlock()
+		return startedTask{}, &startError{
+			Status:  http.StatusServiceUnavailable,
+			Code:    api.ErrorAgentDraining,
+			Message: "Agent is draining and not accepting new tasks",
+		}
+	}
 	if a.state != StateIdle {
 		currentTaskID := ""
 		if a.currentTask != nil {
 			currentTaskID = a.currentTask.ID
 		}
 		a.mu.Unlock()
-		api.WriteJSON(w, http.StatusConflict, map[string]any{
-			"error":        api.ErrorAgentBusy,
-			"message":      fmt.Sprintf("Agent is currently processing %s", currentTaskID),
-			"current_task": currentTaskID,
-		})
-		return
+		return startedTask{}, &startError{
+			Status:      http.StatusConflict,
+			Code:        api.ErrorAgentBusy,
+			Message:     fmt.Sprintf("Agent is currently processing %s", currentTaskID),
+			CurrentTask: currentTaskID,
+		}
 	}
 
 	// Create task with session-based working directory
@@ -498,22 +798,31 @@ func (a *Agent) handleCreateTask(w http.ResponseWriter, r *http.Request) {
 	model, err := a.resolveModel(req.Tier)
 	if err != nil {
 		a.mu.Unlock()
-		api.WriteError(w, http.StatusInternalServerError, "configuration_error", err.Error())
-		return
+		return startedTask{}, &startError{Status: http.StatusInternalServerError, Code: "configuration_error", Message: err.Error()}
 	}
 
+	if taskID == "" {
+		taskID = "task-" + uuid.New().String()[:8]
+	}
 	task := &Task{
-		ID:            "task-" + uuid.New().String()[:8],
+		ID:            taskID,
 		State:         TaskStateQueued,
 		Prompt:        req.Prompt,
 		Model:         model,
 		SessionID:     sessionID,
+		ParentTaskID:  req.ParentTaskID,
+		RequestID:     req.RequestID,
+		RerunOf:       req.RerunOf,
 		ResumeSession: resumeSession,
 		WorkDir:       sessionID,
+		RunnerOptions: req.RunnerOptions,
+		attachments:   req.Attachments,
+		tier:          req.Tier,
 	}
 
 	if req.TimeoutSeconds > 0 {
 		task.Timeout = time.Duration(req.TimeoutSeconds) * time.Second
+		task.timeoutSeconds = req.TimeoutSeconds
 	} else {
 		task.Timeout = a.defaultTimeout()
 	}
@@ -523,25 +832,25 @@ func (a *Agent) handleCreateTask(w http.ResponseWriter, r *http.Request) {
 	a.state = StateWorking
 
 	// Log task creation with task-scoped logger
-	a.log.WithTask(task.ID).Info("task created", map[string]any{
+	a.taskLog(task).Info("task created", map[string]any{
 		"session_id": task.SessionID,
 		"model":      task.Model,
 		"resume":     task.ResumeSession,
 	})
 
 	// Copy fields needed for response before releasing lock
-	taskID := task.ID
-	respSessionID := task.SessionID
+	started := startedTask{ID: task.ID, SessionID: task.SessionID}
 	a.mu.Unlock()
 
 	// Start task execution in background
-	go a.executeTask(task, req.Env)
+	go a.executeTask(task, env)
 
-	api.WriteJSON(w, http.StatusCreated, map[string]any{
-		"task_id":    taskID,
-		"session_id": respSessionID,
-		"status":     "working",
-	})
+	return started, nil
+}
+
+// taskLog returns a logger that tags entries with the task and its request ID.
+func (a *Agent) taskLog(task *Task) *logging.TaskLogger {
+	return a.log.WithTask(task.ID).WithRequestID(task.RequestID)
 }
 
 // handleGetTask returns the status and output of a task by ID.
@@ -578,6 +887,23 @@ func (a *Agent) handleGetTask(w http.ResponseWriter, r *http.Request) {
 			"token_usage":      tokenUsage,
 			"duration_seconds": task.DurationSeconds,
 		}
+		if task.ParentTaskID != "" {
+			resp["parent_task_id"] = task.ParentTaskID
+		}
+		if task.RequestID != "" {
+			resp["request_id"] = task.RequestID
+		}
+		if steps := task.timeline.snapshot(time.Now()); steps != nil {
+			resp["timeline"] = steps
+		}
+		if task.agencyPrompt != nil {
+			resp["agency_prompt"] = task.agencyPrompt
+		}
+		if task.OutputTruncated {
+			resp["output_truncated"] = true
+			resp["output_bytes"] = task.OutputBytes
+			resp["captured_bytes"] = task.CapturedBytes
+		}
 
 		if task.StartedAt != nil {
 			resp["started_at"] = task.StartedAt.Format(time.RFC3339)
@@ -606,28 +932,88 @@ func (a *Agent) handleGetTask(w http.ResponseWriter, r *http.Request) {
 	api.WriteError(w, http.StatusNotFound, api.ErrorNotFound, fmt.Sprintf("Task %s not found", taskID))
 }
 
+// handleGetTaskDiff returns the git patch produced by a task in worktree mode.
+// Returns 409 while the task is still running, 404 if no diff was captured.
+func (a *Agent) handleGetTaskDiff(w http.ResponseWriter, r *http.Request) {
+	taskID := chi.URLParam(r, "id")
+
+	a.mu.RLock()
+	task, ok := a.tasks[taskID]
+	var diff string
+	var terminal bool
+	if ok {
+		diff = task.Diff
+		terminal = task.State.IsTerminal()
+	}
+	a.mu.RUnlock()
+
+	if ok && !terminal {
+		api.WriteError(w, http.StatusConflict, api.ErrorTaskInProgress, fmt.Sprintf("Task %s is still running", taskID))
+		return
+	}
+	if ok && diff != "" {
+		writeDiff(w, []byte(diff))
+		return
+	}
+
+	if a.history != nil {
+		if data, err := a.history.GetDiff(taskID); err == nil {
+			writeDiff(w, data)
+			return
+		}
+	}
+
+	api.WriteError(w, http.StatusNotFound, api.ErrorNotFound, fmt.Sprintf("Diff for %s not found", taskID))
+}
+
+func writeDiff(w http.ResponseWriter, diff []byte) {
+	w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(diff)
+}
+
 // handleCancelTask cancels a running task by ID.
 // Triggers context cancellation which sends SIGTERM to the CLI process.
 // Returns 404 if not found, 409 if already completed.
 func (a *Agent) handleCancelTask(w http.ResponseWriter, r *http.Request) {
 	taskID := chi.URLParam(r, "id")
 
-	a.mu.Lock()
-	task, ok := a.tasks[taskID]
-	if !ok {
-		a.mu.Unlock()
+	finalState, err := a.cancelTask(taskID)
+	switch {
+	case errors.Is(err, errTaskNotFound):
 		api.WriteError(w, http.StatusNotFound, api.ErrorNotFound, fmt.Sprintf("Task %s not found", taskID))
-		return
-	}
-
-	if task.State.IsTerminal() {
-		a.mu.Unlock()
+	case errors.Is(err, errTaskCompleted):
 		api.WriteJSON(w, http.StatusConflict, map[string]any{
 			"error":       api.ErrorAlreadyCompleted,
 			"message":     fmt.Sprintf("Task %s has already completed", taskID),
-			"final_state": task.State,
+			"final_state": finalState,
 		})
-		return
+	default:
+		api.WriteJSON(w, http.StatusOK, map[string]any{
+			"task_id": taskID,
+			"state":   TaskStateCancelled,
+			"message": "Task cancellation initiated",
+		})
+	}
+}
+
+var (
+	errTaskNotFound  = errors.New("task not found")
+	errTaskCompleted = errors.New("task has already completed")
+)
+
+// cancelTask cancels a running task. If it has already finished, returns
+// errTaskCompleted and the state it finished in.
+func (a *Agent) cancelTask(taskID string) (TaskState, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	task, ok := a.tasks[taskID]
+	if !ok {
+		return "", errTaskNotFound
+	}
+	if task.State.IsTerminal() {
+		return task.State, errTaskCompleted
 	}
 
 	task.State = TaskStateCancelled
@@ -638,13 +1024,7 @@ func (a *Agent) handleCancelTask(w http.ResponseWriter, r *http.Request) {
 	if task.cmd != nil {
 		killProcessGroup(task.cmd)
 	}
-	a.mu.Unlock()
-
-	api.WriteJSON(w, http.StatusOK, map[string]any{
-		"task_id": taskID,
-		"state":   TaskStateCancelled,
-		"message": "Task cancellation initiated",
-	})
+	return TaskStateCancelled, nil
 }
 
 // handleShutdown initiates graceful agent shutdown.
@@ -690,6 +1070,41 @@ func (a *Agent) handleShutdown(w http.ResponseWriter, r *http.Request) {
 	}()
 }
 
+// handleDrain puts the agent into drain mode: new tasks are rejected with 503,
+// any running task is allowed to finish, and the agent shuts down once idle.
+func (a *Agent) handleDrain(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	alreadyDraining := a.draining
+	a.draining = true
+	idle := a.state == StateIdle
+	taskID := ""
+	if a.currentTask != nil {
+		taskID = a.currentTask.ID
+	}
+	a.mu.Unlock()
+
+	if !alreadyDraining {
+		a.log.Info("drain requested", map[string]any{"current_task": taskID})
+	}
+
+	api.WriteJSON(w, http.StatusAccepted, map[string]any{
+		"message":      "Drain initiated",
+		"current_task": taskID,
+	})
+
+	if idle && !alreadyDraining {
+		go a.finishDrain()
+	}
+}
+
+// finishDrain shuts the agent down once a drain has completed.
+func (a *Agent) finishDrain() {
+	a.log.Info("drain complete, shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	a.Shutdown(ctx)
+}
+
 // executeTask runs the CLI runner with the given task configuration.
 // It handles the full lifecycle: setup, execution, timeout/cancellation, and result parsing.
 //
@@ -703,7 +1118,7 @@ func (a *Agent) handleShutdown(w http.ResponseWriter, r *http.Request) {
 // The env parameter allows passing additional environment variables to the runner.
 // Auto-resumes up to 2 times if the runner reports a max_turns limit.
 func (a *Agent) executeTask(task *Task, env map[string]string) {
-	taskLog := a.log.WithTask(task.ID)
+	taskLog := a.taskLog(task)
 	taskLog.Info("task started", map[string]any{
 		"timeout_seconds": task.Timeout.Seconds(),
 	})
@@ -715,13 +1130,19 @@ func (a *Agent) executeTask(task *Task, env map[string]string) {
 	now := time.Now()
 	task.StartedAt = &now
 	task.State = TaskStateWorking
+	task.hasEnv = len(env) > 0
 	a.mu.Unlock()
+	a.saveInflight(task)
 
 	defer cancel()
 
+	warnAfter := a.timeoutWarningAfter(task.Timeout)
+	warnTimer := time.AfterFunc(warnAfter, func() { a.warnTimeout(task, task.Timeout-warnAfter) })
+	defer warnTimer.Stop()
+
 	// Create working directory: <session_dir>/<work_dir>/
 	// For new sessions, clean any existing directory first
-	workDir := filepath.Join(a.config.SessionDir, task.WorkDir)
+	workDir := filepath.Join(a.cfg().SessionDir, task.WorkDir)
 	if !task.ResumeSession {
 		os.RemoveAll(workDir) // Clean for new sessions
 	}
@@ -742,11 +1163,55 @@ func (a *Agent) executeTask(task *Task, env map[string]string) {
 		return
 	}
 
+	// In worktree mode, new sessions start from a fresh clone of the repository
+	if a.cfg().Worktree.Repo != "" && !task.ResumeSession {
+		if err := a.prepareWorktree(workDir); err != nil {
+			completedAt := time.Now()
+			a.mu.Lock()
+			setTaskCompletion(task, completedAt)
+			task.State = TaskStateFailed
+			exitCode := 1
+			task.ExitCode = &exitCode
+			task.Error = &TaskError{
+				Type:    "worktree_error",
+				Message: fmt.Sprintf("Failed to prepare worktree: %v", err),
+			}
+			a.mu.Unlock()
+			a.saveTaskHistory(task, nil)
+			a.cleanupTask(task)
+			return
+		}
+	}
+
+	if len(task.attachments) > 0 {
+		if err := a.writeAttachments(task, workDir); err != nil {
+			completedAt := time.Now()
+			a.mu.Lock()
+			setTaskCompletion(task, completedAt)
+			task.State = TaskStateFailed
+			exitCode := 1
+			task.ExitCode = &exitCode
+			task.Error = &TaskError{
+				Type:    "attachment_error",
+				Message: fmt.Sprintf("Failed to write attachments: %v", err),
+			}
+			a.mu.Unlock()
+			a.saveTaskHistory(task, nil)
+			a.cleanupTask(task)
+			return
+		}
+	}
+
 	runnerBin := a.runner.ResolveBin()
 
 	const maxAutoResumes = 2
 	var lastOutput []byte
 
+	// Secrets are scrubbed from output as it is read, so they never reach
+	// the capture, spill file, history or logs
+	redactor := a.loadRedactor()
+	redactions := 0
+
 	// Execution loop: runs once normally, up to 2 more times for max_turns auto-resume
 	for {
 		prompt, promptErr := a.buildPrompt(task)
@@ -766,16 +1231,40 @@ func (a *Agent) executeTask(task *Task, env map[string]string) {
 			a.cleanupTask(task)
 			return
 		}
-		cmdSpec := a.runner.BuildCommand(task, prompt, a.config)
+		cmdSpec := a.runner.BuildCommand(task, prompt, a.cfg())
+
+		bin, args := runnerBin, cmdSpec.Args
+		containerRuntime := "" // Set when the CLI runs in a container
+		if cc := a.cfg().Container; cc.Enabled() {
+			containerRuntime = cc.RuntimeBin()
+			var containerErr error
+			bin, args, containerErr = containerCommand(cc, a.runner, task.ID, runnerBin, args, workDir, env)
+			if containerErr != nil {
+				completedAt := time.Now()
+				a.mu.Lock()
+				setTaskCompletion(task, completedAt)
+				task.State = TaskStateFailed
+				exitCode := 1
+				task.ExitCode = &exitCode
+				task.Error = &TaskError{
+					Type:    "container_error",
+					Message: containerErr.Error(),
+				}
+				a.mu.Unlock()
+				a.saveTaskHistory(task, nil)
+				a.cleanupTask(task)
+				return
+			}
+		}
 
-		cmd := exec.CommandContext(ctx, runnerBin, cmdSpec.Args...)
+		cmd := exec.CommandContext(ctx, bin, args...)
 		cmd.Dir = workDir
 		if cmdSpec.PromptInStdin {
 			cmd.Stdin = strings.NewReader(prompt)
 		}
 
 		// Inherit current environment and add task-specific vars
-		cmd.Env = os.Environ()
+		cmd.Env = runnerEnviron()
 		for k, v := range env {
 			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 		}
@@ -829,12 +1318,13 @@ func (a *Agent) executeTask(task *Task, env map[string]string) {
 		a.mu.Lock()
 		task.cmd = cmd
 		a.mu.Unlock()
+		a.saveInflight(task)
 
 		// Stream and parse output line by line
 		parser := stream.NewClaudeStreamParser()
 		eventLogger := stream.NewToolEventLogger(taskLog)
 
-		var outputBuf bytes.Buffer
+		capture := newOutputCapture(a.maxOutputBytes(), a.spillOpener(task.ID))
 		var lastResult *stream.ClaudeStreamEvent
 
 		scanner := bufio.NewScanner(stdout)
@@ -843,9 +1333,21 @@ func (a *Agent) executeTask(task *Task, env map[string]string) {
 		scanner.Buffer(make([]byte, 64*1024), maxScannerBuffer)
 
 		for scanner.Scan() {
-			line := scanner.Bytes()
-			outputBuf.Write(line)
-			outputBuf.WriteByte('\n')
+			line, n := redactor.Bytes(scanner.Bytes())
+			redactions += n
+			capture.WriteLine(line)
+			a.updateLiveOutput(task, line)
+
+			// Codex names its session once it starts; recorded so a restarted
+			// agent can resume it
+			if task.cliSessionID == "" && a.runner.Kind() == api.AgentKindCodex {
+				if id := streamSessionID(line); isSafeSessionID(id) {
+					a.mu.Lock()
+					task.cliSessionID = id
+					a.mu.Unlock()
+					a.saveInflight(task)
+				}
+			}
 
 			// Parse stream events and log them
 			events, parseErr := parser.ParseLine(line)
@@ -859,6 +1361,9 @@ func (a *Agent) executeTask(task *Task, env map[string]string) {
 			for _, event := range events {
 				eventLogger.Log(event)
 			}
+			a.mu.Lock()
+			task.timeline.add(events)
+			a.mu.Unlock()
 
 			// Track the last result event for final metrics
 			var rawEvent stream.ClaudeStreamEvent
@@ -874,14 +1379,39 @@ func (a *Agent) executeTask(task *Task, env map[string]string) {
 			})
 		}
 
-		lastOutput = outputBuf.Bytes()
+		if err := capture.Close(); err != nil {
+			taskLog.Warn("failed to spill task output", map[string]any{
+				"error": err.Error(),
+			})
+		}
+		lastOutput = capture.Captured()
+		parseInput := capture.ParseInput()
+		if capture.Truncated() {
+			taskLog.Warn("task output truncated", map[string]any{
+				"output_bytes":   capture.TotalBytes(),
+				"captured_bytes": len(lastOutput),
+				"spilled":        capture.Spilled(),
+			})
+		}
 
 		// Wait for command to complete
 		cmdErr = cmd.Wait()
 		completedAt := time.Now()
+		if containerRuntime != "" {
+			// On timeout, cancel or shutdown only the runtime client is
+			// killed; the container would keep running on the workdir
+			if err := removeTaskContainers(containerRuntime, task.ID); err != nil {
+				taskLog.Warn("failed to remove task container", map[string]any{"error": err.Error()})
+			}
+		}
 
 		a.mu.Lock()
 		setTaskCompletion(task, completedAt)
+		task.OutputTruncated = capture.Truncated()
+		task.OutputBytes = capture.TotalBytes()
+		task.CapturedBytes = int64(len(lastOutput))
+		task.spilled = capture.Spilled()
+		task.Redactions = redactions
 
 		// Handle cancellation: context was canceled and task was marked cancelled
 		if ctx.Err() == context.Canceled && task.State == TaskStateCancelled {
@@ -906,6 +1436,11 @@ func (a *Agent) executeTask(task *Task, env map[string]string) {
 				Type:    "timeout",
 				Message: fmt.Sprintf("Task exceeded timeout of %v", task.Timeout),
 			}
+			// Output up to the kill; with truncated output, the live output
+			// already holds it
+			if partial := a.partialOutput(parseInput); partial != "" {
+				task.Output = partial
+			}
 			a.mu.Unlock()
 			a.saveTaskHistory(task, lastOutput)
 			a.cleanupTask(task)
@@ -926,7 +1461,7 @@ func (a *Agent) executeTask(task *Task, env map[string]string) {
 			}
 
 			// Extract result text - look for it in the stream output
-			task.Output = extractResultFromStream(lastOutput)
+			task.Output = extractResultFromStream(parseInput)
 
 			// Check for max_turns limit and auto-resume if possible
 			if lastResult.Subtype == "error_max_turns" && task.maxTurnsResumes < maxAutoResumes {
@@ -946,7 +1481,7 @@ func (a *Agent) executeTask(task *Task, env map[string]string) {
 				task.Error = &TaskError{
 					Type: "max_turns",
 					Message: fmt.Sprintf("Task exceeded maximum turns limit (%d turns x %d attempts). Consider breaking the task into smaller steps.",
-						a.runner.MaxTurnsLimit(a.config), maxAutoResumes+1),
+						a.maxTurnsFor(task), maxAutoResumes+1),
 				}
 				a.mu.Unlock()
 				a.saveTaskHistory(task, lastOutput)
@@ -956,7 +1491,7 @@ func (a *Agent) executeTask(task *Task, env map[string]string) {
 		}
 
 		// Try runner-specific parsing for metadata (session_id, tokens, etc)
-		parsedOutput, parsed := a.runner.ParseOutput(lastOutput)
+		parsedOutput, parsed := a.runner.ParseOutput(parseInput)
 		if parsed {
 			// Only update session_id if runner returns a safe, non-empty value and we didn't already get one
 			if parsedOutput.SessionID != "" && task.SessionID == "" {
@@ -980,7 +1515,7 @@ func (a *Agent) executeTask(task *Task, env map[string]string) {
 			// For Codex, handle session directory renaming
 			if a.runner.Kind() == api.AgentKindCodex && !task.ResumeSession && task.SessionID != "" {
 				oldPath := workDir
-				newPath := filepath.Join(a.config.SessionDir, task.SessionID)
+				newPath := filepath.Join(a.cfg().SessionDir, task.SessionID)
 				task.WorkDir = task.SessionID
 				if oldPath != newPath {
 					if err := os.Rename(oldPath, newPath); err != nil {
@@ -992,8 +1527,25 @@ func (a *Agent) executeTask(task *Task, env map[string]string) {
 			}
 		}
 
+		// A run that tried tools the policy forbids fails even if the CLI
+		// exited cleanly, so callers don't mistake partial work for success
+		var violations []string
+		if parsed {
+			violations = a.policyViolations(parsedOutput.DeniedTools)
+		}
+
 		// Determine final state based on command execution result
-		if cmdErr != nil {
+		if len(violations) > 0 {
+			task.State = TaskStateFailed
+			task.Error = &TaskError{
+				Type:    "policy_violation",
+				Message: fmt.Sprintf("Tool policy denied: %s", strings.Join(violations, ", ")),
+			}
+			taskLog.Warn("task violated tool policy", map[string]any{
+				"denied_tools":     violations,
+				"duration_seconds": task.DurationSeconds,
+			})
+		} else if cmdErr != nil {
 			task.State = TaskStateFailed
 			exitCode := 1
 			if exitErr, ok := cmdErr.(*exec.ExitError); ok {
@@ -1002,9 +1554,11 @@ func (a *Agent) executeTask(task *Task, env map[string]string) {
 				}
 			}
 			task.ExitCode = &exitCode
+			message, n := redactor.String(stderr.String())
+			task.Redactions += n
 			task.Error = &TaskError{
 				Type:    a.runner.ErrorType(),
-				Message: stderr.String(),
+				Message: message,
 			}
 			taskLog.Error("task failed", map[string]any{
 				"error_type":       a.runner.ErrorType(),
@@ -1072,13 +1626,17 @@ func extractResultFromStream(output []byte) string {
 
 // saveTaskHistory saves a completed task to the history store.
 func (a *Agent) saveTaskHistory(task *Task, rawOutput []byte) {
+	diff := a.captureWorktreeDiff(task)
 	if a.history == nil {
 		return
 	}
 
 	entry := &history.Entry{
 		TaskID:          task.ID,
+		AgentID:         a.cfg().ID,
 		SessionID:       task.SessionID,
+		ParentTaskID:    task.ParentTaskID,
+		RequestID:       task.RequestID,
 		State:           string(task.State),
 		Prompt:          task.Prompt,
 		Model:           task.Model,
@@ -1086,6 +1644,21 @@ func (a *Agent) saveTaskHistory(task *Task, rawOutput []byte) {
 		DurationSeconds: task.DurationSeconds,
 		ExitCode:        task.ExitCode,
 		Steps:           history.ExtractSteps(rawOutput),
+		FileChanges:     history.ExtractFileChanges(rawOutput),
+		OutputTruncated: task.OutputTruncated,
+		OutputBytes:     task.OutputBytes,
+		CapturedBytes:   task.CapturedBytes,
+		HasSpill:        task.spilled,
+		Redactions:      task.Redactions,
+		Timeline:        task.timeline.snapshot(time.Now()),
+		AgencyPrompt:    task.agencyPrompt,
+		Tier:            task.tier,
+		TimeoutSeconds:  task.timeoutSeconds,
+		RerunOf:         task.RerunOf,
+	}
+	if !task.RunnerOptions.IsZero() {
+		options := task.RunnerOptions
+		entry.RunnerOptions = &options
 	}
 
 	if task.StartedAt != nil {
@@ -1108,7 +1681,7 @@ func (a *Agent) saveTaskHistory(task *Task, rawOutput []byte) {
 	}
 
 	if err := a.history.Save(entry); err != nil {
-		a.log.WithTask(task.ID).Warn("failed to save task history", map[string]any{
+		a.taskLog(task).Warn("failed to save task history", map[string]any{
 			"error": err.Error(),
 		})
 	}
@@ -1116,14 +1689,27 @@ func (a *Agent) saveTaskHistory(task *Task, rawOutput []byte) {
 	// Save debug log (raw CLI output)
 	if len(rawOutput) > 0 {
 		if err := a.history.SaveDebugLog(task.ID, rawOutput); err != nil {
-			a.log.WithTask(task.ID).Warn("failed to save debug log", map[string]any{
+			a.taskLog(task).Warn("failed to save debug log", map[string]any{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	// Save worktree diff
+	if diff != "" {
+		if err := a.history.SaveDiff(task.ID, []byte(diff)); err != nil {
+			a.taskLog(task).Warn("failed to save diff", map[string]any{
 				"error": err.Error(),
 			})
 		}
 	}
+
+	a.collectArtifacts(task)
 }
 
 func (a *Agent) cleanupTask(task *Task) {
+	a.clearInflight()
+
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
@@ -1135,6 +1721,9 @@ func (a *Agent) cleanupTask(task *Task) {
 	if a.history != nil {
 		delete(a.tasks, task.ID)
 	}
+	if a.draining {
+		go a.finishDrain()
+	}
 }
 
 // handleListHistory returns paginated task history.
@@ -1156,7 +1745,82 @@ func (a *Agent) handleListHistory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	rating := r.URL.Query().Get("rating")
+	if rating != "" && rating != history.RatingGood && rating != history.RatingBad {
+		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, "rating must be good or bad")
+		return
+	}
+
 	result := a.history.List(history.ListOptions{
+		Page:   page,
+		Limit:  limit,
+		Query:  r.URL.Query().Get("q"),
+		Rating: rating,
+		Tag:    r.URL.Query().Get("tag"),
+	})
+
+	api.WriteJSON(w, http.StatusOK, result)
+}
+
+// handleExportHistory streams every history entry, oldest first, for
+// analytics.
+// Query params:
+//   - format: jsonl (default) or csv
+//   - since: RFC 3339 time; only entries completed at or after it
+func (a *Agent) handleExportHistory(w http.ResponseWriter, r *http.Request) {
+	if a.history == nil {
+		api.WriteError(w, http.StatusServiceUnavailable, "history_unavailable", "History storage not configured")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	contentType := "application/x-ndjson"
+	switch format {
+	case "", history.ExportJSONL:
+		format = history.ExportJSONL
+	case history.ExportCSV:
+		contentType = "text/csv; charset=utf-8"
+	default:
+		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, "format must be jsonl or csv")
+		return
+	}
+	var since time.Time
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, s); err != nil {
+			api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, "since must be an RFC 3339 time")
+			return
+		}
+	}
+
+	records := a.history.Export(since)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="history.`+format+`"`)
+	w.WriteHeader(http.StatusOK)
+	if err := history.WriteExport(w, format, records); err != nil {
+		a.log.Warn("history export interrupted", map[string]any{"error": err.Error()})
+	}
+}
+
+// handleListHistorySessions returns paginated history totals per session.
+func (a *Agent) handleListHistorySessions(w http.ResponseWriter, r *http.Request) {
+	if a.history == nil {
+		api.WriteError(w, http.StatusServiceUnavailable, "history_unavailable", "History storage not configured")
+		return
+	}
+
+	page, err := api.ParseIntParam(r.URL.Query().Get("page"), 1, 10000, 1)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, "page "+err.Error())
+		return
+	}
+	limit, err := api.ParseIntParam(r.URL.Query().Get("limit"), 1, 1000, 20)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, "limit "+err.Error())
+		return
+	}
+
+	result := a.history.Sessions(history.ListOptions{
 		Page:  page,
 		Limit: limit,
 	})
@@ -1164,6 +1828,23 @@ func (a *Agent) handleListHistory(w http.ResponseWriter, r *http.Request) {
 	api.WriteJSON(w, http.StatusOK, result)
 }
 
+// handleGetHistorySession returns a session's totals and its history entries.
+func (a *Agent) handleGetHistorySession(w http.ResponseWriter, r *http.Request) {
+	if a.history == nil {
+		api.WriteError(w, http.StatusServiceUnavailable, "history_unavailable", "History storage not configured")
+		return
+	}
+
+	sessionID := chi.URLParam(r, "session_id")
+	session, err := a.history.Session(sessionID)
+	if err != nil {
+		api.WriteError(w, http.StatusNotFound, api.ErrorNotFound, err.Error())
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, session)
+}
+
 // handleGetHistory returns a single history entry with outline.
 func (a *Agent) handleGetHistory(w http.ResponseWriter, r *http.Request) {
 	if a.history == nil {
@@ -1181,6 +1862,36 @@ func (a *Agent) handleGetHistory(w http.ResponseWriter, r *http.Request) {
 	api.WriteJSON(w, http.StatusOK, entry)
 }
 
+// handlePatchHistory rates, notes or tags a task in history.
+func (a *Agent) handlePatchHistory(w http.ResponseWriter, r *http.Request) {
+	if a.history == nil {
+		api.WriteError(w, http.StatusServiceUnavailable, "history_unavailable", "History storage not configured")
+		return
+	}
+
+	taskID := chi.URLParam(r, "id")
+	if _, err := a.history.Get(taskID); err != nil {
+		api.WriteError(w, http.StatusNotFound, api.ErrorNotFound, err.Error())
+		return
+	}
+	var update history.AnnotationUpdate
+	r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+	if !api.DecodeJSON(w, r, &update) {
+		return
+	}
+	if err := update.Validate(); err != nil {
+		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, err.Error())
+		return
+	}
+
+	entry, err := a.history.Annotate(taskID, update)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, "save_error", err.Error())
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, entry)
+}
+
 // handleGetHistoryDebug returns the full debug log for a task.
 func (a *Agent) handleGetHistoryDebug(w http.ResponseWriter, r *http.Request) {
 	if a.history == nil {
@@ -1200,10 +1911,57 @@ func (a *Agent) handleGetHistoryDebug(w http.ResponseWriter, r *http.Request) {
 	w.Write(debugLog)
 }
 
+// handleGetHistorySpill returns the output a task produced beyond the
+// capture limit.
+func (a *Agent) handleGetHistorySpill(w http.ResponseWriter, r *http.Request) {
+	if a.history == nil {
+		api.WriteError(w, http.StatusServiceUnavailable, "history_unavailable", "History storage not configured")
+		return
+	}
+
+	taskID := chi.URLParam(r, "id")
+	spill, err := a.history.GetSpill(taskID)
+	if err != nil {
+		api.WriteError(w, http.StatusNotFound, api.ErrorNotFound, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	w.Write(spill)
+}
+
+// handleHistoryDiff compares the output and artifacts of two history entries.
+// Query params:
+//   - a: task ID of the baseline entry
+//   - b: task ID of the entry to compare against it
+func (a *Agent) handleHistoryDiff(w http.ResponseWriter, r *http.Request) {
+	if a.history == nil {
+		api.WriteError(w, http.StatusServiceUnavailable, "history_unavailable", "History storage not configured")
+		return
+	}
+
+	taskA := r.URL.Query().Get("a")
+	taskB := r.URL.Query().Get("b")
+	if taskA == "" || taskB == "" {
+		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, "a and b query parameters are required")
+		return
+	}
+
+	cmp, err := a.history.Compare(taskA, taskB)
+	if err != nil {
+		api.WriteError(w, http.StatusNotFound, api.ErrorNotFound, err.Error())
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, cmp)
+}
+
 // handleLogs returns log entries with optional filtering.
 // Query params:
 //   - level: minimum log level (debug, info, warn, error)
 //   - task_id: filter by task ID
+//   - request_id: filter by request ID
 //   - since: RFC3339 timestamp to filter entries after
 //   - until: RFC3339 timestamp to filter entries before
 //   - limit: max entries to return (default 100)
@@ -1218,6 +1976,9 @@ func (a *Agent) handleLogs(w http.ResponseWriter, r *http.Request) {
 	if taskID := r.URL.Query().Get("task_id"); taskID != "" {
 		q.TaskID = taskID
 	}
+	if requestID := r.URL.Query().Get("request_id"); requestID != "" {
+		q.RequestID = requestID
+	}
 	if since := r.URL.Query().Get("since"); since != "" {
 		if t, err := time.Parse(time.RFC3339, since); err == nil {
 			q.Since = t
@@ -1246,3 +2007,98 @@ func (a *Agent) handleLogStats(w http.ResponseWriter, r *http.Request) {
 	stats := a.log.Stats()
 	api.WriteJSON(w, http.StatusOK, stats)
 }
+
+const (
+	logStreamBuffer    = 256              // Entries queued for a slow stream client before some are dropped
+	logStreamKeepalive = 15 * time.Second // Interval between comments keeping an idle stream open
+)
+
+// handleLogStream streams a task's log entries as server-sent events: the
+// latest stored entries first, then each new one as it is logged, until the
+// client goes away.
+// Query params:
+//   - task_id: task to stream (required)
+//   - level: minimum log level (debug, info, warn, error)
+//   - limit: max stored entries sent first (default 100)
+func (a *Agent) handleLogStream(w http.ResponseWriter, r *http.Request) {
+	q := logging.Query{
+		TaskID: r.URL.Query().Get("task_id"),
+		Level:  logging.Level(r.URL.Query().Get("level")),
+		Limit:  100,
+	}
+	if q.TaskID == "" {
+		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, "task_id query parameter is required")
+		return
+	}
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err := api.ParseIntParam(limitStr, 0, 10000, 100)
+		if err != nil {
+			api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, "limit "+err.Error())
+			return
+		}
+		q.Limit = limit
+	}
+
+	backlog, sub := a.log.Subscribe(q, logStreamBuffer)
+	defer sub.Close()
+	if q.Limit == 0 {
+		backlog = nil
+	}
+
+	rc := http.NewResponseController(w)
+	// Streams outlive the server's write timeout
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(event string, v any) bool {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return false
+		}
+		if event != "" {
+			fmt.Fprintf(w, "event: %s\n", event)
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	for _, entry := range backlog {
+		if !send("", entry) {
+			return
+		}
+	}
+	if rc.Flush() != nil {
+		return
+	}
+
+	keepalive := time.NewTicker(logStreamKeepalive)
+	defer keepalive.Stop()
+	var dropped int64
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case entry := <-sub.C:
+			if !send("", entry) {
+				return
+			}
+		case <-keepalive.C:
+			if n := sub.Dropped(); n > dropped {
+				dropped = n
+				if !send("dropped", map[string]int64{"dropped": n}) {
+					return
+				}
+				continue
+			}
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil || rc.Flush() != nil {
+				return
+			}
+		}
+	}
+}
@@ -1,18 +1,27 @@
 package agent
 
 import (
+	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/api"
 	"phobos.org.uk/agency/internal/config"
+	"phobos.org.uk/agency/internal/history"
+	"phobos.org.uk/agency/internal/logging"
 )
 
 func TestStatusEndpoint(t *testing.T) {
@@ -29,7 +38,58 @@ func TestStatusEndpoint(t *testing.T) {
 	require.Contains(t, w.Body.String(), `"state":"idle"`)
 	require.Contains(t, w.Body.String(), `"version":"test-version"`)
 	require.Contains(t, w.Body.String(), `"type":"agent"`)
-	require.Contains(t, w.Body.String(), `"interfaces":["statusable","taskable"]`)
+	require.Contains(t, w.Body.String(), `"interfaces":["statusable","taskable","configurable"]`)
+
+	var resp StatusResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, api.APIVersion, resp.APIVersion)
+	require.Contains(t, resp.Capabilities, api.CapabilitySSE)
+	require.Contains(t, resp.Capabilities, api.CapabilityTimeline)
+
+	// Codex output carries no tool calls to build a timeline from
+	codex := NewWithRunner(config.Default(), "test-version", NewCodexRunner())
+	w = httptest.NewRecorder()
+	codex.Router().ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Contains(t, resp.Capabilities, api.CapabilitySSE)
+	require.NotContains(t, resp.Capabilities, api.CapabilityTimeline)
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	t.Setenv("CLAUDE_BIN", "sh")
+
+	cfg := config.Default()
+	cfg.AgencyPromptsDir = t.TempDir()
+	a := New(cfg, "test")
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		a.Router().ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	require.Equal(t, http.StatusOK, get("/healthz").Code)
+
+	// Not ready until the agency prompt is installed
+	w := get("/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var resp api.HealthResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, "not_ready", resp.Status)
+	require.Contains(t, resp.Checks["agency_prompt"], "agency prompt file not found")
+	require.Equal(t, "ok", resp.Checks["runner"])
+
+	require.NoError(t, os.WriteFile(filepath.Join(cfg.AgencyPromptsDir, "claude-prod.md"), []byte("# Agency"), 0644))
+	require.Equal(t, http.StatusOK, get("/readyz").Code)
+
+	// A missing CLI or draining makes the agent unready, but still live
+	t.Setenv("CLAUDE_BIN", filepath.Join(t.TempDir(), "claude"))
+	require.Equal(t, http.StatusServiceUnavailable, get("/readyz").Code)
+	t.Setenv("CLAUDE_BIN", "sh")
+	a.mu.Lock()
+	a.draining = true
+	a.mu.Unlock()
+	require.Equal(t, http.StatusServiceUnavailable, get("/readyz").Code)
+	require.Equal(t, http.StatusOK, get("/healthz").Code)
 }
 
 func TestCreateTaskValidation(t *testing.T) {
@@ -155,6 +215,129 @@ func TestCreateTaskCreatesSessionDir(t *testing.T) {
 	require.DirExists(t, cfg.SessionDir)
 }
 
+func TestCreateSubtaskRecordsParent(t *testing.T) {
+	// Cannot use t.Parallel() with t.Setenv()
+	t.Setenv("CLAUDE_BIN", "echo")
+
+	tmpDir := t.TempDir()
+	promptsDir := filepath.Join(tmpDir, "prompts")
+	require.NoError(t, os.MkdirAll(promptsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "claude-prod.md"), []byte("# Test Instructions"), 0644))
+
+	cfg := config.Default()
+	cfg.SessionDir = filepath.Join(tmpDir, "sessions")
+	cfg.HistoryDir = filepath.Join(tmpDir, "history")
+	cfg.AgencyPromptsDir = promptsDir
+	a := New(cfg, "test")
+
+	req := httptest.NewRequest("POST", "/task", strings.NewReader(`{"prompt": "child", "parent_task_id": "../etc"}`))
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	req = httptest.NewRequest("POST", "/task", strings.NewReader(`{"prompt": "child", "parent_task_id": "task-parent1"}`))
+	w = httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var response struct {
+		TaskID string `json:"task_id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	// The link to the parent is kept in history
+	require.Eventually(t, func() bool {
+		entry, err := a.history.Get(response.TaskID)
+		return err == nil && entry.ParentTaskID == "task-parent1"
+	}, 2*time.Second, 50*time.Millisecond)
+}
+
+func TestTaskRequestID(t *testing.T) {
+	// Cannot use t.Parallel() with t.Setenv()
+	t.Setenv("CLAUDE_BIN", "echo")
+
+	tmpDir := t.TempDir()
+	promptsDir := filepath.Join(tmpDir, "prompts")
+	require.NoError(t, os.MkdirAll(promptsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "claude-prod.md"), []byte("# Test Instructions"), 0644))
+
+	cfg := config.Default()
+	cfg.SessionDir = filepath.Join(tmpDir, "sessions")
+	cfg.HistoryDir = filepath.Join(tmpDir, "history")
+	cfg.AgencyPromptsDir = promptsDir
+	a := New(cfg, "test")
+
+	req := httptest.NewRequest("POST", "/task", strings.NewReader(`{"prompt": "hello"}`))
+	req.Header.Set(api.RequestIDHeader, "req-trace-1")
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Equal(t, "req-trace-1", w.Header().Get(api.RequestIDHeader))
+	var response struct {
+		TaskID string `json:"task_id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	// The request ID is kept in history and tags the task's log entries
+	require.Eventually(t, func() bool {
+		entry, err := a.history.Get(response.TaskID)
+		return err == nil && entry.RequestID == "req-trace-1"
+	}, 2*time.Second, 50*time.Millisecond)
+
+	req = httptest.NewRequest("GET", "/logs?request_id=req-trace-1", nil)
+	w = httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var logs logging.QueryResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &logs))
+	require.NotEmpty(t, logs.Entries)
+	for _, entry := range logs.Entries {
+		require.Equal(t, response.TaskID, entry.TaskID)
+		require.Equal(t, "req-trace-1", entry.RequestID)
+	}
+
+	// Requests without a usable ID are given one
+	req = httptest.NewRequest("GET", "/status", nil)
+	req.Header.Set(api.RequestIDHeader, "not a valid id")
+	w = httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.True(t, api.ValidRequestID(w.Header().Get(api.RequestIDHeader)))
+	require.NotEqual(t, "not a valid id", w.Header().Get(api.RequestIDHeader))
+}
+
+func TestTaskAgencyPromptStamp(t *testing.T) {
+	// Cannot use t.Parallel() with t.Setenv()
+	t.Setenv("CLAUDE_BIN", "echo")
+
+	tmpDir := t.TempDir()
+	promptsDir := filepath.Join(tmpDir, "prompts")
+	require.NoError(t, os.MkdirAll(promptsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "claude-prod.md"), []byte("# Test Instructions"), 0644))
+
+	cfg := config.Default()
+	cfg.SessionDir = filepath.Join(tmpDir, "sessions")
+	cfg.HistoryDir = filepath.Join(tmpDir, "history")
+	cfg.AgencyPromptsDir = promptsDir
+	cfg.Profile = config.DefaultProfile
+	a := New(cfg, "test")
+
+	req := httptest.NewRequest("POST", "/task", strings.NewReader(`{"prompt": "hello"}`))
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var response struct {
+		TaskID string `json:"task_id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	// The prompt's file and content hash are kept in history
+	sum := sha256.Sum256([]byte("# Test Instructions"))
+	want := &history.PromptStamp{File: "claude-prod.md", Hash: hex.EncodeToString(sum[:])}
+	require.Eventually(t, func() bool {
+		entry, err := a.history.Get(response.TaskID)
+		return err == nil && reflect.DeepEqual(want, entry.AgencyPrompt)
+	}, 2*time.Second, 50*time.Millisecond)
+}
+
 func TestGetTaskNotFound(t *testing.T) {
 	t.Parallel()
 
@@ -221,6 +404,128 @@ func TestShutdownWithoutTask(t *testing.T) {
 	require.Contains(t, w.Body.String(), "Shutdown initiated")
 }
 
+func TestAuthTokenRequiredForMutatingEndpoints(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.AuthToken = "secret-token"
+	a := New(cfg, "test")
+	router := a.Router()
+
+	// Reads stay open
+	req := httptest.NewRequest("GET", "/status", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	for _, header := range []string{"", "Bearer wrong-token", "secret-token"} {
+		req := httptest.NewRequest("POST", "/task/missing/cancel", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusUnauthorized, w.Code, "Authorization: %q", header)
+		require.Contains(t, w.Body.String(), api.ErrorUnauthorized)
+	}
+
+	req = httptest.NewRequest("POST", "/task/missing/cancel", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDrainFinishesTaskThenShutsDown(t *testing.T) {
+	// Cannot use t.Parallel() with t.Setenv()
+	tmpDir := t.TempDir()
+	mockPath := filepath.Join(tmpDir, "mock-claude-slow")
+	script := `#!/bin/bash
+sleep 0.3
+echo '{"type":"result","subtype":"success","result":"finished"}'
+`
+	require.NoError(t, os.WriteFile(mockPath, []byte(script), 0755))
+	t.Setenv("CLAUDE_BIN", mockPath)
+
+	promptsDir := filepath.Join(tmpDir, "prompts")
+	require.NoError(t, os.MkdirAll(promptsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "claude-prod.md"), []byte("# Test Instructions"), 0644))
+
+	cfg := config.Default()
+	cfg.SessionDir = filepath.Join(tmpDir, "sessions")
+	cfg.HistoryDir = "" // Keep tasks in memory for verification
+	cfg.AgencyPromptsDir = promptsDir
+	a := New(cfg, "test")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	a.server = &http.Server{Handler: a.Router()}
+	served := make(chan error, 1)
+	go func() { served <- a.server.Serve(listener) }()
+
+	req := httptest.NewRequest("POST", "/task", strings.NewReader(`{"prompt": "slow"}`))
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp struct {
+		TaskID string `json:"task_id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	req = httptest.NewRequest("POST", "/drain", nil)
+	w = httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	require.Contains(t, w.Body.String(), resp.TaskID)
+
+	req = httptest.NewRequest("GET", "/status", nil)
+	w = httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Contains(t, w.Body.String(), `"state":"draining"`)
+
+	req = httptest.NewRequest("POST", "/task", strings.NewReader(`{"prompt": "rejected"}`))
+	w = httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Contains(t, w.Body.String(), api.ErrorAgentDraining)
+
+	// Server shuts down once the running task completes
+	select {
+	case err := <-served:
+		require.ErrorIs(t, err, http.ErrServerClosed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("agent did not shut down after drain")
+	}
+
+	a.mu.RLock()
+	state := a.tasks[resp.TaskID].State
+	a.mu.RUnlock()
+	require.Equal(t, TaskStateCompleted, state)
+}
+
+func TestDrainWhenIdleShutsDown(t *testing.T) {
+	t.Parallel()
+
+	a := New(config.Default(), "test")
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	a.server = &http.Server{Handler: a.Router()}
+	served := make(chan error, 1)
+	go func() { served <- a.server.Serve(listener) }()
+
+	req := httptest.NewRequest("POST", "/drain", nil)
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	select {
+	case err := <-served:
+		require.ErrorIs(t, err, http.ErrServerClosed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle agent did not shut down after drain")
+	}
+}
+
 func TestBuildClaudeArgs(t *testing.T) {
 	t.Parallel()
 
@@ -646,3 +951,239 @@ func TestLogsEndpointWithFilters(t *testing.T) {
 		require.Equal(t, "error", entry.Level)
 	}
 }
+
+func TestLogStreamEndpoint(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	a := New(cfg, "test-version")
+	a.log.WithTask("task-1").Info("task started")
+
+	srv := httptest.NewServer(a.Router())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/logs/stream?task_id=task-1")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	readEntry := func() logging.Entry {
+		t.Helper()
+		for {
+			line, err := reader.ReadString('\n')
+			require.NoError(t, err)
+			if data, ok := strings.CutPrefix(line, "data: "); ok {
+				var entry logging.Entry
+				require.NoError(t, json.Unmarshal([]byte(data), &entry))
+				return entry
+			}
+		}
+	}
+
+	// Stored entries come first, then new ones for the task alone
+	require.Equal(t, "task started", readEntry().Message)
+	a.log.WithTask("task-2").Info("other task")
+	a.log.WithTask("task-1").Warn("task nearing timeout")
+	entry := readEntry()
+	require.Equal(t, "task nearing timeout", entry.Message)
+	require.Equal(t, "task-1", entry.TaskID)
+
+	missing, err := http.Get(srv.URL + "/logs/stream")
+	require.NoError(t, err)
+	missing.Body.Close()
+	require.Equal(t, http.StatusBadRequest, missing.StatusCode)
+}
+
+func TestHistoryDiffEndpoint(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.HistoryDir = filepath.Join(t.TempDir(), "history")
+	a := New(cfg, "test")
+	require.NotNil(t, a.history)
+
+	require.NoError(t, a.history.Save(&history.Entry{TaskID: "task-a", Output: "one\ntwo", CompletedAt: time.Now()}))
+	require.NoError(t, a.history.Save(&history.Entry{TaskID: "task-b", Output: "one\nthree", CompletedAt: time.Now()}))
+
+	req := httptest.NewRequest("GET", "/history/diff?a=task-a&b=task-b", nil)
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var cmp history.Comparison
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &cmp))
+	require.Equal(t, "task-a", cmp.A.TaskID)
+	require.Equal(t, "task-b", cmp.B.TaskID)
+	require.Equal(t, 1, cmp.Output.Additions)
+	require.Equal(t, 1, cmp.Output.Deletions)
+
+	req = httptest.NewRequest("GET", "/history/diff?a=task-a", nil)
+	w = httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	req = httptest.NewRequest("GET", "/history/diff?a=task-a&b=missing", nil)
+	w = httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHistoryAnnotationEndpoints(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.HistoryDir = filepath.Join(t.TempDir(), "history")
+	a := New(cfg, "test")
+	require.NoError(t, a.history.Save(&history.Entry{TaskID: "task-a", State: "completed", CompletedAt: time.Now()}))
+	require.NoError(t, a.history.Save(&history.Entry{TaskID: "task-b", State: "completed", CompletedAt: time.Now()}))
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		a.Router().ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	w := serve(http.MethodPatch, "/history/task-a", `{"rating":"good","notes":"Clean fix","tags":["Auth","auth"]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var entry history.Entry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entry))
+	require.Equal(t, history.RatingGood, entry.Annotation.Rating)
+	require.Equal(t, []string{"auth"}, entry.Annotation.Tags)
+
+	w = serve(http.MethodGet, "/history?rating=good", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var list history.ListResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Entries, 1)
+	require.Equal(t, "task-a", list.Entries[0].TaskID)
+	require.Equal(t, "Clean fix", list.Entries[0].Annotation.Notes)
+
+	w = serve(http.MethodGet, "/history?tag=auth", "")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Entries, 1)
+
+	require.Equal(t, http.StatusBadRequest, serve(http.MethodGet, "/history?rating=meh", "").Code)
+	require.Equal(t, http.StatusBadRequest, serve(http.MethodPatch, "/history/task-b", `{"rating":"meh"}`).Code)
+	require.Equal(t, http.StatusBadRequest, serve(http.MethodPatch, "/history/task-b", `{"tags":"auth"}`).Code)
+	require.Equal(t, http.StatusNotFound, serve(http.MethodPatch, "/history/task-missing", `{"rating":"bad"}`).Code)
+}
+
+func TestHistoryExportEndpoint(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.HistoryDir = filepath.Join(t.TempDir(), "history")
+	a := New(cfg, "test")
+	now := time.Now().UTC().Truncate(time.Second)
+	require.NoError(t, a.history.Save(&history.Entry{TaskID: "task-old", State: "completed", Prompt: "old", StartedAt: now.Add(-2 * time.Hour), CompletedAt: now.Add(-2 * time.Hour)}))
+	require.NoError(t, a.history.Save(&history.Entry{TaskID: "task-new", State: "failed", Prompt: "new", StartedAt: now, CompletedAt: now,
+		Error: &history.EntryError{Type: "timeout", Message: "timed out"}}))
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		a.Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := get("/history/export")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[0], `"task_id":"task-old"`)
+
+	w = get("/history/export?format=csv&since=" + url.QueryEscape(now.Add(-time.Hour).Format(time.RFC3339)))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	require.Contains(t, w.Header().Get("Content-Disposition"), "history.csv")
+	lines = strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 2)
+	require.True(t, strings.HasPrefix(lines[0], "task_id,"))
+	require.Contains(t, lines[1], "task-new")
+	require.Contains(t, lines[1], "timeout")
+
+	require.Equal(t, http.StatusBadRequest, get("/history/export?format=xml").Code)
+	require.Equal(t, http.StatusBadRequest, get("/history/export?since=yesterday").Code)
+}
+
+func TestHistorySessionsEndpoints(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.HistoryDir = filepath.Join(t.TempDir(), "history")
+	a := New(cfg, "test")
+	require.NotNil(t, a.history)
+
+	now := time.Now()
+	require.NoError(t, a.history.Save(&history.Entry{TaskID: "task-a", SessionID: "sess-1", StartedAt: now, CompletedAt: now, DurationSeconds: 5}))
+	require.NoError(t, a.history.Save(&history.Entry{TaskID: "task-b", SessionID: "sess-1", StartedAt: now.Add(time.Second), CompletedAt: now.Add(time.Second), DurationSeconds: 7}))
+
+	req := httptest.NewRequest("GET", "/history/sessions", nil)
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var list history.SessionListResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Sessions, 1)
+	require.Equal(t, 2, list.Sessions[0].TaskCount)
+	require.Equal(t, 12.0, list.Sessions[0].DurationSeconds)
+
+	req = httptest.NewRequest("GET", "/history/sessions/sess-1", nil)
+	w = httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var detail history.SessionDetail
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &detail))
+	require.Equal(t, "sess-1", detail.SessionID)
+	require.Len(t, detail.Tasks, 2)
+	require.Equal(t, "task-a", detail.Tasks[0].TaskID)
+
+	req = httptest.NewRequest("GET", "/history/sessions/missing", nil)
+	w = httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHistorySearch(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.HistoryDir = filepath.Join(t.TempDir(), "history")
+	a := New(cfg, "test")
+
+	now := time.Now()
+	require.NoError(t, a.history.Save(&history.Entry{TaskID: "task-a", Prompt: "Fix the login page", CompletedAt: now}))
+	require.NoError(t, a.history.Save(&history.Entry{TaskID: "task-b", Prompt: "Update docs", CompletedAt: now}))
+
+	req := httptest.NewRequest("GET", "/history?q=LOGIN", nil)
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var result history.ListResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	require.Equal(t, 1, result.Total)
+	require.Equal(t, "task-a", result.Entries[0].TaskID)
+}
+
+func TestRunnerEnviron(t *testing.T) {
+	// Cannot use t.Parallel() with t.Setenv()
+	t.Setenv("AGENCY_AUTH_TOKEN", "agent-secret")
+	t.Setenv("AGENCY_CLAUDE_MODEL", "opus")
+	t.Setenv(api.AuthTokenEnv, "fleet-secret")
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("AGENCY_ROOT", "/srv/agency")
+	t.Setenv(config.ProfileEnv, "ci")
+
+	env := strings.Join(runnerEnviron(), "\n")
+	require.NotContains(t, env, "agent-secret")
+	require.NotContains(t, env, "AGENCY_CLAUDE_MODEL")
+	require.NotContains(t, env, "fleet-secret")
+	require.Contains(t, env, "GOFLAGS=-mod=mod")
+
+	// Operational variables that aren't config overrides are kept
+	require.Contains(t, env, "AGENCY_ROOT=/srv/agency")
+	require.Contains(t, env, config.ProfileEnv+"=ci")
+}
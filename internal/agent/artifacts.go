@@ -0,0 +1,156 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/config"
+)
+
+// collectArtifacts copies files matching the configured globs from the
+// task's working directory into history. Files are opened through an os.Root
+// at the workdir, so a symlinked file or directory can't smuggle in files
+// from outside it; symlinked files and oversized files are skipped.
+func (a *Agent) collectArtifacts(task *Task) {
+	cfg := a.cfg().Artifacts
+	if len(cfg.Globs) == 0 || a.history == nil {
+		return
+	}
+	maxBytes := cfg.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = config.DefaultArtifactMaxBytes
+	}
+	maxFiles := cfg.MaxFiles
+	if maxFiles <= 0 {
+		maxFiles = config.DefaultArtifactMaxFiles
+	}
+
+	taskLog := a.taskLog(task)
+	workDir := filepath.Join(a.cfg().SessionDir, task.WorkDir)
+	saved := make(map[string]bool)
+
+	root, err := os.OpenRoot(workDir)
+	if err != nil {
+		return
+	}
+	defer root.Close()
+
+	for _, pattern := range cfg.Globs {
+		matches, err := filepath.Glob(filepath.Join(workDir, pattern))
+		if err != nil {
+			taskLog.Warn("invalid artifact glob", map[string]any{"pattern": pattern, "error": err.Error()})
+			continue
+		}
+		for _, match := range matches {
+			rel, err := filepath.Rel(workDir, match)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || saved[rel] {
+				continue
+			}
+			if info, err := root.Lstat(rel); err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			if len(saved) >= maxFiles {
+				taskLog.Warn("artifact limit reached", map[string]any{"max_files": maxFiles})
+				return
+			}
+			data, err := readArtifact(root, rel, maxBytes)
+			if errors.Is(err, errArtifactTooLarge) {
+				taskLog.Warn("skipping oversized artifact", map[string]any{"name": rel})
+				continue
+			}
+			if err != nil {
+				continue
+			}
+			if err := a.history.SaveArtifact(task.ID, filepath.ToSlash(rel), data); err != nil {
+				taskLog.Warn("failed to save artifact", map[string]any{"name": rel, "error": err.Error()})
+				continue
+			}
+			saved[rel] = true
+		}
+	}
+}
+
+var errArtifactTooLarge = errors.New("artifact too large")
+
+// readArtifact reads a regular file through root, from the opened file
+// rather than by path again, so it can't be swapped for a link meanwhile.
+func readArtifact(root *os.Root, rel string, maxBytes int64) ([]byte, error) {
+	f, err := root.Open(rel)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", rel)
+	}
+	if info.Size() > maxBytes {
+		return nil, errArtifactTooLarge
+	}
+	data, err := io.ReadAll(io.LimitReader(f, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, errArtifactTooLarge
+	}
+	return data, nil
+}
+
+// handleListArtifacts returns the artifacts collected for a task.
+func (a *Agent) handleListArtifacts(w http.ResponseWriter, r *http.Request) {
+	if a.history == nil {
+		api.WriteError(w, http.StatusServiceUnavailable, "history_unavailable", "History storage not configured")
+		return
+	}
+
+	taskID := chi.URLParam(r, "id")
+	artifacts, err := a.history.ListArtifacts(taskID)
+	if err != nil {
+		api.WriteError(w, http.StatusNotFound, api.ErrorNotFound, err.Error())
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, map[string]any{
+		"task_id":   taskID,
+		"artifacts": artifacts,
+	})
+}
+
+// handleGetArtifact serves a single artifact file as a download.
+func (a *Agent) handleGetArtifact(w http.ResponseWriter, r *http.Request) {
+	if a.history == nil {
+		api.WriteError(w, http.StatusServiceUnavailable, "history_unavailable", "History storage not configured")
+		return
+	}
+
+	taskID := chi.URLParam(r, "id")
+	name := chi.URLParam(r, "*")
+	data, err := a.history.GetArtifact(taskID, name)
+	if err != nil {
+		api.WriteError(w, http.StatusNotFound, api.ErrorNotFound, err.Error())
+		return
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(name)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/config"
+)
+
+func TestArtifactsCollectedAfterTask(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Mock CLI that writes a couple of files into its working directory
+	// and links to files and a directory outside it
+	hostDir := filepath.Join(tmpDir, "host")
+	require.NoError(t, os.MkdirAll(hostDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(hostDir, "secret.md"), []byte("secret"), 0644))
+	mockPath := filepath.Join(tmpDir, "mock-claude-artifacts")
+	script := `#!/bin/bash
+mkdir -p out
+echo "report" > out/report.md
+echo "ignored" > scratch.tmp
+ln -s /etc/passwd out/leak.md
+ln -s ` + hostDir + ` linked
+echo '{"type":"result","subtype":"success","result":"done"}'
+`
+	require.NoError(t, os.WriteFile(mockPath, []byte(script), 0755))
+	t.Setenv("CLAUDE_BIN", mockPath)
+
+	promptsDir := filepath.Join(tmpDir, "prompts")
+	require.NoError(t, os.MkdirAll(promptsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "claude-prod.md"), []byte("# Test Instructions"), 0644))
+
+	cfg := config.Default()
+	cfg.SessionDir = filepath.Join(tmpDir, "sessions")
+	cfg.HistoryDir = filepath.Join(tmpDir, "history")
+	cfg.AgencyPromptsDir = promptsDir
+	cfg.Artifacts.Globs = []string{"out/*.md", "linked/*.md"}
+	a := New(cfg, "test")
+
+	req := httptest.NewRequest("POST", "/task", strings.NewReader(`{"prompt": "make files"}`))
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var resp struct {
+		TaskID string `json:"task_id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	require.Eventually(t, func() bool {
+		artifacts, err := a.history.ListArtifacts(resp.TaskID)
+		return err == nil && len(artifacts) > 0
+	}, 5*time.Second, 50*time.Millisecond)
+
+	req = httptest.NewRequest("GET", "/history/"+resp.TaskID+"/artifacts", nil)
+	w = httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var list struct {
+		Artifacts []struct {
+			Name string `json:"name"`
+		} `json:"artifacts"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Artifacts, 1, "symlinks, files under symlinked dirs and non-matching files are skipped")
+	require.Equal(t, "out/report.md", list.Artifacts[0].Name)
+
+	req = httptest.NewRequest("GET", "/history/"+resp.TaskID+"/artifacts/out/report.md", nil)
+	w = httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "report\n", w.Body.String())
+	require.Contains(t, w.Header().Get("Content-Disposition"), `filename="report.md"`)
+
+	req = httptest.NewRequest("GET", "/history/"+resp.TaskID+"/artifacts/missing.md", nil)
+	w = httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/config"
+)
+
+// attachmentsDir is the workdir subdirectory attachments are written to.
+const attachmentsDir = "attachments"
+
+var attachmentNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._ -]{0,254}$`)
+
+// validateAttachments checks a task's attachments against the attachments
+// config: safe unique names, and the file count, size and type limits.
+func (a *Agent) validateAttachments(attachments []api.Attachment) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+	limits := a.cfg().Attachments
+	maxFiles := limits.MaxFiles
+	if maxFiles <= 0 {
+		maxFiles = config.DefaultAttachmentMaxFiles
+	}
+	maxBytes := limits.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = config.DefaultAttachmentMaxBytes
+	}
+	if len(attachments) > maxFiles {
+		return fmt.Errorf("at most %d attachments are allowed, got %d", maxFiles, len(attachments))
+	}
+
+	seen := make(map[string]bool)
+	for _, att := range attachments {
+		if !attachmentNamePattern.MatchString(att.Name) {
+			return fmt.Errorf("attachment name %q must be a plain file name of letters, digits, spaces, '.', '_' or '-'", att.Name)
+		}
+		if seen[att.Name] {
+			return fmt.Errorf("attachment %q is given twice", att.Name)
+		}
+		seen[att.Name] = true
+		if int64(len(att.Data)) > maxBytes {
+			return fmt.Errorf("attachment %q is %d bytes, over the %d byte limit", att.Name, len(att.Data), maxBytes)
+		}
+		if len(limits.AllowedTypes) > 0 {
+			contentType := attachmentType(att.Data)
+			if !typeAllowed(contentType, limits.AllowedTypes) {
+				return fmt.Errorf("attachment %q has type %s, which is not allowed", att.Name, contentType)
+			}
+		}
+	}
+	return nil
+}
+
+// attachmentType returns the media type detected from the content, without
+// parameters such as charset.
+func attachmentType(data []byte) string {
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(data))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return mediaType
+}
+
+// typeAllowed reports whether contentType matches one of the patterns,
+// which are full types or a major type with "/*".
+func typeAllowed(contentType string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if major, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if strings.HasPrefix(contentType, major+"/") {
+				return true
+			}
+		} else if pattern == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// writeAttachments writes the task's attachments into the attachments
+// directory of workDir, replacing files of the same name from earlier tasks
+// in the session. In worktree mode the directory is excluded from git, so
+// attachments don't show up in the task's diff.
+func (a *Agent) writeAttachments(task *Task, workDir string) error {
+	dir := filepath.Join(workDir, attachmentsDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	for i, att := range task.attachments {
+		if err := os.WriteFile(filepath.Join(dir, att.Name), att.Data, 0600); err != nil {
+			return err
+		}
+		task.attachments[i].Data = nil // Written; only the name is needed from here
+	}
+
+	if a.cfg().Worktree.Repo != "" {
+		exclude := filepath.Join(workDir, ".git", "info", "exclude")
+		data, _ := os.ReadFile(exclude)
+		line := "/" + attachmentsDir + "/"
+		if !strings.Contains(string(data), line+"\n") {
+			if err := os.MkdirAll(filepath.Dir(exclude), 0700); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(exclude, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if _, err := f.WriteString(line + "\n"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// attachmentsNote tells the CLI where the task's attachments are.
+func attachmentsNote(attachments []api.Attachment) string {
+	if len(attachments) == 0 {
+		return ""
+	}
+	paths := make([]string, len(attachments))
+	for i, att := range attachments {
+		paths[i] = attachmentsDir + "/" + att.Name
+	}
+	return "\n\nAttached files (relative to the working directory): " + strings.Join(paths, ", ")
+}
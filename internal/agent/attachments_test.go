@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/config"
+)
+
+func TestValidateAttachments(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.Attachments.MaxBytes = 16
+	cfg.Attachments.MaxFiles = 2
+	cfg.Attachments.AllowedTypes = []string{"text/*", "application/json"}
+	a := New(cfg, "test")
+
+	text := []byte("hello\n")
+	tests := []struct {
+		name        string
+		attachments []api.Attachment
+		wantErr     string
+	}{
+		{"none", nil, ""},
+		{"text", []api.Attachment{{Name: "app.log", Data: text}}, ""},
+		{"json", []api.Attachment{{Name: "data.json", Data: []byte(`{"a":1}`)}}, ""},
+		{"too many", []api.Attachment{{Name: "a", Data: text}, {Name: "b", Data: text}, {Name: "c", Data: text}}, "at most 2 attachments"},
+		{"path", []api.Attachment{{Name: "../etc/passwd", Data: text}}, "must be a plain file name"},
+		{"hidden", []api.Attachment{{Name: ".env", Data: text}}, "must be a plain file name"},
+		{"duplicate", []api.Attachment{{Name: "a", Data: text}, {Name: "a", Data: text}}, "given twice"},
+		{"too big", []api.Attachment{{Name: "a", Data: bytes.Repeat([]byte("x"), 17)}}, "over the 16 byte limit"},
+		{"disallowed type", []api.Attachment{{Name: "a.png", Data: []byte("\x89PNG\r\n\x1a\n")}}, "image/png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := a.validateAttachments(tt.attachments)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTaskRejectsInvalidAttachments(t *testing.T) {
+	t.Parallel()
+
+	a := New(config.Default(), "test")
+	body, err := json.Marshal(map[string]any{
+		"prompt":      "review",
+		"attachments": []api.Attachment{{Name: "a/b", Data: []byte("x")}},
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/task", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "must be a plain file name")
+}
+
+func TestAttachmentsWrittenBeforeTask(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Mock CLI that records its arguments and the attachment it finds
+	mockPath := filepath.Join(tmpDir, "mock-claude-attachments")
+	script := `#!/bin/bash
+echo "$@" > args.txt
+cp attachments/app.log seen.log
+echo '{"type":"result","subtype":"success","result":"done"}'
+`
+	require.NoError(t, os.WriteFile(mockPath, []byte(script), 0755))
+	t.Setenv("CLAUDE_BIN", mockPath)
+
+	promptsDir := filepath.Join(tmpDir, "prompts")
+	require.NoError(t, os.MkdirAll(promptsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "claude-prod.md"), []byte("# Test Instructions"), 0644))
+
+	cfg := config.Default()
+	cfg.SessionDir = filepath.Join(tmpDir, "sessions")
+	cfg.HistoryDir = filepath.Join(tmpDir, "history")
+	cfg.AgencyPromptsDir = promptsDir
+	a := New(cfg, "test")
+
+	body, err := json.Marshal(map[string]any{
+		"prompt":      "review the attached log",
+		"attachments": []api.Attachment{{Name: "app.log", Data: []byte("ERROR boom\n")}},
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/task", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var resp struct {
+		TaskID    string `json:"task_id"`
+		SessionID string `json:"session_id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	require.Eventually(t, func() bool {
+		req := httptest.NewRequest("GET", "/task/"+resp.TaskID, nil)
+		w := httptest.NewRecorder()
+		a.Router().ServeHTTP(w, req)
+		var status struct {
+			State string `json:"state"`
+		}
+		return json.Unmarshal(w.Body.Bytes(), &status) == nil && status.State == "completed"
+	}, 5*time.Second, 50*time.Millisecond)
+
+	workDir := filepath.Join(cfg.SessionDir, resp.SessionID)
+	seen, err := os.ReadFile(filepath.Join(workDir, "seen.log"))
+	require.NoError(t, err)
+	require.Equal(t, "ERROR boom\n", string(seen))
+
+	args, err := os.ReadFile(filepath.Join(workDir, "args.txt"))
+	require.NoError(t, err)
+	require.Contains(t, string(args), "Attached files (relative to the working directory): attachments/app.log")
+}
@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"phobos.org.uk/agency/internal/backup"
+)
+
+// newBackupRunner returns the runner for the backup settings, or nil if
+// backups are off or can't be set up.
+func (a *Agent) newBackupRunner() *backup.Runner {
+	cfg := a.cfg()
+	if !cfg.Backup.Enabled() {
+		return nil
+	}
+	sources := []backup.Source{
+		{Name: "history", Dir: cfg.HistoryDir},
+		{Name: "sessions", Dir: cfg.SessionDir, Skip: isHiddenTopLevel},
+		{Name: "sessions.json", Snapshot: a.sessionsSnapshot},
+	}
+	runner, err := backup.New(backup.Options{
+		Destination: cfg.Backup.Destination,
+		Endpoint:    cfg.Backup.Endpoint,
+		Region:      cfg.Backup.Region,
+		Interval:    cfg.Backup.Interval,
+		Retain:      cfg.Backup.Retain,
+		Prefix:      "agent-" + cfg.Name + "-" + a.agentKind,
+		Version:     a.version,
+		OnResult:    a.logBackup,
+	}, sources)
+	if err != nil {
+		a.log.Warn("backups disabled", map[string]any{"error": err.Error()})
+		return nil
+	}
+	return runner
+}
+
+// isHiddenTopLevel reports whether rel names a hidden entry at the top of the
+// session directory, such as .certs or a restore in progress, which aren't
+// sessions.
+func isHiddenTopLevel(rel string) bool {
+	return !strings.Contains(rel, "/") && strings.HasPrefix(rel, ".")
+}
+
+// sessionsSnapshot is the session listing from /sessions, kept in backups
+// as a record of the sessions the history refers to.
+func (a *Agent) sessionsSnapshot() ([]byte, error) {
+	sessions, err := a.sessions()
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(map[string]any{"sessions": sessions}, "", "  ")
+}
+
+func (a *Agent) logBackup(status backup.Status) {
+	if status.LastError != "" {
+		a.log.Warn("backup failed", map[string]any{
+			"destination": status.Destination,
+			"error":       status.LastError,
+		})
+		return
+	}
+	a.log.Info("backup written", map[string]any{
+		"destination": status.Destination,
+		"archive":     status.LastArchive,
+		"bytes":       status.LastSizeBytes,
+	})
+}
+
+// RunBackups backs up the history every backup interval until ctx is
+// cancelled. It returns at once if backups are off.
+func (a *Agent) RunBackups(ctx context.Context) {
+	if a.backups == nil {
+		return
+	}
+	a.backups.Run(ctx)
+}
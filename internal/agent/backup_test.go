@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/config"
+	"phobos.org.uk/agency/internal/history"
+)
+
+func TestAgentBackups(t *testing.T) {
+	t.Parallel()
+
+	dest := filepath.Join(t.TempDir(), "backups")
+	cfg := config.Default()
+	cfg.Name = "dev"
+	cfg.SessionDir = t.TempDir()
+	cfg.HistoryDir = filepath.Join(t.TempDir(), "history")
+	cfg.Backup = config.BackupConfig{Destination: dest}
+	a := New(cfg, "test")
+	require.NotNil(t, a.backups)
+	require.NoError(t, a.history.Save(&history.Entry{TaskID: "task-1", State: "completed", CompletedAt: time.Now()}))
+
+	name, err := a.backups.Backup(context.Background())
+	require.NoError(t, err)
+	require.Regexp(t, `^agent-dev-claude-.*\.tar\.gz$`, name)
+	_, err = os.Stat(filepath.Join(dest, name))
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var status StatusResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	require.NotNil(t, status.Backup)
+	require.Equal(t, dest, status.Backup.Destination)
+	require.Equal(t, name, status.Backup.LastArchive)
+
+	// Without a destination there is no runner and no status
+	cfg = config.Default()
+	cfg.HistoryDir = ""
+	a = New(cfg, "test")
+	require.Nil(t, a.backups)
+	a.RunBackups(context.Background()) // Returns at once
+	w = httptest.NewRecorder()
+	a.Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	require.NotContains(t, w.Body.String(), `"backup"`)
+}
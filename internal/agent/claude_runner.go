@@ -3,7 +3,10 @@ package agent
 import (
 	"encoding/json"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 
 	"phobos.org.uk/agency/internal/api"
 	"phobos.org.uk/agency/internal/config"
@@ -23,13 +26,40 @@ func (claudeRunner) ResolveBin() string {
 	return claudeBin
 }
 
+// claudePermissionModes are the values accepted by --permission-mode.
+var claudePermissionModes = []string{"default", "acceptEdits", "plan", "bypassPermissions"}
+
 func (claudeRunner) BuildCommand(task *Task, prompt string, cfg *config.Config) RunnerCommand {
-	args := []string{
-		"--print",
-		"--dangerously-skip-permissions",
+	maxTurns := cfg.Claude.MaxTurns
+	if task.MaxTurns > 0 {
+		maxTurns = task.MaxTurns
+	}
+
+	// An allowlist policy only holds if permissions aren't bypassed: in the
+	// default mode, tools outside --allowedTools are denied and reported.
+	args := []string{"--print"}
+	switch {
+	case task.PermissionMode != "":
+		args = append(args, "--permission-mode", task.PermissionMode)
+	case len(cfg.Policy.AllowedTools) > 0:
+		args = append(args, "--permission-mode", "default")
+	default:
+		args = append(args, "--dangerously-skip-permissions")
+	}
+	args = append(args,
 		"--model", task.Model,
 		"--output-format", "json",
-		"--max-turns", strconv.Itoa(cfg.Claude.MaxTurns),
+		"--max-turns", strconv.Itoa(maxTurns),
+	)
+	allowedTools := task.AllowedTools
+	if len(allowedTools) == 0 {
+		allowedTools = cfg.Policy.AllowedTools
+	}
+	if len(allowedTools) > 0 {
+		args = append(args, "--allowedTools", strings.Join(allowedTools, ","))
+	}
+	if len(cfg.Policy.DeniedTools) > 0 {
+		args = append(args, "--disallowedTools", strings.Join(cfg.Policy.DeniedTools, ","))
 	}
 
 	// Add session handling for conversation continuity
@@ -59,6 +89,9 @@ func (claudeRunner) ParseOutput(stdout []byte) (RunnerOutput, bool) {
 			InputTokens  int `json:"input_tokens"`
 			OutputTokens int `json:"output_tokens"`
 		} `json:"usage"`
+		PermissionDenials []struct {
+			ToolName string `json:"tool_name"`
+		} `json:"permission_denials"`
 	}
 
 	if err := json.Unmarshal(stdout, &resp); err != nil {
@@ -76,6 +109,9 @@ func (claudeRunner) ParseOutput(stdout []byte) (RunnerOutput, bool) {
 		MaxTurnsExceeded: resp.Subtype == "error_max_turns",
 		HasOutput:        true,
 	}
+	for _, denial := range resp.PermissionDenials {
+		out.DeniedTools = append(out.DeniedTools, denial.ToolName)
+	}
 	return out, true
 }
 
@@ -90,3 +126,35 @@ func (claudeRunner) SupportsAutoResume() bool {
 func (claudeRunner) MaxTurnsLimit(cfg *config.Config) int {
 	return cfg.Claude.MaxTurns
 }
+
+func (claudeRunner) PermissionModes() []string {
+	return claudePermissionModes
+}
+
+func (claudeRunner) SupportsAllowedTools() bool {
+	return true
+}
+
+// claudeProjectChars matches the characters the CLI replaces with "-" when
+// naming a project directory after its working directory.
+var claudeProjectChars = regexp.MustCompile(`[^A-Za-z0-9]`)
+
+// StateDir returns CLAUDE_CONFIG_DIR, or ~/.claude.
+func (claudeRunner) StateDir() (string, string) {
+	return "CLAUDE_CONFIG_DIR", cliStateDir("CLAUDE_CONFIG_DIR", ".claude")
+}
+
+// SessionState returns the CLI's project directory for the workdir, under
+// CLAUDE_CONFIG_DIR or ~/.claude. Each session has its own workdir, so the
+// project holds that session's transcripts alone.
+func (r claudeRunner) SessionState(workDir, _ string) []string {
+	_, root := r.StateDir()
+	if root == "" {
+		return nil
+	}
+	abs, err := filepath.Abs(workDir)
+	if err != nil {
+		return nil
+	}
+	return []string{filepath.Join(root, "projects", claudeProjectChars.ReplaceAllString(abs, "-"))}
+}
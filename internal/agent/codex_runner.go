@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"phobos.org.uk/agency/internal/api"
@@ -25,13 +26,20 @@ func (codexRunner) ResolveBin() string {
 	return codexBin
 }
 
+// codexSandboxModes are the values accepted by --sandbox.
+var codexSandboxModes = []string{"read-only", "workspace-write", "danger-full-access"}
+
 func (codexRunner) BuildCommand(task *Task, prompt string, cfg *config.Config) RunnerCommand {
-	args := []string{
-		"exec",
-		"--dangerously-bypass-approvals-and-sandbox",
+	args := []string{"exec"}
+	if task.PermissionMode != "" {
+		args = append(args, "--sandbox", task.PermissionMode)
+	} else {
+		args = append(args, "--dangerously-bypass-approvals-and-sandbox")
+	}
+	args = append(args,
 		"--json",
 		"--skip-git-repo-check",
-	}
+	)
 
 	if task.Model != "" {
 		args = append(args, "--model", task.Model)
@@ -116,6 +124,30 @@ func (codexRunner) MaxTurnsLimit(cfg *config.Config) int {
 	return 0
 }
 
+func (codexRunner) PermissionModes() []string {
+	return codexSandboxModes
+}
+
+func (codexRunner) SupportsAllowedTools() bool {
+	return false
+}
+
+// StateDir returns CODEX_HOME, or ~/.codex.
+func (codexRunner) StateDir() (string, string) {
+	return "CODEX_HOME", cliStateDir("CODEX_HOME", ".codex")
+}
+
+// SessionState returns the session's rollout files, kept by date under
+// CODEX_HOME or ~/.codex.
+func (r codexRunner) SessionState(_, sessionID string) []string {
+	_, root := r.StateDir()
+	if root == "" {
+		return nil
+	}
+	matches, _ := filepath.Glob(filepath.Join(root, "sessions", "*", "*", "*", "rollout-*-"+sessionID+".jsonl"))
+	return matches
+}
+
 func extractOutputText(raw map[string]any) (string, bool) {
 	if v, ok := raw["result"].(string); ok {
 		return v, true
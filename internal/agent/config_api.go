@@ -0,0 +1,196 @@
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/config"
+)
+
+// ConfigSettings are the settings served and updated at /config: the ones an
+// agent applies without a restart.
+type ConfigSettings struct {
+	AgentKind      string            `json:"agent_kind"`
+	Tiers          map[string]string `json:"tiers"`                 // Configured tier models; other tiers use the agent kind's defaults
+	Model          string            `json:"model"`                 // claude.model or codex.model
+	TimeoutSeconds int               `json:"timeout_seconds"`       // Default task timeout
+	MaxTurns       int               `json:"max_turns,omitempty"`   // Claude only
+	ConfigFile     string            `json:"config_file,omitempty"` // Where updates are saved; empty if they last until restart
+	Profile        string            `json:"profile"`               // Config profile in effect
+}
+
+// ConfigUpdate is the body of PUT /config. Omitted fields are kept; a tier
+// set to "" goes back to the agent kind's default model.
+type ConfigUpdate struct {
+	Tiers          map[string]string `json:"tiers,omitempty"`
+	Model          *string           `json:"model,omitempty"`
+	TimeoutSeconds *int              `json:"timeout_seconds,omitempty"`
+	MaxTurns       *int              `json:"max_turns,omitempty"`
+}
+
+// SetConfigPath names the config file the agent was loaded from, so updates
+// through PUT /config are saved there and survive a restart.
+func (a *Agent) SetConfigPath(path string) {
+	a.cfgMu.Lock()
+	defer a.cfgMu.Unlock()
+	a.configPath = path
+}
+
+func (a *Agent) configSettings() ConfigSettings {
+	a.cfgMu.RLock()
+	cfg, path := a.config, a.configPath
+	a.cfgMu.RUnlock()
+
+	settings := ConfigSettings{
+		AgentKind:  a.agentKind,
+		Tiers:      map[string]string{},
+		ConfigFile: path,
+		Profile:    a.profile(),
+	}
+	for _, tier := range cfg.Tiers.Configured() {
+		settings.Tiers[tier] = cfg.Tiers.Value(tier)
+	}
+	switch a.agentKind {
+	case api.AgentKindCodex:
+		settings.Model = cfg.Codex.Model
+		settings.TimeoutSeconds = int(cfg.Codex.Timeout.Seconds())
+	default:
+		settings.Model = cfg.Claude.Model
+		settings.TimeoutSeconds = int(cfg.Claude.Timeout.Seconds())
+		settings.MaxTurns = cfg.Claude.MaxTurns
+	}
+	return settings
+}
+
+func (a *Agent) handleGetConfig(w http.ResponseWriter, r *http.Request) {
+	api.WriteJSON(w, http.StatusOK, a.configSettings())
+}
+
+// handlePutConfig applies a ConfigUpdate. With a config file, the changes are
+// written to it and reloaded, as if the file had been edited; without one
+// they last until the agent restarts. When the profile in effect is defined in
+// the file, the changes are written to that profile, since its settings win
+// over the base ones.
+func (a *Agent) handlePutConfig(w http.ResponseWriter, r *http.Request) {
+	var update ConfigUpdate
+	if !api.DecodeJSON(w, r, &update) {
+		return
+	}
+
+	a.configUpdate.Lock()
+	defer a.configUpdate.Unlock()
+
+	next := *a.cfg()
+	values, err := a.applyConfigUpdate(&next, update)
+	if err == nil {
+		err = next.Validate()
+	}
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, err.Error())
+		return
+	}
+	// A -set flag or environment variable would win over the edit on reload
+	if pinned := pinnedKeys(values); len(pinned) > 0 {
+		api.WriteError(w, http.StatusConflict, api.ErrorConfigError,
+			fmt.Sprintf("Overridden by -set or an %s* environment variable, so the edit would have no effect: %s",
+				config.EnvPrefix, strings.Join(pinned, ", ")))
+		return
+	}
+
+	a.cfgMu.RLock()
+	path := a.configPath
+	a.cfgMu.RUnlock()
+	if path != "" {
+		if _, ok := next.Profiles[next.Profile]; ok {
+			values = profileKeys(next.Profile, values)
+		}
+		if err := config.UpdateFile(path, values); err != nil {
+			api.WriteError(w, http.StatusInternalServerError, api.ErrorConfigError, err.Error())
+			return
+		}
+		if err := a.ReloadConfig(path); err != nil {
+			api.WriteError(w, http.StatusInternalServerError, api.ErrorConfigError, err.Error())
+			return
+		}
+	} else {
+		a.cfgMu.Lock()
+		a.config = &next
+		a.cfgMu.Unlock()
+		a.log.Info("config updated", map[string]any{
+			"model":   a.defaultModel(),
+			"timeout": a.defaultTimeout().String(),
+		})
+	}
+
+	api.WriteJSON(w, http.StatusOK, a.configSettings())
+}
+
+// pinnedKeys returns the keys among values that a -set flag or environment
+// variable overrides, sorted.
+func pinnedKeys(values map[string]any) []string {
+	var pinned []string
+	for key := range values {
+		if config.Overridden(config.EnvPrefix, key) {
+			pinned = append(pinned, key)
+		}
+	}
+	sort.Strings(pinned)
+	return pinned
+}
+
+// applyConfigUpdate applies update to cfg and returns the changed settings as
+// config file keys.
+func (a *Agent) applyConfigUpdate(cfg *config.Config, update ConfigUpdate) (map[string]any, error) {
+	values := map[string]any{}
+	for tier, model := range update.Tiers {
+		switch tier {
+		case api.TierFast:
+			cfg.Tiers.Fast = model
+		case api.TierStandard:
+			cfg.Tiers.Standard = model
+		case api.TierHeavy:
+			cfg.Tiers.Heavy = model
+		default:
+			return nil, fmt.Errorf("unknown tier %q", tier)
+		}
+		values["tiers."+tier] = model
+	}
+
+	section := a.agentKind
+	model, timeout := &cfg.Claude.Model, &cfg.Claude.Timeout
+	if a.agentKind == api.AgentKindCodex {
+		model, timeout = &cfg.Codex.Model, &cfg.Codex.Timeout
+		if update.MaxTurns != nil {
+			return nil, fmt.Errorf("max_turns is not supported by %s agents", a.agentKind)
+		}
+	}
+	if update.Model != nil {
+		if *update.Model == "" {
+			return nil, fmt.Errorf("model must not be empty")
+		}
+		*model = *update.Model
+		values[section+".model"] = *update.Model
+	}
+	if update.TimeoutSeconds != nil {
+		*timeout = time.Duration(*update.TimeoutSeconds) * time.Second
+		values[section+".timeout"] = *timeout
+	}
+	if update.MaxTurns != nil {
+		cfg.Claude.MaxTurns = *update.MaxTurns
+		values[section+".max_turns"] = *update.MaxTurns
+	}
+	return values, nil
+}
+
+// profileKeys moves config file keys under the named profile.
+func profileKeys(profile string, values map[string]any) map[string]any {
+	keys := make(map[string]any, len(values))
+	for key, value := range values {
+		keys["profiles."+profile+"."+key] = value
+	}
+	return keys
+}
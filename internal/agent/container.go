@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"phobos.org.uk/agency/internal/config"
+)
+
+// containerCommand wraps a CLI invocation in "<runtime> run", so the CLI and
+// the commands it runs see only the task's workdir, the CLI's state
+// directory and the configured mounts. The workdir and state directory are
+// mounted at their host paths, keeping paths in output, history and session
+// state the same as on the host.
+//
+// Variables are passed by name only, so their values come from the
+// runtime's own environment rather than appearing in its arguments.
+func containerCommand(cc config.ContainerConfig, r Runner, taskID, bin string, args []string, workDir string, env map[string]string) (string, []string, error) {
+	absWorkDir, err := filepath.Abs(workDir)
+	if err != nil {
+		return "", nil, fmt.Errorf("resolving workdir: %w", err)
+	}
+
+	run := []string{"run", "--rm", "-i", "--init",
+		"--label", "agency.task=" + taskID,
+		"-v", absWorkDir + ":" + absWorkDir,
+		"-w", absWorkDir,
+	}
+	if uid, gid := os.Getuid(), os.Getgid(); uid >= 0 {
+		// Files the task writes stay owned by the agent's user
+		run = append(run, "--user", fmt.Sprintf("%d:%d", uid, gid))
+	}
+	if cc.Network != "" {
+		run = append(run, "--network", cc.Network)
+	}
+
+	if envVar, stateDir := r.StateDir(); stateDir != "" {
+		absStateDir, err := filepath.Abs(stateDir)
+		if err != nil {
+			return "", nil, fmt.Errorf("resolving %s: %w", envVar, err)
+		}
+		// Created here, or the runtime would create it owned by root
+		if err := os.MkdirAll(absStateDir, 0700); err != nil {
+			return "", nil, fmt.Errorf("creating %s: %w", envVar, err)
+		}
+		run = append(run, "-v", absStateDir+":"+absStateDir, "-e", envVar+"="+absStateDir)
+	}
+	for _, mount := range cc.Mounts {
+		run = append(run, "-v", mount)
+	}
+
+	names := slices.Clone(cc.Env)
+	for name := range env {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range slices.Compact(names) {
+		run = append(run, "-e", name)
+	}
+
+	run = append(run, cc.Args...)
+	run = append(run, cc.Image, bin)
+	return cc.RuntimeBin(), append(run, args...), nil
+}
+
+// containerCleanupTimeout bounds the runtime commands removing a task's
+// containers.
+const containerCleanupTimeout = 30 * time.Second
+
+// removeTaskContainers force-removes any container left for a task, found by
+// its agency.task label. Killing "<runtime> run" stops only the client, as
+// the runtime doesn't pass SIGKILL on to the container.
+func removeTaskContainers(runtime, taskID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), containerCleanupTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, runtime, "ps", "-aq", "--filter", "label=agency.task="+taskID).Output()
+	if err != nil {
+		return fmt.Errorf("listing containers: %w", err)
+	}
+	ids := strings.Fields(string(out))
+	if len(ids) == 0 {
+		return nil
+	}
+	if out, err := exec.CommandContext(ctx, runtime, append([]string{"rm", "-f"}, ids...)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("removing containers: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"phobos.org.uk/agency/internal/config"
+)
+
+func TestContainerCommand(t *testing.T) {
+	stateDir := filepath.Join(t.TempDir(), "claude")
+	t.Setenv("CLAUDE_CONFIG_DIR", stateDir)
+	workDir := t.TempDir()
+
+	cc := config.ContainerConfig{
+		Image:   "agency-claude:latest",
+		Runtime: config.ContainerRuntimePodman,
+		Network: "none",
+		Mounts:  []string{"/srv/cache:/cache:ro"},
+		Env:     []string{"ANTHROPIC_API_KEY", "GIT_TOKEN"},
+		Args:    []string{"--memory=4g"},
+	}
+	env := map[string]string{"GIT_TOKEN": "secret", "AGENCY_SUBTASK_URL": "http://127.0.0.1:8081"}
+	bin, args, err := containerCommand(cc, NewClaudeRunner(), "task-1", "claude", []string{"--print", "-p"}, workDir, env)
+	require.NoError(t, err)
+	require.Equal(t, "podman", bin)
+
+	want := []string{"run", "--rm", "-i", "--init",
+		"--label", "agency.task=task-1",
+		"-v", workDir + ":" + workDir,
+		"-w", workDir,
+		"--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+		"--network", "none",
+		"-v", stateDir + ":" + stateDir, "-e", "CLAUDE_CONFIG_DIR=" + stateDir,
+		"-v", "/srv/cache:/cache:ro",
+		"-e", "AGENCY_SUBTASK_URL", "-e", "ANTHROPIC_API_KEY", "-e", "GIT_TOKEN",
+		"--memory=4g",
+		"agency-claude:latest", "claude", "--print", "-p",
+	}
+	require.Equal(t, want, args)
+	require.NotContains(t, fmt.Sprint(args), "secret", "values stay out of the arguments")
+	require.DirExists(t, stateDir)
+}
+
+func TestContainerCommandDefaultRuntime(t *testing.T) {
+	t.Setenv("CODEX_HOME", filepath.Join(t.TempDir(), "codex"))
+
+	bin, args, err := containerCommand(config.ContainerConfig{Image: "agency-codex"}, NewCodexRunner(), "task-2", "codex", []string{"exec"}, t.TempDir(), nil)
+	require.NoError(t, err)
+	require.Equal(t, "docker", bin)
+	require.NotContains(t, args, "--network", "the runtime's default network")
+	require.Equal(t, []string{"agency-codex", "codex", "exec"}, args[len(args)-3:])
+}
+
+// fakeRuntime puts a docker on PATH that logs its arguments to the returned
+// file. "run" hangs like a stuck container; "ps" prints psOutput.
+func fakeRuntime(t *testing.T, psOutput string) string {
+	t.Helper()
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "calls.log")
+	script := fmt.Sprintf(`#!/bin/sh
+echo "$*" >> %s
+case "$1" in
+run) exec sleep 30 ;;
+ps) printf '%s' ;;
+esac
+`, logPath, psOutput)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docker"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return logPath
+}
+
+func TestRemoveTaskContainers(t *testing.T) {
+	// Cannot use t.Parallel() with t.Setenv()
+	logPath := fakeRuntime(t, "")
+	require.NoError(t, removeTaskContainers("docker", "task-1"))
+	calls, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	require.Equal(t, "ps -aq --filter label=agency.task=task-1\n", string(calls), "nothing to remove")
+}
+
+func TestContainerRemovedAfterTimeout(t *testing.T) {
+	// Cannot use t.Parallel() with t.Setenv()
+	logPath := fakeRuntime(t, "c0ffee\n")
+	t.Setenv("CLAUDE_CONFIG_DIR", filepath.Join(t.TempDir(), "claude"))
+	tmpDir := t.TempDir()
+	promptsDir := filepath.Join(tmpDir, "prompts")
+	require.NoError(t, os.MkdirAll(promptsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "claude-prod.md"), []byte("# Test Instructions"), 0644))
+
+	cfg := config.Default()
+	cfg.SessionDir = filepath.Join(tmpDir, "sessions")
+	cfg.HistoryDir = filepath.Join(tmpDir, "history")
+	cfg.AgencyPromptsDir = promptsDir
+	cfg.Container = config.ContainerConfig{Image: "agency-claude"}
+	a := New(cfg, "test")
+
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/task", strings.NewReader(`{"prompt": "hang", "timeout_seconds": 1}`)))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var resp struct {
+		TaskID string `json:"task_id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	require.Eventually(t, func() bool {
+		calls, _ := os.ReadFile(logPath)
+		return strings.Contains(string(calls), "rm -f c0ffee")
+	}, 10*time.Second, 50*time.Millisecond)
+	calls, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	require.Contains(t, string(calls), "ps -aq --filter label=agency.task="+resp.TaskID)
+}
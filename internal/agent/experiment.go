@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"math/rand/v2"
+	"path/filepath"
+
+	"phobos.org.uk/agency/internal/config"
+	"phobos.org.uk/agency/internal/history"
+)
+
+// applyExperiment puts task in an arm of the running prompt experiment and
+// returns the agency prompt for that arm, stamped with the experiment. A task
+// keeps its arm when it runs again, so resumes don't mix the prompts. If the
+// variant prompt can't be read, the task runs outside the experiment with the
+// usual prompt rather than being counted in either arm.
+func (a *Agent) applyExperiment(task *Task, exp config.ExperimentConfig, prompt string, stamp *history.PromptStamp) (string, *history.PromptStamp) {
+	name := exp.Label()
+	a.mu.Lock()
+	arm := ""
+	if prev := task.agencyPrompt; prev != nil && prev.Experiment == name {
+		arm = prev.Arm
+	}
+	a.mu.Unlock()
+	if arm == "" {
+		arm = history.ArmControl
+		if rand.IntN(100) < exp.Percent {
+			arm = history.ArmVariant
+		}
+	}
+
+	if arm == history.ArmVariant {
+		variant, variantStamp, err := readAgencyPrompt(a.experimentVariantPath(exp))
+		if err != nil {
+			a.log.Warn("prompt experiment variant unavailable, using the usual prompt", map[string]any{
+				"task_id":    task.ID,
+				"experiment": name,
+				"error":      err.Error(),
+			})
+			return prompt, stamp
+		}
+		prompt, stamp = variant, variantStamp
+	}
+	stamp.Experiment = name
+	stamp.Arm = arm
+	return prompt, stamp
+}
+
+// experimentVariantPath returns the path of the experiment's variant prompt.
+func (a *Agent) experimentVariantPath(exp config.ExperimentConfig) string {
+	if filepath.IsAbs(exp.Variant) {
+		return exp.Variant
+	}
+	return filepath.Join(a.promptsDir(), exp.Variant)
+}
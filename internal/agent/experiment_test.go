@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/config"
+	"phobos.org.uk/agency/internal/history"
+)
+
+func TestApplyExperiment(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "claude-prod.md"), []byte("# Control"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "claude-prod-b.md"), []byte("# Variant"), 0644))
+	cfg := config.Default()
+	cfg.SessionDir = filepath.Join(dir, "sessions")
+	cfg.HistoryDir = filepath.Join(dir, "history")
+	cfg.AgencyPromptsDir = dir
+	cfg.Profile = config.DefaultProfile
+	a := New(cfg, "test")
+
+	control, controlStamp, err := a.loadAgencyPrompt()
+	require.NoError(t, err)
+	exp := config.ExperimentConfig{Name: "terse", Variant: "claude-prod-b.md", Percent: 100}
+
+	task := &Task{ID: "task-1"}
+	prompt, stamp := a.applyExperiment(task, exp, control, controlStamp)
+	require.Equal(t, "# Variant", prompt)
+	require.Equal(t, "claude-prod-b.md", stamp.File)
+	require.Equal(t, "terse", stamp.Experiment)
+	require.Equal(t, history.ArmVariant, stamp.Arm)
+
+	// A task keeps its arm across runs
+	task.agencyPrompt = &history.PromptStamp{File: "claude-prod.md", Experiment: "terse", Arm: history.ArmControl}
+	_, controlStamp, err = a.loadAgencyPrompt()
+	require.NoError(t, err)
+	prompt, stamp = a.applyExperiment(task, exp, control, controlStamp)
+	require.Equal(t, "# Control", prompt)
+	require.Equal(t, history.ArmControl, stamp.Arm)
+
+	// A missing variant leaves the task out of the experiment
+	exp.Variant = "claude-prod-missing.md"
+	_, controlStamp, err = a.loadAgencyPrompt()
+	require.NoError(t, err)
+	prompt, stamp = a.applyExperiment(&Task{ID: "task-2"}, exp, control, controlStamp)
+	require.Equal(t, "# Control", prompt)
+	require.Empty(t, stamp.Experiment)
+	require.Empty(t, stamp.Arm)
+}
@@ -0,0 +1,43 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+
+	"phobos.org.uk/agency/internal/api"
+)
+
+// readinessChecks are the conditions for /readyz: the agent can only run
+// tasks once its agency prompt and CLI binary (or container runtime) resolve,
+// and stops taking them while draining.
+func (a *Agent) readinessChecks() []api.ReadinessCheck {
+	return []api.ReadinessCheck{
+		{Name: "agency_prompt", Check: func() error {
+			_, err := a.findAgencyPrompt()
+			return err
+		}},
+		{Name: "runner", Check: func() error {
+			if cc := a.cfg().Container; cc.Enabled() {
+				// The CLI is in the image; only the runtime has to be here
+				if _, err := exec.LookPath(cc.RuntimeBin()); err != nil {
+					return fmt.Errorf("container runtime not found: %w", err)
+				}
+				return nil
+			}
+			bin := a.runner.ResolveBin()
+			if _, err := exec.LookPath(bin); err != nil {
+				return fmt.Errorf("%s CLI not found: %w", a.agentKind, err)
+			}
+			return nil
+		}},
+		{Name: "draining", Check: func() error {
+			a.mu.RLock()
+			defer a.mu.RUnlock()
+			if a.draining {
+				return errors.New("agent is draining")
+			}
+			return nil
+		}},
+	}
+}
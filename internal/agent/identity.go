@@ -0,0 +1,34 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// loadOrCreateAgentID returns the agent ID stored at path, generating and
+// persisting a new UUID on first start so the ID survives restarts and
+// port changes.
+func loadOrCreateAgentID(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		id := strings.TrimSpace(string(data))
+		if id != "" {
+			return id, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("reading agent ID: %w", err)
+	}
+
+	id := uuid.New().String()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("creating agent ID directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(id+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("writing agent ID: %w", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/config"
+)
+
+func TestLoadOrCreateAgentID(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "agents", "agent-claude.id")
+
+	id, err := loadOrCreateAgentID(path)
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
+
+	again, err := loadOrCreateAgentID(path)
+	require.NoError(t, err)
+	require.Equal(t, id, again)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestAgentIDStableAcrossRestarts(t *testing.T) {
+	// Cannot use t.Parallel() with t.Setenv()
+	t.Setenv("AGENCY_ROOT", t.TempDir())
+
+	statusID := func() string {
+		cfg := config.Default()
+		cfg.HistoryDir = ""
+		a := New(cfg, "test")
+
+		req := httptest.NewRequest("GET", "/status", nil)
+		w := httptest.NewRecorder()
+		a.Router().ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var status StatusResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+		return status.AgentID
+	}
+
+	first := statusID()
+	require.NotEmpty(t, first)
+	require.Equal(t, first, statusID())
+
+	// Different agent kinds on the same host get distinct IDs
+	cfg := config.Default()
+	cfg.HistoryDir = ""
+	codex := NewWithRunner(cfg, "test", NewCodexRunner())
+	require.NotEqual(t, first, codex.config.ID)
+}
+
+func TestAgentIDFromConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.HistoryDir = ""
+	cfg.ID = "agent-fixed"
+	a := New(cfg, "test")
+
+	require.Equal(t, "agent-fixed", a.config.ID)
+}
@@ -0,0 +1,233 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"phobos.org.uk/agency/internal/api"
+)
+
+// orphanStopGrace is how long an orphaned CLI gets to exit after SIGTERM
+// before it is killed.
+const orphanStopGrace = 5 * time.Second
+
+// codexRestartPrompt resumes a Codex session interrupted by an agent restart.
+const codexRestartPrompt = "The agent running this task restarted and interrupted your last turn. " +
+	"Check the state of the working directory, then carry on with the task where you left off."
+
+// inflightRecord is what an agent keeps on disk about its running task, so
+// that after a crash or kill it can stop the CLI it left behind and either
+// resume or fail the task. It is removed when the task finishes.
+type inflightRecord struct {
+	TaskID         string            `json:"task_id"`
+	SessionID      string            `json:"session_id"`
+	ResumeSession  bool              `json:"resume_session,omitempty"`
+	WorkDir        string            `json:"work_dir"` // Relative to the session dir
+	ParentTaskID   string            `json:"parent_task_id,omitempty"`
+	RequestID      string            `json:"request_id,omitempty"`
+	Prompt         string            `json:"prompt"`
+	Model          string            `json:"model,omitempty"`
+	TimeoutSeconds float64           `json:"timeout_seconds"`
+	StartedAt      time.Time         `json:"started_at"`
+	PID            int               `json:"pid,omitempty"`            // CLI process, which leads its own process group
+	CLISessionID   string            `json:"cli_session_id,omitempty"` // Session ID reported by the CLI so far
+	HasEnv         bool              `json:"has_env,omitempty"`        // Task env isn't persisted, so such tasks can't resume
+	RunnerOptions  api.RunnerOptions `json:"runner_options"`
+
+	// As requested, for the task's history
+	Tier             string `json:"tier,omitempty"`
+	RequestedTimeout int    `json:"requested_timeout,omitempty"` // Seconds (0 = the agent's default)
+	RerunOf          string `json:"rerun_of,omitempty"`
+}
+
+// inflightPath is the agent's in-flight record, named by agent ID as agents
+// can share a session dir.
+func (a *Agent) inflightPath() string {
+	return filepath.Join(a.cfg().SessionDir, ".inflight", a.cfg().ID+".json")
+}
+
+// saveInflight records the current state of a running task.
+func (a *Agent) saveInflight(task *Task) {
+	a.mu.RLock()
+	rec := inflightRecord{
+		TaskID:         task.ID,
+		SessionID:      task.SessionID,
+		ResumeSession:  task.ResumeSession,
+		WorkDir:        task.WorkDir,
+		ParentTaskID:   task.ParentTaskID,
+		RequestID:      task.RequestID,
+		Prompt:         task.Prompt,
+		Model:          task.Model,
+		TimeoutSeconds: task.Timeout.Seconds(),
+		CLISessionID:   task.cliSessionID,
+		HasEnv:         task.hasEnv,
+		RunnerOptions:  task.RunnerOptions,
+
+		Tier:             task.tier,
+		RequestedTimeout: task.timeoutSeconds,
+		RerunOf:          task.RerunOf,
+	}
+	if task.StartedAt != nil {
+		rec.StartedAt = *task.StartedAt
+	}
+	if task.cmd != nil && task.cmd.Process != nil {
+		rec.PID = task.cmd.Process.Pid
+	}
+	a.mu.RUnlock()
+
+	if err := writeInflight(a.inflightPath(), rec); err != nil {
+		a.taskLog(task).Warn("failed to record running task", map[string]any{"error": err.Error()})
+	}
+}
+
+func writeInflight(path string, rec inflightRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// clearInflight removes the record once a task has finished.
+func (a *Agent) clearInflight() {
+	if err := os.Remove(a.inflightPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		a.log.Warn("failed to remove running task record", map[string]any{"error": err.Error()})
+	}
+}
+
+// adoptInflightTask deals with a task left running by an earlier agent
+// process that exited mid-task. The CLI it left behind is stopped. A Codex
+// task then resumes its session under the same task ID; any other task is
+// recorded in history as failed with an agent_restarted error.
+func (a *Agent) adoptInflightTask() {
+	data, err := os.ReadFile(a.inflightPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	var rec inflightRecord
+	if err == nil {
+		err = json.Unmarshal(data, &rec)
+	}
+	if err != nil || rec.TaskID == "" {
+		a.log.Warn("ignoring unreadable running task record", map[string]any{"path": a.inflightPath()})
+		a.clearInflight()
+		return
+	}
+
+	taskLog := a.log.WithTask(rec.TaskID).WithRequestID(rec.RequestID)
+	stopped := rec.PID > 0 && stopOrphan(rec.PID, orphanStopGrace)
+	taskLog.Warn("task interrupted by agent restart", map[string]any{
+		"pid":         rec.PID,
+		"cli_stopped": stopped,
+	})
+
+	if task := a.resumableTask(rec); task != nil {
+		taskLog.Info("resuming interrupted session", map[string]any{"session_id": task.SessionID})
+		a.mu.Lock()
+		a.tasks[task.ID] = task
+		a.currentTask = task
+		a.state = StateWorking
+		a.mu.Unlock()
+		go a.executeTask(task, nil)
+		return
+	}
+
+	message := "Agent restarted while the task was running"
+	if stopped {
+		message += fmt.Sprintf("; its CLI process (pid %d) was stopped", rec.PID)
+	}
+	startedAt := rec.StartedAt
+	exitCode := 1
+	task := &Task{
+		ID:            rec.TaskID,
+		State:         TaskStateFailed,
+		Prompt:        rec.Prompt,
+		Model:         rec.Model,
+		StartedAt:     &startedAt,
+		ExitCode:      &exitCode,
+		Error:         &TaskError{Type: "agent_restarted", Message: message},
+		SessionID:     rec.SessionID,
+		ParentTaskID:  rec.ParentTaskID,
+		RequestID:     rec.RequestID,
+		WorkDir:       rec.WorkDir,
+		RunnerOptions: rec.RunnerOptions,
+		RerunOf:       rec.RerunOf,
+
+		tier:           rec.Tier,
+		timeoutSeconds: rec.RequestedTimeout,
+	}
+	setTaskCompletion(task, time.Now())
+	if a.history == nil {
+		// Kept in memory, as finished tasks are without history
+		a.mu.Lock()
+		a.tasks[task.ID] = task
+		a.mu.Unlock()
+	}
+	a.saveTaskHistory(task, nil)
+	a.clearInflight()
+}
+
+// resumableTask returns the task that continues rec's Codex session, or nil
+// if it can't be resumed: other runners, a session the CLI never reported,
+// per-task env that wasn't persisted, or no time left.
+func (a *Agent) resumableTask(rec inflightRecord) *Task {
+	sessionID := rec.CLISessionID
+	if sessionID == "" && rec.ResumeSession {
+		sessionID = rec.SessionID
+	}
+	remaining := time.Duration(rec.TimeoutSeconds*float64(time.Second)) - time.Since(rec.StartedAt)
+	if a.runner.Kind() != api.AgentKindCodex || !isSafeSessionID(sessionID) || rec.HasEnv || remaining <= 0 {
+		return nil
+	}
+
+	// A new Codex session's directory is renamed to the CLI's session ID
+	// when its first task finishes; do that now, as this one won't
+	if rec.WorkDir != sessionID {
+		oldPath := filepath.Join(a.cfg().SessionDir, rec.WorkDir)
+		newPath := filepath.Join(a.cfg().SessionDir, sessionID)
+		if err := os.Rename(oldPath, newPath); err != nil {
+			a.log.WithTask(rec.TaskID).WithRequestID(rec.RequestID).Warn("failed to rename session directory", map[string]any{"error": err.Error()})
+			return nil
+		}
+	}
+
+	return &Task{
+		ID:            rec.TaskID,
+		State:         TaskStateQueued,
+		Prompt:        codexRestartPrompt,
+		Model:         rec.Model,
+		Timeout:       remaining,
+		SessionID:     sessionID,
+		ParentTaskID:  rec.ParentTaskID,
+		RequestID:     rec.RequestID,
+		ResumeSession: true,
+		WorkDir:       sessionID,
+		RunnerOptions: rec.RunnerOptions,
+		RerunOf:       rec.RerunOf,
+
+		tier:           rec.Tier,
+		timeoutSeconds: rec.RequestedTimeout,
+	}
+}
+
+// streamSessionID returns the session ID in a line of CLI JSON output, if any.
+func streamSessionID(line []byte) string {
+	var event struct {
+		SessionID string `json:"session_id"`
+	}
+	if json.Unmarshal(line, &event) != nil {
+		return ""
+	}
+	return event.SessionID
+}
@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/config"
+)
+
+func TestStopOrphan(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("process groups are unix only")
+	}
+
+	cmd := exec.Command("sleep", "30")
+	setupProcessGroup(cmd)
+	require.NoError(t, cmd.Start())
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+
+	require.True(t, stopOrphan(cmd.Process.Pid, 5*time.Second))
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("orphan not stopped")
+	}
+
+	// Nothing leads a group at the PID any more
+	require.False(t, stopOrphan(cmd.Process.Pid, time.Second))
+}
+
+func TestInflightRecordLifecycle(t *testing.T) {
+	t.Setenv("CLAUDE_BIN", "echo")
+
+	cfg := config.Default()
+	cfg.SessionDir = filepath.Join(t.TempDir(), "sessions")
+	cfg.HistoryDir = ""
+	a := New(cfg, "test")
+
+	now := time.Now()
+	task := &Task{ID: "task-1", Prompt: "hello", SessionID: "sess-1", WorkDir: "sess-1", Timeout: time.Minute, StartedAt: &now}
+	a.saveInflight(task)
+	require.FileExists(t, a.inflightPath())
+
+	a.cleanupTask(task)
+	require.NoFileExists(t, a.inflightPath())
+}
+
+func TestAdoptInflightTaskFails(t *testing.T) {
+	t.Setenv("CLAUDE_BIN", "echo")
+
+	tmpDir := t.TempDir()
+	cfg := config.Default()
+	cfg.SessionDir = filepath.Join(tmpDir, "sessions")
+	cfg.HistoryDir = filepath.Join(tmpDir, "history")
+	a := New(cfg, "test")
+
+	require.NoError(t, writeInflight(a.inflightPath(), inflightRecord{
+		TaskID:         "task-orphan",
+		SessionID:      "sess-1",
+		WorkDir:        "sess-1",
+		Prompt:         "fix the bug",
+		TimeoutSeconds: 600,
+		StartedAt:      time.Now().Add(-time.Minute),
+	}))
+	a.adoptInflightTask()
+
+	entry, err := a.history.Get("task-orphan")
+	require.NoError(t, err)
+	require.Equal(t, string(TaskStateFailed), entry.State)
+	require.Equal(t, "fix the bug", entry.Prompt)
+	require.NotNil(t, entry.Error)
+	require.Equal(t, "agent_restarted", entry.Error.Type)
+	require.NoFileExists(t, a.inflightPath())
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	require.Equal(t, StateIdle, a.state)
+}
+
+func TestAdoptInflightTaskResumesCodex(t *testing.T) {
+	t.Setenv("CODEX_BIN", "echo")
+
+	cfg := config.Default()
+	cfg.SessionDir = filepath.Join(t.TempDir(), "sessions")
+	cfg.HistoryDir = "" // Keep tasks in memory for verification
+	a := New(cfg, "test")
+	a.runner = codexRunner{}
+
+	const cliSession = "0199a213-81c0-7800-8aa1-bbab2a035a53"
+	require.NoError(t, os.MkdirAll(filepath.Join(cfg.SessionDir, "agent-dir"), 0700))
+	require.NoError(t, writeInflight(a.inflightPath(), inflightRecord{
+		TaskID:         "task-codex",
+		SessionID:      "agent-dir",
+		WorkDir:        "agent-dir",
+		Prompt:         "fix the bug",
+		TimeoutSeconds: 600,
+		StartedAt:      time.Now().Add(-time.Minute),
+		CLISessionID:   cliSession,
+	}))
+	a.adoptInflightTask()
+
+	// The session directory takes the CLI's session ID, and the same task
+	// resumes it
+	require.DirExists(t, filepath.Join(cfg.SessionDir, cliSession))
+	a.mu.RLock()
+	task := a.tasks["task-codex"]
+	a.mu.RUnlock()
+	require.NotNil(t, task)
+	require.Equal(t, cliSession, task.SessionID)
+	require.True(t, task.ResumeSession)
+	require.Greater(t, task.Timeout, 8*time.Minute)
+
+	require.Eventually(t, func() bool {
+		a.mu.RLock()
+		defer a.mu.RUnlock()
+		return a.state == StateIdle
+	}, 5*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,43 @@
+package agent
+
+import (
+	"phobos.org.uk/agency/internal/config"
+	"phobos.org.uk/agency/internal/logging"
+)
+
+// addLogSinks attaches the sinks configured in cfg to log. A sink that can't
+// be opened is skipped with a warning rather than stopping the agent.
+func addLogSinks(log *logging.Logger, cfg config.LogConfig, component, agentID string) {
+	if cfg.File.Path != "" {
+		sink, err := logging.NewFileSink(cfg.File.Path, cfg.File.MaxBytes, cfg.File.MaxFiles)
+		if err != nil {
+			log.Warn("failed to open log file", map[string]any{"path": cfg.File.Path, "error": err.Error()})
+		} else {
+			log.AddSink(sink)
+		}
+	}
+
+	if cfg.Syslog.Enabled {
+		tag := cfg.Syslog.Tag
+		if tag == "" {
+			tag = "agency-" + component
+		}
+		sink, err := logging.NewSyslogSink(cfg.Syslog.Network, cfg.Syslog.Address, tag)
+		if err != nil {
+			log.Warn("failed to connect to syslog", map[string]any{"error": err.Error()})
+		} else {
+			log.AddSink(sink)
+		}
+	}
+
+	if cfg.OTLP.Endpoint != "" {
+		log.AddSink(logging.NewOTLPSink(logging.OTLPConfig{
+			Endpoint: cfg.OTLP.Endpoint,
+			Headers:  cfg.OTLP.Headers,
+			Resource: map[string]string{
+				"service.name":        "agency-" + component,
+				"service.instance.id": agentID,
+			},
+		}))
+	}
+}
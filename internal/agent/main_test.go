@@ -0,0 +1,21 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// TestMain points the agency root at a temporary directory, so agents
+// created without an ID keep their ID files out of the real ~/.agency.
+func TestMain(m *testing.M) {
+	root, err := os.MkdirTemp("", "agency-test-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("AGENCY_ROOT", root)
+	code := m.Run()
+	os.RemoveAll(root)
+	os.Exit(code)
+}
@@ -0,0 +1,187 @@
+package agent
+
+import (
+	"bytes"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	"phobos.org.uk/agency/internal/config"
+)
+
+// outputCapture keeps the first maxBytes of a task's CLI output in memory and
+// writes the rest to a spill file, opened on first overflow (the excess is
+// discarded when openSpill is nil). The last line is always kept so the final
+// result can be parsed from truncated output.
+type outputCapture struct {
+	maxBytes  int64
+	buf       bytes.Buffer
+	total     int64
+	openSpill func() (io.WriteCloser, error)
+	spill     io.WriteCloser
+	spillErr  error
+	lastLine  []byte
+}
+
+func newOutputCapture(maxBytes int64, openSpill func() (io.WriteCloser, error)) *outputCapture {
+	return &outputCapture{maxBytes: maxBytes, openSpill: openSpill}
+}
+
+// WriteLine records one line of output. Lines are never split: a line that
+// doesn't fit in the remaining capture budget goes to the spill file whole.
+func (c *outputCapture) WriteLine(line []byte) {
+	size := int64(len(line)) + 1
+	c.total += size
+	c.lastLine = append(c.lastLine[:0], line...)
+
+	if c.total == int64(c.buf.Len())+size && c.total <= c.maxBytes {
+		c.buf.Write(line)
+		c.buf.WriteByte('\n')
+		return
+	}
+	if c.openSpill == nil || c.spillErr != nil {
+		return
+	}
+	if c.spill == nil {
+		if c.spill, c.spillErr = c.openSpill(); c.spillErr != nil {
+			return
+		}
+	}
+	if _, err := c.spill.Write(line); err != nil {
+		c.spillErr = err
+		return
+	}
+	if _, err := c.spill.Write([]byte{'\n'}); err != nil {
+		c.spillErr = err
+	}
+}
+
+// Captured returns the output kept in memory.
+func (c *outputCapture) Captured() []byte {
+	return c.buf.Bytes()
+}
+
+// Truncated reports whether any output went past the capture limit.
+func (c *outputCapture) Truncated() bool {
+	return c.total > int64(c.buf.Len())
+}
+
+// TotalBytes returns the size of all output seen, including spilled lines.
+func (c *outputCapture) TotalBytes() int64 {
+	return c.total
+}
+
+// ParseInput returns the bytes to parse for the final result: the captured
+// output, or just the last line when the output was truncated.
+func (c *outputCapture) ParseInput() []byte {
+	if c.Truncated() {
+		return c.lastLine
+	}
+	return c.buf.Bytes()
+}
+
+// Spilled reports whether excess output was written to the spill file.
+func (c *outputCapture) Spilled() bool {
+	return c.spill != nil && c.spillErr == nil
+}
+
+// Close closes the spill file and returns the first spill error, if any.
+func (c *outputCapture) Close() error {
+	if c.spill != nil {
+		if err := c.spill.Close(); err != nil && c.spillErr == nil {
+			c.spillErr = err
+		}
+	}
+	return c.spillErr
+}
+
+// maxOutputBytes returns the configured capture limit for task output.
+func (a *Agent) maxOutputBytes() int64 {
+	if limit := a.cfg().Output.MaxBytes; limit > 0 {
+		return limit
+	}
+	return config.DefaultOutputMaxBytes
+}
+
+// spillOpener returns a function that creates the task's spill file in the
+// history store, or nil when history is disabled and excess output is dropped.
+func (a *Agent) spillOpener(taskID string) func() (io.WriteCloser, error) {
+	if a.history == nil {
+		return nil
+	}
+	return func() (io.WriteCloser, error) {
+		f, err := a.history.CreateSpill(taskID)
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+}
+
+// timeoutWarningAfter returns how long into a task its timeout warning is
+// due: output.timeout_warning before the timeout, or halfway through tasks
+// shorter than twice that.
+func (a *Agent) timeoutWarningAfter(timeout time.Duration) time.Duration {
+	lead := a.cfg().Output.TimeoutWarning
+	if lead <= 0 {
+		lead = config.DefaultOutputTimeoutWarning
+	}
+	return timeout - min(lead, timeout/2)
+}
+
+// maxLiveOutputBytes caps the output text a running task reports; the
+// latest text is kept.
+const maxLiveOutputBytes = 64 << 10
+
+// partialOutput extracts the output text so far from CLI output that may end
+// mid-task.
+func (a *Agent) partialOutput(raw []byte) string {
+	if parsed, ok := a.runner.ParseOutput(raw); ok && parsed.HasOutput && parsed.Output != "" {
+		return parsed.Output
+	}
+	return extractResultFromStream(raw)
+}
+
+// updateLiveOutput makes the latest output text in a line of CLI output the
+// running task's output, so it can be followed through GET /task/{id}.
+func (a *Agent) updateLiveOutput(task *Task, line []byte) {
+	text := a.partialOutput(line)
+	if text == "" {
+		return
+	}
+	text = tailUTF8(text, maxLiveOutputBytes)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if task.State == TaskStateWorking {
+		task.Output = text
+	}
+}
+
+// tailUTF8 returns the last maxBytes of s, starting on a rune boundary.
+func tailUTF8(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	s = s[len(s)-maxBytes:]
+	for len(s) > 0 && !utf8.RuneStart(s[0]) {
+		s = s[1:]
+	}
+	return s
+}
+
+// warnTimeout logs that a task is close to its timeout, with how much
+// output it has produced, which is kept if the timeout hits.
+func (a *Agent) warnTimeout(task *Task, remaining time.Duration) {
+	a.mu.RLock()
+	working := task.State == TaskStateWorking
+	outputBytes := len(task.Output)
+	a.mu.RUnlock()
+	if !working {
+		return
+	}
+	a.taskLog(task).Warn("task nearing timeout", map[string]any{
+		"remaining_seconds": remaining.Seconds(),
+		"timeout_seconds":   task.Timeout.Seconds(),
+		"output_bytes":      outputBytes,
+	})
+}
@@ -0,0 +1,185 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/config"
+)
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestOutputCapture(t *testing.T) {
+	t.Parallel()
+
+	var spill bytes.Buffer
+	opened := 0
+	c := newOutputCapture(10, func() (io.WriteCloser, error) {
+		opened++
+		return nopWriteCloser{&spill}, nil
+	})
+
+	c.WriteLine([]byte("abcd"))
+	c.WriteLine([]byte("efgh"))
+	require.False(t, c.Truncated())
+	require.Equal(t, "abcd\nefgh\n", string(c.ParseInput()))
+
+	// Once a line overflows, every later line spills so the capture has no gaps
+	c.WriteLine([]byte("ijkl"))
+	c.WriteLine([]byte("m"))
+	require.NoError(t, c.Close())
+
+	require.True(t, c.Truncated())
+	require.True(t, c.Spilled())
+	require.Equal(t, 1, opened)
+	require.Equal(t, "abcd\nefgh\n", string(c.Captured()))
+	require.Equal(t, "ijkl\nm\n", spill.String())
+	require.Equal(t, int64(17), c.TotalBytes())
+	require.Equal(t, "m", string(c.ParseInput()))
+}
+
+func TestOutputCaptureWithoutSpill(t *testing.T) {
+	t.Parallel()
+
+	c := newOutputCapture(4, nil)
+	c.WriteLine([]byte("too long"))
+	require.NoError(t, c.Close())
+
+	require.True(t, c.Truncated())
+	require.False(t, c.Spilled())
+	require.Empty(t, c.Captured())
+	require.Equal(t, "too long", string(c.ParseInput()))
+}
+
+func TestTaskOutputTruncated(t *testing.T) {
+	// Cannot use t.Parallel() with t.Setenv()
+	tmpDir := t.TempDir()
+	mockPath := filepath.Join(tmpDir, "mock-claude-noisy")
+	script := `#!/bin/bash
+for i in $(seq 1 50); do
+  echo '{"type":"assistant","message":{"content":[{"type":"text","text":"chatter line"}]}}'
+done
+echo '{"type":"result","subtype":"success","result":"finished"}'
+`
+	require.NoError(t, os.WriteFile(mockPath, []byte(script), 0755))
+	t.Setenv("CLAUDE_BIN", mockPath)
+
+	promptsDir := filepath.Join(tmpDir, "prompts")
+	require.NoError(t, os.MkdirAll(promptsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "claude-prod.md"), []byte("# Test Instructions"), 0644))
+
+	cfg := config.Default()
+	cfg.SessionDir = filepath.Join(tmpDir, "sessions")
+	cfg.HistoryDir = filepath.Join(tmpDir, "history")
+	cfg.AgencyPromptsDir = promptsDir
+	cfg.Output.MaxBytes = 1024
+	a := New(cfg, "test")
+
+	req := httptest.NewRequest("POST", "/task", strings.NewReader(`{"prompt": "noisy"}`))
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp struct {
+		TaskID string `json:"task_id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	require.Eventually(t, func() bool {
+		entry, err := a.history.Get(resp.TaskID)
+		return err == nil && entry.HasSpill && entry.HasDebugLog
+	}, 5*time.Second, 10*time.Millisecond)
+
+	entry, err := a.history.Get(resp.TaskID)
+	require.NoError(t, err)
+	require.Equal(t, "completed", entry.State)
+	require.Equal(t, "finished", entry.Output)
+	require.True(t, entry.OutputTruncated)
+	require.LessOrEqual(t, entry.CapturedBytes, int64(1024))
+
+	debugLog, err := a.history.GetDebugLog(resp.TaskID)
+	require.NoError(t, err)
+	spill, err := a.history.GetSpill(resp.TaskID)
+	require.NoError(t, err)
+	require.Equal(t, entry.OutputBytes, int64(len(debugLog)+len(spill)))
+	require.Equal(t, entry.CapturedBytes, int64(len(debugLog)))
+}
+
+func TestTimeoutWarningAfter(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	a := New(cfg, "test")
+	require.Equal(t, 25*time.Minute, a.timeoutWarningAfter(30*time.Minute))
+	require.Equal(t, 3*time.Minute, a.timeoutWarningAfter(6*time.Minute), "halfway through short tasks")
+
+	cfg.Output.TimeoutWarning = time.Minute
+	require.Equal(t, 29*time.Minute, a.timeoutWarningAfter(30*time.Minute))
+}
+
+func TestTailUTF8(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "short", tailUTF8("short", 10))
+	require.Equal(t, "world", tailUTF8("hello world", 5))
+	require.Equal(t, "b", tailUTF8("aéb", 2), "never starts mid-rune")
+}
+
+func TestTimeoutKeepsPartialOutput(t *testing.T) {
+	// Cannot use t.Parallel() with t.Setenv()
+	tmpDir := t.TempDir()
+	mockPath := filepath.Join(tmpDir, "mock-claude-stuck")
+	script := `#!/bin/bash
+echo '{"type":"assistant","message":{"content":[{"type":"text","text":"Found the bug in parser.go"}]}}'
+exec sleep 30
+`
+	require.NoError(t, os.WriteFile(mockPath, []byte(script), 0755))
+	t.Setenv("CLAUDE_BIN", mockPath)
+
+	promptsDir := filepath.Join(tmpDir, "prompts")
+	require.NoError(t, os.MkdirAll(promptsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "claude-prod.md"), []byte("# Test Instructions"), 0644))
+
+	cfg := config.Default()
+	cfg.SessionDir = filepath.Join(tmpDir, "sessions")
+	cfg.HistoryDir = filepath.Join(tmpDir, "history")
+	cfg.AgencyPromptsDir = promptsDir
+	a := New(cfg, "test")
+
+	req := httptest.NewRequest("POST", "/task", strings.NewReader(`{"prompt": "stuck", "timeout_seconds": 2}`))
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp struct {
+		TaskID string `json:"task_id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	// The output so far is visible while the task works
+	require.Eventually(t, func() bool {
+		a.mu.RLock()
+		defer a.mu.RUnlock()
+		task, ok := a.tasks[resp.TaskID]
+		return ok && task.State == TaskStateWorking && task.Output == "Found the bug in parser.go"
+	}, 2*time.Second, 20*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		_, err := a.history.Get(resp.TaskID)
+		return err == nil
+	}, 5*time.Second, 20*time.Millisecond)
+	entry, err := a.history.Get(resp.TaskID)
+	require.NoError(t, err)
+	require.Equal(t, "failed", entry.State)
+	require.Equal(t, "timeout", entry.Error.Type)
+	require.Equal(t, "Found the bug in parser.go", entry.Output)
+}
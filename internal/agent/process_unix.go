@@ -5,6 +5,7 @@ package agent
 import (
 	"os/exec"
 	"syscall"
+	"time"
 )
 
 // setupProcessGroup configures the command to run in its own process group.
@@ -25,3 +26,23 @@ func killProcessGroup(cmd *exec.Cmd) {
 		syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
 	}
 }
+
+// stopOrphan stops a CLI process group left behind by an earlier agent
+// process: SIGTERM, then SIGKILL if it hasn't exited after grace. It reports
+// whether there was a group led by pid to stop.
+func stopOrphan(pid int, grace time.Duration) bool {
+	// The CLI leads its own group, so anything else at pid is a reused PID
+	if pgid, err := syscall.Getpgid(pid); err != nil || pgid != pid {
+		return false
+	}
+	syscall.Kill(-pid, syscall.SIGTERM)
+	deadline := time.Now().Add(grace)
+	for time.Now().Before(deadline) {
+		if syscall.Kill(-pid, 0) != nil {
+			return true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	syscall.Kill(-pid, syscall.SIGKILL)
+	return true
+}
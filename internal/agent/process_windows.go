@@ -3,8 +3,10 @@
 package agent
 
 import (
+	"os"
 	"os/exec"
 	"syscall"
+	"time"
 )
 
 // setupProcessGroup configures the command to run in its own process group.
@@ -25,3 +27,13 @@ func killProcessGroup(cmd *exec.Cmd) {
 		cmd.Process.Kill()
 	}
 }
+
+// stopOrphan kills a CLI process left behind by an earlier agent process,
+// reporting whether there was one to kill.
+func stopOrphan(pid int, grace time.Duration) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return p.Kill() == nil
+}
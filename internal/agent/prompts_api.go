@@ -0,0 +1,239 @@
+package agent
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/config"
+)
+
+const (
+	maxPromptBytes   = 1 << 20    // Largest prompt PUT /prompts/{name} accepts
+	maxPromptBackups = 10         // Previous versions kept per prompt
+	promptBackupDir  = ".backups" // Within the prompts directory
+)
+
+// promptNamePattern matches the prompt files /prompts manages: markdown
+// files directly in the prompts directory.
+var promptNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*\.md$`)
+
+// PromptFile describes an agency prompt file in the prompts directory.
+type PromptFile struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+	Active     bool      `json:"active,omitempty"`  // The prompt this agent's tasks use
+	Content    string    `json:"content,omitempty"` // Only from GET and PUT /prompts/{name}
+	Backup     string    `json:"backup,omitempty"`  // Where PUT saved the previous version, relative to the prompts directory
+}
+
+// PromptList is the response of GET /prompts.
+type PromptList struct {
+	Dir     string       `json:"dir"`
+	Active  string       `json:"active,omitempty"` // Path of the prompt tasks use, which is outside dir when agency_prompt_file is set
+	Prompts []PromptFile `json:"prompts"`
+}
+
+// PromptUpdate is the body of PUT /prompts/{name}.
+type PromptUpdate struct {
+	Content string `json:"content"`
+}
+
+// promptsDir returns the directory agency prompts are loaded from.
+func (a *Agent) promptsDir() string {
+	if dir := a.cfg().AgencyPromptsDir; dir != "" {
+		return dir
+	}
+	return config.DefaultPromptsPath()
+}
+
+func (a *Agent) handleListPrompts(w http.ResponseWriter, r *http.Request) {
+	dir := a.promptsDir()
+	list := PromptList{Dir: dir, Prompts: []PromptFile{}}
+	if active, err := a.findAgencyPrompt(); err == nil {
+		list.Active = active
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		api.WriteError(w, http.StatusInternalServerError, api.ErrorReadError, err.Error())
+		return
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !promptNamePattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		list.Prompts = append(list.Prompts, PromptFile{
+			Name:       entry.Name(),
+			Size:       info.Size(),
+			ModifiedAt: info.ModTime().UTC(),
+			Active:     filepath.Join(dir, entry.Name()) == list.Active,
+		})
+	}
+	api.WriteJSON(w, http.StatusOK, list)
+}
+
+// promptPath returns the path of the prompt named in the request, writing a
+// 400 if the name isn't one /prompts manages.
+func (a *Agent) promptPath(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name := chi.URLParam(r, "name")
+	if !promptNamePattern.MatchString(name) {
+		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, "prompt name must be a .md file name")
+		return "", false
+	}
+	return filepath.Join(a.promptsDir(), name), true
+}
+
+func (a *Agent) handleGetPrompt(w http.ResponseWriter, r *http.Request) {
+	path, ok := a.promptPath(w, r)
+	if !ok {
+		return
+	}
+	prompt, err := a.readPrompt(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		api.WriteError(w, http.StatusNotFound, api.ErrorNotFound, "prompt not found")
+		return
+	}
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, api.ErrorReadError, err.Error())
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, prompt)
+}
+
+// handlePutPrompt creates or replaces a prompt. The previous version is kept
+// in the backup directory; tasks pick the change up when they next start.
+func (a *Agent) handlePutPrompt(w http.ResponseWriter, r *http.Request) {
+	path, ok := a.promptPath(w, r)
+	if !ok {
+		return
+	}
+	var update PromptUpdate
+	r.Body = http.MaxBytesReader(w, r.Body, 2*maxPromptBytes) // Room for JSON escaping
+	if !api.DecodeJSON(w, r, &update) {
+		return
+	}
+	if strings.TrimSpace(update.Content) == "" {
+		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, "content must not be empty")
+		return
+	}
+	if len(update.Content) > maxPromptBytes {
+		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, "content must be at most 1 MiB")
+		return
+	}
+
+	a.promptUpdate.Lock()
+	defer a.promptUpdate.Unlock()
+
+	backup, err := a.backupPrompt(path, update.Content)
+	if err == nil {
+		err = writePromptFile(path, update.Content)
+	}
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, api.ErrorConfigError, err.Error())
+		return
+	}
+	a.log.Info("agency prompt updated", map[string]any{
+		"name":   filepath.Base(path),
+		"backup": backup,
+	})
+
+	prompt, err := a.readPrompt(path)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, api.ErrorReadError, err.Error())
+		return
+	}
+	prompt.Backup = backup
+	api.WriteJSON(w, http.StatusOK, prompt)
+}
+
+func (a *Agent) readPrompt(path string) (PromptFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PromptFile{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return PromptFile{}, err
+	}
+	active, _ := a.findAgencyPrompt()
+	return PromptFile{
+		Name:       filepath.Base(path),
+		Size:       info.Size(),
+		ModifiedAt: info.ModTime().UTC(),
+		Active:     path == active,
+		Content:    string(data),
+	}, nil
+}
+
+// backupPrompt copies the prompt at path into the backup directory, unless
+// it doesn't exist yet or already holds content, and prunes the prompt's
+// oldest backups. It returns the backup's path relative to the prompts
+// directory, or "" if none was made.
+func (a *Agent) backupPrompt(path, content string) (string, error) {
+	old, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && string(old) == content) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(filepath.Dir(path), promptBackupDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name := filepath.Base(path)
+	// The fixed-width timestamp sorts backups oldest first
+	backup := name + "." + time.Now().UTC().Format("20060102T150405.000000000Z")
+	if err := os.WriteFile(filepath.Join(dir, backup), old, 0644); err != nil {
+		return "", err
+	}
+
+	backups, err := filepath.Glob(filepath.Join(dir, name+".*"))
+	if err == nil && len(backups) > maxPromptBackups {
+		slices.Sort(backups)
+		for _, stale := range backups[:len(backups)-maxPromptBackups] {
+			os.Remove(stale)
+		}
+	}
+	return filepath.Join(promptBackupDir, backup), nil
+}
+
+// writePromptFile replaces the file at path atomically, so a task starting
+// meanwhile reads either the old prompt or the new one.
+func writePromptFile(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".prompt-*.md")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/config"
+)
+
+func TestPromptsEndpoints(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	promptsDir := filepath.Join(dir, "prompts")
+	require.NoError(t, os.MkdirAll(promptsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "claude-prod.md"), []byte("# Prod v1"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "notes.txt"), []byte("not a prompt"), 0644))
+
+	cfg := config.Default()
+	cfg.SessionDir = filepath.Join(dir, "sessions")
+	cfg.HistoryDir = filepath.Join(dir, "history")
+	cfg.AgencyPromptsDir = promptsDir
+	cfg.Profile = config.DefaultProfile
+	a := New(cfg, "test")
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		a.Router().ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	w := serve(http.MethodGet, "/prompts", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var list PromptList
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Equal(t, promptsDir, list.Dir)
+	require.Equal(t, filepath.Join(promptsDir, "claude-prod.md"), list.Active)
+	require.Len(t, list.Prompts, 1)
+	require.Equal(t, "claude-prod.md", list.Prompts[0].Name)
+	require.True(t, list.Prompts[0].Active)
+	require.Empty(t, list.Prompts[0].Content)
+
+	w = serve(http.MethodGet, "/prompts/claude-prod.md", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var prompt PromptFile
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &prompt))
+	require.Equal(t, "# Prod v1", prompt.Content)
+
+	// Updates back up the previous version and apply to the next task
+	w = serve(http.MethodPut, "/prompts/claude-prod.md", `{"content":"# Prod v2"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &prompt))
+	require.Equal(t, "# Prod v2", prompt.Content)
+	require.True(t, strings.HasPrefix(prompt.Backup, filepath.Join(promptBackupDir, "claude-prod.md.")))
+	backup, err := os.ReadFile(filepath.Join(promptsDir, prompt.Backup))
+	require.NoError(t, err)
+	require.Equal(t, "# Prod v1", string(backup))
+	loaded, _, err := a.loadAgencyPrompt()
+	require.NoError(t, err)
+	require.Equal(t, "# Prod v2", loaded)
+
+	// Saving the same content again makes no backup; new prompts have none
+	w = serve(http.MethodPut, "/prompts/claude-prod.md", `{"content":"# Prod v2"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var unchanged PromptFile
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &unchanged))
+	require.Empty(t, unchanged.Backup)
+	w = serve(http.MethodPut, "/prompts/claude-dev.md", `{"content":"# Dev"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var created PromptFile
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.Empty(t, created.Backup)
+	require.False(t, created.Active)
+
+	require.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/prompts/codex-prod.md", "").Code)
+	require.Equal(t, http.StatusBadRequest, serve(http.MethodGet, "/prompts/notes.txt", "").Code)
+	require.Equal(t, http.StatusBadRequest, serve(http.MethodPut, "/prompts/..%2Fescape.md", `{"content":"x"}`).Code)
+	require.Equal(t, http.StatusBadRequest, serve(http.MethodPut, "/prompts/claude-prod.md", `{"content":"  "}`).Code)
+}
+
+func TestPromptBackupsArePruned(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cfg := config.Default()
+	cfg.SessionDir = filepath.Join(dir, "sessions")
+	cfg.HistoryDir = filepath.Join(dir, "history")
+	cfg.AgencyPromptsDir = dir
+	a := New(cfg, "test")
+
+	for i := range maxPromptBackups + 3 {
+		w := httptest.NewRecorder()
+		body := fmt.Sprintf(`{"content":"version %d"}`, i)
+		a.Router().ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/prompts/claude-prod.md", strings.NewReader(body)))
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	backups, err := filepath.Glob(filepath.Join(dir, promptBackupDir, "claude-prod.md.*"))
+	require.NoError(t, err)
+	require.Len(t, backups, maxPromptBackups)
+	oldest, err := os.ReadFile(backups[0])
+	require.NoError(t, err)
+	require.Equal(t, "version 2", string(oldest)) // Versions 0 and 1 were pruned
+}
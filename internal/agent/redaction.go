@@ -0,0 +1,22 @@
+package agent
+
+import (
+	"maps"
+	"slices"
+
+	"phobos.org.uk/agency/internal/config"
+	"phobos.org.uk/agency/internal/redact"
+)
+
+// loadRedactor builds a redactor for the values in the agent's secrets file
+// and installs it on the logger. If the secrets file can't be read, only
+// well-known token formats are redacted.
+func (a *Agent) loadRedactor() *redact.Redactor {
+	secrets, err := config.LoadSecrets(a.cfg().Env.SecretsPath())
+	if err != nil {
+		a.log.Warn("failed to load secrets for redaction", map[string]any{"error": err.Error()})
+	}
+	r := redact.New(slices.Collect(maps.Values(secrets)))
+	a.log.SetRedactor(r)
+	return r
+}
@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/tlsutil"
+)
+
+// DefaultRegisterInterval is the heartbeat interval when neither the config
+// nor the web view sets one.
+const DefaultRegisterInterval = 30 * time.Second
+
+// registerResponse is the subset of the web view's /api/register reply used here.
+type registerResponse struct {
+	HeartbeatSeconds int `json:"heartbeat_seconds"`
+}
+
+// RunRegistration registers the agent with the web view at register.url and
+// repeats the registration as a heartbeat until ctx is cancelled. The web
+// view drops the agent if the heartbeats stop.
+func (a *Agent) RunRegistration(ctx context.Context) {
+	cfg := a.cfg()
+	if cfg.Register.URL == "" {
+		return
+	}
+	if cfg.AuthToken == "" {
+		a.log.Warn("register.url is set but no auth_token; the web view requires one to register", nil)
+		return
+	}
+	switch cfg.Bind {
+	case "127.0.0.1", "localhost", "::1":
+		a.log.Warn("agent binds to loopback, so a web view on another machine can't reach it", map[string]any{"bind": cfg.Bind})
+	}
+	advertise := cfg.Register.AdvertiseURL
+	if advertise == "" {
+		advertise = defaultAdvertiseURL(cfg.Port)
+	}
+	endpoint := strings.TrimRight(cfg.Register.URL, "/") + "/api/register"
+	client := api.WithAuthToken(tlsutil.NewHTTPClient(10*time.Second), cfg.AuthToken)
+
+	registered, first := false, true
+	for {
+		interval, err := a.register(ctx, client, endpoint, advertise)
+		if err != nil {
+			// Report the first failure and a lost registration, not every retry
+			if (registered || first) && ctx.Err() == nil {
+				a.log.Warn("registration with web view failed", map[string]any{
+					"web_view": cfg.Register.URL,
+					"error":    err.Error(),
+				})
+			}
+			registered = false
+		} else if !registered {
+			a.log.Info("registered with web view", map[string]any{
+				"web_view":  cfg.Register.URL,
+				"advertise": advertise,
+			})
+			registered = true
+		}
+		first = false
+
+		if cfg.Register.Interval > 0 {
+			interval = cfg.Register.Interval
+		} else if interval <= 0 {
+			interval = DefaultRegisterInterval
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// register sends one registration and returns the heartbeat interval the web
+// view asked for.
+func (a *Agent) register(ctx context.Context, client *http.Client, endpoint, advertise string) (time.Duration, error) {
+	body, err := json.Marshal(map[string]string{"url": advertise, "type": api.TypeAgent})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("web view returned status %d", resp.StatusCode)
+	}
+	var reply registerResponse
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return 0, fmt.Errorf("parsing response: %w", err)
+	}
+	return time.Duration(reply.HeartbeatSeconds) * time.Second, nil
+}
+
+// defaultAdvertiseURL is the URL other machines reach this agent at by
+// default: its hostname and port.
+func defaultAdvertiseURL(port int) string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+	return "https://" + net.JoinHostPort(host, strconv.Itoa(port))
+}
@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/config"
+)
+
+func TestRunRegistration(t *testing.T) {
+	t.Parallel()
+
+	registrations := make(chan map[string]string, 10)
+	webView := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/register", r.URL.Path)
+		require.Equal(t, "Bearer fleet-token", r.Header.Get("Authorization"))
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		registrations <- body
+		w.Write([]byte(`{"status":"registered","heartbeat_seconds":30}`))
+	}))
+	defer webView.Close()
+
+	cfg := config.Default()
+	cfg.ID = "agent-register"
+	cfg.AuthToken = "fleet-token"
+	cfg.Register = config.RegisterConfig{
+		URL:          webView.URL + "/",
+		AdvertiseURL: "https://build-01:9000",
+		Interval:     10 * time.Millisecond, // Overrides the web view's 30s
+	}
+	a := New(cfg, "test")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.RunRegistration(ctx)
+		close(done)
+	}()
+
+	// Registers, then heartbeats
+	for range 2 {
+		select {
+		case body := <-registrations:
+			require.Equal(t, map[string]string{"url": "https://build-01:9000", "type": "agent"}, body)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no registration received")
+		}
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunRegistration did not stop")
+	}
+}
+
+func TestRunRegistrationNeedsToken(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.ID = "agent-register-no-token"
+	cfg.Register.URL = "https://dash:8443"
+	a := New(cfg, "test")
+
+	// Returns immediately rather than heartbeating without credentials
+	a.RunRegistration(context.Background())
+}
+
+func TestDefaultAdvertiseURL(t *testing.T) {
+	t.Parallel()
+
+	url := defaultAdvertiseURL(9100)
+	require.Regexp(t, `^https://.+:9100$`, url)
+}
@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"phobos.org.uk/agency/internal/config"
+)
+
+// DefaultConfigReloadInterval is how often WatchConfig checks the config file.
+const DefaultConfigReloadInterval = 60 * time.Second
+
+// ReloadConfig re-reads the config file at path and applies the settings that
+// can change without a restart: tier mappings, CLI models, timeouts and max
+// turns, task option bounds, tool policy, output limit, task environment,
+// session disk limits, attachment limits, experiments, profiles and the agency
+// prompt location. Running tasks keep the model and timeout they started
+// with; the new values apply to the next task. Listener, auth token,
+// identity, directory, backup, artifact, worktree and container settings are
+// kept, and a warning is logged if they differ.
+func (a *Agent) ReloadConfig(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	loaded, err := config.LoadProfile(path, a.cfg().Profile)
+	if err != nil {
+		return err
+	}
+
+	a.cfgMu.Lock()
+	old := a.config
+	next := *old
+	next.Tiers = loaded.Tiers
+	next.Claude = loaded.Claude
+	next.Codex = loaded.Codex
+	next.AgencyPromptsDir = loaded.AgencyPromptsDir
+	next.AgencyPromptFile = loaded.AgencyPromptFile
+	next.TaskOptions = loaded.TaskOptions
+	next.Policy = loaded.Policy
+	next.Output = loaded.Output
+	next.Env = loaded.Env
+	next.Sessions = loaded.Sessions
+	next.Attachments = loaded.Attachments
+	next.Experiment = loaded.Experiment
+	next.Profiles = loaded.Profiles
+	a.config = &next
+	a.configModTime = info.ModTime()
+	a.cfgMu.Unlock()
+
+	if loaded.SessionDir != old.SessionDir || loaded.HistoryDir != old.HistoryDir || loaded.Backup != old.Backup ||
+		loaded.Worktree != old.Worktree || !reflect.DeepEqual(loaded.Artifacts, old.Artifacts) ||
+		!reflect.DeepEqual(loaded.Container, old.Container) ||
+		(loaded.ID != "" && loaded.ID != old.ID) ||
+		(loaded.AuthToken != "" && loaded.AuthToken != old.AuthToken) {
+		a.log.Warn("config reload ignored settings that require a restart", map[string]any{
+			"path": path,
+		})
+	}
+	a.log.Info("config reloaded", map[string]any{
+		"path":    path,
+		"model":   a.defaultModel(),
+		"timeout": a.defaultTimeout().String(),
+	})
+	return nil
+}
+
+// WatchConfig reloads the config file at path whenever its modification time
+// changes, checking every interval until ctx is cancelled.
+func (a *Agent) WatchConfig(ctx context.Context, path string, interval time.Duration) {
+	if info, err := os.Stat(path); err == nil {
+		a.cfgMu.Lock()
+		if a.configModTime.IsZero() {
+			a.configModTime = info.ModTime()
+		}
+		a.cfgMu.Unlock()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil {
+				a.log.Warn("config reload check failed", map[string]any{"error": err.Error()})
+				continue
+			}
+			a.cfgMu.RLock()
+			changed := info.ModTime().After(a.configModTime)
+			a.cfgMu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := a.ReloadConfig(path); err != nil {
+				a.log.Warn("config reload failed, keeping current config", map[string]any{"error": err.Error()})
+				// Don't retry the same broken file every tick
+				a.cfgMu.Lock()
+				a.configModTime = info.ModTime()
+				a.cfgMu.Unlock()
+			}
+		}
+	}
+}
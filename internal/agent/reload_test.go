@@ -0,0 +1,225 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/config"
+)
+
+func writeReloadConfig(t *testing.T, path string, port int, standard string, timeout time.Duration) {
+	t.Helper()
+	dir := filepath.Dir(path)
+	data := fmt.Sprintf(`port: %d
+id: agent-reload
+session_dir: %s
+history_dir: %s
+tiers:
+  standard: %s
+claude:
+  timeout: %s
+`, port, filepath.Join(dir, "sessions"), filepath.Join(dir, "history"), standard, timeout)
+	require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+}
+
+func newReloadAgent(t *testing.T) (*Agent, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	writeReloadConfig(t, path, 9000, "sonnet", 30*time.Minute)
+	cfg, err := config.Load(path)
+	require.NoError(t, err)
+	return New(cfg, "test"), path
+}
+
+func TestReloadConfig(t *testing.T) {
+	t.Parallel()
+
+	a, path := newReloadAgent(t)
+	model, err := a.resolveModel(api.TierStandard)
+	require.NoError(t, err)
+	require.Equal(t, "sonnet", model)
+
+	writeReloadConfig(t, path, 9005, "opus", 5*time.Minute)
+	require.NoError(t, a.ReloadConfig(path))
+
+	model, err = a.resolveModel(api.TierStandard)
+	require.NoError(t, err)
+	require.Equal(t, "opus", model)
+	require.Equal(t, 5*time.Minute, a.defaultTimeout())
+
+	// Listener and identity settings need a restart
+	require.Equal(t, 9000, a.cfg().Port)
+	require.Equal(t, "agent-reload", a.cfg().ID)
+}
+
+func TestReloadConfigInvalidKeepsCurrent(t *testing.T) {
+	t.Parallel()
+
+	a, path := newReloadAgent(t)
+	require.NoError(t, os.WriteFile(path, []byte("claude:\n  model: gpt\n"), 0644))
+
+	require.Error(t, a.ReloadConfig(path))
+	require.Equal(t, "sonnet", a.defaultModel())
+}
+
+func TestWatchConfigReloadsOnChange(t *testing.T) {
+	t.Parallel()
+
+	a, path := newReloadAgent(t)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	a.configModTime = info.ModTime() // Baseline before the watcher starts
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.WatchConfig(ctx, path, 10*time.Millisecond)
+
+	writeReloadConfig(t, path, 9000, "haiku", 30*time.Minute)
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+
+	require.Eventually(t, func() bool {
+		return a.defaultModel() == "haiku"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestConfigEndpoint(t *testing.T) {
+	t.Parallel()
+
+	a, path := newReloadAgent(t)
+	a.SetConfigPath(path)
+	serve := func(method, body string) (*httptest.ResponseRecorder, ConfigSettings) {
+		w := httptest.NewRecorder()
+		a.Router().ServeHTTP(w, httptest.NewRequest(method, "/config", strings.NewReader(body)))
+		var settings ConfigSettings
+		json.Unmarshal(w.Body.Bytes(), &settings)
+		return w, settings
+	}
+
+	w, settings := serve(http.MethodGet, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, map[string]string{"standard": "sonnet"}, settings.Tiers)
+	require.Equal(t, 1800, settings.TimeoutSeconds)
+	require.Equal(t, path, settings.ConfigFile)
+
+	w, settings = serve(http.MethodPut, `{"tiers":{"fast":"sonnet"},"timeout_seconds":600,"max_turns":80}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Equal(t, map[string]string{"fast": "sonnet", "standard": "sonnet"}, settings.Tiers)
+	require.Equal(t, 600, settings.TimeoutSeconds)
+	require.Equal(t, 80, settings.MaxTurns)
+	require.Equal(t, 10*time.Minute, a.defaultTimeout())
+
+	// Saved to the file, so the change survives a restart
+	saved, err := config.Load(path)
+	require.NoError(t, err)
+	require.Equal(t, "sonnet", saved.Tiers.Fast)
+	require.Equal(t, 10*time.Minute, saved.Claude.Timeout)
+	require.Equal(t, 80, saved.Claude.MaxTurns)
+
+	// Invalid settings are rejected and nothing changes
+	w, _ = serve(http.MethodPut, `{"timeout_seconds":0}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	w, _ = serve(http.MethodPut, `{"tiers":{"huge":"opus"}}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, 10*time.Minute, a.defaultTimeout())
+
+	// Codex agents have no max_turns; without a config file changes stay in memory
+	codex := NewWithRunner(config.Default(), "test", NewCodexRunner())
+	w = httptest.NewRecorder()
+	codex.Router().ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/config", strings.NewReader(`{"max_turns":5}`)))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	w = httptest.NewRecorder()
+	codex.Router().ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/config", strings.NewReader(`{"model":"gpt-5.2-codex"}`)))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Equal(t, "gpt-5.2-codex", codex.cfg().Codex.Model)
+}
+
+func TestConfigEndpointRejectsOverriddenKeys(t *testing.T) {
+	// Cannot use t.Parallel() with t.Setenv()
+	t.Setenv("AGENCY_CLAUDE_TIMEOUT", "45m")
+
+	a, path := newReloadAgent(t)
+	a.SetConfigPath(path)
+	require.Equal(t, 45*time.Minute, a.defaultTimeout())
+	before, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/config", strings.NewReader(`{"timeout_seconds":600}`)))
+	require.Equal(t, http.StatusConflict, w.Code)
+	require.Contains(t, w.Body.String(), "claude.timeout")
+	after, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, string(before), string(after))
+	require.Equal(t, 45*time.Minute, a.defaultTimeout())
+
+	// Keys without an override can still be changed
+	w = httptest.NewRecorder()
+	a.Router().ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/config", strings.NewReader(`{"tiers":{"fast":"sonnet"}}`)))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestConfigProfile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	promptsDir := filepath.Join(dir, "prompts")
+	require.NoError(t, os.MkdirAll(promptsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "claude-prod.md"), []byte("prod"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "claude-dev.md"), []byte("dev"), 0644))
+	path := filepath.Join(dir, "agent.yaml")
+	data := fmt.Sprintf(`session_dir: %s
+history_dir: %s
+agency_prompts_dir: %s
+tiers:
+  standard: sonnet
+profiles:
+  dev:
+    tiers:
+      standard: haiku
+  staging: {}
+`, filepath.Join(dir, "sessions"), filepath.Join(dir, "history"), promptsDir)
+	require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+
+	cfg, err := config.LoadProfile(path, "dev")
+	require.NoError(t, err)
+	a := New(cfg, "test")
+	a.SetConfigPath(path)
+
+	// The profile picks the agency prompt variant
+	prompt, _, err := a.loadAgencyPrompt()
+	require.NoError(t, err)
+	require.Equal(t, "dev", prompt)
+
+	// Updates are saved to the profile in effect, and survive a reload
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/config", strings.NewReader(`{"tiers":{"standard":"opus"}}`)))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var settings ConfigSettings
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &settings))
+	require.Equal(t, "dev", settings.Profile)
+	require.Equal(t, "opus", settings.Tiers["standard"])
+
+	saved, err := config.LoadProfile(path, "dev")
+	require.NoError(t, err)
+	require.Equal(t, "opus", saved.Tiers.Standard)
+	base, err := config.LoadProfile(path, "staging")
+	require.NoError(t, err)
+	require.Equal(t, "sonnet", base.Tiers.Standard)
+
+	// The staging profile has no prompt variant, so the prod one is used
+	a.config.Profile = "staging"
+	prompt, _, err = a.loadAgencyPrompt()
+	require.NoError(t, err)
+	require.Equal(t, "prod", prompt)
+}
@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"phobos.org.uk/agency/internal/api"
+)
+
+// RerunRequest is the optional body of POST /history/{id}/rerun.
+type RerunRequest struct {
+	SameSession bool              `json:"same_session,omitempty"` // Continue the original task's session instead of starting a new one
+	Env         map[string]string `json:"env,omitempty"`          // Per-task env, which history doesn't keep
+}
+
+// handleRerunTask starts a new task with the prompt and settings of a task in
+// history, recording the original as its rerun_of. Attachments aren't kept in
+// history, so they aren't sent again; a re-run in the same session still
+// finds them in its workdir.
+func (a *Agent) handleRerunTask(w http.ResponseWriter, r *http.Request) {
+	if a.history == nil {
+		api.WriteError(w, http.StatusServiceUnavailable, "history_unavailable", "History storage not configured")
+		return
+	}
+	entry, err := a.history.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		api.WriteError(w, http.StatusNotFound, api.ErrorNotFound, err.Error())
+		return
+	}
+
+	var rerun RerunRequest
+	if r.ContentLength != 0 && !api.DecodeJSON(w, r, &rerun) {
+		return
+	}
+
+	req := TaskRequest{
+		Prompt:         entry.Prompt,
+		Tier:           entry.Tier,
+		TimeoutSeconds: entry.TimeoutSeconds,
+		Env:            rerun.Env,
+		RequestID:      api.RequestIDFromContext(r.Context()),
+		RerunOf:        entry.TaskID,
+	}
+	if entry.RunnerOptions != nil {
+		req.RunnerOptions = *entry.RunnerOptions
+	}
+	if rerun.SameSession {
+		req.SessionID = entry.SessionID
+	}
+
+	task, startErr := a.startTask(req, "")
+	if startErr != nil {
+		writeStartError(w, startErr)
+		return
+	}
+	a.log.Info("task re-run", map[string]any{
+		"task_id":  task.ID,
+		"rerun_of": entry.TaskID,
+	})
+
+	api.WriteJSON(w, http.StatusCreated, map[string]any{
+		"task_id":    task.ID,
+		"session_id": task.SessionID,
+		"rerun_of":   entry.TaskID,
+		"prompt":     entry.Prompt,
+	})
+}
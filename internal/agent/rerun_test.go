@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/config"
+	"phobos.org.uk/agency/internal/history"
+)
+
+func TestRerunTask(t *testing.T) {
+	// Cannot use t.Parallel() with t.Setenv()
+	t.Setenv("CLAUDE_BIN", "echo")
+
+	tmpDir := t.TempDir()
+	promptsDir := filepath.Join(tmpDir, "prompts")
+	require.NoError(t, os.MkdirAll(promptsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "claude-prod.md"), []byte("# Test Instructions"), 0644))
+
+	cfg := config.Default()
+	cfg.SessionDir = filepath.Join(tmpDir, "sessions")
+	cfg.HistoryDir = filepath.Join(tmpDir, "history")
+	cfg.AgencyPromptsDir = promptsDir
+	a := New(cfg, "test")
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		a.Router().ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	type created struct {
+		TaskID    string `json:"task_id"`
+		SessionID string `json:"session_id"`
+		RerunOf   string `json:"rerun_of"`
+	}
+	waitForHistory := func(taskID string) *history.Entry {
+		var entry *history.Entry
+		require.Eventually(t, func() bool {
+			var err error
+			entry, err = a.history.Get(taskID)
+			return err == nil
+		}, 2*time.Second, 20*time.Millisecond)
+		return entry
+	}
+	// The agent is busy until the task that saved history has finished
+	rerun := func(taskID, body string) *httptest.ResponseRecorder {
+		var w *httptest.ResponseRecorder
+		require.Eventually(t, func() bool {
+			w = serve(http.MethodPost, "/history/"+taskID+"/rerun", body)
+			return w.Code != http.StatusConflict
+		}, 2*time.Second, 20*time.Millisecond)
+		return w
+	}
+
+	w := serve(http.MethodPost, "/task", `{"prompt": "hello", "tier": "fast", "timeout_seconds": 600, "max_turns": 5}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var original created
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &original))
+	entry := waitForHistory(original.TaskID)
+	require.Equal(t, "fast", entry.Tier)
+	require.Equal(t, 600, entry.TimeoutSeconds)
+	require.Equal(t, &api.RunnerOptions{MaxTurns: 5}, entry.RunnerOptions)
+	require.Empty(t, entry.RerunOf)
+
+	// A re-run starts a new session by default, with the original's settings
+	w = rerun(original.TaskID, "")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var first created
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &first))
+	require.Equal(t, original.TaskID, first.RerunOf)
+	require.NotEqual(t, original.SessionID, first.SessionID)
+	entry = waitForHistory(first.TaskID)
+	require.Equal(t, "hello", entry.Prompt)
+	require.Equal(t, "fast", entry.Tier)
+	require.Equal(t, 600, entry.TimeoutSeconds)
+	require.Equal(t, &api.RunnerOptions{MaxTurns: 5}, entry.RunnerOptions)
+	require.Equal(t, original.TaskID, entry.RerunOf)
+
+	list := a.history.List(history.ListOptions{Page: 1, Limit: 10})
+	require.Equal(t, original.TaskID, list.Entries[0].RerunOf)
+
+	// ...or continues the original's session
+	w = rerun(original.TaskID, `{"same_session": true}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var second created
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &second))
+	require.Equal(t, original.SessionID, second.SessionID)
+	waitForHistory(second.TaskID)
+
+	require.Equal(t, http.StatusNotFound, rerun("task-missing", "").Code)
+	require.Equal(t, http.StatusBadRequest, rerun(original.TaskID, `{"same_session": `).Code)
+}
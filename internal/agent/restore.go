@@ -0,0 +1,215 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/backup"
+	"phobos.org.uk/agency/internal/history"
+)
+
+// MaxRestoreBytes limits the total size of the files unpacked from a backup.
+const MaxRestoreBytes int64 = 16 << 30
+
+// restoreTimeout bounds a restore's upload and extraction, in place of the
+// server's read and write timeouts (ag-cli restore waits as long).
+const restoreTimeout = 30 * time.Minute
+
+// RestoreResult reports what POST /admin/restore brought back.
+type RestoreResult struct {
+	Prefix          string    `json:"prefix"`           // Component the backup was made by
+	CreatedAt       time.Time `json:"created_at"`       // When the backup was made
+	HistoryFiles    int       `json:"history_files"`    // Files added to the history directory
+	HistoryEntries  int       `json:"history_entries"`  // Entries in the history after the restore
+	Sessions        []string  `json:"sessions"`         // Session workdirs restored
+	SkippedSessions []string  `json:"skipped_sessions"` // Already present, left as they were
+}
+
+// handleRestore rehydrates the history and session workdirs from a backup
+// archive sent as the request body, e.g. to move an agent to a new machine.
+// Existing files and sessions are kept, so restoring twice is harmless.
+func (a *Agent) handleRestore(w http.ResponseWriter, r *http.Request) {
+	// Archives take far longer to upload than the server's timeouts allow
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(restoreTimeout)
+	rc.SetReadDeadline(deadline)
+	rc.SetWriteDeadline(deadline)
+
+	if !a.restoreMu.TryLock() {
+		api.WriteError(w, http.StatusConflict, api.ErrorAgentBusy, "A restore is already running")
+		return
+	}
+	defer a.restoreMu.Unlock()
+
+	a.mu.RLock()
+	busy := a.state != StateIdle
+	a.mu.RUnlock()
+	if busy {
+		api.WriteError(w, http.StatusConflict, api.ErrorAgentBusy, "Cannot restore while a task is running")
+		return
+	}
+
+	cfg := a.cfg()
+	if err := os.MkdirAll(cfg.SessionDir, 0700); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, api.ErrorReadError, err.Error())
+		return
+	}
+	// Hidden, so it's never taken for a session, and on the same
+	// filesystem so sessions move into place by renaming
+	staging, err := os.MkdirTemp(cfg.SessionDir, ".restore-*")
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, api.ErrorReadError, err.Error())
+		return
+	}
+	defer os.RemoveAll(staging)
+
+	manifest, err := backup.Extract(r.Body, staging, MaxRestoreBytes)
+	if errors.Is(err, backup.ErrTooLarge) {
+		api.WriteError(w, http.StatusRequestEntityTooLarge, api.ErrorValidation, err.Error())
+		return
+	}
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, err.Error())
+		return
+	}
+	if !strings.HasPrefix(manifest.Prefix, "agent-") {
+		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation,
+			fmt.Sprintf("Backup %q is not of an agent", manifest.Prefix))
+		return
+	}
+	if !strings.HasSuffix(manifest.Prefix, "-"+a.agentKind) {
+		api.WriteError(w, http.StatusBadRequest, api.ErrorAgentKindMismatch,
+			fmt.Sprintf("Backup %q is not of a %s agent", manifest.Prefix, a.agentKind))
+		return
+	}
+
+	result := RestoreResult{
+		Prefix:          manifest.Prefix,
+		CreatedAt:       manifest.CreatedAt,
+		Sessions:        []string{},
+		SkippedSessions: []string{},
+	}
+	if err := restoreSessions(filepath.Join(staging, "sessions"), cfg.SessionDir, &result); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, api.ErrorReadError, "Restoring sessions: "+err.Error())
+		return
+	}
+	if a.history != nil {
+		if result.HistoryFiles, err = restoreDir(filepath.Join(staging, "history"), cfg.HistoryDir); err != nil {
+			api.WriteError(w, http.StatusInternalServerError, api.ErrorReadError, "Restoring history: "+err.Error())
+			return
+		}
+		if err := a.history.Reload(); err != nil {
+			api.WriteError(w, http.StatusInternalServerError, api.ErrorReadError, err.Error())
+			return
+		}
+		result.HistoryEntries = a.history.List(history.ListOptions{Limit: 1}).Total
+	}
+
+	a.log.Info("backup restored", map[string]any{
+		"prefix":           result.Prefix,
+		"created_at":       result.CreatedAt,
+		"history_files":    result.HistoryFiles,
+		"sessions":         len(result.Sessions),
+		"skipped_sessions": len(result.SkippedSessions),
+	})
+	api.WriteJSON(w, http.StatusOK, result)
+}
+
+// restoreSessions moves each session workdir from src into sessionDir,
+// skipping sessions that already exist there.
+func restoreSessions(src, sessionDir string, result *RestoreResult) error {
+	entries, err := os.ReadDir(src)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !isSafeSessionID(entry.Name()) || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		dest := filepath.Join(sessionDir, entry.Name())
+		if _, err := os.Lstat(dest); err == nil {
+			result.SkippedSessions = append(result.SkippedSessions, entry.Name())
+			continue
+		}
+		if err := os.Rename(filepath.Join(src, entry.Name()), dest); err != nil {
+			return err
+		}
+		result.Sessions = append(result.Sessions, entry.Name())
+	}
+	sort.Strings(result.Sessions)
+	sort.Strings(result.SkippedSessions)
+	return nil
+}
+
+// restoreDir moves the files under src into dest, keeping any that already
+// exist, and returns how many were added.
+func restoreDir(src, dest string) (int, error) {
+	added := 0
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		if _, err := os.Lstat(target); err == nil {
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return err
+		}
+		if err := moveFile(p, target); err != nil {
+			return err
+		}
+		added++
+		return nil
+	})
+	return added, err
+}
+
+// moveFile renames src to dest, copying it instead when they're on
+// different filesystems.
+func moveFile(src, dest string) error {
+	if err := os.Rename(src, dest); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,143 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/backup"
+	"phobos.org.uk/agency/internal/config"
+	"phobos.org.uk/agency/internal/history"
+)
+
+func TestRestoreEndpoint(t *testing.T) {
+	t.Parallel()
+
+	// Back up an agent with a session and a finished task
+	dest := t.TempDir()
+	cfg := config.Default()
+	cfg.Name = "dev"
+	cfg.SessionDir = t.TempDir()
+	cfg.HistoryDir = filepath.Join(t.TempDir(), "history")
+	cfg.Backup = config.BackupConfig{Destination: dest}
+	old := New(cfg, "test")
+	require.NoError(t, os.MkdirAll(filepath.Join(cfg.SessionDir, "sess-1"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(cfg.SessionDir, "sess-1", "notes.md"), []byte("work"), 0600))
+	require.NoError(t, os.MkdirAll(filepath.Join(cfg.SessionDir, ".certs"), 0700))
+	require.NoError(t, old.history.Save(&history.Entry{TaskID: "task-1", SessionID: "sess-1", State: "completed", CompletedAt: time.Now()}))
+	name, err := old.backups.Backup(context.Background())
+	require.NoError(t, err)
+	archive, err := os.ReadFile(filepath.Join(dest, name))
+	require.NoError(t, err)
+
+	// Restore it on a fresh agent that already has a session of its own
+	cfg = config.Default()
+	cfg.SessionDir = t.TempDir()
+	cfg.HistoryDir = filepath.Join(t.TempDir(), "history")
+	a := New(cfg, "test")
+	require.NoError(t, os.MkdirAll(filepath.Join(cfg.SessionDir, "sess-local"), 0700))
+	restore := func(body []byte) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		a.Router().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/restore", bytes.NewReader(body)))
+		return w
+	}
+
+	w := restore(archive)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result RestoreResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	require.Equal(t, "agent-dev-claude", result.Prefix)
+	require.Equal(t, []string{"sess-1"}, result.Sessions)
+	require.Empty(t, result.SkippedSessions)
+	require.Equal(t, 1, result.HistoryFiles)
+	require.Equal(t, 1, result.HistoryEntries)
+
+	data, err := os.ReadFile(filepath.Join(cfg.SessionDir, "sess-1", "notes.md"))
+	require.NoError(t, err)
+	require.Equal(t, "work", string(data))
+	require.NoDirExists(t, filepath.Join(cfg.SessionDir, ".certs"))
+	require.DirExists(t, filepath.Join(cfg.SessionDir, "sess-local"))
+	entry, err := a.history.Get("task-1")
+	require.NoError(t, err)
+	require.Equal(t, "sess-1", entry.SessionID)
+	matches, _ := filepath.Glob(filepath.Join(cfg.SessionDir, ".restore-*"))
+	require.Empty(t, matches)
+
+	// Restoring again keeps what is there
+	w = restore(archive)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	require.Empty(t, result.Sessions)
+	require.Equal(t, []string{"sess-1"}, result.SkippedSessions)
+	require.Zero(t, result.HistoryFiles)
+
+	// Only backups of the same kind of agent are accepted
+	for prefix, code := range map[string]string{"web": api.ErrorValidation, "agent-dev-codex": api.ErrorAgentKindMismatch} {
+		var buf bytes.Buffer
+		require.NoError(t, backup.WriteArchive(&buf, backup.Manifest{Prefix: prefix, CreatedAt: time.Now()}, nil))
+		w = restore(buf.Bytes())
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		require.Contains(t, w.Body.String(), code)
+	}
+	w = restore([]byte("not an archive"))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Not while a task is running
+	a.mu.Lock()
+	a.state = StateWorking
+	a.mu.Unlock()
+	w = restore(archive)
+	require.Equal(t, http.StatusConflict, w.Code)
+	require.Contains(t, w.Body.String(), api.ErrorAgentBusy)
+}
+
+func TestRestoreOutlivesServerTimeouts(t *testing.T) {
+	t.Parallel()
+
+	sessions := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(sessions, "sess-1"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(sessions, "sess-1", "notes.md"), []byte("work"), 0600))
+	var archive bytes.Buffer
+	require.NoError(t, backup.WriteArchive(&archive, backup.Manifest{Prefix: "agent-dev-claude", CreatedAt: time.Now()},
+		[]backup.Source{{Name: "sessions", Dir: sessions}}))
+
+	cfg := config.Default()
+	cfg.SessionDir = t.TempDir()
+	cfg.HistoryDir = filepath.Join(t.TempDir(), "history")
+	a := New(cfg, "test")
+	server := httptest.NewUnstartedServer(a.Router())
+	server.Config.ReadTimeout = 200 * time.Millisecond
+	server.Config.WriteTimeout = 200 * time.Millisecond
+	server.Start()
+	t.Cleanup(server.Close)
+
+	// Send the archive slowly, taking well past the server's timeouts
+	body, pw := io.Pipe()
+	go func() {
+		data := archive.Bytes()
+		chunk := len(data)/4 + 1
+		for len(data) > 0 {
+			n := min(chunk, len(data))
+			if _, err := pw.Write(data[:n]); err != nil {
+				return
+			}
+			data = data[n:]
+			time.Sleep(200 * time.Millisecond)
+		}
+		pw.Close()
+	}()
+	resp, err := server.Client().Post(server.URL+"/admin/restore", "application/gzip", body)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.FileExists(t, filepath.Join(cfg.SessionDir, "sess-1", "notes.md"))
+}
@@ -1,6 +1,11 @@
 package agent
 
-import "phobos.org.uk/agency/internal/config"
+import (
+	"os"
+	"path/filepath"
+
+	"phobos.org.uk/agency/internal/config"
+)
 
 // RunnerCommand describes how to invoke a CLI runner.
 type RunnerCommand struct {
@@ -16,6 +21,7 @@ type RunnerOutput struct {
 	TokenUsage       *TokenUsage
 	MaxTurnsExceeded bool
 	HasOutput        bool
+	DeniedTools      []string // Tool calls the CLI refused, one entry per denial
 }
 
 // Runner defines a provider-specific CLI adapter.
@@ -27,6 +33,10 @@ type Runner interface {
 	ErrorType() string
 	SupportsAutoResume() bool
 	MaxTurnsLimit(cfg *config.Config) int
+	PermissionModes() []string // Values accepted for a task's permission_mode
+	SupportsAllowedTools() bool
+	SessionState(workDir, sessionID string) []string // Files the CLI keeps for a session outside its workdir
+	StateDir() (envVar, dir string)                  // Where the CLI keeps credentials and sessions, and the variable that moves it
 }
 
 // NewClaudeRunner returns a Claude CLI runner.
@@ -38,3 +48,16 @@ func NewClaudeRunner() Runner {
 func NewCodexRunner() Runner {
 	return codexRunner{}
 }
+
+// cliStateDir returns the directory named by envVar, or home/name, or "" if
+// there is no home directory.
+func cliStateDir(envVar, name string) string {
+	if dir := os.Getenv(envVar); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, name)
+}
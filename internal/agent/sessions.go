@@ -0,0 +1,385 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/config"
+)
+
+// SessionUsage is the disk space taken by one session workdir.
+type SessionUsage struct {
+	SessionID  string    `json:"session_id"`
+	Bytes      int64     `json:"bytes"`
+	LastUsedAt time.Time `json:"last_used_at"` // Newest modification time in the workdir
+	Active     bool      `json:"active"`       // A task is running in it
+}
+
+// DiskUsageResponse is the /sessions/disk-usage response.
+type DiskUsageResponse struct {
+	SessionDir    string         `json:"session_dir"`
+	TotalBytes    int64          `json:"total_bytes"`
+	MaxTotalBytes int64          `json:"max_total_bytes,omitempty"`
+	MaxAgeSeconds float64        `json:"max_age_seconds,omitempty"`
+	Sessions      []SessionUsage `json:"sessions"` // Least recently used first
+}
+
+// SessionInfo describes a session known to the agent from its workdir or
+// task history.
+type SessionInfo struct {
+	SessionID  string    `json:"session_id"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	TaskCount  int       `json:"task_count"` // Tasks in the retained history
+	Bytes      int64     `json:"bytes"`      // Workdir size
+	HasWorkdir bool      `json:"has_workdir"`
+	Active     bool      `json:"active"`
+}
+
+// DeleteSessionResponse is the DELETE /sessions/{id} response.
+type DeleteSessionResponse struct {
+	SessionID      string `json:"session_id"`
+	WorkdirRemoved bool   `json:"workdir_removed"`
+	FreedBytes     int64  `json:"freed_bytes"`
+	StateRemoved   int    `json:"cli_state_removed"` // CLI state files or directories removed
+}
+
+// errSessionActive is returned when removing the running task's session.
+var errSessionActive = errors.New("session is in use by the running task")
+
+// CleanupResult reports the sessions removed by a cleanup.
+type CleanupResult struct {
+	Removed    []string `json:"removed"`
+	FreedBytes int64    `json:"freed_bytes"`
+	TotalBytes int64    `json:"total_bytes"` // Remaining after the cleanup
+}
+
+// sessionUsage measures each session workdir, least recently used first.
+// Hidden entries such as .certs are not sessions and are skipped.
+func (a *Agent) sessionUsage() ([]SessionUsage, error) {
+	dir := a.cfg().SessionDir
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading session dir: %w", err)
+	}
+
+	active := a.activeSession()
+	var sessions []SessionUsage
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		usage := SessionUsage{SessionID: entry.Name(), Active: entry.Name() == active}
+		usage.Bytes, usage.LastUsedAt = dirUsage(filepath.Join(dir, entry.Name()))
+		sessions = append(sessions, usage)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.Before(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+// dirUsage returns the total size of the regular files under dir and the
+// newest modification time of anything in it. Unreadable entries are
+// counted as far as they can be.
+func dirUsage(dir string) (int64, time.Time) {
+	var size int64
+	var modTime time.Time
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+		return nil
+	})
+	return size, modTime
+}
+
+// activeSession returns the workdir of the running task, if any.
+func (a *Agent) activeSession() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.currentTask == nil || a.state == StateIdle {
+		return ""
+	}
+	return a.currentTask.WorkDir
+}
+
+// CleanupSessions removes session workdirs unused for longer than maxAge,
+// then the least recently used ones until they total at most maxTotalBytes.
+// A zero limit is not enforced. The running task's session is never removed.
+func (a *Agent) CleanupSessions(maxAge time.Duration, maxTotalBytes int64) (CleanupResult, error) {
+	// Finish removals interrupted by an earlier failure
+	leftovers, _ := filepath.Glob(filepath.Join(a.cfg().SessionDir, ".removing-*"))
+	for _, path := range leftovers {
+		os.RemoveAll(path)
+	}
+
+	sessions, err := a.sessionUsage()
+	if err != nil {
+		return CleanupResult{}, err
+	}
+	result := CleanupResult{Removed: []string{}}
+	for _, s := range sessions {
+		result.TotalBytes += s.Bytes
+	}
+
+	now := time.Now()
+	for _, s := range sessions {
+		expired := maxAge > 0 && now.Sub(s.LastUsedAt) > maxAge
+		overQuota := maxTotalBytes > 0 && result.TotalBytes > maxTotalBytes
+		if !expired && !overQuota {
+			continue
+		}
+		if err := a.removeSession(s.SessionID); err != nil {
+			a.log.Warn("failed to remove session workdir", map[string]any{
+				"session_id": s.SessionID,
+				"error":      err.Error(),
+			})
+			continue
+		}
+		result.Removed = append(result.Removed, s.SessionID)
+		result.FreedBytes += s.Bytes
+		result.TotalBytes -= s.Bytes
+	}
+
+	if len(result.Removed) > 0 {
+		a.log.Info("session workdirs cleaned up", map[string]any{
+			"removed":     len(result.Removed),
+			"freed_bytes": result.FreedBytes,
+			"total_bytes": result.TotalBytes,
+		})
+	}
+	return result, nil
+}
+
+// removeSession deletes a session workdir unless a task is running in it.
+// The workdir is first renamed aside under the lock, so a task starting
+// meanwhile gets a fresh directory rather than a half-deleted one.
+func (a *Agent) removeSession(sessionID string) error {
+	dir := filepath.Join(a.cfg().SessionDir, sessionID)
+	trash := filepath.Join(a.cfg().SessionDir, ".removing-"+sessionID)
+
+	a.mu.Lock()
+	if a.currentTask != nil && a.state != StateIdle && a.currentTask.WorkDir == sessionID {
+		a.mu.Unlock()
+		return errSessionActive
+	}
+	err := os.Rename(dir, trash)
+	a.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(trash)
+}
+
+// RunSessionJanitor enforces the sessions limits every cleanup interval
+// until ctx is cancelled. Limits are read from the current config on each
+// pass, so a reload can enable or change them.
+func (a *Agent) RunSessionJanitor(ctx context.Context) {
+	for {
+		limits := a.cfg().Sessions
+		interval := limits.CleanupInterval
+		if interval <= 0 {
+			interval = config.DefaultSessionCleanupInterval
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		limits = a.cfg().Sessions
+		if !limits.Limited() {
+			continue
+		}
+		if _, err := a.CleanupSessions(limits.MaxAge, limits.MaxTotalBytes); err != nil {
+			a.log.Warn("session cleanup failed", map[string]any{"error": err.Error()})
+		}
+	}
+}
+
+// handleSessionDiskUsage reports the disk space taken by each session workdir.
+func (a *Agent) handleSessionDiskUsage(w http.ResponseWriter, r *http.Request) {
+	sessions, err := a.sessionUsage()
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, api.ErrorReadError, err.Error())
+		return
+	}
+	limits := a.cfg().Sessions
+	resp := DiskUsageResponse{
+		SessionDir:    a.cfg().SessionDir,
+		MaxTotalBytes: limits.MaxTotalBytes,
+		MaxAgeSeconds: limits.MaxAge.Seconds(),
+		Sessions:      []SessionUsage{},
+	}
+	for _, s := range sessions {
+		resp.TotalBytes += s.Bytes
+		resp.Sessions = append(resp.Sessions, s)
+	}
+	api.WriteJSON(w, http.StatusOK, resp)
+}
+
+// handleSessionCleanup runs a cleanup now. The body may override the
+// configured limits; without either limit nothing is removed.
+func (a *Agent) handleSessionCleanup(w http.ResponseWriter, r *http.Request) {
+	limits := a.cfg().Sessions
+	req := struct {
+		MaxAgeSeconds *int64 `json:"max_age_seconds"`
+		MaxTotalBytes *int64 `json:"max_total_bytes"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, "Invalid JSON: "+err.Error())
+		return
+	}
+	maxAge, maxTotalBytes := limits.MaxAge, limits.MaxTotalBytes
+	if req.MaxAgeSeconds != nil {
+		if *req.MaxAgeSeconds < 0 {
+			api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, "max_age_seconds must not be negative")
+			return
+		}
+		maxAge = time.Duration(*req.MaxAgeSeconds) * time.Second
+	}
+	if req.MaxTotalBytes != nil {
+		if *req.MaxTotalBytes < 0 {
+			api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, "max_total_bytes must not be negative")
+			return
+		}
+		maxTotalBytes = *req.MaxTotalBytes
+	}
+
+	result, err := a.CleanupSessions(maxAge, maxTotalBytes)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, api.ErrorReadError, err.Error())
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, result)
+}
+
+// sessions lists the sessions with a workdir or history entries, most
+// recently used first.
+func (a *Agent) sessions() ([]SessionInfo, error) {
+	usage, err := a.sessionUsage()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*SessionInfo)
+	for _, u := range usage {
+		byID[u.SessionID] = &SessionInfo{
+			SessionID:  u.SessionID,
+			LastUsedAt: u.LastUsedAt,
+			Bytes:      u.Bytes,
+			HasWorkdir: true,
+			Active:     u.Active,
+		}
+	}
+	if a.history != nil {
+		for id, act := range a.history.SessionActivity() {
+			info, ok := byID[id]
+			if !ok {
+				info = &SessionInfo{SessionID: id}
+				byID[id] = info
+			}
+			info.TaskCount = act.TaskCount
+			if act.CompletedAt.After(info.LastUsedAt) {
+				info.LastUsedAt = act.CompletedAt
+			}
+		}
+	}
+
+	sessions := make([]SessionInfo, 0, len(byID))
+	for _, info := range byID {
+		sessions = append(sessions, *info)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].LastUsedAt.Equal(sessions[j].LastUsedAt) {
+			return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+		}
+		return sessions[i].SessionID < sessions[j].SessionID
+	})
+	return sessions, nil
+}
+
+// handleListSessions lists the sessions the agent knows about.
+func (a *Agent) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := a.sessions()
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, api.ErrorReadError, err.Error())
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, map[string]any{"sessions": sessions})
+}
+
+// handleDeleteSession removes a session's workdir and the state the CLI
+// keeps for it, so it can no longer be resumed. History entries are kept.
+func (a *Agent) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	sessionID := chi.URLParam(r, "id")
+	if !isSafeSessionID(sessionID) {
+		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, "Invalid session_id")
+		return
+	}
+	if a.activeSession() == sessionID {
+		api.WriteError(w, http.StatusConflict, api.ErrorTaskInProgress, fmt.Sprintf("Session %s has a running task", sessionID))
+		return
+	}
+
+	resp := DeleteSessionResponse{SessionID: sessionID}
+	workDir := filepath.Join(a.cfg().SessionDir, sessionID)
+	if _, err := os.Stat(workDir); err == nil {
+		size, _ := dirUsage(workDir)
+		if err := a.removeSession(sessionID); errors.Is(err, errSessionActive) {
+			api.WriteError(w, http.StatusConflict, api.ErrorTaskInProgress, fmt.Sprintf("Session %s has a running task", sessionID))
+			return
+		} else if err != nil {
+			api.WriteError(w, http.StatusInternalServerError, "delete_error", "Failed to remove session workdir: "+err.Error())
+			return
+		}
+		resp.WorkdirRemoved = true
+		resp.FreedBytes = size
+	}
+
+	for _, path := range a.runner.SessionState(workDir, sessionID) {
+		if _, err := os.Lstat(path); err != nil {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			api.WriteError(w, http.StatusInternalServerError, "delete_error", "Failed to remove CLI session state: "+err.Error())
+			return
+		}
+		resp.StateRemoved++
+	}
+
+	if !resp.WorkdirRemoved && resp.StateRemoved == 0 {
+		api.WriteError(w, http.StatusNotFound, api.ErrorNotFound, fmt.Sprintf("Session %s not found", sessionID))
+		return
+	}
+	a.log.Info("session deleted", map[string]any{
+		"session_id":        sessionID,
+		"freed_bytes":       resp.FreedBytes,
+		"cli_state_removed": resp.StateRemoved,
+	})
+	api.WriteJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,199 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/config"
+	"phobos.org.uk/agency/internal/history"
+)
+
+// writeSession creates a session workdir holding size bytes, last used at mtime.
+func writeSession(t *testing.T, sessionDir, id string, size int, mtime time.Time) {
+	t.Helper()
+	dir := filepath.Join(sessionDir, id)
+	require.NoError(t, os.MkdirAll(dir, 0700))
+	path := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(path, make([]byte, size), 0600))
+	require.NoError(t, os.Chtimes(path, mtime, mtime))
+	require.NoError(t, os.Chtimes(dir, mtime, mtime))
+}
+
+func newSessionsAgent(t *testing.T) (*Agent, string) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	cfg := config.Default()
+	cfg.ID = "agent-sessions"
+	cfg.SessionDir = filepath.Join(tmpDir, "sessions")
+	cfg.HistoryDir = ""
+	return New(cfg, "test"), cfg.SessionDir
+}
+
+func TestCleanupSessions(t *testing.T) {
+	t.Parallel()
+
+	a, sessionDir := newSessionsAgent(t)
+	now := time.Now()
+	writeSession(t, sessionDir, "stale", 100, now.Add(-48*time.Hour))
+	writeSession(t, sessionDir, "old", 300, now.Add(-3*time.Hour))
+	writeSession(t, sessionDir, "busy", 400, now.Add(-4*time.Hour))
+	writeSession(t, sessionDir, "recent", 200, now.Add(-time.Hour))
+	require.NoError(t, os.MkdirAll(filepath.Join(sessionDir, ".certs"), 0700))
+
+	// The running task's session is next in line for the quota but survives
+	a.mu.Lock()
+	a.state = StateWorking
+	a.currentTask = &Task{ID: "task-1", WorkDir: "busy"}
+	a.mu.Unlock()
+
+	result, err := a.CleanupSessions(24*time.Hour, 700)
+	require.NoError(t, err)
+	require.Equal(t, []string{"stale", "old"}, result.Removed, "expired first, then least recently used")
+	require.Equal(t, int64(400), result.FreedBytes)
+	require.Equal(t, int64(600), result.TotalBytes)
+
+	entries, err := os.ReadDir(sessionDir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	require.ElementsMatch(t, []string{".certs", "busy", "recent"}, names)
+}
+
+func TestSessionEndpoints(t *testing.T) {
+	t.Parallel()
+
+	a, sessionDir := newSessionsAgent(t)
+	now := time.Now()
+	writeSession(t, sessionDir, "first", 100, now.Add(-2*time.Hour))
+	writeSession(t, sessionDir, "second", 50, now.Add(-time.Hour))
+
+	req := httptest.NewRequest("GET", "/sessions/disk-usage", nil)
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var usage DiskUsageResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &usage))
+	require.Equal(t, int64(150), usage.TotalBytes)
+	require.Len(t, usage.Sessions, 2)
+	require.Equal(t, "first", usage.Sessions[0].SessionID)
+
+	// No limits configured or given: nothing to do
+	req = httptest.NewRequest("POST", "/sessions/cleanup", nil)
+	w = httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"removed": [], "freed_bytes": 0, "total_bytes": 150}`, w.Body.String())
+
+	req = httptest.NewRequest("POST", "/sessions/cleanup", strings.NewReader(`{"max_age_seconds": 5400}`))
+	w = httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"removed": ["first"], "freed_bytes": 100, "total_bytes": 50}`, w.Body.String())
+
+	req = httptest.NewRequest("POST", "/sessions/cleanup", strings.NewReader(`{"max_total_bytes": -1}`))
+	w = httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestListAndDeleteSessions(t *testing.T) {
+	claudeDir := t.TempDir()
+	t.Setenv("CLAUDE_CONFIG_DIR", claudeDir)
+
+	tmpDir := t.TempDir()
+	cfg := config.Default()
+	cfg.ID = "agent-sessions"
+	cfg.SessionDir = filepath.Join(tmpDir, "sessions")
+	cfg.HistoryDir = filepath.Join(tmpDir, "history")
+	a := New(cfg, "test")
+
+	now := time.Now()
+	writeSession(t, cfg.SessionDir, "with-workdir", 100, now.Add(-time.Hour))
+	require.NoError(t, a.history.Save(&history.Entry{TaskID: "task-1", SessionID: "with-workdir", CompletedAt: now.Add(-2 * time.Hour)}))
+	require.NoError(t, a.history.Save(&history.Entry{TaskID: "task-2", SessionID: "with-workdir", CompletedAt: now.Add(-time.Hour)}))
+	require.NoError(t, a.history.Save(&history.Entry{TaskID: "task-3", SessionID: "history-only", CompletedAt: now.Add(-3 * time.Hour)}))
+
+	// The CLI's transcript for the session lives outside the workdir
+	state := a.runner.SessionState(filepath.Join(cfg.SessionDir, "with-workdir"), "with-workdir")
+	require.Len(t, state, 1)
+	require.Equal(t, claudeDir, filepath.Dir(filepath.Dir(state[0])))
+	require.True(t, strings.HasSuffix(state[0], "-sessions-with-workdir"), "named after the workdir with / replaced")
+	require.NoError(t, os.MkdirAll(state[0], 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(state[0], "with-workdir.jsonl"), []byte("{}\n"), 0600))
+
+	req := httptest.NewRequest("GET", "/sessions", nil)
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Sessions []SessionInfo `json:"sessions"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Sessions, 2)
+	require.Equal(t, "with-workdir", list.Sessions[0].SessionID, "most recently used first")
+	require.Equal(t, 2, list.Sessions[0].TaskCount)
+	require.Equal(t, int64(100), list.Sessions[0].Bytes)
+	require.True(t, list.Sessions[0].HasWorkdir)
+	require.Equal(t, "history-only", list.Sessions[1].SessionID)
+	require.False(t, list.Sessions[1].HasWorkdir)
+
+	req = httptest.NewRequest("DELETE", "/sessions/with-workdir", nil)
+	w = httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"session_id": "with-workdir", "workdir_removed": true, "freed_bytes": 100, "cli_state_removed": 1}`, w.Body.String())
+	require.NoDirExists(t, filepath.Join(cfg.SessionDir, "with-workdir"))
+	require.NoDirExists(t, state[0])
+
+	// Nothing left to delete; history entries are kept
+	req = httptest.NewRequest("DELETE", "/sessions/with-workdir", nil)
+	w = httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusNotFound, w.Code)
+	_, err := a.history.Get("task-1")
+	require.NoError(t, err)
+
+	req = httptest.NewRequest("DELETE", "/sessions/..", nil)
+	w = httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDeleteActiveSession(t *testing.T) {
+	t.Parallel()
+
+	a, sessionDir := newSessionsAgent(t)
+	writeSession(t, sessionDir, "busy", 10, time.Now())
+	a.mu.Lock()
+	a.state = StateWorking
+	a.currentTask = &Task{ID: "task-1", WorkDir: "busy"}
+	a.mu.Unlock()
+
+	req := httptest.NewRequest("DELETE", "/sessions/busy", nil)
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusConflict, w.Code)
+	require.DirExists(t, filepath.Join(sessionDir, "busy"))
+}
+
+func TestCodexSessionState(t *testing.T) {
+	codexHome := t.TempDir()
+	t.Setenv("CODEX_HOME", codexHome)
+
+	dayDir := filepath.Join(codexHome, "sessions", "2026", "01", "02")
+	require.NoError(t, os.MkdirAll(dayDir, 0700))
+	rollout := filepath.Join(dayDir, "rollout-2026-01-02T10-00-00-0199a1b2-c3d4.jsonl")
+	require.NoError(t, os.WriteFile(rollout, nil, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dayDir, "rollout-2026-01-02T11-00-00-other.jsonl"), nil, 0600))
+
+	require.Equal(t, []string{rollout}, NewCodexRunner().SessionState("", "0199a1b2-c3d4"))
+}
@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/config"
+)
+
+// validateRunnerOptions checks per-task runner overrides against what the
+// runner supports, the bounds in the task_options config block, and the
+// agent's tool policy.
+func (a *Agent) validateRunnerOptions(opts api.RunnerOptions) error {
+	cfg := a.cfg()
+	bounds := cfg.TaskOptions
+	policy := cfg.Policy
+
+	if opts.MaxTurns != 0 {
+		defaultLimit := a.runner.MaxTurnsLimit(cfg)
+		if defaultLimit == 0 {
+			return fmt.Errorf("max_turns is not supported by %s agents", a.agentKind)
+		}
+		limit := bounds.MaxTurnsLimit
+		if limit == 0 {
+			limit = defaultLimit
+		}
+		if opts.MaxTurns < 1 || opts.MaxTurns > limit {
+			return fmt.Errorf("max_turns must be between 1 and %d", limit)
+		}
+	}
+
+	if opts.PermissionMode != "" {
+		modes := a.runner.PermissionModes()
+		if !slices.Contains(modes, opts.PermissionMode) {
+			return fmt.Errorf("permission_mode must be one of %s", strings.Join(modes, ", "))
+		}
+		if len(bounds.PermissionModes) > 0 && !slices.Contains(bounds.PermissionModes, opts.PermissionMode) {
+			return fmt.Errorf("permission_mode %q is not permitted on this agent (allowed: %s)",
+				opts.PermissionMode, strings.Join(bounds.PermissionModes, ", "))
+		}
+		if opts.PermissionMode == "bypassPermissions" && len(policy.AllowedTools) > 0 {
+			return fmt.Errorf("permission_mode bypassPermissions is not permitted by this agent's tool policy")
+		}
+	}
+
+	if len(opts.AllowedTools) > 0 {
+		if !a.runner.SupportsAllowedTools() {
+			return fmt.Errorf("allowed_tools is not supported by %s agents", a.agentKind)
+		}
+		for _, tool := range opts.AllowedTools {
+			if strings.TrimSpace(tool) == "" {
+				return fmt.Errorf("allowed_tools must not contain empty names")
+			}
+			if len(bounds.AllowedTools) > 0 && !slices.Contains(bounds.AllowedTools, tool) {
+				return fmt.Errorf("tool %q is not permitted on this agent (allowed: %s)",
+					tool, strings.Join(bounds.AllowedTools, ", "))
+			}
+			if !policy.Permits(tool) {
+				return fmt.Errorf("tool %q is not permitted by this agent's tool policy", tool)
+			}
+		}
+	}
+
+	return nil
+}
+
+// policyViolations returns the denied tool calls in a run's output that the
+// agent's tool policy forbids. Denials of permitted tools (e.g. the CLI asking
+// for approval in plan mode) are not violations.
+func (a *Agent) policyViolations(denied []string) []string {
+	policy := a.cfg().Policy
+	if policy.IsEmpty() {
+		return nil
+	}
+	var violations []string
+	for _, tool := range denied {
+		if !policy.Permits(tool) && !slices.Contains(violations, tool) {
+			violations = append(violations, tool)
+		}
+	}
+	return violations
+}
+
+// maxTurnsFor returns the turn limit a task runs with.
+func (a *Agent) maxTurnsFor(task *Task) int {
+	if task.MaxTurns > 0 {
+		return task.MaxTurns
+	}
+	return a.runner.MaxTurnsLimit(a.cfg())
+}
+
+// secretRefPrefix marks a task env value that names a secret in the agent's
+// secrets file, e.g. "secret:github_token".
+const secretRefPrefix = "secret:"
+
+// directorEnv is set by the web view on queued tasks, so it is passed
+// through whatever the env allowlist says.
+var directorEnv = []string{api.EnvDirectorURL, api.EnvQueueID, api.EnvSubtaskToken}
+
+// resolveEnv checks a task's env against the agent's env allowlist and
+// replaces secret references with their values, so secrets never travel
+// over the API.
+func (a *Agent) resolveEnv(env map[string]string) (map[string]string, *startError) {
+	if len(env) == 0 {
+		return env, nil
+	}
+	envCfg := a.cfg().Env
+	var secrets map[string]string
+	resolved := make(map[string]string, len(env))
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		if !envCfg.Permits(name) && !slices.Contains(directorEnv, name) {
+			return nil, &startError{
+				Status:  http.StatusBadRequest,
+				Code:    api.ErrorValidation,
+				Message: fmt.Sprintf("env variable %q is not permitted on this agent", name),
+			}
+		}
+		ref, isSecret := strings.CutPrefix(env[name], secretRefPrefix)
+		if !isSecret {
+			resolved[name] = env[name]
+			continue
+		}
+		if secrets == nil {
+			var err error
+			if secrets, err = config.LoadSecrets(envCfg.SecretsPath()); err != nil {
+				return nil, &startError{Status: http.StatusInternalServerError, Code: "configuration_error", Message: err.Error()}
+			}
+		}
+		value, ok := secrets[ref]
+		if !ok {
+			return nil, &startError{
+				Status:  http.StatusBadRequest,
+				Code:    api.ErrorValidation,
+				Message: fmt.Sprintf("env variable %q refers to unknown secret %q", name, ref),
+			}
+		}
+		resolved[name] = value
+	}
+	return resolved, nil
+}
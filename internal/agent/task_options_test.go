@@ -0,0 +1,253 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/config"
+)
+
+func TestValidateRunnerOptions(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.HistoryDir = ""
+	cfg.ID = "agent-test"
+	cfg.Claude.MaxTurns = 50
+	claude := New(cfg, "test")
+
+	bounded := config.Default()
+	bounded.HistoryDir = ""
+	bounded.ID = "agent-test"
+	bounded.TaskOptions = config.TaskOptions{
+		MaxTurnsLimit:   200,
+		PermissionModes: []string{"plan", "acceptEdits"},
+		AllowedTools:    []string{"Read", "Grep"},
+	}
+	claudeBounded := New(bounded, "test")
+
+	policied := config.Default()
+	policied.HistoryDir = ""
+	policied.ID = "agent-test"
+	policied.Policy = config.ToolPolicy{
+		AllowedTools: []string{"Read", "Edit"},
+		DeniedTools:  []string{"Bash"},
+	}
+	claudePolicied := New(policied, "test")
+
+	codexCfg := config.Default()
+	codexCfg.HistoryDir = ""
+	codexCfg.ID = "agent-test"
+	codex := NewWithRunner(codexCfg, "test", NewCodexRunner())
+
+	tests := []struct {
+		name    string
+		agent   *Agent
+		opts    api.RunnerOptions
+		wantErr string
+	}{
+		{"no overrides", claude, api.RunnerOptions{}, ""},
+		{"max turns within default", claude, api.RunnerOptions{MaxTurns: 10}, ""},
+		{"max turns above default", claude, api.RunnerOptions{MaxTurns: 51}, "between 1 and 50"},
+		{"negative max turns", claude, api.RunnerOptions{MaxTurns: -1}, "between 1 and 50"},
+		{"max turns within configured limit", claudeBounded, api.RunnerOptions{MaxTurns: 150}, ""},
+		{"unknown permission mode", claude, api.RunnerOptions{PermissionMode: "yolo"}, "must be one of"},
+		{"permission mode not permitted", claudeBounded, api.RunnerOptions{PermissionMode: "bypassPermissions"}, "not permitted"},
+		{"permitted permission mode", claudeBounded, api.RunnerOptions{PermissionMode: "plan"}, ""},
+		{"tool not permitted", claudeBounded, api.RunnerOptions{AllowedTools: []string{"Bash"}}, "not permitted"},
+		{"empty tool name", claude, api.RunnerOptions{AllowedTools: []string{" "}}, "empty"},
+		{"permitted tools", claudeBounded, api.RunnerOptions{AllowedTools: []string{"Read"}}, ""},
+		{"tool denied by policy", claudePolicied, api.RunnerOptions{AllowedTools: []string{"Bash"}}, "tool policy"},
+		{"tool outside policy allowlist", claudePolicied, api.RunnerOptions{AllowedTools: []string{"Write"}}, "tool policy"},
+		{"tool within policy", claudePolicied, api.RunnerOptions{AllowedTools: []string{"Read"}}, ""},
+		{"bypass with policy allowlist", claudePolicied, api.RunnerOptions{PermissionMode: "bypassPermissions"}, "tool policy"},
+		{"codex sandbox mode", codex, api.RunnerOptions{PermissionMode: "read-only"}, ""},
+		{"codex max turns", codex, api.RunnerOptions{MaxTurns: 5}, "not supported by codex"},
+		{"codex allowed tools", codex, api.RunnerOptions{AllowedTools: []string{"Read"}}, "not supported by codex"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.agent.validateRunnerOptions(tt.opts)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestBuildCommandRunnerOptions(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	task := &Task{
+		Model:  "sonnet",
+		Prompt: "test",
+		RunnerOptions: api.RunnerOptions{
+			MaxTurns:       7,
+			PermissionMode: "plan",
+			AllowedTools:   []string{"Read", "Grep"},
+		},
+	}
+
+	args := claudeRunner{}.BuildCommand(task, "test", cfg).Args
+	require.NotContains(t, args, "--dangerously-skip-permissions")
+	require.Equal(t, "plan", args[indexOf(args, "--permission-mode")+1])
+	require.Equal(t, "7", args[indexOf(args, "--max-turns")+1])
+	require.Equal(t, "Read,Grep", args[indexOf(args, "--allowedTools")+1])
+
+	codexTask := &Task{Prompt: "test", RunnerOptions: api.RunnerOptions{PermissionMode: "workspace-write"}}
+	args = codexRunner{}.BuildCommand(codexTask, "test", cfg).Args
+	require.NotContains(t, args, "--dangerously-bypass-approvals-and-sandbox")
+	require.Equal(t, "workspace-write", args[indexOf(args, "--sandbox")+1])
+}
+
+func TestCreateTaskRejectsInvalidRunnerOptions(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.HistoryDir = ""
+	cfg.ID = "agent-test"
+	a := New(cfg, "test")
+
+	body := `{"prompt": "test", "max_turns": 500}`
+	req := httptest.NewRequest("POST", "/task", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "max_turns")
+	require.Equal(t, StateIdle, a.state)
+}
+
+func TestBuildCommandToolPolicy(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.Policy = config.ToolPolicy{
+		AllowedTools: []string{"Read", "Edit"},
+		DeniedTools:  []string{"Bash"},
+	}
+
+	args := claudeRunner{}.BuildCommand(&Task{Model: "sonnet", Prompt: "test"}, "test", cfg).Args
+	require.NotContains(t, args, "--dangerously-skip-permissions")
+	require.Equal(t, "default", args[indexOf(args, "--permission-mode")+1])
+	require.Equal(t, "Read,Edit", args[indexOf(args, "--allowedTools")+1])
+	require.Equal(t, "Bash", args[indexOf(args, "--disallowedTools")+1])
+
+	// A task allowlist narrows the policy allowlist
+	task := &Task{Model: "sonnet", Prompt: "test", RunnerOptions: api.RunnerOptions{AllowedTools: []string{"Read"}}}
+	args = claudeRunner{}.BuildCommand(task, "test", cfg).Args
+	require.Equal(t, "Read", args[indexOf(args, "--allowedTools")+1])
+}
+
+func TestCreateTaskRejectsPolicyOnCodex(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.HistoryDir = ""
+	cfg.ID = "agent-test"
+	cfg.Policy = config.ToolPolicy{DeniedTools: []string{"Bash"}}
+	a := NewWithRunner(cfg, "test", NewCodexRunner())
+
+	req := httptest.NewRequest("POST", "/task", bytes.NewBufferString(`{"prompt": "test"}`))
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Contains(t, w.Body.String(), "tool policy is not supported")
+}
+
+func TestPolicyViolationFailsTask(t *testing.T) {
+	// Cannot use t.Parallel() with t.Setenv()
+	tmpDir := t.TempDir()
+	mockPath := filepath.Join(tmpDir, "mock-claude-denied")
+	script := `#!/bin/bash
+echo '{"type":"result","subtype":"success","result":"done","permission_denials":[{"tool_name":"Bash"},{"tool_name":"Read"}]}'
+`
+	require.NoError(t, os.WriteFile(mockPath, []byte(script), 0755))
+	t.Setenv("CLAUDE_BIN", mockPath)
+
+	promptsDir := filepath.Join(tmpDir, "prompts")
+	require.NoError(t, os.MkdirAll(promptsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "claude-prod.md"), []byte("# Test Instructions"), 0644))
+
+	cfg := config.Default()
+	cfg.SessionDir = filepath.Join(tmpDir, "sessions")
+	cfg.HistoryDir = ""
+	cfg.AgencyPromptsDir = promptsDir
+	cfg.Policy = config.ToolPolicy{DeniedTools: []string{"Bash"}}
+	a := New(cfg, "test")
+
+	req := httptest.NewRequest("POST", "/task", bytes.NewBufferString(`{"prompt": "test"}`))
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp struct {
+		TaskID string `json:"task_id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	var task *Task
+	require.Eventually(t, func() bool {
+		a.mu.RLock()
+		defer a.mu.RUnlock()
+		task = a.tasks[resp.TaskID]
+		return task != nil && task.State == TaskStateFailed
+	}, 5*time.Second, 10*time.Millisecond)
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	require.Equal(t, "policy_violation", task.Error.Type)
+	require.Equal(t, "Tool policy denied: Bash", task.Error.Message)
+}
+
+func TestResolveEnv(t *testing.T) {
+	t.Parallel()
+
+	secretsFile := filepath.Join(t.TempDir(), "secrets.yaml")
+	require.NoError(t, os.WriteFile(secretsFile, []byte("github_token: ghp_123\n"), 0600))
+
+	cfg := config.Default()
+	cfg.HistoryDir = ""
+	cfg.ID = "agent-test"
+	cfg.Env = config.EnvConfig{Allowed: []string{"GOFLAGS", "GITHUB_TOKEN"}, SecretsFile: secretsFile}
+	a := New(cfg, "test")
+
+	env, err := a.resolveEnv(map[string]string{
+		"GOFLAGS":           "-mod=mod",
+		"GITHUB_TOKEN":      "secret:github_token",
+		api.EnvSubtaskToken: "abc", // Set by the web view, so always allowed
+	})
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"GOFLAGS": "-mod=mod", "GITHUB_TOKEN": "ghp_123", api.EnvSubtaskToken: "abc"}, env)
+
+	_, err = a.resolveEnv(map[string]string{"LD_PRELOAD": "/tmp/x.so"})
+	require.NotNil(t, err)
+	require.Equal(t, http.StatusBadRequest, err.Status)
+	require.Contains(t, err.Message, `"LD_PRELOAD" is not permitted`)
+
+	_, err = a.resolveEnv(map[string]string{"GITHUB_TOKEN": "secret:npm_token"})
+	require.NotNil(t, err)
+	require.Contains(t, err.Message, `unknown secret "npm_token"`)
+
+	// Secrets resolve on the way to the runner; the request is rejected
+	// before a task starts when one is missing
+	body, _ := json.Marshal(TaskRequest{Prompt: "hi", Env: map[string]string{"GITHUB_TOKEN": "secret:missing"}})
+	rec := httptest.NewRecorder()
+	a.handleCreateTask(rec, httptest.NewRequest("POST", "/task", bytes.NewReader(body)))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Equal(t, StateIdle, a.state)
+}
@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"phobos.org.uk/agency/internal/history"
+	"phobos.org.uk/agency/internal/stream"
+)
+
+const (
+	maxTimelineSteps  = 500 // Steps kept per task; the oldest are dropped
+	maxTimelineTarget = 120 // Characters of a step's target kept
+)
+
+// timelineTargetKeys are the tool inputs naming what a call acts on, in the
+// order they're preferred.
+var timelineTargetKeys = []string{"file_path", "notebook_path", "pattern", "command", "url", "query", "path"}
+
+// timeline builds a task's tool-call timeline from its stream events. It is
+// guarded by the agent's mutex.
+type timeline struct {
+	steps   []history.TimelineStep
+	pending map[string]int // Tool ID to index in steps, until the result arrives
+}
+
+// add records the tool calls and results among events.
+func (t *timeline) add(events []*stream.ToolEvent) {
+	for _, event := range events {
+		switch event.Type {
+		case stream.EventToolCall:
+			if len(t.steps) == maxTimelineSteps {
+				t.dropOldest()
+			}
+			if t.pending == nil {
+				t.pending = make(map[string]int)
+			}
+			t.pending[event.ToolID] = len(t.steps)
+			t.steps = append(t.steps, history.TimelineStep{
+				Tool:      event.ToolName,
+				Target:    timelineTarget(event.Input),
+				StartedAt: event.Timestamp,
+			})
+		case stream.EventToolResult:
+			i, ok := t.pending[event.ToolID]
+			if !ok {
+				continue
+			}
+			delete(t.pending, event.ToolID)
+			step := &t.steps[i]
+			step.Done = true
+			step.DurationMS = event.Timestamp.Sub(step.StartedAt).Milliseconds()
+			step.ResultBytes = len(event.Output)
+			step.IsError = event.IsError
+		}
+	}
+}
+
+func (t *timeline) dropOldest() {
+	t.steps = slices.Delete(t.steps, 0, 1)
+	for id, i := range t.pending {
+		if i == 0 {
+			delete(t.pending, id)
+		} else {
+			t.pending[id] = i - 1
+		}
+	}
+}
+
+// snapshot returns a copy of the steps, with running calls' durations so far.
+func (t *timeline) snapshot(now time.Time) []history.TimelineStep {
+	if len(t.steps) == 0 {
+		return nil
+	}
+	steps := slices.Clone(t.steps)
+	for i := range steps {
+		if !steps[i].Done {
+			steps[i].DurationMS = now.Sub(steps[i].StartedAt).Milliseconds()
+		}
+	}
+	return steps
+}
+
+// timelineTarget picks what a tool call acts on from its input.
+func timelineTarget(input map[string]any) string {
+	for _, key := range timelineTargetKeys {
+		if s, ok := input[key].(string); ok && s != "" {
+			if utf8.RuneCountInString(s) > maxTimelineTarget {
+				s = string([]rune(s)[:maxTimelineTarget-1]) + "…"
+			}
+			return s
+		}
+	}
+	return ""
+}
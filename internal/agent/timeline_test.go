@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/config"
+	"phobos.org.uk/agency/internal/history"
+	"phobos.org.uk/agency/internal/stream"
+)
+
+func TestTimeline(t *testing.T) {
+	t.Parallel()
+
+	start := time.Now()
+	var tl timeline
+	require.Nil(t, tl.snapshot(start))
+
+	tl.add([]*stream.ToolEvent{
+		{Type: stream.EventToolCall, Timestamp: start, ToolName: "Read", ToolID: "t1", Input: map[string]any{"file_path": "/src/main.go"}},
+		{Type: stream.EventToolCall, Timestamp: start, ToolName: "Bash", ToolID: "t2", Input: map[string]any{"command": strings.Repeat("x", 200)}},
+		{Type: stream.EventTextResponse, Timestamp: start, TextLength: 10},
+	})
+	tl.add([]*stream.ToolEvent{
+		{Type: stream.EventToolResult, Timestamp: start.Add(1500 * time.Millisecond), ToolID: "t1", Output: "package main"},
+		{Type: stream.EventToolResult, Timestamp: start, ToolID: "unknown"},
+	})
+
+	steps := tl.snapshot(start.Add(3 * time.Second))
+	require.Len(t, steps, 2)
+	require.Equal(t, history.TimelineStep{
+		Tool: "Read", Target: "/src/main.go", StartedAt: start, Done: true, DurationMS: 1500, ResultBytes: 12,
+	}, steps[0])
+	require.Equal(t, "Bash", steps[1].Tool)
+	require.Len(t, []rune(steps[1].Target), maxTimelineTarget)
+	require.False(t, steps[1].Done)
+	require.Equal(t, int64(3000), steps[1].DurationMS, "running calls report their time so far")
+	require.Zero(t, tl.steps[1].DurationMS, "snapshots don't change the timeline")
+
+	// Old steps make way for new ones; results still find their call
+	for i := range maxTimelineSteps {
+		tl.add([]*stream.ToolEvent{{Type: stream.EventToolCall, Timestamp: start, ToolName: "Grep", ToolID: fmt.Sprintf("g%d", i)}})
+	}
+	tl.add([]*stream.ToolEvent{{Type: stream.EventToolResult, Timestamp: start, ToolID: "g499", IsError: true}})
+	steps = tl.snapshot(start)
+	require.Len(t, steps, maxTimelineSteps)
+	require.Equal(t, "Grep", steps[0].Tool)
+	require.True(t, steps[len(steps)-1].Done)
+	require.True(t, steps[len(steps)-1].IsError)
+	require.NotContains(t, tl.pending, "t2", "dropped calls are forgotten")
+}
+
+func TestTaskTimeline(t *testing.T) {
+	// Cannot use t.Parallel() with t.Setenv()
+	tmpDir := t.TempDir()
+	mockPath := filepath.Join(tmpDir, "mock-claude-tools")
+	script := `#!/bin/bash
+echo '{"type":"assistant","message":{"content":[{"type":"tool_use","id":"toolu_1","name":"Read","input":{"file_path":"go.mod"}}]}}'
+echo '{"type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"module example"}]}}'
+echo '{"type":"assistant","message":{"content":[{"type":"tool_use","id":"toolu_2","name":"Bash","input":{"command":"go test ./..."}}]}}'
+sleep 1
+echo '{"type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"toolu_2","content":"ok"}]}}'
+echo '{"type":"result","subtype":"success","result":"done"}'
+`
+	require.NoError(t, os.WriteFile(mockPath, []byte(script), 0755))
+	t.Setenv("CLAUDE_BIN", mockPath)
+
+	promptsDir := filepath.Join(tmpDir, "prompts")
+	require.NoError(t, os.MkdirAll(promptsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "claude-prod.md"), []byte("# Test Instructions"), 0644))
+
+	cfg := config.Default()
+	cfg.SessionDir = filepath.Join(tmpDir, "sessions")
+	cfg.HistoryDir = filepath.Join(tmpDir, "history")
+	cfg.AgencyPromptsDir = promptsDir
+	a := New(cfg, "test")
+
+	req := httptest.NewRequest("POST", "/task", strings.NewReader(`{"prompt": "tools"}`))
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp struct {
+		TaskID string `json:"task_id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	// While the second call runs, the task reports both
+	require.Eventually(t, func() bool {
+		w := httptest.NewRecorder()
+		a.Router().ServeHTTP(w, httptest.NewRequest("GET", "/task/"+resp.TaskID, nil))
+		var status struct {
+			State    string                 `json:"state"`
+			Timeline []history.TimelineStep `json:"timeline"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &status)
+		return status.State == "working" && len(status.Timeline) == 2 &&
+			status.Timeline[0].Done && !status.Timeline[1].Done && status.Timeline[1].Target == "go test ./..."
+	}, 2*time.Second, 20*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		_, err := a.history.Get(resp.TaskID)
+		return err == nil
+	}, 5*time.Second, 20*time.Millisecond)
+	entry, err := a.history.Get(resp.TaskID)
+	require.NoError(t, err)
+	require.Len(t, entry.Timeline, 2)
+	require.Equal(t, "Read", entry.Timeline[0].Tool)
+	require.Equal(t, "go.mod", entry.Timeline[0].Target)
+	require.Equal(t, len("module example"), entry.Timeline[0].ResultBytes)
+	require.True(t, entry.Timeline[1].Done)
+	require.GreaterOrEqual(t, entry.Timeline[1].DurationMS, int64(900))
+}
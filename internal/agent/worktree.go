@@ -0,0 +1,108 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// worktreeBaseRef marks the state of a session's clone before its latest
+// task: the commit it was cloned at, then the tree left by each task. Diffs
+// against it include both commits made by the task and uncommitted changes,
+// and nothing from the session's earlier tasks.
+const worktreeBaseRef = "refs/agency/base"
+
+const gitTimeout = 2 * time.Minute
+
+// prepareWorktree clones the configured repository into workDir and records
+// the starting commit for later diffing.
+func (a *Agent) prepareWorktree(workDir string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+
+	args := []string{"clone", "--quiet"}
+	if ref := a.cfg().Worktree.Ref; ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	args = append(args, "--", a.cfg().Worktree.Repo, workDir)
+	if _, err := runGit(ctx, "", args...); err != nil {
+		return err
+	}
+
+	_, err := runGit(ctx, workDir, "update-ref", worktreeBaseRef, "HEAD")
+	return err
+}
+
+// captureWorktreeDiff records the patch produced by a task in worktree mode.
+// Returns the diff, or "" if worktree mode is disabled or the diff failed.
+func (a *Agent) captureWorktreeDiff(task *Task) string {
+	if a.cfg().Worktree.Repo == "" {
+		return ""
+	}
+
+	a.mu.RLock()
+	workDir := filepath.Join(a.cfg().SessionDir, task.WorkDir)
+	a.mu.RUnlock()
+
+	diff, err := worktreeDiff(workDir)
+	if err != nil {
+		a.taskLog(task).Warn("failed to capture worktree diff", map[string]any{
+			"error": err.Error(),
+		})
+		return ""
+	}
+
+	if err := advanceWorktreeBase(workDir); err != nil {
+		a.taskLog(task).Warn("failed to advance worktree diff base", map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	a.mu.Lock()
+	task.Diff = diff
+	a.mu.Unlock()
+	return diff
+}
+
+// worktreeDiff returns all changes in workDir relative to the session's base.
+func worktreeDiff(workDir string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+
+	// Stage everything so new files appear in the diff. The clone is private
+	// to the session, so touching its index is harmless.
+	if _, err := runGit(ctx, workDir, "add", "--all"); err != nil {
+		return "", err
+	}
+	return runGit(ctx, workDir, "diff", "--cached", "--binary", worktreeBaseRef)
+}
+
+// advanceWorktreeBase points the base at the tree staged by worktreeDiff, so
+// the next task in the session is diffed against what this one left.
+func advanceWorktreeBase(workDir string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+
+	tree, err := runGit(ctx, workDir, "write-tree")
+	if err != nil {
+		return err
+	}
+	_, err = runGit(ctx, workDir, "update-ref", worktreeBaseRef, strings.TrimSpace(tree))
+	return err
+}
+
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,173 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/config"
+)
+
+func initTestRepo(t *testing.T, dir string) {
+	t.Helper()
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"config", "user.email", "test@example.com"},
+		{"config", "user.name", "Test"},
+		{"add", "README.md"},
+		{"commit", "--quiet", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+}
+
+func TestWorktreeModeCapturesDiff(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	tmpDir := t.TempDir()
+
+	repoDir := filepath.Join(tmpDir, "repo")
+	require.NoError(t, os.MkdirAll(repoDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "README.md"), []byte("hello\n"), 0644))
+	initTestRepo(t, repoDir)
+
+	// Mock CLI that edits a tracked file and adds a new one
+	mockPath := filepath.Join(tmpDir, "mock-claude-edit")
+	script := `#!/bin/bash
+echo "world" >> README.md
+echo "new" > added.txt
+echo '{"type":"result","subtype":"success","result":"edited"}'
+`
+	require.NoError(t, os.WriteFile(mockPath, []byte(script), 0755))
+	t.Setenv("CLAUDE_BIN", mockPath)
+
+	promptsDir := filepath.Join(tmpDir, "prompts")
+	require.NoError(t, os.MkdirAll(promptsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "claude-prod.md"), []byte("# Test Instructions"), 0644))
+
+	cfg := config.Default()
+	cfg.SessionDir = filepath.Join(tmpDir, "sessions")
+	cfg.HistoryDir = filepath.Join(tmpDir, "history")
+	cfg.AgencyPromptsDir = promptsDir
+	cfg.Worktree.Repo = repoDir
+	a := New(cfg, "test")
+
+	req := httptest.NewRequest("POST", "/task", strings.NewReader(`{"prompt": "edit"}`))
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var resp struct {
+		TaskID string `json:"task_id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	require.Eventually(t, func() bool {
+		entry, err := a.history.Get(resp.TaskID)
+		return err == nil && entry.HasDiff
+	}, 5*time.Second, 50*time.Millisecond)
+
+	entry, err := a.history.Get(resp.TaskID)
+	require.NoError(t, err)
+	require.Equal(t, string(TaskStateCompleted), entry.State)
+
+	req = httptest.NewRequest("GET", "/task/"+resp.TaskID+"/diff", nil)
+	w = httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Header().Get("Content-Type"), "text/x-diff")
+	require.Contains(t, w.Body.String(), "+world")
+	require.Contains(t, w.Body.String(), "added.txt")
+
+	// Source repository is untouched
+	data, err := os.ReadFile(filepath.Join(repoDir, "README.md"))
+	require.NoError(t, err)
+	require.Equal(t, "hello\n", string(data))
+}
+
+func TestTaskDiffNotFound(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.HistoryDir = ""
+	a := New(cfg, "test")
+
+	req := httptest.NewRequest("GET", "/task/task-missing/diff", nil)
+	w := httptest.NewRecorder()
+	a.Router().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Contains(t, w.Body.String(), "not_found")
+}
+
+func TestWorktreeDiffIsPerTask(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	tmpDir := t.TempDir()
+	repoDir := filepath.Join(tmpDir, "repo")
+	require.NoError(t, os.MkdirAll(repoDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "README.md"), []byte("hello\n"), 0644))
+	initTestRepo(t, repoDir)
+
+	// Mock CLI that adds a numbered file on each run, committing the first
+	mockPath := filepath.Join(tmpDir, "mock-claude-numbered")
+	script := `#!/bin/bash
+n=$(ls task-*.txt 2>/dev/null | wc -l)
+echo "run $n" > task-$n.txt
+if [ "$n" = 0 ]; then git add task-0.txt && git -c user.email=t@example.com -c user.name=T commit --quiet -m first; fi
+echo '{"type":"result","subtype":"success","result":"done"}'
+`
+	require.NoError(t, os.WriteFile(mockPath, []byte(script), 0755))
+	t.Setenv("CLAUDE_BIN", mockPath)
+
+	promptsDir := filepath.Join(tmpDir, "prompts")
+	require.NoError(t, os.MkdirAll(promptsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(promptsDir, "claude-prod.md"), []byte("# Test Instructions"), 0644))
+
+	cfg := config.Default()
+	cfg.SessionDir = filepath.Join(tmpDir, "sessions")
+	cfg.HistoryDir = filepath.Join(tmpDir, "history")
+	cfg.AgencyPromptsDir = promptsDir
+	cfg.Worktree.Repo = repoDir
+	a := New(cfg, "test")
+
+	runTask := func(body string) (taskID, sessionID, diff string) {
+		w := httptest.NewRecorder()
+		a.Router().ServeHTTP(w, httptest.NewRequest("POST", "/task", strings.NewReader(body)))
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var resp struct {
+			TaskID    string `json:"task_id"`
+			SessionID string `json:"session_id"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Eventually(t, func() bool {
+			entry, err := a.history.Get(resp.TaskID)
+			return err == nil && entry.HasDiff
+		}, 5*time.Second, 50*time.Millisecond)
+		w = httptest.NewRecorder()
+		a.Router().ServeHTTP(w, httptest.NewRequest("GET", "/task/"+resp.TaskID+"/diff", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		return resp.TaskID, resp.SessionID, w.Body.String()
+	}
+
+	_, sessionID, first := runTask(`{"prompt": "one"}`)
+	require.Contains(t, first, "task-0.txt")
+
+	_, _, second := runTask(`{"prompt": "two", "session_id": "` + sessionID + `"}`)
+	require.Contains(t, second, "task-1.txt")
+	require.NotContains(t, second, "task-0.txt", "earlier tasks' changes are left out")
+}
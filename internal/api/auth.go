@@ -0,0 +1,67 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// AuthTokenEnv names the environment variable holding the shared bearer token
+// used when a component's auth_token setting is empty.
+const AuthTokenEnv = "AG_AUTH_TOKEN"
+
+// RequireAuthToken returns middleware that rejects mutating requests (anything
+// but GET, HEAD and OPTIONS) unless they carry "Authorization: Bearer <token>".
+// An empty token disables the check.
+func RequireAuthToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if token == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+			given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				WriteError(w, http.StatusUnauthorized, ErrorUnauthorized, "missing or invalid bearer token")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// WithAuthToken returns a copy of client that sends token as a bearer token
+// on every request that has no Authorization header of its own. An empty
+// token returns client unchanged.
+func WithAuthToken(client *http.Client, token string) *http.Client {
+	if token == "" {
+		return client
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	authed := *client
+	authed.Transport = &bearerTransport{base: base, token: token}
+	return &authed
+}
+
+// bearerTransport adds a bearer token to outgoing requests.
+type bearerTransport struct {
+	base  http.RoundTripper
+	token string
+}
+
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" {
+		return t.base.RoundTrip(req)
+	}
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,40 @@
+package api
+
+import "net/http"
+
+// ReadinessCheck is one condition a component must meet before it is ready
+// for traffic. Check returns nil when the condition holds.
+type ReadinessCheck struct {
+	Name  string
+	Check func() error
+}
+
+// HealthResponse is the body of /healthz and /readyz.
+type HealthResponse struct {
+	Status string            `json:"status"`           // ok, ready or not_ready
+	Checks map[string]string `json:"checks,omitempty"` // Readiness check name to "ok" or the failure
+}
+
+// HandleHealthz reports liveness: the process is up and serving HTTP.
+func HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// ReadyzHandler returns a handler reporting readiness. It runs every check
+// and responds 200 if all pass, else 503, listing each check's result.
+func ReadyzHandler(checks ...ReadinessCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := HealthResponse{Status: "ready", Checks: make(map[string]string, len(checks))}
+		status := http.StatusOK
+		for _, c := range checks {
+			if err := c.Check(); err != nil {
+				resp.Checks[c.Name] = err.Error()
+				resp.Status = "not_ready"
+				status = http.StatusServiceUnavailable
+				continue
+			}
+			resp.Checks[c.Name] = "ok"
+		}
+		WriteJSON(w, status, resp)
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the ID that ties together a task's requests, queue
+// entry, agent task, history entry and log entries across components.
+const RequestIDHeader = "X-Agency-Request-ID"
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:-]{0,127}$`)
+
+// NewRequestID returns a fresh request ID.
+func NewRequestID() string {
+	return "req-" + uuid.New().String()
+}
+
+// ValidRequestID reports whether id is acceptable as a request ID: up to 128
+// letters, digits, dots, underscores, colons and hyphens.
+func ValidRequestID(id string) bool {
+	return requestIDPattern.MatchString(id)
+}
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying a request ID.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID set by RequestID, or "".
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestID is middleware that adopts a valid X-Agency-Request-ID from the
+// caller, or generates one when the request is the first to reach a
+// component, and makes it available through RequestIDFromContext. The ID is
+// echoed in the response header.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !ValidRequestID(id) {
+			id = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(ContextWithRequestID(r.Context(), id)))
+	})
+}
+
+// WithRequestID returns a copy of client that sends id as the request ID on
+// every request that has none of its own. An empty id returns client
+// unchanged.
+func WithRequestID(client *http.Client, id string) *http.Client {
+	if id == "" {
+		return client
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	tagged := *client
+	tagged.Transport = &requestIDTransport{base: base, id: id}
+	return &tagged
+}
+
+// requestIDTransport adds a request ID to outgoing requests.
+type requestIDTransport struct {
+	base http.RoundTripper
+	id   string
+}
+
+func (t *requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get(RequestIDHeader) != "" {
+		return t.base.RoundTrip(req)
+	}
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(req.Context())
+	req.Header.Set(RequestIDHeader, t.id)
+	return t.base.RoundTrip(req)
+}
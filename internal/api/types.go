@@ -1,6 +1,8 @@
 // Package api defines shared types and constants for the agency framework.
 package api
 
+import "slices"
+
 // Component types identify the kind of component.
 const (
 	TypeAgent    = "agent"
@@ -30,10 +32,48 @@ const (
 	InterfaceConfigurable = "configurable"
 )
 
+// APIVersion is the version of the HTTP API a component reports in /status.
+// It is raised only for changes that existing clients can't ignore; new
+// features are announced as capabilities instead. Components that report no
+// version predate versioning.
+const APIVersion = 1
+
+// Capabilities name optional features a component reports in /status, so
+// clients can check for a feature before relying on it and fall back when an
+// older component lacks it.
+const (
+	CapabilityA2A               = "a2a"                // Agent: A2A endpoint at /a2a
+	CapabilityArtifacts         = "artifacts"          // Agent: files a task produced, under /history/{id}/artifacts
+	CapabilityAttachments       = "attachments"        // Agent: files sent with a task
+	CapabilityCallbacks         = "callbacks"          // Web view: queued tasks POST their result to callback_url
+	CapabilityCompare           = "compare"            // Web view: one prompt run on several agent kinds
+	CapabilityIdempotency       = "idempotency"        // Web view: repeated idempotency_key submissions return the first task
+	CapabilityLiveOutput        = "live-output"        // Agent: GET /task/{id} reports output while the task runs
+	CapabilityRequestID         = "request-id"         // X-Agency-Request-ID is adopted, forwarded and logged
+	CapabilityScheduledDispatch = "scheduled-dispatch" // Web view: queued tasks may set run_at or hold
+	CapabilitySSE               = "sse"                // Task logs stream as server-sent events at /logs/stream
+	CapabilityTimeline          = "timeline"           // Agent: task status and history include a tool-call timeline
+
+	CapabilityAnnotations   = "annotations"    // Agent: PATCH /history/{id} rates, notes and tags finished tasks
+	CapabilityHistoryExport = "history-export" // Agent: GET /history/export streams history as JSONL or CSV
+	CapabilityPrompts       = "prompts"        // Agent: agency prompt files can be listed and edited at /prompts
+	CapabilityRerun         = "rerun"          // Agent: finished tasks can be run again at /history/{id}/rerun
+	CapabilityRestore       = "restore"        // Agent: POST /admin/restore rehydrates history and sessions from a backup
+	CapabilityRunnerOptions = "runner-options" // Agent: tasks accept max_turns, permission_mode and allowed_tools
+	CapabilityTaskEnv       = "task-env"       // Agent: tasks accept env
+)
+
+// HasCapability reports whether capabilities, as reported in /status,
+// include capability.
+func HasCapability(capabilities []string, capability string) bool {
+	return slices.Contains(capabilities, capability)
+}
+
 // Error codes for consistent API error responses.
 const (
 	// Agent errors
 	ErrorAgentBusy        = "agent_busy"
+	ErrorAgentDraining    = "agent_draining"
 	ErrorAlreadyCompleted = "already_completed"
 	ErrorTaskInProgress   = "task_in_progress"
 
@@ -43,9 +83,14 @@ const (
 
 	// State errors
 	ErrorJobAlreadyRunning = "job_already_running"
+	ErrorJobExists         = "job_exists"
+	ErrorJobReadOnly       = "job_read_only"
+	ErrorJobSuspended      = "job_suspended"
+	ErrorJobNotSuspended   = "job_not_suspended"
 
 	// Auth errors
 	ErrorUnauthorized = "unauthorized"
+	ErrorForbidden    = "forbidden"
 
 	// Validation errors
 	ErrorValidation        = "validation_error"
@@ -56,11 +101,21 @@ const (
 	ErrorAgentError = "agent_error"
 
 	// Queue errors
-	ErrorQueueFull  = "queue_full"
-	ErrorQueueError = "queue_error"
+	ErrorQueueFull               = "queue_full"
+	ErrorQueueError              = "queue_error"
+	ErrorSessionAgentUnavailable = "session_agent_unavailable"
+	ErrorSessionChanged          = "session_changed"
+	ErrorTaskNotPending          = "task_not_pending"
+	ErrorTaskNotHeld             = "task_not_held"
 
 	// Generic errors
 	ErrorReadError = "read_error"
+
+	// Config errors
+	ErrorConfigError = "config_error" // An agent couldn't save or reload its config file or prompts
+
+	// Capability errors
+	ErrorNotSupported = "not_supported" // The component lacks a capability the request needs
 )
 
 // ProjectContext provides project-specific instructions prepended to task prompts.
@@ -88,3 +143,31 @@ func IsValidAgentKind(kind string) bool {
 		return false
 	}
 }
+
+// RunnerOptions are optional per-task overrides for the agent's CLI runner.
+// Agents validate them against their configured task_options bounds.
+type RunnerOptions struct {
+	MaxTurns       int      `json:"max_turns,omitempty"`       // Claude only; at most task_options.max_turns_limit
+	PermissionMode string   `json:"permission_mode,omitempty"` // Claude permission mode or Codex sandbox mode
+	AllowedTools   []string `json:"allowed_tools,omitempty"`   // Claude only; restricts the tools a task may use
+}
+
+// Attachment is a file sent with a task, written into the session workdir
+// before the CLI runs. Data is base64 in JSON.
+type Attachment struct {
+	Name string `json:"name"` // File name without directories
+	Data []byte `json:"data"`
+}
+
+// IsZero reports whether no overrides are set.
+func (o RunnerOptions) IsZero() bool {
+	return o.MaxTurns == 0 && o.PermissionMode == "" && len(o.AllowedTools) == 0
+}
+
+// Environment variables the web view gives each queued task so it can spawn
+// subtasks. Agents pass them through regardless of their env allowlist.
+const (
+	EnvDirectorURL  = "AGENCY_DIRECTOR_URL"
+	EnvQueueID      = "AGENCY_QUEUE_ID"
+	EnvSubtaskToken = "AGENCY_SUBTASK_TOKEN"
+)
@@ -0,0 +1,134 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// ManifestName is the archive entry describing the backup.
+const ManifestName = "manifest.json"
+
+// Source is something put in a backup archive: either a directory, archived
+// recursively under Name, or a file Name with generated content.
+type Source struct {
+	Name     string                 // Path inside the archive, e.g. history or auth-store.json
+	Dir      string                 // Directory to archive (missing = skipped)
+	Snapshot func() ([]byte, error) // Content of the file Name, used instead of Dir
+
+	// Skip reports whether to leave out a path under Dir, given relative to
+	// it with slashes, and everything beneath it (optional)
+	Skip func(rel string) bool
+}
+
+// Manifest is written first in every archive.
+type Manifest struct {
+	Prefix    string    `json:"prefix"`  // Component the backup is of, e.g. agent-dev-claude
+	Version   string    `json:"version"` // Version of the component that wrote it
+	CreatedAt time.Time `json:"created_at"`
+	Sources   []string  `json:"sources"` // Names of the sources included
+}
+
+// WriteArchive writes a gzipped tar of the manifest and sources to w.
+func WriteArchive(w io.Writer, manifest Manifest, sources []Source) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifest.Sources = manifest.Sources[:0]
+	for _, src := range sources {
+		manifest.Sources = append(manifest.Sources, src.Name)
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFile(tw, ManifestName, data, 0600, manifest.CreatedAt); err != nil {
+		return err
+	}
+
+	for _, src := range sources {
+		if src.Snapshot != nil {
+			data, err := src.Snapshot()
+			if err != nil {
+				return fmt.Errorf("snapshotting %s: %w", src.Name, err)
+			}
+			if err := writeFile(tw, src.Name, data, 0600, manifest.CreatedAt); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := writeDir(tw, src); err != nil {
+			return fmt.Errorf("archiving %s: %w", src.Name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func writeFile(tw *tar.Writer, name string, data []byte, mode fs.FileMode, modTime time.Time) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    int64(mode.Perm()),
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// writeDir adds the regular files under src.Dir to the archive beneath
+// src.Name, keeping their permissions. Files removed while the walk runs,
+// e.g. pruned history, are skipped.
+func writeDir(tw *tar.Writer, src Source) error {
+	err := filepath.WalkDir(src.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(src.Dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." && src.Skip != nil && src.Skip(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		// Read whole, as history rewrites files in place
+		info, err := d.Info()
+		if err == nil {
+			var data []byte
+			if data, err = os.ReadFile(p); err == nil {
+				return writeFile(tw, path.Join(src.Name, rel), data, info.Mode(), info.ModTime())
+			}
+		}
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,234 @@
+// Package backup periodically archives a component's state as a gzipped tar
+// to a local directory or an S3-compatible bucket, keeping the newest few.
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults
+const (
+	DefaultInterval = 24 * time.Hour
+	DefaultRetain   = 7
+)
+
+// archiveTimeFormat stamps archive names, which sort in time order.
+const archiveTimeFormat = "20060102T150405Z"
+
+// Options configures a Runner.
+type Options struct {
+	Destination string        // Absolute directory, or s3://bucket/prefix
+	Endpoint    string        // S3-compatible endpoint URL (default: AWS for Region)
+	Region      string        // S3 region (default: DefaultRegion)
+	Interval    time.Duration // Time between backups (default: DefaultInterval)
+	Retain      int           // Archives kept (default: DefaultRetain)
+	Prefix      string        // Archive name prefix, e.g. agent-dev-claude
+	Version     string        // Written to the manifest
+
+	// S3 credentials (default: AccessKeyEnv, SecretKeyEnv and SessionTokenEnv)
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// Called after each backup attempt with the status, e.g. to log it (optional)
+	OnResult func(Status)
+}
+
+// Status reports the most recent backups, for /status.
+type Status struct {
+	Destination   string     `json:"destination"`
+	LastBackupAt  *time.Time `json:"last_backup_at,omitempty"` // Last successful backup
+	LastArchive   string     `json:"last_archive,omitempty"`
+	LastSizeBytes int64      `json:"last_size_bytes,omitempty"`
+	LastError     string     `json:"last_error,omitempty"` // Set while the latest attempt has failed
+	LastErrorAt   *time.Time `json:"last_error_at,omitempty"`
+	NextBackupAt  *time.Time `json:"next_backup_at,omitempty"`
+}
+
+// Runner makes backups of its sources every interval.
+type Runner struct {
+	opts    Options
+	sources []Source
+	target  target
+
+	mu       sync.Mutex // Held for the duration of a backup
+	statusMu sync.Mutex
+	status   Status
+}
+
+// New validates opts and returns a Runner for sources.
+func New(opts Options, sources []Source) (*Runner, error) {
+	if opts.Interval < 0 {
+		return nil, fmt.Errorf("backup interval must not be negative")
+	}
+	if opts.Retain < 0 {
+		return nil, fmt.Errorf("backup retain must not be negative")
+	}
+	if opts.Interval == 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Retain == 0 {
+		opts.Retain = DefaultRetain
+	}
+	if opts.Prefix == "" || strings.ContainsAny(opts.Prefix, "/\\") {
+		return nil, fmt.Errorf("backup prefix must be a non-empty name, got %q", opts.Prefix)
+	}
+	t, err := newTarget(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Runner{
+		opts:    opts,
+		sources: sources,
+		target:  t,
+		status:  Status{Destination: opts.Destination},
+	}, nil
+}
+
+// Status returns the latest backup status.
+func (r *Runner) Status() Status {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	return r.status
+}
+
+// Run makes a backup every interval until ctx is cancelled. The first is
+// due an interval after the newest archive already at the destination, so
+// restarts don't delay or repeat backups.
+func (r *Runner) Run(ctx context.Context) {
+	next := time.Now()
+	if names, err := r.archives(ctx); err == nil && len(names) > 0 {
+		if last, ok := r.archiveTime(names[len(names)-1]); ok {
+			next = last.Add(r.opts.Interval)
+		}
+	}
+	for {
+		r.setNext(next)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+
+		r.Backup(ctx)
+		next = time.Now().Add(r.opts.Interval)
+	}
+}
+
+// Backup makes a backup now and prunes old archives, returning the archive
+// name.
+func (r *Runner) Backup(ctx context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	name, size, err := r.backup(ctx, now)
+	if err == nil {
+		err = r.prune(ctx)
+	}
+
+	r.statusMu.Lock()
+	if name != "" {
+		r.status.LastBackupAt = &now
+		r.status.LastArchive = name
+		r.status.LastSizeBytes = size
+	}
+	r.status.LastError, r.status.LastErrorAt = "", nil
+	if err != nil {
+		r.status.LastError, r.status.LastErrorAt = err.Error(), &now
+	}
+	status := r.status
+	r.statusMu.Unlock()
+
+	if r.opts.OnResult != nil {
+		r.opts.OnResult(status)
+	}
+	return name, err
+}
+
+// backup writes an archive and stores it, returning its name and size.
+// The name is empty if it wasn't stored.
+func (r *Runner) backup(ctx context.Context, now time.Time) (string, int64, error) {
+	f, err := os.CreateTemp(r.target.tempDir(), ".backup-*.tmp")
+	if err != nil {
+		return "", 0, fmt.Errorf("creating archive: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	hash := sha256.New()
+	manifest := Manifest{Prefix: r.opts.Prefix, Version: r.opts.Version, CreatedAt: now}
+	if err := WriteArchive(io.MultiWriter(f, hash), manifest, r.sources); err != nil {
+		return "", 0, fmt.Errorf("writing archive: %w", err)
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", 0, err
+	}
+
+	name := r.opts.Prefix + "-" + now.Format(archiveTimeFormat) + ".tar.gz"
+	if err := r.target.put(ctx, name, f, size, hex.EncodeToString(hash.Sum(nil))); err != nil {
+		return "", 0, fmt.Errorf("storing %s: %w", name, err)
+	}
+	return name, size, nil
+}
+
+// prune removes all but the newest Retain archives.
+func (r *Runner) prune(ctx context.Context) error {
+	names, err := r.archives(ctx)
+	if err != nil {
+		return fmt.Errorf("listing archives: %w", err)
+	}
+	for len(names) > r.opts.Retain {
+		if err := r.target.remove(ctx, names[0]); err != nil {
+			return fmt.Errorf("removing %s: %w", names[0], err)
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// archives returns the names of this runner's archives, oldest first.
+// Archives with other prefixes sharing the destination are left alone.
+func (r *Runner) archives(ctx context.Context) ([]string, error) {
+	all, err := r.target.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range all {
+		if _, ok := r.archiveTime(name); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// archiveTime parses the time from one of this runner's archive names.
+func (r *Runner) archiveTime(name string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(name, r.opts.Prefix+"-")
+	if !ok {
+		return time.Time{}, false
+	}
+	if stamp, ok = strings.CutSuffix(stamp, ".tar.gz"); !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(archiveTimeFormat, stamp)
+	return t, err == nil
+}
+
+func (r *Runner) setNext(next time.Time) {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	r.status.NextBackupAt = &next
+}
@@ -0,0 +1,151 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// readArchive returns the files in a gzipped tar by name.
+func readArchive(t *testing.T, path string) map[string]string {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	files := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[hdr.Name] = string(data)
+	}
+}
+
+func TestRunner_Backup(t *testing.T) {
+	t.Parallel()
+
+	historyDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(historyDir, "outlines"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(historyDir, "outlines", "task-1.json"), []byte(`{"task_id":"task-1"}`), 0600))
+
+	dest := filepath.Join(t.TempDir(), "backups")
+	var results []Status
+	r, err := New(Options{
+		Destination: dest,
+		Retain:      2,
+		Prefix:      "agent-dev-claude",
+		Version:     "1.2.3",
+		OnResult:    func(s Status) { results = append(results, s) },
+	}, []Source{
+		{Name: "history", Dir: historyDir},
+		{Name: "missing", Dir: filepath.Join(historyDir, "nope")},
+		{Name: "sessions.json", Snapshot: func() ([]byte, error) { return []byte(`[]`), nil }},
+	})
+	require.NoError(t, err)
+
+	name, err := r.Backup(context.Background())
+	require.NoError(t, err)
+	require.Regexp(t, `^agent-dev-claude-\d{8}T\d{6}Z\.tar\.gz$`, name)
+
+	files := readArchive(t, filepath.Join(dest, name))
+	require.Equal(t, `{"task_id":"task-1"}`, files["history/outlines/task-1.json"])
+	require.Equal(t, `[]`, files["sessions.json"])
+	var manifest Manifest
+	require.NoError(t, json.Unmarshal([]byte(files[ManifestName]), &manifest))
+	require.Equal(t, "agent-dev-claude", manifest.Prefix)
+	require.Equal(t, "1.2.3", manifest.Version)
+	require.Equal(t, []string{"history", "missing", "sessions.json"}, manifest.Sources)
+
+	status := r.Status()
+	require.Equal(t, dest, status.Destination)
+	require.Equal(t, name, status.LastArchive)
+	require.NotNil(t, status.LastBackupAt)
+	require.Positive(t, status.LastSizeBytes)
+	require.Empty(t, status.LastError)
+	require.Len(t, results, 1)
+
+	// Only the newest archives of this prefix are kept
+	for _, old := range []string{"agent-dev-claude-20200101T000000Z.tar.gz", "agent-dev-claude-20200102T000000Z.tar.gz", "web-20200101T000000Z.tar.gz", "notes.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dest, old), nil, 0600))
+	}
+	_, err = r.Backup(context.Background())
+	require.NoError(t, err)
+	entries, err := os.ReadDir(dest)
+	require.NoError(t, err)
+	var left []string
+	for _, e := range entries {
+		left = append(left, e.Name())
+	}
+	require.Len(t, left, 4)
+	require.Contains(t, left, "agent-dev-claude-20200102T000000Z.tar.gz")
+	require.NotContains(t, left, "agent-dev-claude-20200101T000000Z.tar.gz")
+	require.Contains(t, left, "web-20200101T000000Z.tar.gz")
+	require.Contains(t, left, "notes.txt")
+
+	// A failed backup is reported but keeps the last good one
+	r.sources = append(r.sources, Source{Name: "broken", Snapshot: func() ([]byte, error) { return nil, errors.New("store closed") }})
+	_, err = r.Backup(context.Background())
+	require.ErrorContains(t, err, "store closed")
+	status = r.Status()
+	require.Contains(t, status.LastError, "store closed")
+	require.NotNil(t, status.LastErrorAt)
+	require.NotEmpty(t, status.LastArchive)
+	require.Len(t, results, 3)
+}
+
+func TestRunner_RunSchedulesFromNewestArchive(t *testing.T) {
+	t.Parallel()
+
+	dest := t.TempDir()
+	last := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, os.WriteFile(filepath.Join(dest, "web-"+last.Format(archiveTimeFormat)+".tar.gz"), nil, 0600))
+	r, err := New(Options{Destination: dest, Interval: 6 * time.Hour, Prefix: "web"}, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return r.Status().NextBackupAt != nil }, time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+	require.True(t, r.Status().NextBackupAt.Equal(last.Add(6*time.Hour)))
+	require.Nil(t, r.Status().LastBackupAt)
+}
+
+func TestNew_Validation(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, opts := range []Options{
+		{Destination: "relative/path", Prefix: "web"},
+		{Destination: "ftp://host/path", Prefix: "web"},
+		{Destination: "s3://", Prefix: "web"},
+		{Destination: dir, Prefix: ""},
+		{Destination: dir, Prefix: "a/b"},
+		{Destination: dir, Prefix: "web", Interval: -time.Hour},
+		{Destination: dir, Prefix: "web", Retain: -1},
+		{Destination: "s3://bucket/prefix", Prefix: "web", Endpoint: "ftp://minio", AccessKeyID: "a", SecretAccessKey: "b"},
+	} {
+		_, err := New(opts, nil)
+		require.Error(t, err, "%+v", opts)
+	}
+}
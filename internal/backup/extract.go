@@ -0,0 +1,85 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrTooLarge is returned by Extract when the archive's files exceed the
+// size limit.
+var ErrTooLarge = errors.New("backup archive too large")
+
+// Extract unpacks an archive written by WriteArchive into dir, returning its
+// manifest. Only regular files are extracted, with the owner always able to
+// read and write them; entries escaping dir are rejected. maxBytes limits the
+// total size of the files (0 = no limit).
+func Extract(r io.Reader, dir string, maxBytes int64) (Manifest, error) {
+	var manifest Manifest
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return manifest, fmt.Errorf("not a gzipped archive: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	var total int64
+	found := false
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, fmt.Errorf("reading archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || name == "." || name == ".." || strings.HasPrefix(name, "../") {
+			return manifest, fmt.Errorf("unsafe path in archive: %q", hdr.Name)
+		}
+		total += hdr.Size
+		if maxBytes > 0 && total > maxBytes {
+			return manifest, ErrTooLarge
+		}
+
+		if name == ManifestName {
+			if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+				return manifest, fmt.Errorf("reading manifest: %w", err)
+			}
+			found = true
+			continue
+		}
+		if err := extractFile(tr, filepath.Join(dir, filepath.FromSlash(name)), fs.FileMode(hdr.Mode).Perm()|0600); err != nil {
+			return manifest, err
+		}
+	}
+	if !found {
+		return manifest, fmt.Errorf("not a backup archive: no %s", ManifestName)
+	}
+	return manifest, nil
+}
+
+func extractFile(r io.Reader, dest string, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,82 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// tarGz builds a gzipped tar of the given files.
+func tarGz(t *testing.T, files map[string]string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, data := range files {
+		require.NoError(t, writeFile(tw, name, []byte(data), 0600, time.Now()))
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return &buf
+}
+
+func TestExtract(t *testing.T) {
+	t.Parallel()
+
+	sessionDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(sessionDir, "sess-1", "bin"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(sessionDir, "sess-1", "bin", "run.sh"), []byte("#!/bin/sh\n"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(sessionDir, ".certs"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(sessionDir, ".certs", "key.pem"), []byte("secret"), 0600))
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteArchive(&buf, Manifest{Prefix: "agent-dev-claude", Version: "1.2.3", CreatedAt: time.Now()}, []Source{
+		{Name: "sessions", Dir: sessionDir, Skip: func(rel string) bool { return rel == ".certs" }},
+		{Name: "sessions.json", Snapshot: func() ([]byte, error) { return []byte(`{}`), nil }},
+	}))
+
+	dir := t.TempDir()
+	manifest, err := Extract(bytes.NewReader(buf.Bytes()), dir, 0)
+	require.NoError(t, err)
+	require.Equal(t, "agent-dev-claude", manifest.Prefix)
+	require.Equal(t, []string{"sessions", "sessions.json"}, manifest.Sources)
+
+	info, err := os.Stat(filepath.Join(dir, "sessions", "sess-1", "bin", "run.sh"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	require.NoFileExists(t, filepath.Join(dir, "sessions", ".certs", "key.pem"))
+	require.NoFileExists(t, filepath.Join(dir, ManifestName))
+	data, err := os.ReadFile(filepath.Join(dir, "sessions.json"))
+	require.NoError(t, err)
+	require.Equal(t, `{}`, string(data))
+
+	// Too large for the limit
+	_, err = Extract(bytes.NewReader(buf.Bytes()), t.TempDir(), 4)
+	require.ErrorIs(t, err, ErrTooLarge)
+}
+
+func TestExtract_Rejects(t *testing.T) {
+	t.Parallel()
+
+	manifest := `{"prefix":"agent-dev-claude"}`
+	for name, files := range map[string]map[string]string{
+		"parent":      {ManifestName: manifest, "../escape.txt": "x"},
+		"nested":      {ManifestName: manifest, "history/../../escape.txt": "x"},
+		"absolute":    {ManifestName: manifest, "/etc/escape.txt": "x"},
+		"no manifest": {"history/task-1.json": "{}"},
+	} {
+		dir := filepath.Join(t.TempDir(), "restore")
+		_, err := Extract(tarGz(t, files), dir, 0)
+		require.Error(t, err, name)
+		require.NoFileExists(t, filepath.Join(filepath.Dir(dir), "escape.txt"), name)
+	}
+
+	_, err := Extract(bytes.NewReader([]byte("not gzip")), t.TempDir(), 0)
+	require.ErrorContains(t, err, "not a gzipped archive")
+}
@@ -0,0 +1,285 @@
+package backup
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Credential environment variables, as used by the AWS tools
+const (
+	AccessKeyEnv    = "AWS_ACCESS_KEY_ID"
+	SecretKeyEnv    = "AWS_SECRET_ACCESS_KEY"
+	SessionTokenEnv = "AWS_SESSION_TOKEN"
+)
+
+// DefaultRegion is the S3 region signed for when none is configured.
+const DefaultRegion = "us-east-1"
+
+// emptySHA256 is the hash of an empty request body.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3Target keeps archives in an S3-compatible bucket, addressed path-style
+// so MinIO, Ceph and other S3 services work alongside AWS.
+type s3Target struct {
+	endpoint     *url.URL
+	bucket       string
+	prefix       string // Key prefix, without a trailing slash
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+	now          func() time.Time
+}
+
+func newS3Target(opts Options, bucket, prefix string) (*s3Target, error) {
+	region := opts.Region
+	if region == "" {
+		region = DefaultRegion
+	}
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	u, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("backup endpoint must be an http(s) URL, got %q", endpoint)
+	}
+	t := &s3Target{
+		endpoint:     u,
+		bucket:       bucket,
+		prefix:       prefix,
+		region:       region,
+		accessKey:    opts.AccessKeyID,
+		secretKey:    opts.SecretAccessKey,
+		sessionToken: opts.SessionToken,
+		client:       &http.Client{Timeout: 30 * time.Minute},
+		now:          time.Now,
+	}
+	if t.accessKey == "" && t.secretKey == "" {
+		t.accessKey = os.Getenv(AccessKeyEnv)
+		t.secretKey = os.Getenv(SecretKeyEnv)
+		t.sessionToken = os.Getenv(SessionTokenEnv)
+	}
+	if t.accessKey == "" || t.secretKey == "" {
+		return nil, fmt.Errorf("S3 backups need %s and %s set", AccessKeyEnv, SecretKeyEnv)
+	}
+	return t, nil
+}
+
+func (t *s3Target) tempDir() string {
+	return ""
+}
+
+func (t *s3Target) key(name string) string {
+	if t.prefix == "" {
+		return name
+	}
+	return t.prefix + "/" + name
+}
+
+// objectURL returns the path-style URL of the object key, or of the bucket
+// when key is empty.
+func (t *s3Target) objectURL(key string) *url.URL {
+	u := *t.endpoint
+	u.Path += "/" + t.bucket
+	u.RawPath = t.endpoint.EscapedPath() + "/" + uriEncode(t.bucket, true)
+	if key != "" {
+		u.Path += "/" + key
+		u.RawPath += "/" + uriEncode(key, false)
+	}
+	return &u
+}
+
+func (t *s3Target) put(ctx context.Context, name string, f *os.File, size int64, sha256Hex string) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, t.objectURL(t.key(name)).String(), io.NopCloser(f))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/gzip")
+	_, err = t.do(req, sha256Hex)
+	return err
+}
+
+// listBucketResult is the part of a ListObjectsV2 response used.
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// list returns the names of the objects directly under the key prefix.
+func (t *s3Target) list(ctx context.Context) ([]string, error) {
+	keyPrefix := t.key("")
+	var names []string
+	token := ""
+	for {
+		u := t.objectURL("")
+		query := url.Values{"list-type": {"2"}, "prefix": {keyPrefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u.RawQuery = canonicalQuery(query)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		body, err := t.do(req, emptySHA256)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		if err := xml.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("parsing bucket listing: %w", err)
+		}
+		for _, obj := range result.Contents {
+			name := strings.TrimPrefix(obj.Key, keyPrefix)
+			if name != "" && !strings.Contains(name, "/") {
+				names = append(names, name)
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return names, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (t *s3Target) remove(ctx context.Context, name string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, t.objectURL(t.key(name)).String(), nil)
+	if err != nil {
+		return err
+	}
+	_, err = t.do(req, emptySHA256)
+	return err
+}
+
+// do signs and sends req, returning the response body. Responses other
+// than 2xx are errors carrying S3's error message.
+func (t *s3Target) do(req *http.Request, payloadHash string) ([]byte, error) {
+	if t.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", t.sessionToken)
+	}
+	signV4(req, payloadHash, t.accessKey, t.secretKey, t.region, t.now())
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		var s3Err struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		if xml.Unmarshal(body, &s3Err) == nil && s3Err.Code != "" {
+			return nil, fmt.Errorf("S3 %s %s: %s: %s", req.Method, req.URL.Path, s3Err.Code, s3Err.Message)
+		}
+		return nil, fmt.Errorf("S3 %s %s: %s", req.Method, req.URL.Path, resp.Status)
+	}
+	return body, nil
+}
+
+// signV4 adds AWS Signature Version 4 headers to req, signing the host and
+// every header already set.
+func signV4(req *http.Request, payloadHash, accessKey, secretKey, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes query sorted by name then value, as SigV4 signs it.
+func canonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything but RFC 3986 unreserved characters,
+// and slashes unless encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
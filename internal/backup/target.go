@@ -0,0 +1,77 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// target is where archives are kept.
+type target interface {
+	// tempDir is where archives are built before put: on the same
+	// filesystem for local targets, so put can rename them into place.
+	tempDir() string
+	// put stores the archive file f, of size bytes with the given SHA-256,
+	// as name. f is closed and removed by the caller.
+	put(ctx context.Context, name string, f *os.File, size int64, sha256Hex string) error
+	list(ctx context.Context) ([]string, error) // Names of the stored archives
+	remove(ctx context.Context, name string) error
+}
+
+// newTarget parses a destination: a local directory, or s3://bucket/prefix
+// for an S3-compatible bucket.
+func newTarget(opts Options) (target, error) {
+	if strings.HasPrefix(opts.Destination, "s3://") {
+		u, err := url.Parse(opts.Destination)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("backup destination must look like s3://bucket/prefix, got %q", opts.Destination)
+		}
+		return newS3Target(opts, u.Host, strings.Trim(u.Path, "/"))
+	}
+	if strings.Contains(opts.Destination, "://") {
+		return nil, fmt.Errorf("backup destination must be a directory or s3://bucket/prefix, got %q", opts.Destination)
+	}
+	if !filepath.IsAbs(opts.Destination) {
+		return nil, fmt.Errorf("backup destination directory must be absolute, got %q", opts.Destination)
+	}
+	if err := os.MkdirAll(opts.Destination, 0700); err != nil {
+		return nil, fmt.Errorf("creating backup directory: %w", err)
+	}
+	return dirTarget(opts.Destination), nil
+}
+
+// dirTarget keeps archives in a local directory, e.g. a mounted network
+// share.
+type dirTarget string
+
+func (d dirTarget) tempDir() string {
+	return string(d)
+}
+
+func (d dirTarget) put(_ context.Context, name string, f *os.File, _ int64, _ string) error {
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(string(d), name))
+}
+
+func (d dirTarget) list(context.Context) ([]string, error) {
+	entries, err := os.ReadDir(string(d))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+func (d dirTarget) remove(_ context.Context, name string) error {
+	return os.Remove(filepath.Join(string(d), name))
+}
@@ -1,9 +1,13 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -12,18 +16,280 @@ import (
 
 // Config represents the agent configuration
 type Config struct {
-	Port             int          `yaml:"port"`
-	Bind             string       `yaml:"bind"` // Address to bind to (default: 127.0.0.1)
-	Name             string       `yaml:"name"` // Agent name (used for history directory)
-	LogLevel         string       `yaml:"log_level"`
-	SessionDir       string       `yaml:"session_dir"`        // Base directory for session workspaces
-	HistoryDir       string       `yaml:"history_dir"`        // Directory for task history storage
-	AgencyPromptsDir string       `yaml:"agency_prompts_dir"` // Directory for agency prompt files
-	AgencyPromptFile string       `yaml:"agency_prompt_file"` // Optional explicit path to agency prompt file
-	AgentKind        string       `yaml:"agent_kind"`         // claude, codex
-	Tiers            TierConfig   `yaml:"tiers"`
-	Claude           ClaudeConfig `yaml:"claude"`
-	Codex            CodexConfig  `yaml:"codex"`
+	Port             int               `yaml:"port"`
+	Bind             string            `yaml:"bind"`       // Address to bind to (default: 127.0.0.1)
+	Name             string            `yaml:"name"`       // Agent name (used for history directory)
+	ID               string            `yaml:"id"`         // Stable agent identifier reported in /status
+	AuthToken        string            `yaml:"auth_token"` // Bearer token required on mutating endpoints (empty = none)
+	LogLevel         string            `yaml:"log_level"`
+	SessionDir       string            `yaml:"session_dir"`        // Base directory for session workspaces
+	HistoryDir       string            `yaml:"history_dir"`        // Directory for task history storage
+	AgencyPromptsDir string            `yaml:"agency_prompts_dir"` // Directory for agency prompt files
+	AgencyPromptFile string            `yaml:"agency_prompt_file"` // Optional explicit path to agency prompt file
+	AgentKind        string            `yaml:"agent_kind"`         // claude, codex
+	Tiers            TierConfig        `yaml:"tiers"`
+	Claude           ClaudeConfig      `yaml:"claude"`
+	Codex            CodexConfig       `yaml:"codex"`
+	Worktree         WorktreeConfig    `yaml:"worktree"`
+	Artifacts        ArtifactsConfig   `yaml:"artifacts"`
+	Attachments      AttachmentsConfig `yaml:"attachments"`
+	TaskOptions      TaskOptions       `yaml:"task_options"`
+	Policy           ToolPolicy        `yaml:"policy"`
+	Output           OutputConfig      `yaml:"output"`
+	Register         RegisterConfig    `yaml:"register"`
+	Env              EnvConfig         `yaml:"env"`
+	Log              LogConfig         `yaml:"log"`
+	Sessions         SessionsConfig    `yaml:"sessions"`
+	Container        ContainerConfig   `yaml:"container"`
+	Experiment       ExperimentConfig  `yaml:"experiment"`
+	Backup           BackupConfig      `yaml:"backup"`
+
+	Profiles map[string]yaml.Node `yaml:"profiles"` // Named overrides of the settings above (see ParseProfile)
+	Profile  string               `yaml:"-"`        // The profile in effect
+}
+
+// Container runtimes
+const (
+	ContainerRuntimeDocker = "docker"
+	ContainerRuntimePodman = "podman"
+)
+
+// ContainerConfig runs the CLI inside a container rather than on the host, so
+// the shell commands a task runs see only its session workdir and the
+// configured mounts.
+type ContainerConfig struct {
+	Image   string   `yaml:"image"`   // Image with the CLI installed (empty = run on the host)
+	Runtime string   `yaml:"runtime"` // docker or podman (default: docker)
+	Network string   `yaml:"network"` // --network value, e.g. none or a network with filtered egress (default: the runtime's)
+	Mounts  []string `yaml:"mounts"`  // Extra host:container[:ro] bind mounts
+	Env     []string `yaml:"env"`     // Host environment variables passed in, e.g. ANTHROPIC_API_KEY
+	Args    []string `yaml:"args"`    // Extra run arguments, e.g. --memory=4g
+}
+
+// Enabled reports whether tasks run in a container.
+func (c ContainerConfig) Enabled() bool {
+	return c.Image != ""
+}
+
+// RuntimeBin returns the container runtime to invoke.
+func (c ContainerConfig) RuntimeBin() string {
+	if c.Runtime == "" {
+		return ContainerRuntimeDocker
+	}
+	return c.Runtime
+}
+
+// Validate checks the container settings.
+func (c ContainerConfig) Validate() error {
+	switch c.Runtime {
+	case "", ContainerRuntimeDocker, ContainerRuntimePodman:
+	default:
+		return fmt.Errorf("container.runtime must be docker or podman, got %q", c.Runtime)
+	}
+	for _, mount := range c.Mounts {
+		parts := strings.Split(mount, ":")
+		if len(parts) < 2 || len(parts) > 3 || !filepath.IsAbs(parts[0]) || !filepath.IsAbs(parts[1]) ||
+			(len(parts) == 3 && parts[2] != "ro" && parts[2] != "rw") {
+			return fmt.Errorf("container.mounts entries must look like /host/path:/container/path[:ro], got %q", mount)
+		}
+	}
+	for _, name := range c.Env {
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			return fmt.Errorf("container.env has an invalid variable name %q", name)
+		}
+	}
+	return nil
+}
+
+// ExperimentConfig runs an A/B test of the agency prompt: Percent of tasks
+// are given the Variant prompt instead of the usual one, and each task's
+// history records which arm it was in.
+type ExperimentConfig struct {
+	Name    string `yaml:"name"`    // Groups results in reports (default: the variant's file name)
+	Variant string `yaml:"variant"` // Alternate prompt file, relative to agency_prompts_dir unless absolute
+	Percent int    `yaml:"percent"` // Share of tasks given the variant, 0-100 (0 = off)
+}
+
+// Enabled reports whether an experiment is running.
+func (e ExperimentConfig) Enabled() bool {
+	return e.Variant != "" && e.Percent > 0
+}
+
+// Label returns the name results are grouped under.
+func (e ExperimentConfig) Label() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	return filepath.Base(e.Variant)
+}
+
+// Validate checks the experiment settings.
+func (e ExperimentConfig) Validate() error {
+	if e.Percent < 0 || e.Percent > 100 {
+		return fmt.Errorf("experiment.percent must be between 0 and 100, got %d", e.Percent)
+	}
+	if e.Percent > 0 && e.Variant == "" {
+		return fmt.Errorf("experiment.variant must name a prompt file when experiment.percent is set")
+	}
+	return nil
+}
+
+// BackupConfig periodically archives the agent's history to a local
+// directory or an S3-compatible bucket. S3 credentials come from
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+type BackupConfig struct {
+	Destination string        `yaml:"destination"` // Absolute directory or s3://bucket/prefix (empty = disabled)
+	Endpoint    string        `yaml:"endpoint"`    // S3-compatible endpoint, e.g. https://minio:9000 (default: AWS for region)
+	Region      string        `yaml:"region"`      // S3 region signed for (default: us-east-1)
+	Interval    time.Duration `yaml:"interval"`    // Time between backups (default: 24h)
+	Retain      int           `yaml:"retain"`      // Archives kept (default: 7)
+}
+
+// Enabled reports whether backups are configured.
+func (b BackupConfig) Enabled() bool {
+	return b.Destination != ""
+}
+
+// Validate checks the backup settings.
+func (b BackupConfig) Validate() error {
+	if b.Destination != "" && !strings.HasPrefix(b.Destination, "s3://") && !filepath.IsAbs(b.Destination) {
+		return fmt.Errorf("backup.destination must be an absolute directory or s3://bucket/prefix, got %q", b.Destination)
+	}
+	if b.Endpoint != "" {
+		if u, err := url.Parse(b.Endpoint); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("backup.endpoint must be an absolute http or https URL, got %q", b.Endpoint)
+		}
+	}
+	if b.Interval != 0 && b.Interval < time.Minute {
+		return fmt.Errorf("backup.interval must be at least 1 minute, got %v", b.Interval)
+	}
+	if b.Retain < 0 {
+		return fmt.Errorf("backup.retain must not be negative, got %d", b.Retain)
+	}
+	return nil
+}
+
+// SessionsConfig bounds the disk space taken by session workdirs. Sessions
+// with a running task are never removed.
+type SessionsConfig struct {
+	MaxTotalBytes   int64         `yaml:"max_total_bytes"`  // Oldest sessions are removed above this total (0 = unlimited)
+	MaxAge          time.Duration `yaml:"max_age"`          // Sessions unused for longer are removed (0 = forever)
+	CleanupInterval time.Duration `yaml:"cleanup_interval"` // How often limits are enforced (default: 1h)
+}
+
+// Limited reports whether either limit is set.
+func (s SessionsConfig) Limited() bool {
+	return s.MaxTotalBytes > 0 || s.MaxAge > 0
+}
+
+// LogConfig sends structured log entries to sinks beyond stderr and the
+// in-memory buffer behind /logs. All sinks are off by default.
+type LogConfig struct {
+	File   LogFileConfig   `yaml:"file"`
+	Syslog LogSyslogConfig `yaml:"syslog"`
+	OTLP   LogOTLPConfig   `yaml:"otlp"`
+}
+
+// LogFileConfig writes JSON lines to a rotated file.
+type LogFileConfig struct {
+	Path     string `yaml:"path"`      // Log file (empty = disabled)
+	MaxBytes int64  `yaml:"max_bytes"` // Size at which the file is rotated (default: 10 MiB)
+	MaxFiles int    `yaml:"max_files"` // Rotated files kept (default: 5)
+}
+
+// LogSyslogConfig sends entries to syslog.
+type LogSyslogConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Network string `yaml:"network"` // udp, tcp or unix (empty = local daemon)
+	Address string `yaml:"address"` // e.g. logs.internal:514 (required with network)
+	Tag     string `yaml:"tag"`     // Default: agency-<component>
+}
+
+// LogOTLPConfig exports entries to an OpenTelemetry collector over OTLP/HTTP.
+type LogOTLPConfig struct {
+	Endpoint string            `yaml:"endpoint"` // Collector base URL, e.g. http://otel:4318 (empty = disabled)
+	Headers  map[string]string `yaml:"headers"`  // Extra request headers, e.g. for authentication
+}
+
+// EnvConfig controls the environment variables tasks may set for the CLI.
+type EnvConfig struct {
+	Allowed     []string `yaml:"allowed"`      // Variable names tasks may set (empty = any)
+	SecretsFile string   `yaml:"secrets_file"` // YAML map of secret values (default: AGENCY_ROOT/secrets.yaml)
+}
+
+// Permits reports whether tasks may set the variable name.
+func (e EnvConfig) Permits(name string) bool {
+	return len(e.Allowed) == 0 || slices.Contains(e.Allowed, name)
+}
+
+// SecretsPath returns the secrets file to read.
+func (e EnvConfig) SecretsPath() string {
+	if e.SecretsFile != "" {
+		return e.SecretsFile
+	}
+	return DefaultSecretsPath()
+}
+
+// RegisterConfig has the agent register itself with a web view on another
+// machine, which can't find it by port scanning.
+type RegisterConfig struct {
+	URL          string        `yaml:"url"`           // Web view base URL, e.g. https://dash:8443 (empty = disabled)
+	AdvertiseURL string        `yaml:"advertise_url"` // URL the web view reaches this agent at (default: https://<hostname>:<port>)
+	Interval     time.Duration `yaml:"interval"`      // Heartbeat interval (default: as the web view asks, else 30s)
+}
+
+// OutputConfig bounds how much CLI output a task keeps in memory, and sets
+// when a task is warned about as it nears its timeout.
+type OutputConfig struct {
+	MaxBytes       int64         `yaml:"max_bytes"`       // Captured output limit; the rest spills to disk (default: 16 MiB)
+	TimeoutWarning time.Duration `yaml:"timeout_warning"` // Log a warning this long before a task's timeout (default: 5m)
+}
+
+// ToolPolicy restricts which tools the CLI may use on this agent instance.
+type ToolPolicy struct {
+	AllowedTools []string `yaml:"allowed_tools"` // Only these tools may run (empty = no allowlist)
+	DeniedTools  []string `yaml:"denied_tools"`  // Tools never available to tasks
+}
+
+// IsEmpty reports whether the policy places no restrictions.
+func (p ToolPolicy) IsEmpty() bool {
+	return len(p.AllowedTools) == 0 && len(p.DeniedTools) == 0
+}
+
+// Permits reports whether the policy lets tasks use a tool.
+func (p ToolPolicy) Permits(tool string) bool {
+	if slices.Contains(p.DeniedTools, tool) {
+		return false
+	}
+	return len(p.AllowedTools) == 0 || slices.Contains(p.AllowedTools, tool)
+}
+
+// TaskOptions bounds the runner options a task may override.
+type TaskOptions struct {
+	MaxTurnsLimit   int      `yaml:"max_turns_limit"`  // Highest per-task max_turns (0 = claude.max_turns)
+	PermissionModes []string `yaml:"permission_modes"` // Permission modes tasks may request (empty = any supported)
+	AllowedTools    []string `yaml:"allowed_tools"`    // Tools tasks may list in allowed_tools (empty = any)
+}
+
+// ArtifactsConfig controls collection of files produced by tasks.
+type ArtifactsConfig struct {
+	Globs    []string `yaml:"globs"`     // Patterns relative to the session workdir (empty = disabled)
+	MaxBytes int64    `yaml:"max_bytes"` // Per-file size limit (default: 10 MiB)
+	MaxFiles int      `yaml:"max_files"` // Per-task file limit (default: 20)
+}
+
+// AttachmentsConfig limits the files tasks may attach.
+type AttachmentsConfig struct {
+	MaxBytes     int64    `yaml:"max_bytes"`     // Per-file size limit (default: 1 MiB)
+	MaxFiles     int      `yaml:"max_files"`     // Per-task file limit (default: 10)
+	AllowedTypes []string `yaml:"allowed_types"` // Detected content types, e.g. text/plain or image/* (empty = any)
+}
+
+// WorktreeConfig enables git isolation: each new session gets a fresh clone
+// of Repo and the resulting diff is captured in task history.
+type WorktreeConfig struct {
+	Repo string `yaml:"repo"` // Repository path or URL (empty = disabled)
+	Ref  string `yaml:"ref"`  // Branch or tag to check out (default: remote HEAD)
 }
 
 // ClaudeConfig holds Claude CLI settings
@@ -51,6 +317,17 @@ func (t TierConfig) HasAny() bool {
 	return t.Fast != "" || t.Standard != "" || t.Heavy != ""
 }
 
+// Configured returns the names of the tiers that have a model set.
+func (t TierConfig) Configured() []string {
+	var tiers []string
+	for _, tier := range []string{api.TierFast, api.TierStandard, api.TierHeavy} {
+		if t.Value(tier) != "" {
+			tiers = append(tiers, tier)
+		}
+	}
+	return tiers
+}
+
 // Value returns the model name for a tier.
 func (t TierConfig) Value(tier string) string {
 	switch tier {
@@ -97,10 +374,31 @@ const (
 	DefaultAgentKind    = api.AgentKindClaude
 	DefaultCodexModel   = ""
 	DefaultCodexTimeout = 30 * time.Minute
+
+	DefaultArtifactMaxBytes = 10 << 20
+	DefaultArtifactMaxFiles = 20
+
+	DefaultAttachmentMaxBytes = 1 << 20
+	DefaultAttachmentMaxFiles = 10
+
+	DefaultOutputMaxBytes       = 16 << 20
+	DefaultOutputTimeoutWarning = 5 * time.Minute
+
+	DefaultSessionCleanupInterval = time.Hour
 )
 
-// Parse parses YAML config data
+// Parse parses YAML config data with the profile selected by AGENCY_MODE
+// (see ParseProfile)
 func Parse(data []byte) (*Config, error) {
+	return ParseProfile(data, "")
+}
+
+// ParseProfile parses YAML config data, applies the settings of the named
+// profile over the file's base settings, then applies AGENCY_* environment
+// overrides (see ApplyEnv). An empty profile selects SelectedProfile(). A
+// profile the file doesn't define is an error if the file defines any,
+// unless it's DefaultProfile, which falls back to the base settings.
+func ParseProfile(data []byte, profile string) (*Config, error) {
 	cfg := &Config{
 		Port:       DefaultPort,
 		Bind:       DefaultBind,
@@ -122,6 +420,15 @@ func Parse(data []byte) (*Config, error) {
 	if err := yaml.Unmarshal(data, cfg); err != nil {
 		return nil, fmt.Errorf("parsing config: %w", err)
 	}
+	if profile == "" {
+		profile = SelectedProfile()
+	}
+	if err := cfg.applyProfile(profile); err != nil {
+		return nil, err
+	}
+	if err := ApplyEnv(cfg, EnvPrefix); err != nil {
+		return nil, err
+	}
 
 	// Derive SessionDir if not set
 	if cfg.SessionDir == "" {
@@ -140,13 +447,19 @@ func Parse(data []byte) (*Config, error) {
 	return cfg, nil
 }
 
-// Load loads config from a file path
+// Load loads config from a file path with the profile selected by AGENCY_MODE
 func Load(path string) (*Config, error) {
+	return LoadProfile(path, "")
+}
+
+// LoadProfile loads config from a file path with the named profile (see
+// ParseProfile)
+func LoadProfile(path, profile string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("reading config file: %w", err)
 	}
-	return Parse(data)
+	return ParseProfile(data, profile)
 }
 
 // Validate checks config validity
@@ -185,6 +498,118 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	if c.TaskOptions.MaxTurnsLimit < 0 {
+		return fmt.Errorf("task_options.max_turns_limit must not be negative, got %d", c.TaskOptions.MaxTurnsLimit)
+	}
+
+	if c.Output.MaxBytes < 0 {
+		return fmt.Errorf("output.max_bytes must not be negative, got %d", c.Output.MaxBytes)
+	}
+	if c.Output.TimeoutWarning < 0 {
+		return fmt.Errorf("output.timeout_warning must not be negative, got %v", c.Output.TimeoutWarning)
+	}
+
+	for _, tool := range append(slices.Clone(c.Policy.AllowedTools), c.Policy.DeniedTools...) {
+		if tool == "" {
+			return fmt.Errorf("policy tool names must not be empty")
+		}
+	}
+	for _, tool := range c.Policy.AllowedTools {
+		if slices.Contains(c.Policy.DeniedTools, tool) {
+			return fmt.Errorf("policy lists tool %q as both allowed and denied", tool)
+		}
+	}
+
+	if c.Register.URL != "" {
+		if u, err := url.Parse(c.Register.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("register.url must be an absolute http or https URL, got %q", c.Register.URL)
+		}
+	}
+	if c.Register.AdvertiseURL != "" {
+		if u, err := url.Parse(c.Register.AdvertiseURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("register.advertise_url must be an absolute https URL, got %q", c.Register.AdvertiseURL)
+		}
+	}
+	if c.Register.Interval < 0 {
+		return fmt.Errorf("register.interval must not be negative, got %v", c.Register.Interval)
+	}
+
+	for _, name := range c.Env.Allowed {
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			return fmt.Errorf("env.allowed has an invalid variable name %q", name)
+		}
+	}
+
+	if err := c.Log.Validate(); err != nil {
+		return err
+	}
+
+	if c.Sessions.MaxTotalBytes < 0 {
+		return fmt.Errorf("sessions.max_total_bytes must not be negative, got %d", c.Sessions.MaxTotalBytes)
+	}
+	if c.Sessions.MaxAge < 0 {
+		return fmt.Errorf("sessions.max_age must not be negative, got %v", c.Sessions.MaxAge)
+	}
+	if c.Sessions.CleanupInterval != 0 && c.Sessions.CleanupInterval < time.Minute {
+		return fmt.Errorf("sessions.cleanup_interval must be at least 1 minute, got %v", c.Sessions.CleanupInterval)
+	}
+
+	if c.Attachments.MaxBytes < 0 {
+		return fmt.Errorf("attachments.max_bytes must not be negative, got %d", c.Attachments.MaxBytes)
+	}
+	if c.Attachments.MaxFiles < 0 {
+		return fmt.Errorf("attachments.max_files must not be negative, got %d", c.Attachments.MaxFiles)
+	}
+	for _, t := range c.Attachments.AllowedTypes {
+		if mediaType, sub, ok := strings.Cut(t, "/"); !ok || mediaType == "" || sub == "" {
+			return fmt.Errorf("attachments.allowed_types entries must look like text/plain or image/*, got %q", t)
+		}
+	}
+
+	if err := c.Container.Validate(); err != nil {
+		return err
+	}
+	if err := c.Experiment.Validate(); err != nil {
+		return err
+	}
+	if err := c.Backup.Validate(); err != nil {
+		return err
+	}
+
+	for _, pattern := range c.Artifacts.Globs {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid artifacts glob %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks the log sink settings.
+func (l LogConfig) Validate() error {
+	if l.File.MaxBytes < 0 {
+		return fmt.Errorf("log.file.max_bytes must not be negative, got %d", l.File.MaxBytes)
+	}
+	if l.File.MaxFiles < 0 {
+		return fmt.Errorf("log.file.max_files must not be negative, got %d", l.File.MaxFiles)
+	}
+	switch l.Syslog.Network {
+	case "":
+		if l.Syslog.Address != "" {
+			return fmt.Errorf("log.syslog.network is required with log.syslog.address")
+		}
+	case "udp", "tcp", "unix":
+		if l.Syslog.Address == "" {
+			return fmt.Errorf("log.syslog.address is required with log.syslog.network")
+		}
+	default:
+		return fmt.Errorf("log.syslog.network must be udp, tcp or unix, got %q", l.Syslog.Network)
+	}
+	if l.OTLP.Endpoint != "" {
+		if u, err := url.Parse(l.OTLP.Endpoint); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("log.otlp.endpoint must be an absolute http or https URL, got %q", l.OTLP.Endpoint)
+		}
+	}
 	return nil
 }
 
@@ -207,35 +632,49 @@ func Default() *Config {
 			Model:   DefaultCodexModel,
 			Timeout: DefaultCodexTimeout,
 		},
+		Profile: SelectedProfile(),
 	}
 }
 
 // DefaultHistoryPath returns the default history directory path for an agent.
 // Uses AGENCY_ROOT env var if set, otherwise ~/.agency/history/<name>
 func DefaultHistoryPath(name string) string {
-	root := os.Getenv("AGENCY_ROOT")
-	if root == "" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			home = "/tmp"
-		}
-		root = filepath.Join(home, ".agency")
-	}
-	return filepath.Join(root, "history", name)
+	return filepath.Join(agencyRoot(), "history", name)
+}
+
+// DefaultAgentIDPath returns the file holding the persistent agent ID.
+// Uses AGENCY_ROOT env var if set, otherwise ~/.agency/agents/<name>-<kind>.id
+func DefaultAgentIDPath(name, kind string) string {
+	return filepath.Join(agencyRoot(), "agents", name+"-"+kind+".id")
 }
 
 // DefaultSessionPath returns the default session directory path.
 // Uses AGENCY_ROOT env var if set, otherwise ~/.agency/sessions
 func DefaultSessionPath() string {
-	root := os.Getenv("AGENCY_ROOT")
-	if root == "" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			home = "/tmp"
-		}
-		root = filepath.Join(home, ".agency")
+	return filepath.Join(agencyRoot(), "sessions")
+}
+
+// DefaultSecretsPath returns the default secrets file path.
+// Uses AGENCY_ROOT env var if set, otherwise ~/.agency/secrets.yaml
+func DefaultSecretsPath() string {
+	return filepath.Join(agencyRoot(), "secrets.yaml")
+}
+
+// LoadSecrets reads a YAML map of secret names to values. A missing file
+// holds no secrets.
+func LoadSecrets(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading secrets file: %w", err)
 	}
-	return filepath.Join(root, "sessions")
+	secrets := map[string]string{}
+	if err := yaml.Unmarshal(data, &secrets); err != nil {
+		return nil, fmt.Errorf("parsing secrets file: %w", err)
+	}
+	return secrets, nil
 }
 
 // DefaultPromptsPath returns the default agency prompts directory path.
@@ -244,23 +683,17 @@ func DefaultPromptsPath() string {
 	if dir := os.Getenv("AGENCY_PROMPTS_DIR"); dir != "" {
 		return dir
 	}
-	root := os.Getenv("AGENCY_ROOT")
-	if root == "" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			home = "/tmp"
-		}
-		root = filepath.Join(home, ".agency")
-	}
-	return filepath.Join(root, "prompts")
+	return filepath.Join(agencyRoot(), "prompts")
 }
 
-// AgencyMode returns the current agency mode (prod or dev).
-// Uses AGENCY_MODE env var, defaults to "prod".
-func AgencyMode() string {
-	mode := os.Getenv("AGENCY_MODE")
-	if mode == "" {
-		return "prod"
+// agencyRoot returns AGENCY_ROOT if set, otherwise ~/.agency
+func agencyRoot() string {
+	if root := os.Getenv("AGENCY_ROOT"); root != "" {
+		return root
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "/tmp"
 	}
-	return mode
+	return filepath.Join(home, ".agency")
 }
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -107,6 +109,133 @@ claude:
 `,
 			wantErr: "max_turns must be at least 1",
 		},
+		{
+			name: "tool both allowed and denied",
+			yaml: `
+port: 9000
+policy:
+  allowed_tools: [Read, Bash]
+  denied_tools: [Bash]
+`,
+			wantErr: "both allowed and denied",
+		},
+		{
+			name: "advertise url not https",
+			yaml: `
+port: 9000
+register:
+  url: https://dash:8443
+  advertise_url: http://build-01:9000
+`,
+			wantErr: "register.advertise_url must be an absolute https URL",
+		},
+		{
+			name: "invalid env name",
+			yaml: `
+port: 9000
+env:
+  allowed: [GOFLAGS, "A=B"]
+`,
+			wantErr: "env.allowed has an invalid variable name",
+		},
+		{
+			name: "syslog address without network",
+			yaml: `
+port: 9000
+log:
+  syslog:
+    enabled: true
+    address: logs.internal:514
+`,
+			wantErr: "log.syslog.network is required",
+		},
+		{
+			name: "otlp endpoint not a url",
+			yaml: `
+port: 9000
+log:
+  otlp:
+    endpoint: otel:4318
+`,
+			wantErr: "log.otlp.endpoint must be an absolute http or https URL",
+		},
+		{
+			name: "session cleanup interval too short",
+			yaml: `
+port: 9000
+sessions:
+  max_age: 168h
+  cleanup_interval: 10s
+`,
+			wantErr: "sessions.cleanup_interval must be at least 1 minute",
+		},
+		{
+			name: "attachment type without subtype",
+			yaml: `
+port: 9000
+attachments:
+  allowed_types: [text]
+`,
+			wantErr: "attachments.allowed_types",
+		},
+		{
+			name: "unknown container runtime",
+			yaml: `
+port: 9000
+container:
+  image: agency-claude
+  runtime: lxc
+`,
+			wantErr: "container.runtime must be docker or podman",
+		},
+		{
+			name: "relative container mount",
+			yaml: `
+port: 9000
+container:
+  image: agency-claude
+  mounts: ["cache:/cache"]
+`,
+			wantErr: "container.mounts",
+		},
+		{
+			name: "experiment percent out of range",
+			yaml: `
+port: 9000
+experiment:
+  variant: claude-prod-b.md
+  percent: 120
+`,
+			wantErr: "experiment.percent must be between 0 and 100",
+		},
+		{
+			name: "experiment without variant",
+			yaml: `
+port: 9000
+experiment:
+  percent: 20
+`,
+			wantErr: "experiment.variant must name a prompt file",
+		},
+		{
+			name: "relative backup destination",
+			yaml: `
+port: 9000
+backup:
+  destination: backups
+`,
+			wantErr: "backup.destination must be an absolute directory",
+		},
+		{
+			name: "backup interval too short",
+			yaml: `
+port: 9000
+backup:
+  destination: s3://agency-backups/agents
+  interval: 10s
+`,
+			wantErr: "backup.interval must be at least 1 minute",
+		},
 	}
 
 	for _, tt := range tests {
@@ -122,6 +251,7 @@ claude:
 			}
 
 			require.NoError(t, err)
+			tt.want.Profile = SelectedProfile()
 			require.Equal(t, tt.want, got)
 		})
 	}
@@ -144,3 +274,227 @@ func TestDefault(t *testing.T) {
 	require.Equal(t, DefaultCodexModel, cfg.Codex.Model)
 	require.Equal(t, DefaultCodexTimeout, cfg.Codex.Timeout)
 }
+
+func TestTierConfigConfigured(t *testing.T) {
+	t.Parallel()
+
+	require.Empty(t, TierConfig{}.Configured())
+	require.Equal(t, []string{"fast", "heavy"}, TierConfig{Fast: "haiku", Heavy: "opus"}.Configured())
+	require.Equal(t, []string{"fast", "standard", "heavy"}, DefaultClaudeTiers().Configured())
+}
+
+func TestToolPolicyPermits(t *testing.T) {
+	t.Parallel()
+
+	require.True(t, ToolPolicy{}.Permits("Bash"))
+
+	deny := ToolPolicy{DeniedTools: []string{"Bash"}}
+	require.False(t, deny.Permits("Bash"))
+	require.True(t, deny.Permits("Read"))
+
+	allow := ToolPolicy{AllowedTools: []string{"Read", "Edit"}}
+	require.True(t, allow.Permits("Edit"))
+	require.False(t, allow.Permits("Bash"))
+}
+
+func TestEnvConfig(t *testing.T) {
+	t.Parallel()
+
+	require.True(t, EnvConfig{}.Permits("ANYTHING"))
+	allow := EnvConfig{Allowed: []string{"GOFLAGS"}}
+	require.True(t, allow.Permits("GOFLAGS"))
+	require.False(t, allow.Permits("LD_PRELOAD"))
+
+	require.Equal(t, DefaultSecretsPath(), EnvConfig{}.SecretsPath())
+	require.Equal(t, "/etc/agency/secrets.yaml", EnvConfig{SecretsFile: "/etc/agency/secrets.yaml"}.SecretsPath())
+}
+
+func TestLoadSecrets(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	secrets, err := LoadSecrets(filepath.Join(dir, "missing.yaml"))
+	require.NoError(t, err)
+	require.Empty(t, secrets)
+
+	path := filepath.Join(dir, "secrets.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("github_token: ghp_123\nnpm_token: npm_456\n"), 0600))
+	secrets, err = LoadSecrets(path)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"github_token": "ghp_123", "npm_token": "npm_456"}, secrets)
+
+	require.NoError(t, os.WriteFile(path, []byte("- not a map\n"), 0600))
+	_, err = LoadSecrets(path)
+	require.Error(t, err)
+}
+
+func TestUpdateFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	original := `# Build agent
+port: 9000
+tiers:
+  fast: haiku # cheap
+  heavy: opus
+claude:
+  model: sonnet
+`
+	require.NoError(t, os.WriteFile(path, []byte(original), 0o600))
+
+	require.NoError(t, UpdateFile(path, map[string]any{
+		"tiers.fast":       "sonnet",
+		"claude.timeout":   45 * time.Minute,
+		"claude.max_turns": 80,
+		"codex.model":      "gpt-5.2-codex",
+	}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "# Build agent")
+	require.Contains(t, string(data), "fast: sonnet # cheap")
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	require.Equal(t, 9000, cfg.Port)
+	require.Equal(t, "sonnet", cfg.Tiers.Fast)
+	require.Equal(t, "opus", cfg.Tiers.Heavy)
+	require.Equal(t, "sonnet", cfg.Claude.Model)
+	require.Equal(t, 45*time.Minute, cfg.Claude.Timeout)
+	require.Equal(t, 80, cfg.Claude.MaxTurns)
+	require.Equal(t, "gpt-5.2-codex", cfg.Codex.Model)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// Files that aren't a mapping are left alone
+	require.NoError(t, os.WriteFile(path, []byte("- not\n- a mapping\n"), 0o600))
+	require.Error(t, UpdateFile(path, map[string]any{"tiers.fast": "haiku"}))
+}
+
+func TestParseEnvOverrides(t *testing.T) {
+	t.Setenv("AGENCY_PORT", "9300")
+	t.Setenv("AGENCY_NAME", "builder")
+	t.Setenv("AGENCY_CLAUDE_MODEL", "opus")
+	t.Setenv("AGENCY_CLAUDE_TIMEOUT", "45m")
+	t.Setenv("AGENCY_TIERS_FAST", "sonnet")
+	t.Setenv("AGENCY_CONTAINER_MOUNTS", "/data:/data:ro, /cache:/cache")
+
+	cfg, err := Parse([]byte("port: 9000\nclaude:\n  model: sonnet\n  max_turns: 20\n"))
+	require.NoError(t, err)
+	require.Equal(t, 9300, cfg.Port)
+	require.Equal(t, "opus", cfg.Claude.Model)
+	require.Equal(t, 45*time.Minute, cfg.Claude.Timeout)
+	require.Equal(t, 20, cfg.Claude.MaxTurns) // From the file
+	require.Equal(t, "sonnet", cfg.Tiers.Fast)
+	require.Equal(t, []string{"/data:/data:ro", "/cache:/cache"}, cfg.Container.Mounts)
+	require.Equal(t, DefaultHistoryPath("builder"), cfg.HistoryDir) // Derived from the overridden name
+
+	// Overrides are validated like the file
+	t.Setenv("AGENCY_PORT", "0")
+	_, err = Parse(nil)
+	require.ErrorContains(t, err, "port must be between")
+	t.Setenv("AGENCY_PORT", "nine")
+	_, err = Parse(nil)
+	require.ErrorContains(t, err, "AGENCY_PORT")
+}
+
+func TestEnvNames(t *testing.T) {
+	t.Parallel()
+
+	names := EnvNames(&Config{}, EnvPrefix)
+	require.Contains(t, names, "AGENCY_AUTH_TOKEN")
+	require.Contains(t, names, "AGENCY_CLAUDE_MODEL")
+	require.NotContains(t, names, "AGENCY_ROOT")
+	require.NotContains(t, names, ProfileEnv)
+}
+
+func TestSetFlag(t *testing.T) {
+	// Cannot use t.Parallel() with t.Setenv()
+	t.Setenv("AGENCY_CLAUDE_MAX_TURNS", "")
+	t.Cleanup(func() {
+		overridesMu.Lock()
+		clear(overrides)
+		overridesMu.Unlock()
+	})
+
+	f := NewSetFlag(EnvPrefix, &Config{})
+	require.False(t, Overridden(EnvPrefix, "claude.max_turns"))
+	require.NoError(t, f.Set("claude.max_turns=80"))
+	require.Empty(t, os.Getenv("AGENCY_CLAUDE_MAX_TURNS"), "overrides stay out of the environment")
+	require.True(t, Overridden(EnvPrefix, "claude.max_turns"))
+	require.ErrorContains(t, f.Set("claude.max_turn=80"), "unknown config key")
+	require.Error(t, f.Set("claude.max_turns=many"))
+	require.Error(t, f.Set("claude.model"))
+
+	cfg, err := Parse(nil)
+	require.NoError(t, err)
+	require.Equal(t, 80, cfg.Claude.MaxTurns)
+}
+
+func TestParseProfile(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`port: 9000
+agency_prompts_dir: /srv/prompts
+tiers:
+  fast: haiku
+  standard: sonnet
+profiles:
+  dev:
+    port: 9100
+    history_dir: /tmp/dev-history
+    tiers:
+      standard: haiku
+  staging:
+    agency_prompts_dir: /srv/staging-prompts
+`)
+	cfg, err := ParseProfile(data, "dev")
+	require.NoError(t, err)
+	require.Equal(t, "dev", cfg.Profile)
+	require.Equal(t, 9100, cfg.Port)
+	require.Equal(t, "/tmp/dev-history", cfg.HistoryDir)
+	require.Equal(t, "haiku", cfg.Tiers.Standard)
+	require.Equal(t, "haiku", cfg.Tiers.Fast) // Kept from the base
+	require.Equal(t, "/srv/prompts", cfg.AgencyPromptsDir)
+
+	cfg, err = ParseProfile(data, "staging")
+	require.NoError(t, err)
+	require.Equal(t, 9000, cfg.Port)
+	require.Equal(t, "/srv/staging-prompts", cfg.AgencyPromptsDir)
+
+	// prod falls back to the base settings when the file doesn't define it
+	cfg, err = ParseProfile(data, DefaultProfile)
+	require.NoError(t, err)
+	require.Equal(t, DefaultProfile, cfg.Profile)
+	require.Equal(t, 9000, cfg.Port)
+
+	_, err = ParseProfile(data, "qa")
+	require.ErrorContains(t, err, `unknown profile "qa" (defined: dev, staging)`)
+
+	// Without profiles in the file, any profile selects the base settings
+	cfg, err = ParseProfile([]byte("port: 9000\n"), "dev")
+	require.NoError(t, err)
+	require.Equal(t, "dev", cfg.Profile)
+
+	// Profile settings are validated like the base
+	_, err = ParseProfile([]byte("profiles:\n  dev:\n    port: 0\n"), "dev")
+	require.ErrorContains(t, err, "port must be between")
+	_, err = ParseProfile([]byte("profiles:\n  dev: fast\n"), "dev")
+	require.ErrorContains(t, err, "must be a mapping")
+	_, err = ParseProfile([]byte("profiles:\n  dev:\n    profiles: {}\n"), "dev")
+	require.ErrorContains(t, err, "can't be nested")
+}
+
+func TestSelectedProfile(t *testing.T) {
+	t.Setenv(ProfileEnv, "")
+	require.Equal(t, DefaultProfile, SelectedProfile())
+
+	t.Setenv(ProfileEnv, "dev")
+	require.Equal(t, "dev", SelectedProfile())
+	cfg, err := Parse([]byte("profiles:\n  dev:\n    port: 9100\n"))
+	require.NoError(t, err)
+	require.Equal(t, 9100, cfg.Port)
+	require.Equal(t, "dev", Default().Profile)
+}
@@ -0,0 +1,199 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EnvPrefix starts the environment variables that override agent config
+// keys, e.g. AGENCY_CLAUDE_MODEL for claude.model.
+const EnvPrefix = "AGENCY_"
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+// overrides holds -set values by environment variable name. They're kept in
+// the process rather than set in the environment, so they don't leak into
+// the environment of commands the process runs, such as task CLIs.
+var (
+	overridesMu sync.RWMutex
+	overrides   = map[string]string{}
+)
+
+// lookupEnv returns the override for the variable name: a -set value, else
+// the environment variable.
+func lookupEnv(name string) string {
+	overridesMu.RLock()
+	value, ok := overrides[name]
+	overridesMu.RUnlock()
+	if ok {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// Overridden reports whether key is pinned by a -set flag or environment
+// variable, so changing it in the config file has no effect.
+func Overridden(prefix, key string) bool {
+	return lookupEnv(EnvName(prefix, key)) != ""
+}
+
+// EnvName returns the environment variable that overrides key, a dotted YAML
+// path such as "claude.model": prefix followed by the key in upper case with
+// dots as underscores.
+func EnvName(prefix, key string) string {
+	return prefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// ApplyEnv overrides settings in cfg, a pointer to a config struct, from -set
+// flags and the environment variables EnvName gives for their keys. Lists are
+// comma-separated and durations use Go syntax (90s, 1h30m). Empty variables
+// are ignored. Maps and lists of sections, such as scheduler jobs, can only
+// be set in the file.
+func ApplyEnv(cfg any, prefix string) error {
+	fields := map[string]reflect.Value{}
+	overridableFields(reflect.ValueOf(cfg).Elem(), "", fields)
+	for key, field := range fields {
+		name := EnvName(prefix, key)
+		value := lookupEnv(name)
+		if value == "" {
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// EnvNames returns the environment variables ApplyEnv reads for cfg, a
+// pointer to a config struct.
+func EnvNames(cfg any, prefix string) []string {
+	fields := map[string]reflect.Value{}
+	overridableFields(reflect.ValueOf(cfg).Elem(), "", fields)
+	names := make([]string, 0, len(fields))
+	for key := range fields {
+		names = append(names, EnvName(prefix, key))
+	}
+	return names
+}
+
+// overridableFields collects the settable fields of struct v by YAML key.
+func overridableFields(v reflect.Value, prefix string, fields map[string]reflect.Value) {
+	t := v.Type()
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		field := v.Field(i)
+		switch {
+		case sf.Type.Kind() == reflect.Struct:
+			overridableFields(field, prefix+name+".", fields)
+		case settable(sf.Type):
+			fields[prefix+name] = field
+		}
+	}
+}
+
+func settable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+func setField(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Int || field.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case field.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case field.Kind() == reflect.Slice:
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		field.Set(reflect.ValueOf(list).Convert(field.Type()))
+	}
+	return nil
+}
+
+// SetFlag is a repeatable -set key=value flag overriding a config key. It
+// takes the place of the key's environment variable within the process, so
+// the override is applied wherever ApplyEnv is, including config reloads.
+type SetFlag struct {
+	prefix string
+	keys   map[string]reflect.Value
+}
+
+// NewSetFlag returns a -set flag for keys of the config struct cfg points to,
+// overridden through environment variables starting with prefix.
+func NewSetFlag(prefix string, cfg any) *SetFlag {
+	keys := map[string]reflect.Value{}
+	overridableFields(reflect.ValueOf(cfg).Elem(), "", keys)
+	return &SetFlag{prefix: prefix, keys: keys}
+}
+
+var _ flag.Value = (*SetFlag)(nil)
+
+func (f *SetFlag) String() string { return "" }
+
+// Set records one key=value override.
+func (f *SetFlag) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("want key=value, got %q", s)
+	}
+	field, known := f.keys[key]
+	if !known {
+		return fmt.Errorf("unknown config key %q", key)
+	}
+	// Check the value now, so a typo fails at the flag rather than at load
+	if err := setField(reflect.New(field.Type()).Elem(), value); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	overrides[EnvName(f.prefix, key)] = value
+	return nil
+}
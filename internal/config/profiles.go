@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Profiles
+const (
+	ProfileEnv     = "AGENCY_MODE" // Selects the profile when none is given explicitly
+	DefaultProfile = "prod"
+)
+
+// SelectedProfile returns the profile named by AGENCY_MODE, or DefaultProfile.
+func SelectedProfile() string {
+	if profile := os.Getenv(ProfileEnv); profile != "" {
+		return profile
+	}
+	return DefaultProfile
+}
+
+// applyProfile decodes the named profile's settings over c and records it as
+// the profile in effect. Keys the profile leaves out keep their base values;
+// lists it sets replace the base lists.
+func (c *Config) applyProfile(name string) error {
+	for defined := range c.Profiles {
+		if defined == "" || strings.Contains(defined, ".") {
+			return fmt.Errorf("profile name %q must be non-empty and contain no dots", defined)
+		}
+	}
+	c.Profile = name
+	node, ok := c.Profiles[name]
+	if !ok {
+		if len(c.Profiles) > 0 && name != DefaultProfile {
+			return fmt.Errorf("unknown profile %q (defined: %s)", name, strings.Join(slices.Sorted(maps.Keys(c.Profiles)), ", "))
+		}
+		return nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("profile %q: must be a mapping of config keys", name)
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		if node.Content[i].Value == "profiles" {
+			return fmt.Errorf("profile %q: profiles can't be nested", name)
+		}
+	}
+	if err := node.Decode(c); err != nil {
+		return fmt.Errorf("profile %q: %w", name, err)
+	}
+	return nil
+}
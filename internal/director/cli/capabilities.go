@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"phobos.org.uk/agency/internal/api"
+)
+
+// Requirement is a capability a command needs from a component, and the
+// flag that needs it.
+type Requirement struct {
+	Capability string
+	Flag       string
+}
+
+// componentAPI is the part of a component's /status that says which API it
+// speaks.
+type componentAPI struct {
+	APIVersion   int      `json:"api_version"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// CheckCapabilities reads the /status of the component at baseURL and returns
+// an error naming the first of reqs it reports lacking. Components from
+// before capabilities were reported are assumed to support everything, and
+// ones that can't be read are left for the command's own request to fail.
+// warning is set when the component speaks a newer API than this client.
+func CheckCapabilities(client *http.Client, baseURL string, reqs []Requirement) (warning string, err error) {
+	resp, err := client.Get(baseURL + "/status")
+	if err != nil {
+		return "", nil
+	}
+	defer resp.Body.Close()
+	var status componentAPI
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&status) != nil {
+		return "", nil
+	}
+	return checkCapabilities(status, baseURL, reqs)
+}
+
+func checkCapabilities(status componentAPI, baseURL string, reqs []Requirement) (warning string, err error) {
+	if status.APIVersion > api.APIVersion {
+		warning = fmt.Sprintf("%s speaks API version %d, newer than this ag-cli's %d; upgrade ag-cli if anything looks wrong",
+			baseURL, status.APIVersion, api.APIVersion)
+	}
+	if status.APIVersion == 0 {
+		return warning, nil
+	}
+	for _, req := range reqs {
+		if !api.HasCapability(status.Capabilities, req.Capability) {
+			return warning, fmt.Errorf("%s does not support %s (no %q capability)", baseURL, req.Flag, req.Capability)
+		}
+	}
+	return warning, nil
+}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"phobos.org.uk/agency/internal/api"
+)
+
+func TestCheckCapabilities(t *testing.T) {
+	t.Parallel()
+
+	reqs := []Requirement{{Capability: api.CapabilityScheduledDispatch, Flag: "-run-at"}}
+	tests := []struct {
+		name        string
+		status      map[string]any
+		wantErr     string
+		wantWarning bool
+	}{
+		{"supported", map[string]any{"api_version": api.APIVersion, "capabilities": []string{api.CapabilityScheduledDispatch}}, "", false},
+		{"missing", map[string]any{"api_version": api.APIVersion, "capabilities": []string{api.CapabilitySSE}}, "does not support -run-at", false},
+		{"unversioned", map[string]any{"type": "view"}, "", false}, // Predates capabilities: assumed to support everything
+		{"newer", map[string]any{"api_version": api.APIVersion + 1, "capabilities": []string{api.CapabilityScheduledDispatch}}, "", true},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "/status", r.URL.Path)
+			json.NewEncoder(w).Encode(tt.status)
+		}))
+		warning, err := CheckCapabilities(srv.Client(), srv.URL, reqs)
+		srv.Close()
+		if tt.wantErr != "" {
+			require.ErrorContains(t, err, tt.wantErr, tt.name)
+		} else {
+			require.NoError(t, err, tt.name)
+		}
+		require.Equal(t, tt.wantWarning, warning != "", tt.name)
+	}
+
+	// Unreachable components are left for the command's own request to report
+	warning, err := CheckCapabilities(http.DefaultClient, "http://127.0.0.1:1", reqs)
+	require.NoError(t, err)
+	require.Empty(t, warning)
+}
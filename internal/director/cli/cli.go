@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"time"
 
+	"phobos.org.uk/agency/internal/api"
 	"phobos.org.uk/agency/internal/tlsutil"
 )
 
@@ -14,6 +15,7 @@ import (
 type Director struct {
 	directorURL string // Primary target for session tracking (optional)
 	agentURL    string // Direct agent URL (fallback if director unavailable)
+	authToken   string // Bearer token for agents that require one (optional)
 	client      *http.Client
 }
 
@@ -36,7 +38,7 @@ func New(agentURL string, opts ...Option) *Director {
 		opt(d)
 	}
 	// Update client for TLS if needed
-	d.client = tlsutil.NewHTTPClient(5*time.Minute, d.directorURL, d.agentURL)
+	d.client = api.WithAuthToken(tlsutil.NewHTTPClient(5*time.Minute, d.directorURL, d.agentURL), d.authToken)
 	return d
 }
 
@@ -50,6 +52,13 @@ func WithDirectorURL(url string) Option {
 	}
 }
 
+// WithAuthToken sends token as a bearer token, for agents with auth_token set
+func WithAuthToken(token string) Option {
+	return func(d *Director) {
+		d.authToken = token
+	}
+}
+
 // Run submits a task and polls until completion
 func (d *Director) Run(prompt string, timeout time.Duration) (*TaskResult, error) {
 	// Try director first (for session tracking)
@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Shells that completion scripts can be generated for.
+var CompletionShells = []string{"bash", "zsh", "fish"}
+
+// CompletionCommand describes a subcommand for shell completion.
+type CompletionCommand struct {
+	Name        string
+	Description string
+	Flags       []string // Without the leading dash
+	Args        []string // Fixed positional values, if any (otherwise files complete)
+}
+
+// WriteCompletion writes a completion script for program to w. Flags and
+// fixed arguments complete per subcommand; anything else completes file
+// names, for prompts and -attach.
+func WriteCompletion(w io.Writer, shell, program string, cmds []CompletionCommand) error {
+	fn := "_" + strings.NewReplacer("-", "_", ".", "_").Replace(program)
+	var b strings.Builder
+	switch shell {
+	case "bash":
+		names := make([]string, len(cmds))
+		for i, c := range cmds {
+			names[i] = c.Name
+		}
+		fmt.Fprintf(&b, "# bash completion for %s\n", program)
+		fmt.Fprintf(&b, "%s() {\n", fn)
+		b.WriteString("    local cur=${COMP_WORDS[COMP_CWORD]}\n")
+		b.WriteString("    if [ \"$COMP_CWORD\" -eq 1 ]; then\n")
+		fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(names, " "))
+		b.WriteString("        return\n    fi\n")
+		b.WriteString("    local candidates=\n    case ${COMP_WORDS[1]} in\n")
+		for _, c := range cmds {
+			if len(c.Flags) == 0 && len(c.Args) == 0 {
+				continue
+			}
+			fmt.Fprintf(&b, "    %s) candidates=%q ;;\n", c.Name, completionWords(c))
+		}
+		b.WriteString("    esac\n")
+		b.WriteString("    COMPREPLY=($(compgen -W \"$candidates\" -- \"$cur\"))\n")
+		b.WriteString("}\n")
+		fmt.Fprintf(&b, "complete -o default -F %s %s\n", fn, program)
+	case "zsh":
+		fmt.Fprintf(&b, "#compdef %s\n\n", program)
+		fmt.Fprintf(&b, "%s() {\n", fn)
+		b.WriteString("    local -a commands candidates\n    commands=(\n")
+		for _, c := range cmds {
+			fmt.Fprintf(&b, "        %s\n", zshQuote(c.Name+":"+c.Description))
+		}
+		b.WriteString("    )\n")
+		b.WriteString("    if (( CURRENT == 2 )); then\n        _describe command commands\n        return\n    fi\n")
+		b.WriteString("    case $words[2] in\n")
+		for _, c := range cmds {
+			if len(c.Flags) == 0 && len(c.Args) == 0 {
+				continue
+			}
+			fmt.Fprintf(&b, "    %s) candidates=(%s) ;;\n", c.Name, completionWords(c))
+		}
+		b.WriteString("    esac\n")
+		b.WriteString("    compadd -- $candidates\n    _files\n}\n\n")
+		fmt.Fprintf(&b, "if [ \"$funcstack[1]\" = %q ]; then\n    %s \"$@\"\nelse\n    compdef %s %s\nfi\n", fn, fn, fn, program)
+	case "fish":
+		fmt.Fprintf(&b, "# fish completion for %s\n", program)
+		for _, c := range cmds {
+			fmt.Fprintf(&b, "complete -c %s -n __fish_use_subcommand -f -a %s -d %s\n", program, c.Name, fishQuote(c.Description))
+		}
+		for _, c := range cmds {
+			cond := fishQuote("__fish_seen_subcommand_from " + c.Name)
+			for _, flag := range c.Flags {
+				fmt.Fprintf(&b, "complete -c %s -n %s -o %s\n", program, cond, flag)
+			}
+			if len(c.Args) > 0 {
+				fmt.Fprintf(&b, "complete -c %s -n %s -f -a %s\n", program, cond, fishQuote(strings.Join(c.Args, " ")))
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported shell %q (want %s)", shell, strings.Join(CompletionShells, ", "))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// completionWords lists a command's fixed arguments and dashed flags.
+func completionWords(c CompletionCommand) string {
+	words := append([]string(nil), c.Args...)
+	for _, flag := range c.Flags {
+		words = append(words, "-"+flag)
+	}
+	return strings.Join(words, " ")
+}
+
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteCompletion(t *testing.T) {
+	t.Parallel()
+
+	cmds := []CompletionCommand{
+		{Name: "task", Description: "Submit a task", Flags: []string{"agent", "tier"}},
+		{Name: "completion", Description: "Print the user's script", Args: CompletionShells},
+		{Name: "version", Description: "Show version"},
+	}
+
+	var b strings.Builder
+	require.NoError(t, WriteCompletion(&b, "bash", "ag-cli", cmds))
+	require.Contains(t, b.String(), `compgen -W "task completion version"`)
+	require.Contains(t, b.String(), `task) candidates="-agent -tier" ;;`)
+	require.Contains(t, b.String(), `completion) candidates="bash zsh fish" ;;`)
+	require.Contains(t, b.String(), "complete -o default -F _ag_cli ag-cli")
+
+	b.Reset()
+	require.NoError(t, WriteCompletion(&b, "zsh", "ag-cli", cmds))
+	require.True(t, strings.HasPrefix(b.String(), "#compdef ag-cli\n"))
+	require.Contains(t, b.String(), `'completion:Print the user'\''s script'`)
+	require.Contains(t, b.String(), "compdef _ag_cli ag-cli")
+
+	b.Reset()
+	require.NoError(t, WriteCompletion(&b, "fish", "ag-cli", cmds))
+	require.Contains(t, b.String(), `complete -c ag-cli -n __fish_use_subcommand -f -a completion -d 'Print the user\'s script'`)
+	require.Contains(t, b.String(), `complete -c ag-cli -n '__fish_seen_subcommand_from task' -o agent`)
+	require.Contains(t, b.String(), `complete -c ag-cli -n '__fish_seen_subcommand_from completion' -f -a 'bash zsh fish'`)
+
+	require.ErrorContains(t, WriteCompletion(&b, "tcsh", "ag-cli", cmds), "unsupported shell")
+}
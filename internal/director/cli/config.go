@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigPathEnv overrides where ag-cli looks for its config file.
+const ConfigPathEnv = "AG_CLI_CONFIG"
+
+// Defaults used when neither a flag nor the config file sets a value.
+const (
+	DefaultDirectorURL = "http://localhost:8080"
+	DefaultAgentURL    = "https://localhost:9000"
+	DefaultOutput      = OutputText
+)
+
+// Output formats for command results.
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// Config holds ag-cli defaults, so the same -director and -agent flags don't
+// have to be repeated on every invocation. Flags still override it.
+type Config struct {
+	DirectorURL string `yaml:"director_url"`
+	AgentURL    string `yaml:"agent_url"`
+	Token       string `yaml:"token"`  // Bearer token for agents; AG_AUTH_TOKEN takes precedence
+	Output      string `yaml:"output"` // text or json
+}
+
+// DefaultConfigPath returns AG_CLI_CONFIG if set, otherwise
+// cli.yaml under $XDG_CONFIG_HOME/agency (default ~/.config/agency).
+func DefaultConfigPath() string {
+	if path := os.Getenv(ConfigPathEnv); path != "" {
+		return path
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = "/tmp"
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "agency", "cli.yaml")
+}
+
+// LoadConfig reads the config file at path. A missing file is not an error:
+// every setting just takes its default.
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{
+		DirectorURL: DefaultDirectorURL,
+		AgentURL:    DefaultAgentURL,
+		Output:      DefaultOutput,
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	if err := ValidateOutput(cfg.Output); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ValidateOutput checks an output format.
+func ValidateOutput(output string) error {
+	switch output {
+	case OutputText, OutputJSON:
+		return nil
+	}
+	return fmt.Errorf("output must be text or json, got %q", output)
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cfg, err := LoadConfig(filepath.Join(dir, "missing.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, &Config{DirectorURL: DefaultDirectorURL, AgentURL: DefaultAgentURL, Output: OutputText}, cfg)
+
+	path := filepath.Join(dir, "cli.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("director_url: https://build-01:8443\ntoken: secret\noutput: json\n"), 0o600))
+	cfg, err = LoadConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, "https://build-01:8443", cfg.DirectorURL)
+	require.Equal(t, DefaultAgentURL, cfg.AgentURL)
+	require.Equal(t, "secret", cfg.Token)
+	require.Equal(t, OutputJSON, cfg.Output)
+
+	require.NoError(t, os.WriteFile(path, []byte("output: yaml\n"), 0o600))
+	_, err = LoadConfig(path)
+	require.ErrorContains(t, err, "output must be text or json")
+
+	require.NoError(t, os.WriteFile(path, []byte("director_url: [\n"), 0o600))
+	_, err = LoadConfig(path)
+	require.Error(t, err)
+}
+
+func TestDefaultConfigPath(t *testing.T) {
+	t.Setenv(ConfigPathEnv, "")
+	t.Setenv("XDG_CONFIG_HOME", "/xdg")
+	require.Equal(t, "/xdg/agency/cli.yaml", DefaultConfigPath())
+
+	t.Setenv(ConfigPathEnv, "/etc/ag-cli.yaml")
+	require.Equal(t, "/etc/ag-cli.yaml", DefaultConfigPath())
+}
@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"phobos.org.uk/agency/internal/tlsutil"
+)
+
+// DiscoveredComponent is a component answering /status on a scanned port.
+type DiscoveredComponent struct {
+	Port   int
+	Status map[string]any
+}
+
+// HostScan is the result of scanning one host's port range.
+type HostScan struct {
+	Host       string
+	Components []DiscoveredComponent // Ordered by port
+	TLSErrors  int                   // Ports that presented an untrusted certificate
+}
+
+// ParseHosts splits a comma-separated host list, dropping blanks and
+// duplicates.
+func ParseHosts(list string) []string {
+	var hosts []string
+	seen := map[string]bool{}
+	for _, h := range strings.Split(list, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" || seen[h] {
+			continue
+		}
+		seen[h] = true
+		hosts = append(hosts, h)
+	}
+	return hosts
+}
+
+// LoadHostsFile reads a host registry: one host per line, with blank lines
+// and # comments ignored. Text after the host on a line is ignored too, so
+// lines may carry notes ("build-01  # GPU box").
+func LoadHostsFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var fields []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if parts := strings.Fields(line); len(parts) > 0 {
+			fields = append(fields, parts[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ParseHosts(strings.Join(fields, ",")), nil
+}
+
+// Discover scans portStart-portEnd on each host over HTTPS, probing every
+// port concurrently. Results are returned in host order.
+func Discover(hosts []string, portStart, portEnd int, timeout time.Duration) []HostScan {
+	client := tlsutil.NewHTTPClient(timeout)
+	scans := make([]HostScan, len(hosts))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		scans[i].Host = host
+		for port := portStart; port <= portEnd; port++ {
+			wg.Add(1)
+			go func(scan *HostScan, port int) {
+				defer wg.Done()
+				status, err := probeStatus(client, scan.Host, port)
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case err == nil:
+					scan.Components = append(scan.Components, DiscoveredComponent{Port: port, Status: status})
+				case isCertError(err):
+					scan.TLSErrors++
+				}
+			}(&scans[i], port)
+		}
+	}
+	wg.Wait()
+
+	for i := range scans {
+		sort.Slice(scans[i].Components, func(a, b int) bool {
+			return scans[i].Components[a].Port < scans[i].Components[b].Port
+		})
+	}
+	return scans
+}
+
+// probeStatus fetches and decodes /status from host:port.
+func probeStatus(client *http.Client, host string, port int) (map[string]any, error) {
+	resp, err := client.Get(statusURL(host, port))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var status map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// isCertError reports whether err is a TLS certificate verification failure,
+// as with the self-signed certificates agents generate.
+func isCertError(err error) bool {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	var verify *tls.CertificateVerificationError
+	return errors.As(err, &unknownAuthority) || errors.As(err, &hostname) ||
+		errors.As(err, &invalid) || errors.As(err, &verify)
+}
+
+// statusURL returns the /status URL for host:port, bracketing IPv6 hosts.
+func statusURL(host string, port int) string {
+	return fmt.Sprintf("https://%s/status", net.JoinHostPort(host, strconv.Itoa(port)))
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHosts(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, []string{"a", "b.example.com", "::1"}, ParseHosts(" a, b.example.com,,a ,::1"))
+	require.Empty(t, ParseHosts(""))
+}
+
+func TestLoadHostsFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "hosts")
+	require.NoError(t, os.WriteFile(path, []byte("# fleet\nbuild-01  # GPU box\n\n  build-02\nbuild-01\n"), 0o644))
+
+	hosts, err := LoadHostsFile(path)
+	require.NoError(t, err)
+	require.Equal(t, []string{"build-01", "build-02"}, hosts)
+
+	_, err = LoadHostsFile(filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, err)
+}
+
+func TestDiscover(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/status", r.URL.Path)
+		w.Write([]byte(`{"type":"agent","state":"idle","version":"1.2.3"}`))
+	}))
+	defer server.Close()
+
+	_, portStr, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+
+	// Loopback hosts accept the self-signed test certificate
+	scans := Discover([]string{"127.0.0.1", "localhost"}, port, port, 2*time.Second)
+	require.Len(t, scans, 2)
+	for i, host := range []string{"127.0.0.1", "localhost"} {
+		require.Equal(t, host, scans[i].Host)
+		require.Len(t, scans[i].Components, 1)
+		require.Equal(t, port, scans[i].Components[0].Port)
+		require.Equal(t, "agent", scans[i].Components[0].Status["type"])
+		require.Zero(t, scans[i].TLSErrors)
+	}
+}
+
+func TestIsCertError(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// A verifying client rejects the self-signed certificate
+	_, err := (&http.Client{Timeout: 2 * time.Second}).Get(server.URL)
+	require.Error(t, err)
+	require.True(t, isCertError(err))
+
+	require.False(t, isCertError(errors.New("connection refused")))
+}
+
+func TestStatusURL(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "https://build-01:9000/status", statusURL("build-01", 9000))
+	require.Equal(t, "https://[::1]:9001/status", statusURL("::1", 9001))
+}
@@ -0,0 +1,433 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Interactive mode commands
+const (
+	CmdCancel = "/cancel"
+	CmdNew    = "/new"
+	CmdStatus = "/status"
+	CmdHelp   = "/help"
+	CmdQuit   = "/quit"
+)
+
+// DefaultInteractivePollInterval is how often a running task is polled.
+const DefaultInteractivePollInterval = 500 * time.Millisecond
+
+// InteractiveOptions configure an interactive session.
+type InteractiveOptions struct {
+	Timeout      time.Duration // Per-task timeout
+	Tier         string        // Optional model tier
+	AgentKind    string        // Optional agent kind (queue routing)
+	PollInterval time.Duration // Defaults to DefaultInteractivePollInterval
+}
+
+// interactive is the state of one REPL: the agent session prompts continue,
+// and the task currently running in it.
+type interactive struct {
+	d       *Director
+	opts    InteractiveOptions
+	out     io.Writer
+	lines   chan string
+	eof     bool
+	pending []string // Lines typed while a task was running, handled in order after it
+
+	sessionID string
+	agentURL  string // Agent holding the session
+
+	queueID   string
+	taskID    string
+	taskAgent string
+	state     string
+	position  int
+	logsShown int
+	cancelled bool
+}
+
+// Interactive reads prompts from in and runs each as a task in the same agent
+// session, streaming the agent's activity log and printing each result to
+// out. With a director URL, tasks go through the director queue so they wait
+// for the session's agent instead of failing when it is busy. Lines starting
+// with / are commands (see CmdHelp). Returns when in is exhausted or on /quit.
+func (d *Director) Interactive(in io.Reader, out io.Writer, opts InteractiveOptions) error {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultInteractivePollInterval
+	}
+	s := &interactive{d: d, opts: opts, out: out, lines: make(chan string)}
+	go func() {
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			s.lines <- scanner.Text()
+		}
+		close(s.lines)
+	}()
+
+	fmt.Fprintf(out, "Interactive mode: each prompt continues the same session. Type %s for commands.\n", CmdHelp)
+	for {
+		var line string
+		if len(s.pending) > 0 {
+			line, s.pending = s.pending[0], s.pending[1:]
+		} else {
+			if s.eof {
+				return nil
+			}
+			fmt.Fprint(out, "> ")
+			var ok bool
+			if line, ok = <-s.lines; !ok {
+				fmt.Fprintln(out)
+				return nil
+			}
+			line = strings.TrimSpace(line)
+		}
+		switch {
+		case line == "":
+		case line == CmdQuit:
+			return nil
+		case strings.HasPrefix(line, "/"):
+			s.command(line)
+		default:
+			if err := s.run(line); err != nil {
+				fmt.Fprintf(out, "Error: %v\n", err)
+			}
+		}
+	}
+}
+
+// command handles a command entered while no task is running.
+func (s *interactive) command(line string) {
+	switch line {
+	case CmdNew:
+		s.sessionID, s.agentURL = "", ""
+		fmt.Fprintln(s.out, "Started a new session")
+	case CmdStatus:
+		s.printStatus()
+	case CmdCancel:
+		fmt.Fprintln(s.out, "No task is running")
+	case CmdHelp:
+		s.printHelp()
+	default:
+		fmt.Fprintf(s.out, "Unknown command %s (type %s for commands)\n", line, CmdHelp)
+	}
+}
+
+func (s *interactive) printHelp() {
+	fmt.Fprintf(s.out, `Commands:
+  %-8s Cancel the running task
+  %-8s Start a new session for the next prompt
+  %-8s Show the session and current task
+  %-8s Exit
+`, CmdCancel, CmdNew, CmdStatus, CmdQuit)
+}
+
+func (s *interactive) printStatus() {
+	if s.sessionID == "" {
+		fmt.Fprintln(s.out, "Session: new (starts with the next prompt)")
+	} else {
+		fmt.Fprintf(s.out, "Session: %s (agent %s)\n", s.sessionID, s.agentURL)
+	}
+	switch {
+	case s.taskID != "":
+		fmt.Fprintf(s.out, "Task: %s %s on %s\n", s.taskID, s.state, s.taskAgent)
+	case s.queueID != "":
+		fmt.Fprintf(s.out, "Queued: %s %s (position %d)\n", s.queueID, s.state, s.position)
+	}
+}
+
+// run submits prompt and follows the task to completion, handling commands
+// typed meanwhile.
+func (s *interactive) run(prompt string) error {
+	if err := s.submit(prompt); err != nil {
+		return err
+	}
+	defer func() { s.queueID, s.taskID = "", "" }()
+
+	deadline := time.Now().Add(s.opts.Timeout)
+	ticker := time.NewTicker(s.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case line, ok := <-s.lines:
+			if !ok {
+				// Input closed; finish following the task, then exit
+				s.lines, s.eof = nil, true
+				continue
+			}
+			s.commandWhileRunning(strings.TrimSpace(line))
+		case <-ticker.C:
+			done, err := s.poll()
+			if err != nil || done {
+				return err
+			}
+			if s.opts.Timeout > 0 && time.Now().After(deadline) {
+				return fmt.Errorf("task did not complete within %s (still %s)", s.opts.Timeout, s.state)
+			}
+		}
+	}
+}
+
+// commandWhileRunning handles a line typed while a task runs. /cancel,
+// /status and /help act at once; anything else waits for the task to finish.
+func (s *interactive) commandWhileRunning(line string) {
+	switch line {
+	case "":
+	case CmdCancel:
+		s.cancel()
+	case CmdStatus:
+		s.printStatus()
+	case CmdHelp:
+		s.printHelp()
+	default:
+		s.pending = append(s.pending, line)
+		if !strings.HasPrefix(line, "/") {
+			fmt.Fprintln(s.out, "(prompt will run after the current task)")
+		}
+	}
+}
+
+// submit starts a task for prompt in the current session.
+func (s *interactive) submit(prompt string) error {
+	s.queueID, s.taskID, s.taskAgent = "", "", ""
+	s.state, s.position, s.logsShown, s.cancelled = "", 0, 0, false
+
+	req := map[string]any{
+		"prompt":          prompt,
+		"timeout_seconds": int(s.opts.Timeout.Seconds()),
+	}
+	if s.sessionID != "" {
+		req["session_id"] = s.sessionID
+	}
+	if s.opts.Tier != "" {
+		req["tier"] = s.opts.Tier
+	}
+
+	if s.d.directorURL != "" {
+		req["source"] = "cli"
+		if s.opts.AgentKind != "" {
+			req["agent_kind"] = s.opts.AgentKind
+		}
+		var resp struct {
+			QueueID  string `json:"queue_id"`
+			Position int    `json:"position"`
+			State    string `json:"state"`
+		}
+		if err := s.d.postJSON(s.d.directorURL+"/api/queue/task", req, &resp); err != nil {
+			return fmt.Errorf("queueing task: %w", err)
+		}
+		s.queueID, s.state, s.position = resp.QueueID, resp.State, resp.Position
+		fmt.Fprintf(s.out, "Queued %s (position %d)\n", s.queueID, s.position)
+		return nil
+	}
+
+	agentURL := s.agentURL
+	if agentURL == "" {
+		agentURL = s.d.agentURL
+	}
+	var resp struct {
+		TaskID    string `json:"task_id"`
+		SessionID string `json:"session_id"`
+	}
+	if err := s.d.postJSON(agentURL+"/task", req, &resp); err != nil {
+		return fmt.Errorf("submitting task: %w", err)
+	}
+	s.startTask(agentURL, resp.TaskID, resp.SessionID)
+	return nil
+}
+
+// startTask records the task now running for the session.
+func (s *interactive) startTask(agentURL, taskID, sessionID string) {
+	s.taskAgent, s.taskID, s.state = agentURL, taskID, "working"
+	s.agentURL = agentURL
+	if sessionID != "" {
+		s.sessionID = sessionID
+	}
+	fmt.Fprintf(s.out, "Task %s started on %s\n", taskID, agentURL)
+}
+
+// poll checks the task once, printing new activity, and reports whether it
+// has finished.
+func (s *interactive) poll() (bool, error) {
+	if s.taskID == "" {
+		return s.pollQueue()
+	}
+	s.showLogs()
+
+	resp, err := s.d.client.Get(s.taskAgent + "/task/" + url.PathEscape(s.taskID))
+	if err != nil {
+		return false, fmt.Errorf("polling task: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("polling task: status %d", resp.StatusCode)
+	}
+
+	var status struct {
+		State           string  `json:"state"`
+		Output          string  `json:"output"`
+		SessionID       string  `json:"session_id"`
+		DurationSeconds float64 `json:"duration_seconds"`
+		Error           *struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return false, fmt.Errorf("decoding task status: %w", err)
+	}
+	s.state = status.State
+	if status.SessionID != "" {
+		s.sessionID = status.SessionID
+	}
+	if !isTerminal(status.State) {
+		return false, nil
+	}
+
+	s.showLogs()
+	if status.Output != "" {
+		fmt.Fprintf(s.out, "\n%s\n\n", strings.TrimRight(status.Output, "\n"))
+	}
+	if status.Error != nil {
+		fmt.Fprintf(s.out, "Error: [%s] %s\n", status.Error.Type, status.Error.Message)
+	}
+	fmt.Fprintf(s.out, "[%s in %.1fs, session %s]\n", status.State, status.DurationSeconds, s.sessionID)
+	return true, nil
+}
+
+// pollQueue follows a task waiting in the director queue until it is
+// dispatched to an agent.
+func (s *interactive) pollQueue() (bool, error) {
+	resp, err := s.d.client.Get(s.d.directorURL + "/api/queue/" + url.PathEscape(s.queueID))
+	if err != nil {
+		return false, fmt.Errorf("polling queue: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		if s.cancelled {
+			fmt.Fprintln(s.out, "[cancelled before dispatch]")
+			return true, nil
+		}
+		return false, fmt.Errorf("queued task %s is no longer in the queue", s.queueID)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("polling queue: status %d", resp.StatusCode)
+	}
+
+	var detail struct {
+		State     string `json:"state"`
+		Position  int    `json:"position"`
+		TaskID    string `json:"task_id"`
+		AgentURL  string `json:"agent_url"`
+		LastError string `json:"last_error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&detail); err != nil {
+		return false, fmt.Errorf("decoding queue status: %w", err)
+	}
+
+	if detail.TaskID != "" && detail.AgentURL != "" {
+		s.startTask(detail.AgentURL, detail.TaskID, "")
+		return false, nil
+	}
+	if isTerminal(detail.State) {
+		fmt.Fprintf(s.out, "[%s in queue: %s]\n", detail.State, detail.LastError)
+		return true, nil
+	}
+	if detail.Position != s.position {
+		fmt.Fprintf(s.out, "Waiting in queue (position %d)\n", detail.Position)
+	}
+	s.state, s.position = detail.State, detail.Position
+	return false, nil
+}
+
+// showLogs prints the agent log entries for the task not yet shown.
+func (s *interactive) showLogs() {
+	q := url.Values{"task_id": {s.taskID}, "level": {"info"}, "limit": {"1000"}}
+	resp, err := s.d.client.Get(s.taskAgent + "/logs?" + q.Encode())
+	if err != nil {
+		return // Activity is best effort; the task poll reports real errors
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return
+	}
+
+	var logs struct {
+		Entries []struct {
+			Message string         `json:"message"`
+			Fields  map[string]any `json:"fields"`
+		} `json:"entries"`
+		Total int `json:"total"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&logs); err != nil {
+		return
+	}
+	fresh := min(logs.Total-s.logsShown, len(logs.Entries))
+	for _, e := range logs.Entries[len(logs.Entries)-max(fresh, 0):] {
+		var b strings.Builder
+		b.WriteString("  · ")
+		b.WriteString(e.Message)
+		for _, k := range slices.Sorted(maps.Keys(e.Fields)) {
+			fmt.Fprintf(&b, " %s=%v", k, e.Fields[k])
+		}
+		fmt.Fprintln(s.out, b.String())
+	}
+	s.logsShown = max(logs.Total, s.logsShown)
+}
+
+// cancel cancels the running task, through the queue when it was queued.
+func (s *interactive) cancel() {
+	target := s.taskAgent + "/task/" + url.PathEscape(s.taskID) + "/cancel"
+	if s.queueID != "" {
+		target = s.d.directorURL + "/api/queue/" + url.PathEscape(s.queueID) + "/cancel"
+	}
+	if err := s.d.postJSON(target, nil, nil); err != nil {
+		fmt.Fprintf(s.out, "Cancel failed: %v\n", err)
+		return
+	}
+	s.cancelled = true
+	fmt.Fprintln(s.out, "Cancel requested")
+}
+
+// postJSON posts body as JSON and decodes a 200 or 201 response into out.
+// Other responses become errors carrying the server's message.
+func (d *Director) postJSON(target string, body, out any) error {
+	data, _ := json.Marshal(body)
+	if body == nil {
+		data = nil
+	}
+	resp, err := d.client.Post(target, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		if apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+		return fmt.Errorf("%s (status %d)", apiErr.Message, resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func isTerminal(state string) bool {
+	return state == "completed" || state == "failed" || state == "cancelled"
+}
@@ -0,0 +1,197 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// sessionAgent is a mock agent that completes each task on its second poll
+// and records the session IDs it was sent.
+type sessionAgent struct {
+	mu        sync.Mutex
+	tasks     int
+	polls     map[string]int
+	sessions  []string
+	cancelled []string
+	hold      bool // Keep tasks working until cancelled
+}
+
+func newSessionAgent() *sessionAgent {
+	return &sessionAgent{polls: make(map[string]int)}
+}
+
+func (a *sessionAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/task":
+		var req map[string]any
+		json.NewDecoder(r.Body).Decode(&req)
+		sessionID, _ := req["session_id"].(string)
+		a.sessions = append(a.sessions, sessionID)
+		if sessionID == "" {
+			sessionID = fmt.Sprintf("session-%d", len(a.sessions))
+		}
+		a.tasks++
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{
+			"task_id":    fmt.Sprintf("task-%d", a.tasks),
+			"session_id": sessionID,
+		})
+
+	case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/cancel"):
+		taskID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/task/"), "/cancel")
+		a.cancelled = append(a.cancelled, taskID)
+		json.NewEncoder(w).Encode(map[string]string{"task_id": taskID, "state": "cancelled"})
+
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/task/"):
+		taskID := strings.TrimPrefix(r.URL.Path, "/task/")
+		a.polls[taskID]++
+		state := "working"
+		switch {
+		case len(a.cancelled) > 0 && a.cancelled[len(a.cancelled)-1] == taskID:
+			state = "cancelled"
+		case !a.hold && a.polls[taskID] >= 2:
+			state = "completed"
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"task_id":          taskID,
+			"state":            state,
+			"output":           "answer from " + taskID,
+			"duration_seconds": 1.5,
+		})
+
+	case r.Method == "GET" && r.URL.Path == "/logs":
+		json.NewEncoder(w).Encode(map[string]any{
+			"entries": []map[string]any{
+				{"message": "bash command", "fields": map[string]any{"cmd": "go test ./..."}},
+			},
+			"total": 1,
+		})
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func testInteractiveOptions() InteractiveOptions {
+	return InteractiveOptions{Timeout: 5 * time.Second, PollInterval: 10 * time.Millisecond}
+}
+
+func TestInteractiveContinuesSession(t *testing.T) {
+	t.Parallel()
+
+	agent := newSessionAgent()
+	server := httptest.NewServer(agent)
+	defer server.Close()
+
+	// Prompts piped in ahead of time run one after another; /status acts at once
+	in := strings.NewReader("first prompt\nsecond prompt\n/new\nthird prompt\n/status\n/quit\nignored\n")
+	var out bytes.Buffer
+	require.NoError(t, New(server.URL).Interactive(in, &out, testInteractiveOptions()))
+
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+	require.Equal(t, []string{"", "session-1", ""}, agent.sessions)
+
+	output := out.String()
+	require.Contains(t, output, "answer from task-1")
+	require.Contains(t, output, "answer from task-2")
+	require.Contains(t, output, "answer from task-3")
+	require.Contains(t, output, "bash command cmd=go test ./...")
+	require.Contains(t, output, "[completed in 1.5s, session session-1]")
+	require.Contains(t, output, "Started a new session")
+	require.Contains(t, output, "Session: session-1")
+	require.Equal(t, 3, strings.Count(output, "bash command"), "log entries are shown once per task")
+	require.Equal(t, 3, agent.tasks)
+}
+
+func TestInteractiveCancel(t *testing.T) {
+	t.Parallel()
+
+	agent := newSessionAgent()
+	agent.hold = true
+	server := httptest.NewServer(agent)
+	defer server.Close()
+
+	in := strings.NewReader("long prompt\n/cancel\n")
+	var out bytes.Buffer
+	require.NoError(t, New(server.URL).Interactive(in, &out, testInteractiveOptions()))
+
+	agent.mu.Lock()
+	require.Equal(t, []string{"task-1"}, agent.cancelled)
+	agent.mu.Unlock()
+	require.Contains(t, out.String(), "Cancel requested")
+	require.Contains(t, out.String(), "[cancelled in")
+}
+
+func TestInteractiveViaQueue(t *testing.T) {
+	t.Parallel()
+
+	agent := newSessionAgent()
+	agentServer := httptest.NewServer(agent)
+	defer agentServer.Close()
+
+	var mu sync.Mutex
+	var queued []map[string]any
+	polls := 0
+	director := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api/queue/task":
+			var req map[string]any
+			json.NewDecoder(r.Body).Decode(&req)
+			queued = append(queued, req)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]any{"queue_id": "queue-1", "position": 2, "state": "pending"})
+		case r.Method == "GET" && r.URL.Path == "/api/queue/queue-1":
+			polls++
+			if polls < 3 {
+				json.NewEncoder(w).Encode(map[string]any{"state": "pending", "position": 1})
+				return
+			}
+			// Dispatch the task to the agent
+			resp, err := http.Post(agentServer.URL+"/task", "application/json", strings.NewReader(`{}`))
+			require.NoError(t, err)
+			var task map[string]string
+			json.NewDecoder(resp.Body).Decode(&task)
+			resp.Body.Close()
+			json.NewEncoder(w).Encode(map[string]any{
+				"state": "working", "task_id": task["task_id"], "agent_url": agentServer.URL,
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer director.Close()
+
+	in := strings.NewReader("queued prompt\n")
+	var out bytes.Buffer
+	opts := testInteractiveOptions()
+	opts.Tier = "heavy"
+	require.NoError(t, New("", WithDirectorURL(director.URL)).Interactive(in, &out, opts))
+
+	mu.Lock()
+	require.Len(t, queued, 1)
+	require.Equal(t, "queued prompt", queued[0]["prompt"])
+	require.Equal(t, "heavy", queued[0]["tier"])
+	require.Equal(t, "cli", queued[0]["source"])
+	mu.Unlock()
+
+	output := out.String()
+	require.Contains(t, output, "Queued queue-1 (position 2)")
+	require.Contains(t, output, "Waiting in queue (position 1)")
+	require.Contains(t, output, "Task task-1 started on "+agentServer.URL)
+	require.Contains(t, output, "answer from task-1")
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"phobos.org.uk/agency/internal/api"
+)
+
+// listedAgent is the part of a director's GET /api/agents entry used to
+// pick an agent.
+type listedAgent struct {
+	URL       string   `json:"url"`
+	AgentKind string   `json:"agent_kind"`
+	Tiers     []string `json:"tiers"`
+	State     string   `json:"state"`
+}
+
+// PickIdleAgent asks the director at directorURL for its discovered agents
+// and returns the URL of an idle one that runs agentKind, preferring agents
+// that configure tier, then agents with the default tier mapping, as the
+// director's own routing does. It returns "" if no matching agent is idle.
+func PickIdleAgent(client *http.Client, directorURL, agentKind, tier string) (string, error) {
+	resp, err := client.Get(directorURL + "/api/agents")
+	if err != nil {
+		return "", fmt.Errorf("listing agents: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("listing agents: status %d", resp.StatusCode)
+	}
+	var agents []listedAgent
+	if err := json.NewDecoder(resp.Body).Decode(&agents); err != nil {
+		return "", fmt.Errorf("listing agents: %w", err)
+	}
+	return pickIdleAgent(agents, agentKind, tier), nil
+}
+
+func pickIdleAgent(agents []listedAgent, agentKind, tier string) string {
+	if agentKind == "" {
+		agentKind = api.AgentKindClaude
+	}
+	if tier == "" {
+		tier = api.TierStandard
+	}
+
+	best, bestRank := "", 3
+	for _, agent := range agents {
+		kind := agent.AgentKind
+		if kind == "" {
+			kind = api.AgentKindClaude // Agents that don't report a kind run Claude
+		}
+		if agent.State != "idle" || kind != agentKind {
+			continue
+		}
+		rank := 2 // Configures other tiers; the requested one falls back to defaults
+		switch {
+		case slices.Contains(agent.Tiers, tier):
+			rank = 0
+		case len(agent.Tiers) == 0:
+			rank = 1
+		}
+		if rank < bestRank {
+			best, bestRank = agent.URL, rank
+		}
+	}
+	return best
+}
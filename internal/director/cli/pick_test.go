@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPickIdleAgent(t *testing.T) {
+	t.Parallel()
+
+	agents := []listedAgent{
+		{URL: "https://a:9000", State: "working"},
+		{URL: "https://b:9000", State: "idle", AgentKind: "codex"},
+		{URL: "https://c:9000", State: "idle", Tiers: []string{"fast"}},
+		{URL: "https://d:9000", State: "idle"},
+		{URL: "https://e:9000", State: "idle", AgentKind: "claude", Tiers: []string{"heavy"}},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/agents", r.URL.Path)
+		json.NewEncoder(w).Encode(agents)
+	}))
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		kind, tier, want string
+	}{
+		{"claude", "heavy", "https://e:9000"},    // Configures the tier
+		{"claude", "standard", "https://d:9000"}, // Default tier mapping beats other tiers
+		{"", "", "https://d:9000"},
+		{"codex", "fast", "https://b:9000"},
+	}
+	for _, tt := range tests {
+		got, err := PickIdleAgent(srv.Client(), srv.URL, tt.kind, tt.tier)
+		require.NoError(t, err)
+		require.Equal(t, tt.want, got, tt.kind+"/"+tt.tier)
+	}
+
+	agents = agents[:1]
+	got, err := PickIdleAgent(srv.Client(), srv.URL, "claude", "standard")
+	require.NoError(t, err)
+	require.Empty(t, got)
+
+	_, err = PickIdleAgent(srv.Client(), "http://127.0.0.1:1", "claude", "")
+	require.Error(t, err)
+}
@@ -0,0 +1,23 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+)
+
+// ParseRunAt parses a queue -run-at value: an RFC 3339 timestamp, or a
+// local clock time (15:04) meaning its next occurrence after now.
+func ParseRunAt(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	clock, err := time.ParseInLocation("15:04", s, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("run-at must be an RFC 3339 time or HH:MM, got %q", s)
+	}
+	t := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRunAt(t *testing.T) {
+	t.Parallel()
+
+	loc := time.FixedZone("test", 3600)
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, loc)
+
+	got, err := ParseRunAt("02:00", now)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2026, 3, 11, 2, 0, 0, 0, loc), got, "tomorrow once today's has passed")
+
+	got, err = ParseRunAt("18:30", now)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2026, 3, 10, 18, 30, 0, 0, loc), got)
+
+	got, err = ParseRunAt("2026-04-01T09:00:00Z", now)
+	require.NoError(t, err)
+	require.True(t, got.Equal(time.Date(2026, 4, 1, 9, 0, 0, 0, time.UTC)))
+
+	_, err = ParseRunAt("tonight", now)
+	require.Error(t, err)
+}
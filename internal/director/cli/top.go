@@ -0,0 +1,167 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultTopInterval is how often ag-cli top refreshes.
+const DefaultTopInterval = 2 * time.Second
+
+// topRecent is how many recently finished tasks the monitor lists.
+const topRecent = 8
+
+// TopSnapshot is the part of the director's GET /api/dashboard shown by
+// ag-cli top.
+type TopSnapshot struct {
+	Agents []struct {
+		URL         string `json:"url"`
+		AgentKind   string `json:"agent_kind"`
+		State       string `json:"state"`
+		CurrentTask *struct {
+			ID            string `json:"id"`
+			StartedAt     string `json:"started_at"`
+			PromptPreview string `json:"prompt_preview"`
+		} `json:"current_task"`
+	} `json:"agents"`
+	Queue *struct {
+		Depth            int     `json:"depth"`
+		MaxSize          int     `json:"max_size"`
+		OldestAgeSeconds float64 `json:"oldest_age_seconds"`
+		DispatchedCount  int     `json:"dispatched_count"`
+	} `json:"queue"`
+	Sessions []struct {
+		AgentURL string `json:"agent_url"`
+		Tasks    []struct {
+			TaskID string `json:"task_id"`
+			State  string `json:"state"`
+			Prompt string `json:"prompt"`
+		} `json:"tasks"`
+		UpdatedAt time.Time `json:"updated_at"`
+	} `json:"sessions"`
+}
+
+// FetchTop reads the director's dashboard data.
+func FetchTop(client *http.Client, directorURL string) (*TopSnapshot, error) {
+	resp, err := client.Get(directorURL + "/api/dashboard")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("dashboard: status %d", resp.StatusCode)
+	}
+	var snap TopSnapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("dashboard: %w", err)
+	}
+	return &snap, nil
+}
+
+// RenderTop writes one frame of the monitor, fitting lines to width columns:
+// the agents with their states and current tasks, the queue, and the most
+// recently finished tasks.
+func RenderTop(w io.Writer, snap *TopSnapshot, directorURL string, now time.Time, width int) {
+	line := func(format string, args ...any) {
+		fmt.Fprintln(w, clip(fmt.Sprintf(format, args...), width))
+	}
+
+	line("ag-cli top - %s - %s", directorURL, now.Format("15:04:05"))
+	line("")
+
+	busy := 0
+	for _, agent := range snap.Agents {
+		if agent.State != "idle" {
+			busy++
+		}
+	}
+	line("AGENTS (%d, %d busy)", len(snap.Agents), busy)
+	if len(snap.Agents) == 0 {
+		line("  none discovered")
+	}
+	for _, agent := range snap.Agents {
+		kind := agent.AgentKind
+		if kind == "" {
+			kind = "claude"
+		}
+		task := ""
+		if agent.CurrentTask != nil {
+			task = oneLine(agent.CurrentTask.PromptPreview)
+			if started, err := time.Parse(time.RFC3339, agent.CurrentTask.StartedAt); err == nil {
+				task = fmt.Sprintf("%-6s %s", now.Sub(started).Round(time.Second), task)
+			}
+		}
+		line("  %-24s %-7s %-10s %s", hostPort(agent.URL), kind, agent.State, task)
+	}
+	line("")
+
+	if q := snap.Queue; q != nil {
+		oldest := ""
+		if q.OldestAgeSeconds > 0 {
+			oldest = fmt.Sprintf(", oldest %s", (time.Duration(q.OldestAgeSeconds) * time.Second).Round(time.Second))
+		}
+		line("QUEUE  %d/%d pending, %d dispatched%s", q.Depth, q.MaxSize, q.DispatchedCount, oldest)
+		line("")
+	}
+
+	line("RECENT")
+	recent := recentTasks(snap, topRecent)
+	if len(recent) == 0 {
+		line("  no finished tasks")
+	}
+	for _, r := range recent {
+		line("  %s  %-9s %-24s %s", r.at.In(now.Location()).Format("15:04"), r.state, hostPort(r.agentURL), oneLine(r.prompt))
+	}
+}
+
+type recentTask struct {
+	at       time.Time
+	state    string
+	agentURL string
+	prompt   string
+}
+
+// recentTasks returns the last finished task of the most recently updated
+// sessions, newest first. Sessions only record when they last changed, so
+// that time stands in for the task's.
+func recentTasks(snap *TopSnapshot, n int) []recentTask {
+	var recent []recentTask
+	for _, s := range snap.Sessions {
+		for i := len(s.Tasks) - 1; i >= 0; i-- {
+			if t := s.Tasks[i]; t.State == "completed" || t.State == "failed" || t.State == "cancelled" {
+				recent = append(recent, recentTask{at: s.UpdatedAt, state: t.State, agentURL: s.AgentURL, prompt: t.Prompt})
+				break
+			}
+		}
+	}
+	slices.SortFunc(recent, func(a, b recentTask) int { return b.at.Compare(a.at) })
+	return recent[:min(n, len(recent))]
+}
+
+// hostPort strips the scheme from a component URL.
+func hostPort(u string) string {
+	_, rest, found := strings.Cut(u, "://")
+	if !found {
+		return u
+	}
+	return rest
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// clip shortens s to width runes, marking the cut with an ellipsis.
+func clip(s string, width int) string {
+	s = strings.TrimRight(s, " ")
+	r := []rune(s)
+	if width <= 0 || len(r) <= width {
+		return s
+	}
+	return string(r[:width-1]) + "…"
+}
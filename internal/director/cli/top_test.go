@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const topDashboard = `{
+	"agents": [
+		{"url": "https://build-01:9000", "state": "working", "current_task": {"id": "t1", "started_at": "2026-03-14T11:58:30Z", "prompt_preview": "Fix the\nflaky test"}},
+		{"url": "https://build-01:9001", "agent_kind": "codex", "state": "idle"}
+	],
+	"queue": {"depth": 2, "max_size": 50, "oldest_age_seconds": 95, "dispatched_count": 1},
+	"sessions": [
+		{"agent_url": "https://build-01:9000", "updated_at": "2026-03-14T11:50:00Z", "tasks": [{"state": "completed", "prompt": "Older"}]},
+		{"agent_url": "https://build-01:9001", "updated_at": "2026-03-14T11:55:00Z", "tasks": [{"state": "failed", "prompt": "Newer"}, {"state": "working", "prompt": "Running"}]},
+		{"agent_url": "https://build-01:9001", "updated_at": "2026-03-14T11:56:00Z", "tasks": [{"state": "working", "prompt": "Never finished"}]}
+	]
+}`
+
+func TestTop(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/dashboard", r.URL.Path)
+		w.Write([]byte(topDashboard))
+	}))
+	t.Cleanup(srv.Close)
+
+	snap, err := FetchTop(srv.Client(), srv.URL)
+	require.NoError(t, err)
+
+	var b strings.Builder
+	RenderTop(&b, snap, srv.URL, time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC), 80)
+	out := b.String()
+	require.Contains(t, out, "AGENTS (2, 1 busy)")
+	require.Contains(t, out, "build-01:9000            claude  working    1m30s  Fix the flaky test")
+	require.Contains(t, out, "build-01:9001            codex   idle\n")
+	require.Contains(t, out, "QUEUE  2/50 pending, 1 dispatched, oldest 1m35s")
+	require.Less(t, strings.Index(out, "Newer"), strings.Index(out, "Older"), "newest first")
+	require.NotContains(t, out, "Never finished")
+	for _, line := range strings.Split(out, "\n") {
+		require.LessOrEqual(t, len([]rune(line)), 80, line)
+	}
+
+	_, err = FetchTop(srv.Client(), "http://127.0.0.1:1")
+	require.Error(t, err)
+}
+
+func TestClip(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "short", clip("short  ", 10))
+	require.Equal(t, "abcd…", clip("abcdefgh", 5))
+	require.Equal(t, "abcdefgh", clip("abcdefgh", 0))
+}
@@ -0,0 +1,112 @@
+package history
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Task ratings
+const (
+	RatingGood = "good"
+	RatingBad  = "bad"
+)
+
+// Annotation limits
+const (
+	MaxNotesLength = 4000
+	MaxTags        = 20
+	MaxTagLength   = 40
+)
+
+// tagPattern matches annotation tags once lowercased.
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// Annotation is a user's feedback on a finished task, for building datasets
+// of good and bad results.
+type Annotation struct {
+	Rating    string    `json:"rating,omitempty"` // RatingGood or RatingBad
+	Notes     string    `json:"notes,omitempty"`
+	Tags      []string  `json:"tags,omitempty"` // Lowercase, sorted
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AnnotationUpdate changes an entry's annotation. Fields left nil are kept;
+// an empty rating, notes or tag list clears that field.
+type AnnotationUpdate struct {
+	Rating *string   `json:"rating,omitempty"`
+	Notes  *string   `json:"notes,omitempty"`
+	Tags   *[]string `json:"tags,omitempty"`
+}
+
+// Validate checks the update, lowercasing, sorting and deduplicating its tags.
+func (u *AnnotationUpdate) Validate() error {
+	if u.Rating != nil {
+		switch *u.Rating {
+		case "", RatingGood, RatingBad:
+		default:
+			return fmt.Errorf("rating must be good, bad or empty, got %q", *u.Rating)
+		}
+	}
+	if u.Notes != nil && len(*u.Notes) > MaxNotesLength {
+		return fmt.Errorf("notes must be at most %d bytes", MaxNotesLength)
+	}
+	if u.Tags != nil {
+		tags := make([]string, 0, len(*u.Tags))
+		for _, tag := range *u.Tags {
+			tag = strings.ToLower(strings.TrimSpace(tag))
+			if len(tag) > MaxTagLength || !tagPattern.MatchString(tag) {
+				return fmt.Errorf("tag %q must be 1-%d letters, digits, dots, dashes or underscores", tag, MaxTagLength)
+			}
+			tags = append(tags, tag)
+		}
+		slices.Sort(tags)
+		tags = slices.Compact(tags)
+		if len(tags) > MaxTags {
+			return fmt.Errorf("at most %d tags are allowed", MaxTags)
+		}
+		u.Tags = &tags
+	}
+	return nil
+}
+
+// Annotate applies a validated update to a task's annotation and persists the
+// entry. An annotation left with no rating, notes or tags is removed.
+func (s *Store) Annotate(taskID string, update AnnotationUpdate) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[taskID]
+	if !ok {
+		return nil, fmt.Errorf("%s not found in history", taskID)
+	}
+
+	var ann Annotation
+	if entry.Annotation != nil {
+		ann = *entry.Annotation
+	}
+	if update.Rating != nil {
+		ann.Rating = *update.Rating
+	}
+	if update.Notes != nil {
+		ann.Notes = *update.Notes
+	}
+	if update.Tags != nil {
+		ann.Tags = *update.Tags
+	}
+	ann.UpdatedAt = time.Now().UTC()
+
+	// Entries handed out by Get are shared, so the update goes on a copy
+	updated := *entry
+	updated.Annotation = &ann
+	if ann.Rating == "" && ann.Notes == "" && len(ann.Tags) == 0 {
+		updated.Annotation = nil
+	}
+	if err := writeJSON(s.outlinePath(taskID), &updated); err != nil {
+		return nil, fmt.Errorf("saving annotation: %w", err)
+	}
+	s.entries[taskID] = &updated
+	return &updated, nil
+}
@@ -0,0 +1,81 @@
+package history
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotationUpdateValidate(t *testing.T) {
+	t.Parallel()
+
+	str := func(s string) *string { return &s }
+	tags := func(t ...string) *[]string { return &t }
+
+	update := AnnotationUpdate{Rating: str(RatingGood), Tags: tags(" Refactor", "flaky-test", "refactor")}
+	require.NoError(t, update.Validate())
+	require.Equal(t, []string{"flaky-test", "refactor"}, *update.Tags)
+
+	require.NoError(t, (&AnnotationUpdate{Rating: str("")}).Validate())
+	require.ErrorContains(t, (&AnnotationUpdate{Rating: str("great")}).Validate(), "rating must be")
+	require.ErrorContains(t, (&AnnotationUpdate{Notes: str(strings.Repeat("x", MaxNotesLength+1))}).Validate(), "notes")
+	require.ErrorContains(t, (&AnnotationUpdate{Tags: tags("two words")}).Validate(), "tag")
+	require.ErrorContains(t, (&AnnotationUpdate{Tags: tags("")}).Validate(), "tag")
+	many := make([]string, MaxTags+1)
+	for i := range many {
+		many[i] = strings.Repeat("t", i+1)
+	}
+	require.ErrorContains(t, (&AnnotationUpdate{Tags: &many}).Validate(), "at most")
+}
+
+func TestStore_Annotate(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	require.NoError(t, err)
+	now := time.Now()
+	require.NoError(t, store.Save(&Entry{TaskID: "task-1", Prompt: "fix auth", CompletedAt: now}))
+	require.NoError(t, store.Save(&Entry{TaskID: "task-2", Prompt: "fix build", CompletedAt: now.Add(time.Second)}))
+
+	str := func(s string) *string { return &s }
+	before, err := store.Get("task-1")
+	require.NoError(t, err)
+	entry, err := store.Annotate("task-1", AnnotationUpdate{Rating: str(RatingBad), Notes: str("Broke the login page"), Tags: &[]string{"regression"}})
+	require.NoError(t, err)
+	require.Equal(t, RatingBad, entry.Annotation.Rating)
+	require.False(t, entry.Annotation.UpdatedAt.IsZero())
+	require.Nil(t, before.Annotation) // Entries already handed out are unchanged
+
+	// Fields left out are kept
+	entry, err = store.Annotate("task-1", AnnotationUpdate{Rating: str(RatingGood)})
+	require.NoError(t, err)
+	require.Equal(t, RatingGood, entry.Annotation.Rating)
+	require.Equal(t, "Broke the login page", entry.Annotation.Notes)
+	require.Equal(t, []string{"regression"}, entry.Annotation.Tags)
+
+	// Annotations survive a reload and filter listings
+	reloaded, err := NewStore(dir)
+	require.NoError(t, err)
+	got, err := reloaded.Get("task-1")
+	require.NoError(t, err)
+	require.Equal(t, entry.Annotation.Notes, got.Annotation.Notes)
+
+	result := reloaded.List(ListOptions{Rating: RatingGood})
+	require.Len(t, result.Entries, 1)
+	require.Equal(t, "task-1", result.Entries[0].TaskID)
+	require.Equal(t, RatingGood, result.Entries[0].Annotation.Rating)
+	require.Len(t, reloaded.List(ListOptions{Tag: "Regression"}).Entries, 1)
+	require.Empty(t, reloaded.List(ListOptions{Rating: RatingBad}).Entries)
+	require.Len(t, reloaded.List(ListOptions{Query: "login page"}).Entries, 1) // Notes are searched
+
+	// Clearing every field removes the annotation
+	entry, err = reloaded.Annotate("task-1", AnnotationUpdate{Rating: str(""), Notes: str(""), Tags: &[]string{}})
+	require.NoError(t, err)
+	require.Nil(t, entry.Annotation)
+
+	_, err = reloaded.Annotate("task-missing", AnnotationUpdate{Rating: str(RatingGood)})
+	require.Error(t, err)
+}
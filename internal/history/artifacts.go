@@ -0,0 +1,104 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Artifact describes a file collected from a task's working directory.
+type Artifact struct {
+	Name string `json:"name"` // Path relative to the session workdir (slash-separated)
+	Size int64  `json:"size"`
+}
+
+// SaveArtifact stores a file produced by a task under the given relative name.
+func (s *Store) SaveArtifact(taskID, name string, data []byte) error {
+	path, err := s.artifactPath(taskID, name)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("creating artifact directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("saving artifact: %w", err)
+	}
+
+	if entry, ok := s.entries[taskID]; ok {
+		entry.Artifacts = upsertArtifact(entry.Artifacts, Artifact{Name: name, Size: int64(len(data))})
+		if err := writeJSON(s.outlinePath(taskID), entry); err != nil {
+			return fmt.Errorf("updating outline: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ListArtifacts returns the artifacts stored for a task.
+func (s *Store) ListArtifacts(taskID string) ([]Artifact, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, ok := s.entries[taskID]
+	if !ok {
+		return nil, fmt.Errorf("%s not found in history", taskID)
+	}
+	artifacts := make([]Artifact, len(entry.Artifacts))
+	copy(artifacts, entry.Artifacts)
+	return artifacts, nil
+}
+
+// GetArtifact retrieves the contents of a stored artifact.
+func (s *Store) GetArtifact(taskID, name string) ([]byte, error) {
+	path, err := s.artifactPath(taskID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("artifact %s for %s not found", name, taskID)
+		}
+		return nil, fmt.Errorf("reading artifact: %w", err)
+	}
+	return data, nil
+}
+
+// artifactPath resolves an artifact name to a path inside the task's
+// artifact directory, rejecting names that would escape it.
+func (s *Store) artifactPath(taskID, name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if name == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid artifact name %q", name)
+	}
+	return filepath.Join(s.artifactsDir(taskID), clean), nil
+}
+
+func (s *Store) artifactsDir(taskID string) string {
+	return filepath.Join(s.dir, taskID+".artifacts")
+}
+
+func upsertArtifact(artifacts []Artifact, a Artifact) []Artifact {
+	for i := range artifacts {
+		if artifacts[i].Name == a.Name {
+			artifacts[i] = a
+			return artifacts
+		}
+	}
+	artifacts = append(artifacts, a)
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].Name < artifacts[j].Name
+	})
+	return artifacts
+}
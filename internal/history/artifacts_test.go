@@ -0,0 +1,52 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Artifacts(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Save(&Entry{TaskID: "task-art", CompletedAt: time.Now()}))
+
+	require.NoError(t, store.SaveArtifact("task-art", "reports/summary.md", []byte("# Summary")))
+	require.NoError(t, store.SaveArtifact("task-art", "out.txt", []byte("hi")))
+
+	artifacts, err := store.ListArtifacts("task-art")
+	require.NoError(t, err)
+	require.Equal(t, []Artifact{
+		{Name: "out.txt", Size: 2},
+		{Name: "reports/summary.md", Size: 9},
+	}, artifacts)
+
+	data, err := store.GetArtifact("task-art", "reports/summary.md")
+	require.NoError(t, err)
+	require.Equal(t, "# Summary", string(data))
+
+	// Artifacts listing survives a reload
+	reloaded, err := NewStore(dir)
+	require.NoError(t, err)
+	artifacts, err = reloaded.ListArtifacts("task-art")
+	require.NoError(t, err)
+	require.Len(t, artifacts, 2)
+}
+
+func TestStore_ArtifactNameValidation(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	for _, name := range []string{"", "../escape.txt", "a/../../escape.txt", "/etc/passwd"} {
+		require.Error(t, store.SaveArtifact("task-x", name, []byte("x")), name)
+		_, err := store.GetArtifact("task-x", name)
+		require.Error(t, err, name)
+	}
+}
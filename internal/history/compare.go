@@ -0,0 +1,189 @@
+package history
+
+import (
+	"bytes"
+	"time"
+	"unicode/utf8"
+
+	"phobos.org.uk/agency/internal/textdiff"
+)
+
+// maxCompareTextBytes bounds artifact contents that are diffed line by line.
+// Larger or binary artifacts are only compared for equality.
+const maxCompareTextBytes = 1 << 20
+
+// Artifact comparison statuses.
+const (
+	ArtifactAdded     = "added"
+	ArtifactRemoved   = "removed"
+	ArtifactChanged   = "changed"
+	ArtifactUnchanged = "unchanged"
+)
+
+// Comparison is a structured diff between two history entries.
+type Comparison struct {
+	A           CompareSide            `json:"a"`
+	B           CompareSide            `json:"b"`
+	Output      textdiff.Result        `json:"output"`
+	FileChanges []FileChangeComparison `json:"file_changes,omitempty"`
+	Artifacts   []ArtifactComparison   `json:"artifacts,omitempty"`
+}
+
+// CompareSide identifies one side of a comparison.
+type CompareSide struct {
+	TaskID        string    `json:"task_id"`
+	State         string    `json:"state"`
+	PromptPreview string    `json:"prompt_preview"`
+	Model         string    `json:"model"`
+	CompletedAt   time.Time `json:"completed_at"`
+}
+
+// ArtifactComparison describes how a single artifact differs between entries.
+type ArtifactComparison struct {
+	Name   string           `json:"name"`
+	Status string           `json:"status"`         // added, removed, changed, unchanged
+	SizeA  int64            `json:"size_a"`         // 0 when absent from A
+	SizeB  int64            `json:"size_b"`         // 0 when absent from B
+	Diff   *textdiff.Result `json:"diff,omitempty"` // Line diff for changed text artifacts
+}
+
+// FileChangeComparison describes how the edits to one file differ between
+// entries. Statuses are those of artifacts: added and removed files were
+// only touched by B or A.
+type FileChangeComparison struct {
+	Path       string           `json:"path"`
+	Status     string           `json:"status"`
+	AdditionsA int              `json:"additions_a"`
+	DeletionsA int              `json:"deletions_a"`
+	AdditionsB int              `json:"additions_b"`
+	DeletionsB int              `json:"deletions_b"`
+	Diff       *textdiff.Result `json:"diff,omitempty"` // Line diff of the two edit snippets, when changed
+}
+
+// Compare computes a structured diff from task a to task b, covering the
+// final output, file changes and any collected artifacts.
+func (s *Store) Compare(aID, bID string) (*Comparison, error) {
+	a, err := s.Get(aID)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.Get(bID)
+	if err != nil {
+		return nil, err
+	}
+
+	cmp := CompareEntries(a, b)
+
+	artifactsA, _ := s.ListArtifacts(aID)
+	artifactsB, _ := s.ListArtifacts(bID)
+	sizesB := make(map[string]int64, len(artifactsB))
+	for _, art := range artifactsB {
+		sizesB[art.Name] = art.Size
+	}
+
+	seen := make(map[string]bool, len(artifactsA))
+	for _, art := range artifactsA {
+		seen[art.Name] = true
+		sizeB, inB := sizesB[art.Name]
+		if !inB {
+			cmp.Artifacts = append(cmp.Artifacts, ArtifactComparison{
+				Name: art.Name, Status: ArtifactRemoved, SizeA: art.Size,
+			})
+			continue
+		}
+		cmp.Artifacts = append(cmp.Artifacts, s.compareArtifact(aID, bID, art.Name, art.Size, sizeB))
+	}
+	for _, art := range artifactsB {
+		if !seen[art.Name] {
+			cmp.Artifacts = append(cmp.Artifacts, ArtifactComparison{
+				Name: art.Name, Status: ArtifactAdded, SizeB: art.Size,
+			})
+		}
+	}
+
+	return cmp, nil
+}
+
+// CompareEntries diffs the output and file changes of two entries, which
+// may come from different stores. Artifacts are left to Store.Compare.
+func CompareEntries(a, b *Entry) *Comparison {
+	cmp := &Comparison{
+		A:      compareSide(a),
+		B:      compareSide(b),
+		Output: textdiff.Compare(a.Output, b.Output),
+	}
+
+	changesB := make(map[string]FileChange, len(b.FileChanges))
+	for _, change := range b.FileChanges {
+		changesB[change.Path] = change
+	}
+	seen := make(map[string]bool, len(a.FileChanges))
+	for _, ca := range a.FileChanges {
+		seen[ca.Path] = true
+		result := FileChangeComparison{Path: ca.Path, AdditionsA: ca.Additions, DeletionsA: ca.Deletions}
+		cb, inB := changesB[ca.Path]
+		switch {
+		case !inB:
+			result.Status = ArtifactRemoved
+		case ca.Diff == cb.Diff && ca.Additions == cb.Additions && ca.Deletions == cb.Deletions:
+			result.Status = ArtifactUnchanged
+		default:
+			result.Status = ArtifactChanged
+			diff := textdiff.Compare(ca.Diff, cb.Diff)
+			result.Diff = &diff
+		}
+		if inB {
+			result.AdditionsB, result.DeletionsB = cb.Additions, cb.Deletions
+		}
+		cmp.FileChanges = append(cmp.FileChanges, result)
+	}
+	for _, cb := range b.FileChanges {
+		if !seen[cb.Path] {
+			cmp.FileChanges = append(cmp.FileChanges, FileChangeComparison{
+				Path: cb.Path, Status: ArtifactAdded, AdditionsB: cb.Additions, DeletionsB: cb.Deletions,
+			})
+		}
+	}
+	return cmp
+}
+
+func (s *Store) compareArtifact(aID, bID, name string, sizeA, sizeB int64) ArtifactComparison {
+	result := ArtifactComparison{Name: name, SizeA: sizeA, SizeB: sizeB}
+
+	dataA, errA := s.GetArtifact(aID, name)
+	dataB, errB := s.GetArtifact(bID, name)
+	if errA != nil || errB != nil {
+		// Can't read contents; fall back to comparing sizes
+		result.Status = ArtifactUnchanged
+		if sizeA != sizeB {
+			result.Status = ArtifactChanged
+		}
+		return result
+	}
+
+	if bytes.Equal(dataA, dataB) {
+		result.Status = ArtifactUnchanged
+		return result
+	}
+
+	result.Status = ArtifactChanged
+	if isComparableText(dataA) && isComparableText(dataB) {
+		diff := textdiff.Compare(string(dataA), string(dataB))
+		result.Diff = &diff
+	}
+	return result
+}
+
+func compareSide(e *Entry) CompareSide {
+	return CompareSide{
+		TaskID:        e.TaskID,
+		State:         e.State,
+		PromptPreview: e.PromptPreview,
+		Model:         e.Model,
+		CompletedAt:   e.CompletedAt,
+	}
+}
+
+func isComparableText(data []byte) bool {
+	return len(data) <= maxCompareTextBytes && utf8.Valid(data) && !bytes.ContainsRune(data, 0)
+}
@@ -0,0 +1,88 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"phobos.org.uk/agency/internal/textdiff"
+)
+
+func TestStore_Compare(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	require.NoError(t, store.Save(&Entry{TaskID: "task-a", State: "completed", Output: "hello\nworld", CompletedAt: time.Now()}))
+	require.NoError(t, store.Save(&Entry{TaskID: "task-b", State: "completed", Output: "hello\nthere", CompletedAt: time.Now()}))
+
+	require.NoError(t, store.SaveArtifact("task-a", "same.txt", []byte("x")))
+	require.NoError(t, store.SaveArtifact("task-b", "same.txt", []byte("x")))
+	require.NoError(t, store.SaveArtifact("task-a", "notes.md", []byte("one\ntwo\n")))
+	require.NoError(t, store.SaveArtifact("task-b", "notes.md", []byte("one\n2\n")))
+	require.NoError(t, store.SaveArtifact("task-a", "old.bin", []byte{0, 1}))
+	require.NoError(t, store.SaveArtifact("task-b", "new.txt", []byte("new")))
+
+	cmp, err := store.Compare("task-a", "task-b")
+	require.NoError(t, err)
+	require.Equal(t, "task-a", cmp.A.TaskID)
+	require.Equal(t, "task-b", cmp.B.TaskID)
+	require.Equal(t, 1, cmp.Output.Additions)
+	require.Equal(t, 1, cmp.Output.Deletions)
+
+	byName := make(map[string]ArtifactComparison)
+	for _, a := range cmp.Artifacts {
+		byName[a.Name] = a
+	}
+	require.Len(t, byName, 4)
+	require.Equal(t, ArtifactUnchanged, byName["same.txt"].Status)
+	require.Equal(t, ArtifactRemoved, byName["old.bin"].Status)
+	require.Equal(t, ArtifactAdded, byName["new.txt"].Status)
+
+	notes := byName["notes.md"]
+	require.Equal(t, ArtifactChanged, notes.Status)
+	require.NotNil(t, notes.Diff)
+	require.Equal(t, textdiff.Line{Kind: textdiff.Insert, Text: "2", NewLine: 2}, notes.Diff.Lines[2])
+
+	_, err = store.Compare("task-a", "missing")
+	require.Error(t, err)
+}
+
+func TestCompareEntries_FileChanges(t *testing.T) {
+	t.Parallel()
+
+	a := &Entry{TaskID: "task-a", Output: "done", FileChanges: []FileChange{
+		{Path: "main.go", Operation: "edit", Additions: 1, Deletions: 1, Diff: "-old\n+new"},
+		{Path: "same.go", Operation: "write", Additions: 3, Diff: "+a\n+b\n+c"},
+		{Path: "gone.go", Operation: "edit", Deletions: 2},
+	}}
+	b := &Entry{TaskID: "task-b", Output: "done", FileChanges: []FileChange{
+		{Path: "main.go", Operation: "edit", Additions: 1, Deletions: 1, Diff: "-old\n+newer"},
+		{Path: "same.go", Operation: "write", Additions: 3, Diff: "+a\n+b\n+c"},
+		{Path: "added.go", Operation: "write", Additions: 5},
+	}}
+
+	cmp := CompareEntries(a, b)
+	require.Zero(t, cmp.Output.Additions+cmp.Output.Deletions)
+	require.Empty(t, cmp.Artifacts)
+
+	byPath := make(map[string]FileChangeComparison)
+	for _, c := range cmp.FileChanges {
+		byPath[c.Path] = c
+	}
+	require.Len(t, byPath, 4)
+	require.Equal(t, ArtifactUnchanged, byPath["same.go"].Status)
+	require.Nil(t, byPath["same.go"].Diff)
+	require.Equal(t, ArtifactRemoved, byPath["gone.go"].Status)
+	require.Equal(t, 2, byPath["gone.go"].DeletionsA)
+	require.Equal(t, ArtifactAdded, byPath["added.go"].Status)
+	require.Equal(t, 5, byPath["added.go"].AdditionsB)
+
+	main := byPath["main.go"]
+	require.Equal(t, ArtifactChanged, main.Status)
+	require.NotNil(t, main.Diff)
+	require.Equal(t, 1, main.Diff.Additions)
+	require.Equal(t, 1, main.Diff.Deletions)
+}
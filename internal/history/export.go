@@ -0,0 +1,162 @@
+package history
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export formats
+const (
+	ExportJSONL = "jsonl"
+	ExportCSV   = "csv"
+)
+
+// ExportRecord is a history entry flattened for loading into spreadsheets
+// and warehouses. Every record has the same fields, empty when unknown.
+type ExportRecord struct {
+	TaskID          string    `json:"task_id"`
+	AgentID         string    `json:"agent_id"`
+	SessionID       string    `json:"session_id"`
+	RerunOf         string    `json:"rerun_of"`
+	State           string    `json:"state"`
+	Model           string    `json:"model"`
+	Tier            string    `json:"tier"`
+	Prompt          string    `json:"prompt"`
+	StartedAt       time.Time `json:"started_at"`
+	CompletedAt     time.Time `json:"completed_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	ExitCode        *int      `json:"exit_code"`
+	InputTokens     int       `json:"input_tokens"`
+	OutputTokens    int       `json:"output_tokens"`
+	ErrorType       string    `json:"error_type"`
+	ErrorMessage    string    `json:"error_message"`
+	PromptFile      string    `json:"agency_prompt_file"`
+	PromptHash      string    `json:"agency_prompt_hash"`
+	Experiment      string    `json:"experiment"`
+	Arm             string    `json:"arm"`
+	Rating          string    `json:"rating"`
+	Notes           string    `json:"notes"`
+	Tags            []string  `json:"tags"`
+}
+
+// exportColumns are the CSV header, in the order of ExportRecord's fields.
+var exportColumns = []string{
+	"task_id", "agent_id", "session_id", "rerun_of", "state", "model", "tier", "prompt",
+	"started_at", "completed_at", "duration_seconds", "exit_code", "input_tokens",
+	"output_tokens", "error_type", "error_message", "agency_prompt_file",
+	"agency_prompt_hash", "experiment", "arm", "rating", "notes", "tags",
+}
+
+// Export returns the entries completed at or after since, oldest first. A
+// zero since exports everything.
+func (s *Store) Export(since time.Time) []ExportRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := make([]*Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		if e.CompletedAt.Before(since) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sortOldestFirst(entries)
+
+	records := make([]ExportRecord, 0, len(entries))
+	for _, e := range entries {
+		records = append(records, exportRecord(e))
+	}
+	return records
+}
+
+func exportRecord(e *Entry) ExportRecord {
+	rec := ExportRecord{
+		TaskID:          e.TaskID,
+		AgentID:         e.AgentID,
+		SessionID:       e.SessionID,
+		RerunOf:         e.RerunOf,
+		State:           e.State,
+		Model:           e.Model,
+		Tier:            e.Tier,
+		Prompt:          e.Prompt,
+		StartedAt:       e.StartedAt,
+		CompletedAt:     e.CompletedAt,
+		DurationSeconds: e.DurationSeconds,
+		ExitCode:        e.ExitCode,
+		Tags:            []string{},
+	}
+	if e.TokenUsage != nil {
+		rec.InputTokens = e.TokenUsage.Input
+		rec.OutputTokens = e.TokenUsage.Output
+	}
+	if e.Error != nil {
+		rec.ErrorType = e.Error.Type
+		rec.ErrorMessage = e.Error.Message
+	}
+	if p := e.AgencyPrompt; p != nil {
+		rec.PromptFile, rec.PromptHash = p.File, p.Hash
+		rec.Experiment, rec.Arm = p.Experiment, p.Arm
+	}
+	if a := e.Annotation; a != nil {
+		rec.Rating, rec.Notes = a.Rating, a.Notes
+		rec.Tags = append(rec.Tags, a.Tags...)
+	}
+	return rec
+}
+
+// WriteExport writes records to w as JSON Lines or as CSV with a header row.
+func WriteExport(w io.Writer, format string, records []ExportRecord) error {
+	switch format {
+	case ExportJSONL:
+		enc := json.NewEncoder(w)
+		for i := range records {
+			if err := enc.Encode(&records[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case ExportCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(exportColumns); err != nil {
+			return err
+		}
+		for i := range records {
+			if err := cw.Write(records[i].csvRow()); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown export format %q (want %s or %s)", format, ExportJSONL, ExportCSV)
+	}
+}
+
+// csvRow formats the record in exportColumns order. Times are RFC 3339 in
+// UTC and tags are space separated.
+func (r *ExportRecord) csvRow() []string {
+	exitCode := ""
+	if r.ExitCode != nil {
+		exitCode = strconv.Itoa(*r.ExitCode)
+	}
+	return []string{
+		r.TaskID, r.AgentID, r.SessionID, r.RerunOf, r.State, r.Model, r.Tier, r.Prompt,
+		csvTime(r.StartedAt), csvTime(r.CompletedAt),
+		strconv.FormatFloat(r.DurationSeconds, 'f', -1, 64), exitCode,
+		strconv.Itoa(r.InputTokens), strconv.Itoa(r.OutputTokens),
+		r.ErrorType, r.ErrorMessage, r.PromptFile, r.PromptHash, r.Experiment, r.Arm,
+		r.Rating, r.Notes, strings.Join(r.Tags, " "),
+	}
+}
+
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,83 @@
+package history
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Export(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	exitCode := 1
+	entries := []*Entry{
+		{TaskID: "task-old", State: "completed", Prompt: "old", StartedAt: base.Add(-48 * time.Hour), CompletedAt: base.Add(-47 * time.Hour)},
+		{TaskID: "task-2", SessionID: "sess-1", State: "failed", Model: "opus", Tier: "heavy", Prompt: "fix \"auth\",\nplease",
+			StartedAt: base.Add(time.Hour), CompletedAt: base.Add(time.Hour + 90*time.Second), DurationSeconds: 90, ExitCode: &exitCode,
+			Error:      &EntryError{Type: "timeout", Message: "task timed out"},
+			Annotation: &Annotation{Rating: RatingBad, Notes: "gave up", Tags: []string{"auth", "flaky"}}},
+		{TaskID: "task-1", SessionID: "sess-1", State: "completed", Model: "sonnet", Prompt: "add tests",
+			StartedAt: base, CompletedAt: base.Add(30 * time.Second), DurationSeconds: 30.5,
+			TokenUsage:   &TokenUsage{Input: 1200, Output: 300},
+			AgencyPrompt: &PromptStamp{File: "claude-prod.md", Hash: "abc123", Experiment: "terse", Arm: ArmVariant}},
+	}
+	for _, e := range entries {
+		require.NoError(t, store.Save(e))
+	}
+
+	records := store.Export(base)
+	require.Len(t, records, 2)
+	require.Equal(t, "task-1", records[0].TaskID) // Oldest first
+	require.Equal(t, 1200, records[0].InputTokens)
+	require.Equal(t, "terse", records[0].Experiment)
+	require.Empty(t, records[0].Tags)
+	require.Equal(t, "timeout", records[1].ErrorType)
+	require.Equal(t, RatingBad, records[1].Rating)
+	require.Len(t, store.Export(time.Time{}), 3)
+
+	var jsonl bytes.Buffer
+	require.NoError(t, WriteExport(&jsonl, ExportJSONL, records))
+	lines := strings.Split(strings.TrimSpace(jsonl.String()), "\n")
+	require.Len(t, lines, 2)
+	var row map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &row))
+	require.Equal(t, "task-2", row["task_id"])
+	require.Equal(t, float64(1), row["exit_code"])
+	require.Equal(t, []any{"auth", "flaky"}, row["tags"])
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &row))
+	require.Nil(t, row["exit_code"])
+	require.Equal(t, []any{}, row["tags"])
+
+	var out bytes.Buffer
+	require.NoError(t, WriteExport(&out, ExportCSV, records))
+	rows, err := csv.NewReader(&out).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	require.Equal(t, exportColumns, rows[0])
+	col := func(row []string, name string) string {
+		for i, c := range exportColumns {
+			if c == name {
+				return row[i]
+			}
+		}
+		t.Fatalf("no column %s", name)
+		return ""
+	}
+	require.Equal(t, "fix \"auth\",\nplease", col(rows[2], "prompt"))
+	require.Equal(t, "2026-03-01T13:00:00Z", col(rows[2], "started_at"))
+	require.Equal(t, "1", col(rows[2], "exit_code"))
+	require.Equal(t, "auth flaky", col(rows[2], "tags"))
+	require.Equal(t, "30.5", col(rows[1], "duration_seconds"))
+	require.Equal(t, "", col(rows[1], "exit_code"))
+
+	require.ErrorContains(t, WriteExport(&out, "xml", records), "unknown export format")
+}
@@ -0,0 +1,140 @@
+package history
+
+import (
+	"strings"
+
+	"phobos.org.uk/agency/internal/textdiff"
+)
+
+// MaxFileDiffLength bounds the unified diff snippet kept per file.
+const MaxFileDiffLength = 4000
+
+// fileDiffContext is the number of context lines in diff snippets.
+const fileDiffContext = 3
+
+// FileChange summarizes edits a task made to a single file.
+type FileChange struct {
+	Path      string `json:"path"`
+	Operation string `json:"operation"` // "edit" or "write"
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Diff      string `json:"diff,omitempty"`      // Unified diff snippet
+	Truncated bool   `json:"truncated,omitempty"` // Whether the diff snippet was truncated
+}
+
+// ExtractFileChanges parses Claude's JSON output and returns the files touched
+// by successful Edit, MultiEdit and Write tool calls, in first-touched order.
+// Multiple edits to the same file are merged into one entry. Hunk line numbers
+// in edit snippets are relative to the replaced text, not the whole file.
+func ExtractFileChanges(output []byte) []FileChange {
+	messages, ok := parseMessages(output)
+	if !ok {
+		return nil
+	}
+
+	// Collect tool calls, then drop any whose result reported an error
+	var calls []contentBlock
+	failed := make(map[string]bool)
+	for _, msg := range messages {
+		for _, block := range msg.Content {
+			switch block.Type {
+			case "tool_use":
+				switch block.Name {
+				case "Edit", "MultiEdit", "Write":
+					calls = append(calls, block)
+				}
+			case "tool_result":
+				if block.IsError {
+					failed[block.ToolUseID] = true
+				}
+			}
+		}
+	}
+
+	var changes []FileChange
+	index := make(map[string]int)
+	for _, call := range calls {
+		if failed[call.ID] {
+			continue
+		}
+		input, ok := call.Input.(map[string]any)
+		if !ok {
+			continue
+		}
+		path, _ := input["file_path"].(string)
+		if path == "" {
+			continue
+		}
+
+		operation := "edit"
+		var diffs []textdiff.Result
+		switch call.Name {
+		case "Write":
+			operation = "write"
+			content, _ := input["content"].(string)
+			diffs = append(diffs, textdiff.Compare("", content))
+		case "Edit":
+			oldStr, _ := input["old_string"].(string)
+			newStr, _ := input["new_string"].(string)
+			diffs = append(diffs, textdiff.Compare(oldStr, newStr))
+		case "MultiEdit":
+			edits, _ := input["edits"].([]any)
+			for _, e := range edits {
+				edit, ok := e.(map[string]any)
+				if !ok {
+					continue
+				}
+				oldStr, _ := edit["old_string"].(string)
+				newStr, _ := edit["new_string"].(string)
+				diffs = append(diffs, textdiff.Compare(oldStr, newStr))
+			}
+		}
+
+		i, seen := index[path]
+		if !seen {
+			i = len(changes)
+			index[path] = i
+			changes = append(changes, FileChange{Path: path, Operation: operation})
+		}
+		change := &changes[i]
+		if operation == "write" {
+			change.Operation = "write"
+		}
+
+		name := strings.TrimPrefix(path, "/")
+		oldName := "a/" + name
+		if call.Name == "Write" {
+			oldName = "/dev/null"
+		}
+		for _, d := range diffs {
+			change.Additions += d.Additions
+			change.Deletions += d.Deletions
+			appendDiff(change, textdiff.Unified(d, oldName, "b/"+name, fileDiffContext))
+		}
+	}
+
+	return changes
+}
+
+// appendDiff adds a diff snippet to the change, truncating at MaxFileDiffLength.
+func appendDiff(change *FileChange, snippet string) {
+	if snippet == "" || change.Truncated {
+		return
+	}
+	if len(change.Diff) > 0 {
+		// Later edits to the same file only need their hunks
+		if i := strings.Index(snippet, "@@"); i >= 0 {
+			snippet = snippet[i:]
+		}
+	}
+	if len(change.Diff)+len(snippet) > MaxFileDiffLength {
+		remaining := MaxFileDiffLength - len(change.Diff)
+		if j := strings.LastIndex(snippet[:remaining], "\n"); j >= 0 {
+			snippet = snippet[:j+1]
+		} else {
+			snippet = ""
+		}
+		change.Truncated = true
+	}
+	change.Diff += snippet
+}
@@ -0,0 +1,86 @@
+package history
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractFileChanges(t *testing.T) {
+	t.Parallel()
+
+	output := []byte(`[{
+		"role": "assistant",
+		"content": [
+			{"type": "tool_use", "id": "t1", "name": "Edit",
+			 "input": {"file_path": "/src/main.go", "old_string": "a\nb\n", "new_string": "a\nc\nd\n"}},
+			{"type": "tool_use", "id": "t2", "name": "Write",
+			 "input": {"file_path": "/src/new.go", "content": "package src\n"}},
+			{"type": "tool_use", "id": "t3", "name": "Edit",
+			 "input": {"file_path": "/src/broken.go", "old_string": "x", "new_string": "y"}},
+			{"type": "tool_use", "id": "t4", "name": "Read",
+			 "input": {"file_path": "/src/main.go"}},
+			{"type": "tool_use", "id": "t5", "name": "MultiEdit",
+			 "input": {"file_path": "/src/main.go", "edits": [{"old_string": "d", "new_string": "e"}]}}
+		]
+	}, {
+		"role": "user",
+		"content": [
+			{"type": "tool_result", "tool_use_id": "t3", "content": "old_string not found", "is_error": true}
+		]
+	}]`)
+
+	changes := ExtractFileChanges(output)
+	require.Len(t, changes, 2)
+
+	edited := changes[0]
+	require.Equal(t, "/src/main.go", edited.Path)
+	require.Equal(t, "edit", edited.Operation)
+	require.Equal(t, 3, edited.Additions)
+	require.Equal(t, 2, edited.Deletions)
+	require.True(t, strings.HasPrefix(edited.Diff, "--- a/src/main.go\n+++ b/src/main.go\n@@"))
+	require.Contains(t, edited.Diff, "-b\n+c\n+d\n")
+	require.Contains(t, edited.Diff, "-d\n+e\n")
+
+	written := changes[1]
+	require.Equal(t, "/src/new.go", written.Path)
+	require.Equal(t, "write", written.Operation)
+	require.Equal(t, 1, written.Additions)
+	require.Contains(t, written.Diff, "--- /dev/null\n")
+}
+
+func TestExtractFileChanges_StreamEvents(t *testing.T) {
+	t.Parallel()
+
+	output := []byte(`{"type":"system","subtype":"init"}
+{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"t1","name":"Write","input":{"file_path":"out.txt","content":"hi"}}]}}
+{"type":"result","subtype":"success","result":"done"}
+`)
+
+	changes := ExtractFileChanges(output)
+	require.Len(t, changes, 1)
+	require.Equal(t, "out.txt", changes[0].Path)
+	require.Contains(t, changes[0].Diff, "+++ b/out.txt\n")
+}
+
+func TestExtractFileChanges_Truncation(t *testing.T) {
+	t.Parallel()
+
+	content := strings.Repeat("line of generated content\n", 500)
+	output := []byte(`[{"role":"assistant","content":[{"type":"tool_use","id":"t1","name":"Write","input":{"file_path":"big.txt","content":` +
+		jsonString(content) + `}}]}]`)
+
+	changes := ExtractFileChanges(output)
+	require.Len(t, changes, 1)
+	require.Equal(t, 500, changes[0].Additions)
+	require.True(t, changes[0].Truncated)
+	require.LessOrEqual(t, len(changes[0].Diff), MaxFileDiffLength)
+	require.True(t, strings.HasSuffix(changes[0].Diff, "\n"))
+}
+
+func TestExtractFileChanges_NotJSON(t *testing.T) {
+	t.Parallel()
+
+	require.Empty(t, ExtractFileChanges([]byte("plain text output")))
+}
@@ -6,9 +6,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strings"
 	"sync"
 	"time"
+
+	"phobos.org.uk/agency/internal/api"
 )
 
 // Store manages task history persistence.
@@ -21,22 +25,72 @@ type Store struct {
 
 // Entry represents a completed task in history.
 type Entry struct {
-	TaskID          string      `json:"task_id"`
-	SessionID       string      `json:"session_id"`
-	State           string      `json:"state"`
-	Prompt          string      `json:"prompt"`
-	PromptPreview   string      `json:"prompt_preview"` // First 200 chars
-	Model           string      `json:"model"`
-	StartedAt       time.Time   `json:"started_at"`
-	CompletedAt     time.Time   `json:"completed_at"`
-	DurationSeconds float64     `json:"duration_seconds"`
-	ExitCode        *int        `json:"exit_code,omitempty"`
-	Output          string      `json:"output,omitempty"`
-	OutputPreview   string      `json:"output_preview,omitempty"` // First 200 chars
-	Error           *EntryError `json:"error,omitempty"`
-	TokenUsage      *TokenUsage `json:"token_usage,omitempty"`
-	Steps           []Step      `json:"steps,omitempty"` // Outline of execution steps
-	HasDebugLog     bool        `json:"has_debug_log"`   // Whether full debug log exists
+	TaskID          string       `json:"task_id"`
+	AgentID         string       `json:"agent_id,omitempty"` // Stable ID of the agent that ran the task
+	SessionID       string       `json:"session_id"`
+	ParentTaskID    string       `json:"parent_task_id,omitempty"` // Task that spawned this one as a subtask
+	RequestID       string       `json:"request_id,omitempty"`     // Correlates the task with the requests that led to it
+	State           string       `json:"state"`
+	Prompt          string       `json:"prompt"`
+	PromptPreview   string       `json:"prompt_preview"` // First 200 chars
+	Model           string       `json:"model"`
+	StartedAt       time.Time    `json:"started_at"`
+	CompletedAt     time.Time    `json:"completed_at"`
+	DurationSeconds float64      `json:"duration_seconds"`
+	ExitCode        *int         `json:"exit_code,omitempty"`
+	Output          string       `json:"output,omitempty"`
+	OutputPreview   string       `json:"output_preview,omitempty"` // First 200 chars
+	Error           *EntryError  `json:"error,omitempty"`
+	TokenUsage      *TokenUsage  `json:"token_usage,omitempty"`
+	Steps           []Step       `json:"steps,omitempty"`            // Outline of execution steps
+	FileChanges     []FileChange `json:"file_changes,omitempty"`     // Files modified by Edit/Write tools
+	HasDebugLog     bool         `json:"has_debug_log"`              // Whether full debug log exists
+	HasDiff         bool         `json:"has_diff,omitempty"`         // Whether a worktree diff exists
+	Artifacts       []Artifact   `json:"artifacts,omitempty"`        // Files collected from the workdir
+	OutputTruncated bool         `json:"output_truncated,omitempty"` // CLI output exceeded the capture limit
+	OutputBytes     int64        `json:"output_bytes,omitempty"`     // Total CLI output size
+	CapturedBytes   int64        `json:"captured_bytes,omitempty"`   // Bytes kept in the debug log
+	HasSpill        bool         `json:"has_spill,omitempty"`        // Whether the excess output was kept
+	Redactions      int          `json:"redactions,omitempty"`       // Secrets scrubbed before storage
+
+	Timeline []TimelineStep `json:"timeline,omitempty"` // Tool calls in the order made (Claude tasks)
+
+	AgencyPrompt *PromptStamp `json:"agency_prompt,omitempty"` // Agency prompt the task last ran with
+
+	// Settings the task was submitted with, so it can be re-run with them
+	Tier           string             `json:"tier,omitempty"`
+	TimeoutSeconds int                `json:"timeout_seconds,omitempty"` // 0 = the agent's default
+	RunnerOptions  *api.RunnerOptions `json:"runner_options,omitempty"`
+	RerunOf        string             `json:"rerun_of,omitempty"` // Task this one re-ran
+
+	Annotation *Annotation `json:"annotation,omitempty"` // Set through PATCH /history/{id}
+}
+
+// PromptStamp identifies the version of the agency prompt a task ran with,
+// so changes in output can be traced to prompt changes.
+type PromptStamp struct {
+	File string `json:"file"` // Base name of the prompt file, e.g. claude-prod.md
+	Hash string `json:"hash"` // Hex SHA-256 of the prompt's content
+
+	Experiment string `json:"experiment,omitempty"` // Prompt experiment the task was part of
+	Arm        string `json:"arm,omitempty"`        // ArmControl or ArmVariant
+}
+
+// Prompt experiment arms
+const (
+	ArmControl = "control" // Ran with the usual agency prompt
+	ArmVariant = "variant" // Ran with the experiment's alternate prompt
+)
+
+// TimelineStep is one tool call made by a task.
+type TimelineStep struct {
+	Tool        string    `json:"tool"`
+	Target      string    `json:"target,omitempty"` // File, pattern, command or URL the call acted on
+	StartedAt   time.Time `json:"started_at"`
+	Done        bool      `json:"done"`                   // The result has arrived
+	DurationMS  int64     `json:"duration_ms"`            // Time until the result, once done
+	ResultBytes int       `json:"result_bytes,omitempty"` // Size of the result
+	IsError     bool      `json:"is_error,omitempty"`     // The tool reported failure
 }
 
 // EntryError captures error details.
@@ -60,10 +114,14 @@ type Step struct {
 	Truncated     bool   `json:"truncated,omitempty"`      // Whether content was truncated
 }
 
-// ListOptions controls pagination for List.
+// ListOptions controls pagination and filtering for List.
 type ListOptions struct {
-	Page  int // 1-indexed page number
-	Limit int // Items per page (max 100)
+	Page  int    // 1-indexed page number
+	Limit int    // Items per page (max 100)
+	Query string // Case-insensitive substring of the prompt, output, task or session ID
+
+	Rating string // Only entries with this annotation rating
+	Tag    string // Only entries with this annotation tag
 }
 
 // ListResult contains paginated history entries.
@@ -78,6 +136,7 @@ type ListResult struct {
 // EntrySummary is a lightweight version of Entry for list responses.
 type EntrySummary struct {
 	TaskID          string      `json:"task_id"`
+	AgentID         string      `json:"agent_id,omitempty"`
 	SessionID       string      `json:"session_id"`
 	State           string      `json:"state"`
 	PromptPreview   string      `json:"prompt_preview"`
@@ -87,7 +146,12 @@ type EntrySummary struct {
 	DurationSeconds float64     `json:"duration_seconds"`
 	ExitCode        *int        `json:"exit_code,omitempty"`
 	Error           *EntryError `json:"error,omitempty"`
+	TokenUsage      *TokenUsage `json:"token_usage,omitempty"`
 	HasDebugLog     bool        `json:"has_debug_log"`
+
+	AgencyPrompt *PromptStamp `json:"agency_prompt,omitempty"`
+	RerunOf      string       `json:"rerun_of,omitempty"`
+	Annotation   *Annotation  `json:"annotation,omitempty"`
 }
 
 // Retention limits
@@ -116,6 +180,20 @@ func NewStore(dir string) (*Store, error) {
 	return s, nil
 }
 
+// Reload re-reads the entries from disk, e.g. after files were restored
+// into the directory, then applies the retention limits.
+func (s *Store) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = make(map[string]*Entry)
+	if err := s.load(); err != nil {
+		return fmt.Errorf("loading history: %w", err)
+	}
+	s.pruneUnlocked()
+	return nil
+}
+
 // Save persists a task entry to history.
 // It also triggers pruning if limits are exceeded.
 func (s *Store) Save(entry *Entry) error {
@@ -161,6 +239,65 @@ func (s *Store) SaveDebugLog(taskID string, debugLog []byte) error {
 	return nil
 }
 
+// SaveDiff saves the worktree diff produced by a task.
+func (s *Store) SaveDiff(taskID string, diff []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.WriteFile(s.diffPath(taskID), diff, 0600); err != nil {
+		return fmt.Errorf("saving diff: %w", err)
+	}
+
+	if entry, ok := s.entries[taskID]; ok {
+		entry.HasDiff = true
+		if err := writeJSON(s.outlinePath(taskID), entry); err != nil {
+			return fmt.Errorf("updating outline: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetDiff retrieves the worktree diff for a task.
+func (s *Store) GetDiff(taskID string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, err := os.ReadFile(s.diffPath(taskID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("diff for %s not found", taskID)
+		}
+		return nil, fmt.Errorf("reading diff: %w", err)
+	}
+	return data, nil
+}
+
+// CreateSpill creates the file that holds a task's output beyond the capture
+// limit. The caller writes to and closes it.
+func (s *Store) CreateSpill(taskID string) (*os.File, error) {
+	f, err := os.OpenFile(s.spillPath(taskID), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("creating spill file: %w", err)
+	}
+	return f, nil
+}
+
+// GetSpill retrieves the output a task produced beyond the capture limit.
+func (s *Store) GetSpill(taskID string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, err := os.ReadFile(s.spillPath(taskID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("spill file for %s not found", taskID)
+		}
+		return nil, fmt.Errorf("reading spill file: %w", err)
+	}
+	return data, nil
+}
+
 // Get retrieves a task entry by ID.
 func (s *Store) Get(taskID string) (*Entry, error) {
 	s.mu.RLock()
@@ -206,8 +343,15 @@ func (s *Store) List(opts ListOptions) ListResult {
 	}
 
 	// Collect and sort entries by completion time (newest first)
+	query := strings.ToLower(strings.TrimSpace(opts.Query))
 	sorted := make([]*Entry, 0, len(s.entries))
 	for _, e := range s.entries {
+		if query != "" && !e.matches(query) {
+			continue
+		}
+		if !e.annotated(opts.Rating, opts.Tag) {
+			continue
+		}
 		sorted = append(sorted, e)
 	}
 	sort.Slice(sorted, func(i, j int) bool {
@@ -232,6 +376,7 @@ func (s *Store) List(opts ListOptions) ListResult {
 	for _, e := range sorted[start:end] {
 		entries = append(entries, EntrySummary{
 			TaskID:          e.TaskID,
+			AgentID:         e.AgentID,
 			SessionID:       e.SessionID,
 			State:           e.State,
 			PromptPreview:   e.PromptPreview,
@@ -241,7 +386,11 @@ func (s *Store) List(opts ListOptions) ListResult {
 			DurationSeconds: e.DurationSeconds,
 			ExitCode:        e.ExitCode,
 			Error:           e.Error,
+			TokenUsage:      e.TokenUsage,
 			HasDebugLog:     e.HasDebugLog,
+			AgencyPrompt:    e.AgencyPrompt,
+			RerunOf:         e.RerunOf,
+			Annotation:      e.Annotation,
 		})
 	}
 
@@ -254,6 +403,34 @@ func (s *Store) List(opts ListOptions) ListResult {
 	}
 }
 
+// matches reports whether the entry contains the lowercased query. A query
+// that starts the entry's agency prompt hash matches too.
+func (e *Entry) matches(query string) bool {
+	fields := []string{e.TaskID, e.SessionID, e.Prompt, e.Output}
+	if e.Annotation != nil {
+		fields = append(fields, e.Annotation.Notes)
+	}
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return e.AgencyPrompt != nil && strings.HasPrefix(e.AgencyPrompt.Hash, query)
+}
+
+// annotated reports whether the entry has the given annotation rating and
+// tag, either of which may be empty to match any.
+func (e *Entry) annotated(rating, tag string) bool {
+	if rating == "" && tag == "" {
+		return true
+	}
+	if e.Annotation == nil {
+		return false
+	}
+	return (rating == "" || e.Annotation.Rating == rating) &&
+		(tag == "" || slices.Contains(e.Annotation.Tags, strings.ToLower(tag)))
+}
+
 // load reads all existing entries from disk.
 func (s *Store) load() error {
 	pattern := filepath.Join(s.dir, "*.json")
@@ -278,6 +455,9 @@ func (s *Store) load() error {
 		if _, err := os.Stat(debugPath); err == nil {
 			entry.HasDebugLog = true
 		}
+		if _, err := os.Stat(s.diffPath(entry.TaskID)); err == nil {
+			entry.HasDiff = true
+		}
 
 		s.entries[entry.TaskID] = &entry
 	}
@@ -303,6 +483,9 @@ func (s *Store) pruneUnlocked() {
 			taskID := sorted[i].TaskID
 			os.Remove(s.outlinePath(taskID))
 			os.Remove(s.debugPath(taskID)) // Also remove debug if exists
+			os.Remove(s.spillPath(taskID))
+			os.Remove(s.diffPath(taskID))
+			os.RemoveAll(s.artifactsDir(taskID))
 			delete(s.entries, taskID)
 		}
 		sorted = sorted[:MaxOutlineEntries]
@@ -314,8 +497,10 @@ func (s *Store) pruneUnlocked() {
 		debugPath := s.debugPath(taskID)
 		if _, err := os.Stat(debugPath); err == nil {
 			os.Remove(debugPath)
+			os.Remove(s.spillPath(taskID))
 			if entry, ok := s.entries[taskID]; ok {
 				entry.HasDebugLog = false
+				entry.HasSpill = false
 				// Update the file to reflect HasDebugLog = false
 				writeJSON(s.outlinePath(taskID), entry)
 			}
@@ -331,6 +516,14 @@ func (s *Store) debugPath(taskID string) string {
 	return filepath.Join(s.dir, taskID+".debug.log")
 }
 
+func (s *Store) spillPath(taskID string) string {
+	return filepath.Join(s.dir, taskID+".spill.log")
+}
+
+func (s *Store) diffPath(taskID string) string {
+	return filepath.Join(s.dir, taskID+".diff")
+}
+
 func truncate(s string, maxLen int) string {
 	if len(s) <= maxLen {
 		return s
@@ -104,6 +104,57 @@ func TestStore_DebugLog(t *testing.T) {
 	require.Equal(t, debugData, retrieved)
 }
 
+func TestStore_Diff(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Save(&Entry{TaskID: "task-diff", CompletedAt: time.Now()}))
+
+	_, err = store.GetDiff("task-diff")
+	require.Error(t, err)
+
+	diff := []byte("diff --git a/x b/x\n+hello\n")
+	require.NoError(t, store.SaveDiff("task-diff", diff))
+
+	got, err := store.Get("task-diff")
+	require.NoError(t, err)
+	require.True(t, got.HasDiff)
+
+	retrieved, err := store.GetDiff("task-diff")
+	require.NoError(t, err)
+	require.Equal(t, diff, retrieved)
+
+	// HasDiff survives a reload
+	reloaded, err := NewStore(dir)
+	require.NoError(t, err)
+	got, err = reloaded.Get("task-diff")
+	require.NoError(t, err)
+	require.True(t, got.HasDiff)
+}
+
+func TestStore_Spill(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	_, err = store.GetSpill("task-spill")
+	require.Error(t, err)
+
+	f, err := store.CreateSpill("task-spill")
+	require.NoError(t, err)
+	_, err = f.WriteString("excess\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	data, err := store.GetSpill("task-spill")
+	require.NoError(t, err)
+	require.Equal(t, "excess\n", string(data))
+}
+
 func TestStore_List(t *testing.T) {
 	t.Parallel()
 
@@ -141,6 +192,37 @@ func TestStore_List(t *testing.T) {
 	require.Equal(t, "task-c", result.Entries[0].TaskID)
 }
 
+func TestStore_ListQuery(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, store.Save(&Entry{TaskID: "task-1", SessionID: "sess-a", Prompt: "Fix the Login bug", CompletedAt: now}))
+	require.NoError(t, store.Save(&Entry{TaskID: "task-2", SessionID: "sess-b", Prompt: "Write docs", Output: "Updated LOGIN.md", CompletedAt: now.Add(time.Minute)}))
+	require.NoError(t, store.Save(&Entry{TaskID: "task-3", SessionID: "sess-a", Prompt: "Refactor", CompletedAt: now.Add(2 * time.Minute)}))
+
+	result := store.List(ListOptions{Query: " login "})
+	require.Equal(t, 2, result.Total)
+	require.Equal(t, "task-2", result.Entries[0].TaskID)
+	require.Equal(t, "task-1", result.Entries[1].TaskID)
+
+	result = store.List(ListOptions{Query: "sess-a", Limit: 1})
+	require.Equal(t, 2, result.Total)
+	require.Equal(t, 2, result.TotalPages)
+	require.Equal(t, "task-3", result.Entries[0].TaskID)
+
+	require.Zero(t, store.List(ListOptions{Query: "nothing"}).Total)
+
+	// A prefix of the agency prompt hash finds the tasks that ran with it
+	stamp := &PromptStamp{File: "claude-prod.md", Hash: "3f2a9c0de1"}
+	require.NoError(t, store.Save(&Entry{TaskID: "task-4", Prompt: "Refactor", AgencyPrompt: stamp, CompletedAt: now.Add(3 * time.Minute)}))
+	result = store.List(ListOptions{Query: "3f2a9c"})
+	require.Equal(t, 1, result.Total)
+	require.Equal(t, stamp, result.Entries[0].AgencyPrompt)
+}
+
 func TestStore_Pruning(t *testing.T) {
 	t.Parallel()
 
@@ -245,6 +327,31 @@ func TestStore_Load(t *testing.T) {
 	require.True(t, got.HasDebugLog)
 }
 
+func TestStore_Reload(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	require.NoError(t, err)
+	require.NoError(t, store.Save(&Entry{TaskID: "task-local", CompletedAt: time.Now()}))
+
+	// Files written by another store, as a restore does, appear after a reload
+	other, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, other.Save(&Entry{TaskID: "task-restored", CompletedAt: time.Now().Add(-time.Hour)}))
+	data, err := os.ReadFile(filepath.Join(other.dir, "task-restored.json"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "task-restored.json"), data, 0600))
+
+	_, err = store.Get("task-restored")
+	require.Error(t, err)
+	require.NoError(t, store.Reload())
+	_, err = store.Get("task-restored")
+	require.NoError(t, err)
+	_, err = store.Get("task-local")
+	require.NoError(t, err)
+}
+
 func TestStore_NotFound(t *testing.T) {
 	t.Parallel()
 
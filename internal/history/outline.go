@@ -1,6 +1,7 @@
 package history
 
 import (
+	"bytes"
 	"encoding/json"
 	"strings"
 )
@@ -8,21 +9,14 @@ import (
 // ExtractSteps parses Claude's JSON output and extracts an outline of execution steps.
 // If the output is not valid JSON, returns a single text step with the raw output.
 func ExtractSteps(output []byte) []Step {
-	// Try to parse as Claude's streaming JSON format
-	// Claude outputs conversation messages with tool calls and results
-	var messages []claudeMessage
-	if err := json.Unmarshal(output, &messages); err != nil {
-		// Try single message
-		var msg claudeMessage
-		if err := json.Unmarshal(output, &msg); err != nil {
-			// Not valid JSON - return as single text step
-			return []Step{{
-				Type:          "text",
-				OutputPreview: truncate(string(output), PreviewLength),
-				Truncated:     len(output) > PreviewLength,
-			}}
-		}
-		messages = []claudeMessage{msg}
+	messages, ok := parseMessages(output)
+	if !ok {
+		// Not valid JSON - return as single text step
+		return []Step{{
+			Type:          "text",
+			OutputPreview: truncate(string(output), PreviewLength),
+			Truncated:     len(output) > PreviewLength,
+		}}
 	}
 
 	// First pass: collect all tool calls by ID
@@ -76,10 +70,52 @@ func ExtractSteps(output []byte) []Step {
 	return steps
 }
 
+// parseMessages decodes Claude's conversation output into messages.
+// It accepts a JSON array of messages, a single message, or newline-delimited
+// stream events, unwrapping events that carry the message in a "message" field.
+// Returns false if the output is not in any of these formats.
+func parseMessages(output []byte) ([]claudeMessage, bool) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(output, &items); err != nil {
+		var single json.RawMessage
+		if err := json.Unmarshal(output, &single); err == nil {
+			items = []json.RawMessage{single}
+		} else {
+			items = nil
+			for _, line := range bytes.Split(output, []byte("\n")) {
+				line = bytes.TrimSpace(line)
+				if len(line) > 0 && json.Valid(line) {
+					items = append(items, line)
+				}
+			}
+			if len(items) == 0 {
+				return nil, false
+			}
+		}
+	}
+
+	var messages []claudeMessage
+	parsed := false
+	for _, item := range items {
+		var msg claudeMessage
+		if err := json.Unmarshal(item, &msg); err != nil {
+			continue
+		}
+		parsed = true
+		if msg.Message != nil {
+			msg = *msg.Message
+		}
+		messages = append(messages, msg)
+	}
+	return messages, parsed
+}
+
 // claudeMessage represents a message in Claude's conversation output.
+// Stream events wrap the message in a Message field.
 type claudeMessage struct {
 	Role    string         `json:"role"`
 	Content []contentBlock `json:"content"`
+	Message *claudeMessage `json:"message,omitempty"`
 }
 
 // contentBlock represents a content block in a Claude message.
@@ -93,6 +129,7 @@ type contentBlock struct {
 	// Tool result fields
 	ToolUseID string `json:"tool_use_id,omitempty"`
 	Content   any    `json:"content,omitempty"` // Can be string or array
+	IsError   bool   `json:"is_error,omitempty"`
 }
 
 func formatInput(input any) string {
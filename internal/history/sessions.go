@@ -0,0 +1,171 @@
+package history
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// SessionSummary aggregates the history entries that share a session ID.
+type SessionSummary struct {
+	SessionID       string     `json:"session_id"`
+	TaskCount       int        `json:"task_count"`
+	FailedCount     int        `json:"failed_count"`
+	LastState       string     `json:"last_state"`       // State of the most recent task
+	LastTaskID      string     `json:"last_task_id"`     // Most recent task in the session
+	PromptPreview   string     `json:"prompt_preview"`   // Preview of the session's first prompt
+	StartedAt       time.Time  `json:"started_at"`       // Start of the earliest task
+	CompletedAt     time.Time  `json:"completed_at"`     // Completion of the latest task
+	DurationSeconds float64    `json:"duration_seconds"` // Sum of task durations
+	TokenUsage      TokenUsage `json:"token_usage"`      // Sum of task token usage
+}
+
+// SessionListResult contains paginated session summaries.
+type SessionListResult struct {
+	Sessions   []SessionSummary `json:"sessions"`
+	Page       int              `json:"page"`
+	Limit      int              `json:"limit"`
+	Total      int              `json:"total"`
+	TotalPages int              `json:"total_pages"`
+}
+
+// SessionDetail is a session summary with its full history entries.
+type SessionDetail struct {
+	SessionSummary
+	Tasks []*Entry `json:"tasks"` // Oldest first
+}
+
+// Sessions returns paginated session summaries, most recently active first.
+// Entries without a session ID are skipped.
+func (s *Store) Sessions(opts ListOptions) SessionListResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if opts.Page < 1 {
+		opts.Page = 1
+	}
+	if opts.Limit < 1 {
+		opts.Limit = 20
+	}
+	if opts.Limit > 100 {
+		opts.Limit = 100
+	}
+
+	bySession := make(map[string][]*Entry)
+	for _, e := range s.entries {
+		if e.SessionID == "" {
+			continue
+		}
+		bySession[e.SessionID] = append(bySession[e.SessionID], e)
+	}
+
+	summaries := make([]SessionSummary, 0, len(bySession))
+	for sessionID, entries := range bySession {
+		sortOldestFirst(entries)
+		summaries = append(summaries, summarizeSession(sessionID, entries))
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if !summaries[i].CompletedAt.Equal(summaries[j].CompletedAt) {
+			return summaries[i].CompletedAt.After(summaries[j].CompletedAt)
+		}
+		return summaries[i].SessionID < summaries[j].SessionID
+	})
+
+	total := len(summaries)
+	start := min((opts.Page-1)*opts.Limit, total)
+	end := min(start+opts.Limit, total)
+
+	return SessionListResult{
+		Sessions:   summaries[start:end],
+		Page:       opts.Page,
+		Limit:      opts.Limit,
+		Total:      total,
+		TotalPages: (total + opts.Limit - 1) / opts.Limit,
+	}
+}
+
+// SessionActivity is a session's task count and the completion time of its
+// latest task.
+type SessionActivity struct {
+	TaskCount   int
+	CompletedAt time.Time
+}
+
+// SessionActivity returns the activity of every session in the history.
+func (s *Store) SessionActivity() map[string]SessionActivity {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	activity := make(map[string]SessionActivity)
+	for _, e := range s.entries {
+		if e.SessionID == "" {
+			continue
+		}
+		act := activity[e.SessionID]
+		act.TaskCount++
+		if e.CompletedAt.After(act.CompletedAt) {
+			act.CompletedAt = e.CompletedAt
+		}
+		activity[e.SessionID] = act
+	}
+	return activity
+}
+
+// Session returns the summary and entries of a single session.
+func (s *Store) Session(sessionID string) (*SessionDetail, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entries []*Entry
+	for _, e := range s.entries {
+		if e.SessionID == sessionID {
+			entries = append(entries, e)
+		}
+	}
+	if sessionID == "" || len(entries) == 0 {
+		return nil, fmt.Errorf("session %s not found in history", sessionID)
+	}
+
+	sortOldestFirst(entries)
+	return &SessionDetail{
+		SessionSummary: summarizeSession(sessionID, entries),
+		Tasks:          entries,
+	}, nil
+}
+
+// sortOldestFirst orders a session's entries by start time.
+func sortOldestFirst(entries []*Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].StartedAt.Equal(entries[j].StartedAt) {
+			return entries[i].StartedAt.Before(entries[j].StartedAt)
+		}
+		return entries[i].CompletedAt.Before(entries[j].CompletedAt)
+	})
+}
+
+// summarizeSession totals a session's entries, which must be oldest first.
+func summarizeSession(sessionID string, entries []*Entry) SessionSummary {
+	first, last := entries[0], entries[len(entries)-1]
+	summary := SessionSummary{
+		SessionID:     sessionID,
+		TaskCount:     len(entries),
+		LastState:     last.State,
+		LastTaskID:    last.TaskID,
+		PromptPreview: first.PromptPreview,
+		StartedAt:     first.StartedAt,
+	}
+	for _, e := range entries {
+		if e.State == "failed" {
+			summary.FailedCount++
+		}
+		if e.CompletedAt.After(summary.CompletedAt) {
+			summary.CompletedAt = e.CompletedAt
+		}
+		summary.DurationSeconds += e.DurationSeconds
+		if e.TokenUsage != nil {
+			summary.TokenUsage.Input += e.TokenUsage.Input
+			summary.TokenUsage.Output += e.TokenUsage.Output
+		}
+	}
+	return summary
+}
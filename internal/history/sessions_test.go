@@ -0,0 +1,74 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Sessions(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	base := time.Now().Add(-time.Hour)
+	entries := []*Entry{
+		{TaskID: "task-1", SessionID: "sess-a", State: "completed", Prompt: "first",
+			StartedAt: base, CompletedAt: base.Add(time.Minute), DurationSeconds: 60,
+			TokenUsage: &TokenUsage{Input: 100, Output: 10}},
+		{TaskID: "task-2", SessionID: "sess-a", State: "failed", Prompt: "second",
+			StartedAt: base.Add(2 * time.Minute), CompletedAt: base.Add(4 * time.Minute), DurationSeconds: 120,
+			TokenUsage: &TokenUsage{Input: 50, Output: 5}},
+		{TaskID: "task-3", SessionID: "sess-b", State: "completed", Prompt: "other",
+			StartedAt: base.Add(time.Minute), CompletedAt: base.Add(2 * time.Minute), DurationSeconds: 60},
+		{TaskID: "task-4", State: "completed", CompletedAt: base},
+	}
+	for _, e := range entries {
+		require.NoError(t, store.Save(e))
+	}
+
+	result := store.Sessions(ListOptions{})
+	require.Equal(t, 2, result.Total)
+	require.Len(t, result.Sessions, 2)
+
+	// Most recently active first
+	a := result.Sessions[0]
+	require.Equal(t, "sess-a", a.SessionID)
+	require.Equal(t, 2, a.TaskCount)
+	require.Equal(t, 1, a.FailedCount)
+	require.Equal(t, "failed", a.LastState)
+	require.Equal(t, "task-2", a.LastTaskID)
+	require.Equal(t, "first", a.PromptPreview)
+	require.Equal(t, 180.0, a.DurationSeconds)
+	require.Equal(t, TokenUsage{Input: 150, Output: 15}, a.TokenUsage)
+	require.Equal(t, "sess-b", result.Sessions[1].SessionID)
+
+	paged := store.Sessions(ListOptions{Page: 2, Limit: 1})
+	require.Equal(t, 2, paged.TotalPages)
+	require.Len(t, paged.Sessions, 1)
+	require.Equal(t, "sess-b", paged.Sessions[0].SessionID)
+}
+
+func TestStore_Session(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	base := time.Now().Add(-time.Hour)
+	require.NoError(t, store.Save(&Entry{TaskID: "task-2", SessionID: "sess-a", StartedAt: base.Add(time.Minute), CompletedAt: base.Add(2 * time.Minute)}))
+	require.NoError(t, store.Save(&Entry{TaskID: "task-1", SessionID: "sess-a", StartedAt: base, CompletedAt: base.Add(time.Minute)}))
+
+	detail, err := store.Session("sess-a")
+	require.NoError(t, err)
+	require.Equal(t, 2, detail.TaskCount)
+	require.Len(t, detail.Tasks, 2)
+	require.Equal(t, "task-1", detail.Tasks[0].TaskID)
+	require.Equal(t, "task-2", detail.Tasks[1].TaskID)
+
+	_, err = store.Session("missing")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not found")
+}
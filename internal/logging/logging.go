@@ -3,11 +3,14 @@ package logging
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"sync"
 	"time"
+
+	"phobos.org.uk/agency/internal/redact"
 )
 
 // Level represents log severity levels
@@ -43,6 +46,7 @@ type Entry struct {
 	Message   string         `json:"message"`
 	Component string         `json:"component,omitempty"`
 	TaskID    string         `json:"task_id,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
 	Fields    map[string]any `json:"fields,omitempty"`
 }
 
@@ -55,6 +59,11 @@ type Logger struct {
 	entries    []Entry
 	maxEntries int
 	counts     map[Level]int64
+	redactor   *redact.Redactor // Secrets scrubbed from entries (nil = token patterns only)
+	sinks      []Sink           // Further destinations for entries
+	failing    map[Sink]bool    // Sinks whose last write failed, so failures are reported once
+
+	subscribers map[*Subscription]struct{} // Receivers of new entries
 }
 
 // Config holds logger configuration
@@ -93,25 +102,62 @@ func (l *Logger) SetLevel(level Level) {
 	l.level = level
 }
 
+// SetRedactor sets the secret values scrubbed from later entries. Well-known
+// token formats are always scrubbed.
+func (l *Logger) SetRedactor(r *redact.Redactor) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.redactor = r
+}
+
+// redactEntry scrubs secrets from an entry's message and string fields.
+// Called with l.mu held.
+func (l *Logger) redactEntry(e *Entry) {
+	e.Message, _ = l.redactor.String(e.Message)
+	if len(e.Fields) == 0 {
+		return
+	}
+	fields := make(map[string]any, len(e.Fields))
+	for k, v := range e.Fields {
+		switch v := v.(type) {
+		case string:
+			fields[k], _ = l.redactor.String(v)
+		case []string:
+			scrubbed := make([]string, len(v))
+			for i, s := range v {
+				scrubbed[i], _ = l.redactor.String(s)
+			}
+			fields[k] = scrubbed
+		default:
+			fields[k] = v
+		}
+	}
+	e.Fields = fields
+}
+
 // log writes a log entry if it meets the level threshold
 func (l *Logger) log(level Level, msg string, fields map[string]any) {
 	if levelPriority(level) < levelPriority(l.level) {
 		return
 	}
 
-	entry := Entry{
+	l.record(Entry{
 		Timestamp: time.Now().UTC(),
 		Level:     level,
 		Message:   msg,
 		Component: l.component,
 		Fields:    fields,
-	}
+	})
+}
 
+// record redacts an entry, stores it, and writes it to the output and sinks.
+func (l *Logger) record(entry Entry) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	l.redactEntry(&entry)
 
 	// Update counts
-	l.counts[level]++
+	l.counts[entry.Level]++
 
 	// Store entry (ring buffer)
 	if len(l.entries) >= l.maxEntries {
@@ -125,11 +171,76 @@ func (l *Logger) log(level Level, msg string, fields map[string]any) {
 	data, err := json.Marshal(entry)
 	if err != nil {
 		fmt.Fprintf(l.output, `{"level":"error","message":"failed to marshal log entry: %s"}`+"\n", err)
+	} else {
+		l.output.Write(append(data, '\n'))
+	}
+
+	for _, sink := range l.sinks {
+		l.writeSink(sink, entry)
+	}
+
+	for sub := range l.subscribers {
+		if !sub.q.matches(entry) {
+			continue
+		}
+		select {
+		case sub.ch <- entry:
+		default:
+			sub.dropped++ // Logging never waits on a slow subscriber
+		}
+	}
+}
+
+// AddSink sends later entries to sink as well as the output. The logger
+// closes its sinks in Close.
+func (l *Logger) AddSink(sink Sink) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sinks = append(l.sinks, sink)
+}
+
+// writeSink writes an entry to sink, reporting a failure to the output once
+// until the sink recovers. Called with l.mu held.
+func (l *Logger) writeSink(sink Sink, entry Entry) {
+	err := sink.Write(entry)
+	if err == nil {
+		delete(l.failing, sink)
 		return
 	}
+	if l.failing[sink] {
+		return
+	}
+	if l.failing == nil {
+		l.failing = make(map[Sink]bool)
+	}
+	l.failing[sink] = true
+	data, _ := json.Marshal(Entry{
+		Timestamp: time.Now().UTC(),
+		Level:     LevelError,
+		Message:   "log sink write failed",
+		Component: l.component,
+		Fields:    map[string]any{"sink": sink.Name(), "error": err.Error()},
+	})
 	l.output.Write(append(data, '\n'))
 }
 
+// Close flushes and closes the logger's sinks. Entries logged afterwards go
+// to the output and memory only.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	sinks := l.sinks
+	l.sinks = nil
+	l.mu.Unlock()
+
+	var errs []error
+	for _, sink := range sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing %s log sink: %w", sink.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // Debug logs at debug level
 func (l *Logger) Debug(msg string, fields ...map[string]any) {
 	var f map[string]any
@@ -173,8 +284,17 @@ func (l *Logger) WithTask(taskID string) *TaskLogger {
 
 // TaskLogger is a logger scoped to a specific task
 type TaskLogger struct {
-	parent *Logger
-	taskID string
+	parent    *Logger
+	taskID    string
+	requestID string
+}
+
+// WithRequestID returns a copy of the logger that also adds request_id to its
+// entries. An empty ID adds nothing.
+func (t *TaskLogger) WithRequestID(requestID string) *TaskLogger {
+	scoped := *t
+	scoped.requestID = requestID
+	return &scoped
 }
 
 func (t *TaskLogger) log(level Level, msg string, fields map[string]any) {
@@ -182,32 +302,15 @@ func (t *TaskLogger) log(level Level, msg string, fields map[string]any) {
 		return
 	}
 
-	entry := Entry{
+	t.parent.record(Entry{
 		Timestamp: time.Now().UTC(),
 		Level:     level,
 		Message:   msg,
 		Component: t.parent.component,
 		TaskID:    t.taskID,
+		RequestID: t.requestID,
 		Fields:    fields,
-	}
-
-	t.parent.mu.Lock()
-	defer t.parent.mu.Unlock()
-
-	t.parent.counts[level]++
-
-	if len(t.parent.entries) >= t.parent.maxEntries {
-		copy(t.parent.entries, t.parent.entries[1:])
-		t.parent.entries = t.parent.entries[:len(t.parent.entries)-1]
-	}
-	t.parent.entries = append(t.parent.entries, entry)
-
-	data, err := json.Marshal(entry)
-	if err != nil {
-		fmt.Fprintf(t.parent.output, `{"level":"error","message":"failed to marshal log entry: %s"}`+"\n", err)
-		return
-	}
-	t.parent.output.Write(append(data, '\n'))
+	})
 }
 
 func (t *TaskLogger) Debug(msg string, fields ...map[string]any) {
@@ -246,6 +349,7 @@ func (t *TaskLogger) Error(msg string, fields ...map[string]any) {
 type Query struct {
 	Level     Level     // Filter by minimum level
 	TaskID    string    // Filter by task ID
+	RequestID string    // Filter by request ID
 	Since     time.Time // Filter entries after this time
 	Until     time.Time // Filter entries before this time
 	Limit     int       // Max entries to return (0 = all)
@@ -282,28 +386,22 @@ func (l *Logger) Query(q Query) QueryResult {
 	}
 	stats.Total = stats.Debug + stats.Info + stats.Warn + stats.Error
 
+	filtered, total := l.query(q)
+	return QueryResult{
+		Entries: filtered,
+		Total:   total,
+		Counts:  stats,
+	}
+}
+
+// query returns the most recent stored entries matching q, up to its limit,
+// and how many matched in all. Called with l.mu held.
+func (l *Logger) query(q Query) ([]Entry, int) {
 	var filtered []Entry
 	for _, e := range l.entries {
-		// Level filter
-		if q.Level != "" && levelPriority(e.Level) < levelPriority(q.Level) {
-			continue
-		}
-		// Task filter
-		if q.TaskID != "" && e.TaskID != q.TaskID {
-			continue
-		}
-		// Time filters
-		if !q.Since.IsZero() && e.Timestamp.Before(q.Since) {
-			continue
+		if q.matches(e) {
+			filtered = append(filtered, e)
 		}
-		if !q.Until.IsZero() && e.Timestamp.After(q.Until) {
-			continue
-		}
-		// Component filter
-		if q.Component != "" && e.Component != q.Component {
-			continue
-		}
-		filtered = append(filtered, e)
 	}
 
 	total := len(filtered)
@@ -313,11 +411,74 @@ func (l *Logger) Query(q Query) QueryResult {
 		// Return most recent entries
 		filtered = filtered[len(filtered)-q.Limit:]
 	}
+	return filtered, total
+}
+
+// matches reports whether an entry passes the query's filters
+func (q Query) matches(e Entry) bool {
+	// Level filter
+	if q.Level != "" && levelPriority(e.Level) < levelPriority(q.Level) {
+		return false
+	}
+	// Task filter
+	if q.TaskID != "" && e.TaskID != q.TaskID {
+		return false
+	}
+	if q.RequestID != "" && e.RequestID != q.RequestID {
+		return false
+	}
+	// Time filters
+	if !q.Since.IsZero() && e.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && e.Timestamp.After(q.Until) {
+		return false
+	}
+	// Component filter
+	return q.Component == "" || e.Component == q.Component
+}
 
-	return QueryResult{
-		Entries: filtered,
-		Total:   total,
-		Counts:  stats,
+// Subscription receives entries matching a query as they are logged
+type Subscription struct {
+	C <-chan Entry // Closed by Close
+
+	l       *Logger
+	q       Query
+	ch      chan Entry
+	dropped int64 // Entries missed because C was full; guarded by l.mu
+}
+
+// Subscribe returns the stored entries matching q, as Query would, and a
+// subscription to those logged from then on. Entries are dropped rather than
+// wait for a subscriber whose buffer of the given size is full.
+func (l *Logger) Subscribe(q Query, buffer int) ([]Entry, *Subscription) {
+	ch := make(chan Entry, buffer)
+	sub := &Subscription{C: ch, l: l, q: q, ch: ch}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	backlog, _ := l.query(q)
+	if l.subscribers == nil {
+		l.subscribers = make(map[*Subscription]struct{})
+	}
+	l.subscribers[sub] = struct{}{}
+	return backlog, sub
+}
+
+// Dropped returns how many entries the subscription has missed
+func (s *Subscription) Dropped() int64 {
+	s.l.mu.RLock()
+	defer s.l.mu.RUnlock()
+	return s.dropped
+}
+
+// Close stops the subscription and closes C. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.l.mu.Lock()
+	defer s.l.mu.Unlock()
+	if _, ok := s.l.subscribers[s]; ok {
+		delete(s.l.subscribers, s)
+		close(s.ch)
 	}
 }
 
@@ -0,0 +1,302 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OTLP export limits
+const (
+	otlpQueueSize     = 1000            // Entries buffered for export; more are dropped
+	otlpBatchSize     = 100             // Entries per export request
+	otlpFlushInterval = 2 * time.Second // Longest an entry waits for a batch to fill
+	otlpTimeout       = 10 * time.Second
+)
+
+// OTLPConfig configures an OTLPSink.
+type OTLPConfig struct {
+	Endpoint   string            // Collector base URL; logs are posted to <endpoint>/v1/logs
+	Headers    map[string]string // Extra request headers, e.g. for authentication
+	Resource   map[string]string // Resource attributes, e.g. service.name
+	HTTPClient *http.Client      // Default: a client with a 10s timeout
+}
+
+// OTLPSink exports entries to an OpenTelemetry collector using OTLP/HTTP
+// with JSON encoding. Entries are batched in the background; Write never
+// blocks, dropping entries when the buffer is full.
+type OTLPSink struct {
+	url      string
+	headers  map[string]string
+	resource []otlpKeyValue
+	client   *http.Client
+	entries  chan Entry
+	done     chan struct{}
+
+	mu        sync.Mutex
+	dropped   int   // Entries dropped since the last report
+	lastError error // Last export failure, returned by the next Write
+	closed    bool
+}
+
+// NewOTLPSink starts an exporter to the collector at cfg.Endpoint.
+func NewOTLPSink(cfg OTLPConfig) *OTLPSink {
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: otlpTimeout}
+	}
+	s := &OTLPSink{
+		url:      strings.TrimRight(cfg.Endpoint, "/") + "/v1/logs",
+		headers:  cfg.Headers,
+		resource: otlpAttributes(cfg.Resource),
+		client:   client,
+		entries:  make(chan Entry, otlpQueueSize),
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Name implements Sink.
+func (s *OTLPSink) Name() string { return "otlp" }
+
+// Write implements Sink. It queues the entry and reports the last export
+// failure, if any.
+func (s *OTLPSink) Write(e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	select {
+	case s.entries <- e:
+	default:
+		s.dropped++
+	}
+	err := s.lastError
+	s.lastError = nil
+	return err
+}
+
+// Close exports the buffered entries and stops the exporter.
+func (s *OTLPSink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.entries)
+	}
+	s.mu.Unlock()
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastError
+}
+
+// run batches queued entries and exports them until the queue is closed.
+func (s *OTLPSink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+
+	var batch []Entry
+	for {
+		select {
+		case e, ok := <-s.entries:
+			if !ok {
+				s.export(batch)
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= otlpBatchSize {
+				s.export(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			s.export(batch)
+			batch = nil
+		}
+	}
+}
+
+// export posts a batch to the collector, recording any failure.
+func (s *OTLPSink) export(batch []Entry) {
+	if len(batch) == 0 {
+		return
+	}
+	body, err := json.Marshal(s.request(batch))
+	if err == nil {
+		err = s.post(body)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.lastError = err
+	}
+	if s.dropped > 0 && s.lastError == nil {
+		s.lastError = fmt.Errorf("dropped %d log entries: export queue full", s.dropped)
+		s.dropped = 0
+	}
+}
+
+// post sends an export request body.
+func (s *OTLPSink) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("exporting logs: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("exporting logs: collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// OTLP/HTTP JSON request body, trimmed to the fields we send. See
+// opentelemetry-proto's logs_service.proto.
+type otlpRequest struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano   string         `json:"timeUnixNano"`
+	SeverityNumber int            `json:"severityNumber"`
+	SeverityText   string         `json:"severityText"`
+	Body           otlpAnyValue   `json:"body"`
+	Attributes     []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"` // int64 is a string in OTLP JSON
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+// request builds the export request for a batch.
+func (s *OTLPSink) request(batch []Entry) otlpRequest {
+	records := make([]otlpLogRecord, 0, len(batch))
+	for _, e := range batch {
+		record := otlpLogRecord{
+			TimeUnixNano:   strconv.FormatInt(e.Timestamp.UnixNano(), 10),
+			SeverityNumber: otlpSeverity(e.Level),
+			SeverityText:   strings.ToUpper(string(e.Level)),
+			Body:           otlpString(e.Message),
+		}
+		attrs := map[string]any{}
+		for k, v := range e.Fields {
+			attrs[k] = v
+		}
+		if e.Component != "" {
+			attrs["component"] = e.Component
+		}
+		if e.TaskID != "" {
+			attrs["task_id"] = e.TaskID
+		}
+		if e.RequestID != "" {
+			attrs["request_id"] = e.RequestID
+		}
+		record.Attributes = otlpAttributes(attrs)
+		records = append(records, record)
+	}
+	return otlpRequest{ResourceLogs: []otlpResourceLogs{{
+		Resource: otlpResource{Attributes: s.resource},
+		ScopeLogs: []otlpScopeLogs{{
+			Scope:      otlpScope{Name: "phobos.org.uk/agency/internal/logging"},
+			LogRecords: records,
+		}},
+	}}}
+}
+
+// otlpSeverity maps a level to the first OTLP severity number of its range.
+func otlpSeverity(level Level) int {
+	switch level {
+	case LevelDebug:
+		return 5
+	case LevelWarn:
+		return 13
+	case LevelError:
+		return 17
+	default:
+		return 9
+	}
+}
+
+// otlpAttributes converts a map to OTLP attributes, sorted by key.
+func otlpAttributes[V any](m map[string]V) []otlpKeyValue {
+	attrs := make([]otlpKeyValue, 0, len(m))
+	for k, v := range m {
+		attrs = append(attrs, otlpKeyValue{Key: k, Value: otlpValue(v)})
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+	return attrs
+}
+
+// otlpValue converts a field value to an OTLP value. Values without an OTLP
+// scalar type are sent as JSON strings.
+func otlpValue(v any) otlpAnyValue {
+	switch v := v.(type) {
+	case string:
+		return otlpString(v)
+	case bool:
+		return otlpAnyValue{BoolValue: &v}
+	case int:
+		s := strconv.Itoa(v)
+		return otlpAnyValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return otlpAnyValue{IntValue: &s}
+	case float64:
+		return otlpAnyValue{DoubleValue: &v}
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return otlpString(fmt.Sprint(v))
+		}
+		return otlpString(string(data))
+	}
+}
+
+func otlpString(s string) otlpAnyValue {
+	return otlpAnyValue{StringValue: &s}
+}
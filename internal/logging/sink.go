@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Sink receives log entries in addition to the logger's output, e.g. to keep
+// them across restarts or forward them to a central log stack. Write is
+// called with the logger's lock held, so it must not block for long.
+type Sink interface {
+	Name() string // Short name used when reporting failures, e.g. "file"
+	Write(e Entry) error
+	Close() error
+}
+
+// Defaults for FileSink
+const (
+	DefaultFileMaxBytes = 10 << 20
+	DefaultFileMaxFiles = 5
+)
+
+// FileSink appends entries as JSON lines to a file, rotating it when it
+// reaches maxBytes: path becomes path.1, path.1 becomes path.2 and so on,
+// keeping maxFiles rotated files.
+type FileSink struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+// NewFileSink opens path for appending, creating it and its directory if
+// needed. Zero maxBytes or maxFiles use the defaults.
+func NewFileSink(path string, maxBytes int64, maxFiles int) (*FileSink, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultFileMaxBytes
+	}
+	if maxFiles <= 0 {
+		maxFiles = DefaultFileMaxFiles
+	}
+	s := &FileSink{path: path, maxBytes: maxBytes, maxFiles: maxFiles}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("creating log directory: %w", err)
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open opens the current log file for appending.
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("opening log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("opening log file: %w", err)
+	}
+	s.file = f
+	s.size = info.Size()
+	return nil
+}
+
+// Name implements Sink.
+func (s *FileSink) Name() string { return "file" }
+
+// Write implements Sink.
+func (s *FileSink) Write(e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		// A failed rotation left no file open; try again
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	if s.size > 0 && s.size+int64(len(data)) > s.maxBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(data)
+	s.size += int64(n)
+	return err
+}
+
+// rotate shifts the rotated files up by one, dropping the oldest, and starts
+// a new file. Called with s.mu held.
+func (s *FileSink) rotate() error {
+	s.file.Close()
+	s.file = nil
+	os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxFiles))
+	for i := s.maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+	}
+	if err := os.Rename(s.path, s.path+".1"); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("rotating log file: %w", err)
+	}
+	return s.open()
+}
+
+// Close implements Sink.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
@@ -0,0 +1,138 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSink_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "agent.log")
+	sink, err := NewFileSink(path, 200, 2)
+	require.NoError(t, err)
+
+	logger := New(Config{Output: io.Discard, Component: "agent"})
+	logger.AddSink(sink)
+	for i := 0; i < 10; i++ {
+		logger.Info("rotated entry", map[string]any{"n": i})
+	}
+	require.NoError(t, logger.Close())
+
+	// Only the current file and two rotated ones are kept
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+	var lines []string
+	for _, name := range []string{path + ".2", path + ".1", path} {
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(data), 200)
+		lines = append(lines, strings.Split(strings.TrimSpace(string(data)), "\n")...)
+	}
+
+	// Each line is an entry, and the newest entries survive in order
+	var last Entry
+	require.NoError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &last))
+	assert.Equal(t, float64(9), last.Fields["n"])
+	assert.Equal(t, "agent", last.Component)
+
+	// Reopening appends to the current file
+	sink, err = NewFileSink(path, 200, 2)
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(Entry{Message: "after restart"}))
+	require.NoError(t, sink.Close())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "after restart")
+}
+
+func TestOTLPSink_Export(t *testing.T) {
+	var mu sync.Mutex
+	var requests []otlpRequest
+	var auth string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/logs", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var req otlpRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		mu.Lock()
+		requests = append(requests, req)
+		auth = r.Header.Get("Authorization")
+		mu.Unlock()
+	}))
+	defer collector.Close()
+
+	logger := New(Config{Output: io.Discard, Level: LevelDebug, Component: "agent"})
+	logger.AddSink(NewOTLPSink(OTLPConfig{
+		Endpoint: collector.URL + "/",
+		Headers:  map[string]string{"Authorization": "Bearer otel"},
+		Resource: map[string]string{"service.name": "agency-agent"},
+	}))
+	logger.WithTask("task-1").Warn("slow tool", map[string]any{"tool": "Bash", "seconds": 12})
+	logger.Debug("detail")
+	require.NoError(t, logger.Close(), "close flushes the pending batch")
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, requests, 1)
+	assert.Equal(t, "Bearer otel", auth)
+	rl := requests[0].ResourceLogs[0]
+	assert.Equal(t, "service.name", rl.Resource.Attributes[0].Key)
+	assert.Equal(t, "agency-agent", *rl.Resource.Attributes[0].Value.StringValue)
+
+	records := rl.ScopeLogs[0].LogRecords
+	require.Len(t, records, 2)
+	assert.Equal(t, 13, records[0].SeverityNumber)
+	assert.Equal(t, "WARN", records[0].SeverityText)
+	assert.Equal(t, "slow tool", *records[0].Body.StringValue)
+	attrs := map[string]otlpAnyValue{}
+	for _, kv := range records[0].Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	assert.Equal(t, "task-1", *attrs["task_id"].StringValue)
+	assert.Equal(t, "Bash", *attrs["tool"].StringValue)
+	assert.Equal(t, "12", *attrs["seconds"].IntValue)
+	assert.Equal(t, 5, records[1].SeverityNumber)
+}
+
+// failingSink fails every write until fixed.
+type failingSink struct{ fixed bool }
+
+func (s *failingSink) Name() string { return "broken" }
+func (s *failingSink) Close() error { return nil }
+func (s *failingSink) Write(Entry) error {
+	if s.fixed {
+		return nil
+	}
+	return errors.New("disk full")
+}
+
+func TestLogger_SinkFailureReportedOnce(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(Config{Output: &buf})
+	sink := &failingSink{}
+	logger.AddSink(sink)
+
+	logger.Info("one")
+	logger.Info("two")
+	assert.Equal(t, 1, strings.Count(buf.String(), "log sink write failed"))
+	assert.Contains(t, buf.String(), `"sink":"broken"`)
+	assert.Equal(t, int64(2), logger.Stats().Total, "failures are not counted as entries")
+
+	// A failure after the sink recovers is reported again
+	sink.fixed = true
+	logger.Info("three")
+	sink.fixed = false
+	logger.Info("four")
+	assert.Equal(t, 2, strings.Count(buf.String(), "log sink write failed"))
+}
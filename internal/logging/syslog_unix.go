@@ -0,0 +1,53 @@
+//go:build unix
+
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+)
+
+// SyslogSink sends entries to syslog as JSON messages, at the syslog
+// severity matching their level.
+type SyslogSink struct {
+	w *syslog.Writer
+}
+
+// NewSyslogSink connects to the syslog daemon at address over network
+// ("udp", "tcp" or "unix"); an empty network connects to the local daemon.
+// Messages are tagged with tag.
+func NewSyslogSink(network, address, tag string) (*SyslogSink, error) {
+	w, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to syslog: %w", err)
+	}
+	return &SyslogSink{w: w}, nil
+}
+
+// Name implements Sink.
+func (s *SyslogSink) Name() string { return "syslog" }
+
+// Write implements Sink.
+func (s *SyslogSink) Write(e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	msg := string(data)
+	switch e.Level {
+	case LevelDebug:
+		return s.w.Debug(msg)
+	case LevelWarn:
+		return s.w.Warning(msg)
+	case LevelError:
+		return s.w.Err(msg)
+	default:
+		return s.w.Info(msg)
+	}
+}
+
+// Close implements Sink.
+func (s *SyslogSink) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,22 @@
+//go:build windows
+
+package logging
+
+import "errors"
+
+// SyslogSink is unavailable on Windows.
+type SyslogSink struct{}
+
+// NewSyslogSink always fails on Windows, which has no syslog.
+func NewSyslogSink(network, address, tag string) (*SyslogSink, error) {
+	return nil, errors.New("syslog is not supported on windows")
+}
+
+// Name implements Sink.
+func (s *SyslogSink) Name() string { return "syslog" }
+
+// Write implements Sink.
+func (s *SyslogSink) Write(e Entry) error { return errors.New("syslog is not supported on windows") }
+
+// Close implements Sink.
+func (s *SyslogSink) Close() error { return nil }
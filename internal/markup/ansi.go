@@ -0,0 +1,100 @@
+package markup
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ansiPattern matches CSI sequences (including SGR colours), OSC sequences
+// such as terminal titles and hyperlinks, and two-character escapes.
+var ansiPattern = regexp.MustCompile(`\x1b(?:\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(?:\x07|\x1b\\)|[@-Z\\-_])`)
+
+// ansiColors names the eight basic terminal colours, in SGR order.
+var ansiColors = [8]string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// StripANSI removes ANSI escape sequences from s.
+func StripANSI(s string) string {
+	if !strings.Contains(s, "\x1b") {
+		return s
+	}
+	return ansiPattern.ReplaceAllString(s, "")
+}
+
+// ansiHTML escapes s for HTML, turning SGR bold and foreground colours into
+// spans with ansi-* classes and dropping every other escape sequence.
+func ansiHTML(s string) string {
+	if !strings.Contains(s, "\x1b") {
+		return html.EscapeString(s)
+	}
+
+	var b strings.Builder
+	var bold bool
+	var color string
+	open := false
+	last := 0
+	for _, loc := range ansiPattern.FindAllStringIndex(s, -1) {
+		b.WriteString(html.EscapeString(s[last:loc[0]]))
+		last = loc[1]
+		seq := s[loc[0]:loc[1]]
+		if !strings.HasPrefix(seq, "\x1b[") || !strings.HasSuffix(seq, "m") {
+			continue
+		}
+		bold, color = applySGR(seq[2:len(seq)-1], bold, color)
+		if open {
+			b.WriteString("</span>")
+			open = false
+		}
+		var classes []string
+		if bold {
+			classes = append(classes, "ansi-bold")
+		}
+		if color != "" {
+			classes = append(classes, "ansi-"+color)
+		}
+		if len(classes) > 0 {
+			b.WriteString(`<span class="` + strings.Join(classes, " ") + `">`)
+			open = true
+		}
+	}
+	b.WriteString(html.EscapeString(s[last:]))
+	if open {
+		b.WriteString("</span>")
+	}
+	return b.String()
+}
+
+// applySGR returns the bold and colour state after the SGR parameters
+// params, e.g. "1;31". Background colours and other attributes are ignored.
+func applySGR(params string, bold bool, color string) (bool, string) {
+	codes := strings.Split(params, ";")
+	for i := 0; i < len(codes); i++ {
+		code, err := strconv.Atoi(codes[i])
+		if err != nil {
+			code = 0 // An empty parameter means reset
+		}
+		switch {
+		case code == 0:
+			bold, color = false, ""
+		case code == 1:
+			bold = true
+		case code == 22:
+			bold = false
+		case code >= 30 && code <= 37:
+			color = ansiColors[code-30]
+		case code >= 90 && code <= 97:
+			color = "bright-" + ansiColors[code-90]
+		case code == 39:
+			color = ""
+		case code == 38 || code == 48:
+			// Extended colours: skip "5;n" or "2;r;g;b"
+			if i+1 < len(codes) && codes[i+1] == "5" {
+				i += 2
+			} else if i+1 < len(codes) && codes[i+1] == "2" {
+				i += 4
+			}
+		}
+	}
+	return bold, color
+}
@@ -0,0 +1,407 @@
+// Package markup renders task output, which is mostly markdown with the
+// occasional ANSI escape sequence, as HTML that is safe to embed in a page.
+//
+// It covers the markdown the CLIs produce: headings, paragraphs, fenced
+// code, lists, block quotes, tables, rules, emphasis, code spans and links.
+// All text is escaped and only a fixed set of tags is produced, so HTML in
+// the input shows as text; links are kept only for http, https and mailto
+// URLs, and images become links so nothing is loaded from elsewhere.
+package markup
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	headingPattern   = regexp.MustCompile(`^(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	rulePattern      = regexp.MustCompile(`^(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	fencePattern     = regexp.MustCompile("^[ ]{0,3}(`{3,}|~{3,})[ \t]*([^`\\s]*)")
+	listItemPattern  = regexp.MustCompile(`^( *)([-*+]|\d{1,9}[.)])(?:[ \t]+|$)`)
+	tableSepPattern  = regexp.MustCompile(`^\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?$`)
+	codeLangPattern  = regexp.MustCompile(`^[A-Za-z0-9_+#.-]{1,32}$`)
+	codeSpanPattern  = regexp.MustCompile("(`+)([^`]|[^`].*?[^`])(`+)")
+	escapePattern    = regexp.MustCompile("\\\\([!-/:-@\\[-`{-~])")
+	linkPattern      = regexp.MustCompile(`(!?)\[([^\]]*)\]\(([^()\s]+)(?:\s+&#34;[^&]*&#34;)?\)`)
+	autolinkPattern  = regexp.MustCompile(`&lt;((?:https?://|mailto:)[^\s&]+)&gt;`)
+	bareURLPattern   = regexp.MustCompile(`https?://(?:[^\s&\x00]|&amp;)*[^\s&\x00.,;:!?)\]]`)
+	strongPattern    = regexp.MustCompile(`\*\*([^\s*](?:[^*]*[^\s*])?)\*\*`)
+	strongUPattern   = regexp.MustCompile(`(^|[^\w])__([^\s_](?:[^_]*[^\s_])?)__($|[^\w])`)
+	emPattern        = regexp.MustCompile(`\*([^\s*](?:[^*]*[^\s*])?)\*`)
+	emUPattern       = regexp.MustCompile(`(^|[^\w])_([^\s_](?:[^_]*[^\s_])?)_($|[^\w])`)
+	strikePattern    = regexp.MustCompile(`~~([^\s~](?:[^~]*[^\s~])?)~~`)
+	placeholderMatch = regexp.MustCompile("\x00([0-9]+)\x00")
+	hardBreakPattern = regexp.MustCompile(` {2,}\n`)
+)
+
+// Render returns text as sanitised HTML. ANSI colours in code blocks become
+// spans with ansi-* classes; elsewhere escape sequences are removed.
+func Render(text string) string {
+	if text == "" {
+		return ""
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.Map(func(r rune) rune {
+		if r == 0 || r == '\x01' {
+			return -1 // Used as markers while rendering
+		}
+		return r
+	}, text)
+
+	var b strings.Builder
+	renderBlocks(&b, strings.Split(text, "\n"), false)
+	return b.String()
+}
+
+// renderBlocks renders lines as a sequence of blocks. In tight list items
+// paragraphs are not wrapped in <p>.
+func renderBlocks(b *strings.Builder, lines []string, tight bool) {
+	for i := 0; i < len(lines); {
+		plain := StripANSI(lines[i])
+		trimmed := strings.TrimSpace(plain)
+		switch {
+		case trimmed == "":
+			i++
+		case fencePattern.MatchString(lines[i]):
+			i = renderFence(b, lines, i)
+		case headingPattern.MatchString(trimmed):
+			m := headingPattern.FindStringSubmatch(trimmed)
+			level := strconv.Itoa(len(m[1]))
+			b.WriteString("<h" + level + ">" + inline(m[2]) + "</h" + level + ">\n")
+			i++
+		case rulePattern.MatchString(trimmed):
+			b.WriteString("<hr>\n")
+			i++
+		case strings.HasPrefix(trimmed, ">"):
+			var quoted []string
+			for ; i < len(lines); i++ {
+				t := strings.TrimSpace(StripANSI(lines[i]))
+				if !strings.HasPrefix(t, ">") {
+					break
+				}
+				t = strings.TrimPrefix(t, ">")
+				quoted = append(quoted, strings.TrimPrefix(t, " "))
+			}
+			b.WriteString("<blockquote>\n")
+			renderBlocks(b, quoted, false)
+			b.WriteString("</blockquote>\n")
+		case listItemPattern.MatchString(plain):
+			i = renderList(b, lines, i)
+		case i+1 < len(lines) && isTableStart(trimmed, strings.TrimSpace(StripANSI(lines[i+1]))):
+			i = renderTable(b, lines, i)
+		default:
+			start := i
+			for i++; i < len(lines) && !startsBlock(lines[i]); i++ {
+			}
+			para := inline(strings.Join(lines[start:i], "\n"))
+			if tight {
+				b.WriteString(para + "\n")
+			} else {
+				b.WriteString("<p>" + para + "</p>\n")
+			}
+		}
+	}
+}
+
+// isTableStart reports whether header and sep, both trimmed, start a table.
+func isTableStart(header, sep string) bool {
+	return strings.Contains(header, "|") && strings.Contains(sep, "|") && tableSepPattern.MatchString(sep)
+}
+
+// startsBlock reports whether line ends a paragraph: it is blank or starts
+// a block other than a paragraph.
+func startsBlock(line string) bool {
+	plain := StripANSI(line)
+	trimmed := strings.TrimSpace(plain)
+	return trimmed == "" ||
+		fencePattern.MatchString(line) ||
+		headingPattern.MatchString(trimmed) ||
+		rulePattern.MatchString(trimmed) ||
+		strings.HasPrefix(trimmed, ">") ||
+		listItemPattern.MatchString(plain)
+}
+
+// renderFence renders the fenced code block starting at lines[start] and
+// returns the index after it. An unclosed fence runs to the end.
+func renderFence(b *strings.Builder, lines []string, start int) int {
+	m := fencePattern.FindStringSubmatch(lines[start])
+	marker := m[1]
+	lang := StripANSI(m[2])
+
+	i := start + 1
+	var code []string
+	for ; i < len(lines); i++ {
+		t := strings.TrimSpace(StripANSI(lines[i]))
+		if strings.HasPrefix(t, marker) && strings.Trim(t, marker[:1]) == "" {
+			i++
+			break
+		}
+		code = append(code, lines[i])
+	}
+
+	b.WriteString("<pre><code")
+	if codeLangPattern.MatchString(lang) {
+		b.WriteString(` class="language-` + html.EscapeString(lang) + `"`)
+	}
+	b.WriteString(">" + ansiHTML(strings.Join(code, "\n")) + "</code></pre>\n")
+	return i
+}
+
+// renderList renders the list starting at lines[start] and returns the
+// index after it. Items are the lines up to the next marker at the list's
+// indentation; more deeply indented lines belong to the item, which is
+// rendered as blocks, so nested lists work.
+func renderList(b *strings.Builder, lines []string, start int) int {
+	first := listItemPattern.FindStringSubmatch(StripANSI(lines[start]))
+	indent := len(first[1])
+	ordered := first[2][0] >= '0' && first[2][0] <= '9'
+
+	var items [][]string
+	tight := true
+	i := start
+	for i < len(lines) {
+		plain := StripANSI(lines[i])
+		m := listItemPattern.FindStringSubmatch(plain)
+		if m == nil || len(m[1]) != indent || (m[2][0] >= '0' && m[2][0] <= '9') != ordered {
+			break
+		}
+		item := []string{plain[len(m[0]):]}
+		contentIndent := len(m[0])
+		for i++; i < len(lines); i++ {
+			plain := StripANSI(lines[i])
+			if strings.TrimSpace(plain) == "" {
+				// A blank line continues the item only if indented content follows
+				next := i + 1
+				for next < len(lines) && strings.TrimSpace(StripANSI(lines[next])) == "" {
+					next++
+				}
+				if next < len(lines) && leadingSpaces(StripANSI(lines[next])) > indent {
+					item = append(item, "")
+					tight = false
+					continue
+				}
+				if next < len(lines) {
+					if m := listItemPattern.FindStringSubmatch(StripANSI(lines[next])); m != nil && len(m[1]) == indent {
+						tight = false
+					}
+				}
+				i = next
+				break
+			}
+			spaces := leadingSpaces(plain)
+			if spaces > indent {
+				item = append(item, dedent(plain, min(spaces, contentIndent)))
+				continue
+			}
+			if startsBlock(lines[i]) {
+				break
+			}
+			item = append(item, plain) // Lazy paragraph continuation
+		}
+		items = append(items, item)
+	}
+
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+	b.WriteString("<" + tag)
+	if n, err := strconv.Atoi(strings.TrimRight(first[2], ".)")); ordered && err == nil && n != 1 {
+		b.WriteString(` start="` + strconv.Itoa(n) + `"`)
+	}
+	b.WriteString(">\n")
+	for _, item := range items {
+		b.WriteString("<li>")
+		renderBlocks(b, item, tight)
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</" + tag + ">\n")
+	return i
+}
+
+// renderTable renders the table whose header is lines[start] and returns
+// the index after it.
+func renderTable(b *strings.Builder, lines []string, start int) int {
+	header := tableCells(lines[start])
+	var aligns []string
+	for _, cell := range tableCells(lines[start+1]) {
+		switch left, right := strings.HasPrefix(cell, ":"), strings.HasSuffix(cell, ":"); {
+		case left && right:
+			aligns = append(aligns, "center")
+		case right:
+			aligns = append(aligns, "right")
+		case left:
+			aligns = append(aligns, "left")
+		default:
+			aligns = append(aligns, "")
+		}
+	}
+
+	writeRow := func(cells []string, tag string) {
+		b.WriteString("<tr>")
+		for j := range header {
+			cell := ""
+			if j < len(cells) {
+				cell = cells[j]
+			}
+			b.WriteString("<" + tag)
+			if j < len(aligns) && aligns[j] != "" {
+				b.WriteString(` style="text-align: ` + aligns[j] + `"`)
+			}
+			b.WriteString(">" + inline(cell) + "</" + tag + ">")
+		}
+		b.WriteString("</tr>\n")
+	}
+
+	b.WriteString("<table>\n<thead>\n")
+	writeRow(header, "th")
+	b.WriteString("</thead>\n")
+	i := start + 2
+	if i < len(lines) && strings.Contains(lines[i], "|") {
+		b.WriteString("<tbody>\n")
+		for ; i < len(lines); i++ {
+			t := strings.TrimSpace(StripANSI(lines[i]))
+			if t == "" || !strings.Contains(t, "|") {
+				break
+			}
+			writeRow(tableCells(lines[i]), "td")
+		}
+		b.WriteString("</tbody>\n")
+	}
+	b.WriteString("</table>\n")
+	return i
+}
+
+// tableCells splits a table row into trimmed cells.
+func tableCells(line string) []string {
+	line = strings.TrimSpace(StripANSI(line))
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+	cells := strings.Split(line, "|")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+// dedent removes n columns of indentation from line.
+func dedent(line string, n int) string {
+	for i, r := range line {
+		if n <= 0 || (r != ' ' && r != '\t') {
+			return line[i:]
+		}
+		if r == '\t' {
+			n -= 4
+		} else {
+			n--
+		}
+	}
+	return ""
+}
+
+// leadingSpaces counts the indentation of line, with tabs as four spaces.
+func leadingSpaces(line string) int {
+	n := 0
+	for _, r := range line {
+		switch r {
+		case ' ':
+			n++
+		case '\t':
+			n += 4
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// inline renders the inline markdown of a paragraph or other short text.
+// Code spans, escaped characters and links are swapped for placeholders
+// while the rest is escaped and emphasised, then put back.
+func inline(s string) string {
+	s = StripANSI(s)
+	var held []string
+	hold := func(rendered string) string {
+		held = append(held, rendered)
+		return "\x00" + strconv.Itoa(len(held)-1) + "\x00"
+	}
+
+	s = codeSpanPattern.ReplaceAllStringFunc(s, func(m string) string {
+		parts := codeSpanPattern.FindStringSubmatch(m)
+		if len(parts[1]) != len(parts[3]) {
+			return m
+		}
+		return hold("<code>" + html.EscapeString(strings.TrimSpace(parts[2])) + "</code>")
+	})
+	s = escapePattern.ReplaceAllStringFunc(s, func(m string) string {
+		return hold(html.EscapeString(m[1:]))
+	})
+	s = hardBreakPattern.ReplaceAllString(s, "\x01")
+	s = html.EscapeString(s)
+
+	s = linkPattern.ReplaceAllStringFunc(s, func(m string) string {
+		parts := linkPattern.FindStringSubmatch(m)
+		text, href := parts[2], html.UnescapeString(parts[3])
+		if parts[1] == "!" && text == "" {
+			text = html.EscapeString(href)
+		}
+		if !safeURL(href) {
+			return emphasis(text)
+		}
+		return hold(link(href, emphasis(text)))
+	})
+	s = autolinkPattern.ReplaceAllStringFunc(s, func(m string) string {
+		href := html.UnescapeString(autolinkPattern.FindStringSubmatch(m)[1])
+		return hold(link(href, html.EscapeString(href)))
+	})
+	s = bareURLPattern.ReplaceAllStringFunc(s, func(m string) string {
+		href := html.UnescapeString(m)
+		if !safeURL(href) {
+			return m
+		}
+		return hold(link(href, m))
+	})
+
+	s = emphasis(s)
+	s = strings.ReplaceAll(s, "\x01", "<br>\n")
+	for strings.Contains(s, "\x00") {
+		s = placeholderMatch.ReplaceAllStringFunc(s, func(m string) string {
+			n, _ := strconv.Atoi(m[1 : len(m)-1])
+			return held[n]
+		})
+	}
+	return s
+}
+
+// emphasis applies strong, emphasis and strikethrough to escaped text.
+func emphasis(s string) string {
+	s = strongPattern.ReplaceAllString(s, "<strong>$1</strong>")
+	s = strongUPattern.ReplaceAllString(s, "$1<strong>$2</strong>$3")
+	s = emPattern.ReplaceAllString(s, "<em>$1</em>")
+	s = emUPattern.ReplaceAllString(s, "$1<em>$2</em>$3")
+	return strikePattern.ReplaceAllString(s, "<del>$1</del>")
+}
+
+// link returns an anchor for href, which must be safe, around content.
+func link(href, content string) string {
+	return `<a href="` + html.EscapeString(href) + `" rel="noopener noreferrer" target="_blank">` + content + `</a>`
+}
+
+// safeURL reports whether href may be linked: an http, https or mailto
+// URL, or a relative one.
+func safeURL(href string) bool {
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto":
+		return true
+	case "":
+		return true // url.Parse rejects a colon before the first slash
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package markup
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderBlocks(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "", ""},
+		{"paragraphs", "one\ntwo\n\nthree", "<p>one\ntwo</p>\n<p>three</p>\n"},
+		{"heading", "## Summary ##", "<h2>Summary</h2>\n"},
+		{"hashtag is not a heading", "#42 fixed", "<p>#42 fixed</p>\n"},
+		{"rule", "text\n\n---", "<p>text</p>\n<hr>\n"},
+		{"fence", "```go\nfunc main() {}\n```", "<pre><code class=\"language-go\">func main() {}</code></pre>\n"},
+		{"unclosed fence", "~~~\n<b>", "<pre><code>&lt;b&gt;</code></pre>\n"},
+		{"bad fence language", "```a\"b\nx\n```", "<pre><code>x</code></pre>\n"},
+		{"quote", "> quoted\n> more", "<blockquote>\n<p>quoted\nmore</p>\n</blockquote>\n"},
+		{"tight list", "- one\n- two", "<ul>\n<li>one\n</li>\n<li>two\n</li>\n</ul>\n"},
+		{"ordered start", "3. c\n4. d", "<ol start=\"3\">\n<li>c\n</li>\n<li>d\n</li>\n</ol>\n"},
+		{"nested list", "- a\n  - b\n- c", "<ul>\n<li>a\n<ul>\n<li>b\n</li>\n</ul>\n</li>\n<li>c\n</li>\n</ul>\n"},
+		{"loose list", "- a\n\n- b", "<ul>\n<li><p>a</p>\n</li>\n<li><p>b</p>\n</li>\n</ul>\n"},
+		{
+			"table",
+			"| File | Lines |\n|:-----|------:|\n| a.go | 12 |",
+			"<table>\n<thead>\n<tr><th style=\"text-align: left\">File</th><th style=\"text-align: right\">Lines</th></tr>\n</thead>\n" +
+				"<tbody>\n<tr><td style=\"text-align: left\">a.go</td><td style=\"text-align: right\">12</td></tr>\n</tbody>\n</table>\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.want, Render(tt.in))
+		})
+	}
+}
+
+func TestRenderInline(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"emphasis", "**bold**, *em*, _em_ and ~~gone~~", "<strong>bold</strong>, <em>em</em>, <em>em</em> and <del>gone</del>"},
+		{"snake case", "run_task_now and 2 * 3 * 4", "run_task_now and 2 * 3 * 4"},
+		{"code span", "use `a *b* <c>`", "use <code>a *b* &lt;c&gt;</code>"},
+		{"escape", `\*not em\*`, "*not em*"},
+		{"link", "[docs](https://example.com/a?b=1&c=2)", `<a href="https://example.com/a?b=1&amp;c=2" rel="noopener noreferrer" target="_blank">docs</a>`},
+		{"relative link", "[readme](docs/README.md)", `<a href="docs/README.md" rel="noopener noreferrer" target="_blank">readme</a>`},
+		{"bare URL", "see https://example.com/x.", `see <a href="https://example.com/x" rel="noopener noreferrer" target="_blank">https://example.com/x</a>.`},
+		{"image becomes link", "![shot](https://example.com/s.png)", `<a href="https://example.com/s.png" rel="noopener noreferrer" target="_blank">shot</a>`},
+		{"hard break", "one  \ntwo", "one<br>\ntwo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, "<p>"+tt.want+"</p>\n", Render(tt.in))
+		})
+	}
+}
+
+func TestRenderSanitises(t *testing.T) {
+	t.Parallel()
+
+	inputs := []string{
+		`<script>alert(1)</script>`,
+		`<img src=x onerror=alert(1)>`,
+		`[click](javascript:alert(1))`,
+		`[click](JAVASCRIPT:alert(1))`,
+		`[click](&#106;avascript:alert(1))`,
+		`[x](https://a.com/"onmouseover="alert(1))`,
+		`<javascript:alert(1)>`,
+		"```\"><script>\nx\n```",
+		"| <b>h</b> |\n|---|\n| <i>c</i> |",
+	}
+	for _, in := range inputs {
+		out := Render(in)
+		require.NotContains(t, out, "<script", in)
+		require.NotContains(t, out, "<img", in)
+		require.NotContains(t, out, "<b>", in)
+		require.NotContains(t, out, `href="javascript`, in)
+		require.NotContains(t, strings.ToLower(out), `href="javascript`, in)
+		require.NotContains(t, out, `" onmouseover`, in)
+	}
+}
+
+func TestANSI(t *testing.T) {
+	t.Parallel()
+
+	colored := "\x1b[1;31mFAIL\x1b[0m ok \x1b]0;title\x07\x1b[38;5;208mx\x1b[K"
+	require.Equal(t, "FAIL ok x", StripANSI(colored))
+	require.Equal(t, `<span class="ansi-bold ansi-red">FAIL</span> ok x`, ansiHTML(colored))
+	require.Equal(t, `<span class="ansi-bright-green">&lt;ok&gt;</span>`, ansiHTML("\x1b[92m<ok>"))
+
+	// Colours are kept in code blocks and stripped elsewhere
+	out := Render("\x1b[32mDone\x1b[0m\n\n```\n\x1b[31m-old\x1b[0m\n```")
+	require.Equal(t, "<p>Done</p>\n<pre><code><span class=\"ansi-red\">-old</span></code></pre>\n", out)
+}
@@ -0,0 +1,210 @@
+// Package mcp implements a Model Context Protocol server that exposes agency
+// operations as tools, so MCP clients such as Claude Desktop can submit and
+// track tasks. It speaks newline-delimited JSON-RPC 2.0 over stdio.
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/tlsutil"
+)
+
+// ProtocolVersion is the newest MCP revision the server implements.
+const ProtocolVersion = "2025-06-18"
+
+// supportedVersions lists the revisions the server can negotiate.
+var supportedVersions = []string{"2024-11-05", "2025-03-26", ProtocolVersion}
+
+// maxMessageSize bounds a single JSON-RPC message read from the client.
+const maxMessageSize = 10 * 1024 * 1024
+
+// JSON-RPC error codes
+const (
+	errParse          = -32700
+	errInvalidRequest = -32600
+	errMethodNotFound = -32601
+	errInvalidParams  = -32602
+)
+
+// Config configures the server.
+type Config struct {
+	AgentURL    string // Agent for direct tasks and history
+	DirectorURL string // Director internal API for the queue
+	AuthToken   string // Bearer token for agents with auth_token set (optional)
+	Version     string // Reported in serverInfo
+}
+
+// Server handles MCP requests from a single client.
+type Server struct {
+	config Config
+	client *http.Client
+	tools  []tool
+}
+
+// New creates a server backed by the configured agent and director.
+func New(cfg Config) *Server {
+	s := &Server{
+		config: cfg,
+		client: api.WithAuthToken(tlsutil.NewHTTPClient(30*time.Second, cfg.AgentURL, cfg.DirectorURL), cfg.AuthToken),
+	}
+	s.tools = s.toolset()
+	return s
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Serve reads requests from in and writes responses to out until in is
+// exhausted or ctx is cancelled. Requests are handled one at a time.
+func (s *Server) Serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	enc := json.NewEncoder(out)
+
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		resp := s.handle(ctx, line)
+		if resp == nil {
+			continue
+		}
+		if err := enc.Encode(resp); err != nil {
+			return fmt.Errorf("writing response: %w", err)
+		}
+	}
+	return scanner.Err()
+}
+
+// handle processes one message, returning nil for notifications.
+func (s *Server) handle(ctx context.Context, line []byte) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		return errorResponse(json.RawMessage("null"), errParse, "Parse error")
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		id := req.ID
+		if len(id) == 0 {
+			id = json.RawMessage("null")
+		}
+		return errorResponse(id, errInvalidRequest, "Invalid request")
+	}
+	notification := len(req.ID) == 0
+
+	var result any
+	var rerr *rpcError
+	switch req.Method {
+	case "initialize":
+		result, rerr = s.initialize(req.Params)
+	case "ping":
+		result = struct{}{}
+	case "tools/list":
+		result = map[string]any{"tools": s.tools}
+	case "tools/call":
+		result, rerr = s.callTool(ctx, req.Params)
+	default:
+		if notification {
+			// notifications/initialized, notifications/cancelled and the like
+			return nil
+		}
+		rerr = &rpcError{Code: errMethodNotFound, Message: "Method not found: " + req.Method}
+	}
+	if notification {
+		return nil
+	}
+	if rerr != nil {
+		return &rpcResponse{JSONRPC: "2.0", ID: req.ID, Error: rerr}
+	}
+	return &rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result}
+}
+
+func errorResponse(id json.RawMessage, code int, message string) *rpcResponse {
+	return &rpcResponse{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: message}}
+}
+
+// initialize negotiates the protocol version, echoing the client's if it is
+// supported and offering the newest otherwise.
+func (s *Server) initialize(params json.RawMessage) (any, *rpcError) {
+	var p struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &rpcError{Code: errInvalidParams, Message: "Invalid params: " + err.Error()}
+		}
+	}
+	version := ProtocolVersion
+	if slices.Contains(supportedVersions, p.ProtocolVersion) {
+		version = p.ProtocolVersion
+	}
+	return map[string]any{
+		"protocolVersion": version,
+		"capabilities":    map[string]any{"tools": map[string]any{}},
+		"serverInfo":      map[string]string{"name": "agency", "version": s.config.Version},
+		"instructions":    "Tools for running tasks on Agency coding agents. Use queue_task for work that can wait for a free agent, submit_task to run on the configured agent now, get_status to follow progress and search_history to find earlier results.",
+	}, nil
+}
+
+// callTool runs a tool. Failures of the tool itself are reported in the
+// result with isError set, so the model can see and react to them.
+func (s *Server) callTool(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+	var p struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if len(params) == 0 {
+		return nil, &rpcError{Code: errInvalidParams, Message: "Invalid params: missing params"}
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &rpcError{Code: errInvalidParams, Message: "Invalid params: " + err.Error()}
+	}
+	idx := slices.IndexFunc(s.tools, func(t tool) bool { return t.Name == p.Name })
+	if idx < 0 {
+		return nil, &rpcError{Code: errInvalidParams, Message: "Unknown tool: " + p.Name}
+	}
+	args := p.Arguments
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+
+	text, err := s.tools[idx].run(ctx, args)
+	if err != nil {
+		return toolResult(err.Error(), true), nil
+	}
+	return toolResult(text, false), nil
+}
+
+func toolResult(text string, isError bool) map[string]any {
+	return map[string]any{
+		"content": []map[string]string{{"type": "text", "text": text}},
+		"isError": isError,
+	}
+}
@@ -0,0 +1,300 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/api"
+)
+
+type testResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+type testToolResult struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	IsError bool `json:"isError"`
+}
+
+// serve feeds lines to the server and returns the responses in order.
+func serve(t *testing.T, s *Server, lines ...string) []testResponse {
+	t.Helper()
+	var out bytes.Buffer
+	require.NoError(t, s.Serve(context.Background(), strings.NewReader(strings.Join(lines, "\n")+"\n"), &out))
+
+	var responses []testResponse
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var resp testResponse
+		require.NoError(t, dec.Decode(&resp))
+		responses = append(responses, resp)
+	}
+	return responses
+}
+
+// callTool invokes a tool and returns its result.
+func callTool(t *testing.T, s *Server, name, args string) testToolResult {
+	t.Helper()
+	responses := serve(t, s, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"`+name+`","arguments":`+args+`}}`)
+	require.Len(t, responses, 1)
+	require.Nil(t, responses[0].Error)
+
+	var result testToolResult
+	require.NoError(t, json.Unmarshal(responses[0].Result, &result))
+	require.Len(t, result.Content, 1)
+	require.Equal(t, "text", result.Content[0].Type)
+	return result
+}
+
+// recorder keeps the last request a fake agency server received.
+type recorder struct {
+	mu     sync.Mutex
+	url    *url.URL
+	header http.Header
+	body   []byte
+}
+
+func (rec *recorder) record(r *http.Request) []byte {
+	body, _ := io.ReadAll(r.Body)
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.url, rec.header, rec.body = r.URL, r.Header, body
+	return body
+}
+
+func (rec *recorder) last() (*url.URL, http.Header, []byte) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.url, rec.header, rec.body
+}
+
+// newFakeAgency starts an agent and director that record what they were sent.
+// The agent's task-1 completes on the third poll.
+func newFakeAgency(t *testing.T) (*Server, *recorder) {
+	t.Helper()
+	rec := &recorder{}
+	var polls atomic.Int32
+
+	agentMux := http.NewServeMux()
+	agentMux.HandleFunc("POST /task", func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(string(rec.record(r)), "busy") {
+			api.WriteError(w, http.StatusConflict, api.ErrorAgentBusy, "Agent is already working on a task")
+			return
+		}
+		polls.Store(0)
+		api.WriteJSON(w, http.StatusCreated, map[string]string{"task_id": "task-1", "session_id": "sess-1"})
+	})
+	agentMux.HandleFunc("GET /task/{id}", func(w http.ResponseWriter, r *http.Request) {
+		rec.record(r)
+		if r.PathValue("id") != "task-1" {
+			api.WriteError(w, http.StatusNotFound, api.ErrorNotFound, "Task not found")
+			return
+		}
+		state := "working"
+		if polls.Add(1) >= 3 {
+			state = "completed"
+		}
+		api.WriteJSON(w, http.StatusOK, map[string]string{"task_id": "task-1", "state": state, "output": "done"})
+	})
+	agentMux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		api.WriteJSON(w, http.StatusOK, map[string]string{"type": "agent", "state": "idle"})
+	})
+	agentMux.HandleFunc("GET /history", func(w http.ResponseWriter, r *http.Request) {
+		rec.record(r)
+		api.WriteJSON(w, http.StatusOK, map[string]any{"entries": []map[string]string{{"task_id": "task-0"}}, "total": 1})
+	})
+	agent := httptest.NewServer(api.RequireAuthToken("secret")(agentMux))
+	t.Cleanup(agent.Close)
+
+	directorMux := http.NewServeMux()
+	directorMux.HandleFunc("POST /api/queue/task", func(w http.ResponseWriter, r *http.Request) {
+		rec.record(r)
+		api.WriteJSON(w, http.StatusCreated, map[string]any{"queue_id": "queue-1", "position": 1, "state": "pending"})
+	})
+	directorMux.HandleFunc("GET /api/queue/{id}", func(w http.ResponseWriter, r *http.Request) {
+		rec.record(r)
+		api.WriteJSON(w, http.StatusOK, map[string]string{"queue_id": r.PathValue("id"), "state": "pending"})
+	})
+	director := httptest.NewServer(directorMux)
+	t.Cleanup(director.Close)
+
+	s := New(Config{AgentURL: agent.URL, DirectorURL: director.URL, AuthToken: "secret", Version: "test"})
+	return s, rec
+}
+
+func TestServeProtocol(t *testing.T) {
+	t.Parallel()
+
+	s := New(Config{Version: "1.2.3"})
+	responses := serve(t, s,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"test"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":"two","method":"ping"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":4,"method":"resources/list"}`,
+		`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"launch_missiles"}}`,
+		`{not json`,
+		`{"jsonrpc":"1.0","id":6,"method":"ping"}`,
+	)
+	require.Len(t, responses, 7) // The notification gets no reply
+
+	var init struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		ServerInfo      struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"serverInfo"`
+		Capabilities map[string]any `json:"capabilities"`
+	}
+	require.NoError(t, json.Unmarshal(responses[0].Result, &init))
+	require.Equal(t, "2024-11-05", init.ProtocolVersion)
+	require.Equal(t, "agency", init.ServerInfo.Name)
+	require.Equal(t, "1.2.3", init.ServerInfo.Version)
+	require.Contains(t, init.Capabilities, "tools")
+
+	require.JSONEq(t, `"two"`, string(responses[1].ID))
+	require.JSONEq(t, `{}`, string(responses[1].Result))
+
+	var list struct {
+		Tools []struct {
+			Name        string         `json:"name"`
+			InputSchema map[string]any `json:"inputSchema"`
+		} `json:"tools"`
+	}
+	require.NoError(t, json.Unmarshal(responses[2].Result, &list))
+	var names []string
+	for _, tl := range list.Tools {
+		names = append(names, tl.Name)
+		require.Equal(t, "object", tl.InputSchema["type"])
+	}
+	require.Equal(t, []string{"submit_task", "queue_task", "get_status", "search_history"}, names)
+
+	require.Equal(t, errMethodNotFound, responses[3].Error.Code)
+	require.Equal(t, errInvalidParams, responses[4].Error.Code)
+	require.Equal(t, errParse, responses[5].Error.Code)
+	require.JSONEq(t, "null", string(responses[5].ID))
+	require.Equal(t, errInvalidRequest, responses[6].Error.Code)
+}
+
+func TestServeNegotiatesVersion(t *testing.T) {
+	t.Parallel()
+
+	responses := serve(t, New(Config{}), `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"1999-01-01"}}`)
+	var init struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	require.NoError(t, json.Unmarshal(responses[0].Result, &init))
+	require.Equal(t, ProtocolVersion, init.ProtocolVersion)
+}
+
+func TestSubmitTask(t *testing.T) {
+	t.Parallel()
+
+	s, rec := newFakeAgency(t)
+
+	result := callTool(t, s, "submit_task", `{"prompt":"fix it","tier":"fast"}`)
+	require.False(t, result.IsError, result.Content[0].Text)
+	require.Contains(t, result.Content[0].Text, `"task_id": "task-1"`)
+	_, header, body := rec.last()
+	require.JSONEq(t, `{"prompt":"fix it","tier":"fast"}`, string(body))
+	require.Equal(t, "Bearer secret", header.Get("Authorization"))
+
+	// Agent errors come back as tool errors
+	result = callTool(t, s, "submit_task", `{"prompt":"busy"}`)
+	require.True(t, result.IsError)
+	require.Contains(t, result.Content[0].Text, "409 (agent_busy)")
+
+	// So do bad arguments
+	result = callTool(t, s, "submit_task", `{"prompt":" "}`)
+	require.True(t, result.IsError)
+	require.Contains(t, result.Content[0].Text, "prompt is required")
+	result = callTool(t, s, "submit_task", `{"prompt":"x","promt":"y"}`)
+	require.True(t, result.IsError)
+	require.Contains(t, result.Content[0].Text, "promt")
+	result = callTool(t, s, "submit_task", `{"prompt":"x","wait_seconds":601}`)
+	require.True(t, result.IsError)
+}
+
+func TestSubmitTaskWait(t *testing.T) {
+	// Cannot use t.Parallel(): modifies pollInterval
+	pollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { pollInterval = time.Second })
+
+	s, _ := newFakeAgency(t)
+	result := callTool(t, s, "submit_task", `{"prompt":"fix it","wait_seconds":5}`)
+	require.False(t, result.IsError, result.Content[0].Text)
+	require.Contains(t, result.Content[0].Text, `"state": "completed"`)
+	require.Contains(t, result.Content[0].Text, `"output": "done"`)
+}
+
+func TestQueueTask(t *testing.T) {
+	t.Parallel()
+
+	s, rec := newFakeAgency(t)
+	result := callTool(t, s, "queue_task", `{"prompt":"later","agent_kind":"codex","session_id":"sess-9"}`)
+	require.False(t, result.IsError, result.Content[0].Text)
+	require.Contains(t, result.Content[0].Text, `"queue_id": "queue-1"`)
+	u, _, body := rec.last()
+	require.Equal(t, "/api/queue/task", u.Path)
+	require.JSONEq(t, `{"prompt":"later","session_id":"sess-9","agent_kind":"codex","source":"mcp"}`, string(body))
+}
+
+func TestGetStatus(t *testing.T) {
+	t.Parallel()
+
+	s, rec := newFakeAgency(t)
+
+	result := callTool(t, s, "get_status", `{"queue_id":"queue-7"}`)
+	require.False(t, result.IsError, result.Content[0].Text)
+	u, _, _ := rec.last()
+	require.Equal(t, "/api/queue/queue-7", u.Path)
+
+	result = callTool(t, s, "get_status", `{"task_id":"task-1"}`)
+	require.False(t, result.IsError, result.Content[0].Text)
+	require.Contains(t, result.Content[0].Text, `"task_id": "task-1"`)
+
+	result = callTool(t, s, "get_status", `{"task_id":"task-missing"}`)
+	require.True(t, result.IsError)
+	require.Contains(t, result.Content[0].Text, "404")
+
+	result = callTool(t, s, "get_status", `{"task_id":"a","queue_id":"b"}`)
+	require.True(t, result.IsError)
+
+	// Without IDs it reports the agent and queue, noting what's unreachable
+	result = callTool(t, s, "get_status", `{}`)
+	require.False(t, result.IsError, result.Content[0].Text)
+	var overview map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].Text), &overview))
+	require.Contains(t, string(overview["agent"]), `"idle"`)
+	require.Contains(t, string(overview["queue"]), "error")
+}
+
+func TestSearchHistory(t *testing.T) {
+	t.Parallel()
+
+	s, rec := newFakeAgency(t)
+	result := callTool(t, s, "search_history", `{"query":"login bug","limit":500}`)
+	require.False(t, result.IsError, result.Content[0].Text)
+	require.Contains(t, result.Content[0].Text, "task-0")
+	u, _, _ := rec.last()
+	require.Equal(t, "/history", u.Path)
+	require.Equal(t, "login bug", u.Query().Get("q"))
+	require.Equal(t, "100", u.Query().Get("limit"))
+	require.Equal(t, "1", u.Query().Get("page"))
+}
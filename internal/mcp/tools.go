@@ -0,0 +1,345 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxResponseSize bounds how much of an agency response is read.
+const maxResponseSize = 10 * 1024 * 1024
+
+// maxWaitSeconds caps how long submit_task blocks for a result.
+const maxWaitSeconds = 600
+
+// pollInterval is how often submit_task polls a task it is waiting for.
+// Tests shorten it.
+var pollInterval = time.Second
+
+// tool is an MCP tool definition plus its implementation.
+type tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+	run         func(ctx context.Context, args json.RawMessage) (string, error)
+}
+
+func (s *Server) toolset() []tool {
+	taskProps := map[string]any{
+		"prompt":          map[string]any{"type": "string", "description": "Instructions for the agent"},
+		"tier":            map[string]any{"type": "string", "enum": []string{"fast", "standard", "heavy"}, "description": "Model tier (default standard)"},
+		"session_id":      map[string]any{"type": "string", "description": "Session to continue, from an earlier task"},
+		"timeout_seconds": map[string]any{"type": "integer", "minimum": 1, "description": "Task timeout"},
+	}
+
+	submitProps := map[string]any{
+		"wait_seconds": map[string]any{"type": "integer", "minimum": 0, "maximum": maxWaitSeconds, "description": "Wait up to this long for the task to finish and return its output (default 0: return immediately)"},
+	}
+	queueProps := map[string]any{
+		"agent_kind": map[string]any{"type": "string", "enum": []string{"claude", "codex"}, "description": "Kind of agent to run on (default claude)"},
+	}
+	for k, v := range taskProps {
+		submitProps[k] = v
+		queueProps[k] = v
+	}
+
+	return []tool{
+		{
+			Name:        "submit_task",
+			Description: "Run a task directly on the configured agent. Fails if the agent is busy; use queue_task to wait for a free agent instead.",
+			InputSchema: objectSchema(submitProps, "prompt"),
+			run:         s.submitTask,
+		},
+		{
+			Name:        "queue_task",
+			Description: "Add a task to the director's queue. It runs on the next idle agent of the requested kind. Returns a queue_id for get_status.",
+			InputSchema: objectSchema(queueProps, "prompt"),
+			run:         s.queueTask,
+		},
+		{
+			Name:        "get_status",
+			Description: "Get the state and output of a task by task_id, or of a queued task by queue_id. With neither, returns the agent status and the queue.",
+			InputSchema: objectSchema(map[string]any{
+				"task_id":  map[string]any{"type": "string", "description": "Task ID from submit_task or a finished queued task"},
+				"queue_id": map[string]any{"type": "string", "description": "Queue ID from queue_task"},
+			}),
+			run: s.getStatus,
+		},
+		{
+			Name:        "search_history",
+			Description: "Search completed tasks on the agent, newest first. Matches prompts, output, task IDs and session IDs.",
+			InputSchema: objectSchema(map[string]any{
+				"query": map[string]any{"type": "string", "description": "Case-insensitive text to look for (empty lists everything)"},
+				"limit": map[string]any{"type": "integer", "minimum": 1, "maximum": 100, "description": "Results per page (default 10)"},
+				"page":  map[string]any{"type": "integer", "minimum": 1, "description": "Page number (default 1)"},
+			}),
+			run: s.searchHistory,
+		},
+	}
+}
+
+func objectSchema(props map[string]any, required ...string) map[string]any {
+	schema := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+type taskArgs struct {
+	Prompt         string `json:"prompt"`
+	Tier           string `json:"tier,omitempty"`
+	SessionID      string `json:"session_id,omitempty"`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"`
+}
+
+func (a taskArgs) validate() error {
+	if strings.TrimSpace(a.Prompt) == "" {
+		return errors.New("prompt is required")
+	}
+	if a.TimeoutSeconds < 0 {
+		return errors.New("timeout_seconds must be positive")
+	}
+	return nil
+}
+
+func (s *Server) submitTask(ctx context.Context, raw json.RawMessage) (string, error) {
+	var args struct {
+		taskArgs
+		WaitSeconds int `json:"wait_seconds"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return "", err
+	}
+	if err := args.validate(); err != nil {
+		return "", err
+	}
+	if args.WaitSeconds < 0 || args.WaitSeconds > maxWaitSeconds {
+		return "", fmt.Errorf("wait_seconds must be between 0 and %d", maxWaitSeconds)
+	}
+
+	body, err := s.call(ctx, http.MethodPost, s.config.AgentURL+"/task", args.taskArgs)
+	if err != nil {
+		return "", err
+	}
+	if args.WaitSeconds == 0 {
+		return formatJSON(body), nil
+	}
+
+	var created struct {
+		TaskID string `json:"task_id"`
+	}
+	if err := json.Unmarshal(body, &created); err != nil || created.TaskID == "" {
+		return "", fmt.Errorf("unexpected agent response: %s", body)
+	}
+	return s.waitForTask(ctx, created.TaskID, time.Duration(args.WaitSeconds)*time.Second)
+}
+
+// waitForTask polls a task until it finishes or wait elapses, returning its
+// last known status either way.
+func (s *Server) waitForTask(ctx context.Context, taskID string, wait time.Duration) (string, error) {
+	deadline := time.Now().Add(wait)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		body, err := s.call(ctx, http.MethodGet, s.config.AgentURL+"/task/"+url.PathEscape(taskID), nil)
+		if err != nil {
+			return "", err
+		}
+		var status struct {
+			State string `json:"state"`
+		}
+		if err := json.Unmarshal(body, &status); err != nil {
+			return "", fmt.Errorf("unexpected agent response: %s", body)
+		}
+		switch status.State {
+		case "completed", "failed", "cancelled":
+			return formatJSON(body), nil
+		}
+		if time.Now().After(deadline) {
+			return formatJSON(body) + "\n\nThe task is still running; call get_status with this task_id to check on it.", nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) queueTask(ctx context.Context, raw json.RawMessage) (string, error) {
+	var args struct {
+		taskArgs
+		AgentKind string `json:"agent_kind,omitempty"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return "", err
+	}
+	if err := args.validate(); err != nil {
+		return "", err
+	}
+
+	payload := struct {
+		taskArgs
+		AgentKind string `json:"agent_kind,omitempty"`
+		Source    string `json:"source"`
+	}{args.taskArgs, args.AgentKind, "mcp"}
+	body, err := s.call(ctx, http.MethodPost, s.config.DirectorURL+"/api/queue/task", payload)
+	if err != nil {
+		return "", err
+	}
+	return formatJSON(body), nil
+}
+
+func (s *Server) getStatus(ctx context.Context, raw json.RawMessage) (string, error) {
+	var args struct {
+		TaskID  string `json:"task_id"`
+		QueueID string `json:"queue_id"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return "", err
+	}
+
+	switch {
+	case args.TaskID != "" && args.QueueID != "":
+		return "", errors.New("pass task_id or queue_id, not both")
+	case args.TaskID != "":
+		body, err := s.call(ctx, http.MethodGet, s.config.AgentURL+"/task/"+url.PathEscape(args.TaskID), nil)
+		if err != nil {
+			return "", err
+		}
+		return formatJSON(body), nil
+	case args.QueueID != "":
+		body, err := s.call(ctx, http.MethodGet, s.config.DirectorURL+"/api/queue/"+url.PathEscape(args.QueueID), nil)
+		if err != nil {
+			return "", err
+		}
+		return formatJSON(body), nil
+	}
+
+	// Overview: report whichever of the two is reachable
+	overview := map[string]any{}
+	for key, u := range map[string]string{
+		"agent": s.config.AgentURL + "/status",
+		"queue": s.config.DirectorURL + "/api/queue",
+	} {
+		body, err := s.call(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			overview[key] = map[string]string{"error": err.Error()}
+			continue
+		}
+		overview[key] = json.RawMessage(body)
+	}
+	data, _ := json.MarshalIndent(overview, "", "  ")
+	return string(data), nil
+}
+
+func (s *Server) searchHistory(ctx context.Context, raw json.RawMessage) (string, error) {
+	var args struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+		Page  int    `json:"page"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return "", err
+	}
+	if args.Limit < 1 {
+		args.Limit = 10
+	}
+	if args.Limit > 100 {
+		args.Limit = 100
+	}
+	if args.Page < 1 {
+		args.Page = 1
+	}
+
+	q := url.Values{}
+	q.Set("q", args.Query)
+	q.Set("limit", strconv.Itoa(args.Limit))
+	q.Set("page", strconv.Itoa(args.Page))
+	body, err := s.call(ctx, http.MethodGet, s.config.AgentURL+"/history?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	return formatJSON(body), nil
+}
+
+// decodeArgs strictly decodes tool arguments, so typos in argument names are
+// reported rather than ignored.
+func decodeArgs(raw json.RawMessage, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+// call sends a request to the agent or director and returns the response
+// body, treating non-2xx responses as errors.
+func (s *Server) call(ctx context.Context, method, u string, payload any) ([]byte, error) {
+	var reqBody io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("contacting %s: %w", hostOf(u), err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Message != "" {
+			return nil, fmt.Errorf("%s returned %d (%s): %s", hostOf(u), resp.StatusCode, apiErr.Error, apiErr.Message)
+		}
+		return nil, fmt.Errorf("%s returned %d: %s", hostOf(u), resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+func hostOf(u string) string {
+	if parsed, err := url.Parse(u); err == nil && parsed.Host != "" {
+		return parsed.Host
+	}
+	return u
+}
+
+// formatJSON indents a JSON body for readability, returning it unchanged if
+// it isn't JSON.
+func formatJSON(body []byte) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, body, "", "  "); err != nil {
+		return string(body)
+	}
+	return buf.String()
+}
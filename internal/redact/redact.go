@@ -0,0 +1,94 @@
+// Package redact scrubs secret values and well-known token formats from text
+// before it is stored or returned.
+package redact
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Placeholder replaces each redacted value.
+const Placeholder = "[REDACTED]"
+
+// minSecretLen is the shortest secret value redacted; shorter values would
+// match ordinary text.
+const minSecretLen = 8
+
+// tokenPatterns match credentials whose format is distinctive enough to
+// redact without being configured.
+var tokenPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),                // AWS access key IDs
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,255}\b`),            // GitHub tokens
+	regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,255}\b`),          // GitHub fine-grained tokens
+	regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_-]{20,}`),                  // Anthropic API keys
+	regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),               // Slack tokens
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[^-]*-----`), // PEM private key headers and bodies
+}
+
+// Redactor replaces configured secret values and token patterns with
+// Placeholder. A nil Redactor redacts only token patterns.
+type Redactor struct {
+	secrets []string // Longest first, so a secret containing another is replaced whole
+}
+
+// New returns a Redactor for the given secret values. Values shorter than
+// 8 bytes are ignored.
+func New(secrets []string) *Redactor {
+	r := &Redactor{}
+	for _, s := range secrets {
+		if len(s) >= minSecretLen {
+			r.secrets = append(r.secrets, s)
+		}
+	}
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+	return r
+}
+
+// String returns s with secrets replaced, and how many were replaced.
+func (r *Redactor) String(s string) (string, int) {
+	count := 0
+	if r != nil {
+		for _, secret := range r.secrets {
+			if n := strings.Count(s, secret); n > 0 {
+				s = strings.ReplaceAll(s, secret, Placeholder)
+				count += n
+			}
+		}
+	}
+	for _, re := range tokenPatterns {
+		if !re.MatchString(s) {
+			continue
+		}
+		s = re.ReplaceAllStringFunc(s, func(string) string {
+			count++
+			return Placeholder
+		})
+	}
+	return s, count
+}
+
+// Bytes is String for byte slices. b is returned unchanged when nothing
+// was redacted.
+func (r *Redactor) Bytes(b []byte) ([]byte, int) {
+	count := 0
+	if r != nil {
+		for _, secret := range r.secrets {
+			if n := bytes.Count(b, []byte(secret)); n > 0 {
+				b = bytes.ReplaceAll(b, []byte(secret), []byte(Placeholder))
+				count += n
+			}
+		}
+	}
+	for _, re := range tokenPatterns {
+		if !re.Match(b) {
+			continue
+		}
+		b = re.ReplaceAllFunc(b, func([]byte) []byte {
+			count++
+			return []byte(Placeholder)
+		})
+	}
+	return b, count
+}
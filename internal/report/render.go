@@ -0,0 +1,94 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+)
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"percent":  func(f float64) string { return fmt.Sprintf("%.1f%%", f*100) },
+	"duration": formatDuration,
+	"date":     func(t time.Time) string { return t.Format("2006-01-02 15:04 MST") },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Agency Report</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; background: #0d1117; color: #e6edf3; margin: 0; padding: 32px; }
+main { max-width: 960px; margin: 0 auto; }
+h1 { font-size: 1.5rem; margin: 0 0 4px; }
+h2 { font-size: 1rem; margin: 32px 0 12px; color: #8b949e; text-transform: uppercase; letter-spacing: 0.05em; }
+.meta { color: #8b949e; font-size: 0.875rem; }
+.cards { display: grid; grid-template-columns: repeat(auto-fit, minmax(160px, 1fr)); gap: 12px; }
+.card { background: #161b22; border: 1px solid #30363d; border-radius: 6px; padding: 16px; }
+.card-label { color: #8b949e; font-size: 0.75rem; }
+.card-value { font-size: 1.5rem; font-weight: 600; margin-top: 4px; }
+table { width: 100%; border-collapse: collapse; font-size: 0.875rem; }
+th, td { text-align: left; padding: 8px; border-bottom: 1px solid #30363d; }
+th { color: #8b949e; font-weight: 500; }
+td.num, th.num { text-align: right; font-variant-numeric: tabular-nums; }
+.failed { color: #f85149; }
+.warnings { color: #d29922; font-size: 0.8125rem; }
+</style>
+</head>
+<body>
+<main>
+<h1>Agency Report</h1>
+<div class="meta">{{.Director}} &middot; {{date .Since}} to {{date .GeneratedAt}}</div>
+
+<h2>Summary</h2>
+<div class="cards">
+  <div class="card"><div class="card-label">Tasks run</div><div class="card-value">{{.TasksRun}}</div></div>
+  <div class="card"><div class="card-label">Success rate</div><div class="card-value">{{percent .SuccessRate}}</div></div>
+  <div class="card"><div class="card-label">Failed</div><div class="card-value{{if .Failed}} failed{{end}}">{{.Failed}}</div></div>
+  <div class="card"><div class="card-label">Agent time</div><div class="card-value">{{duration .DurationSeconds}}</div></div>
+  <div class="card"><div class="card-label">Input tokens</div><div class="card-value">{{.InputTokens}}</div></div>
+  <div class="card"><div class="card-label">Output tokens</div><div class="card-value">{{.OutputTokens}}</div></div>
+</div>
+
+<h2>Busiest jobs</h2>
+{{if .Jobs}}
+<table>
+  <tr><th>Job</th><th class="num">Tasks</th><th class="num">Failed</th><th class="num">Agent time</th><th class="num">Input tokens</th><th class="num">Output tokens</th></tr>
+  {{range .Jobs}}
+  <tr><td>{{.Name}}</td><td class="num">{{.Tasks}}</td><td class="num{{if .Failed}} failed{{end}}">{{.Failed}}</td><td class="num">{{duration .DurationSeconds}}</td><td class="num">{{.InputTokens}}</td><td class="num">{{.OutputTokens}}</td></tr>
+  {{end}}
+</table>
+{{else}}
+<p class="meta">No tasks completed in this window.</p>
+{{end}}
+
+<h2>Queue</h2>
+<table>
+  <tr><th>Pending</th><th>Capacity</th><th>Dispatched</th><th>Oldest pending</th></tr>
+  <tr><td>{{.Queue.Depth}}</td><td>{{.Queue.MaxSize}}</td><td>{{.Queue.DispatchedCount}}</td><td>{{duration .Queue.OldestAgeSeconds}}</td></tr>
+</table>
+
+{{if .Errors}}
+<h2>Collection warnings</h2>
+<ul class="warnings">{{range .Errors}}<li>{{.}}</li>{{end}}</ul>
+{{end}}
+</main>
+</body>
+</html>
+`))
+
+// Render writes the report as a standalone HTML page.
+func Render(w io.Writer, r *Report) error {
+	return reportTemplate.Execute(w, r)
+}
+
+func formatDuration(seconds float64) string {
+	d := time.Duration(seconds * float64(time.Second)).Round(time.Second)
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm %ds", int(d.Minutes()), int(d.Seconds())%60)
+	default:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+}
@@ -0,0 +1,207 @@
+// Package report builds shareable activity reports from a running director.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Report summarizes director activity over a time window.
+type Report struct {
+	Director    string    `json:"director"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Since       time.Time `json:"since"`
+
+	TasksRun        int     `json:"tasks_run"`
+	Succeeded       int     `json:"succeeded"`
+	Failed          int     `json:"failed"`
+	Cancelled       int     `json:"cancelled"`
+	SuccessRate     float64 `json:"success_rate"` // Fraction of finished tasks that completed (0-1)
+	DurationSeconds float64 `json:"duration_seconds"`
+	InputTokens     int     `json:"input_tokens"`
+	OutputTokens    int     `json:"output_tokens"`
+
+	Jobs   []JobStats `json:"jobs"` // Busiest first
+	Queue  QueueStats `json:"queue"`
+	Errors []string   `json:"errors,omitempty"` // Non-fatal collection problems
+}
+
+// JobStats aggregates tasks by their originating job or source.
+type JobStats struct {
+	Name            string  `json:"name"`
+	Tasks           int     `json:"tasks"`
+	Failed          int     `json:"failed"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	InputTokens     int     `json:"input_tokens"`
+	OutputTokens    int     `json:"output_tokens"`
+}
+
+// QueueStats is a point-in-time snapshot of the director's work queue.
+type QueueStats struct {
+	Depth            int     `json:"depth"`
+	MaxSize          int     `json:"max_size"`
+	DispatchedCount  int     `json:"dispatched_count"`
+	OldestAgeSeconds float64 `json:"oldest_age_seconds"`
+}
+
+type session struct {
+	AgentURL  string    `json:"agent_url"`
+	Source    string    `json:"source"`
+	SourceJob string    `json:"source_job"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Tasks     []struct {
+		TaskID string `json:"task_id"`
+		State  string `json:"state"`
+	} `json:"tasks"`
+}
+
+type historyEntry struct {
+	State           string    `json:"state"`
+	CompletedAt     time.Time `json:"completed_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	TokenUsage      *struct {
+		Input  int `json:"input"`
+		Output int `json:"output"`
+	} `json:"token_usage"`
+}
+
+// Collect gathers sessions, task history and queue state from the director's
+// internal API and summarizes tasks that completed at or after since.
+func Collect(client *http.Client, directorURL string, since time.Time) (*Report, error) {
+	directorURL = strings.TrimRight(directorURL, "/")
+	r := &Report{
+		Director:    directorURL,
+		GeneratedAt: time.Now().UTC(),
+		Since:       since.UTC(),
+	}
+
+	var sessions []session
+	if err := getJSON(client, directorURL+"/api/sessions", &sessions); err != nil {
+		return nil, fmt.Errorf("fetching sessions: %w", err)
+	}
+
+	jobs := make(map[string]*JobStats)
+	for _, s := range sessions {
+		if s.UpdatedAt.Before(since) {
+			continue
+		}
+		name := jobName(s)
+		for _, t := range s.Tasks {
+			if !isFinished(t.State) {
+				continue
+			}
+
+			var entry historyEntry
+			query := url.Values{"agent_url": {s.AgentURL}}
+			path := directorURL + "/api/history/" + url.PathEscape(t.TaskID) + "?" + query.Encode()
+			if err := getJSON(client, path, &entry); err != nil {
+				r.Errors = append(r.Errors, fmt.Sprintf("history for %s: %v", t.TaskID, err))
+				continue
+			}
+			if entry.CompletedAt.Before(since) {
+				continue
+			}
+
+			job, ok := jobs[name]
+			if !ok {
+				job = &JobStats{Name: name}
+				jobs[name] = job
+			}
+			r.add(job, entry)
+		}
+	}
+
+	for _, job := range jobs {
+		r.Jobs = append(r.Jobs, *job)
+	}
+	sort.Slice(r.Jobs, func(i, j int) bool {
+		if r.Jobs[i].Tasks != r.Jobs[j].Tasks {
+			return r.Jobs[i].Tasks > r.Jobs[j].Tasks
+		}
+		return r.Jobs[i].Name < r.Jobs[j].Name
+	})
+
+	if finished := r.Succeeded + r.Failed; finished > 0 {
+		r.SuccessRate = float64(r.Succeeded) / float64(finished)
+	}
+
+	if err := getJSON(client, directorURL+"/api/queue", &r.Queue); err != nil {
+		r.Errors = append(r.Errors, fmt.Sprintf("queue: %v", err))
+	}
+
+	return r, nil
+}
+
+func (r *Report) add(job *JobStats, entry historyEntry) {
+	r.TasksRun++
+	job.Tasks++
+	switch entry.State {
+	case "completed":
+		r.Succeeded++
+	case "failed":
+		r.Failed++
+		job.Failed++
+	case "cancelled":
+		r.Cancelled++
+	}
+
+	r.DurationSeconds += entry.DurationSeconds
+	job.DurationSeconds += entry.DurationSeconds
+	if entry.TokenUsage != nil {
+		r.InputTokens += entry.TokenUsage.Input
+		r.OutputTokens += entry.TokenUsage.Output
+		job.InputTokens += entry.TokenUsage.Input
+		job.OutputTokens += entry.TokenUsage.Output
+	}
+}
+
+// jobName labels a session by scheduler job, falling back to its source.
+func jobName(s session) string {
+	if s.SourceJob != "" {
+		return s.SourceJob
+	}
+	if s.Source != "" {
+		return s.Source
+	}
+	return "web"
+}
+
+func isFinished(state string) bool {
+	return state == "completed" || state == "failed" || state == "cancelled"
+}
+
+func getJSON(client *http.Client, url string, v any) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// ParseWindow parses a lookback window such as "7d", "12h" or "30m".
+// In addition to time.ParseDuration units it accepts a "d" suffix for days.
+func ParseWindow(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid window %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid window %q", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,94 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectAndRender(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().UTC()
+	old := now.Add(-30 * 24 * time.Hour)
+
+	entries := map[string]map[string]any{
+		"t1": {"state": "completed", "completed_at": now, "duration_seconds": 60.0, "token_usage": map[string]int{"input": 100, "output": 10}},
+		"t2": {"state": "failed", "completed_at": now, "duration_seconds": 30.0},
+		"t3": {"state": "completed", "completed_at": now, "duration_seconds": 10.0, "token_usage": map[string]int{"input": 5, "output": 5}},
+		"t4": {"state": "completed", "completed_at": old, "duration_seconds": 99.0},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/sessions", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]map[string]any{
+			{"agent_url": "https://a:9000", "source": "scheduler", "source_job": "nightly", "updated_at": now,
+				"tasks": []map[string]string{{"task_id": "t1", "state": "completed"}, {"task_id": "t2", "state": "failed"}}},
+			{"agent_url": "https://a:9000", "source": "web", "updated_at": now,
+				"tasks": []map[string]string{{"task_id": "t3", "state": "completed"}, {"task_id": "t5", "state": "working"}}},
+			{"agent_url": "https://a:9000", "source": "cli", "updated_at": old,
+				"tasks": []map[string]string{{"task_id": "t4", "state": "completed"}}},
+		})
+	})
+	mux.HandleFunc("/api/history/{id}", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "https://a:9000", r.URL.Query().Get("agent_url"))
+		entry, ok := entries[r.PathValue("id")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(entry)
+	})
+	mux.HandleFunc("/api/queue", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"depth": 2, "max_size": 50, "dispatched_count": 1})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	r, err := Collect(srv.Client(), srv.URL, now.Add(-7*24*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 3, r.TasksRun)
+	require.Equal(t, 2, r.Succeeded)
+	require.Equal(t, 1, r.Failed)
+	require.InDelta(t, 2.0/3.0, r.SuccessRate, 0.001)
+	require.Equal(t, 105, r.InputTokens)
+	require.Equal(t, 100.0, r.DurationSeconds)
+	require.Equal(t, 2, r.Queue.Depth)
+	require.Empty(t, r.Errors)
+
+	require.Len(t, r.Jobs, 2)
+	require.Equal(t, "nightly", r.Jobs[0].Name)
+	require.Equal(t, 2, r.Jobs[0].Tasks)
+	require.Equal(t, 1, r.Jobs[0].Failed)
+	require.Equal(t, "web", r.Jobs[1].Name)
+
+	var buf bytes.Buffer
+	require.NoError(t, Render(&buf, r))
+	html := buf.String()
+	require.Contains(t, html, "<!DOCTYPE html>")
+	require.Contains(t, html, "66.7%")
+	require.Contains(t, html, "<td>nightly</td>")
+	require.Contains(t, html, "1m 40s")
+}
+
+func TestParseWindow(t *testing.T) {
+	t.Parallel()
+
+	d, err := ParseWindow("7d")
+	require.NoError(t, err)
+	require.Equal(t, 7*24*time.Hour, d)
+
+	d, err = ParseWindow("12h")
+	require.NoError(t, err)
+	require.Equal(t, 12*time.Hour, d)
+
+	for _, bad := range []string{"", "d", "-1d", "abc", "0h"} {
+		_, err := ParseWindow(bad)
+		require.Error(t, err, bad)
+	}
+}
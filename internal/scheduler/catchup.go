@@ -0,0 +1,111 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+)
+
+// Missed-run catch-up policies, applied at startup to runs that fell due
+// while the scheduler was down
+const (
+	CatchUpSkip    = "skip"     // Drop missed runs
+	CatchUpRunOnce = "run_once" // Run once if any runs were missed
+	CatchUpRunAll  = "run_all"  // Run once per missed run, up to MaxCatchUpRuns
+)
+
+// MaxCatchUpRuns caps run_all so a long outage of a frequent job doesn't
+// flood the agents.
+const MaxCatchUpRuns = 24
+
+// catchUp is a job with runs owed at startup.
+type catchUp struct {
+	js   *jobState
+	runs int // Runs to make under the job's policy
+}
+
+// missedRuns counts the schedule times after last and no later than now,
+// stopping at MaxCatchUpRuns.
+func missedRuns(cron *CronExpr, last, now time.Time) int {
+	missed := 0
+	for t := cron.Next(last); !t.IsZero() && !t.After(now) && missed < MaxCatchUpRuns; t = cron.Next(t) {
+		missed++
+	}
+	return missed
+}
+
+// restoreRuns loads each job's last run and consecutive failures from the
+// run history and works out the catch-up runs owed since then. Jobs with no
+// history have missed nothing, and suspended jobs owe no runs. Caller holds
+// s.mu.
+func (s *Scheduler) restoreRuns(now time.Time) []catchUp {
+	var catchUps []catchUp
+	for _, js := range s.jobs {
+		recent := s.runs.recent(js.Job.Name, MaxRunsPerJob)
+		if len(recent) == 0 {
+			continue
+		}
+		js.failures = failureStreak(recent)
+		for _, run := range recent {
+			if run.State == runStateResumed {
+				continue // Not a run; runs missed before the resume are still skipped
+			}
+			js.LastRun = run.StartedAt
+			js.LastStatus = run.State
+			js.LastError = run.Error
+			js.LastTaskID = run.TaskID
+			js.LastQueueID = run.QueueID
+			js.LastAgentURL = run.AgentURL
+			break
+		}
+		if js.suspended() {
+			log.Printf("job=%s action=suspended failures=%d", js.Job.Name, js.failures)
+			continue
+		}
+
+		last := recent[0]
+		missed := missedRuns(js.Cron, last.StartedAt, now)
+		if missed == 0 {
+			continue
+		}
+		policy := s.config.GetCatchUp(js.Job)
+		runs := 0
+		switch policy {
+		case CatchUpRunOnce:
+			runs = 1
+		case CatchUpRunAll:
+			runs = missed
+		}
+		log.Printf("job=%s action=missed_runs count=%d last_run=%s catch_up=%s runs=%d",
+			js.Job.Name, missed, last.StartedAt.Format(time.RFC3339), policy, runs)
+		if runs > 0 {
+			catchUps = append(catchUps, catchUp{js: js, runs: runs})
+		}
+	}
+	return catchUps
+}
+
+// runCatchUps makes the owed runs, one job at a time. A job that is
+// already running (e.g. triggered manually) or becomes suspended skips its
+// remaining catch-up runs.
+func (s *Scheduler) runCatchUps(catchUps []catchUp) {
+	for _, c := range catchUps {
+		for i := range c.runs {
+			c.js.mu.Lock()
+			if c.js.isRunning {
+				c.js.mu.Unlock()
+				log.Printf("job=%s action=catch_up_skipped reason=running remaining=%d", c.js.Job.Name, c.runs-i)
+				break
+			}
+			if c.js.suspended() {
+				c.js.mu.Unlock()
+				log.Printf("job=%s action=catch_up_skipped reason=suspended remaining=%d", c.js.Job.Name, c.runs-i)
+				break
+			}
+			c.js.isRunning = true
+			c.js.mu.Unlock()
+
+			log.Printf("job=%s action=catch_up run=%d/%d", c.js.Job.Name, i+1, c.runs)
+			s.runJob(c.js)
+		}
+	}
+}
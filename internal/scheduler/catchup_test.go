@@ -0,0 +1,132 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMissedRuns(t *testing.T) {
+	t.Parallel()
+
+	hourly, err := ParseCron("0 * * * *")
+	require.NoError(t, err)
+	everyMinute, err := ParseCron("* * * * *")
+	require.NoError(t, err)
+
+	base := time.Date(2025, 1, 13, 10, 30, 0, 0, time.Local)
+
+	tests := []struct {
+		name string
+		cron *CronExpr
+		last time.Time
+		now  time.Time
+		want int
+	}{
+		{"none due", hourly, base, base.Add(20 * time.Minute), 0},
+		{"three due", hourly, base, base.Add(2*time.Hour + 45*time.Minute), 3},
+		{"due exactly now", hourly, base, base.Add(30 * time.Minute), 1},
+		{"capped", everyMinute, base, base.Add(48 * time.Hour), MaxCatchUpRuns},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, missedRuns(tt.cron, tt.last, tt.now))
+		})
+	}
+}
+
+func TestRestoreRunsPolicies(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{
+		Port:    DefaultPort,
+		Bind:    DefaultBind,
+		RunsDir: t.TempDir(),
+		Jobs: []Job{
+			{Name: "skip", Schedule: "0 * * * *", Prompt: "x"},
+			{Name: "once", Schedule: "0 * * * *", Prompt: "x", CatchUp: CatchUpRunOnce},
+			{Name: "all", Schedule: "0 * * * *", Prompt: "x", CatchUp: CatchUpRunAll},
+			{Name: "fresh", Schedule: "0 * * * *", Prompt: "x", CatchUp: CatchUpRunAll},
+		},
+	}
+	require.NoError(t, cfg.Validate())
+
+	now := time.Date(2025, 1, 13, 13, 15, 0, 0, time.Local)
+	lastRun := time.Date(2025, 1, 13, 10, 0, 5, 0, time.Local)
+
+	// Persist history from a previous process
+	previous := newRunStore(cfg.RunsDir)
+	for _, name := range []string{"skip", "once", "all"} {
+		previous.record(name, JobRun{StartedAt: lastRun, State: "submitted", TaskID: "task-" + name})
+	}
+
+	s := New(cfg, "", time.Minute, "test")
+	s.applyConfig(cfg, now)
+	catchUps := s.restoreRuns(now)
+
+	runs := make(map[string]int)
+	for _, c := range catchUps {
+		runs[c.js.Job.Name] = c.runs
+	}
+	assert.Equal(t, map[string]int{"once": 1, "all": 3}, runs)
+
+	// Last run state is restored from history
+	status := s.jobs[0].status(cfg, s.runs)
+	require.NotNil(t, status.LastRun)
+	assert.True(t, lastRun.Equal(*status.LastRun))
+	assert.Equal(t, "task-skip", status.LastTaskID)
+	assert.Equal(t, CatchUpSkip, status.CatchUp)
+	assert.Nil(t, s.jobs[3].status(cfg, s.runs).LastRun)
+}
+
+func TestRunCatchUps(t *testing.T) {
+	t.Parallel()
+
+	var submitted atomic.Int32
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		submitted.Add(1)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"task_id": "task-1"})
+	}))
+	defer agent.Close()
+
+	cfg := &Config{
+		Port:     0,
+		AgentURL: agent.URL,
+		Jobs:     []Job{{Name: "all", Schedule: "0 * * * *", Prompt: "x", CatchUp: CatchUpRunAll}},
+	}
+	s := New(cfg, "", time.Minute, "test")
+	s.applyConfig(cfg, time.Now())
+	js := s.jobs[0]
+
+	s.runCatchUps([]catchUp{{js: js, runs: 2}})
+	assert.Equal(t, int32(2), submitted.Load())
+	assert.Len(t, s.runs.recent("all", 10), 2)
+
+	// A running job skips its catch-up runs
+	js.isRunning = true
+	s.runCatchUps([]catchUp{{js: js, runs: 2}})
+	assert.Equal(t, int32(2), submitted.Load())
+}
+
+func TestConfigCatchUpValidation(t *testing.T) {
+	t.Parallel()
+
+	_, err := Parse([]byte(`
+jobs:
+  - name: job
+    schedule: "0 * * * *"
+    prompt: "x"
+    catch_up: sometimes
+`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "catch_up")
+}
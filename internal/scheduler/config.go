@@ -3,10 +3,14 @@ package scheduler
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"time"
 
 	"gopkg.in/yaml.v3"
 	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/config"
 )
 
 // Config represents the scheduler configuration
@@ -17,6 +21,8 @@ type Config struct {
 	DirectorURL string `yaml:"director_url"` // Primary target for session tracking (optional)
 	AgentURL    string `yaml:"agent_url"`    // Fallback if director unavailable
 	AgentKind   string `yaml:"agent_kind"`   // Default agent kind for jobs
+	RunsDir     string `yaml:"runs_dir"`     // Job run history (Load default: runs/ beside the config file)
+	AuthToken   string `yaml:"auth_token"`   // Bearer token required on mutating endpoints and sent to agents (empty = none)
 	Jobs        []Job  `yaml:"jobs"`
 }
 
@@ -28,9 +34,27 @@ type Job struct {
 	Tier      string        `yaml:"tier,omitempty"`
 	Timeout   time.Duration `yaml:"timeout,omitempty"`
 	AgentURL  string        `yaml:"agent_url,omitempty"`
+	AgentURLs []string      `yaml:"agent_urls,omitempty"` // Several agents to submit to directly, in order (instead of agent_url)
+	FanOut    string        `yaml:"fan_out,omitempty"`    // How agent_urls are used: first_idle, round_robin, all
 	AgentKind string        `yaml:"agent_kind,omitempty"`
+	CatchUp   string        `yaml:"catch_up,omitempty"` // Missed-run policy: skip, run_once, run_all
+	Jitter    time.Duration `yaml:"jitter,omitempty"`   // Random delay of up to this long added to each start
+	Overlap   string        `yaml:"overlap,omitempty"`  // Policy while the previous run is active: allow, skip, queue, cancel_previous
+
+	SuspendAfter int `yaml:"suspend_after,omitempty"` // Consecutive failed runs before the job is suspended (0 = never)
+
+	Env map[string]string `yaml:"env,omitempty"` // Task environment; "secret:<name>" values come from the agent's secrets file
+
+	Managed bool `yaml:"-"` // Defined through the jobs API in jobs.d rather than the config file
 }
 
+// envNamePattern matches environment variable names.
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// secretRefPrefix marks a job env value naming a secret in the agent's
+// secrets file, e.g. "secret:github_token".
+const secretRefPrefix = "secret:"
+
 // Defaults
 const (
 	DefaultPort      = 9100
@@ -40,10 +64,33 @@ const (
 	DefaultTier      = api.TierStandard
 	DefaultTimeout   = 30 * time.Minute
 	DefaultAgentKind = api.AgentKindClaude
+	DefaultCatchUp   = CatchUpSkip
+	DefaultOverlap   = OverlapAllow
+	DefaultFanOut    = FanOutFirstIdle
 )
 
+// EnvPrefix starts the environment variables that override scheduler config
+// keys, e.g. AGENCY_SCHEDULER_DIRECTOR_URL for director_url. It differs from
+// the agents' AGENCY_ so that one environment can configure both.
+const EnvPrefix = "AGENCY_SCHEDULER_"
+
 // Parse parses YAML config data
 func Parse(data []byte) (*Config, error) {
+	cfg, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// parse unmarshals YAML config data with defaults and AGENCY_SCHEDULER_*
+// environment overrides applied, without validating.
+func parse(data []byte) (*Config, error) {
 	cfg := &Config{
 		Port:      DefaultPort,
 		Bind:      DefaultBind,
@@ -55,21 +102,44 @@ func Parse(data []byte) (*Config, error) {
 	if err := yaml.Unmarshal(data, cfg); err != nil {
 		return nil, fmt.Errorf("parsing config: %w", err)
 	}
-
-	if err := cfg.Validate(); err != nil {
+	if err := config.ApplyEnv(cfg, EnvPrefix); err != nil {
 		return nil, err
 	}
 
 	return cfg, nil
 }
 
-// Load loads config from a file path
+// Load loads config from a file path, adding any jobs defined through the
+// jobs API in the jobs.d directory beside it.
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("reading config file: %w", err)
 	}
-	return Parse(data)
+	cfg, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	managed, err := loadJobFiles(JobsDir(path))
+	if err != nil {
+		return nil, err
+	}
+	cfg.Jobs = append(cfg.Jobs, managed...)
+
+	// Run history lives beside the config file unless configured otherwise
+	if cfg.RunsDir == "" {
+		cfg.RunsDir = DefaultRunsDirName
+	}
+	if !filepath.IsAbs(cfg.RunsDir) {
+		cfg.RunsDir = filepath.Join(filepath.Dir(path), cfg.RunsDir)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
 }
 
 // Validate checks config validity
@@ -117,6 +187,49 @@ func (c *Config) Validate() error {
 		if job.Tier != "" && !api.IsValidTier(job.Tier) {
 			return fmt.Errorf("job[%d] %q: tier must be fast, standard, or heavy, got %q", i, job.Name, job.Tier)
 		}
+
+		switch job.CatchUp {
+		case "", CatchUpSkip, CatchUpRunOnce, CatchUpRunAll:
+		default:
+			return fmt.Errorf("job[%d] %q: catch_up must be skip, run_once, or run_all, got %q", i, job.Name, job.CatchUp)
+		}
+
+		if job.Jitter < 0 {
+			return fmt.Errorf("job[%d] %q: jitter must not be negative", i, job.Name)
+		}
+
+		switch job.Overlap {
+		case "", OverlapAllow, OverlapSkip, OverlapQueue, OverlapCancelPrevious:
+		default:
+			return fmt.Errorf("job[%d] %q: overlap must be allow, skip, queue, or cancel_previous, got %q", i, job.Name, job.Overlap)
+		}
+
+		if job.AgentURL != "" && len(job.AgentURLs) > 0 {
+			return fmt.Errorf("job[%d] %q: set agent_url or agent_urls, not both", i, job.Name)
+		}
+		for j, agentURL := range job.AgentURLs {
+			if agentURL == "" || slices.Contains(job.AgentURLs[:j], agentURL) {
+				return fmt.Errorf("job[%d] %q: agent_urls must be distinct and non-empty", i, job.Name)
+			}
+		}
+		switch job.FanOut {
+		case "", FanOutFirstIdle, FanOutRoundRobin, FanOutAll:
+		default:
+			return fmt.Errorf("job[%d] %q: fan_out must be first_idle, round_robin, or all, got %q", i, job.Name, job.FanOut)
+		}
+
+		if job.SuspendAfter < 0 {
+			return fmt.Errorf("job[%d] %q: suspend_after must not be negative", i, job.Name)
+		}
+
+		for name, value := range job.Env {
+			if !envNamePattern.MatchString(name) {
+				return fmt.Errorf("job[%d] %q: env name %q must be letters, digits and '_', not starting with a digit", i, job.Name, name)
+			}
+			if value == secretRefPrefix {
+				return fmt.Errorf("job[%d] %q: env %s names no secret", i, job.Name, name)
+			}
+		}
 	}
 
 	return nil
@@ -130,6 +243,22 @@ func (c *Config) GetAgentURL(job *Job) string {
 	return c.AgentURL
 }
 
+// GetAgentURLs returns the agents a job submits to directly, in order
+func (c *Config) GetAgentURLs(job *Job) []string {
+	if len(job.AgentURLs) > 0 {
+		return job.AgentURLs
+	}
+	return []string{c.GetAgentURL(job)}
+}
+
+// GetFanOut returns the fan-out policy for a job, using the default if not specified
+func (c *Config) GetFanOut(job *Job) string {
+	if job.FanOut != "" {
+		return job.FanOut
+	}
+	return DefaultFanOut
+}
+
 // GetAgentKind returns the agent kind for a job, using defaults if not specified.
 func (c *Config) GetAgentKind(job *Job) string {
 	if job.AgentKind != "" {
@@ -149,6 +278,22 @@ func (c *Config) GetTier(job *Job) string {
 	return DefaultTier
 }
 
+// GetCatchUp returns the missed-run policy for a job, using the default if not specified
+func (c *Config) GetCatchUp(job *Job) string {
+	if job.CatchUp != "" {
+		return job.CatchUp
+	}
+	return DefaultCatchUp
+}
+
+// GetOverlap returns the overlap policy for a job, using the default if not specified
+func (c *Config) GetOverlap(job *Job) string {
+	if job.Overlap != "" {
+		return job.Overlap
+	}
+	return DefaultOverlap
+}
+
 // GetTimeout returns the timeout for a job, using the default if not specified
 func (c *Config) GetTimeout(job *Job) time.Duration {
 	if job.Timeout > 0 {
@@ -0,0 +1,160 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"phobos.org.uk/agency/internal/api"
+)
+
+// dryRunNextRuns is how many upcoming schedule times a dry run lists.
+const dryRunNextRuns = 5
+
+// DryRun describes what a job would submit, without contacting anything.
+type DryRun struct {
+	Job         string             `json:"job"`
+	Schedule    string             `json:"schedule"`
+	NextRuns    []time.Time        `json:"next_runs"`         // Upcoming schedule times, before jitter
+	Jitter      string             `json:"jitter,omitempty"`  // Maximum random delay added to each start
+	CatchUp     string             `json:"catch_up"`          // Missed-run policy
+	Overlap     string             `json:"overlap"`           // Policy while the previous run is active
+	FanOut      string             `json:"fan_out,omitempty"` // For jobs with several agents
+	Prompt      string             `json:"prompt"`            // Exactly as sent; prompts are not templated
+	Submissions []DryRunSubmission `json:"submissions"`       // In the order they would be tried (all at once for fan_out: all)
+}
+
+// DryRunSubmission is one request the scheduler would make to run the job.
+type DryRunSubmission struct {
+	Via     string         `json:"via"` // director, agent or agent_fallback
+	URL     string         `json:"url"`
+	Request map[string]any `json:"request"`
+}
+
+// DryRun describes what job would submit at its next schedule time after
+// now. The director, if configured, is tried first; the agents are the
+// fallback when it can't be reached. A round_robin job is shown starting
+// from its first agent.
+func (c *Config) DryRun(job *Job, now time.Time) (*DryRun, error) {
+	cron, err := ParseCron(job.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	dr := &DryRun{
+		Job:      job.Name,
+		Schedule: job.Schedule,
+		CatchUp:  c.GetCatchUp(job),
+		Overlap:  c.GetOverlap(job),
+		Prompt:   job.Prompt,
+	}
+	if job.Jitter > 0 {
+		dr.Jitter = job.Jitter.String()
+	}
+	if len(job.AgentURLs) > 0 {
+		dr.FanOut = c.GetFanOut(job)
+	}
+	for t := now; len(dr.NextRuns) < dryRunNextRuns; {
+		if t = cron.Next(t); t.IsZero() {
+			break
+		}
+		dr.NextRuns = append(dr.NextRuns, t)
+	}
+
+	var slot time.Time
+	if len(dr.NextRuns) > 0 {
+		slot = dr.NextRuns[0]
+	}
+	agentVia := "agent"
+	if c.DirectorURL != "" && c.GetFanOut(job) != FanOutAll {
+		dr.Submissions = append(dr.Submissions, DryRunSubmission{
+			Via:     "director",
+			URL:     c.DirectorURL + "/api/queue/task",
+			Request: c.queueRequest(job, slot),
+		})
+		agentVia = "agent_fallback"
+	}
+	for _, agentURL := range c.GetAgentURLs(job) {
+		dr.Submissions = append(dr.Submissions, DryRunSubmission{
+			Via:     agentVia,
+			URL:     agentURL + "/task",
+			Request: c.agentRequest(job),
+		})
+	}
+	return dr, nil
+}
+
+// DryRuns describes every job in the config.
+func (c *Config) DryRuns(now time.Time) ([]*DryRun, error) {
+	runs := make([]*DryRun, 0, len(c.Jobs))
+	for i := range c.Jobs {
+		dr, err := c.DryRun(&c.Jobs[i], now)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, dr)
+	}
+	return runs, nil
+}
+
+// handleDryRun shows what a job would submit without submitting it. With an
+// empty body it describes the existing job; with a job definition (as for
+// PUT /jobs/{job}) it validates and describes that instead, saving nothing,
+// so new or changed jobs can be checked first.
+func (s *Scheduler) handleDryRun(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "job")
+
+	s.mu.RLock()
+	config := s.config
+	var job *Job
+	for _, js := range s.jobs {
+		if js.Job.Name == name {
+			job = js.Job
+			break
+		}
+	}
+	s.mu.RUnlock()
+
+	var req JobRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	switch {
+	case err == io.EOF:
+		if job == nil {
+			api.WriteJSON(w, http.StatusNotFound, map[string]string{
+				"error": api.ErrorJobNotFound,
+				"name":  name,
+			})
+			return
+		}
+	case err != nil:
+		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, "Invalid JSON: "+err.Error())
+		return
+	default:
+		if req.Name == "" {
+			req.Name = name
+		}
+		if req.Name != name {
+			api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, "name must match the job in the path")
+			return
+		}
+		proposed, err := req.toJob()
+		if err == nil {
+			check := *config
+			check.Jobs = []Job{proposed}
+			err = check.Validate()
+		}
+		if err != nil {
+			api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, err.Error())
+			return
+		}
+		job = &proposed
+	}
+
+	dr, err := config.DryRun(job, time.Now())
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, err.Error())
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, dr)
+}
@@ -0,0 +1,99 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigDryRun(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{AgentURL: "https://agent:9000", AgentKind: "claude"}
+	job := &Job{Name: "nightly", Schedule: "0 1 * * *", Prompt: "Tidy up", Tier: "fast", Jitter: 5 * time.Minute}
+	now := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+
+	dr, err := cfg.DryRun(job, now)
+	require.NoError(t, err)
+	require.Len(t, dr.NextRuns, dryRunNextRuns)
+	require.Equal(t, time.Date(2026, 3, 15, 1, 0, 0, 0, time.UTC), dr.NextRuns[0])
+	require.Equal(t, "5m0s", dr.Jitter)
+	require.Equal(t, CatchUpSkip, dr.CatchUp)
+	require.Len(t, dr.Submissions, 1)
+	require.Equal(t, "agent", dr.Submissions[0].Via)
+	require.Equal(t, "https://agent:9000/task", dr.Submissions[0].URL)
+	require.Equal(t, "Tidy up", dr.Submissions[0].Request["prompt"])
+	require.Equal(t, "fast", dr.Submissions[0].Request["tier"])
+
+	// With a director, the queue is tried first with the slot's idempotency key
+	cfg.DirectorURL = "http://director:8080"
+	dr, err = cfg.DryRun(job, now)
+	require.NoError(t, err)
+	require.Len(t, dr.Submissions, 2)
+	require.Equal(t, "director", dr.Submissions[0].Via)
+	require.Equal(t, "http://director:8080/api/queue/task", dr.Submissions[0].URL)
+	require.Equal(t, "scheduler:nightly@2026-03-15T01:00:00Z", dr.Submissions[0].Request["idempotency_key"])
+	require.Equal(t, "agent_fallback", dr.Submissions[1].Via)
+
+	// Fanning out to every agent skips the director
+	job.AgentURLs, job.FanOut = []string{"https://a:9000", "https://b:9000"}, FanOutAll
+	dr, err = cfg.DryRun(job, now)
+	require.NoError(t, err)
+	require.Equal(t, FanOutAll, dr.FanOut)
+	require.Len(t, dr.Submissions, 2)
+	require.Equal(t, "agent", dr.Submissions[0].Via)
+	require.Equal(t, "https://b:9000/task", dr.Submissions[1].URL)
+}
+
+func TestDryRunEndpoint(t *testing.T) {
+	t.Parallel()
+
+	var contacted bool
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contacted = true
+	}))
+	t.Cleanup(agent.Close)
+
+	s, _ := newJobsTestScheduler(t)
+	s.config.AgentURL = agent.URL
+
+	w := doJobRequest(t, s, http.MethodPost, "/jobs/nightly/dry-run", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var dr DryRun
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &dr))
+	require.Equal(t, "From the config file", dr.Prompt)
+	require.Equal(t, agent.URL+"/task", dr.Submissions[0].URL)
+	require.False(t, contacted)
+
+	// A proposed definition is checked without being saved
+	w = doJobRequest(t, s, http.MethodPost, "/jobs/weekly/dry-run", JobRequest{Schedule: "0 9 * * 1", Prompt: "Weekly report"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &dr))
+	require.Equal(t, "weekly", dr.Job)
+	require.Equal(t, time.Monday, dr.NextRuns[0].Weekday())
+	require.Len(t, s.jobs, 1)
+
+	tests := []struct {
+		path string
+		body any
+		want int
+	}{
+		{"/jobs/missing/dry-run", nil, http.StatusNotFound},
+		{"/jobs/weekly/dry-run", JobRequest{Schedule: "not cron", Prompt: "x"}, http.StatusBadRequest},
+		{"/jobs/weekly/dry-run", JobRequest{Schedule: "0 9 * * 1"}, http.StatusBadRequest},
+		{"/jobs/weekly/dry-run", JobRequest{Name: "other", Schedule: "0 9 * * 1", Prompt: "x"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := doJobRequest(t, s, http.MethodPost, tt.path, tt.body)
+		require.Equal(t, tt.want, w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	s.Router().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/jobs/nightly/dry-run", strings.NewReader("{")))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,119 @@
+package scheduler
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Fan-out policies, for how a job with several agent_urls submits directly
+// to its agents
+const (
+	FanOutFirstIdle  = "first_idle"  // Try the agents in order until one accepts
+	FanOutRoundRobin = "round_robin" // As first_idle, starting after the agent that took the last run
+	FanOutAll        = "all"         // Submit to every agent at once
+)
+
+// FanOutTask is one agent's part of a fan_out: all run.
+type FanOutTask struct {
+	AgentURL string `json:"agent_url"`
+	TaskID   string `json:"task_id,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// agentSubmission is the outcome of submitting a run directly to agents.
+type agentSubmission struct {
+	AgentURL string // Agent that took the task (the first in order, for fan_out: all)
+	TaskID   string
+	Status   string // submitted, skipped_busy or skipped_error
+	Err      error
+	Tasks    []FanOutTask // Every agent's outcome, for fan_out: all
+}
+
+// submitViaAgents submits a run directly to the job's agents under its
+// fan-out policy. A run that no agent took is skipped_busy if any agent was
+// busy, so an outage of one agent doesn't count as the job failing while
+// another is merely busy, and skipped_error otherwise.
+func (s *Scheduler) submitViaAgents(js *jobState, requestID string) agentSubmission {
+	agents := s.config.GetAgentURLs(js.Job)
+	policy := s.config.GetFanOut(js.Job)
+	if policy == FanOutAll {
+		return s.submitToAll(js.Job, agents, requestID)
+	}
+
+	start := 0
+	if policy == FanOutRoundRobin {
+		js.mu.RLock()
+		start = js.nextAgent % len(agents)
+		js.mu.RUnlock()
+	}
+	var errs []string
+	busy := false
+	for i := range agents {
+		n := (start + i) % len(agents)
+		taskID, status, err := s.submitToAgent(js.Job, agents[n], requestID)
+		if err == nil {
+			js.mu.Lock()
+			js.nextAgent = n + 1
+			js.mu.Unlock()
+			return agentSubmission{AgentURL: agents[n], TaskID: taskID, Status: status}
+		}
+		if len(agents) == 1 {
+			return agentSubmission{Status: status, Err: err}
+		}
+		busy = busy || status == "skipped_busy"
+		errs = append(errs, agents[n]+": "+err.Error())
+	}
+	return failedSubmission(busy, errs)
+}
+
+// submitToAll submits a run to every agent concurrently. It is submitted if
+// any agent took it.
+func (s *Scheduler) submitToAll(job *Job, agents []string, requestID string) agentSubmission {
+	tasks := make([]FanOutTask, len(agents))
+	statuses := make([]string, len(agents))
+	var wg sync.WaitGroup
+	for i, agentURL := range agents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tasks[i].AgentURL = agentURL
+			taskID, status, err := s.submitToAgent(job, agentURL, requestID)
+			tasks[i].TaskID, statuses[i] = taskID, status
+			if err != nil {
+				tasks[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	var errs []string
+	for i, task := range tasks {
+		if task.Error == "" {
+			return agentSubmission{AgentURL: task.AgentURL, TaskID: task.TaskID, Status: statuses[i], Tasks: tasks}
+		}
+		errs = append(errs, task.AgentURL+": "+task.Error)
+	}
+	result := failedSubmission(slices.Contains(statuses, "skipped_busy"), errs)
+	result.Tasks = tasks
+	return result
+}
+
+// lastAgentURL returns the agent holding the job's last direct task. Runs
+// recorded before agents were tracked went to the job's only agent. Caller
+// holds js.mu.
+func (js *jobState) lastAgentURL(config *Config) string {
+	if js.LastAgentURL != "" {
+		return js.LastAgentURL
+	}
+	return config.GetAgentURLs(js.Job)[0]
+}
+
+func failedSubmission(busy bool, errs []string) agentSubmission {
+	status := "skipped_error"
+	if busy {
+		status = "skipped_busy"
+	}
+	return agentSubmission{Status: status, Err: errors.New(strings.Join(errs, "; "))}
+}
@@ -0,0 +1,130 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFanOutAgent returns a mock agent that answers /task with status, or
+// 201 and a task ID named after the agent.
+func newFanOutAgent(t *testing.T, name string, status int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if status != http.StatusCreated {
+			w.WriteHeader(status)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"task_id": "task-" + name})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func newFanOutScheduler(t *testing.T, job Job, directorURL string) (*Scheduler, *jobState) {
+	t.Helper()
+	job.Name, job.Schedule, job.Prompt = "backup", "0 1 * * *", "Back up"
+	cfg := &Config{Port: DefaultPort, Bind: DefaultBind, DirectorURL: directorURL, Jobs: []Job{job}}
+	require.NoError(t, cfg.Validate())
+	s := New(cfg, "", time.Minute, "test")
+	s.applyConfig(cfg, time.Now())
+	return s, s.jobs[0]
+}
+
+func TestFanOutFirstIdle(t *testing.T) {
+	t.Parallel()
+
+	busy, _ := newFanOutAgent(t, "busy", http.StatusConflict)
+	idle, _ := newFanOutAgent(t, "idle", http.StatusCreated)
+	down, _ := newFanOutAgent(t, "down", http.StatusInternalServerError)
+
+	s, js := newFanOutScheduler(t, Job{AgentURLs: []string{busy.URL, down.URL, idle.URL}}, "")
+	s.runJob(js)
+	assert.Equal(t, "submitted", js.LastStatus)
+	assert.Equal(t, "task-idle", js.LastTaskID)
+	assert.Equal(t, idle.URL, js.LastAgentURL)
+	assert.Equal(t, idle.URL, s.runs.recent("backup", 1)[0].AgentURL)
+
+	// Nobody took it: busy wins over errors, so the job isn't counted as failing
+	s, js = newFanOutScheduler(t, Job{AgentURLs: []string{busy.URL, down.URL}}, "")
+	s.runJob(js)
+	assert.Equal(t, "skipped_busy", js.LastStatus)
+	assert.Contains(t, js.LastError, down.URL+": status 500")
+
+	s, js = newFanOutScheduler(t, Job{AgentURLs: []string{down.URL, "http://127.0.0.1:1"}}, "")
+	s.runJob(js)
+	assert.Equal(t, "skipped_error", js.LastStatus)
+}
+
+func TestFanOutRoundRobin(t *testing.T) {
+	t.Parallel()
+
+	a, _ := newFanOutAgent(t, "a", http.StatusCreated)
+	b, _ := newFanOutAgent(t, "b", http.StatusCreated)
+
+	s, js := newFanOutScheduler(t, Job{AgentURLs: []string{a.URL, b.URL}, FanOut: FanOutRoundRobin}, "")
+	var got []string
+	for range 3 {
+		s.runJob(js)
+		got = append(got, js.LastTaskID)
+	}
+	assert.Equal(t, []string{"task-a", "task-b", "task-a"}, got)
+}
+
+func TestFanOutAll(t *testing.T) {
+	t.Parallel()
+
+	a, aCalls := newFanOutAgent(t, "a", http.StatusCreated)
+	busy, busyCalls := newFanOutAgent(t, "busy", http.StatusConflict)
+	b, bCalls := newFanOutAgent(t, "b", http.StatusCreated)
+	director, directorCalls := newFanOutAgent(t, "director", http.StatusCreated)
+
+	// The director can't target agents, so it is bypassed
+	s, js := newFanOutScheduler(t, Job{AgentURLs: []string{busy.URL, a.URL, b.URL}, FanOut: FanOutAll}, director.URL)
+	s.runJob(js)
+	assert.Zero(t, directorCalls.Load())
+	assert.EqualValues(t, 1, aCalls.Load())
+	assert.EqualValues(t, 1, bCalls.Load())
+	assert.EqualValues(t, 1, busyCalls.Load())
+
+	assert.Equal(t, "submitted", js.LastStatus)
+	assert.Equal(t, "task-a", js.LastTaskID, "the first agent in order that took it")
+	run := s.runs.recent("backup", 1)[0]
+	require.Len(t, run.Tasks, 3)
+	assert.Equal(t, FanOutTask{AgentURL: busy.URL, Error: "agent busy"}, run.Tasks[0])
+	assert.Equal(t, FanOutTask{AgentURL: b.URL, TaskID: "task-b"}, run.Tasks[2])
+
+	status := js.currentStatus(s.config)
+	assert.Equal(t, FanOutAll, status.FanOut)
+	assert.Equal(t, a.URL, status.LastAgentURL)
+}
+
+func TestFanOutValidation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		job     Job
+		wantErr string
+	}{
+		{"both agent settings", Job{AgentURL: "http://a", AgentURLs: []string{"http://b"}}, "not both"},
+		{"duplicate agent", Job{AgentURLs: []string{"http://a", "http://a"}}, "distinct"},
+		{"unknown policy", Job{AgentURLs: []string{"http://a"}, FanOut: "random"}, "fan_out must be"},
+	}
+	for _, tt := range tests {
+		tt.job.Name, tt.job.Schedule, tt.job.Prompt = "job", "0 1 * * *", "x"
+		cfg := &Config{Port: DefaultPort, Bind: DefaultBind, Jobs: []Job{tt.job}}
+		err := cfg.Validate()
+		require.Error(t, err, tt.name)
+		assert.Contains(t, err.Error(), tt.wantErr, tt.name)
+	}
+}
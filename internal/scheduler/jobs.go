@@ -0,0 +1,381 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gopkg.in/yaml.v3"
+	"phobos.org.uk/agency/internal/api"
+)
+
+// JobsDirName is the directory, beside the config file, that holds jobs
+// created through the jobs API, one <name>.yaml file per job.
+const JobsDirName = "jobs.d"
+
+// jobNamePattern restricts managed job names to safe file names.
+var jobNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+var (
+	errJobExists   = errors.New("job already exists")
+	errJobNotFound = errors.New("job not found")
+	errJobReadOnly = errors.New("job is defined in the config file")
+	errJobPersist  = errors.New("saving jobs")
+)
+
+// JobsDir returns the managed jobs directory for a config file.
+func JobsDir(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), JobsDirName)
+}
+
+// JobRequest is the body of POST /jobs and PUT /jobs/{job}.
+type JobRequest struct {
+	Name      string `json:"name"`
+	Schedule  string `json:"schedule"`
+	Prompt    string `json:"prompt"`
+	Tier      string `json:"tier,omitempty"`
+	Timeout   string `json:"timeout,omitempty"` // Go duration, e.g. "30m"
+	AgentURL  string `json:"agent_url,omitempty"`
+	AgentKind string `json:"agent_kind,omitempty"`
+	CatchUp   string `json:"catch_up,omitempty"`
+	Jitter    string `json:"jitter,omitempty"` // Go duration, e.g. "5m"
+	Overlap   string `json:"overlap,omitempty"`
+
+	AgentURLs    []string          `json:"agent_urls,omitempty"`
+	FanOut       string            `json:"fan_out,omitempty"`
+	SuspendAfter int               `json:"suspend_after,omitempty"`
+	Env          map[string]string `json:"env,omitempty"` // Values may be "secret:<name>"
+}
+
+// toJob converts the request into a managed job. Full validation happens
+// against the whole config when the job is applied.
+func (r JobRequest) toJob() (Job, error) {
+	if !jobNamePattern.MatchString(r.Name) {
+		return Job{}, fmt.Errorf("name must be 1-64 letters, digits, '.', '_' or '-', starting with a letter or digit")
+	}
+	job := Job{
+		Name:      r.Name,
+		Schedule:  strings.TrimSpace(r.Schedule),
+		Prompt:    r.Prompt,
+		Tier:      r.Tier,
+		AgentURL:  r.AgentURL,
+		AgentKind: r.AgentKind,
+		CatchUp:   r.CatchUp,
+		Overlap:   r.Overlap,
+		Env:       r.Env,
+		Managed:   true,
+
+		AgentURLs:    r.AgentURLs,
+		FanOut:       r.FanOut,
+		SuspendAfter: r.SuspendAfter,
+	}
+	if r.Timeout != "" {
+		timeout, err := time.ParseDuration(r.Timeout)
+		if err != nil || timeout <= 0 {
+			return Job{}, fmt.Errorf("timeout must be a positive duration such as 30m, got %q", r.Timeout)
+		}
+		job.Timeout = timeout
+	}
+	if r.Jitter != "" {
+		jitter, err := time.ParseDuration(r.Jitter)
+		if err != nil || jitter < 0 {
+			return Job{}, fmt.Errorf("jitter must be a duration such as 5m, got %q", r.Jitter)
+		}
+		job.Jitter = jitter
+	}
+	return job, nil
+}
+
+// jobFile is the on-disk form of a managed job.
+type jobFile struct {
+	Name      string `yaml:"name"`
+	Schedule  string `yaml:"schedule"`
+	Prompt    string `yaml:"prompt"`
+	Tier      string `yaml:"tier,omitempty"`
+	Timeout   string `yaml:"timeout,omitempty"`
+	AgentURL  string `yaml:"agent_url,omitempty"`
+	AgentKind string `yaml:"agent_kind,omitempty"`
+	CatchUp   string `yaml:"catch_up,omitempty"`
+	Jitter    string `yaml:"jitter,omitempty"`
+	Overlap   string `yaml:"overlap,omitempty"`
+
+	AgentURLs    []string          `yaml:"agent_urls,omitempty"`
+	FanOut       string            `yaml:"fan_out,omitempty"`
+	SuspendAfter int               `yaml:"suspend_after,omitempty"`
+	Env          map[string]string `yaml:"env,omitempty"`
+}
+
+// loadJobFiles reads the managed jobs in dir, in file name order. A missing
+// directory means no managed jobs.
+func loadJobFiles(dir string) ([]Job, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading jobs directory: %w", err)
+	}
+
+	var jobs []Job
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".yaml" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("reading job file: %w", err)
+		}
+		var job Job
+		if err := yaml.Unmarshal(data, &job); err != nil {
+			return nil, fmt.Errorf("parsing job file %s: %w", entry.Name(), err)
+		}
+		if job.Name+".yaml" != entry.Name() {
+			return nil, fmt.Errorf("job file %s: name %q does not match the file name", entry.Name(), job.Name)
+		}
+		job.Managed = true
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// writeJobFile stores a managed job in dir, replacing any previous version.
+func writeJobFile(dir string, job Job) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("creating jobs directory: %w", err)
+	}
+	file := jobFile{
+		Name:      job.Name,
+		Schedule:  job.Schedule,
+		Prompt:    job.Prompt,
+		Tier:      job.Tier,
+		AgentURL:  job.AgentURL,
+		AgentKind: job.AgentKind,
+		CatchUp:   job.CatchUp,
+		Overlap:   job.Overlap,
+		Env:       job.Env,
+
+		AgentURLs:    job.AgentURLs,
+		FanOut:       job.FanOut,
+		SuspendAfter: job.SuspendAfter,
+	}
+	if job.Timeout > 0 {
+		file.Timeout = job.Timeout.String()
+	}
+	if job.Jitter > 0 {
+		file.Jitter = job.Jitter.String()
+	}
+	data, err := yaml.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("encoding job: %w", err)
+	}
+
+	// Write then rename so a concurrent reload never sees a partial file
+	path := filepath.Join(dir, job.Name+".yaml")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("writing job file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("writing job file: %w", err)
+	}
+	return nil
+}
+
+// configModTime returns the latest modification time of the config file and
+// the managed jobs directory, so jobs.d changes trigger a reload too.
+func configModTime(configPath string) (time.Time, error) {
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	latest := info.ModTime()
+
+	dir := JobsDir(configPath)
+	if info, err := os.Stat(dir); err == nil && info.ModTime().After(latest) {
+		latest = info.ModTime()
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// changeJobs applies edit to a copy of the current jobs, validates the
+// result, persists it with persist, and swaps it in. Job state is preserved
+// by name as for a config reload.
+func (s *Scheduler) changeJobs(edit func(jobs []Job) ([]Job, error), persist func(dir string) error) error {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+
+	s.mu.RLock()
+	next := *s.config
+	s.mu.RUnlock()
+
+	jobs, err := edit(slices.Clone(next.Jobs))
+	if err != nil {
+		return err
+	}
+	next.Jobs = jobs
+	if err := next.Validate(); err != nil {
+		return err
+	}
+	if err := persist(JobsDir(s.configPath)); err != nil {
+		return fmt.Errorf("%w: %v", errJobPersist, err)
+	}
+
+	modTime, err := configModTime(s.configPath)
+	if err != nil {
+		modTime = time.Now()
+	}
+	s.applyConfig(&next, modTime)
+	return nil
+}
+
+// jobIndex returns the index of the named job, or -1.
+func jobIndex(jobs []Job, name string) int {
+	return slices.IndexFunc(jobs, func(j Job) bool { return j.Name == name })
+}
+
+// writeJobResult responds with the named job's status after a change.
+func (s *Scheduler) writeJobResult(w http.ResponseWriter, status int, name string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, js := range s.jobs {
+		if js.Job.Name == name {
+			api.WriteJSON(w, status, js.status(s.config, s.runs))
+			return
+		}
+	}
+	api.WriteError(w, http.StatusNotFound, api.ErrorJobNotFound, "job not found: "+name)
+}
+
+// writeJobChangeError maps a changeJobs error to an HTTP response.
+func writeJobChangeError(w http.ResponseWriter, name string, err error) {
+	switch {
+	case errors.Is(err, errJobExists):
+		api.WriteError(w, http.StatusConflict, api.ErrorJobExists, "job already exists: "+name)
+	case errors.Is(err, errJobNotFound):
+		api.WriteError(w, http.StatusNotFound, api.ErrorJobNotFound, "job not found: "+name)
+	case errors.Is(err, errJobReadOnly):
+		api.WriteError(w, http.StatusConflict, api.ErrorJobReadOnly,
+			"job "+name+" is defined in the config file; edit the file to change it")
+	case errors.Is(err, errJobPersist):
+		api.WriteError(w, http.StatusInternalServerError, "persist_error", err.Error())
+	default:
+		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, err.Error())
+	}
+}
+
+// handleCreateJob adds a managed job.
+func (s *Scheduler) handleCreateJob(w http.ResponseWriter, r *http.Request) {
+	var req JobRequest
+	if !api.DecodeJSON(w, r, &req) {
+		return
+	}
+	job, err := req.toJob()
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, err.Error())
+		return
+	}
+
+	err = s.changeJobs(func(jobs []Job) ([]Job, error) {
+		if jobIndex(jobs, job.Name) >= 0 {
+			return nil, errJobExists
+		}
+		return append(jobs, job), nil
+	}, func(dir string) error {
+		return writeJobFile(dir, job)
+	})
+	if err != nil {
+		writeJobChangeError(w, job.Name, err)
+		return
+	}
+
+	log.Printf("jobs action=created job=%s schedule=%q", job.Name, job.Schedule)
+	s.writeJobResult(w, http.StatusCreated, job.Name)
+}
+
+// handleUpdateJob replaces the definition of a managed job.
+func (s *Scheduler) handleUpdateJob(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "job")
+	var req JobRequest
+	if !api.DecodeJSON(w, r, &req) {
+		return
+	}
+	if req.Name == "" {
+		req.Name = name
+	}
+	if req.Name != name {
+		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, "name cannot be changed; create a new job instead")
+		return
+	}
+	job, err := req.toJob()
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, api.ErrorValidation, err.Error())
+		return
+	}
+
+	err = s.changeJobs(func(jobs []Job) ([]Job, error) {
+		i := jobIndex(jobs, name)
+		if i < 0 {
+			return nil, errJobNotFound
+		}
+		if !jobs[i].Managed {
+			return nil, errJobReadOnly
+		}
+		jobs[i] = job
+		return jobs, nil
+	}, func(dir string) error {
+		return writeJobFile(dir, job)
+	})
+	if err != nil {
+		writeJobChangeError(w, name, err)
+		return
+	}
+
+	log.Printf("jobs action=updated job=%s schedule=%q", job.Name, job.Schedule)
+	s.writeJobResult(w, http.StatusOK, name)
+}
+
+// handleDeleteJob removes a managed job.
+func (s *Scheduler) handleDeleteJob(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "job")
+
+	err := s.changeJobs(func(jobs []Job) ([]Job, error) {
+		i := jobIndex(jobs, name)
+		if i < 0 {
+			return nil, errJobNotFound
+		}
+		if !jobs[i].Managed {
+			return nil, errJobReadOnly
+		}
+		return slices.Delete(jobs, i, i+1), nil
+	}, func(dir string) error {
+		if err := os.Remove(filepath.Join(dir, name+".yaml")); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing job file: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		writeJobChangeError(w, name, err)
+		return
+	}
+
+	log.Printf("jobs action=deleted job=%s", name)
+	api.WriteJSON(w, http.StatusOK, map[string]string{
+		"name":   name,
+		"status": "deleted",
+	})
+}
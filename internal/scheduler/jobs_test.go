@@ -0,0 +1,191 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const jobsTestConfig = `
+jobs:
+  - name: nightly
+    schedule: "0 1 * * *"
+    prompt: "From the config file"
+`
+
+// newJobsTestScheduler returns a scheduler loaded from a temp config, plus
+// its config path.
+func newJobsTestScheduler(t *testing.T) (*Scheduler, string) {
+	t.Helper()
+	configPath := createTempConfig(t, jobsTestConfig)
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+
+	s := New(cfg, configPath, time.Minute, "test")
+	s.applyConfig(cfg, time.Now())
+	return s, configPath
+}
+
+func doJobRequest(t *testing.T, s *Scheduler, method, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	w := httptest.NewRecorder()
+	s.Router().ServeHTTP(w, req)
+	return w
+}
+
+func TestJobsAPILifecycle(t *testing.T) {
+	t.Parallel()
+	s, configPath := newJobsTestScheduler(t)
+	jobFile := filepath.Join(JobsDir(configPath), "weekly.yaml")
+
+	// Create
+	w := doJobRequest(t, s, http.MethodPost, "/jobs", JobRequest{
+		Name:     "weekly",
+		Schedule: "0 9 * * 1",
+		Prompt:   "Weekly report",
+		Tier:     "heavy",
+		Timeout:  "45m",
+		Env:      map[string]string{"REPO_TOKEN": "secret:repo_token"},
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var status JobStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, "weekly", status.Name)
+	assert.True(t, status.Managed)
+	assert.False(t, status.NextRun.IsZero())
+	require.FileExists(t, jobFile)
+
+	// The job survives a restart
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	require.Len(t, cfg.Jobs, 2)
+	assert.Equal(t, "weekly", cfg.Jobs[1].Name)
+	assert.Equal(t, 45*time.Minute, cfg.Jobs[1].Timeout)
+	assert.Equal(t, map[string]string{"REPO_TOKEN": "secret:repo_token"}, cfg.Jobs[1].Env)
+	assert.True(t, cfg.Jobs[1].Managed)
+	assert.False(t, cfg.Jobs[0].Managed)
+
+	// Duplicate
+	w = doJobRequest(t, s, http.MethodPost, "/jobs", JobRequest{
+		Name: "weekly", Schedule: "0 9 * * 1", Prompt: "Again",
+	})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Update
+	w = doJobRequest(t, s, http.MethodPut, "/jobs/weekly", JobRequest{
+		Schedule: "0 10 * * 1",
+		Prompt:   "Weekly report, later",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	cfg, err = Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, "0 10 * * 1", cfg.Jobs[1].Schedule)
+	assert.Equal(t, "Weekly report, later", cfg.Jobs[1].Prompt)
+
+	// Delete
+	w = doJobRequest(t, s, http.MethodDelete, "/jobs/weekly", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NoFileExists(t, jobFile)
+
+	s.mu.RLock()
+	assert.Len(t, s.jobs, 1)
+	s.mu.RUnlock()
+
+	w = doJobRequest(t, s, http.MethodDelete, "/jobs/weekly", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestJobsAPIConfigJobsReadOnly(t *testing.T) {
+	t.Parallel()
+	s, _ := newJobsTestScheduler(t)
+
+	w := doJobRequest(t, s, http.MethodPut, "/jobs/nightly", JobRequest{
+		Schedule: "0 2 * * *", Prompt: "Changed",
+	})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = doJobRequest(t, s, http.MethodDelete, "/jobs/nightly", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	s.mu.RLock()
+	assert.Equal(t, "0 1 * * *", s.jobs[0].Job.Schedule)
+	s.mu.RUnlock()
+}
+
+func TestJobsAPIValidation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		path string
+		req  JobRequest
+	}{
+		{"bad name", "/jobs", JobRequest{Name: "../escape", Schedule: "0 1 * * *", Prompt: "x"}},
+		{"bad schedule", "/jobs", JobRequest{Name: "bad", Schedule: "whenever", Prompt: "x"}},
+		{"missing prompt", "/jobs", JobRequest{Name: "bad", Schedule: "0 1 * * *"}},
+		{"bad tier", "/jobs", JobRequest{Name: "bad", Schedule: "0 1 * * *", Prompt: "x", Tier: "huge"}},
+		{"bad timeout", "/jobs", JobRequest{Name: "bad", Schedule: "0 1 * * *", Prompt: "x", Timeout: "soon"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			s, configPath := newJobsTestScheduler(t)
+
+			w := doJobRequest(t, s, http.MethodPost, tt.path, tt.req)
+			assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+			_, err := os.Stat(JobsDir(configPath))
+			assert.True(t, os.IsNotExist(err), "nothing should be persisted")
+		})
+	}
+}
+
+func TestJobsAPIRenameRejected(t *testing.T) {
+	t.Parallel()
+	s, _ := newJobsTestScheduler(t)
+
+	w := doJobRequest(t, s, http.MethodPost, "/jobs", JobRequest{
+		Name: "daily", Schedule: "0 8 * * *", Prompt: "Daily",
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	w = doJobRequest(t, s, http.MethodPut, "/jobs/daily", JobRequest{
+		Name: "renamed", Schedule: "0 8 * * *", Prompt: "Daily",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestConfigReloadPicksUpJobFiles(t *testing.T) {
+	t.Parallel()
+	s, configPath := newJobsTestScheduler(t)
+
+	s.mu.Lock()
+	s.configModTime = time.Now().Add(-time.Hour)
+	s.mu.Unlock()
+
+	// A job file added by hand is loaded on the next reload check
+	require.NoError(t, writeJobFile(JobsDir(configPath), Job{
+		Name: "handmade", Schedule: "*/5 * * * *", Prompt: "Added on disk",
+	}))
+	s.checkAndReloadConfig()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	require.Len(t, s.jobs, 2)
+	assert.Equal(t, "handmade", s.jobs[1].Job.Name)
+	assert.True(t, s.jobs[1].Job.Managed)
+}
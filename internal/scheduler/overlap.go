@@ -0,0 +1,156 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"time"
+
+	"phobos.org.uk/agency/internal/taskstate"
+)
+
+// Overlap policies, applied when a job is due while its previous run's task
+// is still pending or running
+const (
+	OverlapAllow          = "allow"           // Submit regardless
+	OverlapSkip           = "skip"            // Skip this run
+	OverlapQueue          = "queue"           // Run once the previous task finishes
+	OverlapCancelPrevious = "cancel_previous" // Cancel the previous task, then submit
+)
+
+// overlapRecheckInterval is how often a job held by the queue overlap policy
+// checks whether its previous task has finished.
+var overlapRecheckInterval = 30 * time.Second
+
+// nextRunAfter returns the job's next start after now: the next schedule
+// time plus a random delay of up to the job's jitter.
+func nextRunAfter(job *Job, cron *CronExpr, now time.Time) time.Time {
+	next := cron.Next(now)
+	if next.IsZero() {
+		// Defensive: if Next() can't find a match, skip far into the future
+		return now.Add(24 * time.Hour)
+	}
+	if job.Jitter > 0 {
+		next = next.Add(rand.N(job.Jitter))
+	}
+	return next
+}
+
+// resolveOverlap applies the job's overlap policy before a run and reports
+// whether the run should go ahead. Held and skipped runs leave the previous
+// task recorded so later runs keep checking it.
+func (s *Scheduler) resolveOverlap(js *jobState, started time.Time) bool {
+	policy := s.config.GetOverlap(js.Job)
+	if policy == OverlapAllow {
+		return true
+	}
+
+	active, ref := s.previousActive(js)
+	if !active {
+		return true
+	}
+
+	switch policy {
+	case OverlapSkip:
+		log.Printf("job=%s action=skipped reason=overlap previous=%s", js.Job.Name, ref)
+		s.updateJobStateOverlap(js, "skipped_overlap", "previous run still active: "+ref, time.Time{})
+		s.recordRun(js, started, "")
+		return false
+	case OverlapQueue:
+		log.Printf("job=%s action=held reason=overlap previous=%s", js.Job.Name, ref)
+		s.updateJobStateOverlap(js, "waiting_overlap", "waiting for previous run: "+ref,
+			time.Now().Add(overlapRecheckInterval))
+		return false
+	case OverlapCancelPrevious:
+		if err := s.cancelPrevious(js); err != nil {
+			log.Printf("job=%s warning=cancel_previous_failed previous=%s error=%q", js.Job.Name, ref, err)
+		} else {
+			log.Printf("job=%s action=cancelled_previous previous=%s", js.Job.Name, ref)
+		}
+	}
+	return true
+}
+
+// previousActive reports whether the task from the job's last run is still
+// pending or running, with a reference to it for logs. An unreachable
+// director or agent counts as not active so the run can go ahead.
+func (s *Scheduler) previousActive(js *jobState) (bool, string) {
+	js.mu.RLock()
+	taskID, queueID := js.LastTaskID, js.LastQueueID
+	agentURL := js.lastAgentURL(s.config)
+	js.mu.RUnlock()
+
+	client := s.createHTTPClient(s.config.DirectorURL)
+	switch {
+	case queueID != "":
+		// The director drops finished tasks from the queue
+		resp, err := client.Get(s.config.DirectorURL + "/api/queue/" + url.PathEscape(queueID))
+		if err != nil {
+			return false, "queue_id=" + queueID
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK, "queue_id=" + queueID
+	case taskID != "":
+		resp, err := s.createHTTPClient(agentURL).Get(agentURL + "/task/" + url.PathEscape(taskID))
+		if err != nil {
+			return false, "task_id=" + taskID
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return false, "task_id=" + taskID
+		}
+		var task struct {
+			State string `json:"state"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&task); err != nil {
+			return false, "task_id=" + taskID
+		}
+		state, ok := taskstate.Parse(task.State)
+		return ok && !state.IsTerminal(), "task_id=" + taskID
+	}
+	return false, ""
+}
+
+// cancelPrevious cancels the task from the job's last run.
+func (s *Scheduler) cancelPrevious(js *jobState) error {
+	js.mu.RLock()
+	taskID, queueID := js.LastTaskID, js.LastQueueID
+	agentURL := js.lastAgentURL(s.config)
+	js.mu.RUnlock()
+
+	target := s.config.DirectorURL + "/api/queue/" + url.PathEscape(queueID) + "/cancel"
+	if queueID == "" {
+		target = agentURL + "/task/" + url.PathEscape(taskID) + "/cancel"
+	}
+	resp, err := s.createHTTPClient(target).Post(target, "application/json", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// updateJobStateOverlap records a run that was skipped or held by the overlap
+// policy. The previous task IDs are kept. A zero nextRun means the next
+// scheduled time.
+func (s *Scheduler) updateJobStateOverlap(js *jobState, status, errMsg string, nextRun time.Time) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	now := time.Now()
+	js.LastRun = now
+	js.LastStatus = status
+	js.LastError = errMsg
+	js.lastTasks = nil
+	if nextRun.IsZero() {
+		nextRun = nextRunAfter(js.Job, js.Cron, now)
+	}
+	js.NextRun = nextRun
+	js.isRunning = false
+}
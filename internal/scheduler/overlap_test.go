@@ -0,0 +1,181 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextRunAfterJitter(t *testing.T) {
+	t.Parallel()
+
+	cron, err := ParseCron("0 * * * *")
+	require.NoError(t, err)
+	now := time.Date(2025, 1, 13, 10, 30, 0, 0, time.Local)
+	next := cron.Next(now)
+
+	assert.Equal(t, next, nextRunAfter(&Job{}, cron, now))
+
+	job := &Job{Jitter: 10 * time.Minute}
+	seen := make(map[time.Time]bool)
+	for range 50 {
+		got := nextRunAfter(job, cron, now)
+		assert.False(t, got.Before(next))
+		assert.True(t, got.Before(next.Add(job.Jitter)))
+		seen[got] = true
+	}
+	assert.Greater(t, len(seen), 1, "jitter should vary the start time")
+}
+
+// overlapAgent is a mock agent whose previous task has the given state.
+type overlapAgent struct {
+	prevState string
+
+	mu        sync.Mutex
+	submitted int
+	cancelled []string
+}
+
+func (a *overlapAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/task/task-prev":
+		json.NewEncoder(w).Encode(map[string]string{"task_id": "task-prev", "state": a.prevState})
+	case r.Method == http.MethodPost && r.URL.Path == "/task/task-prev/cancel":
+		a.cancelled = append(a.cancelled, "task-prev")
+		json.NewEncoder(w).Encode(map[string]string{"state": "cancelled"})
+	case r.Method == http.MethodPost && r.URL.Path == "/task":
+		a.submitted++
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"task_id": "task-new"})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestOverlapPolicies(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		overlap       string
+		prevState     string
+		wantStatus    string
+		wantTaskID    string
+		wantSubmitted int
+		wantCancelled int
+		wantRecorded  int
+	}{
+		{"allow runs", OverlapAllow, "working", "submitted", "task-new", 1, 0, 1},
+		{"skip while running", OverlapSkip, "working", "skipped_overlap", "task-prev", 0, 0, 1},
+		{"skip after finish", OverlapSkip, "completed", "submitted", "task-new", 1, 0, 1},
+		{"queue while running", OverlapQueue, "working", "waiting_overlap", "task-prev", 0, 0, 0},
+		{"queue after finish", OverlapQueue, "failed", "submitted", "task-new", 1, 0, 1},
+		{"cancel previous", OverlapCancelPrevious, "working", "submitted", "task-new", 1, 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			agent := &overlapAgent{prevState: tt.prevState}
+			server := httptest.NewServer(agent)
+			defer server.Close()
+
+			cfg := &Config{
+				Port:     0,
+				AgentURL: server.URL,
+				Jobs: []Job{{
+					Name:     "hourly",
+					Schedule: "0 * * * *",
+					Prompt:   "x",
+					Overlap:  tt.overlap,
+				}},
+			}
+			s := New(cfg, "", time.Minute, "test")
+			s.applyConfig(cfg, time.Now())
+			js := s.jobs[0]
+			js.LastTaskID = "task-prev"
+			js.isRunning = true
+
+			before := time.Now()
+			s.runJob(js)
+
+			agent.mu.Lock()
+			assert.Equal(t, tt.wantSubmitted, agent.submitted)
+			assert.Len(t, agent.cancelled, tt.wantCancelled)
+			agent.mu.Unlock()
+
+			status := js.status(cfg, s.runs)
+			assert.Equal(t, tt.wantStatus, status.LastStatus)
+			assert.Equal(t, tt.wantTaskID, status.LastTaskID)
+			assert.Equal(t, tt.overlap, status.Overlap)
+			assert.False(t, js.isRunning)
+			assert.Len(t, status.RecentRuns, tt.wantRecorded)
+			if tt.wantStatus == "waiting_overlap" {
+				// Held runs are retried soon rather than at the next schedule time
+				assert.WithinDuration(t, before.Add(overlapRecheckInterval), status.NextRun, 5*time.Second)
+			}
+		})
+	}
+}
+
+func TestOverlapQueuedPreviousRun(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	queued := true
+	submitted := 0
+	director := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/queue/queue-prev":
+			if !queued {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"queue_id": "queue-prev", "state": "working"})
+		case r.Method == http.MethodPost && r.URL.Path == "/api/queue/task":
+			submitted++
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{"queue_id": "queue-new"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer director.Close()
+
+	cfg := &Config{
+		Port:        0,
+		DirectorURL: director.URL,
+		Jobs:        []Job{{Name: "hourly", Schedule: "0 * * * *", Prompt: "x", Overlap: OverlapSkip}},
+	}
+	s := New(cfg, "", time.Minute, "test")
+	s.applyConfig(cfg, time.Now())
+	js := s.jobs[0]
+	js.LastQueueID = "queue-prev"
+
+	js.isRunning = true
+	s.runJob(js)
+	assert.Equal(t, "skipped_overlap", js.LastStatus)
+
+	// Once the director has dropped the finished task, the job runs again
+	mu.Lock()
+	queued = false
+	mu.Unlock()
+	js.isRunning = true
+	s.runJob(js)
+	assert.Equal(t, "queued", js.LastStatus)
+	assert.Equal(t, "queue-new", js.LastQueueID)
+	mu.Lock()
+	assert.Equal(t, 1, submitted)
+	mu.Unlock()
+}
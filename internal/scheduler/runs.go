@@ -0,0 +1,199 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"phobos.org.uk/agency/internal/api"
+)
+
+// Run history limits
+const (
+	DefaultRunsDirName = "runs" // Beside the config file when runs_dir is unset
+	MaxRunsPerJob      = 100    // Older runs are dropped
+	DefaultRunsLimit   = 20     // Runs returned by GET /jobs/{job}/runs
+	StatusRecentRuns   = 5      // Runs included with each job in /status
+)
+
+// JobRun records one execution of a job. The scheduler does not follow the
+// task after submission, so State is the submission outcome (the same values
+// as JobStatus.LastStatus) and Duration covers the submission only. A
+// "resumed" entry marks a suspended job being resumed rather than a run.
+type JobRun struct {
+	StartedAt       time.Time `json:"started_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	State           string    `json:"state"`
+	TaskID          string    `json:"task_id,omitempty"`
+	QueueID         string    `json:"queue_id,omitempty"`
+	AgentURL        string    `json:"agent_url,omitempty"`  // Agent that took a direct submission
+	RequestID       string    `json:"request_id,omitempty"` // Sent with the run's submissions as X-Agency-Request-ID
+	Error           string    `json:"error,omitempty"`
+
+	Tasks []FanOutTask `json:"tasks,omitempty"` // Each agent's outcome, for fan_out: all
+}
+
+// runStore keeps the recent runs of each job, oldest first, persisted as one
+// JSON file per job. With an empty dir runs are kept in memory only.
+type runStore struct {
+	dir string
+
+	mu     sync.Mutex
+	runs   map[string][]JobRun
+	loaded map[string]bool
+}
+
+func newRunStore(dir string) *runStore {
+	return &runStore{
+		dir:    dir,
+		runs:   make(map[string][]JobRun),
+		loaded: make(map[string]bool),
+	}
+}
+
+// path returns the history file for a job. Config file job names are not
+// restricted, so the name is escaped.
+func (rs *runStore) path(job string) string {
+	return filepath.Join(rs.dir, url.PathEscape(job)+".json")
+}
+
+// load reads a job's runs from disk on first use. Caller holds rs.mu.
+func (rs *runStore) load(job string) []JobRun {
+	if rs.loaded[job] || rs.dir == "" {
+		return rs.runs[job]
+	}
+	rs.loaded[job] = true
+
+	data, err := os.ReadFile(rs.path(job))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("job=%s warning=run_history_read_failed error=%q", job, err)
+		}
+		return rs.runs[job]
+	}
+	var runs []JobRun
+	if err := json.Unmarshal(data, &runs); err != nil {
+		log.Printf("job=%s warning=run_history_corrupt error=%q", job, err)
+		return rs.runs[job]
+	}
+	// Keep anything recorded before the file was read
+	rs.runs[job] = append(runs, rs.runs[job]...)
+	return rs.runs[job]
+}
+
+// record appends a run, trims the job's history to MaxRunsPerJob and saves it.
+func (rs *runStore) record(job string, run JobRun) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	runs := append(rs.load(job), run)
+	if len(runs) > MaxRunsPerJob {
+		runs = runs[len(runs)-MaxRunsPerJob:]
+	}
+	rs.runs[job] = runs
+
+	if rs.dir == "" {
+		return
+	}
+	if err := rs.save(job, runs); err != nil {
+		log.Printf("job=%s warning=run_history_write_failed error=%q", job, err)
+	}
+}
+
+func (rs *runStore) save(job string, runs []JobRun) error {
+	if err := os.MkdirAll(rs.dir, 0700); err != nil {
+		return fmt.Errorf("creating runs directory: %w", err)
+	}
+	data, err := json.Marshal(runs)
+	if err != nil {
+		return err
+	}
+	path := rs.path(job)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// recent returns up to limit of a job's runs, newest first.
+func (rs *runStore) recent(job string, limit int) []JobRun {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	runs := rs.load(job)
+	n := min(limit, len(runs))
+	recent := make([]JobRun, n)
+	for i := range n {
+		recent[i] = runs[len(runs)-1-i]
+	}
+	return recent
+}
+
+// recordRun adds the outcome of a finished runJob call to the job's history.
+func (s *Scheduler) recordRun(js *jobState, started time.Time, requestID string) {
+	js.mu.RLock()
+	run := JobRun{
+		StartedAt:       started,
+		DurationSeconds: time.Since(started).Seconds(),
+		State:           js.LastStatus,
+		TaskID:          js.LastTaskID,
+		QueueID:         js.LastQueueID,
+		AgentURL:        js.LastAgentURL,
+		RequestID:       requestID,
+		Error:           js.LastError,
+		Tasks:           js.lastTasks,
+	}
+	name := js.Job.Name
+	js.mu.RUnlock()
+
+	s.runs.record(name, run)
+	s.countFailure(js, run.State)
+}
+
+// handleJobRuns returns a job's recent runs, newest first.
+func (s *Scheduler) handleJobRuns(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "job")
+
+	limit := DefaultRunsLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxRunsPerJob {
+			api.WriteError(w, http.StatusBadRequest, api.ErrorValidation,
+				fmt.Sprintf("limit must be between 1 and %d", MaxRunsPerJob))
+			return
+		}
+		limit = n
+	}
+
+	s.mu.RLock()
+	found := false
+	for _, js := range s.jobs {
+		if js.Job.Name == name {
+			found = true
+			break
+		}
+	}
+	s.mu.RUnlock()
+	if !found {
+		api.WriteError(w, http.StatusNotFound, api.ErrorJobNotFound, "job not found: "+name)
+		return
+	}
+
+	api.WriteJSON(w, http.StatusOK, map[string]any{
+		"name": name,
+		"runs": s.runs.recent(name, limit),
+	})
+}
@@ -0,0 +1,125 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunStorePersistsAndTrims(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	rs := newRunStore(dir)
+	start := time.Now().Add(-time.Hour)
+	for i := range MaxRunsPerJob + 5 {
+		rs.record("nightly/report", JobRun{
+			StartedAt: start.Add(time.Duration(i) * time.Minute),
+			State:     "submitted",
+			TaskID:    fmt.Sprintf("task-%d", i),
+		})
+	}
+
+	// A fresh store sees the same trimmed history
+	reloaded := newRunStore(dir)
+	all := reloaded.recent("nightly/report", MaxRunsPerJob*2)
+	require.Len(t, all, MaxRunsPerJob)
+	assert.Equal(t, fmt.Sprintf("task-%d", MaxRunsPerJob+4), all[0].TaskID)
+	assert.Equal(t, "task-5", all[len(all)-1].TaskID)
+
+	assert.Len(t, reloaded.recent("nightly/report", 3), 3)
+	assert.Empty(t, reloaded.recent("other", 3))
+}
+
+func TestRunStoreInMemory(t *testing.T) {
+	t.Parallel()
+
+	rs := newRunStore("")
+	rs.record("job", JobRun{State: "queued", QueueID: "q-1"})
+	runs := rs.recent("job", 10)
+	require.Len(t, runs, 1)
+	assert.Equal(t, "q-1", runs[0].QueueID)
+}
+
+func TestJobRunsEndpoint(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 2 {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"task_id": "task-1"})
+	}))
+	defer agent.Close()
+
+	configPath := createTempConfig(t, `
+agent_url: `+agent.URL+`
+jobs:
+  - name: nightly
+    schedule: "0 1 * * *"
+    prompt: "Run"
+`)
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	s := New(cfg, configPath, time.Minute, "test")
+	s.applyConfig(cfg, time.Now())
+	router := s.Router()
+
+	for range 2 {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/trigger/nightly", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/jobs/nightly/runs", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Name string   `json:"name"`
+		Runs []JobRun `json:"runs"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Runs, 2)
+	assert.Equal(t, "skipped_busy", resp.Runs[0].State)
+	assert.Equal(t, "agent busy", resp.Runs[0].Error)
+	assert.Equal(t, "submitted", resp.Runs[1].State)
+	assert.Equal(t, "task-1", resp.Runs[1].TaskID)
+	assert.False(t, resp.Runs[1].StartedAt.IsZero())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/jobs/nightly/runs?limit=1", nil))
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Runs, 1)
+
+	// Recent runs are part of the job status
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var status struct {
+		Jobs []JobStatus `json:"jobs"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	require.Len(t, status.Jobs, 1)
+	assert.Len(t, status.Jobs[0].RecentRuns, 2)
+
+	// History survives a restart
+	restarted := New(cfg, configPath, time.Minute, "test")
+	assert.Len(t, restarted.runs.recent("nightly", 10), 2)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/jobs/missing/runs", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/jobs/nightly/runs?limit=0", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
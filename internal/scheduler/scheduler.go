@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -29,6 +30,10 @@ type Scheduler struct {
 	configReloadInterval time.Duration // How often to check for config changes
 	version              string
 	startTime            time.Time
+	authToken            string // Bearer token for the API and for agents; fixed at startup
+
+	jobsMu sync.Mutex // Serializes changes made through the jobs API
+	runs   *runStore  // Job run history
 
 	mu       sync.RWMutex
 	server   *http.Server
@@ -44,11 +49,17 @@ type jobState struct {
 	mu          sync.RWMutex
 	NextRun     time.Time
 	LastRun     time.Time
-	LastStatus  string // "queued", "submitted", "skipped_queue_full", "skipped_busy", "skipped_error"
-	LastError   string // Last error message (for debugging failed submissions)
-	LastTaskID  string // Agent task ID (for direct submission)
-	LastQueueID string // Queue ID (for queue submission)
-	isRunning   bool   // prevents double-invocation if job execution takes >1s
+	LastStatus  string    // "queued", "submitted", "skipped_queue_full", "skipped_busy", "skipped_error"
+	LastError   string    // Last error message (for debugging failed submissions)
+	LastTaskID  string    // Agent task ID (for direct submission)
+	LastQueueID string    // Queue ID (for queue submission)
+	isRunning   bool      // prevents double-invocation if job execution takes >1s
+	slot        time.Time // Scheduled time of the run being started by the job loop (zero for manual and catch-up runs)
+	failures    int       // Consecutive failed runs; see suspended
+
+	LastAgentURL string       // Agent that took the last direct submission
+	lastTasks    []FanOutTask // Each agent's outcome of the last fan_out: all run
+	nextAgent    int          // Where a round_robin job starts trying its agents
 }
 
 // JobStatus represents a job in the status response
@@ -59,12 +70,75 @@ type JobStatus struct {
 	Timeout     string     `json:"timeout"`
 	AgentKind   string     `json:"agent_kind"`
 	AgentURL    string     `json:"agent_url,omitempty"`
+	CatchUp     string     `json:"catch_up"`
+	Jitter      string     `json:"jitter,omitempty"`
+	Overlap     string     `json:"overlap"`
+	Managed     bool       `json:"managed,omitempty"` // Created through the jobs API; editable and deletable
 	NextRun     time.Time  `json:"next_run"`
 	LastRun     *time.Time `json:"last_run,omitempty"`
 	LastStatus  string     `json:"last_status,omitempty"`
 	LastTaskID  string     `json:"last_task_id,omitempty"`
 	LastQueueID string     `json:"last_queue_id,omitempty"`
 	LastError   string     `json:"last_error,omitempty"`
+	RecentRuns  []JobRun   `json:"recent_runs,omitempty"` // Newest first
+
+	AgentURLs    []string `json:"agent_urls,omitempty"` // For jobs with several agents
+	FanOut       string   `json:"fan_out,omitempty"`
+	LastAgentURL string   `json:"last_agent_url,omitempty"`
+
+	SuspendAfter        int  `json:"suspend_after,omitempty"`
+	ConsecutiveFailures int  `json:"consecutive_failures,omitempty"`
+	Suspended           bool `json:"suspended,omitempty"` // Not run until resumed through POST /jobs/{job}/resume
+}
+
+// status reports a job's definition, run state and recent runs, resolving
+// defaults from config.
+func (js *jobState) status(config *Config, runs *runStore) JobStatus {
+	status := js.currentStatus(config)
+	status.RecentRuns = runs.recent(status.Name, StatusRecentRuns)
+	return status
+}
+
+func (js *jobState) currentStatus(config *Config) JobStatus {
+	js.mu.RLock()
+	defer js.mu.RUnlock()
+
+	status := JobStatus{
+		Name:        js.Job.Name,
+		Schedule:    js.Job.Schedule,
+		Tier:        config.GetTier(js.Job),
+		Timeout:     config.GetTimeout(js.Job).String(),
+		AgentKind:   config.GetAgentKind(js.Job),
+		CatchUp:     config.GetCatchUp(js.Job),
+		Overlap:     config.GetOverlap(js.Job),
+		Managed:     js.Job.Managed,
+		NextRun:     js.NextRun,
+		LastStatus:  js.LastStatus,
+		LastError:   js.LastError,
+		LastTaskID:  js.LastTaskID,
+		LastQueueID: js.LastQueueID,
+
+		AgentURLs:    js.Job.AgentURLs,
+		LastAgentURL: js.LastAgentURL,
+
+		SuspendAfter:        js.Job.SuspendAfter,
+		ConsecutiveFailures: js.failures,
+		Suspended:           js.suspended(),
+	}
+	if agentURL := config.GetAgentURL(js.Job); agentURL != config.AgentURL {
+		status.AgentURL = agentURL
+	}
+	if js.Job.Jitter > 0 {
+		status.Jitter = js.Job.Jitter.String()
+	}
+	if len(js.Job.AgentURLs) > 0 {
+		status.FanOut = config.GetFanOut(js.Job)
+	}
+	if !js.LastRun.IsZero() {
+		lastRun := js.LastRun
+		status.LastRun = &lastRun
+	}
+	return status
 }
 
 // New creates a new scheduler
@@ -78,6 +152,8 @@ func New(config *Config, configPath string, configReloadInterval time.Duration,
 		configReloadInterval: configReloadInterval,
 		version:              version,
 		startTime:            time.Now(),
+		authToken:            config.AuthToken,
+		runs:                 newRunStore(config.RunsDir),
 		stopChan:             make(chan struct{}),
 	}
 }
@@ -91,8 +167,8 @@ func (s *Scheduler) Start() error {
 	}
 
 	// Initialize config modification time for hot-reload
-	if fileInfo, err := os.Stat(s.configPath); err == nil {
-		s.configModTime = fileInfo.ModTime()
+	if modTime, err := configModTime(s.configPath); err == nil {
+		s.configModTime = modTime
 	}
 
 	// Initialize job states
@@ -101,22 +177,17 @@ func (s *Scheduler) Start() error {
 	for i := range s.config.Jobs {
 		job := &s.config.Jobs[i]
 		cron, _ := ParseCron(job.Schedule) // Already validated
-		nextRun := cron.Next(now)
-		if nextRun.IsZero() {
-			// Defensive: if Next() can't find a match, skip far into the future
-			nextRun = now.Add(24 * time.Hour)
-		}
+		nextRun := nextRunAfter(job, cron, now)
 		s.jobs[i] = &jobState{
 			Job:     job,
 			Cron:    cron,
 			NextRun: nextRun,
 		}
 	}
+	catchUps := s.restoreRuns(now)
+
 	// Start HTTP server
-	router := chi.NewRouter()
-	router.Get("/status", s.handleStatus)
-	router.Post("/shutdown", s.handleShutdown)
-	router.Post("/trigger/{job}", s.handleTrigger)
+	router := s.Router()
 
 	// Setup TLS certificates
 	certDir := filepath.Join(os.TempDir(), "agency", "scheduler-certs")
@@ -142,6 +213,7 @@ func (s *Scheduler) Start() error {
 	s.mu.Unlock()
 
 	// Start job runner
+	go s.runCatchUps(catchUps)
 	go s.runJobs()
 
 	// Start config watcher
@@ -160,6 +232,35 @@ func (s *Scheduler) Start() error {
 	return nil
 }
 
+// Router returns the scheduler's HTTP routes.
+func (s *Scheduler) Router() chi.Router {
+	router := chi.NewRouter()
+	router.Use(api.RequireAuthToken(s.authToken))
+	router.Get("/status", s.handleStatus)
+	router.Get("/healthz", api.HandleHealthz)
+	router.Get("/readyz", api.ReadyzHandler(api.ReadinessCheck{Name: "running", Check: s.checkRunning}))
+	router.Post("/shutdown", s.handleShutdown)
+	router.Post("/trigger/{job}", s.handleTrigger)
+	router.Post("/jobs/{job}/dry-run", s.handleDryRun)
+	router.Post("/jobs/{job}/resume", s.handleResume)
+	router.Post("/jobs", s.handleCreateJob)
+	router.Put("/jobs/{job}", s.handleUpdateJob)
+	router.Delete("/jobs/{job}", s.handleDeleteJob)
+	router.Get("/jobs/{job}/runs", s.handleJobRuns)
+	return router
+}
+
+// checkRunning is the scheduler's readiness check: jobs are only triggered
+// between Start and Shutdown.
+func (s *Scheduler) checkRunning() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.running {
+		return errors.New("scheduler is not running")
+	}
+	return nil
+}
+
 // Shutdown gracefully shuts down the scheduler
 func (s *Scheduler) Shutdown(ctx context.Context) error {
 	s.mu.Lock()
@@ -211,13 +312,12 @@ func (s *Scheduler) watchConfig() {
 // checkAndReloadConfig checks if config file has changed and reloads it
 func (s *Scheduler) checkAndReloadConfig() {
 	// Check modification time (no lock needed, read-only operation)
-	fileInfo, err := os.Stat(s.configPath)
+	modTime, err := configModTime(s.configPath)
 	if err != nil {
 		log.Printf("config_reload action=check_failed error=%q", err)
 		return
 	}
 
-	modTime := fileInfo.ModTime()
 	s.mu.RLock()
 	lastModTime := s.configModTime
 	s.mu.RUnlock()
@@ -283,23 +383,16 @@ func (s *Scheduler) applyConfig(newConfig *Config, modTime time.Time) {
 			oldState.Job = job   // Use new definition (prompt, timeout, tier, etc.)
 			oldState.Cron = cron // Use new schedule
 			if !wasRunning {
-				nextRun := cron.Next(now) // Recalculate if not running
-				if nextRun.IsZero() {
-					// Defensive: if Next() can't find a match, skip far into the future
-					nextRun = now.Add(24 * time.Hour)
-				}
+				nextRun := nextRunAfter(job, cron, now) // Recalculate if not running
 				oldState.NextRun = nextRun
 			}
-			// Keep: LastRun, LastStatus, LastTaskID, LastQueueID, isRunning
+			// Keep: LastRun, LastStatus, LastTaskID, LastQueueID, isRunning, failures
 			oldState.mu.Unlock()
 			newJobs[i] = oldState
 			preserved++
 		} else {
 			// New job - initialize fresh
-			nextRun := cron.Next(now)
-			if nextRun.IsZero() {
-				nextRun = now.Add(24 * time.Hour)
-			}
+			nextRun := nextRunAfter(job, cron, now)
 			newJobs[i] = &jobState{
 				Job:     job,
 				Cron:    cron,
@@ -327,8 +420,9 @@ func (s *Scheduler) checkAndRunJobs(now time.Time) {
 		js.mu.Lock()
 		nextRun := js.NextRun
 		running := js.isRunning
-		if !running && (now.After(nextRun) || now.Equal(nextRun)) {
+		if !running && !js.suspended() && (now.After(nextRun) || now.Equal(nextRun)) {
 			js.isRunning = true
+			js.slot = nextRun
 			js.mu.Unlock()
 			s.runJob(js)
 		} else {
@@ -340,12 +434,25 @@ func (s *Scheduler) checkAndRunJobs(now time.Time) {
 // runJob executes a single job, trying queue API first then falling back to agent
 func (s *Scheduler) runJob(js *jobState) {
 	log.Printf("job=%s action=triggered", js.Job.Name)
+	js.mu.Lock()
+	slot := js.slot
+	js.slot = time.Time{}
+	js.mu.Unlock()
+	started := time.Now()
+	if !s.resolveOverlap(js, started) {
+		return
+	}
+	// Every task of the run, on the director or agents, shares the run's request ID
+	requestID := api.NewRequestID()
+	defer s.recordRun(js, started, requestID)
 
-	// Try queue API via director first (preferred path)
-	if s.config.DirectorURL != "" {
-		queueID, err := s.submitViaQueue(js)
+	// Try queue API via director first (preferred path). The director can't
+	// target particular agents, so fan_out: all goes straight to them.
+	fanOutAll := s.config.GetFanOut(js.Job) == FanOutAll
+	if s.config.DirectorURL != "" && !fanOutAll {
+		queueID, err := s.submitViaQueue(js, slot, requestID)
 		if err == nil {
-			log.Printf("job=%s action=queued via=director queue_id=%s", js.Job.Name, queueID)
+			log.Printf("job=%s action=queued via=director queue_id=%s request_id=%s", js.Job.Name, queueID, requestID)
 			s.updateJobStateQueue(js, "queued", queueID)
 			return
 		}
@@ -359,39 +466,27 @@ func (s *Scheduler) runJob(js *jobState) {
 	}
 
 	// Fallback to direct agent submission
-	taskID, status, err := s.submitViaAgent(js)
-	if err != nil {
-		log.Printf("job=%s action=skipped reason=%s error=%q", js.Job.Name, status, err)
-		s.updateJobStateError(js, status, "", err.Error())
+	result := s.submitViaAgents(js, requestID)
+	s.updateJobStateAgent(js, result)
+	if result.Err != nil {
+		log.Printf("job=%s action=skipped reason=%s error=%q", js.Job.Name, result.Status, result.Err)
 		return
 	}
 
 	via := "agent"
-	if s.config.DirectorURL != "" {
+	if s.config.DirectorURL != "" && !fanOutAll {
 		via = "agent_fallback"
 	}
-	log.Printf("job=%s action=submitted via=%s task_id=%s", js.Job.Name, via, taskID)
-	s.updateJobState(js, "submitted", taskID)
+	log.Printf("job=%s action=submitted via=%s agent=%s task_id=%s request_id=%s",
+		js.Job.Name, via, result.AgentURL, result.TaskID, requestID)
 }
 
-// submitViaQueue submits a task through the queue API
-func (s *Scheduler) submitViaQueue(js *jobState) (string, error) {
-	tier := s.config.GetTier(js.Job)
-	timeout := s.config.GetTimeout(js.Job)
-	agentKind := s.config.GetAgentKind(js.Job)
-
-	// Build queue request
-	queueReq := map[string]any{
-		"prompt":          js.Job.Prompt,
-		"timeout_seconds": int(timeout.Seconds()),
-		"source":          "scheduler",
-		"source_job":      js.Job.Name,
-		"agent_kind":      agentKind,
-		"tier":            tier,
-	}
-
-	body, _ := json.Marshal(queueReq)
-	client := s.createHTTPClient(s.config.DirectorURL)
+// submitViaQueue submits a task through the queue API. Runs for a scheduled
+// slot carry an idempotency key naming it, so if two schedulers share a
+// director, or a restart fires the slot again, the director queues it once.
+func (s *Scheduler) submitViaQueue(js *jobState, slot time.Time, requestID string) (string, error) {
+	body, _ := json.Marshal(s.config.queueRequest(js.Job, slot))
+	client := api.WithRequestID(s.createHTTPClient(s.config.DirectorURL), requestID)
 
 	resp, err := client.Post(s.config.DirectorURL+"/api/queue/task", "application/json", bytes.NewReader(body))
 	if err != nil {
@@ -405,7 +500,8 @@ func (s *Scheduler) submitViaQueue(js *jobState) (string, error) {
 		return "", fmt.Errorf("queue full (503)")
 	}
 
-	if resp.StatusCode != http.StatusCreated {
+	// 200 means the slot was already queued; report the existing entry
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
 		return "", fmt.Errorf("director returned status %d: %s", resp.StatusCode, string(respBody))
 	}
 
@@ -419,20 +515,10 @@ func (s *Scheduler) submitViaQueue(js *jobState) (string, error) {
 	return queueResp.QueueID, nil
 }
 
-// submitViaAgent submits a task directly to the agent (fallback path)
-func (s *Scheduler) submitViaAgent(js *jobState) (taskID string, status string, err error) {
-	agentURL := s.config.GetAgentURL(js.Job)
-	tier := s.config.GetTier(js.Job)
-	timeout := s.config.GetTimeout(js.Job)
-
-	taskReq := map[string]any{
-		"prompt":          js.Job.Prompt,
-		"timeout_seconds": int(timeout.Seconds()),
-		"tier":            tier,
-	}
-
-	body, _ := json.Marshal(taskReq)
-	client := s.createHTTPClient(agentURL)
+// submitToAgent submits a task directly to one agent (fallback path)
+func (s *Scheduler) submitToAgent(job *Job, agentURL, requestID string) (taskID string, status string, err error) {
+	body, _ := json.Marshal(s.config.agentRequest(job))
+	client := api.WithRequestID(s.createHTTPClient(agentURL), requestID)
 
 	resp, err := client.Post(agentURL+"/task", "application/json", bytes.NewReader(body))
 	if err != nil {
@@ -461,45 +547,64 @@ func (s *Scheduler) submitViaAgent(js *jobState) (taskID string, status string,
 	return taskResp.TaskID, "submitted", nil
 }
 
-// createHTTPClient creates an HTTP client, with TLS skip verification for localhost HTTPS
-func (s *Scheduler) createHTTPClient(targetURL string) *http.Client {
-	return tlsutil.NewHTTPClient(30*time.Second, targetURL)
+// queueRequest is the body POSTed to the director's /api/queue/task to run
+// job for slot (zero for manual and catch-up runs).
+func (c *Config) queueRequest(job *Job, slot time.Time) map[string]any {
+	req := map[string]any{
+		"prompt":          job.Prompt,
+		"timeout_seconds": int(c.GetTimeout(job).Seconds()),
+		"source":          "scheduler",
+		"source_job":      job.Name,
+		"agent_kind":      c.GetAgentKind(job),
+		"tier":            c.GetTier(job),
+	}
+	if !slot.IsZero() {
+		req["idempotency_key"] = fmt.Sprintf("scheduler:%s@%s", job.Name, slot.UTC().Format(time.RFC3339))
+	}
+	if len(job.Env) > 0 {
+		req["env"] = job.Env
+	}
+	return req
 }
 
-// updateJobState updates job state after execution (for direct agent submission)
-func (s *Scheduler) updateJobState(js *jobState, status, taskID string) {
-	js.mu.Lock()
-	defer js.mu.Unlock()
-
-	now := time.Now()
-	js.LastRun = now
-	js.LastStatus = status
-	js.LastError = "" // Clear error on success
-	js.LastTaskID = taskID
-	js.LastQueueID = "" // Clear queue ID for direct submissions
-	nextRun := js.Cron.Next(now)
-	if nextRun.IsZero() {
-		// Defensive: if Next() can't find a match, skip far into the future
-		nextRun = now.Add(24 * time.Hour)
+// agentRequest is the body POSTed to the agent's /task when the director
+// is unavailable.
+func (c *Config) agentRequest(job *Job) map[string]any {
+	req := map[string]any{
+		"prompt":          job.Prompt,
+		"timeout_seconds": int(c.GetTimeout(job).Seconds()),
+		"tier":            c.GetTier(job),
 	}
-	js.NextRun = nextRun
-	js.isRunning = false
+	if len(job.Env) > 0 {
+		req["env"] = job.Env
+	}
+	return req
 }
 
-func (s *Scheduler) updateJobStateError(js *jobState, status, taskID, errMsg string) {
+// createHTTPClient creates an HTTP client, with TLS skip verification for
+// localhost HTTPS, that sends the scheduler's auth token
+func (s *Scheduler) createHTTPClient(targetURL string) *http.Client {
+	return api.WithAuthToken(tlsutil.NewHTTPClient(30*time.Second, targetURL), s.authToken)
+}
+
+// updateJobState updates job state after execution (for direct agent submission)
+// updateJobStateAgent updates job state after direct agent submission
+func (s *Scheduler) updateJobStateAgent(js *jobState, result agentSubmission) {
 	js.mu.Lock()
 	defer js.mu.Unlock()
 
 	now := time.Now()
 	js.LastRun = now
-	js.LastStatus = status
-	js.LastError = errMsg
-	js.LastTaskID = taskID
-	js.LastQueueID = ""
-	nextRun := js.Cron.Next(now)
-	if nextRun.IsZero() {
-		nextRun = now.Add(24 * time.Hour)
+	js.LastStatus = result.Status
+	js.LastError = "" // Clear error on success
+	if result.Err != nil {
+		js.LastError = result.Err.Error()
 	}
+	js.LastTaskID = result.TaskID
+	js.LastAgentURL = result.AgentURL
+	js.lastTasks = result.Tasks
+	js.LastQueueID = "" // Clear queue ID for direct submissions
+	nextRun := nextRunAfter(js.Job, js.Cron, now)
 	js.NextRun = nextRun
 	js.isRunning = false
 }
@@ -514,12 +619,10 @@ func (s *Scheduler) updateJobStateQueue(js *jobState, status, queueID string) {
 	js.LastStatus = status
 	js.LastError = ""  // Clear error on success
 	js.LastTaskID = "" // Clear task ID for queue submissions
+	js.LastAgentURL = ""
+	js.lastTasks = nil
 	js.LastQueueID = queueID
-	nextRun := js.Cron.Next(now)
-	if nextRun.IsZero() {
-		// Defensive: if Next() can't find a match, skip far into the future
-		nextRun = now.Add(24 * time.Hour)
-	}
+	nextRun := nextRunAfter(js.Job, js.Cron, now)
 	js.NextRun = nextRun
 	js.isRunning = false
 }
@@ -533,11 +636,10 @@ func (s *Scheduler) updateJobStateQueueError(js *jobState, status, queueID, errM
 	js.LastStatus = status
 	js.LastError = errMsg
 	js.LastTaskID = ""
+	js.LastAgentURL = ""
+	js.lastTasks = nil
 	js.LastQueueID = queueID
-	nextRun := js.Cron.Next(now)
-	if nextRun.IsZero() {
-		nextRun = now.Add(24 * time.Hour)
-	}
+	nextRun := nextRunAfter(js.Job, js.Cron, now)
 	js.NextRun = nextRun
 	js.isRunning = false
 }
@@ -551,28 +653,7 @@ func (s *Scheduler) handleStatus(w http.ResponseWriter, r *http.Request) {
 
 	jobStatuses := make([]JobStatus, len(jobs))
 	for i, js := range jobs {
-		js.mu.RLock()
-		status := JobStatus{
-			Name:        js.Job.Name,
-			Schedule:    js.Job.Schedule,
-			Tier:        config.GetTier(js.Job),
-			Timeout:     config.GetTimeout(js.Job).String(),
-			AgentKind:   config.GetAgentKind(js.Job),
-			NextRun:     js.NextRun,
-			LastStatus:  js.LastStatus,
-			LastError:   js.LastError,
-			LastTaskID:  js.LastTaskID,
-			LastQueueID: js.LastQueueID,
-		}
-		if agentURL := config.GetAgentURL(js.Job); agentURL != config.AgentURL {
-			status.AgentURL = agentURL
-		}
-		if !js.LastRun.IsZero() {
-			lastRun := js.LastRun
-			status.LastRun = &lastRun
-		}
-		jobStatuses[i] = status
-		js.mu.RUnlock()
+		jobStatuses[i] = js.status(config, s.runs)
 	}
 
 	configInfo := map[string]any{
@@ -592,6 +673,8 @@ func (s *Scheduler) handleStatus(w http.ResponseWriter, r *http.Request) {
 		"uptime_seconds": time.Since(s.startTime).Seconds(),
 		"config":         configInfo,
 		"jobs":           jobStatuses,
+		"api_version":    api.APIVersion,
+		"capabilities":   []string{api.CapabilityRequestID},
 	}
 
 	api.WriteJSON(w, http.StatusOK, resp)
@@ -643,6 +726,14 @@ func (s *Scheduler) handleTrigger(w http.ResponseWriter, r *http.Request) {
 
 	// Check if already running
 	target.mu.Lock()
+	if target.suspended() {
+		target.mu.Unlock()
+		api.WriteJSON(w, http.StatusConflict, map[string]string{
+			"error": api.ErrorJobSuspended,
+			"name":  jobName,
+		})
+		return
+	}
 	if target.isRunning {
 		target.mu.Unlock()
 		api.WriteJSON(w, http.StatusConflict, map[string]string{
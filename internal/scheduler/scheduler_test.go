@@ -6,12 +6,14 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/api"
 )
 
 func TestParseCron(t *testing.T) {
@@ -177,6 +179,24 @@ jobs:
 	assert.Equal(t, time.Hour, cfg.Jobs[0].Timeout)
 }
 
+func TestConfigEnvOverrides(t *testing.T) {
+	t.Setenv("AGENCY_SCHEDULER_DIRECTOR_URL", "https://director:8443")
+	t.Setenv("AGENCY_SCHEDULER_PORT", "9200")
+	t.Setenv("AGENCY_PORT", "9300") // Agents' prefix; not the scheduler's
+
+	cfg, err := Parse([]byte(`
+port: 9100
+jobs:
+  - name: test-job
+    schedule: "0 1 * * *"
+    prompt: "Test prompt"
+`))
+	require.NoError(t, err)
+	assert.Equal(t, 9200, cfg.Port)
+	assert.Equal(t, "https://director:8443", cfg.DirectorURL)
+	assert.Len(t, cfg.Jobs, 1)
+}
+
 func TestConfigValidation(t *testing.T) {
 	t.Parallel()
 
@@ -253,6 +273,30 @@ jobs:
 `,
 			wantErr: "prompt is required",
 		},
+		{
+			name: "invalid env name",
+			yaml: `
+jobs:
+  - name: test
+    schedule: "0 1 * * *"
+    prompt: "test"
+    env:
+      REPO-TOKEN: "secret:repo_token"
+`,
+			wantErr: "env name \"REPO-TOKEN\"",
+		},
+		{
+			name: "empty secret reference",
+			yaml: `
+jobs:
+  - name: test
+    schedule: "0 1 * * *"
+    prompt: "test"
+    env:
+      REPO_TOKEN: "secret:"
+`,
+			wantErr: "env REPO_TOKEN names no secret",
+		},
 	}
 
 	for _, tt := range tests {
@@ -357,6 +401,8 @@ func TestSchedulerStatus(t *testing.T) {
 	assert.Equal(t, "helper", resp["type"])
 	assert.Equal(t, "test-version", resp["version"])
 	assert.Equal(t, "running", resp["state"])
+	assert.EqualValues(t, api.APIVersion, resp["api_version"])
+	assert.Equal(t, []interface{}{api.CapabilityRequestID}, resp["capabilities"])
 
 	jobs, ok := resp["jobs"].([]interface{})
 	require.True(t, ok)
@@ -367,6 +413,26 @@ func TestSchedulerStatus(t *testing.T) {
 	assert.Equal(t, "0 1 * * *", job["schedule"])
 }
 
+func TestSchedulerHealthEndpoints(t *testing.T) {
+	t.Parallel()
+
+	s := New(&Config{AuthToken: "secret-token"}, "/tmp/test-config.yaml", 60*time.Second, "test")
+	router := s.Router()
+	get := func(path string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, get("/healthz"))
+	assert.Equal(t, http.StatusServiceUnavailable, get("/readyz"), "not ready before Start")
+
+	s.mu.Lock()
+	s.running = true
+	s.mu.Unlock()
+	assert.Equal(t, http.StatusOK, get("/readyz"))
+}
+
 func TestSchedulerJobSubmission(t *testing.T) {
 	t.Parallel()
 
@@ -431,6 +497,50 @@ func TestSchedulerJobSubmission(t *testing.T) {
 	assert.False(t, js.LastRun.IsZero())
 }
 
+func TestSchedulerAuthToken(t *testing.T) {
+	t.Parallel()
+
+	// Mock agent that requires the token
+	var gotAuth string
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"task_id": "task-123"})
+	}))
+	defer agent.Close()
+
+	cfg := &Config{
+		AgentURL:  agent.URL,
+		AuthToken: "secret-token",
+		Jobs:      []Job{{Name: "test-job", Schedule: "0 1 * * *", Prompt: "Test prompt"}},
+	}
+	s := New(cfg, "/tmp/test-config.yaml", 60*time.Second, "test")
+	cron, _ := ParseCron(cfg.Jobs[0].Schedule)
+	js := &jobState{Job: &cfg.Jobs[0], Cron: cron}
+	s.jobs = []*jobState{js}
+	router := s.Router()
+
+	// Status stays open; triggering needs the token
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/trigger/test-job", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req := httptest.NewRequest("POST", "/trigger/missing-job", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Submissions to the agent carry the token
+	s.runJob(js)
+	assert.Equal(t, "Bearer secret-token", gotAuth)
+	assert.Equal(t, "submitted", js.LastStatus)
+}
+
 func TestSchedulerJobAgentBusy(t *testing.T) {
 	t.Parallel()
 
@@ -716,12 +826,44 @@ func TestSchedulerDirectorRouting(t *testing.T) {
 	assert.Equal(t, float64(3600), receivedReq["timeout_seconds"])
 	assert.Equal(t, "scheduler", receivedReq["source"])
 	assert.Equal(t, "test-job", receivedReq["source_job"])
+	assert.NotContains(t, receivedReq, "idempotency_key", "Runs outside the job loop have no slot to key on")
+	assert.NotContains(t, receivedReq, "env")
 
 	// Verify state
 	assert.Equal(t, "queued", js.LastStatus)
 	assert.Equal(t, "queue-123", js.LastQueueID)
 }
 
+func TestSchedulerSlotIdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	var receivedReq map[string]any
+	director := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&receivedReq)
+		// The slot was already queued, e.g. by another scheduler
+		json.NewEncoder(w).Encode(map[string]any{"queue_id": "queue-existing", "duplicate": true})
+	}))
+	defer director.Close()
+
+	cfg := &Config{
+		DirectorURL: director.URL,
+		AgentURL:    "http://localhost:1",
+		Jobs:        []Job{{Name: "nightly", Schedule: "0 2 * * *", Prompt: "Test prompt"}},
+	}
+	s := New(cfg, "/tmp/test-config.yaml", 60*time.Second, "test")
+	cron, _ := ParseCron(cfg.Jobs[0].Schedule)
+	slot := time.Date(2026, 3, 10, 2, 0, 0, 0, time.UTC)
+	js := &jobState{Job: &cfg.Jobs[0], Cron: cron, NextRun: slot}
+	s.jobs = []*jobState{js}
+
+	s.checkAndRunJobs(slot)
+
+	assert.Equal(t, "scheduler:nightly@2026-03-10T02:00:00Z", receivedReq["idempotency_key"])
+	assert.Equal(t, "queued", js.LastStatus)
+	assert.Equal(t, "queue-existing", js.LastQueueID)
+	assert.True(t, js.slot.IsZero())
+}
+
 func TestSchedulerQueueFull(t *testing.T) {
 	t.Parallel()
 
@@ -771,6 +913,33 @@ func TestSchedulerQueueFull(t *testing.T) {
 	assert.Equal(t, "skipped_queue_full", js.LastStatus)
 }
 
+func TestSchedulerSendsRequestID(t *testing.T) {
+	t.Parallel()
+
+	var gotRequestID string
+	director := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRequestID = r.Header.Get(api.RequestIDHeader)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"queue_id": "queue-1"})
+	}))
+	defer director.Close()
+
+	cfg := &Config{
+		DirectorURL: director.URL,
+		AgentURL:    "http://localhost:1",
+		Jobs:        []Job{{Name: "nightly", Schedule: "0 1 * * *", Prompt: "Test prompt"}},
+	}
+	s := New(cfg, "/tmp/test-config.yaml", 60*time.Second, "test")
+	cron, _ := ParseCron(cfg.Jobs[0].Schedule)
+	js := &jobState{Job: &cfg.Jobs[0], Cron: cron}
+	s.jobs = []*jobState{js}
+
+	s.runJob(js)
+
+	require.True(t, api.ValidRequestID(gotRequestID))
+	require.Equal(t, gotRequestID, s.runs.recent("nightly", 1)[0].RequestID)
+}
+
 func TestSchedulerDirectorUnavailable(t *testing.T) {
 	t.Parallel()
 
@@ -1025,13 +1194,10 @@ func TestSchedulerStatusWithDirectorURL(t *testing.T) {
 // Helper function to create a temporary config file for testing
 func createTempConfig(t *testing.T, yamlContent string) string {
 	t.Helper()
-	tmpFile, err := os.CreateTemp("", "scheduler-config-*.yaml")
-	require.NoError(t, err)
-	_, err = tmpFile.WriteString(yamlContent)
-	require.NoError(t, err)
-	tmpFile.Close()
-	t.Cleanup(func() { os.Remove(tmpFile.Name()) })
-	return tmpFile.Name()
+	// Use a private directory so each config gets its own jobs.d
+	path := filepath.Join(t.TempDir(), "scheduler.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(yamlContent), 0644))
+	return path
 }
 
 // Helper function to update file mtime (touch)
@@ -1345,3 +1511,44 @@ jobs:
 	js.mu.RUnlock()
 	s.mu.RUnlock()
 }
+
+func TestSchedulerJobEnv(t *testing.T) {
+	t.Parallel()
+
+	var queueReq, agentReq map[string]any
+	director := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&queueReq)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer director.Close()
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&agentReq)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"task_id": "task-1"})
+	}))
+	defer agent.Close()
+
+	cfg, err := Parse([]byte(`
+jobs:
+  - name: nightly
+    schedule: "0 1 * * *"
+    prompt: "Test prompt"
+    env:
+      REPO_TOKEN: "secret:repo_token"
+      LOG_LEVEL: debug
+`))
+	require.NoError(t, err)
+	cfg.AgentURL = agent.URL
+	s := New(cfg, "/tmp/test-config.yaml", 60*time.Second, "test")
+	cron, _ := ParseCron(cfg.Jobs[0].Schedule)
+
+	// The secret reference is passed through for the agent to resolve
+	want := map[string]any{"REPO_TOKEN": "secret:repo_token", "LOG_LEVEL": "debug"}
+	cfg.DirectorURL = director.URL
+	s.runJob(&jobState{Job: &cfg.Jobs[0], Cron: cron})
+	assert.Equal(t, want, queueReq["env"])
+
+	cfg.DirectorURL = ""
+	s.runJob(&jobState{Job: &cfg.Jobs[0], Cron: cron})
+	assert.Equal(t, want, agentReq["env"])
+}
@@ -0,0 +1,99 @@
+package scheduler
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"phobos.org.uk/agency/internal/api"
+)
+
+// Run states that count towards, or reset, a job's consecutive failures.
+// The scheduler doesn't follow tasks, so a failure is a run whose
+// submission failed; busy, queue-full and overlap skips count neither way.
+const (
+	runStateFailed  = "skipped_error"
+	runStateResumed = "resumed" // Recorded when a suspended job is resumed
+)
+
+// suspended reports whether the job has failed SuspendAfter times in a row
+// and must be resumed before it runs again. Caller holds js.mu.
+func (js *jobState) suspended() bool {
+	return js.Job.SuspendAfter > 0 && js.failures >= js.Job.SuspendAfter
+}
+
+// failureStreak counts the failed runs since the last successful submission
+// or resume, given runs newest first.
+func failureStreak(runs []JobRun) int {
+	streak := 0
+	for _, run := range runs {
+		switch run.State {
+		case runStateFailed:
+			streak++
+		case "queued", "submitted", runStateResumed:
+			return streak
+		}
+	}
+	return streak
+}
+
+// countFailure updates the job's consecutive failures after a run, logging
+// when the job becomes suspended.
+func (s *Scheduler) countFailure(js *jobState, state string) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	switch state {
+	case runStateFailed:
+		js.failures++
+		if js.Job.SuspendAfter > 0 && js.failures == js.Job.SuspendAfter {
+			log.Printf("job=%s action=suspended failures=%d", js.Job.Name, js.failures)
+		}
+	case "queued", "submitted":
+		js.failures = 0
+	}
+}
+
+// handleResume re-enables a suspended job. The resume is recorded in the
+// job's run history so the suspension stays cleared across restarts.
+func (s *Scheduler) handleResume(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "job")
+
+	s.mu.RLock()
+	var target *jobState
+	for _, js := range s.jobs {
+		if js.Job.Name == name {
+			target = js
+			break
+		}
+	}
+	s.mu.RUnlock()
+
+	if target == nil {
+		api.WriteJSON(w, http.StatusNotFound, map[string]string{
+			"error": api.ErrorJobNotFound,
+			"name":  name,
+		})
+		return
+	}
+
+	now := time.Now()
+	target.mu.Lock()
+	if !target.suspended() {
+		target.mu.Unlock()
+		api.WriteJSON(w, http.StatusConflict, map[string]string{
+			"error": api.ErrorJobNotSuspended,
+			"name":  name,
+		})
+		return
+	}
+	failures := target.failures
+	target.failures = 0
+	target.NextRun = nextRunAfter(target.Job, target.Cron, now)
+	target.mu.Unlock()
+
+	s.runs.record(name, JobRun{StartedAt: now, State: runStateResumed})
+	log.Printf("job=%s action=resumed failures=%d", name, failures)
+	s.writeJobResult(w, http.StatusOK, name)
+}
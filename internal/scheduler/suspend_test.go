@@ -0,0 +1,106 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/api"
+)
+
+func TestFailureStreak(t *testing.T) {
+	t.Parallel()
+
+	run := func(state string) JobRun { return JobRun{State: state} }
+	tests := []struct {
+		name string
+		runs []JobRun // Newest first
+		want int
+	}{
+		{"no runs", nil, 0},
+		{"all failed", []JobRun{run("skipped_error"), run("skipped_error")}, 2},
+		{"since success", []JobRun{run("skipped_error"), run("queued"), run("skipped_error")}, 1},
+		{"busy skips don't count", []JobRun{run("skipped_error"), run("skipped_busy"), run("skipped_error")}, 2},
+		{"since resume", []JobRun{run("skipped_error"), run("resumed"), run("skipped_error"), run("skipped_error")}, 1},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, failureStreak(tt.runs), tt.name)
+	}
+}
+
+func TestJobSuspension(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer agent.Close()
+
+	cfg := &Config{
+		Port:     DefaultPort,
+		Bind:     DefaultBind,
+		AgentURL: agent.URL,
+		RunsDir:  t.TempDir(),
+		Jobs:     []Job{{Name: "flaky", Schedule: "* * * * *", Prompt: "x", SuspendAfter: 2}},
+	}
+	require.NoError(t, cfg.Validate())
+	s := New(cfg, "", time.Minute, "test")
+	s.applyConfig(cfg, time.Now())
+	js := s.jobs[0]
+
+	s.runJob(js)
+	s.runJob(js)
+	status := js.currentStatus(cfg)
+	assert.True(t, status.Suspended)
+	assert.Equal(t, 2, status.ConsecutiveFailures)
+
+	// Suspended jobs are neither scheduled nor triggered
+	s.checkAndRunJobs(time.Now().Add(time.Hour))
+	assert.EqualValues(t, 2, calls.Load())
+	w := doJobRequest(t, s, http.MethodPost, "/trigger/flaky", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), api.ErrorJobSuspended)
+
+	// The suspension survives a restart
+	restarted := New(cfg, "", time.Minute, "test")
+	restarted.applyConfig(cfg, time.Now())
+	assert.Empty(t, restarted.restoreRuns(time.Now().Add(time.Hour)), "suspended jobs owe no catch-up runs")
+	assert.True(t, restarted.jobs[0].currentStatus(cfg).Suspended)
+	assert.Equal(t, "skipped_error", restarted.jobs[0].LastStatus)
+
+	// Resume
+	w = doJobRequest(t, s, http.MethodPost, "/jobs/flaky/resume", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resumed JobStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resumed))
+	assert.False(t, resumed.Suspended)
+	assert.Zero(t, resumed.ConsecutiveFailures)
+	assert.Equal(t, runStateResumed, resumed.RecentRuns[0].State)
+
+	w = doJobRequest(t, s, http.MethodPost, "/jobs/flaky/resume", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = doJobRequest(t, s, http.MethodPost, "/jobs/missing/resume", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	restarted = New(cfg, "", time.Minute, "test")
+	restarted.applyConfig(cfg, time.Now())
+	restarted.restoreRuns(time.Now())
+	assert.False(t, restarted.jobs[0].currentStatus(cfg).Suspended)
+	assert.Equal(t, "skipped_error", restarted.jobs[0].LastStatus, "the resume isn't restored as the last run")
+
+	// A successful submission resets the count
+	s.runJob(js)
+	agent.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"task_id": "task-1"})
+	})
+	s.runJob(js)
+	assert.Zero(t, js.currentStatus(cfg).ConsecutiveFailures)
+}
@@ -0,0 +1,262 @@
+// Package supervisor runs the agency components as managed child processes:
+// it starts them with consistent ports, restarts any that exit, and merges
+// their output into one stream.
+package supervisor
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"phobos.org.uk/agency/internal/api"
+)
+
+// Config is the shared ag-all config file.
+type Config struct {
+	BinDir    string            `yaml:"bin_dir"`    // Directory holding the ag-* binaries (default: beside ag-all)
+	LogDir    string            `yaml:"log_dir"`    // Also write each component's output to <log_dir>/<name>.log (empty = stdout only)
+	AuthToken string            `yaml:"auth_token"` // Bearer token shared by every component (default: AG_AUTH_TOKEN)
+	Env       map[string]string `yaml:"env"`        // Extra environment for every component
+	Web       WebConfig         `yaml:"web"`
+	Agents    []AgentConfig     `yaml:"agents"` // Default: one claude agent
+	Scheduler SchedulerConfig   `yaml:"scheduler"`
+	Restart   RestartConfig     `yaml:"restart"`
+}
+
+// WebConfig configures the web view.
+type WebConfig struct {
+	Port         int      `yaml:"port"`          // Default: 8443
+	InternalPort int      `yaml:"internal_port"` // Localhost API for the scheduler and CLI (default: 8080)
+	Args         []string `yaml:"args"`          // Extra ag-view-web flags
+}
+
+// AgentConfig configures one agent.
+type AgentConfig struct {
+	Kind   string   `yaml:"kind"`   // claude or codex
+	Port   int      `yaml:"port"`   // Default: 9000 for the first agent, 9001 for the second, ...
+	Config string   `yaml:"config"` // Agent config file (empty = defaults)
+	Args   []string `yaml:"args"`   // Extra agent flags
+}
+
+// SchedulerConfig configures the scheduler.
+type SchedulerConfig struct {
+	Config string   `yaml:"config"` // Scheduler config file (empty = no scheduler)
+	Port   int      `yaml:"port"`   // Default: 9010
+	Args   []string `yaml:"args"`   // Extra ag-scheduler flags
+}
+
+// RestartConfig controls how crashed components are restarted.
+type RestartConfig struct {
+	Backoff    time.Duration `yaml:"backoff"`     // Delay before the first restart, doubling after each crash (default: 1s)
+	MaxBackoff time.Duration `yaml:"max_backoff"` // Longest delay between restarts (default: 1m)
+}
+
+// Defaults
+const (
+	DefaultWebPort           = 8443
+	DefaultWebInternalPort   = 8080
+	DefaultAgentPort         = 9000
+	DefaultSchedulerPort     = 9010
+	DefaultRestartBackoff    = time.Second
+	DefaultRestartMaxBackoff = time.Minute
+)
+
+// Load reads a config file. Relative paths in it are resolved against the
+// file's directory.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(path)
+	for _, p := range []*string{&cfg.BinDir, &cfg.LogDir, &cfg.Scheduler.Config} {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+	for i := range cfg.Agents {
+		if p := cfg.Agents[i].Config; p != "" && !filepath.IsAbs(p) {
+			cfg.Agents[i].Config = filepath.Join(dir, p)
+		}
+	}
+	return cfg, nil
+}
+
+// Parse parses config data, applies defaults and validates the result.
+func Parse(data []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parsing config: %w", err)
+	}
+	cfg.applyDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Default returns the config used without a config file: the web view and
+// one claude agent.
+func Default() *Config {
+	cfg := &Config{}
+	cfg.applyDefaults()
+	return cfg
+}
+
+func (c *Config) applyDefaults() {
+	if c.Web.Port == 0 {
+		c.Web.Port = DefaultWebPort
+	}
+	if c.Web.InternalPort == 0 {
+		c.Web.InternalPort = DefaultWebInternalPort
+	}
+	if len(c.Agents) == 0 {
+		c.Agents = []AgentConfig{{Kind: api.AgentKindClaude}}
+	}
+	for i := range c.Agents {
+		if c.Agents[i].Port == 0 {
+			c.Agents[i].Port = DefaultAgentPort + i
+		}
+	}
+	if c.Scheduler.Port == 0 {
+		c.Scheduler.Port = DefaultSchedulerPort
+	}
+	if c.Restart.Backoff == 0 {
+		c.Restart.Backoff = DefaultRestartBackoff
+	}
+	if c.Restart.MaxBackoff == 0 {
+		c.Restart.MaxBackoff = DefaultRestartMaxBackoff
+	}
+	if c.AuthToken == "" {
+		c.AuthToken = os.Getenv(api.AuthTokenEnv)
+	}
+}
+
+// Validate checks the config for errors.
+func (c *Config) Validate() error {
+	ports := map[int]string{}
+	claim := func(port int, name string) error {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("%s port must be between 1 and 65535, got %d", name, port)
+		}
+		if other, ok := ports[port]; ok {
+			return fmt.Errorf("%s and %s both use port %d", other, name, port)
+		}
+		ports[port] = name
+		return nil
+	}
+
+	if err := claim(c.Web.Port, "web"); err != nil {
+		return err
+	}
+	if err := claim(c.Web.InternalPort, "web internal"); err != nil {
+		return err
+	}
+	for _, a := range c.Agents {
+		if !api.IsValidAgentKind(a.Kind) {
+			return fmt.Errorf("agent kind must be claude or codex, got %q", a.Kind)
+		}
+		if err := claim(a.Port, "agent "+a.Kind); err != nil {
+			return err
+		}
+	}
+	if c.Scheduler.Config != "" {
+		if err := claim(c.Scheduler.Port, "scheduler"); err != nil {
+			return err
+		}
+	}
+
+	// The web view discovers components by scanning a port range, so keep
+	// it from covering its own ports
+	start, end := c.DiscoveryRange()
+	for _, port := range []int{c.Web.Port, c.Web.InternalPort} {
+		if port >= start && port <= end {
+			return fmt.Errorf("web ports must be outside the agent and scheduler port range %d-%d, got %d", start, end, port)
+		}
+	}
+
+	for name := range c.Env {
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			return fmt.Errorf("env has an invalid variable name %q", name)
+		}
+	}
+	if c.Restart.Backoff < 0 || c.Restart.MaxBackoff < c.Restart.Backoff {
+		return fmt.Errorf("restart.max_backoff must be at least restart.backoff")
+	}
+	return nil
+}
+
+// DiscoveryRange returns the port range the web view scans: every agent
+// and, if configured, the scheduler.
+func (c *Config) DiscoveryRange() (start, end int) {
+	start, end = c.Agents[0].Port, c.Agents[0].Port
+	for _, a := range c.Agents {
+		start, end = min(start, a.Port), max(end, a.Port)
+	}
+	if c.Scheduler.Config != "" {
+		start, end = min(start, c.Scheduler.Port), max(end, c.Scheduler.Port)
+	}
+	return start, end
+}
+
+// DirectorURL is the web view's internal API, which the scheduler should
+// use as its director_url.
+func (c *Config) DirectorURL() string {
+	return "http://127.0.0.1:" + strconv.Itoa(c.Web.InternalPort)
+}
+
+// Children returns the processes to run, web view first.
+func (c *Config) Children() []Child {
+	env := []string{}
+	for _, k := range slices.Sorted(maps.Keys(c.Env)) {
+		env = append(env, k+"="+c.Env[k])
+	}
+	if c.AuthToken != "" {
+		env = append(env, api.AuthTokenEnv+"="+c.AuthToken)
+	}
+	bin := func(name string) string { return filepath.Join(c.BinDir, name) }
+
+	start, end := c.DiscoveryRange()
+	children := []Child{{
+		Name: "web",
+		Path: bin("ag-view-web"),
+		Args: append([]string{
+			"-port", strconv.Itoa(c.Web.Port),
+			"-internal-port", strconv.Itoa(c.Web.InternalPort),
+			"-port-start", strconv.Itoa(start),
+			"-port-end", strconv.Itoa(end),
+		}, c.Web.Args...),
+		Env: env,
+	}}
+	for _, a := range c.Agents {
+		args := []string{"-port", strconv.Itoa(a.Port)}
+		if a.Config != "" {
+			args = append(args, "-config", a.Config)
+		}
+		children = append(children, Child{
+			Name: a.Kind + ":" + strconv.Itoa(a.Port),
+			Path: bin("ag-agent-" + a.Kind),
+			Args: append(args, a.Args...),
+			Env:  env,
+		})
+	}
+	if c.Scheduler.Config != "" {
+		children = append(children, Child{
+			Name: "scheduler",
+			Path: bin("ag-scheduler"),
+			Args: append([]string{"-config", c.Scheduler.Config, "-port", strconv.Itoa(c.Scheduler.Port)}, c.Scheduler.Args...),
+			Env:  env,
+		})
+	}
+	return children
+}
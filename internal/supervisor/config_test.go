@@ -0,0 +1,83 @@
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDefaults(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := Parse([]byte("agents:\n  - kind: claude\n  - kind: codex\n"))
+	require.NoError(t, err)
+	require.Equal(t, DefaultWebPort, cfg.Web.Port)
+	require.Equal(t, 9000, cfg.Agents[0].Port)
+	require.Equal(t, 9001, cfg.Agents[1].Port)
+
+	start, end := cfg.DiscoveryRange()
+	require.Equal(t, []int{9000, 9001}, []int{start, end}, "the scheduler port only counts when it runs")
+	require.Equal(t, "http://127.0.0.1:8080", cfg.DirectorURL())
+
+	require.Len(t, Default().Agents, 1)
+}
+
+func TestParseValidation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"unknown kind", "agents:\n  - kind: gpt\n", "agent kind must be claude or codex"},
+		{"shared port", "agents:\n  - kind: claude\n  - kind: codex\n    port: 9000\n", "agent claude and agent codex both use port 9000"},
+		{"web inside discovery range", "web:\n  port: 9005\nagents:\n  - kind: claude\n    port: 9000\n  - kind: codex\n    port: 9010\n", "web ports must be outside"},
+		{"backoff above max", "restart:\n  backoff: 5m\n", "restart.max_backoff must be at least restart.backoff"},
+		{"bad env name", "env:\n  \"A=B\": x\n", "env has an invalid variable name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := Parse([]byte(tt.yaml))
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestChildren(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agency.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+bin_dir: bin
+auth_token: shared-token
+env:
+  AGENCY_MODE: dev
+agents:
+  - kind: claude
+    config: agent.yaml
+  - kind: codex
+    args: [-bind, 0.0.0.0]
+scheduler:
+  config: scheduler.yaml
+`), 0644))
+	t.Setenv("AG_AUTH_TOKEN", "")
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	children := cfg.Children()
+	require.Len(t, children, 4)
+
+	web := children[0]
+	require.Equal(t, filepath.Join(dir, "bin", "ag-view-web"), web.Path)
+	require.Equal(t, []string{"-port", "8443", "-internal-port", "8080", "-port-start", "9000", "-port-end", "9010"}, web.Args)
+	require.Equal(t, []string{"AGENCY_MODE=dev", "AG_AUTH_TOKEN=shared-token"}, web.Env)
+
+	require.Equal(t, "claude:9000", children[1].Name)
+	require.Equal(t, []string{"-port", "9000", "-config", filepath.Join(dir, "agent.yaml")}, children[1].Args)
+	require.Equal(t, filepath.Join(dir, "bin", "ag-agent-codex"), children[2].Path)
+	require.Equal(t, []string{"-port", "9001", "-bind", "0.0.0.0"}, children[2].Args)
+	require.Equal(t, []string{"-config", filepath.Join(dir, "scheduler.yaml"), "-port", "9010"}, children[3].Args)
+}
@@ -0,0 +1,203 @@
+package supervisor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Supervision timings
+const (
+	stopTimeout = 35 * time.Second // Components allow 30s for graceful shutdown
+	stableAfter = time.Minute      // A child up this long restarts with the initial backoff
+)
+
+// Child is a process run by the supervisor.
+type Child struct {
+	Name string   // Prefix for its output lines, e.g. "web" or "claude:9000"
+	Path string   // Executable
+	Args []string // Arguments, excluding the executable
+	Env  []string // KEY=VALUE pairs added to the supervisor's environment
+}
+
+// Options configures a Supervisor.
+type Options struct {
+	Output     io.Writer     // Merged output of all children (default: os.Stdout)
+	LogDir     string        // Also write each child's output to <LogDir>/<name>.log (empty = disabled)
+	Backoff    time.Duration // Delay before the first restart (default: 1s)
+	MaxBackoff time.Duration // Longest delay between restarts (default: 1m)
+}
+
+// Supervisor runs child processes until its context is cancelled,
+// restarting any that exit with exponential backoff. Each line a child
+// writes is copied to the output prefixed with the child's name.
+type Supervisor struct {
+	children []Child
+	opts     Options
+
+	mu       sync.Mutex // Serializes writes to opts.Output
+	restarts map[string]int
+}
+
+// New creates a supervisor for children.
+func New(children []Child, opts Options) *Supervisor {
+	if opts.Output == nil {
+		opts.Output = os.Stdout
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultRestartBackoff
+	}
+	if opts.MaxBackoff < opts.Backoff {
+		opts.MaxBackoff = max(DefaultRestartMaxBackoff, opts.Backoff)
+	}
+	return &Supervisor{children: children, opts: opts, restarts: make(map[string]int)}
+}
+
+// Run starts every child and keeps them running until ctx is cancelled.
+// Children are then sent SIGTERM, and killed if they haven't exited after
+// 35s. Run returns once all of them have exited.
+func (s *Supervisor) Run(ctx context.Context) error {
+	if s.opts.LogDir != "" {
+		if err := os.MkdirAll(s.opts.LogDir, 0755); err != nil {
+			return fmt.Errorf("creating log directory: %w", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, child := range s.children {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.supervise(ctx, child)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// Restarts returns how many times the child name has been restarted.
+func (s *Supervisor) Restarts(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.restarts[name]
+}
+
+// supervise runs child, restarting it whenever it exits, until ctx is
+// cancelled.
+func (s *Supervisor) supervise(ctx context.Context, child Child) {
+	delay := s.opts.Backoff
+	for {
+		started := time.Now()
+		err := s.runOnce(ctx, child)
+		if ctx.Err() != nil {
+			s.logf("%s stopped", child.Name)
+			return
+		}
+		if time.Since(started) >= stableAfter {
+			delay = s.opts.Backoff
+		}
+		s.logf("%s exited (%v), restarting in %s", child.Name, exitReason(err), delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		s.mu.Lock()
+		s.restarts[child.Name]++
+		s.mu.Unlock()
+		delay = min(delay*2, s.opts.MaxBackoff)
+	}
+}
+
+// exitReason describes how a child exited.
+func exitReason(err error) string {
+	if err == nil {
+		return "exit status 0"
+	}
+	return err.Error()
+}
+
+// runOnce runs child until it exits or ctx is cancelled.
+func (s *Supervisor) runOnce(ctx context.Context, child Child) error {
+	cmd := exec.CommandContext(ctx, child.Path, child.Args...)
+	cmd.Env = append(os.Environ(), child.Env...)
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = stopTimeout
+
+	var logFile *os.File
+	if s.opts.LogDir != "" {
+		name := strings.NewReplacer(":", "-", "/", "-").Replace(child.Name) + ".log"
+		f, err := os.OpenFile(filepath.Join(s.opts.LogDir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("opening log file: %w", err)
+		}
+		defer f.Close()
+		logFile = f
+	}
+	out := &lineWriter{s: s, prefix: child.Name, file: logFile}
+	defer out.Flush()
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	s.logf("starting %s: %s %s", child.Name, child.Path, strings.Join(child.Args, " "))
+	return cmd.Run()
+}
+
+// logf writes a supervisor message to the output.
+func (s *Supervisor) logf(format string, args ...any) {
+	s.writeLine("ag-all", fmt.Sprintf(format, args...))
+}
+
+// writeLine writes one prefixed line to the output.
+func (s *Supervisor) writeLine(prefix, line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.opts.Output, "%-12s | %s\n", prefix, line)
+}
+
+// lineWriter splits a child's output into lines for the merged output,
+// copying it unchanged to the child's log file.
+type lineWriter struct {
+	s      *Supervisor
+	prefix string
+	file   *os.File
+	mu     sync.Mutex
+	buf    []byte // Partial line awaiting its newline
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file != nil {
+		w.file.Write(p)
+	}
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.s.writeLine(w.prefix, strings.TrimSuffix(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes any final unterminated line.
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		w.s.writeLine(w.prefix, string(w.buf))
+		w.buf = nil
+	}
+}
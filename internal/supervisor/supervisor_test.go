@@ -0,0 +1,89 @@
+package supervisor
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSupervisorRestartsCrashedChild(t *testing.T) {
+	t.Parallel()
+
+	logDir := t.TempDir()
+	var out syncBuffer
+	sup := New([]Child{
+		{Name: "crasher", Path: "/bin/sh", Args: []string{"-c", "echo crashing; echo \"token=$AG_TEST\" >&2; exit 3"}, Env: []string{"AG_TEST=shared"}},
+		{Name: "steady", Path: "/bin/sh", Args: []string{"-c", "echo up; exec sleep 60"}},
+	}, Options{Output: &out, LogDir: logDir, Backoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- sup.Run(ctx) }()
+
+	require.Eventually(t, func() bool { return sup.Restarts("crasher") >= 3 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("children were not stopped")
+	}
+
+	// Output is merged line by line with each child's name
+	require.Equal(t, 0, sup.Restarts("steady"), "a running child is left alone")
+	merged := out.String()
+	require.Contains(t, merged, "crasher      | crashing\n")
+	require.Contains(t, merged, "crasher      | token=shared\n")
+	require.Contains(t, merged, "steady       | up\n")
+	require.Contains(t, merged, "crasher exited (exit status 3), restarting in")
+	require.Contains(t, merged, "steady stopped")
+
+	// Each child also gets its own log file
+	data, err := os.ReadFile(filepath.Join(logDir, "crasher.log"))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, strings.Count(string(data), "crashing\n"), 3)
+}
+
+func TestSupervisorBackoff(t *testing.T) {
+	t.Parallel()
+
+	var out syncBuffer
+	sup := New([]Child{{Name: "missing", Path: filepath.Join(t.TempDir(), "nope")}},
+		Options{Output: &out, Backoff: 10 * time.Millisecond, MaxBackoff: 40 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sup.Run(ctx)
+
+	// Delays double up to the maximum
+	require.Eventually(t, func() bool { return sup.Restarts("missing") >= 4 }, 5*time.Second, 10*time.Millisecond)
+	merged := out.String()
+	for _, delay := range []string{"restarting in 10ms", "restarting in 20ms", "restarting in 40ms"} {
+		require.Contains(t, merged, delay)
+	}
+	require.NotContains(t, merged, "restarting in 80ms")
+}
@@ -17,6 +17,9 @@ const (
 	// Used by the work queue for tasks awaiting an available agent.
 	Pending State = "pending"
 
+	// Held indicates a queued task is kept from dispatch until released.
+	Held State = "held"
+
 	// Dispatching indicates a task is being sent to an agent.
 	// Transient state during the handoff from queue to agent.
 	Dispatching State = "dispatching"
@@ -32,6 +35,9 @@ const (
 
 	// Cancelled indicates a task was cancelled by the user.
 	Cancelled State = "cancelled"
+
+	// Expired indicates a queued task passed its deadline before dispatch.
+	Expired State = "expired"
 )
 
 // String returns the string representation of the state.
@@ -42,7 +48,7 @@ func (s State) String() string {
 // IsTerminal returns true if the state is a final state (no further transitions).
 func (s State) IsTerminal() bool {
 	switch s {
-	case Completed, Failed, Cancelled:
+	case Completed, Failed, Cancelled, Expired:
 		return true
 	}
 	return false
@@ -51,7 +57,7 @@ func (s State) IsTerminal() bool {
 // IsActive returns true if the state indicates the task is in progress.
 func (s State) IsActive() bool {
 	switch s {
-	case Queued, Pending, Dispatching, Working:
+	case Queued, Pending, Held, Dispatching, Working:
 		return true
 	}
 	return false
@@ -81,12 +87,14 @@ func (s State) IsDispatched() bool {
 // Each state maps to the set of states it can transition to.
 var ValidTransitions = map[State][]State{
 	Queued:      {Working, Cancelled, Failed},
-	Pending:     {Dispatching, Cancelled, Failed},
+	Pending:     {Dispatching, Held, Cancelled, Failed, Expired},
+	Held:        {Pending, Cancelled, Expired},
 	Dispatching: {Working, Pending, Failed, Cancelled},
 	Working:     {Completed, Failed, Cancelled},
 	Completed:   {}, // Terminal
 	Failed:      {}, // Terminal
 	Cancelled:   {}, // Terminal
+	Expired:     {}, // Terminal
 }
 
 // CanTransition returns true if transitioning from 'from' to 'to' is valid.
@@ -113,12 +121,13 @@ func AllStates() []State {
 		Completed,
 		Failed,
 		Cancelled,
+		Expired,
 	}
 }
 
 // TerminalStates returns all terminal states.
 func TerminalStates() []State {
-	return []State{Completed, Failed, Cancelled}
+	return []State{Completed, Failed, Cancelled, Expired}
 }
 
 // Parse converts a string to a State, returning the state and whether it was valid.
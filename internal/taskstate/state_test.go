@@ -25,6 +25,7 @@ func TestIsTerminal(t *testing.T) {
 		{Completed, true},
 		{Failed, true},
 		{Cancelled, true},
+		{Expired, true},
 	}
 
 	for _, tt := range tests {
@@ -46,6 +47,7 @@ func TestIsActive(t *testing.T) {
 		{Completed, false},
 		{Failed, false},
 		{Cancelled, false},
+		{Expired, false},
 	}
 
 	for _, tt := range tests {
@@ -79,6 +81,7 @@ func TestCanTransition(t *testing.T) {
 	assert.True(t, CanTransition(Working, Completed))
 	assert.True(t, CanTransition(Working, Failed))
 	assert.True(t, CanTransition(Working, Cancelled))
+	assert.True(t, CanTransition(Pending, Expired))
 
 	// Invalid transitions
 	assert.False(t, CanTransition(Completed, Working))
@@ -86,6 +89,7 @@ func TestCanTransition(t *testing.T) {
 	assert.False(t, CanTransition(Cancelled, Working))
 	assert.False(t, CanTransition(Working, Pending)) // Can't go back to pending
 	assert.False(t, CanTransition(Completed, Completed))
+	assert.False(t, CanTransition(Working, Expired)) // Deadlines only apply before dispatch
 }
 
 func TestTerminalStatesCannotTransition(t *testing.T) {
@@ -99,7 +103,7 @@ func TestTerminalStatesCannotTransition(t *testing.T) {
 
 func TestAllStates(t *testing.T) {
 	states := AllStates()
-	require.Len(t, states, 7)
+	require.Len(t, states, 8)
 
 	// Check all expected states are present
 	expected := map[State]bool{
@@ -110,6 +114,7 @@ func TestAllStates(t *testing.T) {
 		Completed:   false,
 		Failed:      false,
 		Cancelled:   false,
+		Expired:     false,
 	}
 	for _, s := range states {
 		expected[s] = true
@@ -121,7 +126,7 @@ func TestAllStates(t *testing.T) {
 
 func TestTerminalStates(t *testing.T) {
 	terminals := TerminalStates()
-	require.Len(t, terminals, 3)
+	require.Len(t, terminals, 4)
 
 	for _, s := range terminals {
 		assert.True(t, s.IsTerminal())
@@ -141,6 +146,7 @@ func TestParse(t *testing.T) {
 		{"queued", Queued, true},
 		{"failed", Failed, true},
 		{"cancelled", Cancelled, true},
+		{"expired", Expired, true},
 		{"invalid", "", false},
 		{"", "", false},
 		{"WORKING", "", false}, // Case sensitive
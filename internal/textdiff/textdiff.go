@@ -0,0 +1,239 @@
+// Package textdiff computes line-based diffs for comparing task output.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kind identifies how a line changed between the old and new text.
+type Kind string
+
+const (
+	Equal  Kind = "equal"
+	Insert Kind = "insert"
+	Delete Kind = "delete"
+)
+
+// Line is a single line of diff output.
+type Line struct {
+	Kind    Kind   `json:"kind"`
+	Text    string `json:"text"`
+	OldLine int    `json:"old_line,omitempty"` // 1-indexed line in old text (equal/delete)
+	NewLine int    `json:"new_line,omitempty"` // 1-indexed line in new text (equal/insert)
+}
+
+// Result is a complete line diff with summary counts.
+type Result struct {
+	Lines     []Line `json:"lines"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+}
+
+// maxCells bounds the LCS table size. Inputs whose differing region exceeds
+// it are reported as a full replacement rather than risking large allocations.
+const maxCells = 4_000_000
+
+// Compare returns the line diff between oldText and newText.
+func Compare(oldText, newText string) Result {
+	a := splitLines(oldText)
+	b := splitLines(newText)
+
+	// Trim common prefix and suffix to keep the LCS table small
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var res Result
+	oldLine, newLine := 0, 0
+	emit := func(kind Kind, text string) {
+		line := Line{Kind: kind, Text: text}
+		switch kind {
+		case Equal:
+			oldLine++
+			newLine++
+			line.OldLine, line.NewLine = oldLine, newLine
+		case Delete:
+			oldLine++
+			line.OldLine = oldLine
+			res.Deletions++
+		case Insert:
+			newLine++
+			line.NewLine = newLine
+			res.Additions++
+		}
+		res.Lines = append(res.Lines, line)
+	}
+
+	for _, text := range a[:prefix] {
+		emit(Equal, text)
+	}
+	midA := a[prefix : len(a)-suffix]
+	midB := b[prefix : len(b)-suffix]
+	for _, op := range diffMiddle(midA, midB) {
+		emit(op.kind, op.text)
+	}
+	for _, text := range a[len(a)-suffix:] {
+		emit(Equal, text)
+	}
+
+	if res.Lines == nil {
+		res.Lines = []Line{}
+	}
+	return res
+}
+
+type op struct {
+	kind Kind
+	text string
+}
+
+// diffMiddle computes an LCS-based edit script for the differing region.
+func diffMiddle(a, b []string) []op {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil
+	}
+	if n*m > maxCells || n == 0 || m == 0 {
+		ops := make([]op, 0, n+m)
+		for _, text := range a {
+			ops = append(ops, op{Delete, text})
+		}
+		for _, text := range b {
+			ops = append(ops, op{Insert, text})
+		}
+		return ops
+	}
+
+	// lcs[i][j] = length of LCS of a[i:] and b[j:]
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := make([]op, 0, n+m)
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, op{Equal, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, op{Delete, a[i]})
+			i++
+		default:
+			ops = append(ops, op{Insert, b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, op{Delete, a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, op{Insert, b[j]})
+	}
+	return ops
+}
+
+// Unified renders a diff in unified format with the given number of
+// context lines around each change. Returns "" if there are no changes.
+func Unified(res Result, oldName, newName string, context int) string {
+	if res.Additions == 0 && res.Deletions == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	lines := res.Lines
+	for start := 0; start < len(lines); {
+		// Find next change
+		first := start
+		for first < len(lines) && lines[first].Kind == Equal {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+
+		// Extend hunk until a run of more than 2*context equal lines
+		end := first
+		for end < len(lines) {
+			if lines[end].Kind != Equal {
+				end++
+				continue
+			}
+			run := end
+			for run < len(lines) && lines[run].Kind == Equal {
+				run++
+			}
+			if run == len(lines) || run-end > 2*context {
+				break
+			}
+			end = run
+		}
+
+		hunkStart := max(first-context, start)
+		hunkEnd := min(end+context, len(lines))
+		writeHunk(&sb, lines[hunkStart:hunkEnd])
+		start = hunkEnd
+	}
+	return sb.String()
+}
+
+func writeHunk(sb *strings.Builder, hunk []Line) {
+	oldStart, newStart := 0, 0
+	oldCount, newCount := 0, 0
+	for _, l := range hunk {
+		if l.OldLine > 0 {
+			if oldStart == 0 {
+				oldStart = l.OldLine
+			}
+			oldCount++
+		}
+		if l.NewLine > 0 {
+			if newStart == 0 {
+				newStart = l.NewLine
+			}
+			newCount++
+		}
+	}
+	fmt.Fprintf(sb, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+	for _, l := range hunk {
+		switch l.Kind {
+		case Equal:
+			sb.WriteString(" ")
+		case Delete:
+			sb.WriteString("-")
+		case Insert:
+			sb.WriteString("+")
+		}
+		sb.WriteString(l.Text)
+		sb.WriteString("\n")
+	}
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.TrimSuffix(s, "\n")
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,44 @@
+package textdiff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+
+	res := Compare("a\nb\nc\n", "a\nx\nc\nd\n")
+	require.Equal(t, 2, res.Additions)
+	require.Equal(t, 1, res.Deletions)
+	require.Equal(t, []Line{
+		{Kind: Equal, Text: "a", OldLine: 1, NewLine: 1},
+		{Kind: Delete, Text: "b", OldLine: 2},
+		{Kind: Insert, Text: "x", NewLine: 2},
+		{Kind: Equal, Text: "c", OldLine: 3, NewLine: 3},
+		{Kind: Insert, Text: "d", NewLine: 4},
+	}, res.Lines)
+}
+
+func TestCompareEmpty(t *testing.T) {
+	t.Parallel()
+
+	res := Compare("", "")
+	require.Empty(t, res.Lines)
+	require.NotNil(t, res.Lines)
+
+	res = Compare("", "one\ntwo")
+	require.Equal(t, 2, res.Additions)
+	require.Equal(t, 0, res.Deletions)
+}
+
+func TestUnified(t *testing.T) {
+	t.Parallel()
+
+	require.Empty(t, Unified(Compare("same\n", "same\n"), "a", "b", 3))
+
+	old := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	updated := "1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n"
+	require.Equal(t, "--- a\n+++ b\n@@ -4,3 +4,3 @@\n 4\n-5\n+five\n 6\n", Unified(Compare(old, updated), "a", "b", 1))
+}
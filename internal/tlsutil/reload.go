@@ -0,0 +1,105 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultCertCheckInterval is how often a CertReloader checks its files.
+const DefaultCertCheckInterval = 30 * time.Second
+
+// CertReloader serves a certificate loaded from files and reloads it when
+// they change, so a renewed or replaced certificate takes effect without a
+// restart. Use GetCertificate as tls.Config.GetCertificate.
+type CertReloader struct {
+	certPath, keyPath string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time // Of the cert and key when last loaded
+}
+
+// NewCertReloader loads the certificate in certPath and keyPath.
+func NewCertReloader(certPath, keyPath string) (*CertReloader, error) {
+	r := &CertReloader{certPath: certPath, keyPath: keyPath}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Reload loads the certificate files. On failure the current certificate
+// is kept.
+func (r *CertReloader) Reload() error {
+	modTimes, err := r.fileModTimes()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.modTimes = modTimes
+	return nil
+}
+
+// fileModTimes returns the modification times of the cert and key files.
+func (r *CertReloader) fileModTimes() ([2]time.Time, error) {
+	var times [2]time.Time
+	for i, path := range []string{r.certPath, r.keyPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return times, fmt.Errorf("loading TLS certificate: %w", err)
+		}
+		times[i] = info.ModTime()
+	}
+	return times, nil
+}
+
+// changed reports whether either file was modified since the last load.
+func (r *CertReloader) changed() bool {
+	modTimes, err := r.fileModTimes()
+	if err != nil {
+		return false // Mid-replacement; try again next time
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return modTimes != r.modTimes
+}
+
+// Watch reloads the certificate whenever its files change, checking every
+// interval until ctx is cancelled. Failed reloads are reported on stderr
+// and retried at the next check.
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !r.changed() {
+			continue
+		}
+		if err := r.Reload(); err != nil {
+			fmt.Fprintf(os.Stderr, "tls: %v (keeping current certificate)\n", err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "tls: reloaded certificate %s\n", r.certPath)
+	}
+}
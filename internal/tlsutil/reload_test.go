@@ -0,0 +1,50 @@
+package tlsutil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertReloaderPicksUpNewCertificate(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	require.NoError(t, GenerateSelfSignedCert(certPath, keyPath, "First"))
+
+	r, err := NewCertReloader(certPath, keyPath)
+	require.NoError(t, err)
+	first, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, 10*time.Millisecond)
+
+	// A broken replacement is ignored and the current certificate kept
+	require.NoError(t, os.WriteFile(certPath, []byte("not a certificate"), 0600))
+	time.Sleep(50 * time.Millisecond)
+	current, _ := r.GetCertificate(nil)
+	require.Same(t, first, current)
+
+	// A valid one is served without a restart
+	require.NoError(t, GenerateSelfSignedCert(certPath, keyPath, "Second"))
+	require.Eventually(t, func() bool {
+		current, _ := r.GetCertificate(nil)
+		return current != first
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestNewCertReloaderMissingFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	_, err := NewCertReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	require.ErrorContains(t, err, "loading TLS certificate")
+}
@@ -0,0 +1,226 @@
+package tlsutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHScheme is the URL scheme for components reached through an SSH tunnel.
+// ssh://[user@]host:port is the component listening on port on the remote
+// host's loopback interface, so agents can stay bound to 127.0.0.1 while
+// being managed from another machine.
+const SSHScheme = "ssh"
+
+// SSH tunnel settings, read from the environment when a tunnel is opened
+const (
+	SSHPortEnv       = "AGENCY_SSH_PORT"        // SSH server port (default: 22)
+	SSHKeyEnv        = "AGENCY_SSH_KEY"         // Identity file (default: ssh-agent, then ~/.ssh/id_ed25519, id_ecdsa, id_rsa)
+	SSHKnownHostsEnv = "AGENCY_SSH_KNOWN_HOSTS" // Known hosts file (default: ~/.ssh/known_hosts)
+)
+
+// sshConnectTimeout bounds the SSH connection and handshake.
+const sshConnectTimeout = 10 * time.Second
+
+// sshDefaultKeys are the identity files tried when AGENCY_SSH_KEY is unset.
+var sshDefaultKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// sshTunnels holds one HTTP transport per SSH destination, shared by every
+// client in the process so each remote host needs one SSH connection.
+var sshTunnels = struct {
+	sync.Mutex
+	transports map[string]*http.Transport // Keyed by user@host:port
+}{transports: make(map[string]*http.Transport)}
+
+// sshRoundTrip sends a request for an ssh:// URL over HTTPS through an SSH
+// port-forward to the remote host's loopback interface.
+func sshRoundTrip(req *http.Request) (*http.Response, error) {
+	transport, err := sshTransport(req.URL.User.Username(), req.URL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	out := req.Clone(req.Context())
+	out.URL.Scheme = "https"
+	out.URL.User = nil
+	resp, err := transport.RoundTrip(out)
+	if resp != nil {
+		resp.Request = req
+	}
+	return resp, err
+}
+
+// sshTransport returns the transport for an SSH destination, creating it on
+// first use.
+func sshTransport(user, host string) (*http.Transport, error) {
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+	if user == "" {
+		return nil, errors.New("ssh: no user in URL and USER is unset")
+	}
+	port := os.Getenv(SSHPortEnv)
+	if port == "" {
+		port = "22"
+	}
+	tunnel := &sshTunnel{user: user, addr: net.JoinHostPort(host, port)}
+	key := user + "@" + tunnel.addr
+
+	sshTunnels.Lock()
+	defer sshTunnels.Unlock()
+	if t, ok := sshTunnels.transports[key]; ok {
+		return t, nil
+	}
+	t := cloneDefaultTransport()
+	t.Proxy = nil
+	t.DialContext = tunnel.dial
+	// The far end is a loopback listener, which has a self-signed
+	// certificate; the SSH host key is what authenticates the host
+	insecureTLS := DefaultTLSConfig()
+	insecureTLS.InsecureSkipVerify = true
+	t.TLSClientConfig = insecureTLS
+	sshTunnels.transports[key] = t
+	return t, nil
+}
+
+// sshTunnel is one SSH connection, opened on the first request and reopened
+// if it drops.
+type sshTunnel struct {
+	user string
+	addr string // SSH server host:port
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+// dial opens a port-forward to the port of addr on the remote loopback
+// interface.
+func (t *sshTunnel) dial(ctx context.Context, _, addr string) (net.Conn, error) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	remote := net.JoinHostPort("127.0.0.1", port)
+
+	client, err := t.connect()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.DialContext(ctx, "tcp", remote)
+	if err == nil || ctx.Err() != nil {
+		return conn, err
+	}
+	// The connection may have dropped since it was last used; reconnect once
+	t.drop(client)
+	if client, err = t.connect(); err != nil {
+		return nil, err
+	}
+	return client.DialContext(ctx, "tcp", remote)
+}
+
+// connect returns the open SSH connection, or opens one.
+func (t *sshTunnel) connect() (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.client != nil {
+		return t.client, nil
+	}
+	config, closeAuth, err := sshClientConfig(t.user)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAuth()
+	client, err := ssh.Dial("tcp", t.addr, config)
+	if err != nil {
+		return nil, fmt.Errorf("ssh %s@%s: %w", t.user, t.addr, err)
+	}
+	t.client = client
+	go func() {
+		client.Wait()
+		t.drop(client)
+	}()
+	return client, nil
+}
+
+// drop forgets a connection that has failed, so the next dial reopens it.
+func (t *sshTunnel) drop(client *ssh.Client) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client == client {
+		t.client = nil
+		client.Close()
+	}
+}
+
+// sshClientConfig authenticates as user with AGENCY_SSH_KEY, or else with
+// ssh-agent and the default identity files, and checks the host key against
+// known_hosts. The returned function closes the ssh-agent connection once
+// the handshake is done.
+func sshClientConfig(user string) (*ssh.ClientConfig, func(), error) {
+	home, _ := os.UserHomeDir()
+	knownHostsPath := os.Getenv(SSHKnownHostsEnv)
+	if knownHostsPath == "" {
+		knownHostsPath = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeys, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ssh: reading known hosts: %w", err)
+	}
+
+	closeAuth := func() {}
+	var signers []ssh.Signer
+	if path := os.Getenv(SSHKeyEnv); path != "" {
+		signer, err := readSSHKey(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		signers = append(signers, signer)
+	} else {
+		if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+			if conn, err := net.Dial("unix", sock); err == nil {
+				closeAuth = func() { conn.Close() }
+				if agentSigners, err := agent.NewClient(conn).Signers(); err == nil {
+					signers = append(signers, agentSigners...)
+				}
+			}
+		}
+		for _, name := range sshDefaultKeys {
+			if signer, err := readSSHKey(filepath.Join(home, ".ssh", name)); err == nil {
+				signers = append(signers, signer) // Missing or passphrase-protected keys are skipped
+			}
+		}
+	}
+	if len(signers) == 0 {
+		closeAuth()
+		return nil, nil, fmt.Errorf("ssh: no usable keys (set %s or run ssh-agent)", SSHKeyEnv)
+	}
+
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signers...)},
+		HostKeyCallback: hostKeys,
+		Timeout:         sshConnectTimeout,
+	}, closeAuth, nil
+}
+
+func readSSHKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ssh: reading key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("ssh: parsing key %s: %w", path, err)
+	}
+	return signer, nil
+}
@@ -0,0 +1,150 @@
+package tlsutil
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// startSSHServer runs an SSH server that accepts clientKey and serves
+// direct-tcpip port-forwards, returning its address and host key.
+func startSSHServer(t *testing.T, clientKey ssh.PublicKey, forwards *atomic.Int32) (string, ssh.PublicKey) {
+	t.Helper()
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	require.NoError(t, err)
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "tester" && string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key for %s", conn.User())
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(nc, config)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for nch := range chans {
+					if nch.ChannelType() != "direct-tcpip" {
+						nch.Reject(ssh.UnknownChannelType, "unsupported")
+						continue
+					}
+					var target struct {
+						Host       string
+						Port       uint32
+						OriginHost string
+						OriginPort uint32
+					}
+					if err := ssh.Unmarshal(nch.ExtraData(), &target); err != nil {
+						nch.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+					conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+					if err != nil {
+						nch.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+					ch, chReqs, err := nch.Accept()
+					if err != nil {
+						conn.Close()
+						continue
+					}
+					forwards.Add(1)
+					go ssh.DiscardRequests(chReqs)
+					go func() {
+						io.Copy(ch, conn)
+						ch.CloseWrite()
+					}()
+					go func() {
+						io.Copy(conn, ch)
+						conn.Close()
+					}()
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), hostSigner.PublicKey()
+}
+
+func TestSSHTunnel(t *testing.T) {
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "status from %s", r.URL.Path)
+	}))
+	defer agent.Close()
+	_, agentPort, err := net.SplitHostPort(agent.Listener.Addr().String())
+	require.NoError(t, err)
+
+	_, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	clientSigner, err := ssh.NewSignerFromKey(clientPriv)
+	require.NoError(t, err)
+	var forwards atomic.Int32
+	sshAddr, hostKey := startSSHServer(t, clientSigner.PublicKey(), &forwards)
+	_, sshPort, err := net.SplitHostPort(sshAddr)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	keyBlock, err := ssh.MarshalPrivateKey(clientPriv, "")
+	require.NoError(t, err)
+	keyPath := filepath.Join(dir, "id_ed25519")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(keyBlock), 0600))
+	knownHostsPath := filepath.Join(dir, "known_hosts")
+	require.NoError(t, os.WriteFile(knownHostsPath, []byte(knownhosts.Line([]string{sshAddr}, hostKey)+"\n"), 0600))
+
+	t.Setenv(SSHPortEnv, sshPort)
+	t.Setenv(SSHKeyEnv, keyPath)
+	t.Setenv(SSHKnownHostsEnv, knownHostsPath)
+
+	client := NewHTTPClient(5 * time.Second)
+	for range 2 {
+		resp, err := client.Get("ssh://tester@127.0.0.1:" + agentPort + "/status")
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "status from /status", string(body))
+		require.Equal(t, SSHScheme, resp.Request.URL.Scheme)
+	}
+	require.Equal(t, int32(1), forwards.Load(), "the forwarded connection is reused")
+
+	_, err = client.Get("ssh://intruder@127.0.0.1:" + agentPort + "/status")
+	require.ErrorContains(t, err, "unable to authenticate")
+
+	// An unknown host key is refused
+	require.NoError(t, os.WriteFile(knownHostsPath, nil, 0600))
+	_, err = client.Get("ssh://other@127.0.0.1:" + agentPort + "/status")
+	require.ErrorContains(t, err, "key is unknown")
+}
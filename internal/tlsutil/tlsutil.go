@@ -122,6 +122,9 @@ type loopbackTLSBypassTransport struct {
 }
 
 func (t *loopbackTLSBypassTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req != nil && req.URL != nil && req.URL.Scheme == SSHScheme {
+		return sshRoundTrip(req)
+	}
 	if t.insecureAll {
 		return t.insecure.RoundTrip(req)
 	}
@@ -151,6 +154,7 @@ func cloneDefaultTransport() *http.Transport {
 // NewHTTPClient creates an HTTP client that:
 // - Uses normal TLS verification by default
 // - Allows self-signed TLS for loopback HTTPS targets (localhost/127.0.0.1/::1)
+// - Tunnels ssh://[user@]host:port URLs to the remote loopback (see SSHScheme)
 //
 // To force-disable TLS verification for all HTTPS (not recommended), set
 // AGENCY_TLS_INSECURE=1.
@@ -0,0 +1,207 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	agentRetryAttempts  = 3                      // Tries for a request whose connection failed
+	agentRetryBaseDelay = 100 * time.Millisecond // Wait before the first retry, doubled for each after
+	breakerThreshold    = 5                      // Consecutive failed calls that open a component's breaker
+	breakerBaseCooldown = 5 * time.Second        // How long a breaker first stays open
+	breakerMaxCooldown  = time.Minute            // Cap on the cooldown, doubled by each failed probe
+)
+
+// agentBreakers is shared by every client from createHTTPClient, so all
+// calls to a component see the same breaker whichever handler makes them.
+var agentBreakers = newBreakerSet()
+
+// Circuit breaker states reported in CircuitStatus
+const (
+	CircuitOpen     = "open"      // Calls fail at once until RetryAt
+	CircuitHalfOpen = "half_open" // One call is let through to probe the component
+)
+
+// CircuitStatus describes a component's circuit breaker while it isn't closed
+type CircuitStatus struct {
+	State    string    `json:"state"`
+	Failures int       `json:"failures"` // Consecutive failed calls
+	RetryAt  time.Time `json:"retry_at"` // When an open breaker next lets a call through
+}
+
+// CircuitOpenError is returned, without a request being made, for calls to a
+// component whose breaker is open.
+type CircuitOpenError struct {
+	Component string
+	RetryAt   time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s is not responding (circuit open until %s)", e.Component, e.RetryAt.Format(time.TimeOnly))
+}
+
+// breaker counts consecutive failed calls to one component. It opens at
+// breakerThreshold failures; once its cooldown passes, one call probes the
+// component, closing the breaker on success and reopening it for twice as
+// long on failure.
+type breaker struct {
+	failures  int
+	cooldown  time.Duration
+	openUntil time.Time
+	probing   bool // A probe call is in flight
+}
+
+type breakerSet struct {
+	mu       sync.Mutex
+	breakers map[string]*breaker // Keyed by breakerKey
+	now      func() time.Time
+}
+
+func newBreakerSet() *breakerSet {
+	return &breakerSet{breakers: make(map[string]*breaker), now: time.Now}
+}
+
+// breakerKey identifies the component a URL belongs to.
+func breakerKey(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+// allow returns a CircuitOpenError if a call to key must not be made now.
+func (s *breakerSet) allow(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.breakers[key]
+	if b == nil || b.failures < breakerThreshold {
+		return nil
+	}
+	if b.probing || s.now().Before(b.openUntil) {
+		return &CircuitOpenError{Component: key, RetryAt: b.openUntil}
+	}
+	b.probing = true
+	return nil
+}
+
+// done records the outcome of a call allowed by allow. Calls the caller
+// cancelled say nothing about the component and are not counted.
+func (s *breakerSet) done(key string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.breakers[key]
+	switch {
+	case err == nil:
+		delete(s.breakers, key)
+		return
+	case errors.Is(err, context.Canceled):
+		if b != nil {
+			b.probing = false
+		}
+		return
+	case b == nil:
+		b = &breaker{}
+		s.breakers[key] = b
+	}
+
+	b.failures++
+	switch {
+	case b.probing:
+		b.cooldown = min(2*b.cooldown, breakerMaxCooldown)
+	case b.failures == breakerThreshold:
+		b.cooldown = breakerBaseCooldown
+	default:
+		return // Still closed, or a call from before the breaker opened
+	}
+	b.probing = false
+	b.openUntil = s.now().Add(b.cooldown)
+}
+
+// status returns the breaker for a component URL, or nil if it's closed.
+func (s *breakerSet) status(componentURL string) *CircuitStatus {
+	u, err := url.Parse(componentURL)
+	if err != nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.breakers[breakerKey(u)]
+	if b == nil || b.failures < breakerThreshold {
+		return nil
+	}
+	state := CircuitOpen
+	if b.probing || !s.now().Before(b.openUntil) {
+		state = CircuitHalfOpen
+	}
+	return &CircuitStatus{State: state, Failures: b.failures, RetryAt: b.openUntil}
+}
+
+// agentTransport guards calls to components with their breakers and retries
+// requests whose connection failed, backing off exponentially. Timeouts are
+// not retried: a wedged component would only make the caller wait longer.
+type agentTransport struct {
+	base     http.RoundTripper
+	breakers *breakerSet
+}
+
+func (t *agentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := breakerKey(req.URL)
+	if err := t.breakers.allow(key); err != nil {
+		if req.Body != nil {
+			req.Body.Close() // RoundTrippers must close the body, even on errors
+		}
+		return nil, err
+	}
+	resp, err := t.roundTripRetrying(req)
+	t.breakers.done(key, err)
+	return resp, err
+}
+
+func (t *agentTransport) roundTripRetrying(req *http.Request) (*http.Response, error) {
+	delay := agentRetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if err == nil || attempt == agentRetryAttempts || !retryableAgentError(req, err) {
+			return resp, err
+		}
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return nil, err
+			}
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		timer := time.NewTimer(jitter(delay, 0.2))
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, err
+		}
+		delay *= 2
+	}
+}
+
+// retryableAgentError reports whether a request can safely be sent again:
+// any request that never connected, and reads whose connection was dropped.
+func retryableAgentError(req *http.Request, err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return !opErr.Timeout()
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
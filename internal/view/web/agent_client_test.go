@@ -0,0 +1,149 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreakerSet(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	s := newBreakerSet()
+	s.now = func() time.Time { return now }
+	const key = "https://localhost:9000"
+	failure := errors.New("connection refused")
+
+	// Failures below the threshold, or cancelled calls, leave it closed
+	for range breakerThreshold - 1 {
+		require.NoError(t, s.allow(key))
+		s.done(key, failure)
+	}
+	s.done(key, context.Canceled)
+	require.NoError(t, s.allow(key))
+	require.Nil(t, s.status(key))
+
+	s.done(key, failure)
+	var open *CircuitOpenError
+	require.ErrorAs(t, s.allow(key), &open)
+	require.Equal(t, now.Add(breakerBaseCooldown), open.RetryAt)
+	require.Equal(t, &CircuitStatus{State: CircuitOpen, Failures: breakerThreshold, RetryAt: open.RetryAt}, s.status(key+"/"))
+
+	// After the cooldown one probe goes through; its failure doubles the cooldown
+	now = now.Add(breakerBaseCooldown)
+	require.Equal(t, CircuitHalfOpen, s.status(key).State)
+	require.NoError(t, s.allow(key))
+	require.Error(t, s.allow(key), "one probe at a time")
+	s.done(key, failure)
+	require.ErrorAs(t, s.allow(key), &open)
+	require.Equal(t, now.Add(2*breakerBaseCooldown), open.RetryAt)
+
+	// A successful probe closes it
+	now = now.Add(2 * breakerBaseCooldown)
+	require.NoError(t, s.allow(key))
+	s.done(key, nil)
+	require.Nil(t, s.status(key))
+	require.NoError(t, s.allow(key))
+}
+
+// flakyTransport fails the first failures round trips with err.
+type flakyTransport struct {
+	failures int
+	err      error
+	calls    int
+	bodies   []string
+}
+
+func (f *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.calls++
+	if req.Body != nil {
+		body, _ := io.ReadAll(req.Body)
+		req.Body.Close()
+		f.bodies = append(f.bodies, string(body))
+	}
+	if f.calls <= f.failures {
+		return nil, f.err
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+func TestAgentTransportRetries(t *testing.T) {
+	t.Parallel()
+
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+
+	// A refused connection is retried, with the body sent again
+	base := &flakyTransport{failures: 2, err: refused}
+	client := &http.Client{Transport: &agentTransport{base: base, breakers: newBreakerSet()}}
+	resp, err := client.Post("https://localhost:9000/task", "application/json", strings.NewReader(`{"prompt":"hi"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, 3, base.calls)
+	require.Equal(t, []string{`{"prompt":"hi"}`, `{"prompt":"hi"}`, `{"prompt":"hi"}`}, base.bodies)
+
+	// Only reads are retried once the request may have been sent
+	base = &flakyTransport{failures: 1, err: reset}
+	client = &http.Client{Transport: &agentTransport{base: base, breakers: newBreakerSet()}}
+	_, err = client.Post("https://localhost:9000/task", "application/json", strings.NewReader(`{}`))
+	require.Error(t, err)
+	require.Equal(t, 1, base.calls)
+	base.failures = 2
+	resp, err = client.Get("https://localhost:9000/status")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, 3, base.calls)
+
+	// Attempts are bounded, and each request's failure counts once
+	base = &flakyTransport{failures: 100, err: refused}
+	breakers := newBreakerSet()
+	client = &http.Client{Transport: &agentTransport{base: base, breakers: breakers}}
+	for range breakerThreshold {
+		_, err = client.Get("https://localhost:9000/status")
+		require.ErrorIs(t, err, syscall.ECONNREFUSED)
+	}
+	require.Equal(t, breakerThreshold*agentRetryAttempts, base.calls)
+
+	// The open breaker fails calls without making them
+	_, err = client.Get("https://localhost:9000/status")
+	var open *CircuitOpenError
+	require.ErrorAs(t, err, &open)
+	require.Equal(t, breakerThreshold*agentRetryAttempts, base.calls)
+	_, err = client.Get("https://localhost:9001/status")
+	require.ErrorIs(t, err, syscall.ECONNREFUSED, "other agents are unaffected")
+}
+
+func TestCreateHTTPClientSharesBreakers(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	// Timeouts aren't retried, and open the breaker for every client
+	client := createHTTPClient(20*time.Millisecond, "")
+	for range breakerThreshold {
+		_, err := client.Get(srv.URL + "/status")
+		require.Error(t, err)
+	}
+	circuit := agentBreakers.status(srv.URL)
+	require.NotNil(t, circuit)
+	require.Equal(t, CircuitOpen, circuit.State)
+
+	start := time.Now()
+	_, err := createHTTPClient(10*time.Second, "token").Get(srv.URL + "/task/abc")
+	var open *CircuitOpenError
+	require.ErrorAs(t, err, &open)
+	require.Less(t, time.Since(start), 100*time.Millisecond)
+}
@@ -0,0 +1,199 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/history"
+	"phobos.org.uk/agency/internal/report"
+)
+
+// Agent report limits
+const (
+	defaultReportPeriod  = 24 * time.Hour
+	maxReportPeriod      = 90 * 24 * time.Hour
+	reportHistoryPage    = 100 // Entries per agent history request (the agent's maximum)
+	maxReportHistoryPage = 50  // Pages read per agent before the report is marked truncated
+	reportFetchTimeout   = 30 * time.Second
+)
+
+// AgentReport summarises the tasks an agent finished in a report period.
+type AgentReport struct {
+	AgentURL  string `json:"agent_url"`
+	AgentID   string `json:"agent_id,omitempty"`
+	AgentKind string `json:"agent_kind,omitempty"`
+
+	TasksRun           int     `json:"tasks_run"`
+	Succeeded          int     `json:"succeeded"`
+	Failed             int     `json:"failed"`
+	Cancelled          int     `json:"cancelled"`
+	SuccessRate        float64 `json:"success_rate"` // Fraction of completed or failed tasks that completed (0-1)
+	AvgDurationSeconds float64 `json:"avg_duration_seconds"`
+	BusySeconds        float64 `json:"busy_seconds"` // Time within the period spent running tasks
+	BusyPercent        float64 `json:"busy_percent"` // BusySeconds as a percentage of the period
+	InputTokens        int     `json:"input_tokens"`
+	OutputTokens       int     `json:"output_tokens"`
+
+	Truncated bool   `json:"truncated,omitempty"` // Only the newest tasks were read
+	Error     string `json:"error,omitempty"`     // Why the agent's history couldn't be read
+}
+
+// AgentReportsResponse is returned by GET /api/reports/agents.
+type AgentReportsResponse struct {
+	Since         time.Time     `json:"since"`
+	Until         time.Time     `json:"until"`
+	PeriodSeconds float64       `json:"period_seconds"`
+	Agents        []AgentReport `json:"agents"` // Busiest first
+}
+
+// HandleAgentReports aggregates, per discovered agent, the tasks finished in
+// the last ?period= (default 24h, at most 90d) from the agents' histories
+func (h *Handlers) HandleAgentReports(w http.ResponseWriter, r *http.Request) {
+	period := defaultReportPeriod
+	if s := r.URL.Query().Get("period"); s != "" {
+		var err error
+		if period, err = report.ParseWindow(s); err != nil || period > maxReportPeriod {
+			writeError(w, http.StatusBadRequest, api.ErrorValidation,
+				"period must be a duration such as 12h or 7d, at most 90d")
+			return
+		}
+	}
+
+	until := time.Now()
+	since := until.Add(-period)
+	client := createHTTPClient(reportFetchTimeout, h.authToken)
+	agents := h.discovery.Agents()
+	reports := make([]AgentReport, len(agents))
+	var wg sync.WaitGroup
+	for i, agent := range agents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reports[i] = agentReport(client, agent, since, until)
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].BusySeconds != reports[j].BusySeconds {
+			return reports[i].BusySeconds > reports[j].BusySeconds
+		}
+		return reports[i].AgentURL < reports[j].AgentURL
+	})
+	writeJSON(w, http.StatusOK, AgentReportsResponse{
+		Since:         since.UTC(),
+		Until:         until.UTC(),
+		PeriodSeconds: period.Seconds(),
+		Agents:        reports,
+	})
+}
+
+// agentReport reads an agent's history back to since.
+func agentReport(client *http.Client, agent *ComponentStatus, since, until time.Time) AgentReport {
+	rep := AgentReport{AgentURL: agent.URL, AgentID: agent.AgentID, AgentKind: agent.AgentKind}
+	var durations float64
+	var err error
+	rep.Truncated, err = walkHistory(client, agent.URL, since, func(e history.EntrySummary) {
+		rep.add(e, since, until)
+		durations += e.DurationSeconds
+	})
+	if err != nil {
+		rep.Error = err.Error()
+	}
+
+	if rep.TasksRun > 0 {
+		rep.AvgDurationSeconds = durations / float64(rep.TasksRun)
+	}
+	if finished := rep.Succeeded + rep.Failed; finished > 0 {
+		rep.SuccessRate = float64(rep.Succeeded) / float64(finished)
+	}
+	rep.BusyPercent = 100 * rep.BusySeconds / until.Sub(since).Seconds()
+	return rep
+}
+
+// add counts a finished task. Only the part of its run within the period
+// counts as busy time.
+func (rep *AgentReport) add(e history.EntrySummary, since, until time.Time) {
+	rep.TasksRun++
+	switch e.State {
+	case "completed":
+		rep.Succeeded++
+	case "failed":
+		rep.Failed++
+	case "cancelled":
+		rep.Cancelled++
+	}
+	if e.TokenUsage != nil {
+		rep.InputTokens += e.TokenUsage.Input
+		rep.OutputTokens += e.TokenUsage.Output
+	}
+
+	start, end := e.StartedAt, e.CompletedAt
+	if start.IsZero() {
+		start = end.Add(-time.Duration(e.DurationSeconds * float64(time.Second)))
+	}
+	start, end = maxTime(start, since), minTime(end, until)
+	if end.After(start) {
+		rep.BusySeconds += end.Sub(start).Seconds()
+	}
+}
+
+// walkHistory calls fn with each task in an agent's history, newest first,
+// until it reaches tasks that finished before since. It reports whether it
+// stopped at the page limit first.
+func walkHistory(client *http.Client, agentURL string, since time.Time, fn func(history.EntrySummary)) (bool, error) {
+	for page := 1; page <= maxReportHistoryPage; page++ {
+		result, err := fetchHistoryPage(client, agentURL, page)
+		if err != nil {
+			return false, err
+		}
+		for _, e := range result.Entries {
+			if e.CompletedAt.Before(since) {
+				return false, nil
+			}
+			fn(e)
+		}
+		if page >= result.TotalPages {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// fetchHistoryPage reads one page of an agent's task history.
+func fetchHistoryPage(client *http.Client, agentURL string, page int) (*history.ListResult, error) {
+	query := url.Values{"page": {fmt.Sprint(page)}, "limit": {fmt.Sprint(reportHistoryPage)}}
+	resp, err := client.Get(agentURL + "/history?" + query.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("fetching history: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching history: status %d", resp.StatusCode)
+	}
+	var result history.ListResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decoding history: %w", err)
+	}
+	return &result, nil
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
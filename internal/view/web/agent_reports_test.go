@@ -0,0 +1,79 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/history"
+)
+
+func TestHandleAgentReports(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	entry := func(state string, startAgo, endAgo time.Duration, tokens int) history.EntrySummary {
+		return history.EntrySummary{
+			State:           state,
+			StartedAt:       now.Add(-startAgo),
+			CompletedAt:     now.Add(-endAgo),
+			DurationSeconds: (startAgo - endAgo).Seconds(),
+			TokenUsage:      &history.TokenUsage{Input: tokens, Output: tokens / 10},
+		}
+	}
+	pages := map[string][]history.EntrySummary{
+		"1": {
+			entry("completed", 2*time.Hour, time.Hour, 1000),
+			entry("failed", 5*time.Hour, 4*time.Hour, 500),
+		},
+		"2": {
+			entry("completed", 25*time.Hour, 23*time.Hour, 100), // Half within the last day
+			entry("completed", 30*time.Hour, 29*time.Hour, 100), // Before the period
+		},
+	}
+	var pagesRead []string
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/status":
+			json.NewEncoder(w).Encode(map[string]any{"type": "agent", "state": "idle", "agent_kind": "claude"})
+		case "/history":
+			page := r.URL.Query().Get("page")
+			pagesRead = append(pagesRead, page)
+			json.NewEncoder(w).Encode(history.ListResult{Entries: pages[page], TotalPages: 3})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(agent.Close)
+
+	d := NewDiscovery(DiscoveryConfig{})
+	d.checkPort(extractPort(t, agent.URL))
+	h := newTestHandlers(t, d, "test")
+
+	w := httptest.NewRecorder()
+	h.HandleAgentReports(w, httptest.NewRequest("GET", "/api/reports/agents?period=1d", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp AgentReportsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, 86400.0, resp.PeriodSeconds)
+	require.Len(t, resp.Agents, 1)
+	rep := resp.Agents[0]
+	require.Equal(t, "claude", rep.AgentKind)
+	require.Equal(t, 3, rep.TasksRun)
+	require.Equal(t, 2, rep.Succeeded)
+	require.Equal(t, 1, rep.Failed)
+	require.InDelta(t, 2.0/3, rep.SuccessRate, 0.001)
+	require.InDelta(t, 4*3600.0/3, rep.AvgDurationSeconds, 1)
+	require.InDelta(t, 3*3600.0, rep.BusySeconds, 1) // 1h + 1h + the last hour of the oldest task
+	require.InDelta(t, 12.5, rep.BusyPercent, 0.01)
+	require.Equal(t, 1600, rep.InputTokens)
+	require.Equal(t, []string{"1", "2"}, pagesRead) // Stops at tasks before the period
+
+	w = httptest.NewRecorder()
+	h.HandleAgentReports(w, httptest.NewRequest("GET", "/api/reports/agents?period=1y", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -1,7 +1,14 @@
 package web
 
+import (
+	"fmt"
+	"strings"
+
+	"phobos.org.uk/agency/internal/api"
+)
+
 // buildAgentRequest constructs the payload for agent task submission.
-func buildAgentRequest(prompt, tier string, timeoutSeconds int, sessionID string, env map[string]string) map[string]any {
+func buildAgentRequest(prompt, tier string, timeoutSeconds int, sessionID string, env map[string]string, opts api.RunnerOptions) map[string]any {
 	req := map[string]any{
 		"prompt": prompt,
 	}
@@ -17,5 +24,67 @@ func buildAgentRequest(prompt, tier string, timeoutSeconds int, sessionID string
 	if len(env) > 0 {
 		req["env"] = env
 	}
+	if opts.MaxTurns > 0 {
+		req["max_turns"] = opts.MaxTurns
+	}
+	if opts.PermissionMode != "" {
+		req["permission_mode"] = opts.PermissionMode
+	}
+	if len(opts.AllowedTools) > 0 {
+		req["allowed_tools"] = opts.AllowedTools
+	}
 	return req
 }
+
+// agentRequestFields are the optional task fields an agent must report a
+// capability for before they're sent to it.
+var agentRequestFields = []struct {
+	field      string
+	capability string
+}{
+	{"env", api.CapabilityTaskEnv},
+	{"max_turns", api.CapabilityRunnerOptions},
+	{"permission_mode", api.CapabilityRunnerOptions},
+	{"allowed_tools", api.CapabilityRunnerOptions},
+	{"attachments", api.CapabilityAttachments},
+}
+
+// adaptAgentRequest removes the fields of req that agent lacks the capability
+// for, so an older agent runs the task without them rather than rejecting or
+// misreading it, and returns the names of the fields removed. Agents from
+// before API versioning are sent req unchanged: there's no telling what they
+// support, and they ignore fields they don't know.
+func adaptAgentRequest(req map[string]any, agent *ComponentStatus) []string {
+	if agent.APIVersion == 0 {
+		return nil
+	}
+	var dropped []string
+	for _, f := range agentRequestFields {
+		if _, ok := req[f.field]; ok && !api.HasCapability(agent.Capabilities, f.capability) {
+			delete(req, f.field)
+			dropped = append(dropped, f.field)
+		}
+	}
+	return dropped
+}
+
+// agentCompatibility describes how an agent's API differs from the director's,
+// for the dashboard, or returns "" if they match.
+func agentCompatibility(agent *ComponentStatus) string {
+	switch {
+	case agent.APIVersion == 0:
+		return "Predates API versioning; newer task options may be ignored"
+	case agent.APIVersion > api.APIVersion:
+		return fmt.Sprintf("Speaks API version %d, newer than the director's %d", agent.APIVersion, api.APIVersion)
+	}
+	var unsupported []string
+	for _, f := range agentRequestFields {
+		if !api.HasCapability(agent.Capabilities, f.capability) {
+			unsupported = append(unsupported, f.field)
+		}
+	}
+	if len(unsupported) == 0 {
+		return ""
+	}
+	return "Tasks are sent without " + strings.Join(unsupported, ", ")
+}
@@ -0,0 +1,42 @@
+package web
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/api"
+)
+
+func TestAdaptAgentRequest(t *testing.T) {
+	t.Parallel()
+
+	build := func() map[string]any {
+		return buildAgentRequest("hi", "fast", 60, "", map[string]string{"A": "1"}, api.RunnerOptions{AllowedTools: []string{"Read"}})
+	}
+
+	// Agents from before versioning get the request as it is
+	req := build()
+	require.Empty(t, adaptAgentRequest(req, &ComponentStatus{}))
+	require.Equal(t, build(), req)
+
+	current := &ComponentStatus{APIVersion: api.APIVersion, Capabilities: []string{api.CapabilityTaskEnv, api.CapabilityRunnerOptions}}
+	req = build()
+	require.Empty(t, adaptAgentRequest(req, current))
+	require.Equal(t, build(), req)
+
+	older := &ComponentStatus{APIVersion: api.APIVersion}
+	req = build()
+	require.Equal(t, []string{"env", "allowed_tools"}, adaptAgentRequest(req, older))
+	require.Equal(t, map[string]any{"prompt": "hi", "tier": "fast", "timeout_seconds": 60}, req)
+}
+
+func TestAgentCompatibility(t *testing.T) {
+	t.Parallel()
+
+	all := []string{api.CapabilityTaskEnv, api.CapabilityRunnerOptions, api.CapabilityAttachments}
+	require.Empty(t, agentCompatibility(&ComponentStatus{APIVersion: api.APIVersion, Capabilities: all}))
+	require.Contains(t, agentCompatibility(&ComponentStatus{}), "Predates API versioning")
+	require.Contains(t, agentCompatibility(&ComponentStatus{APIVersion: api.APIVersion + 1}), "newer than the director's")
+	require.Equal(t, "Tasks are sent without attachments",
+		agentCompatibility(&ComponentStatus{APIVersion: api.APIVersion, Capabilities: all[:2]}))
+}
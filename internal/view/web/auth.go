@@ -48,6 +48,43 @@ func (al *AccessLogger) Log(ip, method, path string, status int, authSuccess boo
 	al.file.WriteString(entry)
 }
 
+// LogBlocked records a request rejected by the IP filter and the rule that
+// matched it
+func (al *AccessLogger) LogBlocked(ip, method, path, rule string) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	fmt.Fprintf(al.file, "%s %s %s %s %d ip_blocked %q\n",
+		time.Now().Format(time.RFC3339),
+		ip,
+		method,
+		path,
+		http.StatusForbidden,
+		rule,
+	)
+}
+
+// HandleEvent records task submissions and finishes and device pairings, so
+// the access log doubles as an audit trail. Other events are too frequent to
+// be worth keeping.
+func (al *AccessLogger) HandleEvent(e Event) {
+	var detail string
+	switch e.Type {
+	case EventTaskSubmitted:
+		detail = fmt.Sprintf("%s source=%q", e.Task.QueueID, e.Task.Source)
+	case EventTaskFinished:
+		detail = fmt.Sprintf("%s state=%s", e.Task.QueueID, e.State)
+	case EventDevicePaired:
+		detail = fmt.Sprintf("device=%q ip=%s", e.Device, e.IP)
+	default:
+		return
+	}
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	fmt.Fprintf(al.file, "%s event %s %s\n", e.Time.Format(time.RFC3339), e.Type, detail)
+}
+
 // Close closes the access log file
 func (al *AccessLogger) Close() error {
 	return al.file.Close()
@@ -72,14 +109,13 @@ func GetSessionFromContext(ctx context.Context) *AuthSession {
 // - Session cookie (for web UI)
 // - Bearer token in Authorization header (for API)
 // - Token query parameter (for API)
+// The password is not accepted as a token while two-factor auth is enabled,
+// since it would bypass the second factor.
 // API paths (/api/*) return 401 on auth failure; others redirect to /login.
 func SessionMiddleware(store *AuthStore, accessLogger *AccessLogger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ip := r.RemoteAddr
-			if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
-				ip = realIP
-			}
+			ip := clientIP(r)
 
 			isAPIPath := strings.HasPrefix(r.URL.Path, "/api/")
 
@@ -104,8 +140,10 @@ func SessionMiddleware(store *AuthStore, accessLogger *AccessLogger) func(http.H
 				return
 			}
 
+			passwordTokens := !store.TOTPEnabled()
+
 			// Try bearer token auth (for API access)
-			if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+			if authHeader := r.Header.Get("Authorization"); passwordTokens && strings.HasPrefix(authHeader, "Bearer ") {
 				token := strings.TrimPrefix(authHeader, "Bearer ")
 				if store.ValidatePassword(token) {
 					if accessLogger != nil {
@@ -117,7 +155,7 @@ func SessionMiddleware(store *AuthStore, accessLogger *AccessLogger) func(http.H
 			}
 
 			// Try query param token (for API access)
-			if token := r.URL.Query().Get("token"); token != "" {
+			if token := r.URL.Query().Get("token"); passwordTokens && token != "" {
 				if store.ValidatePassword(token) {
 					if accessLogger != nil {
 						accessLogger.Log(ip, r.Method, r.URL.Path, http.StatusOK, true)
@@ -54,6 +54,8 @@ type AuthSession struct {
 	ExpiresAt time.Time   `json:"expires_at,omitempty"` // Zero for device sessions
 	IPAddress string      `json:"ip_address"`
 	UserAgent string      `json:"user_agent"`
+
+	Preferences // Dashboard settings of the device
 }
 
 // IsExpired checks if the session has expired.
@@ -75,6 +77,7 @@ type PairingCode struct {
 type authStoreData struct {
 	Sessions     []*AuthSession `json:"sessions"`
 	PairingCodes []*PairingCode `json:"pairing_codes"`
+	TOTP         *totpState     `json:"totp,omitempty"`
 }
 
 // AuthStore manages auth sessions and pairing codes.
@@ -84,6 +87,16 @@ type AuthStore struct {
 	pairingCodes []*PairingCode
 	filePath     string
 	passwordHash string // Argon2id encoded hash (memory only, not persisted)
+
+	totp        *totpState // Two-factor settings (nil = disabled)
+	pendingTOTP string     // Secret awaiting enrollment confirmation (memory only)
+
+	// Most recent pairing code in plaintext, for the QR endpoint (memory only)
+	currentCode        string
+	currentCodeExpires time.Time
+
+	// Wrong second-factor codes at login by client IP (memory only)
+	totpFailures map[string]*totpFailure
 }
 
 // NewAuthStore creates a new auth store.
@@ -151,6 +164,7 @@ func (s *AuthStore) CreateAuthSession(ip, userAgent string) (*AuthSession, error
 	}
 
 	s.mu.Lock()
+	session.Preferences = s.latestPreferencesLocked()
 	s.sessions[id] = session
 	err = s.saveUnlocked()
 	s.mu.Unlock()
@@ -184,6 +198,9 @@ func (s *AuthStore) CreateDeviceSession(code, label, ip, userAgent string) (*Aut
 
 	// Mark code as used
 	validCode.Used = true
+	if code == s.currentCode {
+		s.currentCode = ""
+	}
 
 	// Create device session
 	id, err := generateSessionID()
@@ -203,6 +220,7 @@ func (s *AuthStore) CreateDeviceSession(code, label, ip, userAgent string) (*Aut
 		UserAgent: userAgent,
 	}
 
+	session.Preferences = s.latestPreferencesLocked()
 	s.sessions[id] = session
 	if err := s.saveUnlocked(); err != nil {
 		return nil, err
@@ -247,6 +265,51 @@ func (s *AuthStore) RefreshSession(id string) bool {
 	return true
 }
 
+// Preferences returns the dashboard preferences of a session. They are
+// empty if the session doesn't exist.
+func (s *AuthStore) Preferences(id string) Preferences {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return Preferences{}
+	}
+	return session.Preferences
+}
+
+// SetPreferences stores the dashboard preferences of a session.
+// Returns false if session not found or expired.
+func (s *AuthStore) SetPreferences(id string, prefs Preferences) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || session.IsExpired() {
+		return false, nil
+	}
+	session.Preferences = prefs
+	return true, s.saveUnlocked()
+}
+
+// latestPreferencesLocked returns the preferences new sessions inherit,
+// from the most recently used session. Caller must hold s.mu.
+func (s *AuthStore) latestPreferencesLocked() Preferences {
+	var latest *AuthSession
+	for _, session := range s.sessions {
+		if session.IsExpired() {
+			continue
+		}
+		if latest == nil || session.LastSeen.After(latest.LastSeen) {
+			latest = session
+		}
+	}
+	if latest == nil {
+		return Preferences{}
+	}
+	return latest.Preferences.inherited()
+}
+
 // DeleteSession removes a session.
 func (s *AuthStore) DeleteSession(id string) {
 	s.mu.Lock()
@@ -263,6 +326,7 @@ func (s *AuthStore) InvalidateAllSessions() {
 
 	s.sessions = make(map[string]*AuthSession)
 	s.pairingCodes = make([]*PairingCode, 0)
+	s.currentCode = ""
 	s.saveUnlocked()
 }
 
@@ -285,11 +349,14 @@ func (s *AuthStore) CreatePairingCode() (string, error) {
 	// Clean up expired/used codes
 	s.pruneCodesUnlocked()
 
+	expiresAt := time.Now().Add(PairingCodeTTL)
 	s.pairingCodes = append(s.pairingCodes, &PairingCode{
 		CodeHash:  hash,
-		ExpiresAt: time.Now().Add(PairingCodeTTL),
+		ExpiresAt: expiresAt,
 		Used:      false,
 	})
+	s.currentCode = code
+	s.currentCodeExpires = expiresAt
 
 	if err := s.saveUnlocked(); err != nil {
 		return "", err
@@ -298,6 +365,19 @@ func (s *AuthStore) CreatePairingCode() (string, error) {
 	return code, nil
 }
 
+// CurrentPairingCode returns the most recently generated pairing code and its
+// expiry, if it is still unused and unexpired. Codes generated before a
+// restart are not available.
+func (s *AuthStore) CurrentPairingCode() (string, time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.currentCode == "" || !time.Now().Before(s.currentCodeExpires) {
+		return "", time.Time{}, false
+	}
+	return s.currentCode, s.currentCodeExpires, true
+}
+
 // ListDeviceSessions returns all device sessions.
 func (s *AuthStore) ListDeviceSessions() []*AuthSession {
 	s.mu.RLock()
@@ -370,6 +450,7 @@ func (s *AuthStore) load() error {
 			s.pairingCodes = append(s.pairingCodes, pc)
 		}
 	}
+	s.totp = stored.TOTP
 
 	return nil
 }
@@ -377,6 +458,22 @@ func (s *AuthStore) load() error {
 // saveUnlocked persists sessions to disk.
 // Must be called with lock held.
 func (s *AuthStore) saveUnlocked() error {
+	jsonData, err := s.marshalUnlocked()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.filePath, jsonData, 0600) // Restrictive permissions
+}
+
+// Snapshot returns the store as saved to disk, for backups.
+func (s *AuthStore) Snapshot() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.marshalUnlocked()
+}
+
+// marshalUnlocked encodes the store's contents. Caller must hold the lock.
+func (s *AuthStore) marshalUnlocked() ([]byte, error) {
 	// Filter expired sessions before saving
 	sessions := make([]*AuthSession, 0, len(s.sessions))
 	for _, session := range s.sessions {
@@ -388,14 +485,14 @@ func (s *AuthStore) saveUnlocked() error {
 	data := authStoreData{
 		Sessions:     sessions,
 		PairingCodes: s.pairingCodes,
+		TOTP:         s.totp,
 	}
 
 	jsonData, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
-		return fmt.Errorf("marshaling auth store: %w", err)
+		return nil, fmt.Errorf("marshaling auth store: %w", err)
 	}
-
-	return os.WriteFile(s.filePath, jsonData, 0600) // Restrictive permissions
+	return jsonData, nil
 }
 
 // generateSessionID creates a cryptographically random session ID.
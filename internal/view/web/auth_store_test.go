@@ -325,6 +325,46 @@ func TestPairingCodeSingleUse(t *testing.T) {
 	}
 }
 
+func TestCurrentPairingCode(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := NewAuthStore(filepath.Join(dir, "auth.json"), "password")
+	if err != nil {
+		t.Fatalf("NewAuthStore failed: %v", err)
+	}
+
+	if _, _, ok := store.CurrentPairingCode(); ok {
+		t.Error("no code should be current before one is generated")
+	}
+
+	first, _ := store.CreatePairingCode()
+	second, _ := store.CreatePairingCode()
+	code, expiresAt, ok := store.CurrentPairingCode()
+	if !ok || code != second || code == first {
+		t.Fatalf("current code = %q, %v; want the latest code %q", code, ok, second)
+	}
+	if time.Until(expiresAt) <= 0 || time.Until(expiresAt) > PairingCodeTTL {
+		t.Errorf("expiry %v not within the pairing code TTL", expiresAt)
+	}
+
+	// Using an older code leaves the current one in place
+	if _, err := store.CreateDeviceSession(first, "Device1", "192.168.1.1", "UA"); err != nil {
+		t.Fatalf("pairing with the first code failed: %v", err)
+	}
+	if code, _, ok := store.CurrentPairingCode(); !ok || code != second {
+		t.Error("current code should survive use of another code")
+	}
+
+	// Using the current code clears it
+	if _, err := store.CreateDeviceSession(second, "Device2", "192.168.1.2", "UA"); err != nil {
+		t.Fatalf("pairing with the current code failed: %v", err)
+	}
+	if _, _, ok := store.CurrentPairingCode(); ok {
+		t.Error("a used code should not be current")
+	}
+}
+
 func TestPairingCodeInvalid(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,294 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"phobos.org.uk/agency/internal/api"
+)
+
+// Autoscaling defaults
+const (
+	DefaultAutoscaleUpDepth   = 5                // Pending tasks that count as a backlog
+	DefaultAutoscaleUpAfter   = 5 * time.Minute  // How long a backlog lasts before scaling up
+	DefaultAutoscaleDownAfter = 15 * time.Minute // How long the fleet idles before scaling down
+	autoscaleCheckInterval    = 30 * time.Second
+	autoscaleHookTimeout      = 2 * time.Minute
+	maxAutoscaleEvents        = 50
+)
+
+// Scaling directions
+const (
+	ScaleUp   = "up"
+	ScaleDown = "down"
+)
+
+// AutoscaleConfig configures the agent pool autoscaler. It is disabled
+// unless a command or webhook is set.
+type AutoscaleConfig struct {
+	Command    string        // Shell command that starts or stops an agent (AGENCY_SCALE_* are set)
+	WebhookURL string        // URL POSTed a ScaleRequest instead of running a command
+	UpDepth    int           // Queue depth that counts as a backlog (default: 5)
+	UpAfter    time.Duration // How long the backlog lasts before scaling up (default: 5m)
+	DownAfter  time.Duration // How long the queue is empty with an idle agent before scaling down (default: 15m)
+	MinAgents  int           // Never scale below this many agents
+	MaxAgents  int           // Never scale above this many agents (0 = unlimited)
+}
+
+// Enabled reports whether autoscaling is configured.
+func (c AutoscaleConfig) Enabled() bool {
+	return c.Command != "" || c.WebhookURL != ""
+}
+
+// ScaleRequest asks a scaling hook to add or remove one agent.
+type ScaleRequest struct {
+	Direction  string `json:"direction"` // up or down
+	Reason     string `json:"reason"`
+	QueueDepth int    `json:"queue_depth"`
+	Agents     int    `json:"agents"`
+	AgentURL   string `json:"agent_url,omitempty"` // The idle agent to stop, when scaling down
+}
+
+// Scaler starts or stops agent processes.
+type Scaler interface {
+	Scale(ctx context.Context, req ScaleRequest) error
+}
+
+// commandScaler runs a shell command with the request in AGENCY_SCALE_*
+// environment variables, like the rolling restart command.
+type commandScaler struct {
+	command string
+}
+
+func (s commandScaler) Scale(ctx context.Context, req ScaleRequest) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", s.command)
+	cmd.Env = append(os.Environ(),
+		"AGENCY_SCALE_DIRECTION="+req.Direction,
+		"AGENCY_SCALE_QUEUE_DEPTH="+strconv.Itoa(req.QueueDepth),
+		"AGENCY_SCALE_AGENTS="+strconv.Itoa(req.Agents),
+		"AGENCY_AGENT_URL="+req.AgentURL,
+		"AGENCY_AGENT_PORT="+agentPort(req.AgentURL),
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, truncateOutput(string(output), 200))
+	}
+	return nil
+}
+
+// webhookScaler POSTs the request as JSON.
+type webhookScaler struct {
+	url    string
+	client *http.Client
+}
+
+func (s webhookScaler) Scale(ctx context.Context, req ScaleRequest) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ScaleEvent records one scaling decision.
+type ScaleEvent struct {
+	At time.Time `json:"at"`
+	ScaleRequest
+	Error string `json:"error,omitempty"`
+}
+
+// AutoscaleStatus is the autoscaler's configuration and recent events, for
+// the dashboard and GET /api/autoscale.
+type AutoscaleStatus struct {
+	Hook      string        `json:"hook"` // command or webhook
+	UpDepth   int           `json:"up_depth"`
+	UpAfter   string        `json:"up_after"`
+	DownAfter string        `json:"down_after"`
+	MinAgents int           `json:"min_agents"`
+	MaxAgents int           `json:"max_agents,omitempty"`
+	Events    []*ScaleEvent `json:"events"` // Newest first
+}
+
+// Autoscaler adds an agent when the queue has held a backlog for a while,
+// and removes an idle one when the queue has been empty for a while. The
+// work is done by a Scaler; the timers restart after each decision, so
+// new agents have time to register before the next one.
+type Autoscaler struct {
+	cfg       AutoscaleConfig
+	queue     *WorkQueue
+	discovery *Discovery
+	scaler    Scaler
+	now       func() time.Time
+
+	mu          sync.Mutex
+	backlogFrom time.Time // When the current backlog started (zero = none)
+	idleFrom    time.Time // When the fleet last became idle (zero = busy)
+	events      []*ScaleEvent
+}
+
+// NewAutoscaler creates an autoscaler, or returns nil if cfg is not enabled.
+func NewAutoscaler(cfg AutoscaleConfig, queue *WorkQueue, discovery *Discovery) *Autoscaler {
+	if !cfg.Enabled() {
+		return nil
+	}
+	if cfg.UpDepth <= 0 {
+		cfg.UpDepth = DefaultAutoscaleUpDepth
+	}
+	if cfg.UpAfter <= 0 {
+		cfg.UpAfter = DefaultAutoscaleUpAfter
+	}
+	if cfg.DownAfter <= 0 {
+		cfg.DownAfter = DefaultAutoscaleDownAfter
+	}
+	var scaler Scaler = commandScaler{command: cfg.Command}
+	if cfg.Command == "" {
+		scaler = webhookScaler{url: cfg.WebhookURL, client: &http.Client{Timeout: autoscaleHookTimeout}}
+	}
+	return &Autoscaler{
+		cfg:       cfg,
+		queue:     queue,
+		discovery: discovery,
+		scaler:    scaler,
+		now:       time.Now,
+	}
+}
+
+// Start checks the queue and fleet until the context is cancelled.
+func (a *Autoscaler) Start(ctx context.Context) {
+	ticker := time.NewTicker(autoscaleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.check(ctx)
+		}
+	}
+}
+
+// check makes at most one scaling decision and runs the hook for it.
+func (a *Autoscaler) check(ctx context.Context) {
+	req, ok := a.decide()
+	if !ok {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "autoscale: scaling %s: %s\n", req.Direction, req.Reason)
+	hookCtx, cancel := context.WithTimeout(ctx, autoscaleHookTimeout)
+	err := a.scaler.Scale(hookCtx, req)
+	cancel()
+
+	event := &ScaleEvent{At: a.now(), ScaleRequest: req}
+	if err != nil {
+		event.Error = err.Error()
+		fmt.Fprintf(os.Stderr, "autoscale: scaling %s failed: %v\n", req.Direction, err)
+	}
+	a.mu.Lock()
+	a.events = append(a.events, event)
+	if n := len(a.events) - maxAutoscaleEvents; n > 0 {
+		a.events = append([]*ScaleEvent(nil), a.events[n:]...)
+	}
+	a.mu.Unlock()
+}
+
+// decide updates the backlog and idle timers and reports whether to scale.
+func (a *Autoscaler) decide() (ScaleRequest, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	depth := a.queue.Depth()
+	agents := a.discovery.Agents()
+	idleURL := ""
+	for _, agent := range agents {
+		if agent.State == "idle" {
+			idleURL = agent.URL
+		}
+	}
+	req := ScaleRequest{QueueDepth: depth, Agents: len(agents)}
+
+	if depth >= a.cfg.UpDepth {
+		a.idleFrom = time.Time{}
+		if a.backlogFrom.IsZero() {
+			a.backlogFrom = now
+		}
+		if now.Sub(a.backlogFrom) < a.cfg.UpAfter || (a.cfg.MaxAgents > 0 && len(agents) >= a.cfg.MaxAgents) {
+			return req, false
+		}
+		a.backlogFrom = now
+		req.Direction = ScaleUp
+		req.Reason = fmt.Sprintf("%d tasks queued for %s", depth, a.cfg.UpAfter)
+		return req, true
+	}
+	a.backlogFrom = time.Time{}
+
+	if depth > 0 || idleURL == "" {
+		a.idleFrom = time.Time{}
+		return req, false
+	}
+	if a.idleFrom.IsZero() {
+		a.idleFrom = now
+	}
+	if now.Sub(a.idleFrom) < a.cfg.DownAfter || len(agents) <= a.cfg.MinAgents {
+		return req, false
+	}
+	a.idleFrom = now
+	req.Direction = ScaleDown
+	req.AgentURL = idleURL
+	req.Reason = fmt.Sprintf("queue empty and %s idle for %s", idleURL, a.cfg.DownAfter)
+	return req, true
+}
+
+// Status returns the autoscaler's configuration and recent events.
+func (a *Autoscaler) Status() *AutoscaleStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	status := &AutoscaleStatus{
+		Hook:      "command",
+		UpDepth:   a.cfg.UpDepth,
+		UpAfter:   a.cfg.UpAfter.String(),
+		DownAfter: a.cfg.DownAfter.String(),
+		MinAgents: a.cfg.MinAgents,
+		MaxAgents: a.cfg.MaxAgents,
+		Events:    make([]*ScaleEvent, 0, len(a.events)),
+	}
+	if a.cfg.Command == "" {
+		status.Hook = "webhook"
+	}
+	for i := len(a.events) - 1; i >= 0; i-- {
+		status.Events = append(status.Events, a.events[i])
+	}
+	return status
+}
+
+// HandleStatus handles GET /api/autoscale
+func (a *Autoscaler) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	if a == nil {
+		writeError(w, http.StatusNotFound, api.ErrorNotFound, "Autoscaling is not configured")
+		return
+	}
+	writeJSON(w, http.StatusOK, a.Status())
+}
@@ -0,0 +1,149 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeScaler struct {
+	requests []ScaleRequest
+	err      error
+}
+
+func (s *fakeScaler) Scale(ctx context.Context, req ScaleRequest) error {
+	s.requests = append(s.requests, req)
+	return s.err
+}
+
+func newTestAutoscaler(t *testing.T, cfg AutoscaleConfig, now *time.Time) (*Autoscaler, *WorkQueue, *Discovery, *fakeScaler) {
+	t.Helper()
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	d := NewDiscovery(DiscoveryConfig{})
+	cfg.Command = "true"
+	a := NewAutoscaler(cfg, q, d)
+	scaler := &fakeScaler{}
+	a.scaler = scaler
+	a.now = func() time.Time { return *now }
+	return a, q, d, scaler
+}
+
+func TestAutoscalerDisabledWithoutHook(t *testing.T) {
+	t.Parallel()
+
+	require.Nil(t, NewAutoscaler(AutoscaleConfig{UpDepth: 3}, nil, nil))
+
+	w := httptest.NewRecorder()
+	var a *Autoscaler
+	a.HandleStatus(w, httptest.NewRequest(http.MethodGet, "/api/autoscale", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAutoscalerScalesUpAfterSustainedBacklog(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	a, q, d, scaler := newTestAutoscaler(t, AutoscaleConfig{UpDepth: 2, UpAfter: 5 * time.Minute, MaxAgents: 2}, &now)
+	d.components["https://localhost:9000"] = &ComponentStatus{URL: "https://localhost:9000", Type: "agent", State: "working"}
+	for range 2 {
+		_, _, err := q.Add(QueueSubmitRequest{Prompt: "p"})
+		require.NoError(t, err)
+	}
+
+	a.check(context.Background())
+	now = now.Add(4 * time.Minute)
+	a.check(context.Background())
+	require.Empty(t, scaler.requests, "backlog not sustained yet")
+
+	now = now.Add(time.Minute)
+	a.check(context.Background())
+	require.Len(t, scaler.requests, 1)
+	require.Equal(t, ScaleUp, scaler.requests[0].Direction)
+	require.Equal(t, 2, scaler.requests[0].QueueDepth)
+	require.Equal(t, 1, scaler.requests[0].Agents)
+
+	now = now.Add(time.Minute)
+	a.check(context.Background())
+	require.Len(t, scaler.requests, 1, "the timer restarts after scaling")
+
+	d.components["https://localhost:9001"] = &ComponentStatus{URL: "https://localhost:9001", Type: "agent", State: "working"}
+	now = now.Add(10 * time.Minute)
+	a.check(context.Background())
+	require.Len(t, scaler.requests, 1, "at the agent limit")
+}
+
+func TestAutoscalerScalesDownWhenIdle(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	a, _, d, scaler := newTestAutoscaler(t, AutoscaleConfig{DownAfter: 10 * time.Minute, MinAgents: 1}, &now)
+	d.components["https://localhost:9000"] = &ComponentStatus{URL: "https://localhost:9000", Type: "agent", State: "working"}
+	d.components["https://localhost:9001"] = &ComponentStatus{URL: "https://localhost:9001", Type: "agent", State: "idle"}
+
+	a.check(context.Background())
+	now = now.Add(10 * time.Minute)
+	a.check(context.Background())
+	require.Len(t, scaler.requests, 1)
+	require.Equal(t, ScaleDown, scaler.requests[0].Direction)
+	require.Equal(t, "https://localhost:9001", scaler.requests[0].AgentURL)
+
+	delete(d.components, "https://localhost:9001")
+	d.components["https://localhost:9000"] = &ComponentStatus{URL: "https://localhost:9000", Type: "agent", State: "idle"}
+	now = now.Add(time.Hour)
+	a.check(context.Background())
+	require.Len(t, scaler.requests, 1, "never below the minimum")
+}
+
+func TestAutoscalerRecordsEvents(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	a, _, d, scaler := newTestAutoscaler(t, AutoscaleConfig{DownAfter: time.Minute}, &now)
+	scaler.err = errors.New("exit status 1")
+	d.components["https://localhost:9000"] = &ComponentStatus{URL: "https://localhost:9000", Type: "agent", State: "idle"}
+
+	a.check(context.Background())
+	now = now.Add(time.Minute)
+	a.check(context.Background())
+
+	w := httptest.NewRecorder()
+	a.HandleStatus(w, httptest.NewRequest(http.MethodGet, "/api/autoscale", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var status AutoscaleStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	require.Equal(t, "command", status.Hook)
+	require.Equal(t, DefaultAutoscaleUpDepth, status.UpDepth)
+	require.Len(t, status.Events, 1)
+	require.Equal(t, ScaleDown, status.Events[0].Direction)
+	require.Equal(t, "exit status 1", status.Events[0].Error)
+}
+
+func TestWebhookScaler(t *testing.T) {
+	t.Parallel()
+
+	var got ScaleRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/scale" {
+			http.NotFound(w, r)
+			return
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	s := webhookScaler{url: srv.URL + "/scale", client: srv.Client()}
+	require.NoError(t, s.Scale(context.Background(), ScaleRequest{Direction: ScaleUp, QueueDepth: 7, Agents: 2}))
+	require.Equal(t, ScaleUp, got.Direction)
+	require.Equal(t, 7, got.QueueDepth)
+
+	s.url = srv.URL + "/missing"
+	require.ErrorContains(t, s.Scale(context.Background(), ScaleRequest{Direction: ScaleDown}), "status 404")
+}
@@ -0,0 +1,40 @@
+package web
+
+import (
+	"fmt"
+	"os"
+
+	"phobos.org.uk/agency/internal/backup"
+)
+
+// newBackups returns the runner that archives the session and auth stores,
+// or nil if no backup destination is configured.
+func newBackups(cfg *Config, version string, sessions *SessionStore) (*backup.Runner, error) {
+	if cfg.Backup.Destination == "" {
+		return nil, nil
+	}
+	opts := cfg.Backup
+	opts.Prefix = "web"
+	opts.Version = version
+	if opts.OnResult == nil {
+		opts.OnResult = logBackup
+	}
+	sources := []backup.Source{{Name: "sessions.json", Snapshot: sessions.Snapshot}}
+	if cfg.AuthStore != nil {
+		sources = append(sources, backup.Source{Name: "auth-store.json", Snapshot: cfg.AuthStore.Snapshot})
+	}
+	runner, err := backup.New(opts, sources)
+	if err != nil {
+		return nil, fmt.Errorf("configuring backups: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Backups enabled: %s\n", opts.Destination)
+	return runner, nil
+}
+
+func logBackup(status backup.Status) {
+	if status.LastError != "" {
+		fmt.Fprintf(os.Stderr, "Backup to %s failed: %s\n", status.Destination, status.LastError)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Backup written: %s (%d bytes)\n", status.LastArchive, status.LastSizeBytes)
+}
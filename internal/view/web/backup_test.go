@@ -0,0 +1,90 @@
+package web
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/backup"
+)
+
+func TestDirectorBackups(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	authStore, err := NewAuthStore(filepath.Join(tmpDir, "auth.json"), "password")
+	require.NoError(t, err)
+	dest := filepath.Join(tmpDir, "backups")
+	tlsCfg := TLSConfig{CertFile: filepath.Join(tmpDir, "cert.pem"), KeyFile: filepath.Join(tmpDir, "key.pem"), AutoGenerate: true}
+	d, err := New(&Config{AuthStore: authStore, QueueDir: filepath.Join(tmpDir, "queue"), TLS: tlsCfg}, "test")
+	require.NoError(t, err)
+	require.Nil(t, d.backups)
+
+	d, err = New(&Config{AuthStore: authStore, QueueDir: filepath.Join(tmpDir, "queue"), TLS: tlsCfg, Backup: backup.Options{Destination: dest}}, "test")
+	require.NoError(t, err)
+	require.NotNil(t, d.backups)
+
+	sessions := d.handlers.sessionStore
+	sessions.AddTask("sess-1", "http://localhost:9000", "task-1", "completed", "first")
+	sessions.AddTask("sess-2", "http://localhost:9000", "task-2", "completed", "second")
+	require.True(t, sessions.Archive("sess-2"))
+
+	name, err := d.backups.Backup(context.Background())
+	require.NoError(t, err)
+	require.Regexp(t, `^web-.*\.tar\.gz$`, name)
+
+	files := readTarGz(t, filepath.Join(dest, name))
+	require.Contains(t, files, "manifest.json")
+	require.Contains(t, files, "auth-store.json")
+	var snapshot struct {
+		Sessions []Session `json:"sessions"`
+	}
+	require.NoError(t, json.Unmarshal(files["sessions.json"], &snapshot))
+	require.Len(t, snapshot.Sessions, 2) // Archived sessions are kept too
+
+	rec := httptest.NewRecorder()
+	d.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var status struct {
+		Backup struct {
+			Destination string `json:"destination"`
+			LastArchive string `json:"last_archive"`
+		} `json:"backup"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	require.Equal(t, dest, status.Backup.Destination)
+	require.Equal(t, name, status.Backup.LastArchive)
+
+	// A bad destination stops the director starting
+	_, err = New(&Config{AuthStore: authStore, QueueDir: filepath.Join(tmpDir, "queue"), TLS: tlsCfg, Backup: backup.Options{Destination: "relative/dir"}}, "test")
+	require.ErrorContains(t, err, "configuring backups")
+}
+
+// readTarGz returns the files in a gzipped tar by name.
+func readTarGz(t *testing.T, path string) map[string][]byte {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	files := map[string][]byte{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[hdr.Name] = data
+	}
+}
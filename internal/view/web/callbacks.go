@@ -0,0 +1,210 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"phobos.org.uk/agency/internal/api"
+)
+
+// Result callback delivery
+const (
+	DefaultCallbackAttempts = 5               // Deliveries tried before giving up
+	DefaultCallbackBackoff  = 2 * time.Second // Delay before the first retry, doubling after each
+	callbackTimeout         = 15 * time.Second
+)
+
+// taskResult is the subset of an agent history entry reported when a queued
+// task finishes.
+type taskResult struct {
+	SessionID       string           `json:"session_id"`
+	Output          string           `json:"output"`
+	ExitCode        *int             `json:"exit_code"`
+	Error           *taskResultError `json:"error"`
+	TokenUsage      json.RawMessage  `json:"token_usage"`
+	StartedAt       *time.Time       `json:"started_at"`
+	CompletedAt     *time.Time       `json:"completed_at"`
+	DurationSeconds float64          `json:"duration_seconds"`
+}
+
+type taskResultError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// fetchTaskResult reads a finished task's history entry from its agent.
+func fetchTaskResult(client *http.Client, agentURL, taskID string) (*taskResult, error) {
+	resp, err := client.Get(agentURL + "/history/" + url.PathEscape(taskID))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("agent returned status %d", resp.StatusCode)
+	}
+	var result taskResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("parsing history: %w", err)
+	}
+	return &result, nil
+}
+
+// validateCallbackURL checks that a callback_url is an absolute http(s) URL.
+func validateCallbackURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("callback_url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// CallbackPayload is POSTed to a queued task's callback_url when it finishes.
+type CallbackPayload struct {
+	QueueID         string           `json:"queue_id"`
+	RequestID       string           `json:"request_id,omitempty"`
+	State           string           `json:"state"` // completed, failed, cancelled or expired
+	TaskID          string           `json:"task_id,omitempty"`
+	SessionID       string           `json:"session_id,omitempty"`
+	AgentURL        string           `json:"agent_url,omitempty"`
+	Source          string           `json:"source,omitempty"`
+	SourceJob       string           `json:"source_job,omitempty"`
+	Output          string           `json:"output,omitempty"`
+	ExitCode        *int             `json:"exit_code,omitempty"`
+	Error           *taskResultError `json:"error,omitempty"`
+	TokenUsage      json.RawMessage  `json:"token_usage,omitempty"`
+	StartedAt       *time.Time       `json:"started_at,omitempty"`
+	CompletedAt     *time.Time       `json:"completed_at,omitempty"`
+	DurationSeconds float64          `json:"duration_seconds,omitempty"`
+	QueueError      string           `json:"queue_error,omitempty"`  // Why the queue failed or expired the task, if it did
+	ResultError     string           `json:"result_error,omitempty"` // Why the agent's result couldn't be fetched
+}
+
+// ResultCallbacks delivers the results of queued tasks that set a
+// callback_url, retrying with exponential backoff. Deliveries are held in
+// memory, so any in progress when the director stops are lost.
+type ResultCallbacks struct {
+	client      *http.Client // Callback receivers
+	agentClient *http.Client // Fetches task results from agents
+	attempts    int
+	backoff     time.Duration
+}
+
+// NewResultCallbacks creates a callback sender.
+func NewResultCallbacks() *ResultCallbacks {
+	return &ResultCallbacks{
+		client:      &http.Client{Timeout: callbackTimeout},
+		agentClient: createHTTPClient(callbackTimeout, ""),
+		attempts:    DefaultCallbackAttempts,
+		backoff:     DefaultCallbackBackoff,
+	}
+}
+
+// SetAuthToken sets the bearer token sent to agents
+func (c *ResultCallbacks) SetAuthToken(token string) {
+	c.agentClient = createHTTPClient(callbackTimeout, token)
+}
+
+// TaskFinished sends the result of a task with a callback_url in the
+// background.
+func (c *ResultCallbacks) TaskFinished(task *QueuedTask, state string) {
+	if task.CallbackURL == "" {
+		return
+	}
+	payload := CallbackPayload{
+		QueueID:   task.QueueID,
+		RequestID: task.RequestID,
+		State:     state,
+		TaskID:    task.TaskID,
+		SessionID: task.SessionID,
+		AgentURL:  task.AgentURL,
+		Source:    task.Source,
+		SourceJob: task.SourceJob,
+	}
+	if state == string(TaskStateFailed) || state == string(TaskStateExpired) {
+		payload.QueueError = task.LastError
+	}
+	callbackURL := task.CallbackURL
+	go func() {
+		c.fillResult(&payload)
+		if err := c.deliver(callbackURL, payload); err != nil {
+			fmt.Fprintf(os.Stderr, "queue: callback for %s failed: %v\n", payload.QueueID, err)
+		}
+	}()
+}
+
+// fillResult adds the agent's record of the task, if it ran.
+func (c *ResultCallbacks) fillResult(p *CallbackPayload) {
+	if p.AgentURL == "" || p.TaskID == "" {
+		return
+	}
+	result, err := fetchTaskResult(c.agentClient, p.AgentURL, p.TaskID)
+	if err != nil {
+		p.ResultError = err.Error()
+		return
+	}
+	if result.SessionID != "" {
+		p.SessionID = result.SessionID
+	}
+	p.Output = result.Output
+	p.ExitCode = result.ExitCode
+	p.Error = result.Error
+	p.TokenUsage = result.TokenUsage
+	p.StartedAt = result.StartedAt
+	p.CompletedAt = result.CompletedAt
+	p.DurationSeconds = result.DurationSeconds
+}
+
+// deliver POSTs payload until the receiver answers 2xx, it rejects the
+// payload with a 4xx other than 408 or 429, or the attempts run out.
+func (c *ResultCallbacks) deliver(callbackURL string, payload CallbackPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	backoff := c.backoff
+	var lastErr error
+	for attempt := 1; attempt <= c.attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		req, err := http.NewRequest(http.MethodPost, callbackURL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "agency-director")
+		req.Header.Set("X-Agency-Queue-ID", payload.QueueID)
+		if payload.RequestID != "" {
+			req.Header.Set(api.RequestIDHeader, payload.RequestID)
+		}
+		req.Header.Set("X-Agency-Delivery-Attempt", fmt.Sprint(attempt))
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		lastErr = fmt.Errorf("receiver returned status %d", resp.StatusCode)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return lastErr
+		}
+	}
+	return fmt.Errorf("giving up after %d attempts: %w", c.attempts, lastErr)
+}
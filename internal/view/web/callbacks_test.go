@@ -0,0 +1,140 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCallbacks() *ResultCallbacks {
+	c := NewResultCallbacks()
+	c.backoff = time.Millisecond
+	return c
+}
+
+func TestResultCallbackDelivery(t *testing.T) {
+	t.Parallel()
+
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/history/task-7", r.URL.Path)
+		writeJSON(w, http.StatusOK, map[string]any{
+			"task_id":          "task-7",
+			"session_id":       "sess-1",
+			"state":            "completed",
+			"output":           "All tests pass.",
+			"exit_code":        0,
+			"token_usage":      map[string]int{"input": 1200, "output": 340},
+			"duration_seconds": 42.5,
+		})
+	}))
+	defer agent.Close()
+
+	var attempts atomic.Int32
+	received := make(chan CallbackPayload, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail the first two deliveries to exercise the retries
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		require.Equal(t, "queue-1", r.Header.Get("X-Agency-Queue-ID"))
+		require.Equal(t, "3", r.Header.Get("X-Agency-Delivery-Attempt"))
+		var payload CallbackPayload
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		received <- payload
+	}))
+	defer receiver.Close()
+
+	c := newTestCallbacks()
+	c.TaskFinished(&QueuedTask{QueueID: "queue-0"}, "completed") // No callback_url: nothing sent
+	c.TaskFinished(&QueuedTask{
+		QueueID:     "queue-1",
+		TaskID:      "task-7",
+		AgentURL:    agent.URL,
+		Source:      "cli",
+		CallbackURL: receiver.URL + "/hook",
+	}, "completed")
+
+	select {
+	case payload := <-received:
+		require.Equal(t, "queue-1", payload.QueueID)
+		require.Equal(t, "completed", payload.State)
+		require.Equal(t, "task-7", payload.TaskID)
+		require.Equal(t, "sess-1", payload.SessionID)
+		require.Equal(t, "All tests pass.", payload.Output)
+		require.Equal(t, 0, *payload.ExitCode)
+		require.JSONEq(t, `{"input":1200,"output":340}`, string(payload.TokenUsage))
+		require.Equal(t, 42.5, payload.DurationSeconds)
+		require.Empty(t, payload.ResultError)
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback not delivered")
+	}
+	require.Equal(t, int32(3), attempts.Load())
+}
+
+func TestResultCallbackGivesUp(t *testing.T) {
+	t.Parallel()
+
+	var attempts atomic.Int32
+	status := atomic.Int32{}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer receiver.Close()
+
+	c := newTestCallbacks()
+	payload := CallbackPayload{QueueID: "queue-1", State: "failed", QueueError: "agent busy"}
+
+	// Server errors are retried until the attempts run out
+	status.Store(http.StatusServiceUnavailable)
+	err := c.deliver(receiver.URL, payload)
+	require.ErrorContains(t, err, "giving up after 5 attempts")
+	require.Equal(t, int32(5), attempts.Load())
+
+	// A client error means the receiver won't accept it, so don't retry
+	attempts.Store(0)
+	status.Store(http.StatusNotFound)
+	err = c.deliver(receiver.URL, payload)
+	require.ErrorContains(t, err, "status 404")
+	require.Equal(t, int32(1), attempts.Load())
+
+	// Except for rate limiting
+	attempts.Store(0)
+	status.Store(http.StatusTooManyRequests)
+	require.Error(t, c.deliver(receiver.URL, payload))
+	require.Equal(t, int32(5), attempts.Load())
+}
+
+func TestResultCallbackUndispatchedTask(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan CallbackPayload, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload CallbackPayload
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		received <- payload
+	}))
+	defer receiver.Close()
+
+	newTestCallbacks().TaskFinished(&QueuedTask{
+		QueueID:     "queue-2",
+		LastError:   "session agent gone",
+		CallbackURL: receiver.URL,
+	}, "failed")
+
+	select {
+	case payload := <-received:
+		require.Equal(t, "failed", payload.State)
+		require.Equal(t, "session agent gone", payload.QueueError)
+		require.Empty(t, payload.TaskID)
+		require.Empty(t, payload.ResultError)
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback not delivered")
+	}
+}
@@ -0,0 +1,111 @@
+package web
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const clientContextKey contextKey = "client"
+
+// clientInfo is the resolved origin of a request.
+type clientInfo struct {
+	addr         netip.Addr // Client address (the peer unless a trusted proxy vouched for another)
+	trustedProxy bool       // Peer is a trusted proxy, so its X-Forwarded-* headers are honoured
+	forwarded    bool       // Request carried X-Real-IP or X-Forwarded-For
+}
+
+// ParseTrustedProxies parses a comma-separated list of proxy CIDRs or
+// addresses, e.g. "127.0.0.1,10.0.0.0/8".
+func ParseTrustedProxies(spec string) ([]netip.Prefix, error) {
+	return parsePrefixes(spec)
+}
+
+// ClientIPMiddleware resolves the client address of each request. X-Real-IP
+// and X-Forwarded-For are only honoured when the connecting peer is in
+// trusted; otherwise the socket address is used, so clients cannot spoof
+// their address by sending the headers themselves.
+func ClientIPMiddleware(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			info := resolveClient(r, trusted)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientContextKey, info)))
+		})
+	}
+}
+
+// resolveClient works out where r came from.
+func resolveClient(r *http.Request, trusted []netip.Prefix) clientInfo {
+	info := clientInfo{
+		addr:      peerAddr(r),
+		forwarded: r.Header.Get("X-Real-IP") != "" || r.Header.Get("X-Forwarded-For") != "",
+	}
+	if !info.addr.IsValid() || !prefixesContain(trusted, info.addr) {
+		return info
+	}
+	info.trustedProxy = true
+
+	if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		info.addr = addr.Unmap().WithZone("")
+		return info
+	}
+	// Walk X-Forwarded-For from the right (nearest hop), skipping trusted
+	// proxies; entries further left are client-supplied and can't be trusted.
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		info.addr = addr.Unmap().WithZone("")
+		if !prefixesContain(trusted, info.addr) {
+			break
+		}
+	}
+	return info
+}
+
+// peerAddr returns the socket address of the connecting peer.
+func peerAddr(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap().WithZone("")
+}
+
+// clientFromRequest returns the resolved client, resolving it without trusted
+// proxies if ClientIPMiddleware did not run.
+func clientFromRequest(r *http.Request) clientInfo {
+	if info, ok := r.Context().Value(clientContextKey).(clientInfo); ok {
+		return info
+	}
+	return resolveClient(r, nil)
+}
+
+// clientIP returns the client address of r for logging and session records.
+func clientIP(r *http.Request) string {
+	if addr := clientFromRequest(r).addr; addr.IsValid() {
+		return addr.String()
+	}
+	return r.RemoteAddr
+}
+
+// prefixesContain reports whether any prefix contains addr.
+func prefixesContain(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveClient(t *testing.T) {
+	t.Parallel()
+
+	trusted, err := ParseTrustedProxies("10.0.0.1, 192.168.0.0/24")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		peer    string
+		headers map[string]string
+		want    string
+		proxy   bool
+	}{
+		{"direct", "203.0.113.7:4000", nil, "203.0.113.7", false},
+		{"spoofed real ip", "203.0.113.7:4000", map[string]string{"X-Real-IP": "10.8.0.1"}, "203.0.113.7", false},
+		{"spoofed forwarded for", "203.0.113.7:4000", map[string]string{"X-Forwarded-For": "10.8.0.1"}, "203.0.113.7", false},
+		{"trusted real ip", "10.0.0.1:4000", map[string]string{"X-Real-IP": "198.51.100.2"}, "198.51.100.2", true},
+		{"trusted forwarded for", "10.0.0.1:4000", map[string]string{"X-Forwarded-For": "198.51.100.2"}, "198.51.100.2", true},
+		// Client-supplied entries left of the first untrusted hop are ignored
+		{"forwarded chain", "10.0.0.1:4000", map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.2, 192.168.0.7"}, "198.51.100.2", true},
+		{"garbage forwarded for", "10.0.0.1:4000", map[string]string{"X-Forwarded-For": "nonsense"}, "10.0.0.1", true},
+		{"mapped peer", "[::ffff:203.0.113.7]:4000", nil, "203.0.113.7", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.peer
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		info := resolveClient(req, trusted)
+		require.Equal(t, tt.want, info.addr.String(), tt.name)
+		require.Equal(t, tt.proxy, info.trustedProxy, tt.name)
+	}
+}
+
+func TestClientIPMiddleware(t *testing.T) {
+	t.Parallel()
+
+	var got string
+	handler := ClientIPMiddleware([]netip.Prefix{netip.MustParsePrefix("10.0.0.1/32")})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = clientIP(r)
+		}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:4000"
+	req.Header.Set("X-Real-IP", "198.51.100.2")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	require.Equal(t, "198.51.100.2", got)
+
+	// Without the middleware only the socket address is used
+	require.Equal(t, "10.0.0.1", clientIP(req))
+}
+
+func TestHandleLoginIgnoresSpoofedIP(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewAuthStore(filepath.Join(t.TempDir(), "auth.json"), "password")
+	require.NoError(t, err)
+	h, err := NewHandlers(NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000}), "test", store, false)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/login", strings.NewReader("password=password"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Real-IP", "10.8.0.1")
+	req.RemoteAddr = "203.0.113.7:4000"
+	rec := httptest.NewRecorder()
+	ClientIPMiddleware(nil)(http.HandlerFunc(h.HandleLogin)).ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	sessions := store.ListAllSessions()
+	require.Len(t, sessions, 1)
+	require.Equal(t, "203.0.113.7", sessions[0].IPAddress)
+}
@@ -0,0 +1,286 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"phobos.org.uk/agency/internal/api"
+)
+
+// Comparison limits
+const (
+	maxComparisonRuns      = 4
+	maxFinishedComparisons = 100 // Finished comparisons kept for status queries
+	comparisonFetchTimeout = 15 * time.Second
+)
+
+// Comparison states
+const (
+	ComparisonRunning   = "running"
+	ComparisonCompleted = "completed"
+)
+
+// defaultCompareKinds are compared when a request names no agent kinds.
+var defaultCompareKinds = []string{api.AgentKindClaude, api.AgentKindCodex}
+
+// CompareRequest is the body of POST /api/task/compare. The options apply
+// to every run.
+type CompareRequest struct {
+	Prompt         string            `json:"prompt"`
+	AgentKinds     []string          `json:"agent_kinds,omitempty"` // One run per entry (default: claude, codex)
+	Tier           string            `json:"tier,omitempty"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`
+	RequestID      string            `json:"-"` // Shared by every run
+	api.RunnerOptions
+}
+
+// ComparisonRun is one agent's run of the compared prompt.
+type ComparisonRun struct {
+	AgentKind       string           `json:"agent_kind"`
+	QueueID         string           `json:"queue_id"`
+	State           string           `json:"state"` // The queued task's state
+	TaskID          string           `json:"task_id,omitempty"`
+	AgentURL        string           `json:"agent_url,omitempty"`
+	SessionID       string           `json:"session_id,omitempty"`
+	Output          string           `json:"output,omitempty"`
+	Error           *taskResultError `json:"error,omitempty"`
+	QueueError      string           `json:"queue_error,omitempty"`  // Why the queue failed the run, if it did
+	ResultError     string           `json:"result_error,omitempty"` // Why the output couldn't be read from the agent
+	DurationSeconds float64          `json:"duration_seconds,omitempty"`
+}
+
+// Comparison runs one prompt on several agents, each in a new session, so
+// their outputs can be compared side by side.
+type Comparison struct {
+	ID         string          `json:"comparison_id"`
+	State      string          `json:"state"` // running until every run has finished
+	Prompt     string          `json:"prompt"`
+	CreatedAt  time.Time       `json:"created_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+	Runs       []ComparisonRun `json:"runs"`
+
+	pending int // Runs not yet finished
+}
+
+// Comparisons queues the runs of comparisons and collects their results.
+// It learns that a run finished through TaskFinished, called from the
+// event bus for task.finished events. Comparisons are kept in memory only.
+type Comparisons struct {
+	mu          sync.Mutex
+	queue       *WorkQueue
+	agentClient *http.Client // Fetches run output from agents
+	byID        map[string]*Comparison
+	byQueueID   map[string]runRef // Run of each queued task
+	finished    []string          // IDs of finished comparisons, oldest first
+}
+
+// runRef locates a run within its comparison.
+type runRef struct {
+	cmp   *Comparison
+	index int
+}
+
+// NewComparisons creates a comparison runner that queues runs on queue.
+func NewComparisons(queue *WorkQueue) *Comparisons {
+	return &Comparisons{
+		queue:       queue,
+		agentClient: createHTTPClient(comparisonFetchTimeout, ""),
+		byID:        make(map[string]*Comparison),
+		byQueueID:   make(map[string]runRef),
+	}
+}
+
+// SetAuthToken sets the bearer token sent to agents
+func (c *Comparisons) SetAuthToken(token string) {
+	c.agentClient = createHTTPClient(comparisonFetchTimeout, token)
+}
+
+// Start creates a comparison and queues one run per agent kind. If the
+// queue can't take every run, those already queued are cancelled.
+func (c *Comparisons) Start(req CompareRequest) (*Comparison, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cmp := &Comparison{
+		ID:        fmt.Sprintf("compare-%d", time.Now().UnixNano()),
+		State:     ComparisonRunning,
+		Prompt:    req.Prompt,
+		CreatedAt: time.Now(),
+	}
+	var queued []*QueuedTask
+	for _, kind := range req.AgentKinds {
+		task, _, err := c.queue.Add(QueueSubmitRequest{
+			Prompt:         req.Prompt,
+			Tier:           req.Tier,
+			TimeoutSeconds: req.TimeoutSeconds,
+			Env:            req.Env,
+			Source:         "compare",
+			RequestID:      req.RequestID,
+			SourceJob:      cmp.ID,
+			AgentKind:      kind,
+			RunnerOptions:  req.RunnerOptions,
+		})
+		if err != nil {
+			for _, t := range queued {
+				c.queue.Cancel(t.QueueID)
+			}
+			return nil, err
+		}
+		queued = append(queued, task)
+		cmp.Runs = append(cmp.Runs, ComparisonRun{AgentKind: kind, QueueID: task.QueueID, State: string(task.State)})
+	}
+	cmp.pending = len(cmp.Runs)
+	for i, t := range queued {
+		c.byQueueID[t.QueueID] = runRef{cmp: cmp, index: i}
+	}
+	c.byID[cmp.ID] = cmp
+	return cmp.snapshot(c.queue), nil
+}
+
+// TaskFinished records the end of a comparison run, if task is one, and
+// fetches its output from the agent in the background.
+func (c *Comparisons) TaskFinished(task *QueuedTask, state string) {
+	c.mu.Lock()
+	ref, ok := c.byQueueID[task.QueueID]
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.byQueueID, task.QueueID)
+	run := &ref.cmp.Runs[ref.index]
+	run.State = state
+	run.TaskID = task.TaskID
+	run.AgentURL = task.AgentURL
+	run.SessionID = task.SessionID
+	if state != string(TaskStateCompleted) {
+		run.QueueError = task.LastError
+	}
+	agentURL, taskID := task.AgentURL, task.TaskID
+	c.mu.Unlock()
+
+	if agentURL == "" || taskID == "" {
+		c.runDone(ref, nil, nil)
+		return
+	}
+	go func() {
+		result, err := fetchTaskResult(c.agentClient, agentURL, taskID)
+		c.runDone(ref, result, err)
+	}()
+}
+
+// runDone stores a finished run's result and finishes the comparison once
+// every run is done.
+func (c *Comparisons) runDone(ref runRef, result *taskResult, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cmp := ref.cmp
+	run := &cmp.Runs[ref.index]
+	if err != nil {
+		run.ResultError = err.Error()
+	} else if result != nil {
+		run.Output = result.Output
+		run.Error = result.Error
+		run.DurationSeconds = result.DurationSeconds
+	}
+
+	cmp.pending--
+	if cmp.pending > 0 {
+		return
+	}
+	now := time.Now()
+	cmp.State = ComparisonCompleted
+	cmp.FinishedAt = &now
+	fmt.Fprintf(os.Stderr, "compare: %s completed\n", cmp.ID)
+
+	c.finished = append(c.finished, cmp.ID)
+	for len(c.finished) > maxFinishedComparisons {
+		delete(c.byID, c.finished[0])
+		c.finished = c.finished[1:]
+	}
+}
+
+// Get returns a copy of a comparison, or nil
+func (c *Comparisons) Get(id string) *Comparison {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cmp, ok := c.byID[id]
+	if !ok {
+		return nil
+	}
+	return cmp.snapshot(c.queue)
+}
+
+// snapshot copies cmp, filling in the live state of runs still in the queue.
+func (cmp *Comparison) snapshot(queue *WorkQueue) *Comparison {
+	cp := *cmp
+	cp.Runs = append([]ComparisonRun(nil), cmp.Runs...)
+	for i := range cp.Runs {
+		run := &cp.Runs[i]
+		if task := queue.Get(run.QueueID); task != nil {
+			run.State = string(task.State)
+			run.TaskID = task.TaskID
+			run.AgentURL = task.AgentURL
+		}
+	}
+	return &cp
+}
+
+// HandleSubmit handles POST /api/task/compare
+func (c *Comparisons) HandleSubmit(w http.ResponseWriter, r *http.Request) {
+	var req CompareRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.RequestID = api.RequestIDFromContext(r.Context())
+
+	if req.Prompt == "" {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "prompt is required")
+		return
+	}
+	if len(req.AgentKinds) == 0 {
+		req.AgentKinds = defaultCompareKinds
+	}
+	if len(req.AgentKinds) < 2 || len(req.AgentKinds) > maxComparisonRuns {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation,
+			fmt.Sprintf("agent_kinds must list 2 to %d agent kinds", maxComparisonRuns))
+		return
+	}
+	for _, kind := range req.AgentKinds {
+		if !api.IsValidAgentKind(kind) {
+			writeError(w, http.StatusBadRequest, api.ErrorValidation, "agent_kinds entries must be claude or codex")
+			return
+		}
+	}
+	if req.Tier != "" && !api.IsValidTier(req.Tier) {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "tier must be fast, standard, or heavy")
+		return
+	}
+
+	cmp, err := c.Start(req)
+	if err == ErrQueueFull {
+		writeError(w, http.StatusServiceUnavailable, api.ErrorQueueFull,
+			fmt.Sprintf("Queue is at capacity (%d tasks)", c.queue.Config().MaxSize))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, api.ErrorQueueError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, cmp)
+}
+
+// HandleStatus handles GET /api/task/compare/{id}
+func (c *Comparisons) HandleStatus(w http.ResponseWriter, r *http.Request, id string) {
+	cmp := c.Get(id)
+	if cmp == nil {
+		writeError(w, http.StatusNotFound, api.ErrorNotFound, "Comparison not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, cmp)
+}
@@ -0,0 +1,116 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestComparisonCollectsOutputs(t *testing.T) {
+	t.Parallel()
+
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"output":           "output of " + r.URL.Path,
+			"duration_seconds": 12.5,
+		})
+	}))
+	t.Cleanup(agent.Close)
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	c := NewComparisons(q)
+
+	cmp, err := c.Start(CompareRequest{Prompt: "Explain this repo", AgentKinds: []string{"claude", "codex"}, Tier: "fast"})
+	require.NoError(t, err)
+	require.Equal(t, ComparisonRunning, cmp.State)
+	require.Len(t, cmp.Runs, 2)
+	require.Equal(t, 2, q.Depth())
+	for i, kind := range []string{"claude", "codex"} {
+		task := q.Get(cmp.Runs[i].QueueID)
+		require.Equal(t, kind, task.AgentKind)
+		require.Equal(t, "fast", task.Tier)
+		require.Equal(t, cmp.ID, task.SourceJob)
+	}
+
+	// One run completes; the comparison waits for the other
+	claude := q.Get(cmp.Runs[0].QueueID)
+	q.SetDispatched(claude, agent.URL, "task-claude", "sess-claude", "test")
+	q.Remove(claude)
+	c.TaskFinished(claude, "completed")
+	require.Eventually(t, func() bool {
+		return c.Get(cmp.ID).Runs[0].Output != ""
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, ComparisonRunning, c.Get(cmp.ID).State)
+
+	// The other is cancelled before it runs
+	codex, _ := q.Cancel(cmp.Runs[1].QueueID)
+	c.TaskFinished(codex, "cancelled")
+
+	got := c.Get(cmp.ID)
+	require.Equal(t, ComparisonCompleted, got.State)
+	require.NotNil(t, got.FinishedAt)
+	require.Equal(t, "output of /history/task-claude", got.Runs[0].Output)
+	require.Equal(t, 12.5, got.Runs[0].DurationSeconds)
+	require.Equal(t, "sess-claude", got.Runs[0].SessionID)
+	require.Equal(t, "cancelled", got.Runs[1].State)
+	require.Empty(t, got.Runs[1].Output)
+}
+
+func TestComparisonHandlers(t *testing.T) {
+	t.Parallel()
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir(), MaxSize: 3})
+	require.NoError(t, err)
+	c := NewComparisons(q)
+
+	for _, body := range []string{
+		`{"agent_kinds": ["claude", "codex"]}`,
+		`{"prompt": "p", "agent_kinds": ["claude"]}`,
+		`{"prompt": "p", "agent_kinds": ["claude", "gpt"]}`,
+		`{"prompt": "p", "tier": "huge"}`,
+	} {
+		rec := httptest.NewRecorder()
+		c.HandleSubmit(rec, httptest.NewRequest("POST", "/api/task/compare", bytes.NewBufferString(body)))
+		require.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+
+	// Agent kinds default to claude and codex
+	rec := httptest.NewRecorder()
+	c.HandleSubmit(rec, httptest.NewRequest("POST", "/api/task/compare", bytes.NewBufferString(`{"prompt": "p"}`)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var created Comparison
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	require.Len(t, created.Runs, 2)
+	require.Equal(t, "claude", created.Runs[0].AgentKind)
+	require.Equal(t, "codex", created.Runs[1].AgentKind)
+
+	// A comparison the queue can't fully take queues nothing
+	rec = httptest.NewRecorder()
+	c.HandleSubmit(rec, httptest.NewRequest("POST", "/api/task/compare", bytes.NewBufferString(`{"prompt": "p"}`)))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Equal(t, 2, q.Depth())
+
+	rec = httptest.NewRecorder()
+	c.HandleStatus(rec, httptest.NewRequest("GET", "/api/task/compare/"+created.ID, nil), created.ID)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	c.HandleStatus(rec, httptest.NewRequest("GET", "/api/task/compare/nope", nil), "nope")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandleComparePage(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandlers(t, NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000}), "test")
+	rec := httptest.NewRecorder()
+	h.HandleComparePage(rec, httptest.NewRequest("GET", "/compare/compare-1", nil), `compare-1"><script>`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `data-comparison-id="compare-1&#34;&gt;&lt;script&gt;"`)
+}
@@ -0,0 +1,224 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// maxDashboardSnapshots is how many recent dashboard versions deltas can be
+// computed from. Session times are formatted per viewer, so viewers in
+// different time zones poll different versions; this covers several at once.
+const maxDashboardSnapshots = 64
+
+// DashboardDelta is the response to GET /api/dashboard?since=<etag>: what
+// changed since that version. Lists give changed entries whole, tombstones
+// for removed ones, and their new order only when it is not implied.
+// Other sections appear, whole, only when they changed, and are null when
+// they went away.
+type DashboardDelta struct {
+	Delta      bool            `json:"delta"` // Always true, telling deltas from full responses
+	Since      string          `json:"since"`
+	Agents     *ListDelta      `json:"agents,omitempty"`      // Keyed by url
+	Directors  *ListDelta      `json:"directors,omitempty"`   // Keyed by url
+	Helpers    *ListDelta      `json:"helpers,omitempty"`     // Keyed by url
+	Sessions   *ListDelta      `json:"sessions,omitempty"`    // Keyed by id
+	Queue      json.RawMessage `json:"queue,omitempty"`       // Without tasks
+	QueueTasks *ListDelta      `json:"queue_tasks,omitempty"` // Keyed by queue_id
+	Pipelines  json.RawMessage `json:"pipelines,omitempty"`
+	Recurring  json.RawMessage `json:"recurring,omitempty"`
+	Autoscale  json.RawMessage `json:"autoscale,omitempty"`
+}
+
+// ListDelta is the change to a keyed list. Clients drop removed entries,
+// replace changed ones in place and append new ones; order, when present,
+// lists every key in the new order.
+type ListDelta struct {
+	Changed []json.RawMessage `json:"changed,omitempty"`
+	Removed []string          `json:"removed,omitempty"`
+	Order   []string          `json:"order,omitempty"`
+}
+
+// listSnapshot records a list's keys in order and a hash of each entry.
+type listSnapshot struct {
+	keys   []string
+	hashes map[string][32]byte
+	raw    map[string]json.RawMessage // Current version only; not kept in the cache
+}
+
+// dashboardSnapshot is one version of the dashboard, reduced to hashes.
+type dashboardSnapshot struct {
+	lists    map[string]*listSnapshot
+	sections map[string][32]byte
+	raw      map[string]json.RawMessage // Current version only
+}
+
+// dashboardSnapshots remembers recent versions by ETag, oldest evicted first.
+type dashboardSnapshots struct {
+	mu    sync.Mutex
+	byTag map[string]*dashboardSnapshot
+	order []string
+}
+
+// get returns the snapshot for an ETag, quoted or not.
+func (s *dashboardSnapshots) get(etag string) *dashboardSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.byTag[quoteETag(etag)]
+}
+
+// put stores a snapshot without its raw JSON.
+func (s *dashboardSnapshots) put(etag string, snap *dashboardSnapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byTag[etag]; ok {
+		return
+	}
+	if s.byTag == nil {
+		s.byTag = make(map[string]*dashboardSnapshot)
+	}
+	stored := &dashboardSnapshot{lists: make(map[string]*listSnapshot, len(snap.lists)), sections: snap.sections}
+	for name, list := range snap.lists {
+		stored.lists[name] = &listSnapshot{keys: list.keys, hashes: list.hashes}
+	}
+	s.byTag[etag] = stored
+	s.order = append(s.order, etag)
+	if len(s.order) > maxDashboardSnapshots {
+		delete(s.byTag, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+func quoteETag(etag string) string {
+	return `"` + strings.Trim(etag, `"`) + `"`
+}
+
+// snapshotDashboard hashes each list entry and section of data.
+func snapshotDashboard(data *DashboardData) (*dashboardSnapshot, error) {
+	snap := &dashboardSnapshot{
+		lists:    make(map[string]*listSnapshot),
+		sections: make(map[string][32]byte),
+		raw:      make(map[string]json.RawMessage),
+	}
+	addList := func(name string, n int, entry func(i int) (string, any)) error {
+		list := &listSnapshot{hashes: make(map[string][32]byte, n), raw: make(map[string]json.RawMessage, n)}
+		for i := range n {
+			key, v := entry(i)
+			raw, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			list.keys = append(list.keys, key)
+			list.hashes[key] = sha256.Sum256(raw)
+			list.raw[key] = raw
+		}
+		snap.lists[name] = list
+		return nil
+	}
+	addSection := func(name string, v any) error {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		snap.sections[name] = sha256.Sum256(raw)
+		snap.raw[name] = raw
+		return nil
+	}
+
+	components := func(list []*ComponentStatus) func(int) (string, any) {
+		return func(i int) (string, any) { return list[i].URL, list[i] }
+	}
+	if err := addList("agents", len(data.Agents), components(data.Agents)); err != nil {
+		return nil, err
+	}
+	if err := addList("directors", len(data.Directors), components(data.Directors)); err != nil {
+		return nil, err
+	}
+	if err := addList("helpers", len(data.Helpers), components(data.Helpers)); err != nil {
+		return nil, err
+	}
+	if err := addList("sessions", len(data.Sessions), func(i int) (string, any) {
+		return data.Sessions[i].ID, data.Sessions[i]
+	}); err != nil {
+		return nil, err
+	}
+
+	var queue *QueueInfo
+	var tasks []QueuedTaskSummary
+	if data.Queue != nil {
+		q := *data.Queue
+		tasks, q.Tasks = q.Tasks, nil
+		queue = &q
+	}
+	if err := addList("queue_tasks", len(tasks), func(i int) (string, any) {
+		return tasks[i].QueueID, tasks[i]
+	}); err != nil {
+		return nil, err
+	}
+	if err := addSection("queue", queue); err != nil {
+		return nil, err
+	}
+	if err := addSection("pipelines", data.Pipelines); err != nil {
+		return nil, err
+	}
+	if err := addSection("recurring", data.Recurring); err != nil {
+		return nil, err
+	}
+	if err := addSection("autoscale", data.Autoscale); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// diffDashboard returns the changes from base to cur.
+func diffDashboard(since string, base, cur *dashboardSnapshot) *DashboardDelta {
+	delta := &DashboardDelta{Delta: true, Since: quoteETag(since)}
+	delta.Agents = diffList(base.lists["agents"], cur.lists["agents"])
+	delta.Directors = diffList(base.lists["directors"], cur.lists["directors"])
+	delta.Helpers = diffList(base.lists["helpers"], cur.lists["helpers"])
+	delta.Sessions = diffList(base.lists["sessions"], cur.lists["sessions"])
+	delta.QueueTasks = diffList(base.lists["queue_tasks"], cur.lists["queue_tasks"])
+
+	section := func(name string) json.RawMessage {
+		if base.sections[name] == cur.sections[name] {
+			return nil
+		}
+		return cur.raw[name]
+	}
+	delta.Queue = section("queue")
+	delta.Pipelines = section("pipelines")
+	delta.Recurring = section("recurring")
+	delta.Autoscale = section("autoscale")
+	return delta
+}
+
+// diffList returns the changes from base to cur, or nil if there are none.
+func diffList(base, cur *listSnapshot) *ListDelta {
+	d := &ListDelta{}
+	var kept []string // Order a client arrives at without being told
+	for _, key := range base.keys {
+		if _, ok := cur.hashes[key]; !ok {
+			d.Removed = append(d.Removed, key)
+			continue
+		}
+		kept = append(kept, key)
+	}
+	for _, key := range cur.keys {
+		hash, existed := base.hashes[key]
+		if !existed {
+			kept = append(kept, key)
+		}
+		if !existed || hash != cur.hashes[key] {
+			d.Changed = append(d.Changed, cur.raw[key])
+		}
+	}
+	if !slices.Equal(kept, cur.keys) {
+		d.Order = cur.keys
+	}
+	if len(d.Changed) == 0 && len(d.Removed) == 0 && d.Order == nil {
+		return nil
+	}
+	return d
+}
@@ -0,0 +1,125 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func getDashboard(t *testing.T, h *Handlers, since string) *httptest.ResponseRecorder {
+	t.Helper()
+	target := "/api/dashboard"
+	if since != "" {
+		target += "?since=" + since
+	}
+	rec := httptest.NewRecorder()
+	h.HandleDashboardData(rec, httptest.NewRequest("GET", target, nil))
+	return rec
+}
+
+func TestHandleDashboardDataDelta(t *testing.T) {
+	t.Parallel()
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	h := newTestHandlers(t, d, "test")
+	h.sessionStore.AddTask("sess-1", "http://agent:9000", "task-1", "working", "prompt 1")
+	time.Sleep(10 * time.Millisecond)
+	h.sessionStore.AddTask("sess-2", "http://agent:9001", "task-2", "working", "prompt 2")
+	h.sessionStore.AddTask("sess-3", "http://agent:9002", "task-3", "working", "prompt 3")
+
+	rec := getDashboard(t, h, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	etag1 := rec.Header().Get("ETag")
+
+	// Nothing changed
+	rec = getDashboard(t, h, etag1)
+	require.Equal(t, http.StatusNotModified, rec.Code)
+	require.Equal(t, etag1, rec.Header().Get("ETag"))
+
+	time.Sleep(10 * time.Millisecond)
+	h.sessionStore.UpdateTaskState("sess-1", "task-1", "completed")
+	h.sessionStore.Archive("sess-2")
+
+	rec = getDashboard(t, h, strings.Trim(etag1, `"`))
+	require.Equal(t, http.StatusOK, rec.Code)
+	etag2 := rec.Header().Get("ETag")
+	require.NotEqual(t, etag1, etag2)
+	require.Equal(t, etag2, getDashboard(t, h, "").Header().Get("ETag"), "deltas carry the full data's ETag")
+
+	var delta DashboardDelta
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &delta))
+	require.True(t, delta.Delta)
+	require.Equal(t, etag1, delta.Since)
+	require.Nil(t, delta.Agents)
+	require.Nil(t, delta.Queue)
+	require.Nil(t, delta.Pipelines)
+
+	require.NotNil(t, delta.Sessions)
+	require.Len(t, delta.Sessions.Changed, 1)
+	var session Session
+	require.NoError(t, json.Unmarshal(delta.Sessions.Changed[0], &session))
+	require.Equal(t, "sess-1", session.ID)
+	require.Equal(t, "completed", session.Tasks[0].State)
+	require.Equal(t, []string{"sess-2"}, delta.Sessions.Removed)
+	require.Equal(t, []string{"sess-1", "sess-3"}, delta.Sessions.Order, "sess-1 moved to the top")
+
+	// A version that was never served gets the full data
+	rec = getDashboard(t, h, `"0000000000000000"`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var full map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &full))
+	require.NotContains(t, full, "delta")
+	require.Contains(t, full, "sessions")
+}
+
+func TestDiffList(t *testing.T) {
+	t.Parallel()
+
+	list := func(entries ...string) *listSnapshot {
+		s := &listSnapshot{hashes: make(map[string][32]byte), raw: make(map[string]json.RawMessage)}
+		for _, e := range entries {
+			key, value, _ := strings.Cut(e, "=")
+			s.keys = append(s.keys, key)
+			s.hashes[key] = [32]byte{value[0]}
+			s.raw[key] = json.RawMessage(`"` + e + `"`)
+		}
+		return s
+	}
+
+	require.Nil(t, diffList(list("a=1", "b=1"), list("a=1", "b=1")))
+
+	// Removals and appends are implied, so no order is sent
+	d := diffList(list("a=1", "b=1", "c=1"), list("a=1", "c=2", "d=1"))
+	require.Equal(t, []json.RawMessage{json.RawMessage(`"c=2"`), json.RawMessage(`"d=1"`)}, d.Changed)
+	require.Equal(t, []string{"b"}, d.Removed)
+	require.Nil(t, d.Order)
+
+	// A reorder alone is sent as the new order
+	d = diffList(list("a=1", "b=1"), list("b=1", "a=1"))
+	require.Empty(t, d.Changed)
+	require.Equal(t, []string{"b", "a"}, d.Order)
+
+	// So is a new entry anywhere but the end
+	d = diffList(list("a=1"), list("z=1", "a=1"))
+	require.Len(t, d.Changed, 1)
+	require.Equal(t, []string{"z", "a"}, d.Order)
+}
+
+func TestDashboardSnapshotsEviction(t *testing.T) {
+	t.Parallel()
+
+	var s dashboardSnapshots
+	snap := &dashboardSnapshot{lists: map[string]*listSnapshot{}, sections: map[string][32]byte{}}
+	for i := range maxDashboardSnapshots + 1 {
+		s.put(quoteETag(strings.Repeat("x", i+1)), snap)
+	}
+	require.Nil(t, s.get("x"), "oldest version evicted")
+	require.NotNil(t, s.get("xx"))
+	require.NotNil(t, s.get(`"`+strings.Repeat("x", maxDashboardSnapshots+1)+`"`))
+	require.Len(t, s.order, maxDashboardSnapshots)
+}
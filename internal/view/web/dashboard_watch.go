@@ -0,0 +1,102 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const (
+	maxDashboardWait       = 60 * time.Second // Longest ?wait= on GET /api/dashboard
+	dashboardWatchInterval = time.Second      // How often waiting requests' data is checked
+	dashboardWriteSlack    = 10 * time.Second // Write time allowed after a wait ends
+)
+
+// dashboardWatch tells long-polling dashboard requests when the data has
+// changed. While any are waiting, one goroutine rebuilds the data once a
+// second, and at once on events from the bus, however many requests are
+// waiting.
+type dashboardWatch struct {
+	mu          sync.Mutex
+	waiters     int
+	running     bool
+	changed     chan struct{} // Closed, and replaced, on each change
+	wake        chan struct{} // Rebuild now rather than on the next tick
+	fingerprint [32]byte
+}
+
+// watchDashboard registers a waiting request until the returned function is
+// called.
+func (h *Handlers) watchDashboard() func() {
+	w := &h.dashboardWatch
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.waiters++
+	if !w.running {
+		w.running = true
+		w.changed = make(chan struct{})
+		w.wake = make(chan struct{}, 1)
+		w.fingerprint = h.dashboardFingerprint()
+		go h.runDashboardWatch(w.wake)
+	}
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.waiters--
+	}
+}
+
+// nudge asks for the data to be checked now, if anyone is waiting.
+func (w *dashboardWatch) nudge() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.running {
+		return
+	}
+	select {
+	case w.wake <- struct{}{}:
+	default: // Already due
+	}
+}
+
+// next returns a channel closed on the next change.
+func (w *dashboardWatch) next() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.changed
+}
+
+func (h *Handlers) runDashboardWatch(wake <-chan struct{}) {
+	w := &h.dashboardWatch
+	ticker := time.NewTicker(dashboardWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-wake:
+		}
+		fingerprint := h.dashboardFingerprint()
+		w.mu.Lock()
+		if w.waiters == 0 {
+			w.running = false
+			w.mu.Unlock()
+			return
+		}
+		if fingerprint != w.fingerprint {
+			w.fingerprint = fingerprint
+			close(w.changed)
+			w.changed = make(chan struct{})
+		}
+		w.mu.Unlock()
+	}
+}
+
+// dashboardFingerprint hashes the dashboard data as any viewer would see it.
+// Times are formatted with default preferences; viewers' preferences change
+// how times read, not when they change.
+func (h *Handlers) dashboardFingerprint() [32]byte {
+	data := h.dashboardData(newTimeFormatter(Preferences{}, time.Now()))
+	raw, _ := json.Marshal(data)
+	return sha256.Sum256(raw)
+}
@@ -0,0 +1,72 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func waitDashboard(h *Handlers, wait, etag string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/api/dashboard?wait="+wait, nil)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	rec := httptest.NewRecorder()
+	h.HandleDashboardData(rec, req)
+	return rec
+}
+
+func TestHandleDashboardDataWait(t *testing.T) {
+	t.Parallel()
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	h := newTestHandlers(t, d, "test")
+
+	// Without a version to compare against, the data comes back at once
+	start := time.Now()
+	rec := waitDashboard(h, "30s", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Less(t, time.Since(start), time.Second)
+	etag := rec.Header().Get("ETag")
+
+	// Nothing changes, so the wait runs out
+	start = time.Now()
+	rec = waitDashboard(h, "200ms", etag)
+	require.Equal(t, http.StatusNotModified, rec.Code)
+	require.Equal(t, etag, rec.Header().Get("ETag"))
+	require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+
+	// A change ends the wait
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		h.sessionStore.AddTask("sess-1", "http://agent:9000", "task-1", "working", "prompt")
+	}()
+	start = time.Now()
+	rec = waitDashboard(h, "30s", etag)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotEqual(t, etag, rec.Header().Get("ETag"))
+	require.Contains(t, rec.Body.String(), "sess-1")
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	// The watcher stops once nobody is waiting
+	require.Eventually(t, func() bool {
+		h.dashboardWatch.mu.Lock()
+		defer h.dashboardWatch.mu.Unlock()
+		return !h.dashboardWatch.running
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestHandleDashboardDataWaitInvalid(t *testing.T) {
+	t.Parallel()
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	h := newTestHandlers(t, d, "test")
+
+	for _, wait := range []string{"soon", "-1s", "2m"} {
+		rec := waitDashboard(h, wait, `"abc"`)
+		require.Equal(t, http.StatusBadRequest, rec.Code, wait)
+	}
+}
@@ -3,15 +3,19 @@ package web
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/netip"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/backup"
 )
 
 // Config holds web director configuration
@@ -24,8 +28,27 @@ type Config struct {
 	PortEnd         int // Discovery port range end
 	RefreshInterval time.Duration
 	TLS             TLSConfig
-	AccessLogPath   string // Path for access log file (empty = no logging)
-	QueueDir        string // Path to work queue directory (empty = default)
+	AccessLogPath   string         // Path for access log file (empty = no logging)
+	QueueDir        string         // Path to work queue directory (empty = default)
+	RestartCommand  string         // Shell command to restart one agent during rolling restarts (empty = disabled)
+	AuthToken       string         // Bearer token sent to agents and schedulers (empty = none)
+	IPFilter        *IPFilter      // Client address allow/deny lists (nil = allow all)
+	TrustedProxies  []netip.Prefix // Proxies whose X-Real-IP/X-Forwarded-For are honoured
+	GitHub          GitHubConfig   // GitHub webhook intake (disabled without a webhook secret)
+	RegistrationTTL time.Duration  // How long /api/register registrations last without a heartbeat (default: 90s)
+	SubtaskURL      string         // Director URL tasks use to spawn subtasks (default: internal port, else main port, on 127.0.0.1)
+	PromptRules     PromptRules    // Text added to prompts by task source (nil = none)
+	MetricsInterval time.Duration  // How often metrics history is sampled (default: 1m)
+
+	QueueMaxDispatchesPerHour int              // Queue dispatch limit per rolling hour (0 = unlimited)
+	QueueDispatchWindows      []DispatchWindow // Daily windows restricting when tiers dispatch
+	QueueSourceWeights        map[string]int   // Fair-share dispatch weight per source
+
+	Autoscale AutoscaleConfig // Agent pool scaling hooks (disabled without a command or webhook)
+
+	ComponentURLs []string // Components polled besides the port range, e.g. ssh://host:9000
+
+	Backup backup.Options // Periodic archives of sessions and the auth store (disabled without a destination)
 }
 
 // Director is the web director server
@@ -37,11 +60,23 @@ type Director struct {
 	queueHandlers  *QueueHandlers
 	queue          *WorkQueue
 	dispatcher     *Dispatcher
+	githubHooks    *GitHubHooks
+	pipelines      *Pipelines
+	recurring      *Recurring
+	autoscaler     *Autoscaler // nil = autoscaling disabled
+	backups        *backup.Runner
+	comparisons    *Comparisons
+	uploads        *Uploads
+	subtasks       *Subtasks
+	metrics        *MetricsHistory
+	registrar      *Registrar
 	server         *http.Server
 	internalServer *http.Server // Internal HTTP server (no auth)
+	acmeServer     *http.Server // Answers ACME HTTP-01 challenges (nil = not configured)
 	accessLogger   *AccessLogger
 	authStore      *AuthStore
 	dispatchCancel context.CancelFunc
+	stopCertWatch  context.CancelFunc // Stops reloading the TLS certificate
 }
 
 // New creates a new web director
@@ -66,6 +101,7 @@ func New(cfg *Config, version string) (*Director, error) {
 		RefreshInterval: cfg.RefreshInterval,
 		MaxFailures:     3,
 		SelfPort:        cfg.Port,
+		URLs:            cfg.ComponentURLs,
 	})
 
 	// Create access logger if path configured
@@ -97,19 +133,105 @@ func New(cfg *Config, version string) (*Director, error) {
 		MaxSize:         DefaultMaxSize,
 		MaxAttempts:     DefaultMaxAttempts,
 		DispatchTimeout: DefaultDispatchTimeout,
+		LivenessTimeout: DefaultLivenessTimeout,
+
+		MaxDispatchesPerHour: cfg.QueueMaxDispatchesPerHour,
+		DispatchWindows:      cfg.QueueDispatchWindows,
+		SourceWeights:        cfg.QueueSourceWeights,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("creating work queue: %w", err)
 	}
 
+	// Tell the dashboard, webhooks, audit log and metrics what happens
+	events := NewEventBus()
+	queue.SetEventBus(events)
+	handlers.sessionStore.SetEventBus(events)
+	handlers.SetEventBus(events)
+	if accessLogger != nil {
+		events.Subscribe(accessLogger)
+	}
+
 	// Set queue on handlers for status reporting
 	handlers.SetQueue(queue)
+	handlers.SetAuthToken(cfg.AuthToken)
+	handlers.SetPromptRules(cfg.PromptRules)
+	restarter := NewRestarter(discovery, cfg.RestartCommand)
+	restarter.SetAuthToken(cfg.AuthToken)
+	handlers.SetRestarter(restarter)
+
+	// Rebind sessions when an agent restarts on a different URL
+	discovery.SetRebindFunc(func(oldURL, newURL string) {
+		n := handlers.sessionStore.RebindAgent(oldURL, newURL)
+		fmt.Fprintf(os.Stderr, "discovery: agent moved %s -> %s (rebound %d sessions)\n", oldURL, newURL, n)
+	})
 
 	// Create queue handlers
 	queueHandlers := NewQueueHandlers(queue, discovery, handlers.sessionStore)
+	queueHandlers.SetAuthToken(cfg.AuthToken)
+	// Hold images pasted into the task form until the task is submitted
+	uploads := NewUploads()
+	queueHandlers.SetUploads(uploads)
 
 	// Create dispatcher
 	dispatcher := NewDispatcher(queue, discovery, handlers.sessionStore)
+	dispatcher.SetAuthToken(cfg.AuthToken)
+	dispatcher.SetPromptRules(cfg.PromptRules)
+
+	// Report finished tasks to GitHub issues and callback URLs
+	githubHooks := NewGitHubHooks(cfg.GitHub, queue)
+	githubHooks.SetAuthToken(cfg.AuthToken)
+	callbacks := NewResultCallbacks()
+	callbacks.SetAuthToken(cfg.AuthToken)
+	// Queue the next step of pipelines
+	pipelines := NewPipelines(queue)
+	handlers.SetPipelines(pipelines)
+	// Queue saved tasks on a schedule
+	recurring, err := NewRecurring(queue, filepath.Join(queueDir, "recurring.json"))
+	if err != nil {
+		return nil, fmt.Errorf("creating recurring tasks: %w", err)
+	}
+	handlers.SetRecurring(recurring)
+	// Collect the outputs of compared runs
+	comparisons := NewComparisons(queue)
+	comparisons.SetAuthToken(cfg.AuthToken)
+	// Let running tasks spawn subtasks
+	subtaskURL := cfg.SubtaskURL
+	if subtaskURL == "" {
+		if cfg.InternalPort > 0 {
+			subtaskURL = fmt.Sprintf("http://127.0.0.1:%d", cfg.InternalPort)
+		} else {
+			subtaskURL = fmt.Sprintf("https://127.0.0.1:%d", cfg.Port)
+		}
+	}
+	subtasks, err := NewSubtasks(queue, filepath.Join(queueDir, "subtask.key"), subtaskURL)
+	if err != nil {
+		return nil, fmt.Errorf("creating subtasks: %w", err)
+	}
+	dispatcher.SetTaskEnvFunc(subtasks.TaskEnv)
+	// Sample the fleet for the dashboard's sparklines
+	metrics := NewMetricsHistory(cfg.MetricsInterval, queue, discovery)
+	// Start and stop agents as the queue grows and drains
+	autoscaler := NewAutoscaler(cfg.Autoscale, queue, discovery)
+	handlers.SetAutoscaler(autoscaler)
+	for _, finished := range []func(*QueuedTask, string){
+		metrics.TaskFinished,
+		githubHooks.TaskFinished,
+		callbacks.TaskFinished,
+		pipelines.TaskFinished,
+		comparisons.TaskFinished,
+		subtasks.TaskFinished,
+	} {
+		events.Subscribe(OnTaskFinished(finished))
+	}
+	dispatcher.SetEventBus(events)
+	queueHandlers.SetEventBus(events)
+	// Archive sessions and the auth store
+	backups, err := newBackups(cfg, version, handlers.sessionStore)
+	if err != nil {
+		return nil, err
+	}
+	handlers.SetBackups(backups)
 
 	return &Director{
 		config:        cfg,
@@ -119,6 +241,16 @@ func New(cfg *Config, version string) (*Director, error) {
 		queueHandlers: queueHandlers,
 		queue:         queue,
 		dispatcher:    dispatcher,
+		githubHooks:   githubHooks,
+		pipelines:     pipelines,
+		recurring:     recurring,
+		autoscaler:    autoscaler,
+		backups:       backups,
+		comparisons:   comparisons,
+		uploads:       uploads,
+		subtasks:      subtasks,
+		metrics:       metrics,
+		registrar:     NewRegistrar(discovery, cfg.AuthToken, cfg.RegistrationTTL),
 		accessLogger:  accessLogger,
 		authStore:     cfg.AuthStore,
 	}, nil
@@ -142,14 +274,21 @@ func DefaultQueuePath() string {
 func (d *Director) Router() chi.Router {
 	r := chi.NewRouter()
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.RealIP)
+	r.Use(api.RequestID)
+	r.Use(ClientIPMiddleware(d.config.TrustedProxies))
+	r.Use(IPFilterMiddleware(d.config.IPFilter, d.accessLogger))
 
 	// Public endpoints (no auth needed)
 	r.Get("/status", d.handlers.HandleStatus) // Used by discovery
+	r.Get("/healthz", api.HandleHealthz)
+	r.Get("/readyz", api.ReadyzHandler(d.readinessChecks()...))
 	r.Get("/login", d.handlers.HandleLoginPage)
 	r.Post("/login", d.handlers.HandleLogin)
 	r.Get("/pair", d.handlers.HandlePairPage)
 	r.Post("/pair", d.handlers.HandlePair)
+	r.Post("/api/hooks/github", d.githubHooks.HandleWebhook)  // HMAC-verified
+	r.Post("/api/register", d.registrar.HandleRegister)       // Bearer auth token
+	r.Route("/api/queue/{queueId}/subtasks", d.subtaskRoutes) // Bearer subtask token
 
 	// Protected routes with session middleware
 	protected := r.Group(nil)
@@ -158,24 +297,78 @@ func (d *Director) Router() chi.Router {
 	// Dashboard
 	protected.Get("/", d.handlers.HandleDashboard)
 	protected.Post("/logout", d.handlers.HandleLogout)
+	protected.Get("/compare/{id}", func(w http.ResponseWriter, r *http.Request) {
+		d.handlers.HandleComparePage(w, r, chi.URLParam(r, "id"))
+	})
 
 	// API endpoints
 	protected.Route("/api", func(r chi.Router) {
 		r.Get("/status", d.handlers.HandleStatus)
 		r.Get("/dashboard", d.handlers.HandleDashboardData) // Consolidated endpoint with ETag
 		r.Get("/agents", d.handlers.HandleAgents)
+		r.Get("/agents/{url}/config", func(w http.ResponseWriter, r *http.Request) {
+			d.handlers.HandleAgentConfig(w, r, chi.URLParam(r, "url"))
+		})
+		r.Put("/agents/{url}/config", func(w http.ResponseWriter, r *http.Request) {
+			d.handlers.HandleAgentConfig(w, r, chi.URLParam(r, "url"))
+		})
+		r.Get("/agents/{url}/prompts", func(w http.ResponseWriter, r *http.Request) {
+			d.handlers.HandleAgentPrompts(w, r, chi.URLParam(r, "url"), "")
+		})
+		r.Get("/agents/{url}/prompts/{name}", func(w http.ResponseWriter, r *http.Request) {
+			d.handlers.HandleAgentPrompts(w, r, chi.URLParam(r, "url"), chi.URLParam(r, "name"))
+		})
+		r.Put("/agents/{url}/prompts/{name}", func(w http.ResponseWriter, r *http.Request) {
+			d.handlers.HandleAgentPrompts(w, r, chi.URLParam(r, "url"), chi.URLParam(r, "name"))
+		})
+		r.Get("/metrics/history", d.metrics.HandleHistory)
+		r.Get("/reports/agents", d.handlers.HandleAgentReports)
+		r.Get("/experiments", d.handlers.HandleExperiments)
+		r.Get("/search", d.handlers.HandleSearch)
+		r.Get("/compare", d.handlers.HandleCompareTasks)
 		r.Get("/directors", d.handlers.HandleDirectors)
+		r.Post("/components/restart", d.handlers.HandleRestartComponents)
+		r.Get("/components/restart", d.handlers.HandleRestartStatus)
 		r.Post("/task", d.queueHandlers.HandleTaskSubmitViaQueue) // Route through queue
+		r.Post("/task/compare", d.comparisons.HandleSubmit)
+		r.Post("/uploads", d.uploads.HandleUpload)
+		r.Get("/task/compare/{id}", func(w http.ResponseWriter, req *http.Request) {
+			d.comparisons.HandleStatus(w, req, chi.URLParam(req, "id"))
+		})
 		r.Get("/task/{id}", func(w http.ResponseWriter, r *http.Request) {
 			taskID := chi.URLParam(r, "id")
 			d.handlers.HandleTaskStatus(w, r, taskID)
 		})
+		r.Post("/task/{id}/rerun", func(w http.ResponseWriter, r *http.Request) {
+			d.handlers.HandleRerunTask(w, r, chi.URLParam(r, "id"))
+		})
+		r.Get("/history/diff", d.handlers.HandleHistoryDiff)
+		r.Get("/history/sessions/{sessionId}", func(w http.ResponseWriter, r *http.Request) {
+			sessionID := chi.URLParam(r, "sessionId")
+			d.handlers.HandleSessionHistory(w, r, sessionID)
+		})
 		r.Get("/history/{id}", func(w http.ResponseWriter, r *http.Request) {
 			taskID := chi.URLParam(r, "id")
 			d.handlers.HandleTaskHistory(w, r, taskID)
 		})
+		r.Patch("/history/{id}", func(w http.ResponseWriter, r *http.Request) {
+			d.handlers.HandleAnnotateTask(w, r, chi.URLParam(r, "id"))
+		})
+		r.Get("/history/{id}/artifacts", func(w http.ResponseWriter, r *http.Request) {
+			taskID := chi.URLParam(r, "id")
+			d.handlers.HandleTaskArtifacts(w, r, taskID)
+		})
+		r.Get("/history/{id}/artifacts/*", func(w http.ResponseWriter, r *http.Request) {
+			taskID := chi.URLParam(r, "id")
+			d.handlers.HandleTaskArtifact(w, r, taskID, chi.URLParam(r, "*"))
+		})
 		r.Get("/logs", d.handlers.HandleAgentLogs)           // Proxy agent logs
 		r.Get("/logs/stats", d.handlers.HandleAgentLogStats) // Proxy agent log stats
+		r.Get("/logs/stream", d.handlers.HandleAgentLogStream)
+		r.Get("/agent-sessions", d.handlers.HandleAgentSessions)
+		r.Delete("/agent-sessions/{sessionId}", func(w http.ResponseWriter, r *http.Request) {
+			d.handlers.HandleDeleteAgentSession(w, r, chi.URLParam(r, "sessionId"))
+		})
 		// Session endpoints for global session tracking (task sessions)
 		r.Get("/sessions", d.handlers.HandleSessions)
 		r.Post("/sessions", d.handlers.HandleAddSessionTask)
@@ -190,6 +383,14 @@ func (d *Director) Router() chi.Router {
 		})
 		// Device pairing and management
 		r.Post("/pair/code", d.handlers.HandleGeneratePairingCode)
+		r.Get("/pair/qr", d.handlers.HandlePairingQR)
+		r.Get("/auth/totp", d.handlers.HandleTOTPStatus)
+		r.Post("/auth/totp/enroll", d.handlers.HandleTOTPEnroll)
+		r.Get("/auth/totp/qr", d.handlers.HandleTOTPQR)
+		r.Post("/auth/totp/confirm", d.handlers.HandleTOTPConfirm)
+		r.Post("/auth/totp/disable", d.handlers.HandleTOTPDisable)
+		r.Get("/preferences", d.handlers.HandleGetPreferences)
+		r.Put("/preferences", d.handlers.HandleSetPreferences)
 		r.Get("/devices", d.handlers.HandleListDevices)
 		r.Delete("/devices/{id}", func(w http.ResponseWriter, r *http.Request) {
 			deviceID := chi.URLParam(r, "id")
@@ -205,6 +406,26 @@ func (d *Director) Router() chi.Router {
 			}
 			d.handlers.HandleTriggerJob(w, req, schedulerURL, jobName)
 		})
+		// Scheduler job management (proxies to scheduler component)
+		schedulerJob := func(w http.ResponseWriter, req *http.Request) {
+			schedulerURL := req.URL.Query().Get("scheduler_url")
+			if schedulerURL == "" {
+				api.WriteError(w, http.StatusBadRequest, "validation_error", "scheduler_url query parameter is required")
+				return
+			}
+			d.handlers.HandleSchedulerJob(w, req, schedulerURL, chi.URLParam(req, "job"))
+		}
+		r.Post("/scheduler/jobs", schedulerJob)
+		r.Put("/scheduler/jobs/{job}", schedulerJob)
+		r.Delete("/scheduler/jobs/{job}", schedulerJob)
+		r.Post("/scheduler/jobs/{job}/resume", func(w http.ResponseWriter, req *http.Request) {
+			schedulerURL := req.URL.Query().Get("scheduler_url")
+			if schedulerURL == "" {
+				api.WriteError(w, http.StatusBadRequest, "validation_error", "scheduler_url query parameter is required")
+				return
+			}
+			d.handlers.HandleResumeJob(w, req, schedulerURL, chi.URLParam(req, "job"))
+		})
 		// Queue endpoints
 		r.Post("/queue/task", d.queueHandlers.HandleQueueSubmit)
 		r.Get("/queue", d.queueHandlers.HandleQueueStatus)
@@ -216,31 +437,102 @@ func (d *Director) Router() chi.Router {
 			queueID := chi.URLParam(req, "queueId")
 			d.queueHandlers.HandleQueueCancel(w, req, queueID)
 		})
+		r.Post("/queue/{queueId}/hold", func(w http.ResponseWriter, req *http.Request) {
+			d.queueHandlers.HandleQueueHold(w, req, chi.URLParam(req, "queueId"))
+		})
+		r.Post("/queue/{queueId}/release", func(w http.ResponseWriter, req *http.Request) {
+			d.queueHandlers.HandleQueueRelease(w, req, chi.URLParam(req, "queueId"))
+		})
+		// Pipeline endpoints
+		r.Post("/pipelines", d.pipelines.HandleSubmit)
+		r.Get("/pipelines", d.pipelines.HandleList)
+		r.Get("/pipelines/{pipelineId}", func(w http.ResponseWriter, req *http.Request) {
+			d.pipelines.HandleStatus(w, req, chi.URLParam(req, "pipelineId"))
+		})
+		// Recurring task endpoints
+		r.Route("/recurring", d.recurringRoutes)
+		r.Get("/autoscale", d.autoscaler.HandleStatus)
 	})
 
 	return r
 }
 
+// recurringRoutes registers the recurring task endpoints.
+func (d *Director) recurringRoutes(r chi.Router) {
+	r.Get("/", d.recurring.HandleList)
+	r.Post("/", d.recurring.HandleCreate)
+	r.Get("/{id}", func(w http.ResponseWriter, req *http.Request) {
+		d.recurring.HandleGet(w, req, chi.URLParam(req, "id"))
+	})
+	r.Delete("/{id}", func(w http.ResponseWriter, req *http.Request) {
+		d.recurring.HandleDelete(w, req, chi.URLParam(req, "id"))
+	})
+	r.Post("/{id}/pause", func(w http.ResponseWriter, req *http.Request) {
+		d.recurring.HandlePause(w, req, chi.URLParam(req, "id"), true)
+	})
+	r.Post("/{id}/resume", func(w http.ResponseWriter, req *http.Request) {
+		d.recurring.HandlePause(w, req, chi.URLParam(req, "id"), false)
+	})
+	r.Post("/{id}/run", func(w http.ResponseWriter, req *http.Request) {
+		d.recurring.HandleRun(w, req, chi.URLParam(req, "id"))
+	})
+}
+
+// subtaskRoutes registers the subtask endpoints of a queued task. They are
+// authenticated by the task's subtask token rather than a session.
+func (d *Director) subtaskRoutes(r chi.Router) {
+	r.Post("/", func(w http.ResponseWriter, req *http.Request) {
+		d.subtasks.HandleSpawn(w, req, chi.URLParam(req, "queueId"))
+	})
+	r.Get("/", func(w http.ResponseWriter, req *http.Request) {
+		d.subtasks.HandleStatus(w, req, chi.URLParam(req, "queueId"))
+	})
+}
+
 // InternalRouter returns the internal HTTP router (no authentication).
 // This is used for service-to-service communication on localhost.
 func (d *Director) InternalRouter() chi.Router {
 	r := chi.NewRouter()
 	r.Use(middleware.Recoverer)
+	r.Use(api.RequestID)
+
+	r.Get("/healthz", api.HandleHealthz)
+	r.Get("/readyz", api.ReadyzHandler(d.readinessChecks()...))
 
 	// Internal API endpoints (no auth required)
 	r.Route("/api", func(r chi.Router) {
 		r.Get("/status", d.handlers.HandleStatus)
+		r.Get("/agents", d.handlers.HandleAgents)                 // Used by ag-cli task -auto
+		r.Get("/dashboard", d.handlers.HandleDashboardData)       // Used by ag-cli top
 		r.Post("/task", d.queueHandlers.HandleTaskSubmitViaQueue) // Route through queue
+		r.Post("/task/compare", d.comparisons.HandleSubmit)
+		r.Get("/task/compare/{id}", func(w http.ResponseWriter, req *http.Request) {
+			d.comparisons.HandleStatus(w, req, chi.URLParam(req, "id"))
+		})
 		r.Get("/task/{id}", func(w http.ResponseWriter, req *http.Request) {
 			taskID := chi.URLParam(req, "id")
 			d.handlers.HandleTaskStatus(w, req, taskID)
 		})
+		r.Post("/task/{id}/rerun", func(w http.ResponseWriter, req *http.Request) {
+			d.handlers.HandleRerunTask(w, req, chi.URLParam(req, "id"))
+		})
+		r.Get("/history/diff", d.handlers.HandleHistoryDiff)
+		r.Get("/history/sessions/{sessionId}", func(w http.ResponseWriter, req *http.Request) {
+			sessionID := chi.URLParam(req, "sessionId")
+			d.handlers.HandleSessionHistory(w, req, sessionID)
+		})
 		r.Get("/history/{id}", func(w http.ResponseWriter, req *http.Request) {
 			taskID := chi.URLParam(req, "id")
 			d.handlers.HandleTaskHistory(w, req, taskID)
 		})
+		r.Patch("/history/{id}", func(w http.ResponseWriter, req *http.Request) {
+			d.handlers.HandleAnnotateTask(w, req, chi.URLParam(req, "id"))
+		})
 		r.Get("/logs", d.handlers.HandleAgentLogs)           // Proxy agent logs
 		r.Get("/logs/stats", d.handlers.HandleAgentLogStats) // Proxy agent log stats
+		r.Get("/logs/stream", d.handlers.HandleAgentLogStream)
+		r.Get("/reports/agents", d.handlers.HandleAgentReports)
+		r.Get("/experiments", d.handlers.HandleExperiments)
 		r.Get("/sessions", d.handlers.HandleSessions)
 		// Queue endpoints
 		r.Post("/queue/task", d.queueHandlers.HandleQueueSubmit)
@@ -253,6 +545,22 @@ func (d *Director) InternalRouter() chi.Router {
 			queueID := chi.URLParam(req, "queueId")
 			d.queueHandlers.HandleQueueCancel(w, req, queueID)
 		})
+		r.Post("/queue/{queueId}/hold", func(w http.ResponseWriter, req *http.Request) {
+			d.queueHandlers.HandleQueueHold(w, req, chi.URLParam(req, "queueId"))
+		})
+		r.Post("/queue/{queueId}/release", func(w http.ResponseWriter, req *http.Request) {
+			d.queueHandlers.HandleQueueRelease(w, req, chi.URLParam(req, "queueId"))
+		})
+		r.Route("/queue/{queueId}/subtasks", d.subtaskRoutes)
+		// Pipeline endpoints
+		r.Post("/pipelines", d.pipelines.HandleSubmit)
+		r.Get("/pipelines", d.pipelines.HandleList)
+		r.Get("/pipelines/{pipelineId}", func(w http.ResponseWriter, req *http.Request) {
+			d.pipelines.HandleStatus(w, req, chi.URLParam(req, "pipelineId"))
+		})
+		// Recurring task endpoints
+		r.Route("/recurring", d.recurringRoutes)
+		r.Get("/autoscale", d.autoscaler.HandleStatus)
 	})
 
 	// Shutdown endpoint (internal only, cascades to all services)
@@ -261,6 +569,28 @@ func (d *Director) InternalRouter() chi.Router {
 	return r
 }
 
+// readinessChecks are the conditions for /readyz: the TLS certificate
+// loads (unless it comes from ACME) and the auth store is open.
+func (d *Director) readinessChecks() []api.ReadinessCheck {
+	return []api.ReadinessCheck{
+		{Name: "tls", Check: func() error {
+			if d.config.TLS.ACME.Enabled() {
+				return nil // Certificates are obtained on the first handshake
+			}
+			if _, err := tls.LoadX509KeyPair(d.config.TLS.CertFile, d.config.TLS.KeyFile); err != nil {
+				return fmt.Errorf("loading TLS certificate: %w", err)
+			}
+			return nil
+		}},
+		{Name: "auth_store", Check: func() error {
+			if d.authStore == nil {
+				return errors.New("auth store not loaded")
+			}
+			return nil
+		}},
+	}
+}
+
 // Start starts the web director server
 func (d *Director) Start() error {
 	addr := fmt.Sprintf("%s:%d", d.config.Bind, d.config.Port)
@@ -290,11 +620,38 @@ func (d *Director) Start() error {
 	dispatchCtx, dispatchCancel := context.WithCancel(context.Background())
 	d.dispatchCancel = dispatchCancel
 	go d.dispatcher.Start(dispatchCtx)
+	go d.metrics.Start(dispatchCtx)
+	go d.recurring.Start(dispatchCtx)
+	if d.autoscaler != nil {
+		go d.autoscaler.Start(dispatchCtx)
+	}
+	if d.backups != nil {
+		go d.backups.Run(dispatchCtx)
+	}
 
 	// Setup TLS
-	if err := EnsureTLSCert(d.config.TLS); err != nil {
+	certCtx, stopCertWatch := context.WithCancel(context.Background())
+	d.stopCertWatch = stopCertWatch
+	tlsCfg, acmeManager, err := serverTLSConfig(certCtx, d.config.TLS)
+	if err != nil {
 		return fmt.Errorf("setting up TLS: %w", err)
 	}
+	d.server.TLSConfig = tlsCfg
+	if acmeManager != nil {
+		fmt.Fprintf(os.Stderr, "Obtaining certificates via ACME for %s\n", strings.Join(d.config.TLS.ACME.Domains, ", "))
+		if d.config.TLS.ACME.HTTPAddr != "" {
+			d.acmeServer = &http.Server{
+				Addr:              d.config.TLS.ACME.HTTPAddr,
+				Handler:           acmeManager.HTTPHandler(nil), // Other requests are redirected to HTTPS
+				ReadHeaderTimeout: 5 * time.Second,
+			}
+			go func() {
+				if err := d.acmeServer.ListenAndServe(); err != http.ErrServerClosed {
+					fmt.Fprintf(os.Stderr, "ACME challenge server error: %v\n", err)
+				}
+			}()
+		}
+	}
 
 	fmt.Fprintf(os.Stderr, "Web director starting on https://%s\n", addr)
 	fmt.Fprintf(os.Stderr, "Discovery scanning ports %d-%d\n", d.config.PortStart, d.config.PortEnd)
@@ -319,13 +676,7 @@ func (d *Director) Start() error {
 		}()
 	}
 
-	// Configure TLS
-	tlsCfg := &tls.Config{
-		MinVersion: tls.VersionTLS12,
-	}
-	d.server.TLSConfig = tlsCfg
-
-	return d.server.ListenAndServeTLS(d.config.TLS.CertFile, d.config.TLS.KeyFile)
+	return d.server.ListenAndServeTLS("", "")
 }
 
 // Shutdown gracefully shuts down the director
@@ -335,6 +686,12 @@ func (d *Director) Shutdown(ctx context.Context) error {
 		d.dispatchCancel()
 	}
 	d.discovery.Stop()
+	if d.stopCertWatch != nil {
+		d.stopCertWatch()
+	}
+	if d.acmeServer != nil {
+		d.acmeServer.Shutdown(ctx)
+	}
 	if d.accessLogger != nil {
 		d.accessLogger.Close()
 	}
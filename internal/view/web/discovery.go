@@ -4,8 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math/rand/v2"
 	"net/http"
+	"os"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,14 +23,23 @@ type ComponentStatus struct {
 	Type          string           `json:"type"`                 // agent, director, helper, view
 	Interfaces    []string         `json:"interfaces,omitempty"` // statusable, taskable, observable, configurable
 	Version       string           `json:"version"`
+	AgentID       string           `json:"agent_id,omitempty"` // Stable ID that survives port changes
 	AgentKind     string           `json:"agent_kind,omitempty"`
+	Tiers         []string         `json:"tiers,omitempty"` // Tiers explicitly configured on the agent
 	State         string           `json:"state"`
 	UptimeSeconds float64          `json:"uptime_seconds"`
 	CurrentTask   *api.CurrentTask `json:"current_task,omitempty"`
 	Config        any              `json:"config,omitempty"`
 	Jobs          []JobStatus      `json:"jobs,omitempty"` // For scheduler helpers
 	LastSeen      time.Time        `json:"last_seen"`
-	FailCount     int              `json:"-"` // Internal: consecutive failures
+	Remote        bool             `json:"remote,omitempty"` // Self-registered via /api/register rather than found by port scan
+	FailCount     int              `json:"-"`                // Internal: consecutive failures
+
+	Circuit *CircuitStatus `json:"circuit,omitempty"` // Breaker on calls from the web view, while not closed
+
+	APIVersion    int      `json:"api_version,omitempty"`   // 0 for components that predate versioning
+	Capabilities  []string `json:"capabilities,omitempty"`  // Optional features, see api.Capability*
+	Compatibility string   `json:"compatibility,omitempty"` // How the director adapts to an agent's API, if it must
 }
 
 // JobStatus represents a scheduled job's status (from scheduler)
@@ -37,9 +50,42 @@ type JobStatus struct {
 	LastRun    *time.Time `json:"last_run,omitempty"`
 	LastStatus string     `json:"last_status,omitempty"`
 	LastTaskID string     `json:"last_task_id,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+	Managed    bool       `json:"managed,omitempty"`
+	RecentRuns []JobRun   `json:"recent_runs,omitempty"` // Newest first
+
+	SuspendAfter        int  `json:"suspend_after,omitempty"`
+	ConsecutiveFailures int  `json:"consecutive_failures,omitempty"`
+	Suspended           bool `json:"suspended,omitempty"` // Failed SuspendAfter times in a row; not run until resumed
+}
+
+// JobRun is one recorded run of a scheduler job
+type JobRun struct {
+	StartedAt       time.Time `json:"started_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	State           string    `json:"state"`
+	TaskID          string    `json:"task_id,omitempty"`
+	QueueID         string    `json:"queue_id,omitempty"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// Discovery scanning limits
+const (
+	discoveryWorkers = 16 // Concurrent /status probes per scan
+	deadAfterMisses  = 3  // Misses before a URL with no component is probed less often
+	maxProbeBackoff  = 15 * time.Second
+	scanJitter       = 0.1 // Fraction of the refresh interval scans are spread by
+)
+
+// probeBackoff tracks a URL that keeps failing to answer, so dead ports in
+// the range are probed progressively less often.
+type probeBackoff struct {
+	misses int
+	next   time.Time // Not probed before this
 }
 
-// Discovery handles service discovery via port scanning
+// Discovery handles service discovery via port scanning, plus components on
+// other machines that register themselves
 type Discovery struct {
 	portStart       int
 	portEnd         int
@@ -48,6 +94,10 @@ type Discovery struct {
 
 	mu         sync.RWMutex
 	components map[string]*ComponentStatus // keyed by URL
+	agentURLs  map[string]string           // agent ID -> last known URL
+	remote     map[string]time.Time        // Registered URL -> registration expiry (zero = configured, never expires)
+	rebindFunc func(oldURL, newURL string) // Called when an agent reappears at a new URL
+	backoff    map[string]*probeBackoff    // URLs without a component that keep failing
 
 	client   *http.Client
 	cancel   context.CancelFunc
@@ -62,6 +112,7 @@ type DiscoveryConfig struct {
 	RefreshInterval time.Duration
 	MaxFailures     int
 	SelfPort        int
+	URLs            []string // Components polled besides the port range, e.g. ssh:// tunnelled agents
 }
 
 // NewDiscovery creates a new discovery service
@@ -72,6 +123,10 @@ func NewDiscovery(cfg DiscoveryConfig) *Discovery {
 	if cfg.MaxFailures == 0 {
 		cfg.MaxFailures = 3
 	}
+	remote := make(map[string]time.Time)
+	for _, url := range cfg.URLs {
+		remote[strings.TrimSuffix(url, "/")] = time.Time{}
+	}
 	return &Discovery{
 		portStart:       cfg.PortStart,
 		portEnd:         cfg.PortEnd,
@@ -79,11 +134,22 @@ func NewDiscovery(cfg DiscoveryConfig) *Discovery {
 		maxFailures:     cfg.MaxFailures,
 		selfPort:        cfg.SelfPort,
 		components:      make(map[string]*ComponentStatus),
+		agentURLs:       make(map[string]string),
+		remote:          remote,
+		backoff:         make(map[string]*probeBackoff),
 		client:          tlsutil.NewHTTPClient(500 * time.Millisecond),
 		doneCh:          make(chan struct{}),
 	}
 }
 
+// SetRebindFunc sets the callback invoked when an agent with a known ID
+// is discovered at a different URL (e.g. after restarting on a new port).
+func (d *Discovery) SetRebindFunc(fn func(oldURL, newURL string)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rebindFunc = fn
+}
+
 // Start begins the discovery polling loop
 func (d *Discovery) Start(ctx context.Context) {
 	ctx, cancel := context.WithCancel(ctx)
@@ -94,20 +160,27 @@ func (d *Discovery) Start(ctx context.Context) {
 	// Do initial scan immediately
 	d.scan()
 
-	ticker := time.NewTicker(d.refreshInterval)
-	defer ticker.Stop()
+	// Jittered, so web views sharing a port range don't probe in step
+	timer := time.NewTimer(jitter(d.refreshInterval, scanJitter))
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			close(d.doneCh)
 			return
-		case <-ticker.C:
+		case <-timer.C:
 			d.scan()
+			timer.Reset(jitter(d.refreshInterval, scanJitter))
 		}
 	}
 }
 
+// jitter returns d moved randomly by up to frac of itself either way.
+func jitter(d time.Duration, frac float64) time.Duration {
+	return d + time.Duration((rand.Float64()*2-1)*frac*float64(d))
+}
+
 // Stop stops the discovery service
 func (d *Discovery) Stop() {
 	d.mu.Lock()
@@ -120,29 +193,103 @@ func (d *Discovery) Stop() {
 	}
 }
 
-// scan checks all ports in the range for components
+// Register adds or renews a remote component, polled alongside the port
+// range until ttl passes without another registration. It reports whether
+// the component was not already registered.
+func (d *Discovery) Register(url string, ttl time.Duration) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	expiry, known := d.remote[url]
+	if !known || !expiry.IsZero() {
+		d.remote[url] = time.Now().Add(ttl)
+	}
+	if !known {
+		delete(d.backoff, url) // Probed on the next scan
+	}
+	return !known
+}
+
+// pruneRemoteUnlocked drops registrations whose heartbeats have stopped,
+// along with their components, and returns the URLs still registered.
+// Must be called with lock held.
+func (d *Discovery) pruneRemoteUnlocked(now time.Time) []string {
+	var urls []string
+	for url, expiry := range d.remote {
+		if !expiry.IsZero() && now.After(expiry) {
+			delete(d.remote, url)
+			delete(d.components, url)
+			delete(d.backoff, url)
+			fmt.Fprintf(os.Stderr, "discovery: registration for %s expired\n", url)
+			continue
+		}
+		urls = append(urls, url)
+	}
+	return urls
+}
+
+// scan checks all ports in the range and registered URLs for components,
+// with a bounded number of probes at once. URLs in backoff are skipped.
 func (d *Discovery) scan() {
-	var wg sync.WaitGroup
+	type probe struct {
+		url    string
+		remote bool
+	}
+	now := time.Now()
+	var probes []probe
 
+	d.mu.Lock()
+	for _, url := range d.pruneRemoteUnlocked(now) {
+		if d.dueUnlocked(url, now) {
+			probes = append(probes, probe{url, true})
+		}
+	}
 	for port := d.portStart; port <= d.portEnd; port++ {
 		// Skip self
 		if port == d.selfPort {
 			continue
 		}
+		if url := portURL(port); d.dueUnlocked(url, now) {
+			probes = append(probes, probe{url, false})
+		}
+	}
+	d.mu.Unlock()
 
+	work := make(chan probe)
+	var wg sync.WaitGroup
+	for range min(discoveryWorkers, len(probes)) {
 		wg.Add(1)
-		go func(p int) {
+		go func() {
 			defer wg.Done()
-			d.checkPort(p)
-		}(port)
+			for p := range work {
+				d.checkURL(p.url, p.remote)
+			}
+		}()
 	}
-
+	for _, p := range probes {
+		work <- p
+	}
+	close(work)
 	wg.Wait()
 }
 
+// dueUnlocked reports whether url should be probed in this scan.
+// Must be called with lock held.
+func (d *Discovery) dueUnlocked(url string, now time.Time) bool {
+	b, ok := d.backoff[url]
+	return !ok || !now.Before(b.next)
+}
+
+func portURL(port int) string {
+	return fmt.Sprintf("https://localhost:%d", port)
+}
+
 // checkPort queries a single port for /status
 func (d *Discovery) checkPort(port int) {
-	url := fmt.Sprintf("https://localhost:%d", port)
+	d.checkURL(portURL(port), false)
+}
+
+// checkURL queries a component's /status and records the result
+func (d *Discovery) checkURL(url string, remote bool) {
 	statusURL := url + "/status"
 
 	resp, err := d.client.Get(statusURL)
@@ -150,7 +297,11 @@ func (d *Discovery) checkPort(port int) {
 		d.markFailed(url)
 		return
 	}
-	defer resp.Body.Close()
+	defer func() {
+		// Drained so the connection is reused by the next scan
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+	}()
 
 	if resp.StatusCode != http.StatusOK {
 		d.markFailed(url)
@@ -166,13 +317,56 @@ func (d *Discovery) checkPort(port int) {
 	status.URL = url
 	status.LastSeen = time.Now()
 	status.FailCount = 0
+	status.Circuit = agentBreakers.status(url)
+	if status.Type == api.TypeAgent {
+		status.Compatibility = agentCompatibility(&status)
+	}
 
 	d.mu.Lock()
+	if _, registered := d.remote[url]; remote && !registered {
+		d.mu.Unlock() // Registration expired while checking
+		return
+	}
+	delete(d.backoff, url)
+	status.Remote = remote
+	movedFrom := d.trackAgentIDUnlocked(&status)
 	d.components[url] = &status
+	rebind := d.rebindFunc
 	d.mu.Unlock()
+
+	if movedFrom != "" && rebind != nil {
+		rebind(movedFrom, url)
+	}
 }
 
-// markFailed increments failure count and removes if threshold exceeded
+// trackAgentIDUnlocked records the URL for a component's agent ID and
+// returns the previous URL if the agent has moved. A move is only reported
+// once the old URL is gone or failing, so two live components that share
+// an ID never steal each other's sessions.
+// Must be called with lock held.
+func (d *Discovery) trackAgentIDUnlocked(status *ComponentStatus) string {
+	if status.AgentID == "" {
+		return ""
+	}
+
+	prevURL, known := d.agentURLs[status.AgentID]
+	if !known || prevURL == status.URL {
+		d.agentURLs[status.AgentID] = status.URL
+		return ""
+	}
+
+	if prev, ok := d.components[prevURL]; ok && prev.AgentID == status.AgentID && prev.FailCount == 0 {
+		return "" // Old URL still healthy; wait until it fails
+	}
+
+	delete(d.components, prevURL)
+	d.agentURLs[status.AgentID] = status.URL
+	return prevURL
+}
+
+// markFailed increments failure count and removes if threshold exceeded.
+// URLs without a component back off once they have missed deadAfterMisses
+// scans in a row, doubling the wait up to maxProbeBackoff.
 func (d *Discovery) markFailed(url string) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -182,6 +376,31 @@ func (d *Discovery) markFailed(url string) {
 		if comp.FailCount >= d.maxFailures {
 			delete(d.components, url)
 		}
+		return
+	}
+
+	b, ok := d.backoff[url]
+	if !ok {
+		b = &probeBackoff{}
+		d.backoff[url] = b
+	}
+	b.misses++
+	if b.misses >= deadAfterMisses {
+		wait := min(d.refreshInterval<<min(b.misses-deadAfterMisses+1, 16), maxProbeBackoff)
+		b.next = time.Now().Add(jitter(wait, scanJitter))
+	}
+}
+
+// MarkBusy records that an agent refused a task as busy, so it isn't chosen
+// again before the next poll reports its real state.
+func (d *Discovery) MarkBusy(url string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if comp, ok := d.components[url]; ok && comp.State == "idle" {
+		busy := *comp // Replaced rather than modified, as callers hold the old one
+		busy.State = "working"
+		d.components[url] = &busy
 	}
 }
 
@@ -256,6 +475,11 @@ func (d *Discovery) GetComponent(url string) (*ComponentStatus, bool) {
 	return comp, ok
 }
 
+// circuitOpen reports whether calls to the component are failing fast.
+func (c *ComponentStatus) circuitOpen() bool {
+	return c.Circuit != nil && c.Circuit.State == CircuitOpen
+}
+
 func hasInterface(interfaces []string, target string) bool {
 	for _, i := range interfaces {
 		if i == target {
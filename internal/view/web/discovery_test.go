@@ -3,10 +3,12 @@ package web
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -53,6 +55,27 @@ func TestDiscoveryAgentClassification(t *testing.T) {
 	require.Len(t, directors, 0)
 }
 
+func TestDiscoveryConfiguredURLs(t *testing.T) {
+	t.Parallel()
+
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"type": "agent", "state": "idle"})
+	}))
+	defer agent.Close()
+
+	// Outside the (empty) port range, and never expiring
+	d := NewDiscovery(DiscoveryConfig{PortStart: 1, PortEnd: 0, URLs: []string{agent.URL + "/"}})
+	d.scan()
+	require.Len(t, d.Agents(), 1)
+	require.Equal(t, agent.URL, d.Agents()[0].URL)
+	require.True(t, d.Agents()[0].Remote)
+
+	require.False(t, d.Register(agent.URL, time.Nanosecond), "already known")
+	time.Sleep(time.Millisecond)
+	d.scan()
+	require.Len(t, d.Agents(), 1, "a registration does not make it expire")
+}
+
 func TestDiscoveryDirectorClassification(t *testing.T) {
 	t.Parallel()
 
@@ -258,6 +281,60 @@ func extractPort(t *testing.T, url string) int {
 	return port
 }
 
+func TestDiscoveryRebindsMovedAgent(t *testing.T) {
+	t.Parallel()
+
+	statusHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"type":     "agent",
+			"agent_id": "agent-abc",
+			"version":  "test",
+			"state":    "idle",
+		})
+	})
+	oldServer := httptest.NewTLSServer(statusHandler)
+	newServer := httptest.NewTLSServer(statusHandler)
+	defer newServer.Close()
+
+	oldPort := extractPort(t, oldServer.URL)
+	newPort := extractPort(t, newServer.URL)
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: oldPort, PortEnd: oldPort, MaxFailures: 3})
+
+	var mu sync.Mutex
+	var rebinds [][2]string
+	d.SetRebindFunc(func(oldURL, newURL string) {
+		mu.Lock()
+		defer mu.Unlock()
+		rebinds = append(rebinds, [2]string{oldURL, newURL})
+	})
+
+	d.checkPort(oldPort)
+	require.Len(t, d.Agents(), 1)
+
+	// Same ID at a new URL while the old one is still healthy is not a move
+	d.checkPort(newPort)
+	require.Len(t, d.Agents(), 2)
+	require.Empty(t, rebinds)
+
+	// Old agent goes away; once it fails the new URL takes over
+	oldServer.Close()
+	d.checkPort(oldPort)
+	d.checkPort(newPort)
+
+	oldURL := fmt.Sprintf("https://localhost:%d", oldPort)
+	newURL := fmt.Sprintf("https://localhost:%d", newPort)
+
+	mu.Lock()
+	require.Equal(t, [][2]string{{oldURL, newURL}}, rebinds)
+	mu.Unlock()
+
+	agents := d.Agents()
+	require.Len(t, agents, 1)
+	require.Equal(t, newURL, agents[0].URL)
+	require.Equal(t, "agent-abc", agents[0].AgentID)
+}
+
 func TestDiscoveryHelperWithJobs(t *testing.T) {
 	t.Parallel()
 
@@ -402,3 +479,60 @@ func TestDiscoveryHelperJobStatusUpdates(t *testing.T) {
 		"NextRun should have been updated: initial=%v, updated=%v",
 		initialJob.NextRun, updatedJob.NextRun)
 }
+
+func TestDiscoveryDeadPortBackoff(t *testing.T) {
+	t.Parallel()
+
+	var up atomic.Bool
+	var probes atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		if !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"type": "agent", "state": "idle"})
+	}))
+	defer server.Close()
+	port := extractPort(t, server.URL)
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: port, PortEnd: port, RefreshInterval: time.Minute})
+	for range deadAfterMisses {
+		d.scan()
+	}
+	require.Equal(t, int32(deadAfterMisses), probes.Load())
+
+	// Backed off: the port is skipped even once it answers
+	up.Store(true)
+	d.scan()
+	require.Equal(t, int32(deadAfterMisses), probes.Load())
+	require.Empty(t, d.Agents())
+
+	d.mu.Lock()
+	b := d.backoff[portURL(port)]
+	require.LessOrEqual(t, time.Until(b.next), maxProbeBackoff+maxProbeBackoff/10)
+	b.next = time.Now()
+	d.mu.Unlock()
+
+	d.scan()
+	require.Len(t, d.Agents(), 1)
+	d.mu.Lock()
+	require.NotContains(t, d.backoff, portURL(port), "cleared once the port answers")
+	d.mu.Unlock()
+}
+
+func TestDiscoveryScanManyPorts(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"type": "agent", "state": "idle"})
+	}))
+	defer server.Close()
+	port := extractPort(t, server.URL)
+
+	// More ports than workers, most of them closed
+	d := NewDiscovery(DiscoveryConfig{PortStart: port - 2*discoveryWorkers, PortEnd: port})
+	d.scan()
+	_, found := d.GetComponent(portURL(port))
+	require.True(t, found)
+}
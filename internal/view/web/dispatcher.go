@@ -9,32 +9,85 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"phobos.org.uk/agency/internal/api"
 	"phobos.org.uk/agency/internal/taskstate"
 )
 
+// errTaskNotFound is returned when an agent has no record of a task,
+// neither in flight nor in history.
+var errTaskNotFound = errors.New("task not found")
+
 // Dispatcher dispatches queued tasks to idle agents
 type Dispatcher struct {
-	queue        *WorkQueue
-	discovery    *Discovery
-	sessionStore *SessionStore
-	client       *http.Client
-	pollInterval time.Duration
+	queue         *WorkQueue
+	discovery     *Discovery
+	sessionStore  *SessionStore
+	client        *http.Client
+	pollInterval  time.Duration
+	trackInterval time.Duration // How often dispatched tasks are checked on their agent
+
+	// When each waiting session follow-up first found its agent missing.
+	// Only touched by the dispatch loop.
+	sessionAgentMissing map[string]time.Time
+
+	limiter dispatchRateLimiter
+	fair    fairScheduler
+	now     func() time.Time // Clock for dispatch windows and the rate limit
+
+	events  *EventBus                                // Told of dispatched tasks and those leaving the queue (optional)
+	taskEnv func(task *QueuedTask) map[string]string // Extra environment for each dispatched task (optional)
+
+	promptRules PromptRules // Per-source prompt augmentation (optional)
 }
 
 // NewDispatcher creates a new dispatcher
 func NewDispatcher(queue *WorkQueue, discovery *Discovery, sessionStore *SessionStore) *Dispatcher {
 	return &Dispatcher{
-		queue:        queue,
-		discovery:    discovery,
-		sessionStore: sessionStore,
-		client:       createHTTPClient(queue.Config().DispatchTimeout),
-		pollInterval: time.Second,
+		queue:         queue,
+		discovery:     discovery,
+		sessionStore:  sessionStore,
+		client:        createHTTPClient(queue.Config().DispatchTimeout, ""),
+		pollInterval:  time.Second,
+		trackInterval: 5 * time.Second,
+
+		sessionAgentMissing: make(map[string]time.Time),
+		now:                 time.Now,
 	}
 }
 
+// SetAuthToken sets the bearer token sent to agents
+func (d *Dispatcher) SetAuthToken(token string) {
+	d.client = api.WithAuthToken(d.client, token)
+}
+
+// SetEventBus sets the bus told of dispatched tasks and of tasks that leave
+// the queue finished: completed, failed or cancelled on their agent, or
+// failed or expired by the queue. Events are published on the dispatcher's
+// goroutines.
+func (d *Dispatcher) SetEventBus(bus *EventBus) {
+	d.events = bus
+}
+
+// SetTaskEnvFunc sets a function returning extra environment variables for
+// a task's agent process, added to the task's own env when it is dispatched.
+func (d *Dispatcher) SetTaskEnvFunc(fn func(task *QueuedTask) map[string]string) {
+	d.taskEnv = fn
+}
+
+// SetPromptRules sets the rules applied to the prompts of dispatched tasks
+func (d *Dispatcher) SetPromptRules(rules PromptRules) {
+	d.promptRules = rules
+}
+
+// finished reports a task that has left the queue.
+func (d *Dispatcher) finished(task *QueuedTask, state string) {
+	d.events.Publish(Event{Type: EventTaskFinished, Task: task, State: state})
+}
+
 // Start runs the dispatcher loop until the context is cancelled
 func (d *Dispatcher) Start(ctx context.Context) {
 	ticker := time.NewTicker(d.pollInterval)
@@ -50,44 +103,97 @@ func (d *Dispatcher) Start(ctx context.Context) {
 	}
 }
 
+// nextDispatchable returns the pending task that may be dispatched now:
+// the oldest task of the source with the lowest fair-share tag, passing over
+// those in skip. Tasks held back by their run_at, a dispatch window or the
+// hourly limit are skipped and get scheduled_after set to when they may next
+// go.
+func (d *Dispatcher) nextDispatchable(now time.Time, skip map[string]bool) *QueuedTask {
+	cfg := d.queue.Config()
+	rateOpens := d.limiter.opensAt(cfg.MaxDispatchesPerHour, now)
+
+	var next *QueuedTask
+	var nextTag float64
+	for _, task := range d.queue.Pending() {
+		if skip[task.QueueID] {
+			continue
+		}
+		after := windowOpensAt(cfg.DispatchWindows, task.Tier, now)
+		if rateOpens.After(after) {
+			after = rateOpens
+		}
+		if task.RunAt != nil && task.RunAt.After(now) && task.RunAt.After(after) {
+			after = *task.RunAt
+		}
+		d.queue.SetScheduledAfter(task, after)
+		if !after.IsZero() {
+			continue
+		}
+		// Strictly lower, so ties and tasks of the same source stay FIFO
+		if tag := d.fair.startTag(sourceKey(task)); next == nil || tag < nextTag {
+			next, nextTag = task, tag
+		}
+	}
+	return next
+}
+
 func (d *Dispatcher) dispatchNext() {
-	// Get next pending task
-	task := d.queue.NextPending()
-	if task == nil {
-		return // Queue empty
+	now := d.now()
+	for _, expired := range d.queue.ExpireDue(now) {
+		fmt.Fprintf(os.Stderr, "queue: expired %s: %s\n", expired.QueueID, expired.LastError)
+		d.finished(expired, string(TaskStateExpired))
 	}
+	d.pruneSessionAgentMissing()
 
+	var task *QueuedTask
 	var agent *ComponentStatus
+	var reason string
+	sessionBound := false        // The task must run on its session's agent
+	waiting := map[string]bool{} // Follow-ups whose session's agent is missing
+	for {
+		task = d.nextDispatchable(now, waiting)
+		if task == nil {
+			return // Queue empty or nothing may dispatch yet
+		}
 
-	// Strict session affinity: if task has a session, it must use that session's agent
-	if task.SessionID != "" {
-		session, exists := d.sessionStore.Get(task.SessionID)
-		if exists && session.AgentURL != "" {
-			// Task must use the session's original agent
-			comp, found := d.discovery.GetComponent(session.AgentURL)
-			if !found {
-				// Session's agent no longer available - wait
-				return
-			}
-			if comp.State == "idle" && comp.FailCount == 0 {
-				agent = comp
+		// Strict session affinity: if task has a session, it must use that session's agent
+		if task.SessionID != "" {
+			session, exists := d.sessionStore.Get(task.SessionID)
+			if exists && session.AgentURL != "" {
+				// Task must use the session's original agent
+				comp, found := d.discovery.GetComponent(session.AgentURL)
+				if !found {
+					// Session's agent no longer available - wait for it to
+					// come back (possibly at a new URL) before giving up,
+					// without holding up the tasks behind this one
+					d.waitForSessionAgent(task, session.AgentURL)
+					waiting[task.QueueID] = true
+					continue
+				}
+				delete(d.sessionAgentMissing, task.QueueID)
+				if comp.State == "idle" && comp.FailCount == 0 && !comp.circuitOpen() {
+					agent = comp
+					reason = "session affinity: continuing on the session's agent"
+					sessionBound = true
+				} else {
+					// Session's agent is busy - wait in queue
+					return
+				}
 			} else {
-				// Session's agent is busy - wait in queue
-				return
+				// Session not found or has no agent - treat as new session
+				agent, reason = selectAgent(d.discovery.Agents(), task.AgentKind, task.Tier)
+				if agent == nil {
+					return // No idle agents
+				}
 			}
 		} else {
-			// Session not found or has no agent - treat as new session
-			agent = d.findFirstIdleAgent(task.AgentKind)
+			// New session - route by agent kind and tier
+			agent, reason = selectAgent(d.discovery.Agents(), task.AgentKind, task.Tier)
 			if agent == nil {
 				return // No idle agents
 			}
 		}
-	} else {
-		// New session - find any idle agent of the requested kind
-		agent = d.findFirstIdleAgent(task.AgentKind)
-		if agent == nil {
-			return // No idle agents
-		}
+		break
 	}
 
 	// Mark as dispatching
@@ -95,60 +201,126 @@ func (d *Dispatcher) dispatchNext() {
 
 	// Submit to agent
 	taskID, sessionID, err := d.submitToAgent(agent, task)
+	tried := map[string]bool{}
+	for isAgentBusy(err) {
+		// The agent took other work since discovery last polled it: try
+		// another idle agent, or leave the task pending without counting an
+		// attempt against it
+		d.discovery.MarkBusy(agent.URL)
+		d.queue.RecordEvent(task, DispatchEvent{Event: DispatchEventBusy, AgentURL: agent.URL})
+		tried[agent.URL] = true
+		if !sessionBound {
+			candidates := slices.DeleteFunc(d.discovery.Agents(), func(a *ComponentStatus) bool { return tried[a.URL] })
+			agent, reason = selectAgent(candidates, task.AgentKind, task.Tier)
+		}
+		if sessionBound || agent == nil {
+			d.queue.ReturnToPending(task)
+			fmt.Fprintf(os.Stderr, "queue: %s left pending (agent busy)\n", task.QueueID)
+			return
+		}
+		taskID, sessionID, err = d.submitToAgent(agent, task)
+	}
 	if err != nil {
-		d.handleDispatchError(task, err)
+		d.handleDispatchError(task, agent.URL, err)
 		return
 	}
 
 	// Success - update task with agent info
-	d.queue.SetDispatched(task, agent.URL, taskID, sessionID)
+	d.queue.SetDispatched(task, agent.URL, taskID, sessionID, reason)
+	d.queue.RecordEvent(task, DispatchEvent{Event: DispatchEventDispatched, AgentURL: agent.URL, TaskID: taskID, Detail: reason})
+	d.events.Publish(Event{Type: EventTaskDispatched, Task: task})
+	d.limiter.record(now)
+	source := sourceKey(task)
+	d.fair.record(source, sourceWeight(d.queue.Config().SourceWeights, source))
 
 	// Track in session store
-	source := task.Source
-	if source == "" {
-		source = "queue"
-	}
 	opts := []AddTaskOption{WithSource(source)}
 	if task.SourceJob != "" {
 		opts = append(opts, WithSourceJob(task.SourceJob))
 	}
+	if task.SeqClaimed {
+		opts = append(opts, WithSeqClaimed())
+	}
 	d.sessionStore.AddTask(sessionID, agent.URL, taskID, "working", task.Prompt, opts...)
 
-	fmt.Fprintf(os.Stderr, "queue: dispatched %s to %s (task_id=%s)\n",
-		task.QueueID, agent.URL, taskID)
+	fmt.Fprintf(os.Stderr, "queue: dispatched %s to %s (task_id=%s, request_id=%s, %s)\n",
+		task.QueueID, agent.URL, taskID, task.RequestID, reason)
 
 	// Start tracking completion in background
 	go d.trackCompletion(task)
 }
 
-func (d *Dispatcher) findFirstIdleAgent(agentKind string) *ComponentStatus {
-	if agentKind == "" {
-		agentKind = api.AgentKindClaude
+// waitForSessionAgent fails a session follow-up once its agent has been
+// missing from discovery for longer than the queue's liveness timeout.
+func (d *Dispatcher) waitForSessionAgent(task *QueuedTask, agentURL string) {
+	since, ok := d.sessionAgentMissing[task.QueueID]
+	if !ok {
+		d.sessionAgentMissing[task.QueueID] = time.Now()
+		return
+	}
+	if time.Since(since) < d.queue.Config().LivenessTimeout {
+		return
+	}
+
+	delete(d.sessionAgentMissing, task.QueueID)
+	reason := sessionAgentGoneMessage(task.SessionID, agentURL)
+	d.queue.RecordEvent(task, DispatchEvent{Event: DispatchEventFailed, AgentURL: agentURL, Detail: reason})
+	d.queue.Fail(task, reason)
+	d.finished(task, string(TaskStateFailed))
+	fmt.Fprintf(os.Stderr, "queue: failed %s: %s\n", task.QueueID, reason)
+}
+
+// pruneSessionAgentMissing forgets follow-ups that are no longer pending,
+// e.g. because they were cancelled, held or expired while waiting.
+func (d *Dispatcher) pruneSessionAgentMissing() {
+	if len(d.sessionAgentMissing) == 0 {
+		return
 	}
-	agents := d.discovery.Agents()
-	for _, agent := range agents {
-		if agent.State == "idle" && agent.FailCount == 0 {
-			if agentKind == api.AgentKindCodex {
-				if agent.AgentKind != api.AgentKindCodex {
-					continue
-				}
-			} else {
-				if agent.AgentKind != "" && agent.AgentKind != api.AgentKindClaude {
-					continue
-				}
-			}
-			return agent
+	pending := map[string]bool{}
+	for _, task := range d.queue.Pending() {
+		pending[task.QueueID] = true
+	}
+	for queueID := range d.sessionAgentMissing {
+		if !pending[queueID] {
+			delete(d.sessionAgentMissing, queueID)
 		}
 	}
-	return nil
+}
+
+// sessionAgentGoneMessage explains why a session follow-up cannot run.
+func sessionAgentGoneMessage(sessionID, agentURL string) string {
+	return fmt.Sprintf("session %s ran on agent %s, which is no longer available; submit without session_id to start a new session",
+		sessionID, agentURL)
 }
 
 func (d *Dispatcher) submitToAgent(agent *ComponentStatus, task *QueuedTask) (taskID, sessionID string, err error) {
 	// Build agent request
-	agentReq := buildAgentRequest(task.Prompt, task.Tier, task.TimeoutSeconds, task.SessionID, task.Env)
+	env := task.Env
+	if d.taskEnv != nil {
+		env = make(map[string]string, len(task.Env))
+		for k, v := range task.Env {
+			env[k] = v
+		}
+		for k, v := range d.taskEnv(task) {
+			env[k] = v
+		}
+	}
+	prompt := d.promptRules.Apply(sourceKey(task), task.Prompt)
+	agentReq := buildAgentRequest(prompt, task.Tier, task.TimeoutSeconds, task.SessionID, env, task.RunnerOptions)
+	if task.ParentTaskID != "" {
+		agentReq["parent_task_id"] = task.ParentTaskID
+	}
+	if len(task.Attachments) > 0 {
+		agentReq["attachments"] = task.Attachments
+	}
+	if dropped := adaptAgentRequest(agentReq, agent); len(dropped) > 0 {
+		detail := "sent without " + strings.Join(dropped, ", ") + ", which the agent does not support"
+		d.queue.RecordEvent(task, DispatchEvent{Event: DispatchEventAdapted, AgentURL: agent.URL, Detail: detail})
+		fmt.Fprintf(os.Stderr, "queue: %s %s\n", task.QueueID, detail)
+	}
 
 	body, _ := json.Marshal(agentReq)
-	resp, err := d.client.Post(agent.URL+"/task", "application/json", bytes.NewReader(body))
+	resp, err := api.WithRequestID(d.client, task.RequestID).Post(agent.URL+"/task", "application/json", bytes.NewReader(body))
 	if err != nil {
 		return "", "", fmt.Errorf("contacting agent: %w", err)
 	}
@@ -174,39 +346,37 @@ func (d *Dispatcher) submitToAgent(agent *ComponentStatus, task *QueuedTask) (ta
 	return agentResp.TaskID, agentResp.SessionID, nil
 }
 
-func (d *Dispatcher) handleDispatchError(task *QueuedTask, err error) {
+func (d *Dispatcher) handleDispatchError(task *QueuedTask, agentURL string, err error) {
 	task.Attempts++
 	task.LastError = err.Error()
 
-	// Check if agent busy (409)
-	var httpErr *HTTPError
-	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusConflict {
-		// Agent became busy between check and submit - requeue at back
-		d.queue.RequeueAtBack(task)
-		fmt.Fprintf(os.Stderr, "queue: requeued %s (agent busy)\n", task.QueueID)
-		return
-	}
-
+	d.queue.RecordEvent(task, DispatchEvent{Event: DispatchEventError, AgentURL: agentURL, Attempt: task.Attempts, Detail: err.Error()})
 	if task.Attempts >= d.queue.Config().MaxAttempts {
 		// Max attempts reached - fail the task
+		d.queue.RecordEvent(task, DispatchEvent{Event: DispatchEventFailed, Detail: fmt.Sprintf("gave up after %d attempts", task.Attempts)})
 		d.queue.SetState(task, TaskStateFailed)
 		d.queue.Remove(task)
+		d.finished(task, string(TaskStateFailed))
 		fmt.Fprintf(os.Stderr, "queue: failed %s after %d attempts: %v\n",
 			task.QueueID, task.Attempts, err)
 		return
 	}
 
 	// Retryable error - back to pending
-	d.queue.SetState(task, TaskStatePending)
+	d.queue.ReturnToPending(task)
 	fmt.Fprintf(os.Stderr, "queue: retry %s (attempt %d/%d): %v\n",
 		task.QueueID, task.Attempts, d.queue.Config().MaxAttempts, err)
 }
 
-// trackCompletion polls the agent for task status until it's terminal
+// trackCompletion polls the agent for task status until it's terminal.
+// It doubles as a liveness watchdog: if the agent stays unreachable for longer
+// than the queue's liveness timeout, or no longer knows about the task, the
+// task is requeued or failed via handleLostTask.
 func (d *Dispatcher) trackCompletion(task *QueuedTask) {
-	ticker := time.NewTicker(5 * time.Second)
+	ticker := time.NewTicker(d.trackInterval)
 	defer ticker.Stop()
 
+	lastSeen := time.Now()
 	for range ticker.C {
 		// Check if task still in queue (might have been cancelled)
 		current := d.queue.Get(task.QueueID)
@@ -215,10 +385,20 @@ func (d *Dispatcher) trackCompletion(task *QueuedTask) {
 		}
 
 		status, err := d.getTaskStatus(task.AgentURL, task.TaskID)
+		if errors.Is(err, errTaskNotFound) {
+			d.handleLostTask(task, fmt.Sprintf("task %s vanished from agent %s", task.TaskID, task.AgentURL))
+			return
+		}
 		if err != nil {
-			// Agent unreachable - keep polling
+			// Agent unreachable - tolerate brief outages
+			if timeout := d.queue.Config().LivenessTimeout; time.Since(lastSeen) >= timeout {
+				d.handleLostTask(task, fmt.Sprintf("agent %s unreachable for over %s: %v",
+					task.AgentURL, timeout, err))
+				return
+			}
 			continue
 		}
+		lastSeen = time.Now()
 
 		if isTerminalState(status) {
 			// Update session store
@@ -226,13 +406,39 @@ func (d *Dispatcher) trackCompletion(task *QueuedTask) {
 				d.sessionStore.UpdateTaskState(task.SessionID, task.TaskID, status)
 			}
 			// Remove from queue
+			d.queue.RecordEvent(task, DispatchEvent{Event: DispatchEventFinished, AgentURL: task.AgentURL, TaskID: task.TaskID, Detail: status})
 			d.queue.Remove(task)
+			d.finished(task, status)
 			fmt.Fprintf(os.Stderr, "queue: completed %s (status=%s)\n", task.QueueID, status)
 			return
 		}
 	}
 }
 
+// handleLostTask deals with a dispatched task whose agent died or forgot it.
+// The task is requeued until it reaches the attempt limit, then failed.
+func (d *Dispatcher) handleLostTask(task *QueuedTask, reason string) {
+	if task.SessionID != "" {
+		d.sessionStore.UpdateTaskState(task.SessionID, task.TaskID, string(TaskStateFailed))
+	}
+
+	attempts := d.queue.RecordAttempt(task, reason)
+	d.queue.RecordEvent(task, DispatchEvent{Event: DispatchEventLost, AgentURL: task.AgentURL, TaskID: task.TaskID, Attempt: attempts, Detail: reason})
+	if attempts >= d.queue.Config().MaxAttempts {
+		d.queue.RecordEvent(task, DispatchEvent{Event: DispatchEventFailed, Detail: fmt.Sprintf("gave up after %d attempts", attempts)})
+		d.queue.SetState(task, TaskStateFailed)
+		d.queue.Remove(task)
+		d.finished(task, string(TaskStateFailed))
+		fmt.Fprintf(os.Stderr, "queue: failed %s after %d attempts: %s\n",
+			task.QueueID, attempts, reason)
+		return
+	}
+
+	d.queue.RequeueAtBack(task)
+	fmt.Fprintf(os.Stderr, "queue: requeued %s (attempt %d/%d): %s\n",
+		task.QueueID, attempts, d.queue.Config().MaxAttempts, reason)
+}
+
 func (d *Dispatcher) getTaskStatus(agentURL, taskID string) (string, error) {
 	resp, err := d.client.Get(agentURL + "/task/" + taskID)
 	if err != nil {
@@ -256,7 +462,10 @@ func (d *Dispatcher) getTaskStatus(agentURL, taskID string) (string, error) {
 			json.NewDecoder(histResp.Body).Decode(&data)
 			return data.State, nil
 		}
-		return "", fmt.Errorf("task not found")
+		if histResp.StatusCode == http.StatusNotFound {
+			return "", errTaskNotFound
+		}
+		return "", fmt.Errorf("history returned status %d", histResp.StatusCode)
 	}
 
 	if resp.StatusCode != http.StatusOK {
@@ -270,6 +479,13 @@ func (d *Dispatcher) getTaskStatus(agentURL, taskID string) (string, error) {
 	return data.State, nil
 }
 
+// isAgentBusy reports whether a submission was refused because the agent
+// is already running a task.
+func isAgentBusy(err error) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusConflict
+}
+
 func isTerminalState(state string) bool {
 	s, ok := taskstate.Parse(state)
 	if !ok {
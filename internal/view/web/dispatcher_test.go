@@ -0,0 +1,573 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/api"
+)
+
+// newWatchdogFixture dispatches one queued task to a fake agent whose task
+// status handler is supplied by the caller.
+func newWatchdogFixture(t *testing.T, cfg QueueConfig, status http.HandlerFunc) (*WorkQueue, *SessionStore, string) {
+	t.Helper()
+
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/task" {
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{"task_id": "task-1", "session_id": "session-1"})
+			return
+		}
+		status(w, r)
+	}))
+	t.Cleanup(agent.Close)
+
+	cfg.Dir = t.TempDir()
+	q, err := NewWorkQueue(cfg)
+	require.NoError(t, err)
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	d.components[agent.URL] = &ComponentStatus{URL: agent.URL, Type: "agent", State: "idle"}
+	d.mu.Unlock()
+
+	ss := NewSessionStore()
+	dispatcher := NewDispatcher(q, d, ss)
+	dispatcher.trackInterval = 10 * time.Millisecond
+
+	task, _, err := q.Add(QueueSubmitRequest{Prompt: "watch me"})
+	require.NoError(t, err)
+	dispatcher.dispatchNext()
+
+	return q, ss, task.QueueID
+}
+
+func TestWatchdogRequeuesVanishedTask(t *testing.T) {
+	t.Parallel()
+
+	q, ss, queueID := newWatchdogFixture(t, QueueConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		// Agent is alive but has no record of the task (e.g. restarted)
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	// Read under the queue lock since the watchdog updates the task concurrently
+	snapshot := func() QueuedTask {
+		q.mu.RLock()
+		defer q.mu.RUnlock()
+		return *q.byID[queueID]
+	}
+	require.Eventually(t, func() bool {
+		return snapshot().State == TaskStatePending
+	}, 2*time.Second, 10*time.Millisecond)
+
+	task := snapshot()
+	require.Equal(t, 1, task.Attempts)
+	require.Contains(t, task.LastError, "vanished")
+	require.Empty(t, task.TaskID)
+
+	session, ok := ss.Get("session-1")
+	require.True(t, ok)
+	require.Equal(t, "failed", session.Tasks[0].State)
+}
+
+func TestWatchdogFailsTaskWhenAgentUnreachable(t *testing.T) {
+	t.Parallel()
+
+	var down atomic.Bool
+	q, _, queueID := newWatchdogFixture(t, QueueConfig{
+		MaxAttempts:     1,
+		LivenessTimeout: 50 * time.Millisecond,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			// Simulate a dead agent by dropping the connection
+			hj, _ := w.(http.Hijacker)
+			conn, _, _ := hj.Hijack()
+			conn.Close()
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"state": "working"})
+	})
+
+	// Agent answers while healthy, so the task stays dispatched
+	time.Sleep(50 * time.Millisecond)
+	require.NotNil(t, q.Get(queueID))
+
+	down.Store(true)
+	require.Eventually(t, func() bool {
+		return q.Get(queueID) == nil
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestWatchdogToleratesBriefOutage(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	q, ss, queueID := newWatchdogFixture(t, QueueConfig{
+		LivenessTimeout: time.Minute,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		switch n := calls.Add(1); {
+		case n <= 3:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			json.NewEncoder(w).Encode(map[string]string{"state": "completed"})
+		}
+	})
+
+	require.Eventually(t, func() bool {
+		return q.Get(queueID) == nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	session, ok := ss.Get("session-1")
+	require.True(t, ok)
+	require.Equal(t, "completed", session.Tasks[0].State)
+}
+
+func TestDispatchFollowUpStaysOnSessionAgent(t *testing.T) {
+	t.Parallel()
+
+	var hits []string
+	newAgent := func(name string) *httptest.Server {
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits = append(hits, name)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{"task_id": "task-" + name, "session_id": "session-1"})
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	preferred := newAgent("preferred")
+	sessionAgent := newAgent("session")
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	d.components[preferred.URL] = &ComponentStatus{URL: preferred.URL, Type: "agent", State: "idle", Tiers: []string{"standard"}}
+	d.components[sessionAgent.URL] = &ComponentStatus{URL: sessionAgent.URL, Type: "agent", State: "idle"}
+	d.mu.Unlock()
+
+	ss := NewSessionStore()
+	ss.AddTask("session-1", sessionAgent.URL, "task-0", "completed", "first")
+	dispatcher := NewDispatcher(q, d, ss)
+	dispatcher.trackInterval = time.Hour // Completion tracking is not under test
+
+	_, _, err = q.Add(QueueSubmitRequest{Prompt: "follow up", SessionID: "session-1"})
+	require.NoError(t, err)
+	dispatcher.dispatchNext()
+
+	require.Equal(t, []string{"session"}, hits)
+}
+
+func TestDispatchTriesAnotherAgentWhenBusy(t *testing.T) {
+	t.Parallel()
+
+	newAgent := func(name string, status int) *httptest.Server {
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{"task_id": "task-" + name, "session_id": "session-" + name})
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	busy := newAgent("busy", http.StatusConflict)
+	idle := newAgent("idle", http.StatusCreated)
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir(), MaxAttempts: 1})
+	require.NoError(t, err)
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	// The busy agent is preferred, so it is tried first
+	d.components[busy.URL] = &ComponentStatus{URL: busy.URL, Type: "agent", State: "idle", Tiers: []string{"standard"}}
+	d.components[idle.URL] = &ComponentStatus{URL: idle.URL, Type: "agent", State: "idle"}
+	d.mu.Unlock()
+
+	ss := NewSessionStore()
+	dispatcher := NewDispatcher(q, d, ss)
+	dispatcher.trackInterval = time.Hour // Completion tracking is not under test
+
+	task, _, err := q.Add(QueueSubmitRequest{Prompt: "race"})
+	require.NoError(t, err)
+	dispatcher.dispatchNext()
+
+	require.Equal(t, TaskStateWorking, task.State)
+	require.Equal(t, idle.URL, task.AgentURL)
+	require.Zero(t, task.Attempts)
+	comp, _ := d.GetComponent(busy.URL)
+	require.Equal(t, "working", comp.State, "marked busy until the next poll")
+
+	// A follow-up can only run on its session's agent, so it waits there
+	ss.AddTask("session-2", busy.URL, "task-0", "completed", "first")
+	d.mu.Lock()
+	d.components[busy.URL] = &ComponentStatus{URL: busy.URL, Type: "agent", State: "idle"}
+	d.mu.Unlock()
+	followUp, _, err := q.Add(QueueSubmitRequest{Prompt: "follow up", SessionID: "session-2"})
+	require.NoError(t, err)
+	dispatcher.dispatchNext()
+
+	require.Equal(t, TaskStatePending, followUp.State)
+	require.Zero(t, followUp.Attempts)
+	require.Equal(t, 1, q.Position(followUp.QueueID))
+	require.NotNil(t, q.Get(followUp.QueueID))
+}
+
+func TestDispatchFailsFollowUpWhenSessionAgentGone(t *testing.T) {
+	t.Parallel()
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir(), LivenessTimeout: 20 * time.Millisecond})
+	require.NoError(t, err)
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	ss := NewSessionStore()
+	ss.AddTask("session-1", "https://localhost:9001", "task-0", "completed", "first")
+	dispatcher := NewDispatcher(q, d, ss)
+	var finished []string
+	events := NewEventBus()
+	events.Subscribe(OnTaskFinished(func(task *QueuedTask, state string) {
+		finished = append(finished, task.QueueID+" "+state)
+	}))
+	dispatcher.SetEventBus(events)
+
+	task, _, err := q.Add(QueueSubmitRequest{Prompt: "follow up", SessionID: "session-1"})
+	require.NoError(t, err)
+
+	// Within the grace period the task keeps waiting for the agent
+	dispatcher.dispatchNext()
+	require.NotNil(t, q.Get(task.QueueID))
+
+	time.Sleep(30 * time.Millisecond)
+	dispatcher.dispatchNext()
+	require.Nil(t, q.Get(task.QueueID))
+	require.Equal(t, TaskStateFailed, task.State)
+	require.Contains(t, task.LastError, "no longer available")
+	require.Equal(t, []string{task.QueueID + " failed"}, finished)
+}
+
+func TestDispatchSkipsFollowUpWaitingForSessionAgent(t *testing.T) {
+	t.Parallel()
+
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"task_id": "task-new", "session_id": "session-new"})
+	}))
+	t.Cleanup(agent.Close)
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir(), LivenessTimeout: time.Minute})
+	require.NoError(t, err)
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	d.components[agent.URL] = &ComponentStatus{URL: agent.URL, Type: "agent", State: "idle"}
+	d.mu.Unlock()
+	ss := NewSessionStore()
+	ss.AddTask("session-1", "https://localhost:9001", "task-0", "completed", "first")
+	dispatcher := NewDispatcher(q, d, ss)
+
+	followUp, _, err := q.Add(QueueSubmitRequest{Prompt: "follow up", SessionID: "session-1"})
+	require.NoError(t, err)
+	fresh, _, err := q.Add(QueueSubmitRequest{Prompt: "new work"})
+	require.NoError(t, err)
+
+	// The follow-up waits for its agent, but the task behind it still goes
+	dispatcher.dispatchNext()
+	require.Equal(t, TaskStatePending, followUp.State)
+	require.Equal(t, TaskStateWorking, fresh.State)
+	require.Contains(t, dispatcher.sessionAgentMissing, followUp.QueueID)
+
+	// Cancelling the follow-up forgets it
+	_, ok := q.Cancel(followUp.QueueID)
+	require.True(t, ok)
+	dispatcher.dispatchNext()
+	require.Empty(t, dispatcher.sessionAgentMissing)
+}
+
+// newScheduleFixture returns a queue and dispatcher with one idle fake agent
+// and a clock fixed at noon local time.
+func newScheduleFixture(t *testing.T, cfg QueueConfig) (*WorkQueue, *Dispatcher, *[]string, time.Time) {
+	t.Helper()
+
+	var prompts []string
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Prompt string `json:"prompt"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		prompts = append(prompts, req.Prompt)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"task_id": "task-" + req.Prompt, "session_id": "session-" + req.Prompt})
+	}))
+	t.Cleanup(agent.Close)
+
+	cfg.Dir = t.TempDir()
+	q, err := NewWorkQueue(cfg)
+	require.NoError(t, err)
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	d.components[agent.URL] = &ComponentStatus{URL: agent.URL, Type: "agent", State: "idle"}
+	d.mu.Unlock()
+
+	noon := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	dispatcher := NewDispatcher(q, d, NewSessionStore())
+	dispatcher.trackInterval = time.Hour // Completion tracking is not under test
+	dispatcher.now = func() time.Time { return noon }
+	return q, dispatcher, &prompts, noon
+}
+
+func TestDispatchDefersTaskOutsideWindow(t *testing.T) {
+	t.Parallel()
+
+	q, dispatcher, prompts, noon := newScheduleFixture(t, QueueConfig{
+		DispatchWindows: []DispatchWindow{{Tier: "heavy", Start: 22 * time.Hour, End: 6 * time.Hour}},
+	})
+
+	heavy, _, err := q.Add(QueueSubmitRequest{Prompt: "heavy", Tier: "heavy"})
+	require.NoError(t, err)
+	_, _, err = q.Add(QueueSubmitRequest{Prompt: "standard"})
+	require.NoError(t, err)
+
+	// The heavy task waits for its window without blocking the one behind it
+	dispatcher.dispatchNext()
+	require.Equal(t, []string{"standard"}, *prompts)
+	require.Equal(t, TaskStatePending, heavy.State)
+	require.NotNil(t, heavy.ScheduledAfter)
+	require.Equal(t, noon.Add(10*time.Hour), *heavy.ScheduledAfter)
+
+	dispatcher.now = func() time.Time { return noon.Add(10 * time.Hour) }
+	dispatcher.dispatchNext()
+	require.Equal(t, []string{"standard", "heavy"}, *prompts)
+	require.Nil(t, heavy.ScheduledAfter)
+}
+
+func TestDispatchWaitsForRunAt(t *testing.T) {
+	t.Parallel()
+
+	q, dispatcher, prompts, noon := newScheduleFixture(t, QueueConfig{})
+
+	runAt := noon.Add(14 * time.Hour) // 2am
+	later, _, err := q.Add(QueueSubmitRequest{Prompt: "nightly", RunAt: &runAt})
+	require.NoError(t, err)
+	past := noon.Add(-time.Minute)
+	_, _, err = q.Add(QueueSubmitRequest{Prompt: "now", RunAt: &past})
+	require.NoError(t, err)
+
+	dispatcher.dispatchNext()
+	dispatcher.dispatchNext()
+	require.Equal(t, []string{"now"}, *prompts)
+	require.Equal(t, TaskStatePending, later.State)
+	require.Equal(t, runAt, *later.ScheduledAfter)
+
+	dispatcher.now = func() time.Time { return runAt }
+	dispatcher.dispatchNext()
+	require.Equal(t, []string{"now", "nightly"}, *prompts)
+}
+
+func TestDispatchRespectsHourlyLimit(t *testing.T) {
+	t.Parallel()
+
+	q, dispatcher, prompts, noon := newScheduleFixture(t, QueueConfig{MaxDispatchesPerHour: 1})
+
+	_, _, err := q.Add(QueueSubmitRequest{Prompt: "first"})
+	require.NoError(t, err)
+	second, _, err := q.Add(QueueSubmitRequest{Prompt: "second"})
+	require.NoError(t, err)
+
+	dispatcher.dispatchNext()
+	dispatcher.dispatchNext()
+	require.Equal(t, []string{"first"}, *prompts)
+	require.NotNil(t, second.ScheduledAfter)
+	require.Equal(t, noon.Add(time.Hour), *second.ScheduledAfter)
+
+	summaries := summarizeQueuedTasks(q.GetAll())
+	require.Equal(t, second.ScheduledAfter, summaries[len(summaries)-1].ScheduledAfter)
+
+	dispatcher.now = func() time.Time { return noon.Add(time.Hour) }
+	dispatcher.dispatchNext()
+	require.Equal(t, []string{"first", "second"}, *prompts)
+}
+
+func TestDispatchSharesFairlyBetweenSources(t *testing.T) {
+	t.Parallel()
+
+	q, dispatcher, prompts, _ := newScheduleFixture(t, QueueConfig{
+		SourceWeights: map[string]int{"web": 2},
+	})
+
+	// A scheduler flood queued ahead of two interactive tasks
+	for _, prompt := range []string{"s1", "s2", "s3", "s4"} {
+		_, _, err := q.Add(QueueSubmitRequest{Prompt: prompt, Source: "scheduler"})
+		require.NoError(t, err)
+	}
+	for _, prompt := range []string{"w1", "w2"} {
+		_, _, err := q.Add(QueueSubmitRequest{Prompt: prompt, Source: "web"})
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, []SourceDepth{
+		{Source: "scheduler", Pending: 4, Weight: 1},
+		{Source: "web", Pending: 2, Weight: 2},
+	}, q.SourceDepths())
+
+	for range 6 {
+		dispatcher.dispatchNext()
+	}
+	require.Equal(t, []string{"s1", "w1", "w2", "s2", "s3", "s4"}, *prompts)
+	require.Equal(t, []SourceDepth{
+		{Source: "scheduler", Dispatched: 4, Weight: 1},
+		{Source: "web", Dispatched: 2, Weight: 2},
+	}, q.SourceDepths())
+}
+
+func TestDispatchExpiresTaskPastDeadline(t *testing.T) {
+	t.Parallel()
+
+	q, dispatcher, prompts, noon := newScheduleFixture(t, QueueConfig{})
+	var finished []string
+	events := NewEventBus()
+	events.Subscribe(OnTaskFinished(func(task *QueuedTask, state string) {
+		finished = append(finished, task.QueueID+" "+state)
+	}))
+	dispatcher.SetEventBus(events)
+
+	deadline := noon.Add(-time.Minute)
+	stale, _, err := q.Add(QueueSubmitRequest{Prompt: "stale", NotAfter: &deadline})
+	require.NoError(t, err)
+	_, _, err = q.Add(QueueSubmitRequest{Prompt: "fresh"})
+	require.NoError(t, err)
+
+	// The expired task is never sent; the one behind it goes instead
+	dispatcher.dispatchNext()
+	require.Equal(t, []string{"fresh"}, *prompts)
+	require.Equal(t, TaskStateExpired, stale.State)
+	require.Nil(t, q.Get(stale.QueueID))
+	require.Equal(t, []string{stale.QueueID + " expired"}, finished)
+}
+
+func TestDispatchForwardsRequestID(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan string, 1)
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/task" {
+			received <- r.Header.Get(api.RequestIDHeader)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{"task_id": "task-1", "session_id": "session-1"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"state": "working"})
+	}))
+	t.Cleanup(agent.Close)
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	d.components[agent.URL] = &ComponentStatus{URL: agent.URL, Type: "agent", State: "idle"}
+	d.mu.Unlock()
+
+	task, _, err := q.Add(QueueSubmitRequest{Prompt: "fix the bug", RequestID: "req-from-cli"})
+	require.NoError(t, err)
+	require.Equal(t, "req-from-cli", task.RequestID)
+	NewDispatcher(q, d, NewSessionStore()).dispatchNext()
+
+	select {
+	case got := <-received:
+		require.Equal(t, "req-from-cli", got)
+	case <-time.After(2 * time.Second):
+		t.Fatal("task was not dispatched")
+	}
+
+	// Tasks the director starts itself get an ID of their own
+	task, _, err = q.Add(QueueSubmitRequest{Prompt: "nightly run", Source: "recurring"})
+	require.NoError(t, err)
+	require.True(t, api.ValidRequestID(task.RequestID))
+}
+
+func TestDispatchAdaptsRequestToAgentCapabilities(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan map[string]any, 1)
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/task" {
+			var req map[string]any
+			json.NewDecoder(r.Body).Decode(&req)
+			received <- req
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{"task_id": "task-1", "session_id": "session-1"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"state": "working"})
+	}))
+	t.Cleanup(agent.Close)
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	d.components[agent.URL] = &ComponentStatus{
+		URL:          agent.URL,
+		Type:         "agent",
+		State:        "idle",
+		APIVersion:   api.APIVersion,
+		Capabilities: []string{api.CapabilityRunnerOptions}, // No task-env
+	}
+	d.mu.Unlock()
+
+	task, _, err := q.Add(QueueSubmitRequest{
+		Prompt:        "deploy",
+		Env:           map[string]string{"DEPLOY_KEY": "secret:deploy"},
+		RunnerOptions: api.RunnerOptions{MaxTurns: 5},
+	})
+	require.NoError(t, err)
+	NewDispatcher(q, d, NewSessionStore()).dispatchNext()
+
+	select {
+	case got := <-received:
+		require.NotContains(t, got, "env")
+		require.EqualValues(t, 5, got["max_turns"])
+	case <-time.After(2 * time.Second):
+		t.Fatal("task was not dispatched")
+	}
+	require.Equal(t, DispatchEventAdapted, task.History[0].Event)
+	require.Contains(t, task.History[0].Detail, "sent without env")
+}
+
+func TestDispatchForwardsAttachments(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan []api.Attachment, 1)
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/task" {
+			var req struct {
+				Attachments []api.Attachment `json:"attachments"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			received <- req.Attachments
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{"task_id": "task-1", "session_id": "session-1"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"state": "working"})
+	}))
+	t.Cleanup(agent.Close)
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	d.components[agent.URL] = &ComponentStatus{URL: agent.URL, Type: "agent", State: "idle"}
+	d.mu.Unlock()
+
+	attachments := []api.Attachment{{Name: "app.log", Data: []byte("ERROR boom\n")}}
+	_, _, err = q.Add(QueueSubmitRequest{Prompt: "review the attached log", Attachments: attachments})
+	require.NoError(t, err)
+	NewDispatcher(q, d, NewSessionStore()).dispatchNext()
+
+	select {
+	case got := <-received:
+		require.Equal(t, attachments, got)
+	case <-time.After(2 * time.Second):
+		t.Fatal("task was not dispatched")
+	}
+}
@@ -0,0 +1,90 @@
+package web
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType names something that happened in the web view
+type EventType string
+
+const (
+	EventTaskSubmitted  EventType = "task.submitted"  // Task added to the queue
+	EventTaskDispatched EventType = "task.dispatched" // Queued task sent to an agent
+	EventTaskFinished   EventType = "task.finished"   // Queued task left the queue; State says how
+	EventSessionUpdated EventType = "session.updated" // Session created, given a task or state, archived, deleted or moved
+	EventDevicePaired   EventType = "device.paired"
+)
+
+// Event is published on the EventBus. Fields not relevant to the type are
+// left empty.
+type Event struct {
+	Type      EventType
+	Time      time.Time
+	Task      *QueuedTask // Task events
+	State     string      // task.finished: completed, failed, cancelled or expired
+	SessionID string      // session.updated
+	Device    string      // device.paired: the device's label
+	IP        string      // device.paired: the client that paired
+}
+
+// EventSink receives every event published on a bus. Sinks run on the
+// publisher's goroutine, in the order they subscribed, and must not block.
+type EventSink interface {
+	HandleEvent(Event)
+}
+
+// EventSinkFunc adapts a function to an EventSink
+type EventSinkFunc func(Event)
+
+// HandleEvent calls f(e)
+func (f EventSinkFunc) HandleEvent(e Event) {
+	f(e)
+}
+
+// OnTaskFinished returns a sink calling fn for task.finished events, for
+// components that learn a task left the queue through a TaskFinished method.
+func OnTaskFinished(fn func(task *QueuedTask, state string)) EventSink {
+	return EventSinkFunc(func(e Event) {
+		if e.Type == EventTaskFinished {
+			fn(e.Task, e.State)
+		}
+	})
+}
+
+// EventBus fans events out from the queue, dispatcher, session store and
+// handlers to the dashboard, webhooks, audit log and metrics. A nil bus
+// drops events, so components work without one.
+type EventBus struct {
+	mu    sync.RWMutex
+	sinks []EventSink
+}
+
+// NewEventBus creates a bus with no sinks
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Subscribe adds a sink for all later events
+func (b *EventBus) Subscribe(sink EventSink) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sinks = append(b.sinks, sink)
+}
+
+// Publish sends e to every sink, stamping its time if unset. It must not be
+// called with locks held that a sink might take.
+func (b *EventBus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.RLock()
+	sinks := b.sinks
+	b.mu.RUnlock()
+	for _, sink := range sinks {
+		sink.HandleEvent(e)
+	}
+}
@@ -0,0 +1,123 @@
+package web
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventBus(t *testing.T) {
+	t.Parallel()
+
+	var nilBus *EventBus
+	nilBus.Publish(Event{Type: EventTaskSubmitted}) // Dropped
+
+	bus := NewEventBus()
+	var seen []string
+	bus.Subscribe(EventSinkFunc(func(e Event) {
+		require.False(t, e.Time.IsZero(), "stamped")
+		seen = append(seen, "all "+string(e.Type))
+	}))
+	bus.Subscribe(OnTaskFinished(func(task *QueuedTask, state string) {
+		seen = append(seen, "finished "+task.QueueID+" "+state)
+	}))
+
+	bus.Publish(Event{Type: EventTaskDispatched, Task: &QueuedTask{QueueID: "q1"}})
+	bus.Publish(Event{Type: EventTaskFinished, Task: &QueuedTask{QueueID: "q1"}, State: "completed"})
+	require.Equal(t, []string{
+		"all task.dispatched",
+		"all task.finished",
+		"finished q1 completed",
+	}, seen)
+}
+
+func TestEventBusPublishers(t *testing.T) {
+	t.Parallel()
+
+	bus := NewEventBus()
+	var events []Event
+	bus.Subscribe(EventSinkFunc(func(e Event) { events = append(events, e) }))
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	q.SetEventBus(bus)
+	task, _, err := q.Add(QueueSubmitRequest{Prompt: "hello", Source: "web"})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, EventTaskSubmitted, events[0].Type)
+	require.Same(t, task, events[0].Task)
+
+	// Session events are published after the store's lock is released, so
+	// sinks can read the store
+	events = nil
+	ss := NewSessionStore()
+	ss.SetEventBus(bus)
+	bus.Subscribe(EventSinkFunc(func(e Event) {
+		if e.Type == EventSessionUpdated {
+			ss.GetAll()
+		}
+	}))
+	ss.AddTask("sess-1", "https://localhost:9000", "task-1", "working", "hello")
+	require.True(t, ss.UpdateTaskState("sess-1", "task-1", "completed"))
+	require.False(t, ss.UpdateTaskState("sess-1", "task-2", "completed"))
+	require.Equal(t, 1, ss.RebindAgent("https://localhost:9000", "https://localhost:9001"))
+	require.True(t, ss.Archive("sess-1"))
+	ss.Delete("sess-1")
+	ss.Delete("sess-1")
+	require.Len(t, events, 5)
+	for _, e := range events {
+		require.Equal(t, EventSessionUpdated, e.Type)
+		require.Equal(t, "sess-1", e.SessionID)
+	}
+}
+
+func TestAccessLoggerEvents(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "access.log")
+	al, err := NewAccessLogger(path)
+	require.NoError(t, err)
+	defer al.Close()
+
+	bus := NewEventBus()
+	bus.Subscribe(al)
+	task := &QueuedTask{QueueID: "queue-1", Source: "web"}
+	bus.Publish(Event{Type: EventTaskSubmitted, Task: task})
+	bus.Publish(Event{Type: EventTaskDispatched, Task: task})
+	bus.Publish(Event{Type: EventTaskFinished, Task: task, State: "failed"})
+	bus.Publish(Event{Type: EventSessionUpdated, SessionID: "sess-1"})
+	bus.Publish(Event{Type: EventDevicePaired, Device: "My Phone", IP: "10.0.0.2"})
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 3, "dispatches and session updates are not logged")
+	require.Contains(t, lines[0], ` event task.submitted queue-1 source="web"`)
+	require.Contains(t, lines[1], ` event task.finished queue-1 state=failed`)
+	require.Contains(t, lines[2], ` event device.paired device="My Phone" ip=10.0.0.2`)
+}
+
+func TestHandleDashboardDataWaitWokenByEvent(t *testing.T) {
+	t.Parallel()
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	h := newTestHandlers(t, d, "test")
+	bus := NewEventBus()
+	h.SetEventBus(bus)
+	h.sessionStore.SetEventBus(bus)
+	etag := waitDashboard(h, "0s", "").Header().Get("ETag")
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		h.sessionStore.AddTask("sess-1", "http://agent:9000", "task-1", "working", "prompt")
+	}()
+	start := time.Now()
+	rec := waitDashboard(h, "30s", etag)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Less(t, time.Since(start), dashboardWatchInterval*8/10, "woken before the next check")
+}
@@ -0,0 +1,182 @@
+package web
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/history"
+	"phobos.org.uk/agency/internal/report"
+)
+
+// defaultExperimentPeriod is longer than the agent report's, as experiments
+// need a few days of tasks before the arms can be compared.
+const defaultExperimentPeriod = 7 * 24 * time.Hour
+
+// ExperimentArmReport summarises the tasks that ran in one arm of a prompt
+// experiment.
+type ExperimentArmReport struct {
+	Arm     string                `json:"arm"`     // history.ArmControl or history.ArmVariant
+	Prompts []history.PromptStamp `json:"prompts"` // Prompt versions the arm ran with
+
+	TasksRun           int     `json:"tasks_run"`
+	Succeeded          int     `json:"succeeded"`
+	Failed             int     `json:"failed"`
+	Cancelled          int     `json:"cancelled"`
+	SuccessRate        float64 `json:"success_rate"` // Fraction of completed or failed tasks that completed (0-1)
+	AvgDurationSeconds float64 `json:"avg_duration_seconds"`
+
+	durations float64
+}
+
+// ExperimentReport compares the arms of a prompt experiment across agents.
+type ExperimentReport struct {
+	Name   string                `json:"name"`
+	Agents []string              `json:"agents"` // URLs of the agents that ran it
+	Arms   []ExperimentArmReport `json:"arms"`   // Control first
+}
+
+// ExperimentsResponse is returned by GET /api/experiments.
+type ExperimentsResponse struct {
+	Since         time.Time          `json:"since"`
+	Until         time.Time          `json:"until"`
+	PeriodSeconds float64            `json:"period_seconds"`
+	Experiments   []ExperimentReport `json:"experiments"` // By name
+
+	Truncated []string          `json:"truncated,omitempty"` // Agents of which only the newest tasks were read
+	Errors    map[string]string `json:"errors,omitempty"`    // Why agents' histories couldn't be read, by URL
+}
+
+// HandleExperiments compares the arms of the prompt experiments agents ran in
+// the last ?period= (default 7d, at most 90d), read from the agents' task
+// histories. ?experiment= limits the report to one experiment.
+func (h *Handlers) HandleExperiments(w http.ResponseWriter, r *http.Request) {
+	period := defaultExperimentPeriod
+	if s := r.URL.Query().Get("period"); s != "" {
+		var err error
+		if period, err = report.ParseWindow(s); err != nil || period > maxReportPeriod {
+			writeError(w, http.StatusBadRequest, api.ErrorValidation,
+				"period must be a duration such as 12h or 7d, at most 90d")
+			return
+		}
+	}
+	only := r.URL.Query().Get("experiment")
+
+	until := time.Now()
+	since := until.Add(-period)
+	client := createHTTPClient(reportFetchTimeout, h.authToken)
+	agents := h.discovery.Agents()
+	type agentTasks struct {
+		entries   []history.EntrySummary
+		truncated bool
+		err       error
+	}
+	results := make([]agentTasks, len(agents))
+	var wg sync.WaitGroup
+	for i, agent := range agents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := &results[i]
+			res.truncated, res.err = walkHistory(client, agent.URL, since, func(e history.EntrySummary) {
+				if p := e.AgencyPrompt; p != nil && p.Experiment != "" && (only == "" || p.Experiment == only) {
+					res.entries = append(res.entries, e)
+				}
+			})
+		}()
+	}
+	wg.Wait()
+
+	resp := ExperimentsResponse{
+		Since:         since.UTC(),
+		Until:         until.UTC(),
+		PeriodSeconds: period.Seconds(),
+		Experiments:   []ExperimentReport{},
+	}
+	byName := map[string]*ExperimentReport{}
+	for i, res := range results {
+		agentURL := agents[i].URL
+		if res.err != nil {
+			if resp.Errors == nil {
+				resp.Errors = map[string]string{}
+			}
+			resp.Errors[agentURL] = res.err.Error()
+		}
+		if res.truncated {
+			resp.Truncated = append(resp.Truncated, agentURL)
+		}
+		for _, e := range res.entries {
+			exp := byName[e.AgencyPrompt.Experiment]
+			if exp == nil {
+				exp = &ExperimentReport{Name: e.AgencyPrompt.Experiment}
+				byName[exp.Name] = exp
+			}
+			if !slices.Contains(exp.Agents, agentURL) {
+				exp.Agents = append(exp.Agents, agentURL)
+			}
+			exp.arm(e.AgencyPrompt.Arm).add(e)
+		}
+	}
+
+	for _, exp := range byName {
+		sort.Slice(exp.Arms, func(i, j int) bool {
+			if (exp.Arms[i].Arm == history.ArmControl) != (exp.Arms[j].Arm == history.ArmControl) {
+				return exp.Arms[i].Arm == history.ArmControl
+			}
+			return exp.Arms[i].Arm < exp.Arms[j].Arm
+		})
+		for i := range exp.Arms {
+			exp.Arms[i].finish()
+		}
+		sort.Strings(exp.Agents)
+		resp.Experiments = append(resp.Experiments, *exp)
+	}
+	sort.Slice(resp.Experiments, func(i, j int) bool {
+		return resp.Experiments[i].Name < resp.Experiments[j].Name
+	})
+	sort.Strings(resp.Truncated)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// arm returns the report of the named arm, adding it if needed.
+func (exp *ExperimentReport) arm(name string) *ExperimentArmReport {
+	for i := range exp.Arms {
+		if exp.Arms[i].Arm == name {
+			return &exp.Arms[i]
+		}
+	}
+	exp.Arms = append(exp.Arms, ExperimentArmReport{Arm: name, Prompts: []history.PromptStamp{}})
+	return &exp.Arms[len(exp.Arms)-1]
+}
+
+// add counts a task that ran in the arm.
+func (arm *ExperimentArmReport) add(e history.EntrySummary) {
+	arm.TasksRun++
+	switch e.State {
+	case "completed":
+		arm.Succeeded++
+	case "failed":
+		arm.Failed++
+	case "cancelled":
+		arm.Cancelled++
+	}
+	arm.durations += e.DurationSeconds
+
+	version := history.PromptStamp{File: e.AgencyPrompt.File, Hash: e.AgencyPrompt.Hash}
+	if !slices.Contains(arm.Prompts, version) {
+		arm.Prompts = append(arm.Prompts, version)
+	}
+}
+
+// finish works out the arm's rates once all its tasks are counted.
+func (arm *ExperimentArmReport) finish() {
+	if arm.TasksRun > 0 {
+		arm.AvgDurationSeconds = arm.durations / float64(arm.TasksRun)
+	}
+	if finished := arm.Succeeded + arm.Failed; finished > 0 {
+		arm.SuccessRate = float64(arm.Succeeded) / float64(finished)
+	}
+}
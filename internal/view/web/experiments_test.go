@@ -0,0 +1,84 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/history"
+)
+
+func TestHandleExperiments(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	entry := func(state, file, experiment, arm string, duration, ago time.Duration) history.EntrySummary {
+		return history.EntrySummary{
+			State:           state,
+			CompletedAt:     now.Add(-ago),
+			DurationSeconds: duration.Seconds(),
+			AgencyPrompt:    &history.PromptStamp{File: file, Hash: file + "-hash", Experiment: experiment, Arm: arm},
+		}
+	}
+	entries := []history.EntrySummary{
+		entry("completed", "claude-prod-b.md", "terse", history.ArmVariant, time.Minute, time.Hour),
+		entry("completed", "claude-prod.md", "terse", history.ArmControl, 3*time.Minute, 2*time.Hour),
+		entry("failed", "claude-prod.md", "terse", history.ArmControl, time.Minute, 3*time.Hour),
+		entry("completed", "claude-prod-b.md", "terse", history.ArmVariant, 3*time.Minute, 4*time.Hour),
+		entry("completed", "claude-prod.md", "", "", time.Minute, 5*time.Hour),                         // Outside any experiment
+		entry("failed", "claude-prod-b.md", "terse", history.ArmVariant, time.Minute, 10*24*time.Hour), // Before the period
+	}
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/status":
+			json.NewEncoder(w).Encode(map[string]any{"type": "agent", "state": "idle", "agent_kind": "claude"})
+		case "/history":
+			json.NewEncoder(w).Encode(history.ListResult{Entries: entries, TotalPages: 1})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(agent.Close)
+
+	d := NewDiscovery(DiscoveryConfig{})
+	d.checkPort(extractPort(t, agent.URL))
+	h := newTestHandlers(t, d, "test")
+
+	w := httptest.NewRecorder()
+	h.HandleExperiments(w, httptest.NewRequest("GET", "/api/experiments", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp ExperimentsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, defaultExperimentPeriod.Seconds(), resp.PeriodSeconds)
+	require.Empty(t, resp.Errors)
+	require.Len(t, resp.Experiments, 1)
+	exp := resp.Experiments[0]
+	require.Equal(t, "terse", exp.Name)
+	require.Len(t, exp.Agents, 1)
+	require.Len(t, exp.Arms, 2)
+
+	control, variant := exp.Arms[0], exp.Arms[1]
+	require.Equal(t, history.ArmControl, control.Arm)
+	require.Equal(t, 2, control.TasksRun)
+	require.InDelta(t, 0.5, control.SuccessRate, 0.001)
+	require.InDelta(t, 120, control.AvgDurationSeconds, 0.001)
+	require.Equal(t, []history.PromptStamp{{File: "claude-prod.md", Hash: "claude-prod.md-hash"}}, control.Prompts)
+	require.Equal(t, history.ArmVariant, variant.Arm)
+	require.Equal(t, 2, variant.TasksRun)
+	require.InDelta(t, 1.0, variant.SuccessRate, 0.001)
+	require.InDelta(t, 120, variant.AvgDurationSeconds, 0.001)
+
+	w = httptest.NewRecorder()
+	h.HandleExperiments(w, httptest.NewRequest("GET", "/api/experiments?experiment=other", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Empty(t, resp.Experiments)
+
+	w = httptest.NewRecorder()
+	h.HandleExperiments(w, httptest.NewRequest("GET", "/api/experiments?period=1y", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
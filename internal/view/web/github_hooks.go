@@ -0,0 +1,395 @@
+package web
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"phobos.org.uk/agency/internal/api"
+)
+
+// GitHub intake defaults
+const (
+	DefaultGitHubLabel  = "agency"
+	DefaultGitHubAPIURL = "https://api.github.com"
+
+	githubCommand         = "/agency"
+	githubSource          = "github"
+	maxGitHubPayload      = 10 << 20 // GitHub caps payloads at 25 MB; issues are far smaller
+	maxGitHubCommentChars = 60000    // GitHub rejects comments over 65536 characters
+	githubRequestTimeout  = 30 * time.Second
+)
+
+// githubRepoPattern matches an "owner/repo" full name.
+var githubRepoPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`)
+
+// GitHubConfig configures the GitHub webhook intake.
+type GitHubConfig struct {
+	WebhookSecret string // Secret shared with GitHub for HMAC verification (empty = intake disabled)
+	Token         string // Token used to comment results back on the issue (empty = no comments)
+	Label         string // Issue label that queues the issue as a task (default: agency)
+	APIURL        string // GitHub API base URL (default: https://api.github.com)
+}
+
+// GitHubHooks turns GitHub issue activity into queued tasks and comments
+// their results back on the issue.
+//
+// A task is queued when someone with write access (owner, member or
+// collaborator) comments "/agency <instructions>" on an issue or pull
+// request, or when the configured label is added to an issue. The task's
+// source is "github" and its source_job is "owner/repo#number", which is how
+// the result finds its way back.
+type GitHubHooks struct {
+	config      GitHubConfig
+	queue       *WorkQueue
+	client      *http.Client // GitHub API
+	agentClient *http.Client // Fetches task output from agents
+}
+
+// NewGitHubHooks creates the GitHub intake for queue.
+func NewGitHubHooks(cfg GitHubConfig, queue *WorkQueue) *GitHubHooks {
+	if cfg.Label == "" {
+		cfg.Label = DefaultGitHubLabel
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = DefaultGitHubAPIURL
+	}
+	cfg.APIURL = strings.TrimRight(cfg.APIURL, "/")
+	return &GitHubHooks{
+		config:      cfg,
+		queue:       queue,
+		client:      &http.Client{Timeout: githubRequestTimeout},
+		agentClient: createHTTPClient(githubRequestTimeout, ""),
+	}
+}
+
+// SetAuthToken sets the bearer token sent to agents
+func (g *GitHubHooks) SetAuthToken(token string) {
+	g.agentClient = createHTTPClient(githubRequestTimeout, token)
+}
+
+// githubUser is the subset of a GitHub user used here.
+type githubUser struct {
+	Login string `json:"login"`
+	Type  string `json:"type"` // "User" or "Bot"
+}
+
+// githubEvent is the subset of issues and issue_comment payloads used here.
+type githubEvent struct {
+	Action     string `json:"action"`
+	Repository struct {
+		FullName string `json:"full_name"`
+		HTMLURL  string `json:"html_url"`
+	} `json:"repository"`
+	Issue struct {
+		Number      int             `json:"number"`
+		Title       string          `json:"title"`
+		Body        string          `json:"body"`
+		HTMLURL     string          `json:"html_url"`
+		PullRequest json.RawMessage `json:"pull_request"` // Set when the issue is a pull request
+	} `json:"issue"`
+	Comment struct {
+		Body              string     `json:"body"`
+		AuthorAssociation string     `json:"author_association"`
+		User              githubUser `json:"user"`
+	} `json:"comment"`
+	Label struct {
+		Name string `json:"name"`
+	} `json:"label"`
+	Sender githubUser `json:"sender"`
+}
+
+// githubHookResponse reports what a webhook delivery did.
+type githubHookResponse struct {
+	Status   string `json:"status"`           // "queued", "duplicate" or "ignored"
+	Reason   string `json:"reason,omitempty"` // Why the delivery was ignored
+	QueueID  string `json:"queue_id,omitempty"`
+	Position int    `json:"position,omitempty"`
+}
+
+// HandleWebhook handles POST /api/hooks/github. Deliveries must carry a
+// valid X-Hub-Signature-256 for the configured secret.
+func (g *GitHubHooks) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	if g.config.WebhookSecret == "" {
+		writeError(w, http.StatusNotFound, api.ErrorNotFound, "GitHub webhooks are not configured")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxGitHubPayload))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, api.ErrorReadError, "Payload too large")
+		return
+	}
+	if !verifyGitHubSignature(g.config.WebhookSecret, body, r.Header.Get("X-Hub-Signature-256")) {
+		writeError(w, http.StatusUnauthorized, api.ErrorUnauthorized, "Invalid webhook signature")
+		return
+	}
+
+	eventType := r.Header.Get("X-GitHub-Event")
+	if eventType == "ping" {
+		writeJSON(w, http.StatusOK, githubHookResponse{Status: "ok"})
+		return
+	}
+
+	var event githubEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		writeError(w, http.StatusBadRequest, api.ErrorParseError, "Invalid JSON payload")
+		return
+	}
+
+	prompt, reason := g.promptFor(eventType, &event)
+	if prompt == "" {
+		writeJSON(w, http.StatusOK, githubHookResponse{Status: "ignored", Reason: reason})
+		return
+	}
+
+	// GitHub redelivers with the same delivery ID, so a redelivery of an
+	// event already queued doesn't start a second task
+	var key string
+	if delivery := r.Header.Get("X-GitHub-Delivery"); delivery != "" {
+		key = "github:" + delivery
+	}
+	task, position, err := g.queue.Add(QueueSubmitRequest{
+		Prompt:         prompt,
+		Source:         githubSource,
+		SourceJob:      fmt.Sprintf("%s#%d", event.Repository.FullName, event.Issue.Number),
+		IdempotencyKey: key,
+		RequestID:      api.RequestIDFromContext(r.Context()),
+	})
+	if err == ErrDuplicate {
+		writeJSON(w, http.StatusOK, githubHookResponse{
+			Status:   "duplicate",
+			QueueID:  task.QueueID,
+			Position: position,
+		})
+		return
+	}
+	if err == ErrQueueFull {
+		writeError(w, http.StatusServiceUnavailable, api.ErrorQueueFull,
+			fmt.Sprintf("Queue is at capacity (%d tasks)", g.queue.Config().MaxSize))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, api.ErrorQueueError, err.Error())
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "github: queued %s for %s (%s by %s)\n",
+		task.QueueID, task.SourceJob, eventType, event.Sender.Login)
+	writeJSON(w, http.StatusAccepted, githubHookResponse{
+		Status:   "queued",
+		QueueID:  task.QueueID,
+		Position: position,
+	})
+}
+
+// verifyGitHubSignature checks an X-Hub-Signature-256 header ("sha256=<hex>")
+// against the HMAC-SHA256 of body.
+func verifyGitHubSignature(secret string, body []byte, header string) bool {
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// promptFor builds the task prompt for an event, or returns why the event
+// doesn't start a task.
+func (g *GitHubHooks) promptFor(eventType string, event *githubEvent) (prompt, reason string) {
+	if !githubRepoPattern.MatchString(event.Repository.FullName) || event.Issue.Number <= 0 {
+		return "", "event has no issue"
+	}
+
+	switch eventType {
+	case "issue_comment":
+		if event.Action != "created" {
+			return "", "comment " + event.Action
+		}
+		instructions, ok := parseGitHubCommand(event.Comment.Body)
+		if !ok {
+			return "", "comment is not an " + githubCommand + " command"
+		}
+		if event.Comment.User.Type == "Bot" {
+			return "", "comment is from a bot"
+		}
+		switch event.Comment.AuthorAssociation {
+		case "OWNER", "MEMBER", "COLLABORATOR":
+		default:
+			return "", fmt.Sprintf("%s is not a collaborator", event.Comment.User.Login)
+		}
+		return buildGitHubPrompt(event, event.Comment.User.Login, instructions), ""
+
+	case "issues":
+		if event.Action != "labeled" {
+			return "", "issue " + event.Action
+		}
+		if !strings.EqualFold(event.Label.Name, g.config.Label) {
+			return "", fmt.Sprintf("label %q is not %q", event.Label.Name, g.config.Label)
+		}
+		return buildGitHubPrompt(event, event.Sender.Login, ""), ""
+	}
+	return "", "unsupported event " + eventType
+}
+
+// parseGitHubCommand extracts the instructions from a comment whose first
+// non-blank line starts with the /agency command. The instructions may be
+// empty, meaning "work on the issue".
+func parseGitHubCommand(body string) (string, bool) {
+	body = strings.TrimSpace(strings.ReplaceAll(body, "\r\n", "\n"))
+	rest, ok := strings.CutPrefix(body, githubCommand)
+	if !ok || (rest != "" && rest[0] != ' ' && rest[0] != '\t' && rest[0] != '\n') {
+		return "", false
+	}
+	return strings.TrimSpace(rest), true
+}
+
+// buildGitHubPrompt injects the repository and issue context ahead of the
+// request.
+func buildGitHubPrompt(event *githubEvent, requester, instructions string) string {
+	kind := "issue"
+	if len(event.Issue.PullRequest) > 0 && string(event.Issue.PullRequest) != "null" {
+		kind = "pull request"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "GitHub repository: %s", event.Repository.FullName)
+	if event.Repository.HTMLURL != "" {
+		fmt.Fprintf(&b, " (%s)", event.Repository.HTMLURL)
+	}
+	fmt.Fprintf(&b, "\nGitHub %s #%d: %s\n", kind, event.Issue.Number, event.Issue.Title)
+	if event.Issue.HTMLURL != "" {
+		fmt.Fprintf(&b, "URL: %s\n", event.Issue.HTMLURL)
+	}
+	if body := strings.TrimSpace(event.Issue.Body); body != "" {
+		fmt.Fprintf(&b, "\n%s description:\n%s\n", kind, body)
+	}
+	if instructions != "" {
+		fmt.Fprintf(&b, "\nRequest from @%s:\n%s\n", requester, instructions)
+	} else {
+		fmt.Fprintf(&b, "\n@%s asked you to work on this %s.\n", requester, kind)
+	}
+	b.WriteString("\nYour final response will be posted as a comment on the " + kind + ".")
+	return b.String()
+}
+
+// TaskFinished comments the result of a finished GitHub task on its issue.
+// Tasks from other sources are ignored. The comment is posted in the
+// background.
+func (g *GitHubHooks) TaskFinished(task *QueuedTask, state string) {
+	if task.Source != githubSource || g.config.Token == "" {
+		return
+	}
+	repo, number, ok := parseGitHubRef(task.SourceJob)
+	if !ok {
+		return
+	}
+	agentURL, taskID, lastError := task.AgentURL, task.TaskID, task.LastError
+	go func() {
+		body := g.resultComment(agentURL, taskID, state, lastError)
+		if err := g.postComment(repo, number, body); err != nil {
+			fmt.Fprintf(os.Stderr, "github: commenting on %s: %v\n", task.SourceJob, err)
+		}
+	}()
+}
+
+// parseGitHubRef splits "owner/repo#number".
+func parseGitHubRef(ref string) (repo string, number int, ok bool) {
+	repo, num, found := strings.Cut(ref, "#")
+	if !found || !githubRepoPattern.MatchString(repo) {
+		return "", 0, false
+	}
+	number, err := strconv.Atoi(num)
+	if err != nil || number <= 0 {
+		return "", 0, false
+	}
+	return repo, number, true
+}
+
+// resultComment builds the comment for a finished task, including the
+// agent's output when it can be fetched.
+func (g *GitHubHooks) resultComment(agentURL, taskID, state, lastError string) string {
+	var output, errMsg string
+	if agentURL != "" && taskID != "" {
+		entry, err := fetchTaskResult(g.agentClient, agentURL, taskID)
+		if err != nil {
+			errMsg = "output unavailable: " + err.Error()
+		} else {
+			output = entry.Output
+			if entry.Error != nil {
+				errMsg = entry.Error.Message
+			}
+		}
+	}
+	if errMsg == "" {
+		errMsg = lastError
+	}
+
+	var b strings.Builder
+	if taskID != "" {
+		fmt.Fprintf(&b, "**Agency** task `%s` %s.", taskID, state)
+	} else {
+		fmt.Fprintf(&b, "**Agency** task %s before it could run.", state)
+	}
+	if state != string(TaskStateCompleted) && errMsg != "" {
+		fmt.Fprintf(&b, "\n\n> %s", strings.ReplaceAll(errMsg, "\n", "\n> "))
+	}
+	if output = strings.TrimSpace(output); output != "" {
+		if len(output) > maxGitHubCommentChars {
+			output = truncateUTF8(output, maxGitHubCommentChars) + "\n\n*(output truncated; see the Agency dashboard for the rest)*"
+		}
+		b.WriteString("\n\n" + output)
+	}
+	return b.String()
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character.
+func truncateUTF8(s string, n int) string {
+	if n >= len(s) {
+		return s
+	}
+	for n > 0 && s[n]&0xC0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
+
+// postComment adds a comment to an issue or pull request.
+func (g *GitHubHooks) postComment(repo string, number int, body string) error {
+	payload, _ := json.Marshal(map[string]string{"body": body})
+	url := fmt.Sprintf("%s/repos/%s/issues/%d/comments", g.config.APIURL, repo, number)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+g.config.Token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("GitHub returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
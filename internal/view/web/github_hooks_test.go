@@ -0,0 +1,291 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testGitHubSecret = "hook-secret"
+
+func signGitHub(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newTestGitHubHooks(t *testing.T, cfg GitHubConfig) (*GitHubHooks, *WorkQueue) {
+	t.Helper()
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	if cfg.WebhookSecret == "" {
+		cfg.WebhookSecret = testGitHubSecret
+	}
+	return NewGitHubHooks(cfg, q), q
+}
+
+func deliverGitHub(h http.Handler, event, body, signature string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/hooks/github", strings.NewReader(body))
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-Hub-Signature-256", signature)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func githubCommentPayload(body, association string) string {
+	payload, _ := json.Marshal(map[string]any{
+		"action":     "created",
+		"repository": map[string]any{"full_name": "acme/widgets", "html_url": "https://github.com/acme/widgets"},
+		"issue": map[string]any{
+			"number":   42,
+			"title":    "Widget crashes on save",
+			"body":     "Steps to reproduce: click save.",
+			"html_url": "https://github.com/acme/widgets/issues/42",
+		},
+		"comment": map[string]any{
+			"body":               body,
+			"author_association": association,
+			"user":               map[string]any{"login": "alice", "type": "User"},
+		},
+		"sender": map[string]any{"login": "alice", "type": "User"},
+	})
+	return string(payload)
+}
+
+func TestVerifyGitHubSignature(t *testing.T) {
+	t.Parallel()
+
+	body := []byte(`{"zen":"hi"}`)
+	require.True(t, verifyGitHubSignature("s3cret", body, signGitHub("s3cret", string(body))))
+	require.False(t, verifyGitHubSignature("other", body, signGitHub("s3cret", string(body))))
+	require.False(t, verifyGitHubSignature("s3cret", []byte(`{"zen":"bye"}`), signGitHub("s3cret", string(body))))
+	require.False(t, verifyGitHubSignature("s3cret", body, ""))
+	require.False(t, verifyGitHubSignature("s3cret", body, "sha1=abc"))
+	require.False(t, verifyGitHubSignature("s3cret", body, "sha256=zz"))
+}
+
+func TestParseGitHubCommand(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		body         string
+		instructions string
+		ok           bool
+	}{
+		{"/agency fix the tests", "fix the tests", true},
+		{"  /agency\r\nadd a changelog entry\r\nand bump the version", "add a changelog entry\nand bump the version", true},
+		{"/agency", "", true},
+		{"/agencyfoo bar", "", false},
+		{"please /agency fix it", "", false},
+		{"LGTM", "", false},
+	}
+	for _, tt := range tests {
+		instructions, ok := parseGitHubCommand(tt.body)
+		require.Equal(t, tt.ok, ok, tt.body)
+		require.Equal(t, tt.instructions, instructions, tt.body)
+	}
+}
+
+func TestGitHubWebhookComment(t *testing.T) {
+	t.Parallel()
+
+	hooks, q := newTestGitHubHooks(t, GitHubConfig{})
+	handler := http.HandlerFunc(hooks.HandleWebhook)
+
+	body := githubCommentPayload("/agency make save idempotent", "MEMBER")
+	rec := deliverGitHub(handler, "issue_comment", body, signGitHub(testGitHubSecret, body))
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+
+	var resp githubHookResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, "queued", resp.Status)
+	require.Equal(t, 1, resp.Position)
+
+	task := q.Get(resp.QueueID)
+	require.NotNil(t, task)
+	require.Equal(t, "github", task.Source)
+	require.Equal(t, "acme/widgets#42", task.SourceJob)
+	require.Contains(t, task.Prompt, "GitHub repository: acme/widgets (https://github.com/acme/widgets)")
+	require.Contains(t, task.Prompt, "GitHub issue #42: Widget crashes on save")
+	require.Contains(t, task.Prompt, "Steps to reproduce: click save.")
+	require.Contains(t, task.Prompt, "Request from @alice:\nmake save idempotent")
+
+	// Bad signatures are rejected before anything is queued
+	rec = deliverGitHub(handler, "issue_comment", body, signGitHub("wrong", body))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Equal(t, 1, q.Depth())
+}
+
+func TestGitHubWebhookRedelivery(t *testing.T) {
+	t.Parallel()
+
+	hooks, q := newTestGitHubHooks(t, GitHubConfig{})
+	body := githubCommentPayload("/agency make save idempotent", "MEMBER")
+	deliver := func(delivery string) githubHookResponse {
+		req := httptest.NewRequest("POST", "/api/hooks/github", strings.NewReader(body))
+		req.Header.Set("X-GitHub-Event", "issue_comment")
+		req.Header.Set("X-GitHub-Delivery", delivery)
+		req.Header.Set("X-Hub-Signature-256", signGitHub(testGitHubSecret, body))
+		rec := httptest.NewRecorder()
+		hooks.HandleWebhook(rec, req)
+		var resp githubHookResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return resp
+	}
+
+	first := deliver("delivery-1")
+	require.Equal(t, "queued", first.Status)
+
+	// A redelivery points at the task already queued
+	again := deliver("delivery-1")
+	require.Equal(t, "duplicate", again.Status)
+	require.Equal(t, first.QueueID, again.QueueID)
+	require.Equal(t, 1, q.Depth())
+
+	// A new delivery of the same comment is a new request
+	require.Equal(t, "queued", deliver("delivery-2").Status)
+	require.Equal(t, 2, q.Depth())
+}
+
+func TestGitHubWebhookIgnored(t *testing.T) {
+	t.Parallel()
+
+	hooks, q := newTestGitHubHooks(t, GitHubConfig{})
+	handler := http.HandlerFunc(hooks.HandleWebhook)
+
+	deliver := func(event, body string) githubHookResponse {
+		t.Helper()
+		rec := deliverGitHub(handler, event, body, signGitHub(testGitHubSecret, body))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var resp githubHookResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return resp
+	}
+
+	require.Equal(t, "ok", deliver("ping", `{"zen":"Keep it simple."}`).Status)
+
+	resp := deliver("issue_comment", githubCommentPayload("Thanks!", "OWNER"))
+	require.Equal(t, "ignored", resp.Status)
+	require.Contains(t, resp.Reason, "not an /agency command")
+
+	// Anyone can comment on a public repository, so outsiders can't start tasks
+	resp = deliver("issue_comment", githubCommentPayload("/agency rm -rf", "NONE"))
+	require.Equal(t, "ignored", resp.Status)
+	require.Contains(t, resp.Reason, "not a collaborator")
+
+	resp = deliver("issues", `{"action":"labeled","label":{"name":"bug"},"repository":{"full_name":"acme/widgets"},"issue":{"number":7}}`)
+	require.Equal(t, "ignored", resp.Status)
+	resp = deliver("push", `{"repository":{"full_name":"acme/widgets"}}`)
+	require.Equal(t, "ignored", resp.Status)
+
+	require.Zero(t, q.Depth())
+}
+
+func TestGitHubWebhookLabel(t *testing.T) {
+	t.Parallel()
+
+	hooks, q := newTestGitHubHooks(t, GitHubConfig{Label: "ai"})
+	body := `{"action":"labeled","label":{"name":"AI"},"sender":{"login":"bob"},
+		"repository":{"full_name":"acme/widgets"},
+		"issue":{"number":9,"title":"Add dark mode","body":"Please","pull_request":null}}`
+	rec := deliverGitHub(http.HandlerFunc(hooks.HandleWebhook), "issues", body, signGitHub(testGitHubSecret, body))
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+
+	tasks := q.GetAll()
+	require.Len(t, tasks, 1)
+	require.Equal(t, "acme/widgets#9", tasks[0].SourceJob)
+	require.Contains(t, tasks[0].Prompt, "GitHub issue #9: Add dark mode")
+	require.Contains(t, tasks[0].Prompt, "@bob asked you to work on this issue.")
+}
+
+func TestGitHubWebhookDisabled(t *testing.T) {
+	t.Parallel()
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	hooks := NewGitHubHooks(GitHubConfig{}, q)
+	rec := deliverGitHub(http.HandlerFunc(hooks.HandleWebhook), "ping", `{}`, signGitHub("", `{}`))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestGitHubWebhookRoute(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	authStore, err := NewAuthStore(filepath.Join(tmpDir, "auth.json"), "password")
+	require.NoError(t, err)
+	d, err := New(&Config{
+		AuthStore: authStore,
+		QueueDir:  filepath.Join(tmpDir, "queue"),
+		GitHub:    GitHubConfig{WebhookSecret: testGitHubSecret},
+	}, "test")
+	require.NoError(t, err)
+
+	// Reachable without a login session; the signature is the authentication
+	body := `{"zen":"hi"}`
+	rec := deliverGitHub(d.Router(), "ping", body, signGitHub(testGitHubSecret, body))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
+
+func TestGitHubTaskFinishedComments(t *testing.T) {
+	t.Parallel()
+
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/history/task-7", r.URL.Path)
+		writeJSON(w, http.StatusOK, map[string]any{"state": "completed", "output": "Fixed the save handler."})
+	}))
+	defer agent.Close()
+
+	comments := make(chan map[string]string, 1)
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/repos/acme/widgets/issues/42/comments", r.URL.Path)
+		require.Equal(t, "Bearer gh-token", r.Header.Get("Authorization"))
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		comments <- body
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer github.Close()
+
+	hooks, _ := newTestGitHubHooks(t, GitHubConfig{Token: "gh-token", APIURL: github.URL})
+
+	// Other sources are left alone
+	hooks.TaskFinished(&QueuedTask{Source: "web", SourceJob: "acme/widgets#42"}, "completed")
+
+	hooks.TaskFinished(&QueuedTask{
+		Source:    "github",
+		SourceJob: "acme/widgets#42",
+		AgentURL:  agent.URL,
+		TaskID:    "task-7",
+	}, "completed")
+
+	select {
+	case body := <-comments:
+		require.Equal(t, "**Agency** task `task-7` completed.\n\nFixed the save handler.", body["body"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("no comment posted")
+	}
+}
+
+func TestGitHubResultComment(t *testing.T) {
+	t.Parallel()
+
+	hooks, _ := newTestGitHubHooks(t, GitHubConfig{})
+
+	// A task that never reached an agent reports the queue's error
+	comment := hooks.resultComment("", "", "failed", "agent busy\nretry later")
+	require.Equal(t, "**Agency** task failed before it could run.\n\n> agent busy\n> retry later", comment)
+
+	require.Equal(t, "ab", truncateUTF8("abc", 2))
+	require.Equal(t, "a", truncateUTF8("aé", 2)) // Doesn't split the two-byte é
+}
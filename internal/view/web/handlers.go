@@ -11,9 +11,14 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/backup"
+	"phobos.org.uk/agency/internal/markup"
 	"phobos.org.uk/agency/internal/tlsutil"
 )
 
@@ -34,9 +39,20 @@ type Handlers struct {
 	tmpl         *template.Template
 	sessionStore *SessionStore
 	authStore    *AuthStore
-	secureCookie bool       // Whether to set Secure flag on cookies (HTTPS)
-	shutdownFunc func()     // Callback to trigger graceful shutdown
-	queue        *WorkQueue // Work queue for status reporting
+	secureCookie bool        // Whether to set Secure flag on cookies (HTTPS)
+	shutdownFunc func()      // Callback to trigger graceful shutdown
+	queue        *WorkQueue  // Work queue for status reporting
+	pipelines    *Pipelines  // Pipelines for status reporting (optional)
+	recurring    *Recurring  // Recurring tasks for the dashboard (optional)
+	autoscaler   *Autoscaler // Scaling events for the dashboard (optional)
+	restarter    *Restarter  // Rolling agent restarts (optional)
+	authToken    string      // Bearer token sent to agents and schedulers (optional)
+	promptRules  PromptRules // Per-source prompt augmentation (optional)
+
+	dashboardSnapshots dashboardSnapshots // Recent versions for ?since= deltas
+	dashboardWatch     dashboardWatch     // Change notification for ?wait= long polls
+	events             *EventBus          // Told of paired devices (optional)
+	backups            *backup.Runner     // Backup status for /status (optional)
 }
 
 // NewHandlers creates handlers with dependencies
@@ -62,14 +78,64 @@ func (h *Handlers) SetShutdownFunc(fn func()) {
 	h.shutdownFunc = fn
 }
 
+// SetRestarter sets the rolling restart orchestrator
+func (h *Handlers) SetRestarter(r *Restarter) {
+	h.restarter = r
+}
+
+// SetEventBus sets the bus told of paired devices, whose events also wake
+// long-polling dashboard requests
+func (h *Handlers) SetEventBus(bus *EventBus) {
+	h.events = bus
+	bus.Subscribe(EventSinkFunc(func(Event) { h.dashboardWatch.nudge() }))
+}
+
+// SetBackups sets the backup runner whose status /status reports
+func (h *Handlers) SetBackups(r *backup.Runner) {
+	h.backups = r
+}
+
+// SetAuthToken sets the bearer token sent to agents and schedulers
+func (h *Handlers) SetAuthToken(token string) {
+	h.authToken = token
+}
+
 // SetQueue sets the work queue for status reporting
 func (h *Handlers) SetQueue(q *WorkQueue) {
 	h.queue = q
 }
 
-// createHTTPClient creates an HTTP client that accepts self-signed certificates for localhost
-func createHTTPClient(timeout time.Duration) *http.Client {
-	return tlsutil.NewHTTPClient(timeout)
+// SetPipelines sets the pipelines shown on the dashboard
+func (h *Handlers) SetPipelines(p *Pipelines) {
+	h.pipelines = p
+}
+
+// SetRecurring sets the recurring tasks shown on the dashboard
+func (h *Handlers) SetRecurring(r *Recurring) {
+	h.recurring = r
+}
+
+// SetAutoscaler sets the autoscaler whose events are shown on the dashboard
+func (h *Handlers) SetAutoscaler(a *Autoscaler) {
+	h.autoscaler = a
+}
+
+// SetPromptRules sets the rules applied to prompts sent straight to agents
+func (h *Handlers) SetPromptRules(rules PromptRules) {
+	h.promptRules = rules
+}
+
+// createHTTPClient creates an HTTP client for calls to components. It accepts
+// self-signed certificates for localhost, sends authToken, if set, as a bearer
+// token, and goes through the shared circuit breakers and connection retries.
+func createHTTPClient(timeout time.Duration, authToken string) *http.Client {
+	client := tlsutil.NewHTTPClient(timeout)
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client.Transport = &agentTransport{base: base, breakers: agentBreakers}
+	return api.WithAuthToken(client, authToken)
 }
 
 func (h *Handlers) requireDiscoveredAgent(w http.ResponseWriter, agentURL string) (*ComponentStatus, bool) {
@@ -86,6 +152,7 @@ func (h *Handlers) HandleDashboard(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	data := map[string]any{
 		"Version": h.version,
+		"Theme":   h.viewerPreferences(r).Theme, // Applied before scripts load, avoiding a flash
 	}
 	if err := h.tmpl.ExecuteTemplate(w, "dashboard.html", data); err != nil {
 		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
@@ -103,6 +170,15 @@ func (h *Handlers) HandleStatus(w http.ResponseWriter, r *http.Request) {
 		"config": map[string]any{
 			"type": "web",
 		},
+		"api_version": api.APIVersion,
+		"capabilities": []string{
+			api.CapabilityCallbacks,
+			api.CapabilityCompare,
+			api.CapabilityIdempotency,
+			api.CapabilityRequestID,
+			api.CapabilityScheduledDispatch,
+			api.CapabilitySSE,
+		},
 	}
 	// Add queue status if available
 	if h.queue != nil {
@@ -113,6 +189,9 @@ func (h *Handlers) HandleStatus(w http.ResponseWriter, r *http.Request) {
 			"dispatched_count":   h.queue.DispatchedCount(),
 		}
 	}
+	if h.backups != nil {
+		resp["backup"] = h.backups.Status()
+	}
 	writeJSON(w, http.StatusOK, resp)
 }
 
@@ -145,6 +224,12 @@ type TaskSubmitRequest struct {
 	Env            map[string]string `json:"env,omitempty"`
 	Source         string            `json:"source,omitempty"`     // "web", "scheduler", "cli" (default: "web")
 	SourceJob      string            `json:"source_job,omitempty"` // Job name for scheduler
+	Attachments    []api.Attachment  `json:"attachments,omitempty"`
+	Uploads        []string          `json:"uploads,omitempty"` // IDs from POST /api/uploads, sent as attachments
+	api.RunnerOptions
+
+	// Session seq the caller last saw; rejected with 409 if it has moved on
+	ExpectedSeq *int `json:"expected_seq,omitempty"`
 }
 
 // TaskSubmitResponse is returned after successful task submission
@@ -193,12 +278,22 @@ func (h *Handlers) HandleTaskSubmit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	source := req.Source
+	if source == "" {
+		source = "web" // Default source is web UI
+	}
+
 	// Build agent task request
-	agentReq := buildAgentRequest(req.Prompt, req.Tier, req.TimeoutSeconds, req.SessionID, req.Env)
+	prompt := h.promptRules.Apply(source, req.Prompt)
+	agentReq := buildAgentRequest(prompt, req.Tier, req.TimeoutSeconds, req.SessionID, req.Env, req.RunnerOptions)
+	if len(req.Attachments) > 0 {
+		agentReq["attachments"] = req.Attachments
+	}
+	adaptAgentRequest(agentReq, agent)
 
 	// Forward to agent
 	body, _ := json.Marshal(agentReq)
-	client := createHTTPClient(10 * time.Second)
+	client := api.WithRequestID(createHTTPClient(10*time.Second, h.authToken), api.RequestIDFromContext(r.Context()))
 	resp, err := client.Post(req.AgentURL+"/task", "application/json", bytes.NewReader(body))
 	if err != nil {
 		writeError(w, http.StatusBadGateway, api.ErrorAgentError, "Failed to contact agent: "+err.Error())
@@ -227,10 +322,6 @@ func (h *Handlers) HandleTaskSubmit(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Track session in session store
-	source := req.Source
-	if source == "" {
-		source = "web" // Default source is web UI
-	}
 	opts := []AddTaskOption{WithSource(source)}
 	if req.SourceJob != "" {
 		opts = append(opts, WithSourceJob(req.SourceJob))
@@ -244,6 +335,62 @@ func (h *Handlers) HandleTaskSubmit(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// HandleRerunTask asks the agent that ran a task to run it again with the same
+// prompt and settings, passing on the optional {"same_session", "env"} body,
+// and tracks the new task's session like a submitted task's.
+func (h *Handlers) HandleRerunTask(w http.ResponseWriter, r *http.Request, taskID string) {
+	agentURL := r.URL.Query().Get("agent_url")
+	if agentURL == "" {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "agent_url query parameter is required")
+		return
+	}
+	agent, ok := h.requireDiscoveredAgent(w, agentURL)
+	if !ok {
+		return
+	}
+	if !api.HasCapability(agent.Capabilities, api.CapabilityRerun) {
+		writeError(w, http.StatusNotImplemented, api.ErrorNotSupported, "Agent does not support re-running tasks; submit the prompt again")
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 64<<10))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "request body too large")
+		return
+	}
+
+	client := api.WithRequestID(createHTTPClient(10*time.Second, h.authToken), api.RequestIDFromContext(r.Context()))
+	resp, err := client.Post(agentURL+"/history/"+url.PathEscape(taskID)+"/rerun", "application/json", bytes.NewReader(body))
+	if err != nil {
+		writeError(w, http.StatusBadGateway, api.ErrorAgentError, "Failed to contact agent: "+err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusCreated {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(resp.StatusCode)
+		w.Write(respBody)
+		return
+	}
+
+	var agentResp struct {
+		TaskID    string `json:"task_id"`
+		SessionID string `json:"session_id"`
+		Prompt    string `json:"prompt"`
+	}
+	if err := json.Unmarshal(respBody, &agentResp); err != nil {
+		writeError(w, http.StatusBadGateway, api.ErrorParseError, "Invalid agent response")
+		return
+	}
+	h.sessionStore.AddTask(agentResp.SessionID, agentURL, agentResp.TaskID, "working", agentResp.Prompt, WithSource("web"))
+
+	writeJSON(w, http.StatusCreated, TaskSubmitResponse{
+		TaskID:    agentResp.TaskID,
+		AgentURL:  agentURL,
+		SessionID: agentResp.SessionID,
+	})
+}
+
 // HandleTaskStatus proxies task status request to the agent.
 // If the agent returns 404 (task completed and moved to history),
 // falls back to checking /history/:id to get the terminal state.
@@ -261,7 +408,7 @@ func (h *Handlers) HandleTaskStatus(w http.ResponseWriter, r *http.Request, task
 	}
 	sessionID := r.URL.Query().Get("session_id") // Optional: for auto-updating session state
 
-	client := createHTTPClient(5 * time.Second)
+	client := createHTTPClient(5*time.Second, h.authToken)
 
 	// Try the active task endpoint first
 	resp, err := client.Get(agentURL + "/task/" + taskID)
@@ -308,7 +455,7 @@ func (h *Handlers) HandleTaskStatus(w http.ResponseWriter, r *http.Request, task
 			// Task found in history - return its state
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusOK)
-			w.Write(body)
+			w.Write(withOutputHTML(r, body))
 			return
 		}
 
@@ -322,15 +469,19 @@ func (h *Handlers) HandleTaskStatus(w http.ResponseWriter, r *http.Request, task
 		return
 	}
 
-	// Forward response as-is
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(resp.StatusCode)
-	if resp.StatusCode == http.StatusOK && sessionID != "" {
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			writeError(w, http.StatusInternalServerError, api.ErrorReadError, "Failed to read task response")
-			return
-		}
+	if resp.StatusCode != http.StatusOK || (sessionID == "" && !wantsHTML(r)) {
+		// Forward response as-is
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, api.ErrorReadError, "Failed to read task response")
+		return
+	}
+	if sessionID != "" {
 		var taskData struct {
 			State string `json:"state"`
 		}
@@ -340,10 +491,71 @@ func (h *Handlers) HandleTaskStatus(w http.ResponseWriter, r *http.Request, task
 				h.sessionStore.UpdateTaskState(sessionID, taskID, taskData.State)
 			}
 		}
-		w.Write(body)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(withOutputHTML(r, body))
+}
+
+// wantsHTML reports whether the request asks for rendered output with
+// ?format=html.
+func wantsHTML(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "html"
+}
+
+// withOutputHTML adds output_html, the task output rendered as sanitised
+// HTML, to a task or history entry and to each entry in a session's tasks,
+// if the request asks for format=html. Other bodies are returned unchanged.
+func withOutputHTML(r *http.Request, body []byte) []byte {
+	if !wantsHTML(r) {
+		return body
+	}
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(body, &obj) != nil {
+		return body
+	}
+	addOutputHTML(obj)
+	if raw, ok := obj["tasks"]; ok {
+		var tasks []map[string]json.RawMessage
+		if json.Unmarshal(raw, &tasks) == nil {
+			for _, task := range tasks {
+				addOutputHTML(task)
+			}
+			obj["tasks"], _ = json.Marshal(tasks)
+		}
+	}
+	out, err := json.Marshal(obj)
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+// addOutputHTML sets output_html from the output field, if there is one.
+func addOutputHTML(obj map[string]json.RawMessage) {
+	var output string
+	if json.Unmarshal(obj["output"], &output) != nil || output == "" {
 		return
 	}
-	io.Copy(w, resp.Body)
+	obj["output_html"], _ = json.Marshal(markup.Render(output))
+}
+
+// copyAgentJSON forwards an agent's JSON response, adding output_html to a
+// successful one if the request asks for format=html.
+func copyAgentJSON(w http.ResponseWriter, r *http.Request, resp *http.Response) {
+	w.Header().Set("Content-Type", "application/json")
+	if resp.StatusCode != http.StatusOK || !wantsHTML(r) {
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, api.ErrorReadError, "Failed to read agent response")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(withOutputHTML(r, body))
 }
 
 // HandleTaskHistory proxies task history request to the agent
@@ -358,7 +570,7 @@ func (h *Handlers) HandleTaskHistory(w http.ResponseWriter, r *http.Request, tas
 	}
 
 	// Forward to agent
-	client := createHTTPClient(5 * time.Second)
+	client := createHTTPClient(5*time.Second, h.authToken)
 	resp, err := client.Get(agentURL + "/history/" + taskID)
 	if err != nil {
 		writeError(w, http.StatusBadGateway, api.ErrorAgentError, "Failed to contact agent: "+err.Error())
@@ -366,12 +578,138 @@ func (h *Handlers) HandleTaskHistory(w http.ResponseWriter, r *http.Request, tas
 	}
 	defer resp.Body.Close()
 
-	// Forward response as-is
+	copyAgentJSON(w, r, resp)
+}
+
+// HandleAnnotateTask proxies a task's rating, notes and tags to the agent's
+// PATCH /history/{id}.
+func (h *Handlers) HandleAnnotateTask(w http.ResponseWriter, r *http.Request, taskID string) {
+	agentURL := r.URL.Query().Get("agent_url")
+	if agentURL == "" {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "agent_url query parameter is required")
+		return
+	}
+	agent, ok := h.requireDiscoveredAgent(w, agentURL)
+	if !ok {
+		return
+	}
+	if !api.HasCapability(agent.Capabilities, api.CapabilityAnnotations) {
+		writeError(w, http.StatusNotImplemented, api.ErrorNotSupported, "Agent does not support annotating tasks")
+		return
+	}
+	h.forwardToAgent(w, r, agentURL+"/history/"+url.PathEscape(taskID), 64<<10)
+}
+
+// HandleSessionHistory proxies a session's aggregated history from the agent
+func (h *Handlers) HandleSessionHistory(w http.ResponseWriter, r *http.Request, sessionID string) {
+	agentURL := r.URL.Query().Get("agent_url")
+	if agentURL == "" {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "agent_url query parameter is required")
+		return
+	}
+	if _, ok := h.requireDiscoveredAgent(w, agentURL); !ok {
+		return
+	}
+
+	client := createHTTPClient(10*time.Second, h.authToken)
+	resp, err := client.Get(agentURL + "/history/sessions/" + url.PathEscape(sessionID))
+	if err != nil {
+		writeError(w, http.StatusBadGateway, api.ErrorAgentError, "Failed to contact agent: "+err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	copyAgentJSON(w, r, resp)
+}
+
+// HandleHistoryDiff proxies a comparison of two history entries from the agent
+func (h *Handlers) HandleHistoryDiff(w http.ResponseWriter, r *http.Request) {
+	agentURL := r.URL.Query().Get("agent_url")
+	if agentURL == "" {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "agent_url query parameter is required")
+		return
+	}
+	taskA := r.URL.Query().Get("a")
+	taskB := r.URL.Query().Get("b")
+	if taskA == "" || taskB == "" {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "a and b query parameters are required")
+		return
+	}
+	if _, ok := h.requireDiscoveredAgent(w, agentURL); !ok {
+		return
+	}
+
+	query := url.Values{"a": {taskA}, "b": {taskB}}
+	client := createHTTPClient(10*time.Second, h.authToken)
+	resp, err := client.Get(agentURL + "/history/diff?" + query.Encode())
+	if err != nil {
+		writeError(w, http.StatusBadGateway, api.ErrorAgentError, "Failed to contact agent: "+err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// HandleTaskArtifacts proxies the artifact listing for a task to the agent
+func (h *Handlers) HandleTaskArtifacts(w http.ResponseWriter, r *http.Request, taskID string) {
+	agentURL := r.URL.Query().Get("agent_url")
+	if agentURL == "" {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "agent_url query parameter is required")
+		return
+	}
+	if _, ok := h.requireDiscoveredAgent(w, agentURL); !ok {
+		return
+	}
+
+	client := createHTTPClient(5*time.Second, h.authToken)
+	resp, err := client.Get(agentURL + "/history/" + url.PathEscape(taskID) + "/artifacts")
+	if err != nil {
+		writeError(w, http.StatusBadGateway, api.ErrorAgentError, "Failed to contact agent: "+err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(resp.StatusCode)
 	io.Copy(w, resp.Body)
 }
 
+// HandleTaskArtifact proxies a single artifact download from the agent
+func (h *Handlers) HandleTaskArtifact(w http.ResponseWriter, r *http.Request, taskID, name string) {
+	agentURL := r.URL.Query().Get("agent_url")
+	if agentURL == "" {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "agent_url query parameter is required")
+		return
+	}
+	if _, ok := h.requireDiscoveredAgent(w, agentURL); !ok {
+		return
+	}
+
+	segments := strings.Split(name, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+
+	client := createHTTPClient(30*time.Second, h.authToken)
+	resp, err := client.Get(agentURL + "/history/" + url.PathEscape(taskID) + "/artifacts/" + strings.Join(segments, "/"))
+	if err != nil {
+		writeError(w, http.StatusBadGateway, api.ErrorAgentError, "Failed to contact agent: "+err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, header := range []string{"Content-Type", "Content-Disposition", "X-Content-Type-Options"} {
+		if v := resp.Header.Get(header); v != "" {
+			w.Header().Set(header, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
 // HandleAgentLogs proxies log requests to the agent
 func (h *Handlers) HandleAgentLogs(w http.ResponseWriter, r *http.Request) {
 	agentURL := r.URL.Query().Get("agent_url")
@@ -393,6 +731,9 @@ func (h *Handlers) HandleAgentLogs(w http.ResponseWriter, r *http.Request) {
 	if taskID := r.URL.Query().Get("task_id"); taskID != "" {
 		queryParams.Set("task_id", taskID)
 	}
+	if requestID := r.URL.Query().Get("request_id"); requestID != "" {
+		queryParams.Set("request_id", requestID)
+	}
 	if level := r.URL.Query().Get("level"); level != "" {
 		queryParams.Set("level", level)
 	}
@@ -408,7 +749,7 @@ func (h *Handlers) HandleAgentLogs(w http.ResponseWriter, r *http.Request) {
 	proxyURL.RawQuery = queryParams.Encode()
 
 	// Forward to agent
-	client := createHTTPClient(5 * time.Second)
+	client := createHTTPClient(5*time.Second, h.authToken)
 	resp, err := client.Get(proxyURL.String())
 	if err != nil {
 		writeError(w, http.StatusBadGateway, api.ErrorAgentError, "Failed to contact agent: "+err.Error())
@@ -422,6 +763,79 @@ func (h *Handlers) HandleAgentLogs(w http.ResponseWriter, r *http.Request) {
 	io.Copy(w, resp.Body)
 }
 
+// HandleAgentLogStream proxies an agent's log stream for a task, passing each
+// event on as it arrives
+func (h *Handlers) HandleAgentLogStream(w http.ResponseWriter, r *http.Request) {
+	agentURL := r.URL.Query().Get("agent_url")
+	if agentURL == "" {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "agent_url query parameter is required")
+		return
+	}
+	taskID := r.URL.Query().Get("task_id")
+	if taskID == "" {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "task_id query parameter is required")
+		return
+	}
+	agent, ok := h.requireDiscoveredAgent(w, agentURL)
+	if !ok {
+		return
+	}
+	if !api.HasCapability(agent.Capabilities, api.CapabilitySSE) {
+		writeError(w, http.StatusNotImplemented, api.ErrorNotSupported, "Agent does not stream logs; poll /api/logs instead")
+		return
+	}
+
+	proxyURL, err := url.Parse(agentURL + "/logs/stream")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "invalid agent_url")
+		return
+	}
+	queryParams := url.Values{}
+	queryParams.Set("task_id", taskID)
+	for _, param := range []string{"level", "limit"} {
+		if v := r.URL.Query().Get(param); v != "" {
+			queryParams.Set(param, v)
+		}
+	}
+	proxyURL.RawQuery = queryParams.Encode()
+
+	// The stream lasts until the browser goes away, which cancels the request
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, proxyURL.String(), nil)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "invalid agent_url")
+		return
+	}
+	client := createHTTPClient(0, h.authToken)
+	resp, err := client.Do(req)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, api.ErrorAgentError, "Failed to contact agent: "+err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(resp.StatusCode)
+	rc.Flush()
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil || rc.Flush() != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
 // HandleAgentLogStats proxies log stats requests to the agent
 func (h *Handlers) HandleAgentLogStats(w http.ResponseWriter, r *http.Request) {
 	agentURL := r.URL.Query().Get("agent_url")
@@ -434,7 +848,7 @@ func (h *Handlers) HandleAgentLogStats(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Forward to agent
-	client := createHTTPClient(5 * time.Second)
+	client := createHTTPClient(5*time.Second, h.authToken)
 	resp, err := client.Get(agentURL + "/logs/stats")
 	if err != nil {
 		writeError(w, http.StatusBadGateway, api.ErrorAgentError, "Failed to contact agent: "+err.Error())
@@ -448,6 +862,130 @@ func (h *Handlers) HandleAgentLogStats(w http.ResponseWriter, r *http.Request) {
 	io.Copy(w, resp.Body)
 }
 
+// HandleAgentSessions proxies the agent's list of session workdirs
+func (h *Handlers) HandleAgentSessions(w http.ResponseWriter, r *http.Request) {
+	agentURL := r.URL.Query().Get("agent_url")
+	if agentURL == "" {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "agent_url query parameter is required")
+		return
+	}
+	if _, ok := h.requireDiscoveredAgent(w, agentURL); !ok {
+		return
+	}
+
+	// Sizing workdirs walks the disk, so allow longer than a status call
+	client := createHTTPClient(30*time.Second, h.authToken)
+	resp, err := client.Get(agentURL + "/sessions")
+	if err != nil {
+		writeError(w, http.StatusBadGateway, api.ErrorAgentError, "Failed to contact agent: "+err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// HandleDeleteAgentSession proxies the deletion of a session's workdir and
+// CLI state to the agent
+func (h *Handlers) HandleDeleteAgentSession(w http.ResponseWriter, r *http.Request, sessionID string) {
+	agentURL := r.URL.Query().Get("agent_url")
+	if agentURL == "" {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "agent_url query parameter is required")
+		return
+	}
+	if _, ok := h.requireDiscoveredAgent(w, agentURL); !ok {
+		return
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodDelete, agentURL+"/sessions/"+url.PathEscape(sessionID), nil)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "invalid agent_url")
+		return
+	}
+	client := createHTTPClient(30*time.Second, h.authToken)
+	resp, err := client.Do(req)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, api.ErrorAgentError, "Failed to contact agent: "+err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// HandleAgentConfig proxies GET and PUT /config to an agent, for viewing and
+// changing its tier models and timeouts. escapedURL is the agent URL,
+// path-escaped into /api/agents/{url}/config.
+func (h *Handlers) HandleAgentConfig(w http.ResponseWriter, r *http.Request, escapedURL string) {
+	agentURL, err := url.PathUnescape(escapedURL)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "invalid agent URL")
+		return
+	}
+	agent, ok := h.requireDiscoveredAgent(w, agentURL)
+	if !ok {
+		return
+	}
+	if !slices.Contains(agent.Interfaces, api.InterfaceConfigurable) {
+		writeError(w, http.StatusNotImplemented, api.ErrorNotSupported, "Agent does not support remote configuration; edit its config file")
+		return
+	}
+	h.forwardToAgent(w, r, agentURL+"/config", 64<<10)
+}
+
+// HandleAgentPrompts proxies GET /prompts, and GET and PUT /prompts/{name}
+// when name is set, to an agent, for editing its agency prompts.
+func (h *Handlers) HandleAgentPrompts(w http.ResponseWriter, r *http.Request, escapedURL, name string) {
+	agentURL, err := url.PathUnescape(escapedURL)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "invalid agent URL")
+		return
+	}
+	agent, ok := h.requireDiscoveredAgent(w, agentURL)
+	if !ok {
+		return
+	}
+	if !api.HasCapability(agent.Capabilities, api.CapabilityPrompts) {
+		writeError(w, http.StatusNotImplemented, api.ErrorNotSupported, "Agent does not support editing prompts; edit the files in its prompts directory")
+		return
+	}
+	target := agentURL + "/prompts"
+	if name != "" {
+		target += "/" + url.PathEscape(name)
+	}
+	h.forwardToAgent(w, r, target, 4<<20)
+}
+
+// forwardToAgent sends r's method, and its body for PUTs and PATCHes of up
+// to maxBody bytes, to target and copies back the agent's JSON response.
+func (h *Handlers) forwardToAgent(w http.ResponseWriter, r *http.Request, target string, maxBody int64) {
+	var body io.Reader
+	if r.Method == http.MethodPut || r.Method == http.MethodPatch {
+		body = http.MaxBytesReader(w, r.Body, maxBody)
+	}
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, target, body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "invalid agent URL")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := createHTTPClient(10*time.Second, h.authToken)
+	resp, err := client.Do(req)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, api.ErrorAgentError, "Failed to contact agent: "+err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
 // HandleSessions returns all sessions
 func (h *Handlers) HandleSessions(w http.ResponseWriter, r *http.Request) {
 	sessions := h.sessionStore.GetAll()
@@ -502,13 +1040,26 @@ func (h *Handlers) HandleUpdateSessionTask(w http.ResponseWriter, r *http.Reques
 	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
+// dashboardScaleEvents is how many recent scaling events the dashboard shows.
+const dashboardScaleEvents = 10
+
 // DashboardData represents the consolidated dashboard response
 type DashboardData struct {
 	Agents    []*ComponentStatus `json:"agents"`
 	Directors []*ComponentStatus `json:"directors"`
 	Helpers   []*ComponentStatus `json:"helpers"`
-	Sessions  []*Session         `json:"sessions"`
+	Sessions  []DashboardSession `json:"sessions"`
 	Queue     *QueueInfo         `json:"queue,omitempty"`
+	Pipelines []*Pipeline        `json:"pipelines,omitempty"` // Running, or finished within the last hour
+	Recurring []*RecurringTask   `json:"recurring,omitempty"`
+	Autoscale *AutoscaleStatus   `json:"autoscale,omitempty"` // Only when autoscaling is configured
+}
+
+// DashboardSession is a session with its times formatted for the viewer
+type DashboardSession struct {
+	*Session
+	CreatedLocal *LocalTime `json:"created_local,omitempty"`
+	UpdatedLocal *LocalTime `json:"updated_local,omitempty"`
 }
 
 // QueueInfo represents queue status in dashboard data
@@ -517,11 +1068,12 @@ type QueueInfo struct {
 	MaxSize          int                 `json:"max_size"`
 	OldestAgeSeconds float64             `json:"oldest_age_seconds"`
 	DispatchedCount  int                 `json:"dispatched_count"`
+	Sources          []SourceDepth       `json:"sources"`
 	Tasks            []QueuedTaskSummary `json:"tasks"`
 }
 
-// HandleDashboardData returns all dashboard data in a single request with ETag support
-func (h *Handlers) HandleDashboardData(w http.ResponseWriter, r *http.Request) {
+// dashboardData gathers the dashboard data, with times formatted by times
+func (h *Handlers) dashboardData(times *timeFormatter) DashboardData {
 	agents := h.discovery.Agents()
 	if agents == nil {
 		agents = []*ComponentStatus{}
@@ -537,9 +1089,13 @@ func (h *Handlers) HandleDashboardData(w http.ResponseWriter, r *http.Request) {
 		helpers = []*ComponentStatus{}
 	}
 
-	sessions := h.sessionStore.GetAll()
-	if sessions == nil {
-		sessions = []*Session{}
+	sessions := []DashboardSession{}
+	for _, session := range h.sessionStore.GetAll() {
+		sessions = append(sessions, DashboardSession{
+			Session:      session,
+			CreatedLocal: times.format(session.CreatedAt),
+			UpdatedLocal: times.format(session.UpdatedAt),
+		})
 	}
 
 	data := DashboardData{
@@ -556,25 +1112,121 @@ func (h *Handlers) HandleDashboardData(w http.ResponseWriter, r *http.Request) {
 			MaxSize:          h.queue.Config().MaxSize,
 			OldestAgeSeconds: h.queue.OldestAge(),
 			DispatchedCount:  h.queue.DispatchedCount(),
+			Sources:          h.queue.SourceDepths(),
 			Tasks:            summarizeQueuedTasks(h.queue.GetAll()),
 		}
+		for i := range data.Queue.Tasks {
+			task := &data.Queue.Tasks[i]
+			task.CreatedLocal = times.format(task.CreatedAt)
+			task.ScheduledLocal = times.formatPtr(task.ScheduledAfter)
+		}
 	}
 
-	// Generate ETag from JSON content
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "marshal_error", err.Error())
-		return
+	if h.pipelines != nil {
+		cutoff := time.Now().Add(-time.Hour)
+		for _, pl := range h.pipelines.All() {
+			if pl.FinishedAt == nil || pl.FinishedAt.After(cutoff) {
+				data.Pipelines = append(data.Pipelines, pl)
+			}
+		}
+	}
+
+	if h.recurring != nil {
+		data.Recurring = h.recurring.All()
+	}
+	if h.autoscaler != nil {
+		data.Autoscale = h.autoscaler.Status()
+		data.Autoscale.Events = data.Autoscale.Events[:min(len(data.Autoscale.Events), dashboardScaleEvents)]
+	}
+
+	return data
+}
+
+// HandleDashboardData returns all dashboard data in a single request with ETag
+// support. With ?since=<etag> it returns only what changed since that version.
+// With ?wait=<duration> and a version the client already has, it holds the
+// request until the data changes, answering 304 if the wait runs out.
+func (h *Handlers) HandleDashboardData(w http.ResponseWriter, r *http.Request) {
+	since := r.URL.Query().Get("since")
+	var wait time.Duration
+	if s := r.URL.Query().Get("wait"); s != "" {
+		var err error
+		if wait, err = time.ParseDuration(s); err != nil || wait < 0 || wait > maxDashboardWait {
+			writeError(w, http.StatusBadRequest, api.ErrorValidation,
+				"wait must be a duration such as 30s, at most 60s")
+			return
+		}
 	}
 
-	hash := sha256.Sum256(jsonData)
-	etag := `"` + hex.EncodeToString(hash[:8]) + `"`
+	// The version the client has: If-None-Match, or the one a delta was asked against
+	current := r.Header.Get("If-None-Match")
+	if since != "" {
+		current = quoteETag(since)
+	}
+	var timeout <-chan time.Time
+	if wait > 0 && current != "" {
+		defer h.watchDashboard()()
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+		// The response can go out after the server's write timeout
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + dashboardWriteSlack))
+	}
+
+	var data DashboardData
+	var jsonData []byte
+	var etag string
+	for {
+		var changed <-chan struct{}
+		if timeout != nil {
+			changed = h.dashboardWatch.next()
+		}
 
-	// Check If-None-Match header
-	if match := r.Header.Get("If-None-Match"); match == etag {
-		w.WriteHeader(http.StatusNotModified)
+		data = h.dashboardData(h.viewerTimes(r))
+		var err error
+		if jsonData, err = json.Marshal(data); err != nil {
+			writeError(w, http.StatusInternalServerError, "marshal_error", err.Error())
+			return
+		}
+		hash := sha256.Sum256(jsonData)
+		etag = `"` + hex.EncodeToString(hash[:8]) + `"`
+		if etag != current {
+			break
+		}
+		if timeout == nil {
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-timeout:
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	snap, err := snapshotDashboard(&data)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "marshal_error", err.Error())
 		return
 	}
+	var base *dashboardSnapshot
+	if since != "" {
+		base = h.dashboardSnapshots.get(since)
+	}
+	h.dashboardSnapshots.put(etag, snap)
+	// An unknown or evicted version gets the full data
+	if base != nil {
+		if jsonData, err = json.Marshal(diffDashboard(since, base, snap)); err != nil {
+			writeError(w, http.StatusInternalServerError, "marshal_error", err.Error())
+			return
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("ETag", etag)
@@ -600,10 +1252,7 @@ func (h *Handlers) HandleLoginPage(w http.ResponseWriter, r *http.Request) {
 
 // HandleLogin processes login form submission
 func (h *Handlers) HandleLogin(w http.ResponseWriter, r *http.Request) {
-	ip := r.RemoteAddr
-	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
-		ip = realIP
-	}
+	ip := clientIP(r)
 
 	if err := r.ParseForm(); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid form data")
@@ -622,6 +1271,25 @@ func (h *Handlers) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Second factor, once the password is known to be right
+	if h.authStore.TOTPEnabled() {
+		code := r.FormValue("totp_code")
+		if code == "" {
+			writeError(w, http.StatusUnauthorized, "totp_required", "Two-factor code required")
+			return
+		}
+		ok, retryAt := h.authStore.VerifyLoginSecondFactor(ip, code)
+		if !retryAt.IsZero() {
+			w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(retryAt).Seconds())+1))
+			writeError(w, http.StatusTooManyRequests, "totp_locked", "Too many invalid two-factor codes, try again later")
+			return
+		}
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "invalid_totp", "Invalid two-factor code")
+			return
+		}
+	}
+
 	// Create session
 	session, err := h.authStore.CreateAuthSession(ip, r.UserAgent())
 	if err != nil {
@@ -645,7 +1313,8 @@ func (h *Handlers) HandleLogout(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/login", http.StatusFound)
 }
 
-// HandlePairPage renders the pairing form
+// HandlePairPage renders the pairing form, pre-filled from the code query
+// parameter set by pairing QR codes
 func (h *Handlers) HandlePairPage(w http.ResponseWriter, r *http.Request) {
 	// If already logged in, redirect to dashboard
 	if cookie, err := r.Cookie(SessionCookieName); err == nil && cookie.Value != "" {
@@ -655,18 +1324,29 @@ func (h *Handlers) HandlePairPage(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	data := struct{ Code string }{}
+	if code := strings.ToUpper(r.URL.Query().Get("code")); len(code) == PairingCodeLength {
+		data.Code = code
+	}
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := h.tmpl.ExecuteTemplate(w, "pair.html", nil); err != nil {
+	if err := h.tmpl.ExecuteTemplate(w, "pair.html", data); err != nil {
+		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// HandleComparePage renders the side-by-side view of a comparison, which
+// loads the comparison from /api/task/compare/{id}
+func (h *Handlers) HandleComparePage(w http.ResponseWriter, r *http.Request, id string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.tmpl.ExecuteTemplate(w, "compare.html", struct{ ID string }{id}); err != nil {
 		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
 	}
 }
 
 // HandlePair processes pairing code submission
 func (h *Handlers) HandlePair(w http.ResponseWriter, r *http.Request) {
-	ip := r.RemoteAddr
-	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
-		ip = realIP
-	}
+	ip := clientIP(r)
 
 	if err := r.ParseForm(); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid form data")
@@ -691,6 +1371,8 @@ func (h *Handlers) HandlePair(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.events.Publish(Event{Type: EventDevicePaired, Device: label, IP: ip})
+
 	// Set long-lived cookie for device session
 	SetDeviceSessionCookie(w, session.ID, h.secureCookie)
 	http.Redirect(w, r, "/", http.StatusFound)
@@ -724,6 +1406,8 @@ type DeviceInfo struct {
 	LastSeen  time.Time `json:"last_seen"`
 	IPAddress string    `json:"ip_address"`
 	IsCurrent bool      `json:"is_current"` // Is this the current session?
+
+	LastSeenLocal *LocalTime `json:"last_seen_local,omitempty"` // For the viewer
 }
 
 // HandleListDevices returns all paired devices (requires session)
@@ -732,6 +1416,7 @@ func (h *Handlers) HandleListDevices(w http.ResponseWriter, r *http.Request) {
 
 	sessions := h.authStore.ListAllSessions()
 	devices := make([]DeviceInfo, 0, len(sessions))
+	times := h.viewerTimes(r)
 
 	for _, s := range sessions {
 		devices = append(devices, DeviceInfo{
@@ -741,6 +1426,8 @@ func (h *Handlers) HandleListDevices(w http.ResponseWriter, r *http.Request) {
 			LastSeen:  s.LastSeen,
 			IPAddress: s.IPAddress,
 			IsCurrent: currentSession != nil && s.ID == currentSession.ID,
+
+			LastSeenLocal: times.format(s.LastSeen),
 		})
 	}
 
@@ -780,13 +1467,34 @@ func (h *Handlers) HandleArchiveSession(w http.ResponseWriter, r *http.Request,
 
 // HandleTriggerJob proxies a job trigger request to a scheduler
 func (h *Handlers) HandleTriggerJob(w http.ResponseWriter, r *http.Request, schedulerURL, jobName string) {
-	client := createHTTPClient(10 * time.Second)
+	h.proxyToScheduler(w, http.MethodPost, schedulerURL+"/trigger/"+jobName, nil)
+}
 
-	req, err := http.NewRequest(http.MethodPost, schedulerURL+"/trigger/"+jobName, nil)
+// HandleResumeJob proxies a request to resume a suspended job to a scheduler
+func (h *Handlers) HandleResumeJob(w http.ResponseWriter, r *http.Request, schedulerURL, jobName string) {
+	h.proxyToScheduler(w, http.MethodPost, schedulerURL+"/jobs/"+url.PathEscape(jobName)+"/resume", nil)
+}
+
+// HandleSchedulerJob proxies a job create, update or delete request to a
+// scheduler. An empty jobName targets the job collection (create).
+func (h *Handlers) HandleSchedulerJob(w http.ResponseWriter, r *http.Request, schedulerURL, jobName string) {
+	target := schedulerURL + "/jobs"
+	if jobName != "" {
+		target += "/" + url.PathEscape(jobName)
+	}
+	h.proxyToScheduler(w, r.Method, target, r.Body)
+}
+
+// proxyToScheduler sends a request to a scheduler and forwards its response.
+func (h *Handlers) proxyToScheduler(w http.ResponseWriter, method, target string, body io.Reader) {
+	client := createHTTPClient(10*time.Second, h.authToken)
+
+	req, err := http.NewRequest(method, target, body)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "request_error", "Failed to create request: "+err.Error())
 		return
 	}
+	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -813,7 +1521,7 @@ func (h *Handlers) HandleShutdown(w http.ResponseWriter, r *http.Request) {
 	agents := h.discovery.Agents()
 	helpers := h.discovery.Helpers()
 
-	client := createHTTPClient(5 * time.Second)
+	client := createHTTPClient(5*time.Second, h.authToken)
 	var shutdownErrors []string
 
 	// Send shutdown to agents
@@ -863,3 +1571,33 @@ func (h *Handlers) HandleShutdown(w http.ResponseWriter, r *http.Request) {
 		h.shutdownFunc()
 	}()
 }
+
+// HandleRestartComponents starts a rolling restart of all agents.
+func (h *Handlers) HandleRestartComponents(w http.ResponseWriter, r *http.Request) {
+	if h.restarter == nil || !h.restarter.Configured() {
+		writeError(w, http.StatusServiceUnavailable, "restart_unavailable", "No restart command configured")
+		return
+	}
+
+	status, err := h.restarter.Start()
+	if err != nil {
+		writeError(w, http.StatusConflict, "restart_error", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+// HandleRestartStatus reports the progress of the current or last rolling restart.
+func (h *Handlers) HandleRestartStatus(w http.ResponseWriter, r *http.Request) {
+	if h.restarter == nil || !h.restarter.Configured() {
+		writeError(w, http.StatusServiceUnavailable, "restart_unavailable", "No restart command configured")
+		return
+	}
+
+	status := h.restarter.Status()
+	if status == nil {
+		writeError(w, http.StatusNotFound, api.ErrorNotFound, "No rolling restart has been run")
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
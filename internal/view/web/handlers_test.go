@@ -2,14 +2,18 @@ package web
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/api"
 )
 
 // newTestHandlers creates a Handlers instance for testing with a temporary auth store
@@ -46,6 +50,41 @@ func TestHandleStatus(t *testing.T) {
 	require.Equal(t, "test-version", resp["version"])
 	require.Equal(t, "running", resp["state"])
 	require.NotNil(t, resp["uptime_seconds"])
+	require.EqualValues(t, api.APIVersion, resp["api_version"])
+	require.Contains(t, resp["capabilities"], api.CapabilitySSE)
+	require.Contains(t, resp["capabilities"], api.CapabilityScheduledDispatch)
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	authStore, err := NewAuthStore(filepath.Join(tmpDir, "auth.json"), "password")
+	require.NoError(t, err)
+	tlsCfg := TLSConfig{CertFile: filepath.Join(tmpDir, "cert.pem"), KeyFile: filepath.Join(tmpDir, "key.pem"), AutoGenerate: true}
+	d, err := New(&Config{AuthStore: authStore, QueueDir: filepath.Join(tmpDir, "queue"), TLS: tlsCfg}, "test")
+	require.NoError(t, err)
+
+	// Both routers answer probes without a session
+	for _, router := range []http.Handler{d.Router(), d.InternalRouter()} {
+		get := func(path string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+			return rec
+		}
+		require.Equal(t, http.StatusOK, get("/healthz").Code)
+
+		// Not ready until the certificate exists
+		rec := get("/readyz")
+		require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		require.Contains(t, rec.Body.String(), `"auth_store":"ok"`)
+	}
+
+	require.NoError(t, EnsureTLSCert(tlsCfg))
+	rec := httptest.NewRecorder()
+	d.Router().ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"status":"ready"`)
 }
 
 func TestHandleAgents(t *testing.T) {
@@ -330,6 +369,513 @@ func TestHandleTaskStatusForwarding(t *testing.T) {
 	require.Equal(t, "completed", resp["state"])
 }
 
+func TestHandleTaskArtifactForwarding(t *testing.T) {
+	t.Parallel()
+
+	var gotPath string
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Header().Set("Content-Type", "text/markdown")
+		w.Header().Set("Content-Disposition", `attachment; filename="report.md"`)
+		w.Write([]byte("report"))
+	}))
+	defer agent.Close()
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	d.components[agent.URL] = &ComponentStatus{
+		URL:   agent.URL,
+		Type:  "agent",
+		State: "idle",
+	}
+	d.mu.Unlock()
+	h := newTestHandlers(t, d, "test")
+
+	req := httptest.NewRequest("GET", "/api/history/task-123/artifacts/out/report.md?agent_url="+agent.URL, nil)
+	rec := httptest.NewRecorder()
+
+	h.HandleTaskArtifact(rec, req, "task-123", "out/report.md")
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "/history/task-123/artifacts/out/report.md", gotPath)
+	require.Equal(t, "report", rec.Body.String())
+	require.Equal(t, "text/markdown", rec.Header().Get("Content-Type"))
+	require.Contains(t, rec.Header().Get("Content-Disposition"), "report.md")
+}
+
+func TestHandleAgentLogStreamForwarding(t *testing.T) {
+	t.Parallel()
+
+	var gotQuery string
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.RawQuery
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"message\":\"task started\"}\n\n"))
+	}))
+	defer agent.Close()
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	d.components[agent.URL] = &ComponentStatus{
+		URL:          agent.URL,
+		Type:         "agent",
+		State:        "working",
+		APIVersion:   api.APIVersion,
+		Capabilities: []string{api.CapabilitySSE},
+	}
+	d.mu.Unlock()
+	h := newTestHandlers(t, d, "test")
+
+	req := httptest.NewRequest("GET", "/api/logs/stream?agent_url="+agent.URL+"&task_id=task-123&level=warn", nil)
+	rec := httptest.NewRecorder()
+	h.HandleAgentLogStream(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "level=warn&task_id=task-123", gotQuery)
+	require.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+	require.Equal(t, "data: {\"message\":\"task started\"}\n\n", rec.Body.String())
+
+	// A task is required
+	req = httptest.NewRequest("GET", "/api/logs/stream?agent_url="+agent.URL, nil)
+	rec = httptest.NewRecorder()
+	h.HandleAgentLogStream(rec, req)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Agents that don't advertise streaming are left to be polled
+	d.mu.Lock()
+	d.components[agent.URL].Capabilities = nil
+	d.mu.Unlock()
+	gotQuery = ""
+	req = httptest.NewRequest("GET", "/api/logs/stream?agent_url="+agent.URL+"&task_id=task-123", nil)
+	rec = httptest.NewRecorder()
+	h.HandleAgentLogStream(rec, req)
+	require.Equal(t, http.StatusNotImplemented, rec.Code)
+	require.Contains(t, rec.Body.String(), api.ErrorNotSupported)
+	require.Empty(t, gotQuery)
+}
+
+func TestHandleAgentConfigForwarding(t *testing.T) {
+	t.Parallel()
+
+	var gotMethod, gotBody string
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/config", r.URL.Path)
+		body, _ := io.ReadAll(r.Body)
+		gotMethod, gotBody = r.Method, string(body)
+		w.Write([]byte(`{"agent_kind":"claude","tiers":{"fast":"sonnet"},"model":"sonnet","timeout_seconds":600}`))
+	}))
+	defer agent.Close()
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	d.components[agent.URL] = &ComponentStatus{
+		URL:        agent.URL,
+		Type:       "agent",
+		State:      "idle",
+		Interfaces: []string{api.InterfaceStatusable, api.InterfaceTaskable, api.InterfaceConfigurable},
+	}
+	d.mu.Unlock()
+	h := newTestHandlers(t, d, "test")
+
+	// The agent URL is path-escaped into the route
+	r := chi.NewRouter()
+	r.Put("/api/agents/{url}/config", func(w http.ResponseWriter, r *http.Request) {
+		h.HandleAgentConfig(w, r, chi.URLParam(r, "url"))
+	})
+	path := "/api/agents/" + url.PathEscape(agent.URL) + "/config"
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, path, strings.NewReader(`{"tiers":{"fast":"sonnet"}}`)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, http.MethodPut, gotMethod)
+	require.Equal(t, `{"tiers":{"fast":"sonnet"}}`, gotBody)
+	require.Contains(t, rec.Body.String(), `"timeout_seconds":600`)
+
+	// Agents from before the config API are left to their config files
+	d.mu.Lock()
+	d.components[agent.URL].Interfaces = []string{api.InterfaceStatusable, api.InterfaceTaskable}
+	d.mu.Unlock()
+	gotMethod = ""
+	rec = httptest.NewRecorder()
+	h.HandleAgentConfig(rec, httptest.NewRequest(http.MethodGet, path, nil), url.PathEscape(agent.URL))
+	require.Equal(t, http.StatusNotImplemented, rec.Code)
+	require.Empty(t, gotMethod)
+
+	rec = httptest.NewRecorder()
+	h.HandleAgentConfig(rec, httptest.NewRequest(http.MethodGet, "/", nil), url.PathEscape("https://localhost:1"))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandleAgentPromptsForwarding(t *testing.T) {
+	t.Parallel()
+
+	var gotMethod, gotPath, gotBody string
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotMethod, gotPath, gotBody = r.Method, r.URL.Path, string(body)
+		w.Write([]byte(`{"name":"claude-prod.md","content":"# v2","backup":".backups/claude-prod.md.1"}`))
+	}))
+	defer agent.Close()
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	d.components[agent.URL] = &ComponentStatus{
+		URL:          agent.URL,
+		Type:         "agent",
+		State:        "idle",
+		APIVersion:   api.APIVersion,
+		Capabilities: []string{api.CapabilityPrompts},
+	}
+	d.mu.Unlock()
+	h := newTestHandlers(t, d, "test")
+
+	r := chi.NewRouter()
+	r.Get("/api/agents/{url}/prompts", func(w http.ResponseWriter, r *http.Request) {
+		h.HandleAgentPrompts(w, r, chi.URLParam(r, "url"), "")
+	})
+	r.Put("/api/agents/{url}/prompts/{name}", func(w http.ResponseWriter, r *http.Request) {
+		h.HandleAgentPrompts(w, r, chi.URLParam(r, "url"), chi.URLParam(r, "name"))
+	})
+	base := "/api/agents/" + url.PathEscape(agent.URL) + "/prompts"
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, base, nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, "/prompts", gotPath)
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, base+"/claude-prod.md", strings.NewReader(`{"content":"# v2"}`)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, http.MethodPut, gotMethod)
+	require.Equal(t, "/prompts/claude-prod.md", gotPath)
+	require.Equal(t, `{"content":"# v2"}`, gotBody)
+	require.Contains(t, rec.Body.String(), `"backup"`)
+
+	// Agents without the prompts API are left to their prompt files
+	d.mu.Lock()
+	d.components[agent.URL].Capabilities = nil
+	d.mu.Unlock()
+	gotPath = ""
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, base, nil))
+	require.Equal(t, http.StatusNotImplemented, rec.Code)
+	require.Empty(t, gotPath)
+}
+
+func TestHandleRerunTask(t *testing.T) {
+	t.Parallel()
+
+	var gotPath, gotBody string
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotPath, gotBody = r.URL.Path, string(body)
+		if strings.Contains(r.URL.Path, "task-missing") {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"not_found","message":"task not found"}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"task_id":"task-2","session_id":"sess-1","rerun_of":"task-1","prompt":"fix the build"}`))
+	}))
+	defer agent.Close()
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	d.components[agent.URL] = &ComponentStatus{
+		URL:          agent.URL,
+		Type:         "agent",
+		State:        "idle",
+		APIVersion:   api.APIVersion,
+		Capabilities: []string{api.CapabilityRerun},
+	}
+	d.mu.Unlock()
+	h := newTestHandlers(t, d, "test")
+	rerun := func(taskID, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/task/"+taskID+"/rerun?agent_url="+url.QueryEscape(agent.URL), strings.NewReader(body))
+		h.HandleRerunTask(rec, req, taskID)
+		return rec
+	}
+
+	rec := rerun("task-1", `{"same_session":true}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	require.Equal(t, "/history/task-1/rerun", gotPath)
+	require.Equal(t, `{"same_session":true}`, gotBody)
+	var resp TaskSubmitResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, TaskSubmitResponse{TaskID: "task-2", AgentURL: agent.URL, SessionID: "sess-1"}, resp)
+
+	// The new task is tracked in its session
+	session, ok := h.sessionStore.Get("sess-1")
+	require.True(t, ok)
+	require.Len(t, session.Tasks, 1)
+	require.Equal(t, "task-2", session.Tasks[0].TaskID)
+	require.Equal(t, "fix the build", session.Tasks[0].Prompt)
+
+	// Agent errors are passed through
+	require.Equal(t, http.StatusNotFound, rerun("task-missing", "").Code)
+
+	// Agents without the re-run API aren't asked
+	d.mu.Lock()
+	d.components[agent.URL].Capabilities = nil
+	d.mu.Unlock()
+	gotPath = ""
+	require.Equal(t, http.StatusNotImplemented, rerun("task-1", "").Code)
+	require.Empty(t, gotPath)
+}
+
+func TestHandleAnnotateTask(t *testing.T) {
+	t.Parallel()
+
+	var gotMethod, gotPath, gotBody string
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotMethod, gotPath, gotBody = r.Method, r.URL.Path, string(body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"task_id":"task-1","annotation":{"rating":"good"}}`))
+	}))
+	defer agent.Close()
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	d.components[agent.URL] = &ComponentStatus{
+		URL:          agent.URL,
+		Type:         "agent",
+		State:        "idle",
+		APIVersion:   api.APIVersion,
+		Capabilities: []string{api.CapabilityAnnotations},
+	}
+	d.mu.Unlock()
+	h := newTestHandlers(t, d, "test")
+	annotate := func(agentURL string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPatch, "/api/history/task-1?agent_url="+url.QueryEscape(agentURL), strings.NewReader(`{"rating":"good"}`))
+		h.HandleAnnotateTask(rec, req, "task-1")
+		return rec
+	}
+
+	rec := annotate(agent.URL)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, http.MethodPatch, gotMethod)
+	require.Equal(t, "/history/task-1", gotPath)
+	require.Equal(t, `{"rating":"good"}`, gotBody)
+	require.Contains(t, rec.Body.String(), `"rating":"good"`)
+
+	require.Equal(t, http.StatusBadRequest, annotate("").Code)
+
+	// Agents without annotations aren't asked
+	d.mu.Lock()
+	d.components[agent.URL].Capabilities = nil
+	d.mu.Unlock()
+	gotPath = ""
+	require.Equal(t, http.StatusNotImplemented, annotate(agent.URL).Code)
+	require.Empty(t, gotPath)
+}
+
+func TestHandleHistoryDiffForwarding(t *testing.T) {
+	t.Parallel()
+
+	var gotQuery string
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/history/diff", r.URL.Path)
+		gotQuery = r.URL.RawQuery
+		w.Write([]byte(`{"output":{"lines":[],"additions":0,"deletions":0}}`))
+	}))
+	defer agent.Close()
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	d.components[agent.URL] = &ComponentStatus{
+		URL:   agent.URL,
+		Type:  "agent",
+		State: "idle",
+	}
+	d.mu.Unlock()
+	h := newTestHandlers(t, d, "test")
+
+	req := httptest.NewRequest("GET", "/api/history/diff?a=task-1&b=task-2&agent_url="+agent.URL, nil)
+	rec := httptest.NewRecorder()
+	h.HandleHistoryDiff(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "a=task-1&b=task-2", gotQuery)
+	require.Contains(t, rec.Body.String(), `"additions":0`)
+
+	req = httptest.NewRequest("GET", "/api/history/diff?a=task-1&agent_url="+agent.URL, nil)
+	rec = httptest.NewRecorder()
+	h.HandleHistoryDiff(rec, req)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandleSessionHistoryForwarding(t *testing.T) {
+	t.Parallel()
+
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/history/sessions/sess-1", r.URL.Path)
+		w.Write([]byte(`{"session_id":"sess-1","task_count":2,"tasks":[]}`))
+	}))
+	defer agent.Close()
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	d.components[agent.URL] = &ComponentStatus{
+		URL:   agent.URL,
+		Type:  "agent",
+		State: "idle",
+	}
+	d.mu.Unlock()
+	h := newTestHandlers(t, d, "test")
+
+	req := httptest.NewRequest("GET", "/api/history/sessions/sess-1?agent_url="+agent.URL, nil)
+	rec := httptest.NewRecorder()
+	h.HandleSessionHistory(rec, req, "sess-1")
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"task_count":2`)
+
+	req = httptest.NewRequest("GET", "/api/history/sessions/sess-1", nil)
+	rec = httptest.NewRecorder()
+	h.HandleSessionHistory(rec, req, "sess-1")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandleHistoryRendersOutputHTML(t *testing.T) {
+	t.Parallel()
+
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/history/sessions/sess-1":
+			w.Write([]byte(`{"session_id":"sess-1","tasks":[{"task_id":"task-1","output":"**done** <b>"}]}`))
+		case "/task/task-2":
+			w.Write([]byte(`{"task_id":"task-2","state":"working","output":"\u001b[31mred\u001b[0m"}`))
+		default:
+			w.Write([]byte(`{"task_id":"task-1","output":"# Title"}`))
+		}
+	}))
+	defer agent.Close()
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	d.components[agent.URL] = &ComponentStatus{URL: agent.URL, Type: "agent", State: "idle"}
+	d.mu.Unlock()
+	h := newTestHandlers(t, d, "test")
+
+	get := func(path string, handle func(w http.ResponseWriter, r *http.Request)) map[string]any {
+		rec := httptest.NewRecorder()
+		handle(rec, httptest.NewRequest("GET", path, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return body
+	}
+
+	entry := get("/api/history/task-1?format=html&agent_url="+agent.URL, func(w http.ResponseWriter, r *http.Request) {
+		h.HandleTaskHistory(w, r, "task-1")
+	})
+	require.Equal(t, "# Title", entry["output"])
+	require.Equal(t, "<h1>Title</h1>\n", entry["output_html"])
+
+	plain := get("/api/history/task-1?agent_url="+agent.URL, func(w http.ResponseWriter, r *http.Request) {
+		h.HandleTaskHistory(w, r, "task-1")
+	})
+	require.NotContains(t, plain, "output_html")
+
+	session := get("/api/history/sessions/sess-1?format=html&agent_url="+agent.URL, func(w http.ResponseWriter, r *http.Request) {
+		h.HandleSessionHistory(w, r, "sess-1")
+	})
+	task := session["tasks"].([]any)[0].(map[string]any)
+	require.Equal(t, "<p><strong>done</strong> &lt;b&gt;</p>\n", task["output_html"])
+
+	status := get("/api/task/task-2?format=html&agent_url="+agent.URL, func(w http.ResponseWriter, r *http.Request) {
+		h.HandleTaskStatus(w, r, "task-2")
+	})
+	require.Equal(t, "<p>red</p>\n", status["output_html"])
+}
+
+func TestHandleAgentSessionsForwarding(t *testing.T) {
+	t.Parallel()
+
+	var gotMethod, gotPath, gotAuth string
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath, gotAuth = r.Method, r.URL.Path, r.Header.Get("Authorization")
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"error":"task_in_progress"}`))
+			return
+		}
+		w.Write([]byte(`{"sessions":[{"session_id":"sess-1","task_count":3}]}`))
+	}))
+	defer agent.Close()
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	d.components[agent.URL] = &ComponentStatus{URL: agent.URL, Type: "agent", State: "idle"}
+	d.mu.Unlock()
+	h := newTestHandlers(t, d, "test")
+	h.authToken = "agent-token"
+
+	req := httptest.NewRequest("GET", "/api/agent-sessions?agent_url="+agent.URL, nil)
+	rec := httptest.NewRecorder()
+	h.HandleAgentSessions(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "/sessions", gotPath)
+	require.Contains(t, rec.Body.String(), `"task_count":3`)
+
+	req = httptest.NewRequest("DELETE", "/api/agent-sessions/sess-1?agent_url="+agent.URL, nil)
+	rec = httptest.NewRecorder()
+	h.HandleDeleteAgentSession(rec, req, "sess-1")
+	require.Equal(t, http.StatusConflict, rec.Code, "the agent's status is passed through")
+	require.Equal(t, http.MethodDelete, gotMethod)
+	require.Equal(t, "/sessions/sess-1", gotPath)
+	require.Equal(t, "Bearer agent-token", gotAuth)
+
+	req = httptest.NewRequest("DELETE", "/api/agent-sessions/sess-1?agent_url=https://unknown:9000", nil)
+	rec = httptest.NewRecorder()
+	h.HandleDeleteAgentSession(rec, req, "sess-1")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandleSchedulerJobForwarding(t *testing.T) {
+	t.Parallel()
+
+	var gotMethod, gotPath, gotBody, gotAuth string
+	scheduler := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotMethod, gotPath, gotBody = r.Method, r.URL.Path, string(body)
+		gotAuth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"name":"weekly","managed":true}`))
+	}))
+	defer scheduler.Close()
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	h := newTestHandlers(t, d, "test")
+	h.SetAuthToken("scheduler-token")
+
+	req := httptest.NewRequest("POST", "/api/scheduler/jobs", strings.NewReader(`{"name":"weekly"}`))
+	req.Header.Set("Authorization", "Bearer web-password") // Not forwarded
+	rec := httptest.NewRecorder()
+	h.HandleSchedulerJob(rec, req, scheduler.URL, "")
+
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Equal(t, "POST", gotMethod)
+	require.Equal(t, "/jobs", gotPath)
+	require.Equal(t, `{"name":"weekly"}`, gotBody)
+	require.Equal(t, "Bearer scheduler-token", gotAuth)
+	require.Contains(t, rec.Body.String(), `"managed":true`)
+
+	req = httptest.NewRequest("DELETE", "/api/scheduler/jobs/weekly", nil)
+	rec = httptest.NewRecorder()
+	h.HandleSchedulerJob(rec, req, scheduler.URL, "weekly")
+	require.Equal(t, "DELETE", gotMethod)
+	require.Equal(t, "/jobs/weekly", gotPath)
+
+	rec = httptest.NewRecorder()
+	h.HandleResumeJob(rec, httptest.NewRequest("POST", "/api/scheduler/jobs/weekly/resume", nil), scheduler.URL, "weekly")
+	require.Equal(t, "POST", gotMethod)
+	require.Equal(t, "/jobs/weekly/resume", gotPath)
+	require.Equal(t, "Bearer scheduler-token", gotAuth)
+}
+
 func TestHandleDashboard(t *testing.T) {
 	t.Parallel()
 
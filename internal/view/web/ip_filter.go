@@ -0,0 +1,118 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"phobos.org.uk/agency/internal/api"
+)
+
+// IPFilter restricts which client addresses may reach the web view.
+// Deny rules win over allow rules. With no allow rules every address not
+// denied is allowed; otherwise only addresses matching an allow rule (and
+// loopback, which discovery and local tools use) get through.
+type IPFilter struct {
+	Allow []netip.Prefix
+	Deny  []netip.Prefix
+}
+
+// ParseIPFilter builds a filter from comma-separated CIDR lists, e.g.
+// "10.8.0.0/24,192.168.1.5". Bare addresses match only themselves. Returns
+// nil if both lists are empty.
+func ParseIPFilter(allow, deny string) (*IPFilter, error) {
+	allowList, err := parsePrefixes(allow)
+	if err != nil {
+		return nil, fmt.Errorf("allow list: %w", err)
+	}
+	denyList, err := parsePrefixes(deny)
+	if err != nil {
+		return nil, fmt.Errorf("deny list: %w", err)
+	}
+	if len(allowList) == 0 && len(denyList) == 0 {
+		return nil, nil
+	}
+	return &IPFilter{Allow: allowList, Deny: denyList}, nil
+}
+
+// parsePrefixes parses a comma-separated list of CIDRs or addresses.
+func parsePrefixes(spec string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, "/") {
+			addr, err := netip.ParseAddr(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q", part)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", part)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Check reports whether addr may connect, and the rule that decided it
+// ("deny 10.0.0.0/8", "allow 10.8.0.0/24", "loopback", "not allowed" or
+// "no allow rules"). Loopback is only let past the allow list when
+// allowLoopback is set.
+func (f *IPFilter) Check(addr netip.Addr, allowLoopback bool) (bool, string) {
+	addr = addr.Unmap().WithZone("")
+	for _, p := range f.Deny {
+		if p.Contains(addr) {
+			return false, "deny " + p.String()
+		}
+	}
+	if len(f.Allow) == 0 {
+		return true, "no allow rules"
+	}
+	for _, p := range f.Allow {
+		if p.Contains(addr) {
+			return true, "allow " + p.String()
+		}
+	}
+	if allowLoopback && addr.IsLoopback() {
+		return true, "loopback"
+	}
+	return false, "not allowed"
+}
+
+// IPFilterMiddleware rejects requests from blocked addresses with 403 before
+// any authentication, recording them in the access log. It checks the
+// address resolved by ClientIPMiddleware, which must run first. A request
+// relayed by an untrusted local proxy is not treated as loopback, since its
+// real origin is unknown. A nil filter allows everything.
+func IPFilterMiddleware(filter *IPFilter, accessLogger *AccessLogger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if filter == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := clientFromRequest(r)
+			if !client.addr.IsValid() {
+				writeError(w, http.StatusForbidden, api.ErrorForbidden, "Unrecognised client address")
+				return
+			}
+			allowed, rule := filter.Check(client.addr, client.trustedProxy || !client.forwarded)
+			if !allowed {
+				if accessLogger != nil {
+					accessLogger.LogBlocked(client.addr.String(), r.Method, r.URL.Path, rule)
+				}
+				writeError(w, http.StatusForbidden, api.ErrorForbidden,
+					fmt.Sprintf("Access from %s is not permitted (%s)", client.addr, rule))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
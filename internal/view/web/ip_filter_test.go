@@ -0,0 +1,136 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIPFilter(t *testing.T) {
+	t.Parallel()
+
+	f, err := ParseIPFilter("", " ")
+	require.NoError(t, err)
+	require.Nil(t, f)
+
+	f, err = ParseIPFilter("10.8.0.0/24, 192.168.1.5", "10.8.0.66,2001:db8::/32")
+	require.NoError(t, err)
+	require.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.8.0.0/24"),
+		netip.MustParsePrefix("192.168.1.5/32"),
+	}, f.Allow)
+	require.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.8.0.66/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}, f.Deny)
+
+	// Host bits are masked off
+	f, err = ParseIPFilter("10.8.0.9/24", "")
+	require.NoError(t, err)
+	require.Equal(t, "10.8.0.0/24", f.Allow[0].String())
+
+	_, err = ParseIPFilter("10.8.0.0/33", "")
+	require.ErrorContains(t, err, "allow list")
+	_, err = ParseIPFilter("", "vpn")
+	require.ErrorContains(t, err, "deny list")
+}
+
+func TestIPFilterCheck(t *testing.T) {
+	t.Parallel()
+
+	f, err := ParseIPFilter("10.8.0.0/24", "10.8.0.66")
+	require.NoError(t, err)
+
+	tests := []struct {
+		addr    string
+		allowed bool
+		rule    string
+	}{
+		{"10.8.0.5", true, "allow 10.8.0.0/24"},
+		{"10.8.0.66", false, "deny 10.8.0.66/32"},
+		{"::ffff:10.8.0.5", true, "allow 10.8.0.0/24"},
+		{"203.0.113.7", false, "not allowed"},
+		{"127.0.0.1", true, "loopback"},
+		{"::1", true, "loopback"},
+	}
+	for _, tt := range tests {
+		allowed, rule := f.Check(netip.MustParseAddr(tt.addr), true)
+		require.Equal(t, tt.allowed, allowed, tt.addr)
+		require.Equal(t, tt.rule, rule, tt.addr)
+	}
+	allowed, rule := f.Check(netip.MustParseAddr("127.0.0.1"), false)
+	require.False(t, allowed)
+	require.Equal(t, "not allowed", rule)
+
+	denyOnly, err := ParseIPFilter("", "203.0.113.0/24")
+	require.NoError(t, err)
+	allowed, _ = denyOnly.Check(netip.MustParseAddr("198.51.100.1"), true)
+	require.True(t, allowed)
+	allowed, _ = denyOnly.Check(netip.MustParseAddr("203.0.113.9"), true)
+	require.False(t, allowed)
+}
+
+func TestIPFilterMiddleware(t *testing.T) {
+	t.Parallel()
+
+	logPath := filepath.Join(t.TempDir(), "access.log")
+	logger, err := NewAccessLogger(logPath)
+	require.NoError(t, err)
+	defer logger.Close()
+
+	f, err := ParseIPFilter("10.8.0.0/24", "")
+	require.NoError(t, err)
+	handler := IPFilterMiddleware(f, logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/login", nil)
+	req.RemoteAddr = "10.8.0.5:51234"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// Forwarding headers do not get around the filter
+	req = httptest.NewRequest("POST", "/login", nil)
+	req.RemoteAddr = "203.0.113.7:51234"
+	req.Header.Set("X-Real-IP", "10.8.0.5")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Contains(t, rec.Body.String(), `"error":"forbidden"`)
+	require.Contains(t, rec.Body.String(), "203.0.113.7")
+
+	data, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `203.0.113.7 POST /login 403 ip_blocked "not allowed"`)
+	require.NotContains(t, string(data), "10.8.0.5")
+
+	// A local proxy that isn't trusted doesn't get the loopback exemption
+	req = httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "127.0.0.1:51234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	// A trusted one has the forwarded client checked instead
+	trusted := ClientIPMiddleware([]netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")})(handler)
+	rec = httptest.NewRecorder()
+	trusted.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Contains(t, rec.Body.String(), "203.0.113.7")
+	req.Header.Set("X-Forwarded-For", "10.8.0.9")
+	rec = httptest.NewRecorder()
+	trusted.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// A nil filter lets everything through
+	rec = httptest.NewRecorder()
+	IPFilterMiddleware(nil, nil)(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
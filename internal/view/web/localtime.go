@@ -0,0 +1,159 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // Viewer timezones on hosts without a zoneinfo database
+)
+
+// localeFormat is how times are shown in a locale.
+type localeFormat struct {
+	layout  string    // time.Format layout of full timestamps
+	justNow string    // Ages under a minute
+	ago     string    // Past ages, e.g. "%s ago"
+	in      string    // Future ages, e.g. "in %s"
+	units   [4]string // Suffixes for seconds, minutes, hours and days
+}
+
+// localeFormats are the supported locales. The empty locale is the default.
+var localeFormats = map[string]localeFormat{
+	"":      {"2006-01-02 15:04", "just now", "%s ago", "in %s", [4]string{"s", "m", "h", "d"}},
+	"en-US": {"Jan 2, 2006 3:04 PM", "just now", "%s ago", "in %s", [4]string{"s", "m", "h", "d"}},
+	"en-GB": {"2 Jan 2006 15:04", "just now", "%s ago", "in %s", [4]string{"s", "m", "h", "d"}},
+	"de-DE": {"02.01.2006 15:04", "gerade eben", "vor %s", "in %s", [4]string{" Sek.", " Min.", " Std.", " T."}},
+	"fr-FR": {"02/01/2006 15:04", "à l'instant", "il y a %s", "dans %s", [4]string{" s", " min", " h", " j"}},
+	"es-ES": {"02/01/2006 15:04", "ahora mismo", "hace %s", "en %s", [4]string{" s", " min", " h", " d"}},
+	"ja-JP": {"2006/01/02 15:04", "たった今", "%s前", "%s後", [4]string{"秒", "分", "時間", "日"}},
+}
+
+// LocalTime is a timestamp formatted for the viewer.
+type LocalTime struct {
+	Local    string `json:"local"`    // In the viewer's timezone and locale
+	Relative string `json:"relative"` // Age, e.g. 5m ago or in 2h
+}
+
+// timeFormatter formats timestamps for one viewer.
+type timeFormatter struct {
+	loc    *time.Location
+	locale localeFormat
+	now    time.Time
+}
+
+// locations caches loaded timezones by name.
+var locations sync.Map
+
+// loadLocation returns the named timezone.
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// newTimeFormatter returns a formatter for prefs. Unknown timezones fall
+// back to UTC and unknown locales to the default.
+func newTimeFormatter(prefs Preferences, now time.Time) *timeFormatter {
+	loc, err := loadLocation(prefs.Timezone)
+	if err != nil || prefs.Timezone == "" {
+		loc = time.UTC
+	}
+	format, ok := localeFormats[prefs.Locale]
+	if !ok {
+		format = localeFormats[""]
+	}
+	return &timeFormatter{loc: loc, locale: format, now: now}
+}
+
+// format returns t for the viewer, or nil for the zero time.
+func (f *timeFormatter) format(t time.Time) *LocalTime {
+	if t.IsZero() {
+		return nil
+	}
+	return &LocalTime{
+		Local:    t.In(f.loc).Format(f.locale.layout),
+		Relative: f.relative(t),
+	}
+}
+
+// formatPtr is format for optional times.
+func (f *timeFormatter) formatPtr(t *time.Time) *LocalTime {
+	if t == nil {
+		return nil
+	}
+	return f.format(*t)
+}
+
+// relative returns the age of t in its largest whole unit. Past ages under
+// a minute are "just now", so the text changes at most once a minute.
+func (f *timeFormatter) relative(t time.Time) string {
+	d := f.now.Sub(t)
+	pattern := f.locale.ago
+	if d < 0 {
+		d = -d
+		pattern = f.locale.in
+	} else if d < time.Minute {
+		return f.locale.justNow
+	}
+
+	var amount string
+	switch {
+	case d < time.Minute:
+		amount = fmt.Sprintf("%d%s", int(d.Seconds()), f.locale.units[0])
+	case d < time.Hour:
+		amount = fmt.Sprintf("%d%s", int(d.Minutes()), f.locale.units[1])
+	case d < 24*time.Hour:
+		amount = fmt.Sprintf("%d%s", int(d.Hours()), f.locale.units[2])
+	default:
+		amount = fmt.Sprintf("%d%s", int(d.Hours()/24), f.locale.units[3])
+	}
+	return fmt.Sprintf(pattern, amount)
+}
+
+// viewerPreferences returns the preferences of the request's auth session.
+// Without a stored locale, the first supported Accept-Language is used.
+func (h *Handlers) viewerPreferences(r *http.Request) Preferences {
+	var prefs Preferences
+	if session := GetSessionFromContext(r.Context()); session != nil && h.authStore != nil {
+		prefs = h.authStore.Preferences(session.ID)
+	}
+	if prefs.Locale == "" {
+		prefs.Locale = acceptedLocale(r.Header.Get("Accept-Language"))
+	}
+	return prefs
+}
+
+// viewerTimes returns a formatter for the request's viewer.
+func (h *Handlers) viewerTimes(r *http.Request) *timeFormatter {
+	return newTimeFormatter(h.viewerPreferences(r), time.Now())
+}
+
+// acceptedLocale returns the first supported locale in an Accept-Language
+// header, matching a bare language such as "de" to its supported locale.
+func acceptedLocale(header string) string {
+	for _, part := range strings.Split(header, ",") {
+		tag, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+		for locale := range localeFormats {
+			if locale != "" && strings.EqualFold(locale, tag) {
+				return locale
+			}
+		}
+		lang, _, _ := strings.Cut(tag, "-")
+		for _, locale := range supportedLocales() {
+			if strings.EqualFold(strings.SplitN(locale, "-", 2)[0], lang) {
+				return locale
+			}
+		}
+	}
+	return ""
+}
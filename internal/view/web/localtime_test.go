@@ -0,0 +1,48 @@
+package web
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeFormatter(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	f := newTimeFormatter(Preferences{Timezone: "America/New_York", Locale: "en-US"}, now)
+
+	got := f.format(now.Add(-90 * time.Minute))
+	require.Equal(t, &LocalTime{Local: "Mar 14, 2026 6:30 AM", Relative: "1h ago"}, got)
+	require.Equal(t, "just now", f.relative(now.Add(-30*time.Second)))
+	require.Equal(t, "in 30s", f.relative(now.Add(30*time.Second)))
+	require.Equal(t, "3d ago", f.relative(now.Add(-80*time.Hour)))
+	require.Nil(t, f.format(time.Time{}))
+	require.Nil(t, f.formatPtr(nil))
+
+	de := newTimeFormatter(Preferences{Timezone: "Europe/Berlin", Locale: "de-DE"}, now)
+	require.Equal(t, &LocalTime{Local: "14.03.2026 12:55", Relative: "vor 5 Min."}, de.format(now.Add(-5*time.Minute)))
+
+	// Unknown settings fall back to UTC and the ISO style
+	fallback := newTimeFormatter(Preferences{Timezone: "Mars/Olympus", Locale: "xx-XX"}, now)
+	require.Equal(t, "2026-03-14 12:00", fallback.format(now).Local)
+}
+
+func TestAcceptedLocale(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"en-GB,en;q=0.9", "en-GB"},
+		{"fr;q=0.9", "fr-FR"},
+		{"pt-BR, de-AT;q=0.8", "de-DE"},
+		{"pt-BR, *;q=0.1", ""},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, acceptedLocale(tt.header), tt.header)
+	}
+}
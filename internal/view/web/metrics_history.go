@@ -0,0 +1,193 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/report"
+)
+
+// Metrics history limits
+const (
+	DefaultMetricsInterval = time.Minute
+	metricsRetention       = 7 * 24 * time.Hour
+	defaultMetricsWindow   = 24 * time.Hour
+	defaultMetricsPoints   = 120
+	maxMetricsPoints       = 1000
+)
+
+// MetricsSample is the fleet at one moment. Agent and queue counts are
+// gauges; task counts are the tasks that left the queue since the previous
+// sample.
+type MetricsSample struct {
+	Time           time.Time `json:"time"`
+	AgentsTotal    int       `json:"agents_total"`
+	AgentsWorking  int       `json:"agents_working"` // Any state but idle
+	QueueDepth     int       `json:"queue_depth"`    // Pending tasks
+	TasksCompleted int       `json:"tasks_completed"`
+	TasksFailed    int       `json:"tasks_failed"` // Failed, cancelled or expired
+}
+
+// MetricsHistory samples agent states, queue depth and task throughput at
+// a fixed interval for the dashboard's sparklines. It learns that tasks
+// finished through TaskFinished, called for task.finished events.
+// Samples are kept in memory for a week.
+type MetricsHistory struct {
+	mu        sync.Mutex
+	interval  time.Duration
+	queue     *WorkQueue
+	discovery *Discovery
+	samples   []MetricsSample // Oldest first
+	completed int             // Since the last sample
+	failed    int
+	now       func() time.Time
+}
+
+// NewMetricsHistory creates a history sampled every interval (default
+// DefaultMetricsInterval).
+func NewMetricsHistory(interval time.Duration, queue *WorkQueue, discovery *Discovery) *MetricsHistory {
+	if interval <= 0 {
+		interval = DefaultMetricsInterval
+	}
+	return &MetricsHistory{
+		interval:  interval,
+		queue:     queue,
+		discovery: discovery,
+		now:       time.Now,
+	}
+}
+
+// Start samples until ctx is cancelled.
+func (m *MetricsHistory) Start(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.record()
+		}
+	}
+}
+
+// TaskFinished counts a task that left the queue.
+func (m *MetricsHistory) TaskFinished(task *QueuedTask, state string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if state == string(TaskStateCompleted) {
+		m.completed++
+	} else {
+		m.failed++
+	}
+}
+
+// record appends a sample of the fleet now and drops samples older than
+// the retention period.
+func (m *MetricsHistory) record() {
+	sample := MetricsSample{QueueDepth: m.queue.Depth()}
+	for _, agent := range m.discovery.Agents() {
+		sample.AgentsTotal++
+		if agent.State != "idle" {
+			sample.AgentsWorking++
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sample.Time = m.now()
+	sample.TasksCompleted, sample.TasksFailed = m.completed, m.failed
+	m.completed, m.failed = 0, 0
+	m.samples = append(m.samples, sample)
+
+	cutoff := sample.Time.Add(-metricsRetention)
+	drop := 0
+	for drop < len(m.samples) && m.samples[drop].Time.Before(cutoff) {
+		drop++
+	}
+	if drop > 0 {
+		m.samples = append(m.samples[:0], m.samples[drop:]...)
+	}
+}
+
+// History returns the samples of the last window, merged into at most
+// points buckets of equal length, ending now. A bucket holds the peak of each gauge and
+// the sum of the task counts, and is timed by its last sample. Buckets
+// without samples are left out.
+func (m *MetricsHistory) History(window time.Duration, points int) (step time.Duration, samples []MetricsSample) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	step = max(m.interval, window/time.Duration(points))
+	now := m.now()
+	samples = []MetricsSample{}
+	bucket := -1
+	for _, s := range m.samples {
+		age := now.Sub(s.Time)
+		if age >= window {
+			continue
+		}
+		b := int(age / step) // Counted back from now, so the newest bucket is whole
+		if b != bucket {
+			bucket = b
+			samples = append(samples, s)
+			continue
+		}
+		last := &samples[len(samples)-1]
+		last.Time = s.Time
+		last.AgentsTotal = max(last.AgentsTotal, s.AgentsTotal)
+		last.AgentsWorking = max(last.AgentsWorking, s.AgentsWorking)
+		last.QueueDepth = max(last.QueueDepth, s.QueueDepth)
+		last.TasksCompleted += s.TasksCompleted
+		last.TasksFailed += s.TasksFailed
+	}
+	return step, samples
+}
+
+// MetricsHistoryResponse is returned by GET /api/metrics/history.
+type MetricsHistoryResponse struct {
+	WindowSeconds   float64         `json:"window_seconds"`
+	IntervalSeconds float64         `json:"interval_seconds"` // Between samples
+	StepSeconds     float64         `json:"step_seconds"`     // Length of each returned bucket
+	Samples         []MetricsSample `json:"samples"`
+}
+
+// HandleHistory returns the metrics of the last ?window= (default 24h, at
+// most 7d) in at most ?points= buckets (default 120).
+func (m *MetricsHistory) HandleHistory(w http.ResponseWriter, r *http.Request) {
+	window := defaultMetricsWindow
+	if s := r.URL.Query().Get("window"); s != "" {
+		var err error
+		if window, err = report.ParseWindow(s); err != nil || window > metricsRetention {
+			writeError(w, http.StatusBadRequest, api.ErrorValidation,
+				"window must be a duration such as 24h or 7d, at most 7d")
+			return
+		}
+	}
+	points := defaultMetricsPoints
+	if s := r.URL.Query().Get("points"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxMetricsPoints {
+			writeError(w, http.StatusBadRequest, api.ErrorValidation,
+				fmt.Sprintf("points must be between 1 and %d", maxMetricsPoints))
+			return
+		}
+		points = n
+	}
+
+	step, samples := m.History(window, points)
+	writeJSON(w, http.StatusOK, MetricsHistoryResponse{
+		WindowSeconds:   window.Seconds(),
+		IntervalSeconds: m.interval.Seconds(),
+		StepSeconds:     step.Seconds(),
+		Samples:         samples,
+	})
+}
@@ -0,0 +1,103 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMetricsHistory(t *testing.T) (*MetricsHistory, *WorkQueue, *time.Time) {
+	t.Helper()
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	m := NewMetricsHistory(time.Minute, q, NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000}))
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+	return m, q, &now
+}
+
+func TestMetricsHistoryRecords(t *testing.T) {
+	t.Parallel()
+
+	m, q, now := newTestMetricsHistory(t)
+	_, _, err := q.Add(QueueSubmitRequest{Prompt: "one"})
+	require.NoError(t, err)
+	m.TaskFinished(nil, string(TaskStateCompleted))
+	m.TaskFinished(nil, string(TaskStateCompleted))
+	m.TaskFinished(nil, string(TaskStateCancelled))
+	m.record()
+	*now = now.Add(time.Minute)
+	m.record()
+
+	_, samples := m.History(time.Hour, 60)
+	require.Len(t, samples, 2)
+	require.Equal(t, 1, samples[0].QueueDepth)
+	require.Equal(t, 2, samples[0].TasksCompleted)
+	require.Equal(t, 1, samples[0].TasksFailed)
+	require.Zero(t, samples[1].TasksCompleted) // Counts reset with each sample
+
+	// Samples older than the retention period are dropped
+	*now = now.Add(metricsRetention)
+	m.record()
+	require.Len(t, m.samples, 2)
+}
+
+func TestMetricsHistoryBuckets(t *testing.T) {
+	t.Parallel()
+
+	m, _, now := newTestMetricsHistory(t)
+	for i := range 120 {
+		m.samples = append(m.samples, MetricsSample{Time: now.Add(time.Duration(i) * time.Minute), QueueDepth: i % 7, TasksCompleted: 1})
+	}
+	*now = now.Add(119 * time.Minute)
+
+	step, samples := m.History(2*time.Hour, 12)
+	require.Equal(t, 10*time.Minute, step)
+	require.LessOrEqual(t, len(samples), 12)
+	total := 0
+	for _, s := range samples {
+		total += s.TasksCompleted
+		require.LessOrEqual(t, s.QueueDepth, 6)
+	}
+	require.Equal(t, 120, total)
+	require.Equal(t, 6, samples[0].QueueDepth)
+
+	// Buckets are never shorter than the sampling interval
+	step, _ = m.History(time.Hour, 1000)
+	require.Equal(t, time.Minute, step)
+}
+
+func TestMetricsHistoryHandler(t *testing.T) {
+	t.Parallel()
+
+	m, _, _ := newTestMetricsHistory(t)
+	m.record()
+
+	tests := []struct {
+		query      string
+		wantStatus int
+	}{
+		{"", http.StatusOK},
+		{"?window=7d&points=24", http.StatusOK},
+		{"?window=8d", http.StatusBadRequest},
+		{"?window=soon", http.StatusBadRequest},
+		{"?points=0", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		m.HandleHistory(w, httptest.NewRequest("GET", "/api/metrics/history"+tt.query, nil))
+		require.Equal(t, tt.wantStatus, w.Code, tt.query)
+	}
+
+	w := httptest.NewRecorder()
+	m.HandleHistory(w, httptest.NewRequest("GET", "/api/metrics/history?window=1h", nil))
+	var resp MetricsHistoryResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, 3600.0, resp.WindowSeconds)
+	require.Equal(t, 60.0, resp.IntervalSeconds)
+	require.Len(t, resp.Samples, 1)
+}
@@ -0,0 +1,106 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"rsc.io/qr"
+)
+
+// Pairing QR code rendering
+const (
+	qrQuietZone    = 4  // Modules of blank border required around the code
+	qrCaptionSpace = 10 // Modules below the SVG code reserved for the caption
+	qrPNGScale     = 8  // Image pixels per module in PNG output
+)
+
+// pairingURL returns the link a scanned QR code opens: the pairing page of
+// the dashboard the request came in on, with the code filled in.
+func pairingURL(r *http.Request, code string) string {
+	scheme := "https"
+	forwardedHTTPS := clientFromRequest(r).trustedProxy && r.Header.Get("X-Forwarded-Proto") == "https"
+	if r.TLS == nil && !forwardedHTTPS {
+		scheme = "http"
+	}
+	u := url.URL{
+		Scheme:   scheme,
+		Host:     r.Host,
+		Path:     "/pair",
+		RawQuery: url.Values{"code": {code}}.Encode(),
+	}
+	return u.String()
+}
+
+// HandlePairingQR renders the current pairing code as a QR code linking to
+// the pairing page. format=svg (default) or format=png. The code's expiry is
+// returned in the X-Pairing-Expires-At and X-Pairing-Expires-In headers.
+func (h *Handlers) HandlePairingQR(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "svg"
+	}
+	if format != "svg" && format != "png" {
+		writeError(w, http.StatusBadRequest, "invalid_format", "format must be svg or png")
+		return
+	}
+
+	code, expiresAt, ok := h.authStore.CurrentPairingCode()
+	if !ok {
+		writeError(w, http.StatusNotFound, "no_pairing_code", "No active pairing code; generate one first")
+		return
+	}
+
+	qrCode, err := qr.Encode(pairingURL(r, code), qr.M)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "qr_error", "Failed to render QR code: "+err.Error())
+		return
+	}
+
+	// The image holds a live credential
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Pairing-Expires-At", expiresAt.UTC().Format(time.RFC3339))
+	w.Header().Set("X-Pairing-Expires-In", strconv.Itoa(int(time.Until(expiresAt).Seconds())))
+
+	if format == "png" {
+		qrCode.Scale = qrPNGScale
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(qrCode.PNG())
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Write(renderQRSVG(qrCode, code))
+}
+
+// renderQRSVG draws a QR code as SVG in module units, with caption (if any)
+// centred underneath.
+func renderQRSVG(code *qr.Code, caption string) []byte {
+	width := code.Size + 2*qrQuietZone
+	height := width
+	if caption != "" {
+		height += qrCaptionSpace
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, width, height)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/>`, width, height)
+	b.WriteString(`<path fill="#000" d="`)
+	for y := range code.Size {
+		for x := range code.Size {
+			if code.Black(x, y) {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x+qrQuietZone, y+qrQuietZone)
+			}
+		}
+	}
+	b.WriteString(`"/>`)
+	if caption != "" {
+		// Captions are base32 codes, so need no escaping
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-family="monospace" font-size="6" letter-spacing="1" text-anchor="middle" fill="#000">%s</text>`,
+			width/2, width+qrCaptionSpace/2, caption)
+	}
+	b.WriteString(`</svg>`)
+	return b.Bytes()
+}
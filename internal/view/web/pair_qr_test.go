@@ -0,0 +1,94 @@
+package web
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlePairingQR(t *testing.T) {
+	t.Parallel()
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	h := newTestHandlers(t, d, "test")
+
+	// No code generated yet
+	rec := httptest.NewRecorder()
+	h.HandlePairingQR(rec, httptest.NewRequest("GET", "/api/pair/qr", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.Contains(t, rec.Body.String(), "no_pairing_code")
+
+	code, err := h.authStore.CreatePairingCode()
+	require.NoError(t, err)
+
+	rec = httptest.NewRecorder()
+	h.HandlePairingQR(rec, httptest.NewRequest("GET", "/api/pair/qr", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "image/svg+xml", rec.Header().Get("Content-Type"))
+	require.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	require.Contains(t, rec.Body.String(), "<svg")
+	require.Contains(t, rec.Body.String(), ">"+code+"</text>")
+
+	expiresIn, err := strconv.Atoi(rec.Header().Get("X-Pairing-Expires-In"))
+	require.NoError(t, err)
+	require.InDelta(t, PairingCodeTTL.Seconds(), expiresIn, 5)
+	expiresAt, err := time.Parse(time.RFC3339, rec.Header().Get("X-Pairing-Expires-At"))
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(PairingCodeTTL), expiresAt, 5*time.Second)
+
+	rec = httptest.NewRecorder()
+	h.HandlePairingQR(rec, httptest.NewRequest("GET", "/api/pair/qr?format=png", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	_, err = png.Decode(bytes.NewReader(rec.Body.Bytes()))
+	require.NoError(t, err)
+
+	rec = httptest.NewRecorder()
+	h.HandlePairingQR(rec, httptest.NewRequest("GET", "/api/pair/qr?format=gif", nil))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestPairingURL(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest("GET", "https://dash.example:8443/api/pair/qr", nil)
+	require.Equal(t, "https://dash.example:8443/pair?code=ABCD2345", pairingURL(req, "ABCD2345"))
+
+	req = httptest.NewRequest("GET", "http://localhost:8080/api/pair/qr", nil)
+	require.Equal(t, "http://localhost:8080/pair?code=ABCD2345", pairingURL(req, "ABCD2345"))
+
+	// X-Forwarded-Proto only counts from a trusted proxy
+	req.Header.Set("X-Forwarded-Proto", "https")
+	require.Equal(t, "http://localhost:8080/pair?code=ABCD2345", pairingURL(req, "ABCD2345"))
+
+	var got string
+	trusted := ClientIPMiddleware([]netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")})
+	trusted(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = pairingURL(r, "ABCD2345")
+	})).ServeHTTP(httptest.NewRecorder(), req)
+	require.Equal(t, "https://localhost:8080/pair?code=ABCD2345", got)
+}
+
+func TestHandlePairPagePrefillsCode(t *testing.T) {
+	t.Parallel()
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	h := newTestHandlers(t, d, "test")
+
+	rec := httptest.NewRecorder()
+	h.HandlePairPage(rec, httptest.NewRequest("GET", "/pair?code=abcd2345", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `value="ABCD2345"`)
+
+	rec = httptest.NewRecorder()
+	h.HandlePairPage(rec, httptest.NewRequest("GET", `/pair?code="><script>`, nil))
+	require.NotContains(t, rec.Body.String(), "<script>\"")
+	require.Contains(t, rec.Body.String(), `value=""`)
+}
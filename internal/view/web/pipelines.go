@@ -0,0 +1,298 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"phobos.org.uk/agency/internal/api"
+)
+
+// Pipeline limits
+const (
+	maxPipelineSteps     = 20
+	maxFinishedPipelines = 100 // Finished pipelines kept for status queries
+)
+
+// Pipeline states
+const (
+	PipelineRunning   = "running"
+	PipelineCompleted = "completed"
+	PipelineFailed    = "failed"
+)
+
+// Step state for steps not yet queued
+const pipelineStepWaiting = "waiting"
+
+// PipelineSubmitRequest is the body of POST /api/pipelines. The options
+// apply to every step.
+type PipelineSubmitRequest struct {
+	Steps          []string          `json:"steps"` // Prompts, run in order
+	Tier           string            `json:"tier,omitempty"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"`
+	SessionID      string            `json:"session_id,omitempty"` // Continue an existing session (optional)
+	Env            map[string]string `json:"env,omitempty"`
+	Source         string            `json:"source,omitempty"`
+	AgentKind      string            `json:"agent_kind,omitempty"`
+	api.RunnerOptions
+}
+
+// PipelineStep is one prompt of a pipeline.
+type PipelineStep struct {
+	Prompt  string `json:"prompt"`
+	State   string `json:"state"` // waiting until queued, then the queued task's state
+	QueueID string `json:"queue_id,omitempty"`
+	TaskID  string `json:"task_id,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Pipeline runs its steps one at a time in a single session. Each step is
+// queued only once the previous one completed; any other outcome fails the
+// pipeline.
+type Pipeline struct {
+	ID          string         `json:"pipeline_id"`
+	State       string         `json:"state"` // running, completed or failed
+	CreatedAt   time.Time      `json:"created_at"`
+	FinishedAt  *time.Time     `json:"finished_at,omitempty"`
+	SessionID   string         `json:"session_id,omitempty"`
+	CurrentStep int            `json:"current_step"`          // Index of the step running, or that ran last
+	FailedStep  *int           `json:"failed_step,omitempty"` // Index of the step that failed
+	Error       string         `json:"error,omitempty"`
+	Steps       []PipelineStep `json:"steps"`
+
+	request PipelineSubmitRequest
+}
+
+// Pipelines chains queued tasks into pipelines. It learns that a step
+// finished through TaskFinished, called for task.finished events.
+// Pipelines are kept in memory: steps already queued survive a director
+// restart, but the steps after them are not queued.
+type Pipelines struct {
+	mu        sync.Mutex
+	queue     *WorkQueue
+	byID      map[string]*Pipeline
+	byQueueID map[string]*Pipeline // Pipeline of each step's queued task
+	finished  []string             // IDs of finished pipelines, oldest first
+}
+
+// NewPipelines creates a pipeline runner that queues steps on queue.
+func NewPipelines(queue *WorkQueue) *Pipelines {
+	return &Pipelines{
+		queue:     queue,
+		byID:      make(map[string]*Pipeline),
+		byQueueID: make(map[string]*Pipeline),
+	}
+}
+
+// Start creates a pipeline and queues its first step.
+func (p *Pipelines) Start(req PipelineSubmitRequest) (*Pipeline, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pl := &Pipeline{
+		ID:        fmt.Sprintf("pipeline-%d", time.Now().UnixNano()),
+		State:     PipelineRunning,
+		CreatedAt: time.Now(),
+		SessionID: req.SessionID,
+		Steps:     make([]PipelineStep, len(req.Steps)),
+		request:   req,
+	}
+	for i, prompt := range req.Steps {
+		pl.Steps[i] = PipelineStep{Prompt: prompt, State: pipelineStepWaiting}
+	}
+	if err := p.queueStepUnlocked(pl, 0); err != nil {
+		return nil, err
+	}
+	p.byID[pl.ID] = pl
+	return pl.snapshot(p.queue), nil
+}
+
+// queueStepUnlocked adds step i of pl to the queue.
+func (p *Pipelines) queueStepUnlocked(pl *Pipeline, i int) error {
+	req := pl.request
+	task, _, err := p.queue.Add(QueueSubmitRequest{
+		Prompt:         req.Steps[i],
+		Tier:           req.Tier,
+		TimeoutSeconds: req.TimeoutSeconds,
+		SessionID:      pl.SessionID,
+		Env:            req.Env,
+		Source:         req.Source,
+		SourceJob:      pl.ID,
+		AgentKind:      req.AgentKind,
+		RunnerOptions:  req.RunnerOptions,
+	})
+	if err != nil {
+		return err
+	}
+	pl.CurrentStep = i
+	pl.Steps[i].QueueID = task.QueueID
+	pl.Steps[i].State = string(task.State)
+	p.byQueueID[task.QueueID] = pl
+	return nil
+}
+
+// TaskFinished advances the pipeline that task is a step of, if any:
+// a completed step queues the next one in the same session, anything else
+// fails the pipeline.
+func (p *Pipelines) TaskFinished(task *QueuedTask, state string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pl, ok := p.byQueueID[task.QueueID]
+	if !ok {
+		return
+	}
+	delete(p.byQueueID, task.QueueID)
+
+	i := pl.CurrentStep
+	step := &pl.Steps[i]
+	step.State = state
+	step.TaskID = task.TaskID
+	if task.SessionID != "" {
+		pl.SessionID = task.SessionID
+	}
+
+	if state != string(TaskStateCompleted) {
+		step.Error = task.LastError
+		p.failUnlocked(pl, i, fmt.Sprintf("step %d %s", i, state))
+		return
+	}
+	if i+1 == len(pl.Steps) {
+		p.finishUnlocked(pl, PipelineCompleted)
+		return
+	}
+	if err := p.queueStepUnlocked(pl, i+1); err != nil {
+		p.failUnlocked(pl, i+1, fmt.Sprintf("queueing step %d: %v", i+1, err))
+		return
+	}
+	fmt.Fprintf(os.Stderr, "pipeline: %s step %d/%d queued as %s\n",
+		pl.ID, i+2, len(pl.Steps), pl.Steps[i+1].QueueID)
+}
+
+func (p *Pipelines) failUnlocked(pl *Pipeline, i int, reason string) {
+	pl.FailedStep = &i
+	pl.Error = reason
+	p.finishUnlocked(pl, PipelineFailed)
+}
+
+// finishUnlocked ends pl and forgets the oldest finished pipelines beyond
+// the retention limit.
+func (p *Pipelines) finishUnlocked(pl *Pipeline, state string) {
+	now := time.Now()
+	pl.State = state
+	pl.FinishedAt = &now
+	if pl.Error != "" {
+		fmt.Fprintf(os.Stderr, "pipeline: %s %s: %s\n", pl.ID, state, pl.Error)
+	} else {
+		fmt.Fprintf(os.Stderr, "pipeline: %s %s\n", pl.ID, state)
+	}
+
+	p.finished = append(p.finished, pl.ID)
+	for len(p.finished) > maxFinishedPipelines {
+		delete(p.byID, p.finished[0])
+		p.finished = p.finished[1:]
+	}
+}
+
+// Get returns a copy of a pipeline, or nil
+func (p *Pipelines) Get(id string) *Pipeline {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pl, ok := p.byID[id]
+	if !ok {
+		return nil
+	}
+	return pl.snapshot(p.queue)
+}
+
+// All returns copies of all pipelines, newest first
+func (p *Pipelines) All() []*Pipeline {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := make([]*Pipeline, 0, len(p.byID))
+	for _, pl := range p.byID {
+		result = append(result, pl.snapshot(p.queue))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+	return result
+}
+
+// snapshot copies pl, filling in the live state of the step in the queue.
+func (pl *Pipeline) snapshot(queue *WorkQueue) *Pipeline {
+	c := *pl
+	c.Steps = append([]PipelineStep(nil), pl.Steps...)
+	if pl.State == PipelineRunning {
+		step := &c.Steps[c.CurrentStep]
+		if task := queue.Get(step.QueueID); task != nil {
+			step.State = string(task.State)
+			step.TaskID = task.TaskID
+		}
+	}
+	return &c
+}
+
+// HandleSubmit handles POST /api/pipelines
+func (p *Pipelines) HandleSubmit(w http.ResponseWriter, r *http.Request) {
+	var req PipelineSubmitRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if len(req.Steps) == 0 {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "steps is required")
+		return
+	}
+	if len(req.Steps) > maxPipelineSteps {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation,
+			fmt.Sprintf("a pipeline has at most %d steps", maxPipelineSteps))
+		return
+	}
+	for i, prompt := range req.Steps {
+		if prompt == "" {
+			writeError(w, http.StatusBadRequest, api.ErrorValidation, fmt.Sprintf("step %d has no prompt", i))
+			return
+		}
+	}
+	if req.Tier != "" && !api.IsValidTier(req.Tier) {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "tier must be fast, standard, or heavy")
+		return
+	}
+	if req.AgentKind != "" && !api.IsValidAgentKind(req.AgentKind) {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "agent_kind must be claude or codex")
+		return
+	}
+
+	pl, err := p.Start(req)
+	if err == ErrQueueFull {
+		writeError(w, http.StatusServiceUnavailable, api.ErrorQueueFull,
+			fmt.Sprintf("Queue is at capacity (%d tasks)", p.queue.Config().MaxSize))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, api.ErrorQueueError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, pl)
+}
+
+// HandleList handles GET /api/pipelines
+func (p *Pipelines) HandleList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"pipelines": p.All()})
+}
+
+// HandleStatus handles GET /api/pipelines/{id}
+func (p *Pipelines) HandleStatus(w http.ResponseWriter, r *http.Request, id string) {
+	pl := p.Get(id)
+	if pl == nil {
+		writeError(w, http.StatusNotFound, api.ErrorNotFound, "Pipeline not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, pl)
+}
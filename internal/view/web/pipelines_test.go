@@ -0,0 +1,125 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// finishStep plays the dispatcher for a pipeline step: dispatch it in
+// sessionID, then finish it with state.
+func finishStep(t *testing.T, q *WorkQueue, p *Pipelines, queueID, sessionID, state string) {
+	t.Helper()
+	task := q.Get(queueID)
+	require.NotNil(t, task)
+	q.SetDispatched(task, "https://localhost:9000", "task-"+queueID, sessionID, "test")
+	q.Remove(task)
+	p.TaskFinished(task, state)
+}
+
+func TestPipelineRunsStepsInOneSession(t *testing.T) {
+	t.Parallel()
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	p := NewPipelines(q)
+
+	pl, err := p.Start(PipelineSubmitRequest{Steps: []string{"plan", "build"}, Tier: "heavy", Source: "cli"})
+	require.NoError(t, err)
+	require.Equal(t, PipelineRunning, pl.State)
+	require.Equal(t, "pending", pl.Steps[0].State)
+	require.Equal(t, pipelineStepWaiting, pl.Steps[1].State)
+	require.Equal(t, 1, q.Depth(), "only the first step is queued")
+
+	first := q.Get(pl.Steps[0].QueueID)
+	require.Equal(t, "heavy", first.Tier)
+	require.Equal(t, pl.ID, first.SourceJob)
+
+	finishStep(t, q, p, pl.Steps[0].QueueID, "session-1", "completed")
+	pl = p.Get(pl.ID)
+	require.Equal(t, 1, pl.CurrentStep)
+	require.Equal(t, "session-1", pl.SessionID)
+	second := q.Get(pl.Steps[1].QueueID)
+	require.NotNil(t, second)
+	require.Equal(t, "session-1", second.SessionID, "later steps continue the session")
+	require.Equal(t, "build", second.Prompt)
+
+	finishStep(t, q, p, second.QueueID, "session-1", "completed")
+	pl = p.Get(pl.ID)
+	require.Equal(t, PipelineCompleted, pl.State)
+	require.NotNil(t, pl.FinishedAt)
+	require.Nil(t, pl.FailedStep)
+	require.Equal(t, "completed", pl.Steps[1].State)
+}
+
+func TestPipelineStopsAtFailedStep(t *testing.T) {
+	t.Parallel()
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	p := NewPipelines(q)
+
+	pl, err := p.Start(PipelineSubmitRequest{Steps: []string{"one", "two", "three"}})
+	require.NoError(t, err)
+	finishStep(t, q, p, pl.Steps[0].QueueID, "session-1", "completed")
+
+	pl = p.Get(pl.ID)
+	finishStep(t, q, p, pl.Steps[1].QueueID, "session-1", "failed")
+
+	pl = p.Get(pl.ID)
+	require.Equal(t, PipelineFailed, pl.State)
+	require.NotNil(t, pl.FailedStep)
+	require.Equal(t, 1, *pl.FailedStep)
+	require.Equal(t, "step 1 failed", pl.Error)
+	require.Equal(t, pipelineStepWaiting, pl.Steps[2].State)
+	require.Zero(t, q.Depth())
+
+	// Tasks outside pipelines are ignored
+	other, _, err := q.Add(QueueSubmitRequest{Prompt: "unrelated"})
+	require.NoError(t, err)
+	p.TaskFinished(other, "completed")
+	require.Equal(t, PipelineFailed, p.Get(pl.ID).State)
+}
+
+func TestPipelineHandlers(t *testing.T) {
+	t.Parallel()
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	p := NewPipelines(q)
+
+	for _, body := range []string{
+		`{}`,
+		`{"steps": ["ok", ""]}`,
+		`{"steps": ["ok"], "tier": "huge"}`,
+		`{"steps": ["ok"], "agent_kind": "other"}`,
+	} {
+		rec := httptest.NewRecorder()
+		p.HandleSubmit(rec, httptest.NewRequest("POST", "/api/pipelines", bytes.NewBufferString(body)))
+		require.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+	require.Zero(t, q.Depth())
+
+	rec := httptest.NewRecorder()
+	p.HandleSubmit(rec, httptest.NewRequest("POST", "/api/pipelines", bytes.NewBufferString(`{"steps": ["a", "b"]}`)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var created Pipeline
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	require.Len(t, created.Steps, 2)
+
+	rec = httptest.NewRecorder()
+	p.HandleStatus(rec, httptest.NewRequest("GET", "/api/pipelines/"+created.ID, nil), created.ID)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var status Pipeline
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	require.Equal(t, PipelineRunning, status.State)
+	require.Equal(t, 0, status.CurrentStep)
+
+	rec = httptest.NewRecorder()
+	p.HandleStatus(rec, httptest.NewRequest("GET", "/api/pipelines/nope", nil), "nope")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
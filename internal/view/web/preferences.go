@@ -0,0 +1,127 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"phobos.org.uk/agency/internal/api"
+)
+
+// Dashboard themes
+const (
+	ThemeDark   = "dark" // Default
+	ThemeLight  = "light"
+	ThemeSystem = "system" // Follow the browser's prefers-color-scheme
+)
+
+// Preference limits
+const (
+	minRefreshInterval = 2   // Seconds
+	maxRefreshInterval = 300 // Seconds
+	maxDefaultContext  = 16 << 10
+)
+
+// Preferences are a device's dashboard settings, kept with its auth session.
+// New sessions inherit the UI settings of the most recently used session, so
+// they follow the user to new browsers; timezone and locale stay per device.
+type Preferences struct {
+	Timezone string `json:"timezone,omitempty"` // IANA name, e.g. Europe/London (empty = UTC)
+	Locale   string `json:"locale,omitempty"`   // One of localeFormats (empty = ISO 8601 style)
+
+	Theme            string `json:"theme,omitempty"`              // ThemeDark, ThemeLight or ThemeSystem (empty = dark)
+	RefreshInterval  int    `json:"refresh_interval,omitempty"`   // Idle polling in seconds (0 = 5)
+	DefaultAgentKind string `json:"default_agent_kind,omitempty"` // Preselected agent kind for new tasks
+	DefaultContext   string `json:"default_context,omitempty"`    // Project context for new sessions' prompts
+}
+
+// inherited returns the settings a new session takes from p.
+func (p Preferences) inherited() Preferences {
+	p.Timezone = ""
+	p.Locale = ""
+	return p
+}
+
+// validate checks that every setting is supported.
+func (p Preferences) validate() error {
+	if p.Timezone != "" {
+		if _, err := loadLocation(p.Timezone); err != nil {
+			return fmt.Errorf("unknown timezone %q", p.Timezone)
+		}
+	}
+	if _, ok := localeFormats[p.Locale]; !ok {
+		return fmt.Errorf("locale must be one of %s", strings.Join(supportedLocales(), ", "))
+	}
+	switch p.Theme {
+	case "", ThemeDark, ThemeLight, ThemeSystem:
+	default:
+		return fmt.Errorf("theme must be %s, %s or %s", ThemeDark, ThemeLight, ThemeSystem)
+	}
+	if p.RefreshInterval != 0 && (p.RefreshInterval < minRefreshInterval || p.RefreshInterval > maxRefreshInterval) {
+		return fmt.Errorf("refresh_interval must be between %d and %d seconds", minRefreshInterval, maxRefreshInterval)
+	}
+	if p.DefaultAgentKind != "" && !api.IsValidAgentKind(p.DefaultAgentKind) {
+		return fmt.Errorf("default_agent_kind must be claude or codex")
+	}
+	if len(p.DefaultContext) > maxDefaultContext {
+		return fmt.Errorf("default_context exceeds %d bytes", maxDefaultContext)
+	}
+	return nil
+}
+
+// supportedLocales returns the non-default locales, sorted.
+func supportedLocales() []string {
+	locales := make([]string, 0, len(localeFormats))
+	for locale := range localeFormats {
+		if locale != "" {
+			locales = append(locales, locale)
+		}
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// PreferencesResponse is returned by the preferences endpoints.
+type PreferencesResponse struct {
+	Preferences
+	Locales []string `json:"locales"` // Supported locales
+}
+
+// HandleGetPreferences returns the current device's preferences
+func (h *Handlers) HandleGetPreferences(w http.ResponseWriter, r *http.Request) {
+	var prefs Preferences
+	if session := GetSessionFromContext(r.Context()); session != nil {
+		prefs = h.authStore.Preferences(session.ID)
+	}
+	writeJSON(w, http.StatusOK, PreferencesResponse{Preferences: prefs, Locales: supportedLocales()})
+}
+
+// HandleSetPreferences updates the current device's preferences. Fields
+// missing from the request are left unchanged. (requires session)
+func (h *Handlers) HandleSetPreferences(w http.ResponseWriter, r *http.Request) {
+	session := GetSessionFromContext(r.Context())
+	if session == nil {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "Preferences are stored with a login or device session")
+		return
+	}
+	prefs := h.authStore.Preferences(session.ID)
+	if !decodeJSON(w, r, &prefs) {
+		return
+	}
+	if err := prefs.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, err.Error())
+		return
+	}
+
+	ok, err := h.authStore.SetPreferences(session.ID, prefs)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "save_error", "Failed to save preferences: "+err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, api.ErrorNotFound, "Session not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, PreferencesResponse{Preferences: prefs, Locales: supportedLocales()})
+}
@@ -0,0 +1,107 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreferencesValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		prefs   Preferences
+		wantErr string
+	}{
+		{"defaults", Preferences{}, ""},
+		{"all set", Preferences{Timezone: "Europe/London", Locale: "en-GB", Theme: ThemeSystem, RefreshInterval: 30, DefaultAgentKind: "codex", DefaultContext: "Go monorepo"}, ""},
+		{"timezone", Preferences{Timezone: "Nowhere/Special"}, "unknown timezone"},
+		{"locale", Preferences{Locale: "tlh"}, "locale must be one of"},
+		{"theme", Preferences{Theme: "solarized"}, "theme must be"},
+		{"refresh too fast", Preferences{RefreshInterval: 1}, "refresh_interval"},
+		{"refresh too slow", Preferences{RefreshInterval: 3600}, "refresh_interval"},
+		{"agent kind", Preferences{DefaultAgentKind: "gpt"}, "default_agent_kind"},
+		{"context too long", Preferences{DefaultContext: strings.Repeat("x", maxDefaultContext+1)}, "default_context"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.prefs.validate()
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestNewSessionsInheritPreferences(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewAuthStore(filepath.Join(t.TempDir(), "auth.json"), "password")
+	require.NoError(t, err)
+	first, err := store.CreateAuthSession("10.0.0.1", "laptop")
+	require.NoError(t, err)
+	prefs := Preferences{Timezone: "Asia/Tokyo", Locale: "ja-JP", Theme: ThemeLight, RefreshInterval: 10, DefaultContext: "Go monorepo"}
+	ok, err := store.SetPreferences(first.ID, prefs)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// UI settings follow to the new browser; timezone and locale are per device
+	code, err := store.CreatePairingCode()
+	require.NoError(t, err)
+	device, err := store.CreateDeviceSession(code, "phone", "10.0.0.2", "phone")
+	require.NoError(t, err)
+	require.Equal(t, prefs.inherited(), store.Preferences(device.ID))
+	require.Empty(t, store.Preferences(device.ID).Timezone)
+}
+
+func TestPreferencesHandlers(t *testing.T) {
+	t.Parallel()
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	h := newTestHandlers(t, d, "test")
+	session, err := h.authStore.CreateAuthSession("127.0.0.1", "test")
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), sessionContextKey, session)
+
+	put := func(prefs Preferences) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(prefs)
+		req := httptest.NewRequest("PUT", "/api/preferences", bytes.NewReader(body)).WithContext(ctx)
+		w := httptest.NewRecorder()
+		h.HandleSetPreferences(w, req)
+		return w
+	}
+
+	require.Equal(t, http.StatusBadRequest, put(Preferences{Timezone: "Nowhere/Special"}).Code)
+	require.Equal(t, http.StatusBadRequest, put(Preferences{Locale: "tlh"}).Code)
+	require.Equal(t, http.StatusOK, put(Preferences{Timezone: "Asia/Tokyo", Locale: "ja-JP"}).Code)
+	require.Equal(t, http.StatusOK, put(Preferences{Theme: ThemeLight}).Code) // Merged with the stored settings
+
+	w := httptest.NewRecorder()
+	h.HandleGetPreferences(w, httptest.NewRequest("GET", "/api/preferences", nil).WithContext(ctx))
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp PreferencesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, Preferences{Timezone: "Asia/Tokyo", Locale: "ja-JP", Theme: ThemeLight}, resp.Preferences)
+	require.Contains(t, resp.Locales, "ja-JP")
+
+	// Without a session there is nowhere to keep preferences
+	w = httptest.NewRecorder()
+	h.HandleSetPreferences(w, httptest.NewRequest("PUT", "/api/preferences", bytes.NewReader([]byte(`{}`))))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Preferences survive a restart
+	reloaded, err := NewAuthStore(h.authStore.filePath, "")
+	require.NoError(t, err)
+	require.Equal(t, "Asia/Tokyo", reloaded.Preferences(session.ID).Timezone)
+}
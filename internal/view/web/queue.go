@@ -17,11 +17,13 @@ import (
 // Task state constants - re-exported from taskstate package for backward compatibility.
 const (
 	TaskStatePending     = taskstate.Pending
+	TaskStateHeld        = taskstate.Held
 	TaskStateDispatching = taskstate.Dispatching
 	TaskStateWorking     = taskstate.Working
 	TaskStateCompleted   = taskstate.Completed
 	TaskStateFailed      = taskstate.Failed
 	TaskStateCancelled   = taskstate.Cancelled
+	TaskStateExpired     = taskstate.Expired
 )
 
 // Persistence directory names
@@ -33,6 +35,19 @@ const (
 // ErrQueueFull is returned when the queue is at capacity
 var ErrQueueFull = errors.New("queue is at capacity")
 
+// ErrDuplicate is returned, along with the existing task, when a submission
+// repeats the idempotency key of a recent one
+var ErrDuplicate = errors.New("duplicate idempotency key")
+
+// ErrTaskNotFound is returned for a queue ID that is not in the queue
+var ErrTaskNotFound = errors.New("queued task not found")
+
+// ErrNotPending is returned when holding a task that is no longer pending
+var ErrNotPending = errors.New("task is not pending")
+
+// ErrNotHeld is returned when releasing a task that is not held
+var ErrNotHeld = errors.New("task is not held")
+
 // QueuedTask represents a task waiting in the queue
 type QueuedTask struct {
 	QueueID   string          `json:"queue_id"`   // Unique queue entry ID
@@ -46,17 +61,49 @@ type QueuedTask struct {
 	SessionID      string            `json:"session_id,omitempty"`
 	Env            map[string]string `json:"env,omitempty"`
 	AgentKind      string            `json:"agent_kind,omitempty"`
+	Attachments    []api.Attachment  `json:"attachments,omitempty"` // Files for the agent to write into the workdir
+	api.RunnerOptions
 
 	// Dispatch tracking
 	DispatchedAt *time.Time `json:"dispatched_at,omitempty"` // When sent to agent
 	TaskID       string     `json:"task_id,omitempty"`       // Agent's task ID (once dispatched)
 	AgentURL     string     `json:"agent_url,omitempty"`     // Target agent (once dispatched)
+	RouteReason  string     `json:"route_reason,omitempty"`  // Why the target agent was chosen
 	Attempts     int        `json:"attempts"`                // Dispatch attempt count
 	LastError    string     `json:"last_error,omitempty"`    // Most recent error
 
+	// Set while a pending task is held back by a dispatch window or the
+	// hourly dispatch limit
+	ScheduledAfter *time.Time `json:"scheduled_after,omitempty"`
+
+	// Deadline for dispatch; the task expires if still pending after it
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// Earliest time the task may be dispatched, if the submitter set one
+	RunAt *time.Time `json:"run_at,omitempty"`
+
 	// Source tracking
-	Source    string `json:"source"`               // "web", "scheduler", "cli"
+	Source    string `json:"source"`               // "web", "scheduler", "cli", "github"
 	SourceJob string `json:"source_job,omitempty"` // Job name (if scheduler)
+
+	CallbackURL    string `json:"callback_url,omitempty"`    // Receives the result when the task finishes
+	IdempotencyKey string `json:"idempotency_key,omitempty"` // Caller's key for suppressing repeat submissions
+
+	// Set on subtasks spawned by another queued task
+	ParentQueueID string `json:"parent_queue_id,omitempty"`
+	ParentTaskID  string `json:"parent_task_id,omitempty"` // Parent's agent task ID, recorded in the child's history
+	SubtaskDepth  int    `json:"subtask_depth,omitempty"`  // How deeply nested (1 = child of a top-level task)
+
+	// Correlates the task with the requests that led to it, and is sent to
+	// the agent as X-Agency-Request-ID
+	RequestID string `json:"request_id,omitempty"`
+
+	// Set when submission already bumped the session's seq, so dispatch
+	// doesn't count the task twice
+	SeqClaimed bool `json:"seq_claimed,omitempty"`
+
+	// Every dispatch, retry, loss and cancel, oldest first
+	History []DispatchEvent `json:"history,omitempty"`
 }
 
 // QueueConfig defines queue behavior
@@ -65,21 +112,53 @@ type QueueConfig struct {
 	MaxSize         int           // Maximum queue depth (default: 50)
 	MaxAttempts     int           // Retry limit per task (default: 3)
 	DispatchTimeout time.Duration // Time to wait for agent response (default: 30s)
+	LivenessTimeout time.Duration // How long a dispatched task's agent may be unreachable (default: 2m)
+
+	MaxDispatchesPerHour int              // Dispatch limit per rolling hour (0 = unlimited)
+	DispatchWindows      []DispatchWindow // Daily windows restricting when tiers dispatch (empty = always)
+	SourceWeights        map[string]int   // Fair-share weight per source (unlisted = DefaultSourceWeight)
+
+	IdempotencyTTL time.Duration // How long an idempotency key suppresses repeats (default: 24h)
 }
 
 const (
 	DefaultMaxSize         = 50
 	DefaultMaxAttempts     = 3
 	DefaultDispatchTimeout = 30 * time.Second
+	DefaultLivenessTimeout = 2 * time.Minute
+	DefaultIdempotencyTTL  = 24 * time.Hour
+
+	expiredRetention = time.Hour // How long expired tasks stay visible in queue status
+	maxExpiredKept   = 100
 )
 
+// expiredTask records when a task expired.
+type expiredTask struct {
+	task *QueuedTask
+	at   time.Time
+}
+
+// keyedTask records the task submitted with an idempotency key.
+type keyedTask struct {
+	task    *QueuedTask
+	addedAt time.Time
+}
+
 // WorkQueue manages pending tasks with file-based persistence
 type WorkQueue struct {
-	mu     sync.RWMutex
-	tasks  []*QueuedTask          // FIFO order
-	byID   map[string]*QueuedTask // Quick lookup by queue_id
-	dir    string                 // Persistence directory
+	mu    sync.RWMutex
+	tasks []*QueuedTask          // FIFO order
+	byID  map[string]*QueuedTask // Quick lookup by queue_id
+	// Recently expired tasks, oldest first. Kept in memory only, so status
+	// queries can report them after they leave the queue.
+	expired []expiredTask
+	// Tasks by idempotency key, kept for IdempotencyTTL after submission
+	// even once they leave the queue
+	keys   map[string]keyedTask
+	dir    string // Persistence directory
 	config QueueConfig
+
+	events *EventBus // Told of submitted tasks (optional)
 }
 
 // NewWorkQueue creates a new work queue with persistence
@@ -93,10 +172,17 @@ func NewWorkQueue(cfg QueueConfig) (*WorkQueue, error) {
 	if cfg.DispatchTimeout == 0 {
 		cfg.DispatchTimeout = DefaultDispatchTimeout
 	}
+	if cfg.LivenessTimeout == 0 {
+		cfg.LivenessTimeout = DefaultLivenessTimeout
+	}
+	if cfg.IdempotencyTTL == 0 {
+		cfg.IdempotencyTTL = DefaultIdempotencyTTL
+	}
 
 	q := &WorkQueue{
 		tasks:  make([]*QueuedTask, 0),
 		byID:   make(map[string]*QueuedTask),
+		keys:   make(map[string]keyedTask),
 		dir:    cfg.Dir,
 		config: cfg,
 	}
@@ -124,20 +210,62 @@ type QueueSubmitRequest struct {
 	TimeoutSeconds int               `json:"timeout_seconds,omitempty"`
 	SessionID      string            `json:"session_id,omitempty"`
 	Env            map[string]string `json:"env,omitempty"`
-	Source         string            `json:"source,omitempty"`     // "web", "scheduler", "cli"
+	Source         string            `json:"source,omitempty"`     // "web", "scheduler", "cli", "github"
 	SourceJob      string            `json:"source_job,omitempty"` // Job name (if scheduler)
 	AgentKind      string            `json:"agent_kind,omitempty"`
+	CallbackURL    string            `json:"callback_url,omitempty"` // POSTed the result when the task finishes
+	IdempotencyKey string            `json:"idempotency_key,omitempty"`
+	ParentQueueID  string            `json:"-"` // Set by Subtasks, never by API callers
+	ParentTaskID   string            `json:"-"`
+	SubtaskDepth   int               `json:"-"`
+	RequestID      string            `json:"-"` // From the submitting request; generated if empty
+
+	// Optional dispatch deadline, relative or absolute (at most one)
+	ExpiresAfterSeconds int              `json:"expires_after_seconds,omitempty"`
+	NotAfter            *time.Time       `json:"not_after,omitempty"`
+	Attachments         []api.Attachment `json:"attachments,omitempty"` // Base64 file contents, limited by the agent
+	api.RunnerOptions
+
+	// Session seq the caller last saw; rejected with 409 if it has moved on
+	ExpectedSeq *int `json:"expected_seq,omitempty"`
+	SeqClaimed  bool `json:"-"` // The session's seq was bumped at submission
+
+	Hold  bool       `json:"hold,omitempty"`   // Queue held, not dispatched until released
+	RunAt *time.Time `json:"run_at,omitempty"` // Not dispatched before this time
+}
+
+// SetEventBus sets the bus told of each task added to the queue
+func (q *WorkQueue) SetEventBus(bus *EventBus) {
+	q.events = bus
 }
 
 // Add adds a task to the queue. Returns the task, position, and error.
+// If req.IdempotencyKey matches a task submitted within the idempotency TTL,
+// nothing is added and Add returns that task, its position and ErrDuplicate.
 func (q *WorkQueue) Add(req QueueSubmitRequest) (*QueuedTask, int, error) {
+	task, position, err := q.add(req)
+	if err == nil {
+		q.events.Publish(Event{Type: EventTaskSubmitted, Task: task})
+	}
+	return task, position, err
+}
+
+func (q *WorkQueue) add(req QueueSubmitRequest) (*QueuedTask, int, error) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
-	// Check capacity
+	now := time.Now()
+	q.pruneKeysUnlocked(now)
+	if req.IdempotencyKey != "" {
+		if existing, ok := q.keys[req.IdempotencyKey]; ok {
+			return existing.task, q.positionUnlocked(existing.task.QueueID), ErrDuplicate
+		}
+	}
+
+	// Check capacity; held tasks take up room too
 	pendingCount := 0
 	for _, t := range q.tasks {
-		if t.State == TaskStatePending {
+		if t.State == TaskStatePending || t.State == TaskStateHeld {
 			pendingCount++
 		}
 	}
@@ -152,11 +280,17 @@ func (q *WorkQueue) Add(req QueueSubmitRequest) (*QueuedTask, int, error) {
 	if agentKind == "" {
 		agentKind = api.AgentKindClaude
 	}
+	// Tasks the director starts itself, such as pipeline stages and
+	// recurring runs, begin their own trace
+	requestID := req.RequestID
+	if requestID == "" {
+		requestID = api.NewRequestID()
+	}
 
 	task := &QueuedTask{
 		QueueID:        queueID,
 		State:          TaskStatePending,
-		CreatedAt:      time.Now(),
+		CreatedAt:      now,
 		Prompt:         req.Prompt,
 		Tier:           req.Tier,
 		TimeoutSeconds: req.TimeoutSeconds,
@@ -165,11 +299,38 @@ func (q *WorkQueue) Add(req QueueSubmitRequest) (*QueuedTask, int, error) {
 		AgentKind:      agentKind,
 		Source:         req.Source,
 		SourceJob:      req.SourceJob,
+		RunnerOptions:  req.RunnerOptions,
+		Attachments:    req.Attachments,
+		CallbackURL:    req.CallbackURL,
+		IdempotencyKey: req.IdempotencyKey,
+		ParentQueueID:  req.ParentQueueID,
+		ParentTaskID:   req.ParentTaskID,
+		SubtaskDepth:   req.SubtaskDepth,
+		RequestID:      requestID,
+		SeqClaimed:     req.SeqClaimed,
 		Attempts:       0,
 	}
+	if req.NotAfter != nil {
+		notAfter := *req.NotAfter
+		task.ExpiresAt = &notAfter
+	} else if req.ExpiresAfterSeconds > 0 {
+		expiresAt := task.CreatedAt.Add(time.Duration(req.ExpiresAfterSeconds) * time.Second)
+		task.ExpiresAt = &expiresAt
+	}
+	if req.RunAt != nil {
+		runAt := *req.RunAt
+		task.RunAt = &runAt
+	}
+	if req.Hold {
+		task.State = TaskStateHeld
+		appendEvent(task, DispatchEvent{At: now, Event: DispatchEventHeld, Detail: "submitted on hold"})
+	}
 
 	q.tasks = append(q.tasks, task)
 	q.byID[task.QueueID] = task
+	if task.IdempotencyKey != "" {
+		q.keys[task.IdempotencyKey] = keyedTask{task: task, addedAt: now}
+	}
 
 	// Persist to disk
 	if err := q.save(task); err != nil {
@@ -177,6 +338,10 @@ func (q *WorkQueue) Add(req QueueSubmitRequest) (*QueuedTask, int, error) {
 		fmt.Fprintf(os.Stderr, "queue: failed to persist task %s: %v\n", task.QueueID, err)
 	}
 
+	if task.State == TaskStateHeld {
+		return task, 0, nil
+	}
+
 	// Calculate position (1-indexed)
 	position := 0
 	for i, t := range q.tasks {
@@ -207,6 +372,20 @@ func (q *WorkQueue) NextPending() *QueuedTask {
 	return nil
 }
 
+// Pending returns the pending tasks in queue order
+func (q *WorkQueue) Pending() []*QueuedTask {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	var pending []*QueuedTask
+	for _, task := range q.tasks {
+		if task.State == TaskStatePending {
+			pending = append(pending, task)
+		}
+	}
+	return pending
+}
+
 // Get returns a task by queue ID
 func (q *WorkQueue) Get(queueID string) *QueuedTask {
 	q.mu.RLock()
@@ -249,15 +428,18 @@ func (q *WorkQueue) SetState(task *QueuedTask, state taskstate.State) {
 	}
 }
 
-// SetDispatched marks a task as dispatched with agent info
-func (q *WorkQueue) SetDispatched(task *QueuedTask, agentURL, taskID, sessionID string) {
+// SetDispatched marks a task as dispatched with agent info and the reason
+// the agent was chosen
+func (q *WorkQueue) SetDispatched(task *QueuedTask, agentURL, taskID, sessionID, reason string) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
 	now := time.Now()
 	task.State = TaskStateWorking
 	task.DispatchedAt = &now
+	task.ScheduledAfter = nil
 	task.AgentURL = agentURL
+	task.RouteReason = reason
 	task.TaskID = taskID
 	if sessionID != "" {
 		task.SessionID = sessionID
@@ -267,6 +449,92 @@ func (q *WorkQueue) SetDispatched(task *QueuedTask, agentURL, taskID, sessionID
 	q.moveToDir(task, "dispatched")
 }
 
+// SetScheduledAfter records when a held-back pending task may next be
+// dispatched. A zero time clears it.
+func (q *WorkQueue) SetScheduledAfter(task *QueuedTask, after time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if after.IsZero() {
+		if task.ScheduledAfter == nil {
+			return
+		}
+		task.ScheduledAfter = nil
+	} else {
+		if task.ScheduledAfter != nil && task.ScheduledAfter.Equal(after) {
+			return
+		}
+		task.ScheduledAfter = &after
+	}
+	if err := q.save(task); err != nil {
+		fmt.Fprintf(os.Stderr, "queue: failed to save task %s: %v\n", task.QueueID, err)
+	}
+}
+
+// RecordAttempt counts a failed attempt and its reason against a task.
+// Returns the updated attempt count.
+func (q *WorkQueue) RecordAttempt(task *QueuedTask, reason string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	task.Attempts++
+	task.LastError = reason
+	return task.Attempts
+}
+
+// ReturnToPending puts a task that could not be dispatched back to pending,
+// keeping its place in the queue
+func (q *WorkQueue) ReturnToPending(task *QueuedTask) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	task.State = TaskStatePending
+	q.moveToDir(task, dirPending)
+}
+
+// Hold keeps a pending task from being dispatched until it is released.
+// It keeps its place in the queue meanwhile.
+func (q *WorkQueue) Hold(queueID string) (*QueuedTask, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	task, ok := q.byID[queueID]
+	if !ok {
+		return nil, ErrTaskNotFound
+	}
+	if task.State != TaskStatePending {
+		return nil, fmt.Errorf("%w: it is %s", ErrNotPending, task.State)
+	}
+	task.State = TaskStateHeld
+	task.ScheduledAfter = nil
+	appendEvent(task, DispatchEvent{Event: DispatchEventHeld})
+	if err := q.save(task); err != nil {
+		fmt.Fprintf(os.Stderr, "queue: failed to save task %s: %v\n", task.QueueID, err)
+	}
+	return task, nil
+}
+
+// Release makes a held task pending again, to be dispatched in its original
+// place in the queue.
+func (q *WorkQueue) Release(queueID string) (*QueuedTask, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	task, ok := q.byID[queueID]
+	if !ok {
+		return nil, ErrTaskNotFound
+	}
+	if task.State != TaskStateHeld {
+		return nil, fmt.Errorf("%w: it is %s", ErrNotHeld, task.State)
+	}
+	task.State = TaskStatePending
+	appendEvent(task, DispatchEvent{Event: DispatchEventReleased})
+	if err := q.save(task); err != nil {
+		fmt.Fprintf(os.Stderr, "queue: failed to save task %s: %v\n", task.QueueID, err)
+	}
+	return task, nil
+}
+
 // RequeueAtBack moves a task to the back of the queue
 func (q *WorkQueue) RequeueAtBack(task *QueuedTask) {
 	q.mu.Lock()
@@ -309,6 +577,16 @@ func (q *WorkQueue) Remove(task *QueuedTask) {
 	q.removeFile(task)
 }
 
+// Fail marks a task as failed with a reason and removes it from the queue.
+func (q *WorkQueue) Fail(task *QueuedTask, reason string) {
+	q.mu.Lock()
+	task.State = TaskStateFailed
+	task.LastError = reason
+	q.mu.Unlock()
+
+	q.Remove(task)
+}
+
 // Cancel cancels a queued task. Returns true if found and cancelled.
 func (q *WorkQueue) Cancel(queueID string) (*QueuedTask, bool) {
 	q.mu.Lock()
@@ -332,11 +610,75 @@ func (q *WorkQueue) Cancel(queueID string) (*QueuedTask, bool) {
 	return task, true
 }
 
+// ExpireDue expires the pending and held tasks whose deadline has passed by now,
+// removing them from the queue. They stay visible through Expired and
+// RecentlyExpired for a while afterwards.
+func (q *WorkQueue) ExpireDue(now time.Time) []*QueuedTask {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var due []*QueuedTask
+	remaining := q.tasks[:0]
+	for _, t := range q.tasks {
+		if (t.State == TaskStatePending || t.State == TaskStateHeld) && t.ExpiresAt != nil && now.After(*t.ExpiresAt) {
+			due = append(due, t)
+			continue
+		}
+		remaining = append(remaining, t)
+	}
+	q.tasks = remaining
+
+	for _, t := range due {
+		t.State = TaskStateExpired
+		t.ScheduledAfter = nil
+		t.LastError = fmt.Sprintf("expired at %s before it could be dispatched", t.ExpiresAt.Format(time.RFC3339))
+		appendEvent(t, DispatchEvent{At: now, Event: DispatchEventExpired})
+		delete(q.byID, t.QueueID)
+		q.removeFile(t)
+		q.expired = append(q.expired, expiredTask{task: t, at: now})
+	}
+
+	cutoff := now.Add(-expiredRetention)
+	for len(q.expired) > 0 && (len(q.expired) > maxExpiredKept || q.expired[0].at.Before(cutoff)) {
+		q.expired = q.expired[1:]
+	}
+	return due
+}
+
+// Expired returns a recently expired task by queue ID, or nil
+func (q *WorkQueue) Expired(queueID string) *QueuedTask {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	for _, e := range q.expired {
+		if e.task.QueueID == queueID {
+			return e.task
+		}
+	}
+	return nil
+}
+
+// RecentlyExpired returns the tasks that expired within the last hour (at
+// most 100), oldest first
+func (q *WorkQueue) RecentlyExpired() []*QueuedTask {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	result := make([]*QueuedTask, 0, len(q.expired))
+	for _, e := range q.expired {
+		result = append(result, e.task)
+	}
+	return result
+}
+
 // Position returns the position of a task in the pending queue (1-indexed)
 func (q *WorkQueue) Position(queueID string) int {
 	q.mu.RLock()
 	defer q.mu.RUnlock()
+	return q.positionUnlocked(queueID)
+}
 
+func (q *WorkQueue) positionUnlocked(queueID string) int {
 	pos := 0
 	for _, t := range q.tasks {
 		if t.State == TaskStatePending {
@@ -349,6 +691,15 @@ func (q *WorkQueue) Position(queueID string) int {
 	return 0 // Not found or not pending
 }
 
+// pruneKeysUnlocked forgets idempotency keys older than the TTL
+func (q *WorkQueue) pruneKeysUnlocked(now time.Time) {
+	for key, entry := range q.keys {
+		if now.Sub(entry.addedAt) > q.config.IdempotencyTTL {
+			delete(q.keys, key)
+		}
+	}
+}
+
 // OldestAge returns the age of the oldest pending task in seconds
 func (q *WorkQueue) OldestAge() float64 {
 	q.mu.RLock()
@@ -376,6 +727,43 @@ func (q *WorkQueue) DispatchedCount() int {
 	return count
 }
 
+// SourceDepth counts the queued tasks from one source.
+type SourceDepth struct {
+	Source     string `json:"source"`
+	Pending    int    `json:"pending"`
+	Dispatched int    `json:"dispatched"`
+	Weight     int    `json:"weight"` // Fair-share weight
+}
+
+// SourceDepths returns the pending and dispatched tasks per source, ordered
+// by source. Tasks without a source are counted under "queue".
+func (q *WorkQueue) SourceDepths() []SourceDepth {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	bySource := map[string]*SourceDepth{}
+	for _, t := range q.tasks {
+		key := sourceKey(t)
+		depth, ok := bySource[key]
+		if !ok {
+			depth = &SourceDepth{Source: key, Weight: sourceWeight(q.config.SourceWeights, key)}
+			bySource[key] = depth
+		}
+		if t.State == TaskStatePending {
+			depth.Pending++
+		} else if t.State.IsDispatched() {
+			depth.Dispatched++
+		}
+	}
+
+	depths := make([]SourceDepth, 0, len(bySource))
+	for _, depth := range bySource {
+		depths = append(depths, *depth)
+	}
+	sort.Slice(depths, func(i, j int) bool { return depths[i].Source < depths[j].Source })
+	return depths
+}
+
 // Config returns the queue configuration
 func (q *WorkQueue) Config() QueueConfig {
 	return q.config
@@ -431,6 +819,12 @@ func (q *WorkQueue) loadFromDisk() error {
 		}
 		// Dispatched tasks that were in-flight during restart go back to pending
 		// (We can't verify with agent since we don't have discovery yet)
+		appendEvent(task, DispatchEvent{
+			Event:    DispatchEventRequeued,
+			AgentURL: task.AgentURL,
+			TaskID:   task.TaskID,
+			Detail:   "director restarted while the task was dispatched",
+		})
 		task.State = TaskStatePending
 		task.TaskID = ""
 		task.AgentURL = ""
@@ -467,6 +861,13 @@ func (q *WorkQueue) loadFromDisk() error {
 		return q.tasks[i].CreatedAt.Before(q.tasks[j].CreatedAt)
 	})
 
+	// Keys of tasks that already left the queue are lost on restart
+	for _, task := range q.tasks {
+		if task.IdempotencyKey != "" {
+			q.keys[task.IdempotencyKey] = keyedTask{task: task, addedAt: task.CreatedAt}
+		}
+	}
+
 	if len(q.tasks) > 0 {
 		fmt.Fprintf(os.Stderr, "queue: loaded %d tasks from disk\n", len(q.tasks))
 	}
@@ -3,9 +3,11 @@ package web
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 
 	"phobos.org.uk/agency/internal/api"
@@ -16,6 +18,10 @@ type QueueHandlers struct {
 	queue        *WorkQueue
 	discovery    *Discovery
 	sessionStore *SessionStore
+	authToken    string   // Bearer token sent to agents (optional)
+	uploads      *Uploads // Images the task form refers to (optional)
+
+	events *EventBus // Told of cancelled tasks (optional)
 }
 
 // NewQueueHandlers creates handlers for queue operations
@@ -27,13 +33,36 @@ func NewQueueHandlers(queue *WorkQueue, discovery *Discovery, sessionStore *Sess
 	}
 }
 
+// SetAuthToken sets the bearer token sent to agents
+func (h *QueueHandlers) SetAuthToken(token string) {
+	h.authToken = token
+}
+
+// SetUploads sets the store that task uploads are resolved from
+func (h *QueueHandlers) SetUploads(uploads *Uploads) {
+	h.uploads = uploads
+}
+
+// SetEventBus sets the bus told of tasks cancelled through the API, the
+// counterpart of Dispatcher.SetEventBus.
+func (h *QueueHandlers) SetEventBus(bus *EventBus) {
+	h.events = bus
+}
+
 // QueueSubmitResponse is returned after successful queue submission
 type QueueSubmitResponse struct {
 	QueueID  string `json:"queue_id"`
 	Position int    `json:"position"`
 	State    string `json:"state"`
+
+	// Set when the idempotency key matched an earlier submission, whose
+	// entry this describes
+	Duplicate bool `json:"duplicate,omitempty"`
 }
 
+// maxIdempotencyKeyLen bounds the keys the queue has to remember
+const maxIdempotencyKeyLen = 256
+
 // HandleQueueSubmit adds a task to the queue
 func (h *QueueHandlers) HandleQueueSubmit(w http.ResponseWriter, r *http.Request) {
 	var req QueueSubmitRequest
@@ -53,8 +82,42 @@ func (h *QueueHandlers) HandleQueueSubmit(w http.ResponseWriter, r *http.Request
 		writeError(w, http.StatusBadRequest, api.ErrorValidation, "agent_kind must be claude or codex")
 		return
 	}
+	if req.CallbackURL != "" {
+		if err := validateCallbackURL(req.CallbackURL); err != nil {
+			writeError(w, http.StatusBadRequest, api.ErrorValidation, err.Error())
+			return
+		}
+	}
+	if err := validateDeadline(req, time.Now()); err != nil {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, err.Error())
+		return
+	}
+	if len(req.IdempotencyKey) > maxIdempotencyKeyLen {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation,
+			fmt.Sprintf("idempotency_key must be at most %d bytes", maxIdempotencyKeyLen))
+		return
+	}
+
+	if msg := h.sessionAgentUnavailable(req.SessionID); msg != "" {
+		writeError(w, http.StatusConflict, api.ErrorSessionAgentUnavailable, msg)
+		return
+	}
+	if !h.claimSession(w, req.SessionID, req.ExpectedSeq) {
+		return
+	}
+	req.SeqClaimed = req.SessionID != ""
+	req.RequestID = api.RequestIDFromContext(r.Context())
 
 	task, position, err := h.queue.Add(req)
+	if err == ErrDuplicate {
+		writeJSON(w, http.StatusOK, QueueSubmitResponse{
+			QueueID:   task.QueueID,
+			Position:  position,
+			State:     string(task.State),
+			Duplicate: true,
+		})
+		return
+	}
 	if err == ErrQueueFull {
 		writeError(w, http.StatusServiceUnavailable, api.ErrorQueueFull,
 			fmt.Sprintf("Queue is at capacity (%d tasks)", h.queue.Config().MaxSize))
@@ -72,13 +135,39 @@ func (h *QueueHandlers) HandleQueueSubmit(w http.ResponseWriter, r *http.Request
 	})
 }
 
+// validateDeadline checks a submission's optional expires_after_seconds or
+// not_after, and that any run_at comes before it.
+func validateDeadline(req QueueSubmitRequest, now time.Time) error {
+	switch {
+	case req.ExpiresAfterSeconds < 0:
+		return errors.New("expires_after_seconds must not be negative")
+	case req.ExpiresAfterSeconds > 0 && req.NotAfter != nil:
+		return errors.New("set expires_after_seconds or not_after, not both")
+	case req.NotAfter != nil && !req.NotAfter.After(now):
+		return errors.New("not_after must be in the future")
+	}
+	if req.RunAt == nil {
+		return nil
+	}
+	deadline := req.NotAfter
+	if req.ExpiresAfterSeconds > 0 {
+		expiresAt := now.Add(time.Duration(req.ExpiresAfterSeconds) * time.Second)
+		deadline = &expiresAt
+	}
+	if deadline != nil && !req.RunAt.Before(*deadline) {
+		return errors.New("run_at must be before the task's expiry")
+	}
+	return nil
+}
+
 // QueueStatusResponse represents the queue status
 type QueueStatusResponse struct {
 	Depth            int                 `json:"depth"`
 	MaxSize          int                 `json:"max_size"`
 	OldestAgeSeconds float64             `json:"oldest_age_seconds"`
 	DispatchedCount  int                 `json:"dispatched_count"`
-	Tasks            []QueuedTaskSummary `json:"tasks"`
+	Sources          []SourceDepth       `json:"sources"` // Per-source counts and weights
+	Tasks            []QueuedTaskSummary `json:"tasks"`   // Queued tasks, then those that expired in the last hour
 }
 
 // QueuedTaskSummary is a summary of a queued task for list responses
@@ -92,6 +181,14 @@ type QueuedTaskSummary struct {
 	SourceJob     string    `json:"source_job,omitempty"`
 	TaskID        string    `json:"task_id,omitempty"`   // If dispatched
 	AgentURL      string    `json:"agent_url,omitempty"` // If dispatched
+
+	ScheduledAfter *time.Time `json:"scheduled_after,omitempty"` // If deferred
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`      // Dispatch deadline, if set
+	RunAt          *time.Time `json:"run_at,omitempty"`          // Earliest dispatch time, if set
+
+	// Set in dashboard data, for the viewer
+	CreatedLocal   *LocalTime `json:"created_local,omitempty"`
+	ScheduledLocal *LocalTime `json:"scheduled_local,omitempty"`
 }
 
 // summarizeQueuedTasks converts queued tasks into summary representations for API responses.
@@ -115,6 +212,10 @@ func summarizeQueuedTasks(tasks []*QueuedTask) []QueuedTaskSummary {
 			SourceJob:     task.SourceJob,
 			TaskID:        task.TaskID,
 			AgentURL:      task.AgentURL,
+
+			ScheduledAfter: task.ScheduledAfter,
+			ExpiresAt:      task.ExpiresAt,
+			RunAt:          task.RunAt,
 		}
 		if task.State.IsPending() {
 			summary.Position = pendingPos
@@ -126,13 +227,14 @@ func summarizeQueuedTasks(tasks []*QueuedTask) []QueuedTaskSummary {
 
 // HandleQueueStatus returns the current queue status
 func (h *QueueHandlers) HandleQueueStatus(w http.ResponseWriter, r *http.Request) {
-	summaries := summarizeQueuedTasks(h.queue.GetAll())
+	summaries := summarizeQueuedTasks(append(h.queue.GetAll(), h.queue.RecentlyExpired()...))
 
 	writeJSON(w, http.StatusOK, QueueStatusResponse{
 		Depth:            h.queue.Depth(),
 		MaxSize:          h.queue.Config().MaxSize,
 		OldestAgeSeconds: h.queue.OldestAge(),
 		DispatchedCount:  h.queue.DispatchedCount(),
+		Sources:          h.queue.SourceDepths(),
 		Tasks:            summaries,
 	})
 }
@@ -146,15 +248,29 @@ type QueuedTaskDetail struct {
 	DispatchedAt *time.Time `json:"dispatched_at,omitempty"`
 	TaskID       string     `json:"task_id,omitempty"`
 	AgentURL     string     `json:"agent_url,omitempty"`
+	RouteReason  string     `json:"route_reason,omitempty"`
 	Attempts     int        `json:"attempts"`
 	LastError    string     `json:"last_error,omitempty"`
 	Source       string     `json:"source"`
 	SourceJob    string     `json:"source_job,omitempty"`
+	CallbackURL  string     `json:"callback_url,omitempty"`
+
+	ScheduledAfter *time.Time `json:"scheduled_after,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	RunAt          *time.Time `json:"run_at,omitempty"`
+	ParentQueueID  string     `json:"parent_queue_id,omitempty"` // Set for subtasks
+	ParentTaskID   string     `json:"parent_task_id,omitempty"`
+	RequestID      string     `json:"request_id,omitempty"`
+
+	History []DispatchEvent `json:"history"` // Dispatch audit trail, oldest first
 }
 
 // HandleQueueTaskStatus returns the status of a specific queued task
 func (h *QueueHandlers) HandleQueueTaskStatus(w http.ResponseWriter, r *http.Request, queueID string) {
 	task := h.queue.Get(queueID)
+	if task == nil {
+		task = h.queue.Expired(queueID)
+	}
 	if task == nil {
 		writeError(w, http.StatusNotFound, api.ErrorNotFound, "Queued task not found")
 		return
@@ -167,10 +283,21 @@ func (h *QueueHandlers) HandleQueueTaskStatus(w http.ResponseWriter, r *http.Req
 		DispatchedAt: task.DispatchedAt,
 		TaskID:       task.TaskID,
 		AgentURL:     task.AgentURL,
+		RouteReason:  task.RouteReason,
 		Attempts:     task.Attempts,
 		LastError:    task.LastError,
 		Source:       task.Source,
 		SourceJob:    task.SourceJob,
+		CallbackURL:  task.CallbackURL,
+
+		ScheduledAfter: task.ScheduledAfter,
+		ExpiresAt:      task.ExpiresAt,
+		RunAt:          task.RunAt,
+		ParentQueueID:  task.ParentQueueID,
+		ParentTaskID:   task.ParentTaskID,
+		RequestID:      task.RequestID,
+
+		History: h.queue.historySnapshot(task),
 	}
 
 	if task.State.IsPending() {
@@ -187,6 +314,60 @@ type QueueCancelResponse struct {
 	WasDispatched bool   `json:"was_dispatched"`
 	AgentURL      string `json:"agent_url,omitempty"`
 	TaskID        string `json:"task_id,omitempty"`
+
+	History []DispatchEvent `json:"history"` // Dispatch audit trail, ending with the cancel
+
+	Agent *AgentCancelResult `json:"agent,omitempty"` // What the agent did, for dispatched tasks
+}
+
+// AgentCancelResult reports how an agent answered the cancellation of a task
+// dispatched to it
+type AgentCancelResult struct {
+	StatusCode int    `json:"status_code,omitempty"` // Agent's answer to POST /task/{id}/cancel; 0 if unreachable
+	Message    string `json:"message,omitempty"`     // Agent's message, or why it couldn't be reached
+	State      string `json:"state,omitempty"`       // Task state last reported by the agent
+	Stopped    bool   `json:"stopped"`               // The agent reported the task finished running
+}
+
+const (
+	cancelVerifyTimeout  = 5 * time.Second        // How long to wait for an agent to stop a cancelled task
+	cancelVerifyInterval = 200 * time.Millisecond // How often the agent is asked meanwhile
+)
+
+// HandleQueueHold keeps a pending task from being dispatched until it is
+// released
+func (h *QueueHandlers) HandleQueueHold(w http.ResponseWriter, r *http.Request, queueID string) {
+	task, err := h.queue.Hold(queueID)
+	h.writeHoldResult(w, task, err)
+}
+
+// HandleQueueRelease lets a held task be dispatched again
+func (h *QueueHandlers) HandleQueueRelease(w http.ResponseWriter, r *http.Request, queueID string) {
+	task, err := h.queue.Release(queueID)
+	h.writeHoldResult(w, task, err)
+}
+
+func (h *QueueHandlers) writeHoldResult(w http.ResponseWriter, task *QueuedTask, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrTaskNotFound):
+		writeError(w, http.StatusNotFound, api.ErrorNotFound, "Queued task not found")
+		return
+	case errors.Is(err, ErrNotPending):
+		writeError(w, http.StatusConflict, api.ErrorTaskNotPending, err.Error())
+		return
+	case errors.Is(err, ErrNotHeld):
+		writeError(w, http.StatusConflict, api.ErrorTaskNotHeld, err.Error())
+		return
+	default:
+		writeError(w, http.StatusInternalServerError, api.ErrorQueueError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, QueueSubmitResponse{
+		QueueID:  task.QueueID,
+		Position: h.queue.Position(task.QueueID),
+		State:    string(task.State),
+	})
 }
 
 // HandleQueueCancel cancels a queued task
@@ -201,18 +382,20 @@ func (h *QueueHandlers) HandleQueueCancel(w http.ResponseWriter, r *http.Request
 	agentURL := task.AgentURL
 	taskID := task.TaskID
 
-	// If task was dispatched, try to cancel on agent
+	// If task was dispatched, cancel it on the agent and wait for it to stop
+	event := DispatchEvent{Event: DispatchEventCancel, Detail: "removed before dispatch"}
+	var agentResult *AgentCancelResult
 	if wasDispatched && agentURL != "" && taskID != "" {
-		client := createHTTPClient(10 * time.Second)
-		req, _ := http.NewRequest(http.MethodPost, agentURL+"/task/"+taskID+"/cancel", nil)
-		resp, err := client.Do(req)
-		if err == nil {
-			resp.Body.Close()
-		}
+		event.AgentURL, event.TaskID = agentURL, taskID
+		agentResult = h.cancelOnAgent(agentURL, taskID)
+		event.Detail = agentResult.summary()
 	}
+	h.queue.RecordEvent(task, event)
 
 	// Remove from queue
-	h.queue.Cancel(queueID)
+	if cancelled, ok := h.queue.Cancel(queueID); ok {
+		h.events.Publish(Event{Type: EventTaskFinished, Task: cancelled, State: string(TaskStateCancelled)})
+	}
 
 	writeJSON(w, http.StatusOK, QueueCancelResponse{
 		QueueID:       queueID,
@@ -220,9 +403,125 @@ func (h *QueueHandlers) HandleQueueCancel(w http.ResponseWriter, r *http.Request
 		WasDispatched: wasDispatched,
 		AgentURL:      agentURL,
 		TaskID:        taskID,
+
+		History: h.queue.historySnapshot(task),
+		Agent:   agentResult,
 	})
 }
 
+// cancelOnAgent asks the agent to cancel a task, then polls it until the
+// task has finished running. The agent reports a cancelled task's state at
+// once, so the task only counts as stopped once it has a completion time.
+func (h *QueueHandlers) cancelOnAgent(agentURL, taskID string) *AgentCancelResult {
+	result := &AgentCancelResult{}
+	client := createHTTPClient(10*time.Second, h.authToken)
+	taskURL := agentURL + "/task/" + url.PathEscape(taskID)
+
+	resp, err := client.Post(taskURL+"/cancel", "application/json", nil)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	var answer struct {
+		State      string `json:"state"`
+		FinalState string `json:"final_state"` // Set when the task had already finished
+		Message    string `json:"message"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&answer)
+	resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+	result.Message = answer.Message
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		result.State = answer.State
+	case http.StatusConflict:
+		result.State = answer.FinalState
+		result.Stopped = true
+		return result
+	default:
+		return result
+	}
+
+	deadline := time.Now().Add(cancelVerifyTimeout)
+	for {
+		var status struct {
+			State       string `json:"state"`
+			CompletedAt string `json:"completed_at"`
+		}
+		resp, err := client.Get(taskURL)
+		if err == nil {
+			if resp.StatusCode == http.StatusOK {
+				json.NewDecoder(resp.Body).Decode(&status)
+			}
+			resp.Body.Close()
+		}
+		if status.State != "" {
+			result.State = status.State
+		}
+		if isTerminalState(status.State) && status.CompletedAt != "" {
+			result.Stopped = true
+			return result
+		}
+		if time.Now().Add(cancelVerifyInterval).After(deadline) {
+			return result
+		}
+		time.Sleep(cancelVerifyInterval)
+	}
+}
+
+// summary describes the result for the task's dispatch history.
+func (r *AgentCancelResult) summary() string {
+	switch {
+	case r.StatusCode == 0:
+		return "cancelling on agent: " + r.Message
+	case r.StatusCode == http.StatusConflict:
+		return fmt.Sprintf("agent had already finished the task (%s)", r.State)
+	case r.Stopped:
+		return fmt.Sprintf("agent stopped the task (%s)", r.State)
+	case r.StatusCode == http.StatusOK:
+		return fmt.Sprintf("agent accepted cancel but the task was still running after %s", cancelVerifyTimeout)
+	default:
+		return fmt.Sprintf("agent answered cancel with status %d: %s", r.StatusCode, r.Message)
+	}
+}
+
+// sessionAgentUnavailable returns an error message if sessionID belongs to a
+// known session whose agent is no longer discovered. Follow-up tasks must run
+// on the session's agent, so queueing them would only wait forever.
+func (h *QueueHandlers) sessionAgentUnavailable(sessionID string) string {
+	if sessionID == "" {
+		return ""
+	}
+	session, ok := h.sessionStore.Get(sessionID)
+	if !ok || session.AgentURL == "" {
+		return ""
+	}
+	if _, found := h.discovery.GetComponent(session.AgentURL); found {
+		return ""
+	}
+	return sessionAgentGoneMessage(sessionID, session.AgentURL)
+}
+
+// claimSession bumps the seq of the session a task is submitted to, and
+// writes a 409 carrying the current seq if the caller expected an older one.
+// Clients send the seq they last saw so they can confirm with the user
+// before appending to a session that changed underneath them.
+func (h *QueueHandlers) claimSession(w http.ResponseWriter, sessionID string, expected *int) bool {
+	if sessionID == "" {
+		return true
+	}
+	seq, ok := h.sessionStore.ClaimSeq(sessionID, expected)
+	if !ok {
+		writeJSON(w, http.StatusConflict, map[string]any{
+			"error":   api.ErrorSessionChanged,
+			"message": fmt.Sprintf("Session %s has changed (seq %d, expected %d)", sessionID, seq, *expected),
+			"seq":     seq,
+		})
+	}
+	return ok
+}
+
 // HandleTaskSubmitViaQueue routes task submission through the queue
 // This replaces direct agent submission with queue-based submission
 func (h *QueueHandlers) HandleTaskSubmitViaQueue(w http.ResponseWriter, r *http.Request) {
@@ -243,6 +542,18 @@ func (h *QueueHandlers) HandleTaskSubmitViaQueue(w http.ResponseWriter, r *http.
 		writeError(w, http.StatusBadRequest, api.ErrorValidation, "agent_kind must be claude or codex")
 		return
 	}
+	if len(req.Uploads) > 0 {
+		if h.uploads == nil {
+			writeError(w, http.StatusBadRequest, api.ErrorValidation, "uploads are not supported here")
+			return
+		}
+		attachments, err := h.uploads.Attachments(req.Uploads)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, api.ErrorValidation, err.Error())
+			return
+		}
+		req.Attachments = append(req.Attachments, attachments...)
+	}
 
 	// If agent_url is specified and agent is idle, submit directly for backward compatibility
 	// Otherwise, queue the task
@@ -254,13 +565,23 @@ func (h *QueueHandlers) HandleTaskSubmitViaQueue(w http.ResponseWriter, r *http.
 					fmt.Sprintf("Agent kind %q does not match requested %q", agent.AgentKind, req.AgentKind))
 				return
 			}
+			if !h.claimSession(w, req.SessionID, req.ExpectedSeq) {
+				return
+			}
 			// Direct submission to idle agent
 			h.submitDirectly(w, r, req, agent)
 			return
 		}
 	}
 
-	// Queue the task
+	if msg := h.sessionAgentUnavailable(req.SessionID); msg != "" {
+		writeError(w, http.StatusConflict, api.ErrorSessionAgentUnavailable, msg)
+		return
+	}
+	if !h.claimSession(w, req.SessionID, req.ExpectedSeq) {
+		return
+	}
+
 	source := req.Source
 	if source == "" {
 		source = "web"
@@ -275,6 +596,10 @@ func (h *QueueHandlers) HandleTaskSubmitViaQueue(w http.ResponseWriter, r *http.
 		Source:         source,
 		SourceJob:      req.SourceJob,
 		AgentKind:      req.AgentKind,
+		Attachments:    req.Attachments,
+		RunnerOptions:  req.RunnerOptions,
+		SeqClaimed:     req.SessionID != "",
+		RequestID:      api.RequestIDFromContext(r.Context()),
 	}
 
 	task, position, err := h.queue.Add(queueReq)
@@ -300,11 +625,15 @@ func (h *QueueHandlers) HandleTaskSubmitViaQueue(w http.ResponseWriter, r *http.
 // submitDirectly handles direct submission to an idle agent (backward compatible path)
 func (h *QueueHandlers) submitDirectly(w http.ResponseWriter, r *http.Request, req TaskSubmitRequest, agent *ComponentStatus) {
 	// Build agent task request
-	agentReq := buildAgentRequest(req.Prompt, req.Tier, req.TimeoutSeconds, req.SessionID, req.Env)
+	agentReq := buildAgentRequest(req.Prompt, req.Tier, req.TimeoutSeconds, req.SessionID, req.Env, req.RunnerOptions)
+	if len(req.Attachments) > 0 {
+		agentReq["attachments"] = req.Attachments
+	}
+	adaptAgentRequest(agentReq, agent)
 
 	// Forward to agent
 	body, _ := json.Marshal(agentReq)
-	client := createHTTPClient(10 * time.Second)
+	client := api.WithRequestID(createHTTPClient(10*time.Second, h.authToken), api.RequestIDFromContext(r.Context()))
 	resp, err := client.Post(req.AgentURL+"/task", "application/json", bytes.NewReader(body))
 	if err != nil {
 		writeError(w, http.StatusBadGateway, api.ErrorAgentError, "Failed to contact agent: "+err.Error())
@@ -341,6 +670,9 @@ func (h *QueueHandlers) submitDirectly(w http.ResponseWriter, r *http.Request, r
 	if req.SourceJob != "" {
 		opts = append(opts, WithSourceJob(req.SourceJob))
 	}
+	if req.SessionID != "" {
+		opts = append(opts, WithSeqClaimed())
+	}
 	h.sessionStore.AddTask(agentResp.SessionID, req.AgentURL, agentResp.TaskID, "working", req.Prompt, opts...)
 
 	writeJSON(w, http.StatusCreated, TaskSubmitResponse{
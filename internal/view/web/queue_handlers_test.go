@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -64,6 +65,91 @@ func TestQueueHandlerSubmitValidation(t *testing.T) {
 	h.HandleQueueSubmit(rec, req)
 
 	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Callback URLs must be absolute http(s) URLs
+	for _, callback := range []string{"ftp://ci.example.com/hook", "/relative", "https://"} {
+		body = `{"prompt": "Test task", "callback_url": "` + callback + `"}`
+		req = httptest.NewRequest("POST", "/api/queue/task", bytes.NewBufferString(body))
+		rec = httptest.NewRecorder()
+		h.HandleQueueSubmit(rec, req)
+		require.Equal(t, http.StatusBadRequest, rec.Code, callback)
+		require.Contains(t, rec.Body.String(), "callback_url", callback)
+	}
+
+	// At most one deadline, and it must be in the future, after any run_at
+	for _, deadline := range []string{
+		`"expires_after_seconds": -1`,
+		`"expires_after_seconds": 60, "not_after": "2099-01-01T00:00:00Z"`,
+		`"not_after": "2000-01-01T00:00:00Z"`,
+		`"not_after": "2099-01-01T00:00:00Z", "run_at": "2099-01-02T00:00:00Z"`,
+		`"expires_after_seconds": 60, "run_at": "2099-01-01T00:00:00Z"`,
+	} {
+		body = `{"prompt": "Test task", ` + deadline + `}`
+		req = httptest.NewRequest("POST", "/api/queue/task", bytes.NewBufferString(body))
+		rec = httptest.NewRecorder()
+		h.HandleQueueSubmit(rec, req)
+		require.Equal(t, http.StatusBadRequest, rec.Code, deadline)
+	}
+	require.Zero(t, q.Depth())
+}
+
+func TestQueueHandlerTaskStatusExpired(t *testing.T) {
+	t.Parallel()
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	h := NewQueueHandlers(q, NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000}), NewSessionStore())
+
+	task, _, err := q.Add(QueueSubmitRequest{Prompt: "Test task", ExpiresAfterSeconds: 1})
+	require.NoError(t, err)
+	q.ExpireDue(task.CreatedAt.Add(time.Minute))
+
+	// The task has left the queue but is still reported, as expired
+	rec := httptest.NewRecorder()
+	h.HandleQueueTaskStatus(rec, httptest.NewRequest("GET", "/api/queue/"+task.QueueID, nil), task.QueueID)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var detail QueuedTaskDetail
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &detail))
+	require.Equal(t, "expired", detail.State)
+	require.NotNil(t, detail.ExpiresAt)
+
+	rec = httptest.NewRecorder()
+	h.HandleQueueStatus(rec, httptest.NewRequest("GET", "/api/queue", nil))
+	var status QueueStatusResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	require.Zero(t, status.Depth)
+	require.Len(t, status.Tasks, 1)
+	require.Equal(t, "expired", status.Tasks[0].State)
+}
+
+func TestQueueHandlerSubmitIdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	h := NewQueueHandlers(q, NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000}), NewSessionStore())
+
+	submit := func(body string) (int, QueueSubmitResponse) {
+		rec := httptest.NewRecorder()
+		h.HandleQueueSubmit(rec, httptest.NewRequest("POST", "/api/queue/task", bytes.NewBufferString(body)))
+		var resp QueueSubmitResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	code, first := submit(`{"prompt": "Test task", "idempotency_key": "ci-run-17"}`)
+	require.Equal(t, http.StatusCreated, code)
+	require.False(t, first.Duplicate)
+
+	code, again := submit(`{"prompt": "Test task", "idempotency_key": "ci-run-17"}`)
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, again.Duplicate)
+	require.Equal(t, first.QueueID, again.QueueID)
+	require.Equal(t, 1, again.Position)
+	require.Equal(t, 1, q.Depth())
+
+	code, _ = submit(`{"prompt": "Test task", "idempotency_key": "` + strings.Repeat("k", maxIdempotencyKeyLen+1) + `"}`)
+	require.Equal(t, http.StatusBadRequest, code)
 }
 
 func TestQueueHandlerSubmitQueueFull(t *testing.T) {
@@ -136,6 +222,12 @@ func TestQueueHandlerTaskStatus(t *testing.T) {
 
 	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
 	h := NewQueueHandlers(q, d, NewSessionStore())
+	var finished []string
+	events := NewEventBus()
+	events.Subscribe(OnTaskFinished(func(task *QueuedTask, state string) {
+		finished = append(finished, task.QueueID+" "+state)
+	}))
+	h.SetEventBus(events)
 
 	// Add a task
 	task, _, _ := q.Add(QueueSubmitRequest{Prompt: "Test task"})
@@ -186,6 +278,12 @@ func TestQueueHandlerCancel(t *testing.T) {
 
 	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
 	h := NewQueueHandlers(q, d, NewSessionStore())
+	var finished []string
+	events := NewEventBus()
+	events.Subscribe(OnTaskFinished(func(task *QueuedTask, state string) {
+		finished = append(finished, task.QueueID+" "+state)
+	}))
+	h.SetEventBus(events)
 
 	// Add a task
 	task, _, _ := q.Add(QueueSubmitRequest{Prompt: "Test task"})
@@ -206,6 +304,7 @@ func TestQueueHandlerCancel(t *testing.T) {
 
 	// Verify task was removed
 	require.Nil(t, q.Get(task.QueueID))
+	require.Equal(t, []string{task.QueueID + " cancelled"}, finished)
 }
 
 func TestQueueHandlerCancelNotFound(t *testing.T) {
@@ -228,6 +327,55 @@ func TestQueueHandlerCancelNotFound(t *testing.T) {
 	require.Equal(t, http.StatusNotFound, rec.Code)
 }
 
+func TestQueueHandlerCancelDispatchedAgentAnswers(t *testing.T) {
+	t.Parallel()
+
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/task/task-done/cancel":
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"message": "Task task-done has already completed", "final_state": "completed"})
+		case "/task/task-gone/cancel":
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"message": "Task task-gone not found"})
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	t.Cleanup(agent.Close)
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	h := NewQueueHandlers(q, NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000}), NewSessionStore())
+
+	cancel := func(taskID string) QueueCancelResponse {
+		task, _, err := q.Add(QueueSubmitRequest{Prompt: "Test task"})
+		require.NoError(t, err)
+		q.SetDispatched(task, agent.URL, taskID, "", "idle agent")
+		rec := httptest.NewRecorder()
+		h.HandleQueueCancel(rec, httptest.NewRequest("POST", "/api/queue/"+task.QueueID+"/cancel", nil), task.QueueID)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var resp QueueCancelResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.True(t, resp.WasDispatched)
+		return resp
+	}
+
+	resp := cancel("task-done")
+	require.Equal(t, &AgentCancelResult{
+		StatusCode: http.StatusConflict,
+		Message:    "Task task-done has already completed",
+		State:      "completed",
+		Stopped:    true,
+	}, resp.Agent)
+	require.Equal(t, "agent had already finished the task (completed)", resp.History[len(resp.History)-1].Detail)
+
+	resp = cancel("task-gone")
+	require.Equal(t, http.StatusNotFound, resp.Agent.StatusCode)
+	require.False(t, resp.Agent.Stopped)
+	require.Equal(t, "agent answered cancel with status 404: Task task-gone not found", resp.History[len(resp.History)-1].Detail)
+}
+
 func TestQueueHandlerTaskSubmitViaQueueDirect(t *testing.T) {
 	t.Parallel()
 
@@ -467,3 +615,152 @@ func TestQueueTaskBWhileTaskARunning(t *testing.T) {
 	require.Equal(t, agent.URL, task.AgentURL)
 	require.Equal(t, taskBID, task.TaskID)
 }
+
+func TestQueueHandlerSubmitSessionAgentGone(t *testing.T) {
+	t.Parallel()
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	ss := NewSessionStore()
+	ss.AddTask("session-1", "https://localhost:9001", "task-1", "completed", "first")
+	h := NewQueueHandlers(q, d, ss)
+
+	for _, submit := range []http.HandlerFunc{h.HandleQueueSubmit, h.HandleTaskSubmitViaQueue} {
+		body := `{"prompt": "follow up", "session_id": "session-1"}`
+		req := httptest.NewRequest("POST", "/api/queue/task", bytes.NewBufferString(body))
+		rec := httptest.NewRecorder()
+		submit(rec, req)
+
+		require.Equal(t, http.StatusConflict, rec.Code)
+		require.Contains(t, rec.Body.String(), "session_agent_unavailable")
+		require.Contains(t, rec.Body.String(), "https://localhost:9001")
+	}
+	require.Equal(t, 0, q.Depth())
+}
+
+func TestQueueForwardsRunnerOptions(t *testing.T) {
+	t.Parallel()
+
+	var received map[string]any
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"task_id": "task-1", "session_id": "session-1"})
+	}))
+	defer agent.Close()
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	d.components[agent.URL] = &ComponentStatus{URL: agent.URL, Type: "agent", State: "idle"}
+	d.mu.Unlock()
+	ss := NewSessionStore()
+	h := NewQueueHandlers(q, d, ss)
+
+	body := `{"prompt": "review", "max_turns": 5, "permission_mode": "plan", "allowed_tools": ["Read", "Grep"]}`
+	req := httptest.NewRequest("POST", "/api/queue/task", bytes.NewBufferString(body))
+	rec := httptest.NewRecorder()
+	h.HandleQueueSubmit(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	dispatcher := NewDispatcher(q, d, ss)
+	dispatcher.trackInterval = time.Hour // Completion tracking is not under test
+	dispatcher.dispatchNext()
+
+	require.Equal(t, float64(5), received["max_turns"])
+	require.Equal(t, "plan", received["permission_mode"])
+	require.Equal(t, []any{"Read", "Grep"}, received["allowed_tools"])
+}
+
+func TestQueueHandlerSubmitExpectedSeq(t *testing.T) {
+	t.Parallel()
+
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"task_id": "task-2", "session_id": "session-1"})
+	}))
+	defer agent.Close()
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	d.components[agent.URL] = &ComponentStatus{URL: agent.URL, Type: "agent", State: "idle"}
+	d.mu.Unlock()
+	ss := NewSessionStore()
+	ss.AddTask("session-1", agent.URL, "task-1", "completed", "first")
+	h := NewQueueHandlers(q, d, ss)
+
+	submit := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/queue/task", bytes.NewBufferString(body))
+		rec := httptest.NewRecorder()
+		h.HandleQueueSubmit(rec, req)
+		return rec
+	}
+
+	rec := submit(`{"prompt": "follow up", "session_id": "session-1", "expected_seq": 0}`)
+	require.Equal(t, http.StatusConflict, rec.Code)
+	var conflict map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &conflict))
+	require.Equal(t, "session_changed", conflict["error"])
+	require.Equal(t, float64(1), conflict["seq"])
+	require.Equal(t, 0, q.Depth())
+
+	rec = submit(`{"prompt": "follow up", "session_id": "session-1", "expected_seq": 1}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	session, _ := ss.Get("session-1")
+	require.Equal(t, 2, session.Seq, "a queued task counts as soon as it is accepted")
+
+	// The seq the first client saw is now stale for anyone else
+	rec = submit(`{"prompt": "racing", "session_id": "session-1", "expected_seq": 1}`)
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	dispatcher := NewDispatcher(q, d, ss)
+	dispatcher.trackInterval = time.Hour // Completion tracking is not under test
+	dispatcher.dispatchNext()
+
+	session, _ = ss.Get("session-1")
+	require.Len(t, session.Tasks, 2)
+	require.Equal(t, 2, session.Seq, "dispatch must not count the task again")
+}
+
+func TestQueueHandlerHoldRelease(t *testing.T) {
+	t.Parallel()
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	h := NewQueueHandlers(q, d, NewSessionStore())
+
+	req := httptest.NewRequest("POST", "/api/queue/task", bytes.NewBufferString(`{"prompt": "draft", "hold": true}`))
+	rec := httptest.NewRecorder()
+	h.HandleQueueSubmit(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var resp QueueSubmitResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, "held", resp.State)
+
+	rec = httptest.NewRecorder()
+	h.HandleQueueHold(rec, httptest.NewRequest("POST", "/", nil), resp.QueueID)
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.Contains(t, rec.Body.String(), "task_not_pending")
+
+	rec = httptest.NewRecorder()
+	h.HandleQueueRelease(rec, httptest.NewRequest("POST", "/", nil), resp.QueueID)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, "pending", resp.State)
+	require.Equal(t, 1, resp.Position)
+
+	rec = httptest.NewRecorder()
+	h.HandleQueueRelease(rec, httptest.NewRequest("POST", "/", nil), resp.QueueID)
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.Contains(t, rec.Body.String(), "task_not_held")
+
+	rec = httptest.NewRecorder()
+	h.HandleQueueHold(rec, httptest.NewRequest("POST", "/", nil), "missing")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,71 @@
+package web
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// maxDispatchEvents bounds a queue entry's dispatch history; the oldest
+// events are dropped first.
+const maxDispatchEvents = 50
+
+// Dispatch history events
+const (
+	DispatchEventDispatched = "dispatched"      // Agent accepted the task
+	DispatchEventBusy       = "agent_busy"      // Agent refused with 409; requeued at the back
+	DispatchEventError      = "dispatch_failed" // Submission failed; retried until max attempts
+	DispatchEventLost       = "lost"            // Agent unreachable or forgot the task
+	DispatchEventRequeued   = "requeued"        // Dispatched when the director restarted
+	DispatchEventFinished   = "finished"        // Agent reported a terminal state
+	DispatchEventFailed     = "failed"          // The queue gave up on the task
+	DispatchEventCancel     = "cancel"          // Cancelled through the API
+	DispatchEventExpired    = "expired"         // Not dispatched before its deadline
+	DispatchEventHeld       = "held"            // Kept from dispatch until released
+	DispatchEventReleased   = "released"        // Released from hold
+	DispatchEventAdapted    = "adapted"         // Fields the agent doesn't support were left out
+)
+
+// DispatchEvent is one entry in a queued task's dispatch history.
+type DispatchEvent struct {
+	At       time.Time `json:"at"`
+	Event    string    `json:"event"`
+	AgentURL string    `json:"agent_url,omitempty"`
+	TaskID   string    `json:"task_id,omitempty"`
+	Attempt  int       `json:"attempt,omitempty"` // Attempt count after the event, for failures
+	Detail   string    `json:"detail,omitempty"`  // Route reason, error, agent response or final state
+}
+
+// RecordEvent appends an event to a task's dispatch history, saving it if
+// the task is still queued.
+func (q *WorkQueue) RecordEvent(task *QueuedTask, event DispatchEvent) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	appendEvent(task, event)
+	if q.byID[task.QueueID] != task {
+		return
+	}
+	if err := q.save(task); err != nil {
+		fmt.Fprintf(os.Stderr, "queue: failed to save task %s: %v\n", task.QueueID, err)
+	}
+}
+
+// appendEvent adds an event to a task's history. Caller holds q.mu, or owns
+// the task.
+func appendEvent(task *QueuedTask, event DispatchEvent) {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+	task.History = append(task.History, event)
+	if n := len(task.History) - maxDispatchEvents; n > 0 {
+		task.History = append([]DispatchEvent(nil), task.History[n:]...)
+	}
+}
+
+// historySnapshot copies a task's dispatch history for a response.
+func (q *WorkQueue) historySnapshot(task *QueuedTask) []DispatchEvent {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return append([]DispatchEvent(nil), task.History...)
+}
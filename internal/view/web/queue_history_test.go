@@ -0,0 +1,113 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatchHistory(t *testing.T) {
+	t.Parallel()
+
+	var submits atomic.Int32
+	var cancelled atomic.Bool
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/task":
+			if submits.Add(1) == 1 {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{"task_id": "task-1", "session_id": "session-1"})
+		case r.URL.Path == "/task/task-1/cancel":
+			cancelled.Store(true)
+			json.NewEncoder(w).Encode(map[string]string{"task_id": "task-1", "state": "cancelled"})
+		case cancelled.Load():
+			json.NewEncoder(w).Encode(map[string]string{"state": "cancelled", "completed_at": "2026-01-02T03:04:05Z"})
+		default:
+			json.NewEncoder(w).Encode(map[string]string{"state": "working"})
+		}
+	}))
+	t.Cleanup(agent.Close)
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	d.components[agent.URL] = &ComponentStatus{URL: agent.URL, Type: "agent", State: "idle"}
+	d.mu.Unlock()
+	dispatcher := NewDispatcher(q, d, NewSessionStore())
+
+	task, _, err := q.Add(QueueSubmitRequest{Prompt: "audit me"})
+	require.NoError(t, err)
+	dispatcher.dispatchNext() // Busy
+	d.mu.Lock()
+	d.components[agent.URL] = &ComponentStatus{URL: agent.URL, Type: "agent", State: "idle"} // Polled idle again
+	d.mu.Unlock()
+	dispatcher.dispatchNext() // Accepted
+
+	h := NewQueueHandlers(q, d, NewSessionStore())
+	rec := httptest.NewRecorder()
+	h.HandleQueueTaskStatus(rec, httptest.NewRequest("GET", "/api/queue/"+task.QueueID, nil), task.QueueID)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var detail QueuedTaskDetail
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &detail))
+	require.Len(t, detail.History, 2)
+	require.Equal(t, DispatchEventBusy, detail.History[0].Event)
+	require.Equal(t, agent.URL, detail.History[0].AgentURL)
+	require.Zero(t, detail.History[0].Attempt, "busy refusals aren't attempts")
+	require.Equal(t, DispatchEventDispatched, detail.History[1].Event)
+	require.Equal(t, "task-1", detail.History[1].TaskID)
+	require.NotEmpty(t, detail.History[1].Detail, "the route reason")
+
+	rec = httptest.NewRecorder()
+	h.HandleQueueCancel(rec, httptest.NewRequest("POST", "/api/queue/"+task.QueueID+"/cancel", nil), task.QueueID)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var cancelResp QueueCancelResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &cancelResp))
+	require.Equal(t, &AgentCancelResult{StatusCode: http.StatusOK, State: "cancelled", Stopped: true}, cancelResp.Agent)
+	require.Len(t, cancelResp.History, 3)
+	require.Equal(t, DispatchEvent{
+		At:       cancelResp.History[2].At,
+		Event:    DispatchEventCancel,
+		AgentURL: agent.URL,
+		TaskID:   "task-1",
+		Detail:   "agent stopped the task (cancelled)",
+	}, cancelResp.History[2])
+}
+
+func TestDispatchHistorySurvivesRestart(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	q, err := NewWorkQueue(QueueConfig{Dir: dir})
+	require.NoError(t, err)
+	task, _, err := q.Add(QueueSubmitRequest{Prompt: "interrupted"})
+	require.NoError(t, err)
+	q.SetDispatched(task, "https://agent:9000", "task-1", "", "idle agent")
+	q.RecordEvent(task, DispatchEvent{Event: DispatchEventDispatched, AgentURL: "https://agent:9000", TaskID: "task-1"})
+
+	reloaded, err := NewWorkQueue(QueueConfig{Dir: dir})
+	require.NoError(t, err)
+	history := reloaded.Get(task.QueueID).History
+	require.Len(t, history, 2)
+	require.Equal(t, DispatchEventRequeued, history[1].Event)
+	require.Equal(t, "https://agent:9000", history[1].AgentURL)
+	require.Equal(t, "task-1", history[1].TaskID)
+}
+
+func TestDispatchHistoryIsBounded(t *testing.T) {
+	t.Parallel()
+
+	task := &QueuedTask{}
+	for i := range maxDispatchEvents + 10 {
+		appendEvent(task, DispatchEvent{Event: DispatchEventBusy, Attempt: i})
+	}
+	require.Len(t, task.History, maxDispatchEvents)
+	require.Equal(t, 10, task.History[0].Attempt)
+}
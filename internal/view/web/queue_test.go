@@ -1,6 +1,7 @@
 package web
 
 import (
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -100,12 +101,13 @@ func TestQueueSetDispatched(t *testing.T) {
 
 	task, _, _ := q.Add(QueueSubmitRequest{Prompt: "test"})
 
-	q.SetDispatched(task, "http://agent:9000", "task-123", "session-456")
+	q.SetDispatched(task, "http://agent:9000", "task-123", "session-456", "idle claude agent configures tier standard")
 
 	require.Equal(t, TaskStateWorking, task.State)
 	require.Equal(t, "http://agent:9000", task.AgentURL)
 	require.Equal(t, "task-123", task.TaskID)
 	require.Equal(t, "session-456", task.SessionID)
+	require.Equal(t, "idle claude agent configures tier standard", task.RouteReason)
 	require.NotNil(t, task.DispatchedAt)
 }
 
@@ -172,7 +174,7 @@ func TestQueueDepthOnlyCountsPending(t *testing.T) {
 	require.Equal(t, 2, q.Depth())
 
 	// Mark one as dispatched
-	q.SetDispatched(task, "http://agent:9000", "task-1", "")
+	q.SetDispatched(task, "http://agent:9000", "task-1", "", "")
 
 	require.Equal(t, 1, q.Depth())
 	require.Equal(t, 1, q.DispatchedCount())
@@ -209,3 +211,146 @@ func TestQueueSourceTracking(t *testing.T) {
 	require.Equal(t, "scheduler", task.Source)
 	require.Equal(t, "nightly-job", task.SourceJob)
 }
+
+func TestQueueExpireDue(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	q, err := NewWorkQueue(QueueConfig{Dir: dir})
+	require.NoError(t, err)
+
+	short, _, err := q.Add(QueueSubmitRequest{Prompt: "short", ExpiresAfterSeconds: 60})
+	require.NoError(t, err)
+	notAfter := short.CreatedAt.Add(time.Hour)
+	long, _, err := q.Add(QueueSubmitRequest{Prompt: "long", NotAfter: &notAfter})
+	require.NoError(t, err)
+	_, _, err = q.Add(QueueSubmitRequest{Prompt: "open-ended"})
+	require.NoError(t, err)
+	require.Equal(t, notAfter, *long.ExpiresAt)
+
+	require.Empty(t, q.ExpireDue(short.CreatedAt.Add(30*time.Second)))
+
+	expired := q.ExpireDue(short.CreatedAt.Add(2 * time.Minute))
+	require.Len(t, expired, 1)
+	require.Equal(t, short.QueueID, expired[0].QueueID)
+	require.Equal(t, TaskStateExpired, short.State)
+	require.Contains(t, short.LastError, "expired at")
+	require.Equal(t, 2, q.Depth())
+	require.Nil(t, q.Get(short.QueueID))
+	require.Same(t, short, q.Expired(short.QueueID))
+	require.NoFileExists(t, filepath.Join(dir, dirPending, short.QueueID+".json"))
+
+	// Expired tasks stay visible for a while, then drop out
+	later := short.CreatedAt.Add(2 * time.Hour)
+	require.Len(t, q.ExpireDue(later), 1)
+	require.Len(t, q.RecentlyExpired(), 1)
+	require.Nil(t, q.Expired(short.QueueID))
+	require.Equal(t, long.QueueID, q.RecentlyExpired()[0].QueueID)
+}
+
+func TestQueueIdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	q, err := NewWorkQueue(QueueConfig{Dir: dir, MaxSize: 1})
+	require.NoError(t, err)
+
+	first, pos, err := q.Add(QueueSubmitRequest{Prompt: "nightly", IdempotencyKey: "job@02:00"})
+	require.NoError(t, err)
+	require.Equal(t, 1, pos)
+
+	// A repeat returns the original entry, even when the queue is full
+	again, pos, err := q.Add(QueueSubmitRequest{Prompt: "nightly", IdempotencyKey: "job@02:00"})
+	require.ErrorIs(t, err, ErrDuplicate)
+	require.Same(t, first, again)
+	require.Equal(t, 1, pos)
+	require.Equal(t, 1, q.Depth())
+
+	// Keys outlive the task's time in the queue
+	q.Remove(first)
+	again, pos, err = q.Add(QueueSubmitRequest{Prompt: "nightly", IdempotencyKey: "job@02:00"})
+	require.ErrorIs(t, err, ErrDuplicate)
+	require.Same(t, first, again)
+	require.Zero(t, pos)
+
+	// Keys of queued tasks survive a restart
+	second, _, err := q.Add(QueueSubmitRequest{Prompt: "nightly", IdempotencyKey: "job@03:00"})
+	require.NoError(t, err)
+	reloaded, err := NewWorkQueue(QueueConfig{Dir: dir, MaxSize: 1})
+	require.NoError(t, err)
+	again, _, err = reloaded.Add(QueueSubmitRequest{Prompt: "nightly", IdempotencyKey: "job@03:00"})
+	require.ErrorIs(t, err, ErrDuplicate)
+	require.Equal(t, second.QueueID, again.QueueID)
+}
+
+func TestQueueIdempotencyKeyExpires(t *testing.T) {
+	t.Parallel()
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir(), IdempotencyTTL: 10 * time.Millisecond})
+	require.NoError(t, err)
+
+	first, _, err := q.Add(QueueSubmitRequest{Prompt: "test", IdempotencyKey: "k"})
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	second, _, err := q.Add(QueueSubmitRequest{Prompt: "test", IdempotencyKey: "k"})
+	require.NoError(t, err)
+	require.NotEqual(t, first.QueueID, second.QueueID)
+}
+
+func TestQueueHoldRelease(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	q, err := NewWorkQueue(QueueConfig{Dir: dir, MaxSize: 3})
+	require.NoError(t, err)
+
+	first, _, err := q.Add(QueueSubmitRequest{Prompt: "first"})
+	require.NoError(t, err)
+	drafted, position, err := q.Add(QueueSubmitRequest{Prompt: "drafted", Hold: true})
+	require.NoError(t, err)
+	require.Equal(t, TaskStateHeld, drafted.State)
+	require.Zero(t, position)
+
+	// Held tasks are never handed to the dispatcher, but take up room
+	require.Equal(t, []*QueuedTask{first}, q.Pending())
+	require.Equal(t, 1, q.Depth())
+	_, _, err = q.Add(QueueSubmitRequest{Prompt: "third"})
+	require.NoError(t, err)
+	_, _, err = q.Add(QueueSubmitRequest{Prompt: "fourth"})
+	require.ErrorIs(t, err, ErrQueueFull)
+
+	_, err = q.Hold(drafted.QueueID)
+	require.ErrorIs(t, err, ErrNotPending)
+	_, err = q.Release(first.QueueID)
+	require.ErrorIs(t, err, ErrNotHeld)
+	_, err = q.Hold("missing")
+	require.ErrorIs(t, err, ErrTaskNotFound)
+
+	_, err = q.Hold(first.QueueID)
+	require.NoError(t, err)
+	require.Equal(t, TaskStateHeld, first.State)
+
+	// Held state survives a restart
+	q2, err := NewWorkQueue(QueueConfig{Dir: dir, MaxSize: 3})
+	require.NoError(t, err)
+	require.Len(t, q2.Pending(), 1)
+	require.Equal(t, TaskStateHeld, q2.Get(drafted.QueueID).State)
+
+	// Released tasks go back to their original place in the queue
+	released, err := q.Release(drafted.QueueID)
+	require.NoError(t, err)
+	require.Equal(t, TaskStatePending, released.State)
+	require.Equal(t, 1, q.Position(drafted.QueueID))
+	require.Equal(t, DispatchEventReleased, drafted.History[len(drafted.History)-1].Event)
+
+	// Held tasks still expire at their deadline
+	deadline := time.Now().Add(time.Minute)
+	expiring, _, err := q2.Add(QueueSubmitRequest{Prompt: "late", NotAfter: &deadline, Hold: true})
+	require.ErrorIs(t, err, ErrQueueFull)
+	require.Nil(t, expiring)
+	q2.Cancel(drafted.QueueID)
+	expiring, _, err = q2.Add(QueueSubmitRequest{Prompt: "late", NotAfter: &deadline, Hold: true})
+	require.NoError(t, err)
+	require.Len(t, q2.ExpireDue(deadline.Add(time.Second)), 1)
+	require.Equal(t, TaskStateExpired, expiring.State)
+}
@@ -0,0 +1,419 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/scheduler"
+)
+
+// Recurring task limits
+const (
+	minRecurringInterval   = time.Minute
+	maxRecurringTasks      = 100
+	recurringCheckInterval = 15 * time.Second
+)
+
+// SourceRecurring is the source of tasks queued by recurring tasks.
+const SourceRecurring = "recurring"
+
+// Recurring task errors
+var (
+	errRecurringNotFound = errors.New("recurring task not found")
+	errTooManyRecurring  = fmt.Errorf("at most %d recurring tasks", maxRecurringTasks)
+)
+
+// RecurringRequest is the body of POST /api/recurring. Exactly one of
+// interval_seconds and cron sets the schedule.
+type RecurringRequest struct {
+	Name            string `json:"name"`
+	Prompt          string `json:"prompt"`
+	IntervalSeconds int    `json:"interval_seconds,omitempty"`
+	Cron            string `json:"cron,omitempty"` // 5-field cron, in the director's local time
+	Tier            string `json:"tier,omitempty"`
+	AgentKind       string `json:"agent_kind,omitempty"`
+	TimeoutSeconds  int    `json:"timeout_seconds,omitempty"`
+}
+
+// RecurringTask is a saved task the director queues on a schedule, for
+// users who run the web view without ag-scheduler.
+type RecurringTask struct {
+	ID string `json:"id"`
+	RecurringRequest
+	Paused    bool      `json:"paused,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	NextRun     *time.Time `json:"next_run,omitempty"` // Unset while paused
+	LastRun     *time.Time `json:"last_run,omitempty"`
+	LastQueueID string     `json:"last_queue_id,omitempty"`
+	LastError   string     `json:"last_error,omitempty"` // Why the last run was skipped or not queued
+	Runs        int        `json:"runs"`
+}
+
+// validate checks a recurring task definition.
+func (req RecurringRequest) validate() error {
+	switch {
+	case req.Name == "":
+		return errors.New("name is required")
+	case req.Prompt == "":
+		return errors.New("prompt is required")
+	case (req.IntervalSeconds > 0) == (req.Cron != ""):
+		return errors.New("set one of interval_seconds or cron")
+	case req.IntervalSeconds > 0 && time.Duration(req.IntervalSeconds)*time.Second < minRecurringInterval:
+		return fmt.Errorf("interval_seconds must be at least %d", int(minRecurringInterval.Seconds()))
+	case req.Tier != "" && !api.IsValidTier(req.Tier):
+		return errors.New("tier must be fast, standard, or heavy")
+	case req.AgentKind != "" && !api.IsValidAgentKind(req.AgentKind):
+		return errors.New("agent_kind must be claude or codex")
+	case req.TimeoutSeconds < 0:
+		return errors.New("timeout_seconds must not be negative")
+	}
+	if req.Cron != "" {
+		if _, err := scheduler.ParseCron(req.Cron); err != nil {
+			return fmt.Errorf("cron: %w", err)
+		}
+	}
+	return nil
+}
+
+// next returns the first scheduled run after t.
+func (rt *RecurringTask) next(t time.Time) time.Time {
+	if rt.IntervalSeconds > 0 {
+		return t.Add(time.Duration(rt.IntervalSeconds) * time.Second)
+	}
+	cron, err := scheduler.ParseCron(rt.Cron)
+	if err != nil {
+		return time.Time{} // Validated on creation
+	}
+	return cron.Next(t)
+}
+
+// Recurring queues saved tasks on an interval or cron schedule. Tasks are
+// kept in a JSON file so they survive restarts; a run missed while the
+// director was down happens once when it starts. A run is skipped while
+// the previous one is still in the queue.
+type Recurring struct {
+	mu    sync.Mutex
+	queue *WorkQueue
+	path  string
+	tasks map[string]*RecurringTask
+	now   func() time.Time
+}
+
+// NewRecurring creates a recurring task runner queueing on queue, loading
+// saved tasks from path.
+func NewRecurring(queue *WorkQueue, path string) (*Recurring, error) {
+	r := &Recurring{
+		queue: queue,
+		path:  path,
+		tasks: make(map[string]*RecurringTask),
+		now:   time.Now,
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading recurring tasks: %w", err)
+	}
+	if err == nil {
+		var tasks []*RecurringTask
+		if err := json.Unmarshal(data, &tasks); err != nil {
+			return nil, fmt.Errorf("parsing recurring tasks %s: %w", path, err)
+		}
+		for _, rt := range tasks {
+			r.tasks[rt.ID] = rt
+		}
+	}
+	return r, nil
+}
+
+// Start queues due tasks until the context is cancelled.
+func (r *Recurring) Start(ctx context.Context) {
+	ticker := time.NewTicker(recurringCheckInterval)
+	defer ticker.Stop()
+
+	r.runDue()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.runDue()
+		}
+	}
+}
+
+// runDue queues every unpaused task whose next run has come.
+func (r *Recurring) runDue() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	changed := false
+	for _, rt := range r.tasks {
+		if rt.Paused || rt.NextRun == nil || rt.NextRun.After(now) {
+			continue
+		}
+		slot := *rt.NextRun
+		if rt.LastQueueID != "" && r.queue.Get(rt.LastQueueID) != nil {
+			rt.LastError = fmt.Sprintf("skipped the %s run: %s is still in the queue", slot.Format(time.RFC3339), rt.LastQueueID)
+		} else {
+			r.queueUnlocked(rt, now, fmt.Sprintf("recurring:%s@%s", rt.ID, slot.Format(time.RFC3339)))
+		}
+		next := rt.next(now)
+		rt.NextRun = &next
+		changed = true
+	}
+	if changed {
+		r.saveUnlocked()
+	}
+}
+
+// queueUnlocked adds a run of rt to the queue, recording the outcome.
+func (r *Recurring) queueUnlocked(rt *RecurringTask, now time.Time, idempotencyKey string) error {
+	task, _, err := r.queue.Add(QueueSubmitRequest{
+		Prompt:         rt.Prompt,
+		Tier:           rt.Tier,
+		TimeoutSeconds: rt.TimeoutSeconds,
+		AgentKind:      rt.AgentKind,
+		Source:         SourceRecurring,
+		SourceJob:      rt.Name,
+		IdempotencyKey: idempotencyKey,
+	})
+	if err != nil && err != ErrDuplicate {
+		rt.LastError = "queueing: " + err.Error()
+		fmt.Fprintf(os.Stderr, "recurring: %s: %s\n", rt.Name, rt.LastError)
+		return err
+	}
+	rt.Runs++
+	rt.LastRun = &now
+	rt.LastQueueID = task.QueueID
+	rt.LastError = ""
+	fmt.Fprintf(os.Stderr, "recurring: %s queued as %s\n", rt.Name, task.QueueID)
+	return nil
+}
+
+// Create saves a new recurring task, first run at its next scheduled time.
+func (r *Recurring) Create(req RecurringRequest) (*RecurringTask, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.tasks) >= maxRecurringTasks {
+		return nil, errTooManyRecurring
+	}
+	now := r.now()
+	rt := &RecurringTask{
+		ID:               fmt.Sprintf("recurring-%d", time.Now().UnixNano()),
+		RecurringRequest: req,
+		CreatedAt:        now,
+	}
+	next := rt.next(now)
+	rt.NextRun = &next
+	r.tasks[rt.ID] = rt
+	if err := r.saveUnlocked(); err != nil {
+		delete(r.tasks, rt.ID)
+		return nil, err
+	}
+	c := *rt
+	return &c, nil
+}
+
+// Get returns a copy of a recurring task, or nil
+func (r *Recurring) Get(id string) *RecurringTask {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rt, ok := r.tasks[id]
+	if !ok {
+		return nil
+	}
+	c := *rt
+	return &c
+}
+
+// All returns copies of all recurring tasks, oldest first
+func (r *Recurring) All() []*RecurringTask {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make([]*RecurringTask, 0, len(r.tasks))
+	for _, rt := range r.tasks {
+		c := *rt
+		result = append(result, &c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+// Delete removes a recurring task. Runs already queued are left alone.
+func (r *Recurring) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tasks[id]; !ok {
+		return errRecurringNotFound
+	}
+	delete(r.tasks, id)
+	return r.saveUnlocked()
+}
+
+// SetPaused pauses or resumes a recurring task. A resumed task next runs at
+// its first scheduled time from now; runs missed while paused are dropped.
+func (r *Recurring) SetPaused(id string, paused bool) (*RecurringTask, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rt, ok := r.tasks[id]
+	if !ok {
+		return nil, errRecurringNotFound
+	}
+	if rt.Paused != paused {
+		rt.Paused = paused
+		rt.NextRun = nil
+		if !paused {
+			next := rt.next(r.now())
+			rt.NextRun = &next
+		}
+		if err := r.saveUnlocked(); err != nil {
+			return nil, err
+		}
+	}
+	c := *rt
+	return &c, nil
+}
+
+// RunNow queues a run of a recurring task straight away, leaving its
+// schedule as it was.
+func (r *Recurring) RunNow(id string) (*RecurringTask, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rt, ok := r.tasks[id]
+	if !ok {
+		return nil, errRecurringNotFound
+	}
+	if err := r.queueUnlocked(rt, r.now(), ""); err != nil {
+		return nil, err
+	}
+	r.saveUnlocked()
+	c := *rt
+	return &c, nil
+}
+
+// saveUnlocked writes all recurring tasks to disk, replacing the file
+// atomically.
+func (r *Recurring) saveUnlocked() error {
+	tasks := make([]*RecurringTask, 0, len(r.tasks))
+	for _, rt := range r.tasks {
+		tasks = append(tasks, rt)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].CreatedAt.Before(tasks[j].CreatedAt) })
+	data, err := json.MarshalIndent(tasks, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling recurring tasks: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0700); err != nil {
+		return fmt.Errorf("saving recurring tasks: %w", err)
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("saving recurring tasks: %w", err)
+	}
+	if err := os.Rename(tmp, r.path); err != nil {
+		fmt.Fprintf(os.Stderr, "recurring: failed to save %s: %v\n", r.path, err)
+		return fmt.Errorf("saving recurring tasks: %w", err)
+	}
+	return nil
+}
+
+// HandleList handles GET /api/recurring
+func (r *Recurring) HandleList(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"recurring": r.All()})
+}
+
+// HandleCreate handles POST /api/recurring
+func (r *Recurring) HandleCreate(w http.ResponseWriter, req *http.Request) {
+	var body RecurringRequest
+	if !decodeJSON(w, req, &body) {
+		return
+	}
+	if err := body.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, err.Error())
+		return
+	}
+	rt, err := r.Create(body)
+	if err == errTooManyRecurring {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, api.ErrorQueueError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, rt)
+}
+
+// HandleGet handles GET /api/recurring/{id}
+func (r *Recurring) HandleGet(w http.ResponseWriter, req *http.Request, id string) {
+	rt := r.Get(id)
+	if rt == nil {
+		writeError(w, http.StatusNotFound, api.ErrorNotFound, "Recurring task not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, rt)
+}
+
+// HandleDelete handles DELETE /api/recurring/{id}
+func (r *Recurring) HandleDelete(w http.ResponseWriter, req *http.Request, id string) {
+	if err := r.Delete(id); err != nil {
+		writeRecurringError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandlePause handles POST /api/recurring/{id}/pause and /resume
+func (r *Recurring) HandlePause(w http.ResponseWriter, req *http.Request, id string, paused bool) {
+	rt, err := r.SetPaused(id, paused)
+	if err != nil {
+		writeRecurringError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rt)
+}
+
+// HandleRun handles POST /api/recurring/{id}/run
+func (r *Recurring) HandleRun(w http.ResponseWriter, req *http.Request, id string) {
+	rt, err := r.RunNow(id)
+	if err == ErrQueueFull {
+		writeError(w, http.StatusServiceUnavailable, api.ErrorQueueFull,
+			fmt.Sprintf("Queue is at capacity (%d tasks)", r.queue.Config().MaxSize))
+		return
+	}
+	if err != nil {
+		writeRecurringError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rt)
+}
+
+func writeRecurringError(w http.ResponseWriter, err error) {
+	if err == errRecurringNotFound {
+		writeError(w, http.StatusNotFound, api.ErrorNotFound, "Recurring task not found")
+		return
+	}
+	writeError(w, http.StatusInternalServerError, api.ErrorQueueError, err.Error())
+}
@@ -0,0 +1,244 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRecurring(t *testing.T, now *time.Time) (*Recurring, *WorkQueue, string) {
+	t.Helper()
+	dir := t.TempDir()
+	q, err := NewWorkQueue(QueueConfig{Dir: dir})
+	require.NoError(t, err)
+	path := filepath.Join(dir, "recurring.json")
+	r, err := NewRecurring(q, path)
+	require.NoError(t, err)
+	r.now = func() time.Time { return *now }
+	return r, q, path
+}
+
+func TestRecurringRequestValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		req  RecurringRequest
+		err  string
+	}{
+		{"interval", RecurringRequest{Name: "n", Prompt: "p", IntervalSeconds: 3600}, ""},
+		{"cron", RecurringRequest{Name: "n", Prompt: "p", Cron: "0 9 * * 1-5"}, ""},
+		{"no name", RecurringRequest{Prompt: "p", IntervalSeconds: 3600}, "name is required"},
+		{"no prompt", RecurringRequest{Name: "n", IntervalSeconds: 3600}, "prompt is required"},
+		{"no schedule", RecurringRequest{Name: "n", Prompt: "p"}, "set one of"},
+		{"both schedules", RecurringRequest{Name: "n", Prompt: "p", IntervalSeconds: 3600, Cron: "* * * * *"}, "set one of"},
+		{"short interval", RecurringRequest{Name: "n", Prompt: "p", IntervalSeconds: 30}, "at least 60"},
+		{"bad cron", RecurringRequest{Name: "n", Prompt: "p", Cron: "every day"}, "cron:"},
+		{"bad tier", RecurringRequest{Name: "n", Prompt: "p", IntervalSeconds: 3600, Tier: "huge"}, "tier"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.req.validate()
+			if tt.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestRecurringQueuesWhenDue(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.Local)
+	r, q, _ := newTestRecurring(t, &now)
+
+	rt, err := r.Create(RecurringRequest{Name: "hourly", Prompt: "check the build", IntervalSeconds: 3600, Tier: "fast"})
+	require.NoError(t, err)
+	require.Equal(t, now.Add(time.Hour), *rt.NextRun)
+
+	r.runDue()
+	require.Zero(t, q.Depth(), "not due yet")
+
+	now = now.Add(time.Hour)
+	r.runDue()
+	require.Equal(t, 1, q.Depth())
+	task := q.Pending()[0]
+	require.Equal(t, "check the build", task.Prompt)
+	require.Equal(t, "fast", task.Tier)
+	require.Equal(t, SourceRecurring, task.Source)
+	require.Equal(t, "hourly", task.SourceJob)
+
+	rt = r.Get(rt.ID)
+	require.Equal(t, 1, rt.Runs)
+	require.Equal(t, task.QueueID, rt.LastQueueID)
+	require.Equal(t, now.Add(time.Hour), *rt.NextRun)
+}
+
+func TestRecurringCronSchedule(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.Local) // A Monday
+	r, _, _ := newTestRecurring(t, &now)
+
+	rt, err := r.Create(RecurringRequest{Name: "standup", Prompt: "summarise", Cron: "30 9 * * 1-5"})
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2026, 3, 2, 9, 30, 0, 0, time.Local), *rt.NextRun)
+}
+
+func TestRecurringSkipsWhilePreviousRunQueued(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.Local)
+	r, q, _ := newTestRecurring(t, &now)
+
+	rt, err := r.Create(RecurringRequest{Name: "n", Prompt: "p", IntervalSeconds: 60})
+	require.NoError(t, err)
+
+	now = now.Add(time.Minute)
+	r.runDue()
+	require.Equal(t, 1, q.Depth())
+
+	now = now.Add(time.Minute)
+	r.runDue()
+	require.Equal(t, 1, q.Depth(), "the previous run is still queued")
+	rt = r.Get(rt.ID)
+	require.Equal(t, 1, rt.Runs)
+	require.Contains(t, rt.LastError, "still in the queue")
+
+	q.Remove(q.Get(rt.LastQueueID))
+	now = now.Add(time.Minute)
+	r.runDue()
+	require.Equal(t, 1, q.Depth())
+	rt = r.Get(rt.ID)
+	require.Equal(t, 2, rt.Runs)
+	require.Empty(t, rt.LastError)
+}
+
+func TestRecurringMissedRunsDoNotBurst(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.Local)
+	r, q, _ := newTestRecurring(t, &now)
+
+	rt, err := r.Create(RecurringRequest{Name: "n", Prompt: "p", IntervalSeconds: 60})
+	require.NoError(t, err)
+
+	now = now.Add(10 * time.Minute)
+	r.runDue()
+	r.runDue()
+	require.Equal(t, 1, q.Depth(), "missed runs are queued once")
+	require.Equal(t, now.Add(time.Minute), *r.Get(rt.ID).NextRun)
+}
+
+func TestRecurringPauseAndRunNow(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.Local)
+	r, q, _ := newTestRecurring(t, &now)
+
+	rt, err := r.Create(RecurringRequest{Name: "n", Prompt: "p", IntervalSeconds: 60})
+	require.NoError(t, err)
+
+	rt, err = r.SetPaused(rt.ID, true)
+	require.NoError(t, err)
+	require.True(t, rt.Paused)
+	require.Nil(t, rt.NextRun)
+
+	now = now.Add(time.Hour)
+	r.runDue()
+	require.Zero(t, q.Depth(), "paused tasks are not queued")
+
+	rt, err = r.RunNow(rt.ID)
+	require.NoError(t, err)
+	require.Equal(t, 1, q.Depth(), "run now works while paused")
+	require.Equal(t, 1, rt.Runs)
+	require.Nil(t, rt.NextRun)
+
+	rt, err = r.SetPaused(rt.ID, false)
+	require.NoError(t, err)
+	require.Equal(t, now.Add(time.Minute), *rt.NextRun)
+
+	_, err = r.SetPaused("recurring-missing", true)
+	require.ErrorIs(t, err, errRecurringNotFound)
+}
+
+func TestRecurringPersists(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.Local)
+	r, q, path := newTestRecurring(t, &now)
+
+	kept, err := r.Create(RecurringRequest{Name: "kept", Prompt: "p", IntervalSeconds: 60})
+	require.NoError(t, err)
+	deleted, err := r.Create(RecurringRequest{Name: "deleted", Prompt: "p", Cron: "0 * * * *"})
+	require.NoError(t, err)
+	require.NoError(t, r.Delete(deleted.ID))
+	require.ErrorIs(t, r.Delete(deleted.ID), errRecurringNotFound)
+
+	reloaded, err := NewRecurring(q, path)
+	require.NoError(t, err)
+	all := reloaded.All()
+	require.Len(t, all, 1)
+	require.Equal(t, kept.ID, all[0].ID)
+	require.Equal(t, "kept", all[0].Name)
+	require.Equal(t, *kept.NextRun, all[0].NextRun.Local())
+}
+
+func TestRecurringHandlers(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.Local)
+	r, q, _ := newTestRecurring(t, &now)
+
+	post := func(handler http.HandlerFunc, body any) *httptest.ResponseRecorder {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/api/recurring", bytes.NewReader(data)))
+		return w
+	}
+
+	w := post(r.HandleCreate, RecurringRequest{Name: "n", Prompt: "p"})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = post(r.HandleCreate, RecurringRequest{Name: "n", Prompt: "p", IntervalSeconds: 300})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var rt RecurringTask
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rt))
+	require.NotEmpty(t, rt.ID)
+
+	w = httptest.NewRecorder()
+	r.HandleList(w, httptest.NewRequest(http.MethodGet, "/api/recurring", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Recurring []RecurringTask `json:"recurring"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Recurring, 1)
+
+	w = httptest.NewRecorder()
+	r.HandleRun(w, httptest.NewRequest(http.MethodPost, "/api/recurring/"+rt.ID+"/run", nil), rt.ID)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, 1, q.Depth())
+
+	w = httptest.NewRecorder()
+	r.HandlePause(w, httptest.NewRequest(http.MethodPost, "/api/recurring/missing/pause", nil), "missing", true)
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	r.HandleDelete(w, httptest.NewRequest(http.MethodDelete, "/api/recurring/"+rt.ID, nil), rt.ID)
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	r.HandleGet(w, httptest.NewRequest(http.MethodGet, "/api/recurring/"+rt.ID, nil), rt.ID)
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
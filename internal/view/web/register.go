@@ -0,0 +1,100 @@
+package web
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"phobos.org.uk/agency/internal/api"
+)
+
+// DefaultRegistrationTTL is how long a registration lasts without a heartbeat.
+// Components are asked to renew at a third of this.
+const DefaultRegistrationTTL = 90 * time.Second
+
+// RegisterRequest is the body of POST /api/register.
+type RegisterRequest struct {
+	URL  string `json:"url"`  // Base URL the web view should poll, e.g. https://build-01:9000
+	Type string `json:"type"` // agent, director or helper
+}
+
+// RegisterResponse tells a component when to send its next heartbeat.
+type RegisterResponse struct {
+	Status           string    `json:"status"` // "registered"
+	URL              string    `json:"url"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	HeartbeatSeconds int       `json:"heartbeat_seconds"`
+}
+
+// Registrar lets components on other machines, which the port scan can't
+// reach, register with discovery. Registrations are renewed by repeating
+// them and are authenticated with the fleet's shared bearer token, so they
+// are disabled until one is configured.
+type Registrar struct {
+	discovery *Discovery
+	authToken string
+	ttl       time.Duration
+}
+
+// NewRegistrar creates a registrar that adds components to discovery.
+func NewRegistrar(discovery *Discovery, authToken string, ttl time.Duration) *Registrar {
+	if ttl <= 0 {
+		ttl = DefaultRegistrationTTL
+	}
+	return &Registrar{discovery: discovery, authToken: authToken, ttl: ttl}
+}
+
+// HandleRegister handles POST /api/register, which registers a component or
+// renews its registration.
+func (reg *Registrar) HandleRegister(w http.ResponseWriter, r *http.Request) {
+	if reg.authToken == "" {
+		writeError(w, http.StatusNotFound, api.ErrorNotFound, "Registration requires an auth token to be configured")
+		return
+	}
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(reg.authToken)) != 1 {
+		writeError(w, http.StatusUnauthorized, api.ErrorUnauthorized, "missing or invalid bearer token")
+		return
+	}
+
+	var req RegisterRequest
+	r.Body = http.MaxBytesReader(w, r.Body, 64*1024)
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	componentURL, err := normalizeComponentURL(req.URL)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, err.Error())
+		return
+	}
+	switch req.Type {
+	case api.TypeAgent, api.TypeDirector, api.TypeHelper:
+	default:
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "type must be agent, director or helper")
+		return
+	}
+
+	if reg.discovery.Register(componentURL, reg.ttl) {
+		fmt.Fprintf(os.Stderr, "discovery: %s registered at %s\n", req.Type, componentURL)
+	}
+	writeJSON(w, http.StatusOK, RegisterResponse{
+		Status:           "registered",
+		URL:              componentURL,
+		ExpiresAt:        time.Now().Add(reg.ttl).UTC(),
+		HeartbeatSeconds: int(reg.ttl / 3 / time.Second),
+	})
+}
+
+// normalizeComponentURL checks that raw is an https base URL and strips any
+// trailing slash, so heartbeats renew the same registration.
+func normalizeComponentURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimRight(raw, "/"))
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.Path != "" || u.RawQuery != "" || u.User != nil {
+		return "", fmt.Errorf("url must be an https base URL such as https://host:9000")
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,98 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func postRegister(h http.Handler, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/register", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRegisterHandler(t *testing.T) {
+	t.Parallel()
+
+	d := NewDiscovery(DiscoveryConfig{})
+	handler := http.HandlerFunc(NewRegistrar(d, "fleet-token", time.Minute).HandleRegister)
+
+	rec := postRegister(handler, "fleet-token", `{"url":"https://build-01:9000/","type":"agent"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp RegisterResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, "registered", resp.Status)
+	require.Equal(t, "https://build-01:9000", resp.URL)
+	require.Equal(t, 20, resp.HeartbeatSeconds)
+	require.Contains(t, d.remote, "https://build-01:9000")
+
+	tests := []struct {
+		name  string
+		token string
+		body  string
+		code  int
+	}{
+		{"missing token", "", `{"url":"https://build-01:9000","type":"agent"}`, http.StatusUnauthorized},
+		{"wrong token", "guess", `{"url":"https://build-01:9000","type":"agent"}`, http.StatusUnauthorized},
+		{"plain http", "fleet-token", `{"url":"http://build-01:9000","type":"agent"}`, http.StatusBadRequest},
+		{"url with path", "fleet-token", `{"url":"https://build-01:9000/status","type":"agent"}`, http.StatusBadRequest},
+		{"unknown type", "fleet-token", `{"url":"https://build-01:9000","type":"view"}`, http.StatusBadRequest},
+		{"bad json", "fleet-token", `{`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := postRegister(handler, tt.token, tt.body)
+		require.Equal(t, tt.code, rec.Code, tt.name)
+	}
+	require.Len(t, d.remote, 1)
+}
+
+func TestRegisterDisabledWithoutToken(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	authStore, err := NewAuthStore(filepath.Join(tmpDir, "auth.json"), "password")
+	require.NoError(t, err)
+	d, err := New(&Config{AuthStore: authStore, QueueDir: filepath.Join(tmpDir, "queue")}, "test")
+	require.NoError(t, err)
+
+	rec := postRegister(d.Router(), "", `{"url":"https://build-01:9000","type":"agent"}`)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestDiscoveryRegisteredComponent(t *testing.T) {
+	t.Parallel()
+
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"type": "agent", "state": "idle", "version": "remote-1.0"})
+	}))
+	defer agent.Close()
+
+	// An empty port range, so only the registration finds the agent
+	d := NewDiscovery(DiscoveryConfig{PortStart: 1, PortEnd: 0})
+	require.True(t, d.Register(agent.URL, time.Minute))
+	require.False(t, d.Register(agent.URL, time.Minute)) // Heartbeat
+	d.scan()
+
+	agents := d.Agents()
+	require.Len(t, agents, 1)
+	require.Equal(t, agent.URL, agents[0].URL)
+	require.True(t, agents[0].Remote)
+	require.Equal(t, "remote-1.0", agents[0].Version)
+
+	// Pruned once heartbeats stop
+	d.Register(agent.URL, -time.Second)
+	d.scan()
+	require.Empty(t, d.Agents())
+	require.Empty(t, d.remote)
+}
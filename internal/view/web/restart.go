@@ -0,0 +1,293 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Rolling restart states
+const (
+	RestartStateRunning   = "running"
+	RestartStateCompleted = "completed"
+	RestartStateFailed    = "failed"
+)
+
+// Per-agent rolling restart steps
+const (
+	RestartStepPending    = "pending"
+	RestartStepDraining   = "draining"
+	RestartStepRestarting = "restarting"
+	RestartStepWaiting    = "waiting"
+	RestartStepDone       = "done"
+	RestartStepFailed     = "failed"
+)
+
+// Rolling restart timeouts
+const (
+	DefaultRestartDrainTimeout   = time.Hour        // Time for the current task to finish
+	DefaultRestartCommandTimeout = 2 * time.Minute  // Time for the restart command to run
+	DefaultRestartReadyTimeout   = 2 * time.Minute  // Time for the agent to come back
+	restartPollInterval          = 2 * time.Second  // Agent status polling while draining/waiting
+	restartStatusTimeout         = 3 * time.Second  // Per-request timeout for status polls
+	restartRequestTimeout        = 10 * time.Second // Timeout for the drain request
+)
+
+// RestartStatus reports the progress of a rolling restart.
+type RestartStatus struct {
+	State      string                `json:"state"`
+	StartedAt  time.Time             `json:"started_at"`
+	FinishedAt *time.Time            `json:"finished_at,omitempty"`
+	Agents     []*RestartAgentStatus `json:"agents"`
+	Error      string                `json:"error,omitempty"`
+}
+
+// RestartAgentStatus reports the progress of restarting a single agent.
+type RestartAgentStatus struct {
+	URL       string `json:"url"`
+	AgentID   string `json:"agent_id,omitempty"`
+	AgentKind string `json:"agent_kind,omitempty"`
+	Step      string `json:"step"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Restarter drains and restarts agents one at a time.
+// The restart itself is delegated to a configured shell command (for example
+// "systemctl --user restart agency-agent@$AGENCY_AGENT_PORT"), which receives
+// the agent's URL, port, kind and ID in AGENCY_AGENT_* environment variables.
+type Restarter struct {
+	discovery *Discovery
+	command   string
+	client    *http.Client
+	authToken string // Bearer token sent to agents (optional)
+
+	drainTimeout time.Duration
+	readyTimeout time.Duration
+	pollInterval time.Duration
+	runCommand   func(ctx context.Context, agent *RestartAgentStatus) error
+
+	mu      sync.RWMutex
+	current *RestartStatus
+}
+
+// NewRestarter creates a restarter that runs command to restart each agent.
+func NewRestarter(discovery *Discovery, command string) *Restarter {
+	r := &Restarter{
+		discovery:    discovery,
+		command:      command,
+		client:       createHTTPClient(restartStatusTimeout, ""),
+		drainTimeout: DefaultRestartDrainTimeout,
+		readyTimeout: DefaultRestartReadyTimeout,
+		pollInterval: restartPollInterval,
+	}
+	r.runCommand = r.execCommand
+	return r
+}
+
+// SetAuthToken sets the bearer token sent to agents
+func (r *Restarter) SetAuthToken(token string) {
+	r.authToken = token
+}
+
+// Configured reports whether a restart command is available.
+func (r *Restarter) Configured() bool {
+	return r.command != ""
+}
+
+// Status returns a snapshot of the current (or most recent) rolling restart.
+func (r *Restarter) Status() *RestartStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.snapshotUnlocked()
+}
+
+// Start begins a rolling restart of all discovered agents in the background.
+// Returns an error if a restart is already running or no agents are known.
+func (r *Restarter) Start() (*RestartStatus, error) {
+	r.mu.Lock()
+	if r.current != nil && r.current.State == RestartStateRunning {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("rolling restart already in progress")
+	}
+
+	agents := r.discovery.Agents()
+	if len(agents) == 0 {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("no agents discovered")
+	}
+
+	status := &RestartStatus{
+		State:     RestartStateRunning,
+		StartedAt: time.Now(),
+	}
+	for _, agent := range agents {
+		status.Agents = append(status.Agents, &RestartAgentStatus{
+			URL:       agent.URL,
+			AgentID:   agent.AgentID,
+			AgentKind: agent.AgentKind,
+			Step:      RestartStepPending,
+		})
+	}
+	r.current = status
+	snapshot := r.snapshotUnlocked()
+	r.mu.Unlock()
+
+	go r.run(status)
+	return snapshot, nil
+}
+
+func (r *Restarter) run(status *RestartStatus) {
+	for _, agent := range status.Agents {
+		if err := r.restartAgent(agent); err != nil {
+			r.mu.Lock()
+			agent.Step = RestartStepFailed
+			agent.Error = err.Error()
+			r.finishUnlocked(status, RestartStateFailed, fmt.Sprintf("%s: %v", agent.URL, err))
+			r.mu.Unlock()
+			fmt.Fprintf(os.Stderr, "restart: %s failed: %v (stopping rollout)\n", agent.URL, err)
+			return
+		}
+		r.setStep(agent, RestartStepDone)
+		fmt.Fprintf(os.Stderr, "restart: %s restarted\n", agent.URL)
+	}
+
+	r.mu.Lock()
+	r.finishUnlocked(status, RestartStateCompleted, "")
+	r.mu.Unlock()
+}
+
+// restartAgent drains one agent, runs the restart command once it has exited,
+// and waits for it to report idle again.
+func (r *Restarter) restartAgent(agent *RestartAgentStatus) error {
+	r.setStep(agent, RestartStepDraining)
+	if err := r.requestDrain(agent.URL); err != nil {
+		return fmt.Errorf("requesting drain: %w", err)
+	}
+	if !r.waitFor(r.drainTimeout, func() bool { return !r.reachable(agent.URL) }) {
+		return fmt.Errorf("agent did not finish draining within %s", r.drainTimeout)
+	}
+
+	r.setStep(agent, RestartStepRestarting)
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRestartCommandTimeout)
+	defer cancel()
+	if err := r.runCommand(ctx, agent); err != nil {
+		return fmt.Errorf("restart command: %w", err)
+	}
+
+	r.setStep(agent, RestartStepWaiting)
+	if !r.waitFor(r.readyTimeout, func() bool { return r.agentState(agent.URL) == "idle" }) {
+		return fmt.Errorf("agent did not come back within %s", r.readyTimeout)
+	}
+	return nil
+}
+
+func (r *Restarter) requestDrain(agentURL string) error {
+	client := createHTTPClient(restartRequestTimeout, r.authToken)
+	resp, err := client.Post(agentURL+"/drain", "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("agent returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// agentState returns the state reported by the agent, or "" if unreachable.
+func (r *Restarter) agentState(agentURL string) string {
+	resp, err := r.client.Get(agentURL + "/status")
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+
+	var status struct {
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return ""
+	}
+	return status.State
+}
+
+func (r *Restarter) reachable(agentURL string) bool {
+	return r.agentState(agentURL) != ""
+}
+
+// waitFor polls cond until it returns true or the timeout expires.
+func (r *Restarter) waitFor(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if cond() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(r.pollInterval)
+	}
+}
+
+// execCommand runs the configured restart command for an agent.
+func (r *Restarter) execCommand(ctx context.Context, agent *RestartAgentStatus) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", r.command)
+	cmd.Env = append(os.Environ(),
+		"AGENCY_AGENT_URL="+agent.URL,
+		"AGENCY_AGENT_PORT="+agentPort(agent.URL),
+		"AGENCY_AGENT_KIND="+agent.AgentKind,
+		"AGENCY_AGENT_ID="+agent.AgentID,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, truncateOutput(string(output), 200))
+	}
+	return nil
+}
+
+func (r *Restarter) setStep(agent *RestartAgentStatus, step string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	agent.Step = step
+}
+
+func (r *Restarter) finishUnlocked(status *RestartStatus, state, errMsg string) {
+	now := time.Now()
+	status.State = state
+	status.FinishedAt = &now
+	status.Error = errMsg
+}
+
+func (r *Restarter) snapshotUnlocked() *RestartStatus {
+	if r.current == nil {
+		return nil
+	}
+	snapshot := *r.current
+	snapshot.Agents = make([]*RestartAgentStatus, len(r.current.Agents))
+	for i, agent := range r.current.Agents {
+		copied := *agent
+		snapshot.Agents[i] = &copied
+	}
+	return &snapshot
+}
+
+func agentPort(agentURL string) string {
+	u, err := url.Parse(agentURL)
+	if err != nil {
+		return ""
+	}
+	return u.Port()
+}
+
+func truncateOutput(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	return s[:maxLen] + "..."
+}
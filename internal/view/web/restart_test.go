@@ -0,0 +1,246 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRestartAgent simulates an agent that exits after a drain request and
+// comes back when restarted.
+type fakeRestartAgent struct {
+	mu   sync.Mutex
+	down bool
+	srv  *httptest.Server
+}
+
+func newFakeRestartAgent(t *testing.T) *fakeRestartAgent {
+	t.Helper()
+	a := &fakeRestartAgent{}
+	a.srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.mu.Lock()
+		down := a.down
+		a.mu.Unlock()
+
+		if down {
+			// Simulate a stopped process by dropping the connection
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+
+		switch r.URL.Path {
+		case "/status":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"type":       "agent",
+				"interfaces": []string{"statusable", "taskable"},
+				"version":    "agent-v1",
+				"state":      "idle",
+			})
+		case "/drain":
+			a.setDown(true)
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(map[string]string{"message": "draining"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(a.srv.Close)
+	return a
+}
+
+func (a *fakeRestartAgent) setDown(down bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.down = down
+}
+
+func newTestRestarter(t *testing.T, agents ...*fakeRestartAgent) *Restarter {
+	t.Helper()
+	d := NewDiscovery(DiscoveryConfig{})
+	for _, a := range agents {
+		d.checkPort(extractPort(t, a.srv.URL))
+	}
+	require.Len(t, d.Agents(), len(agents))
+
+	r := NewRestarter(d, "true")
+	r.pollInterval = 10 * time.Millisecond
+	r.drainTimeout = 5 * time.Second
+	r.readyTimeout = 5 * time.Second
+	return r
+}
+
+func waitForRestart(t *testing.T, r *Restarter) *RestartStatus {
+	t.Helper()
+	var status *RestartStatus
+	require.Eventually(t, func() bool {
+		status = r.Status()
+		return status != nil && status.State != RestartStateRunning
+	}, 10*time.Second, 10*time.Millisecond)
+	return status
+}
+
+func TestRestarterRestartsAgentsOneAtATime(t *testing.T) {
+	t.Parallel()
+
+	a1 := newFakeRestartAgent(t)
+	a2 := newFakeRestartAgent(t)
+	r := newTestRestarter(t, a1, a2)
+	byURL := map[string]*fakeRestartAgent{}
+	for _, fake := range []*fakeRestartAgent{a1, a2} {
+		byURL[fmt.Sprintf("https://localhost:%d", extractPort(t, fake.srv.URL))] = fake
+	}
+
+	var mu sync.Mutex
+	var restarted []string
+	overlapping := false
+	r.runCommand = func(ctx context.Context, agent *RestartAgentStatus) error {
+		mu.Lock()
+		defer mu.Unlock()
+		// Only the agent being restarted may be down
+		for url, fake := range byURL {
+			fake.mu.Lock()
+			if fake.down != (url == agent.URL) {
+				overlapping = true
+			}
+			fake.mu.Unlock()
+		}
+		restarted = append(restarted, agent.URL)
+		byURL[agent.URL].setDown(false)
+		return nil
+	}
+
+	started, err := r.Start()
+	require.NoError(t, err)
+	require.Equal(t, RestartStateRunning, started.State)
+	require.Len(t, started.Agents, 2)
+
+	status := waitForRestart(t, r)
+	require.Equal(t, RestartStateCompleted, status.State)
+	require.NotNil(t, status.FinishedAt)
+	for _, agent := range status.Agents {
+		require.Equal(t, RestartStepDone, agent.Step)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []string{status.Agents[0].URL, status.Agents[1].URL}, restarted)
+	require.False(t, overlapping)
+}
+
+func TestRestarterStopsOnFailure(t *testing.T) {
+	t.Parallel()
+
+	a1 := newFakeRestartAgent(t)
+	a2 := newFakeRestartAgent(t)
+	r := newTestRestarter(t, a1, a2)
+	r.runCommand = func(ctx context.Context, agent *RestartAgentStatus) error {
+		return fmt.Errorf("unit not found")
+	}
+
+	_, err := r.Start()
+	require.NoError(t, err)
+
+	status := waitForRestart(t, r)
+	require.Equal(t, RestartStateFailed, status.State)
+	require.Contains(t, status.Error, "unit not found")
+	require.Equal(t, RestartStepFailed, status.Agents[0].Step)
+	require.Equal(t, RestartStepPending, status.Agents[1].Step)
+}
+
+func TestRestarterRejectsConcurrentRestart(t *testing.T) {
+	t.Parallel()
+
+	a := newFakeRestartAgent(t)
+	r := newTestRestarter(t, a)
+	release := make(chan struct{})
+	r.runCommand = func(ctx context.Context, agent *RestartAgentStatus) error {
+		<-release
+		a.setDown(false)
+		return nil
+	}
+
+	_, err := r.Start()
+	require.NoError(t, err)
+	_, err = r.Start()
+	require.Error(t, err)
+
+	close(release)
+	require.Equal(t, RestartStateCompleted, waitForRestart(t, r).State)
+}
+
+func TestRestarterExecCommandEnv(t *testing.T) {
+	t.Parallel()
+
+	r := NewRestarter(NewDiscovery(DiscoveryConfig{}), `test "$AGENCY_AGENT_PORT" = 9001 && test "$AGENCY_AGENT_KIND" = codex`)
+	err := r.execCommand(context.Background(), &RestartAgentStatus{
+		URL:       "https://localhost:9001",
+		AgentKind: "codex",
+	})
+	require.NoError(t, err)
+
+	err = r.execCommand(context.Background(), &RestartAgentStatus{
+		URL:       "https://localhost:9002",
+		AgentKind: "codex",
+	})
+	require.Error(t, err)
+}
+
+func TestHandleRestartComponentsNotConfigured(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHandlers(t, NewDiscovery(DiscoveryConfig{}), "test")
+	h.SetRestarter(NewRestarter(h.discovery, ""))
+
+	rec := httptest.NewRecorder()
+	h.HandleRestartComponents(rec, httptest.NewRequest("POST", "/api/components/restart", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.HandleRestartStatus(rec, httptest.NewRequest("GET", "/api/components/restart", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestHandleRestartComponents(t *testing.T) {
+	t.Parallel()
+
+	a := newFakeRestartAgent(t)
+	r := newTestRestarter(t, a)
+	r.runCommand = func(ctx context.Context, agent *RestartAgentStatus) error {
+		a.setDown(false)
+		return nil
+	}
+	h := newTestHandlers(t, r.discovery, "test")
+	h.SetRestarter(r)
+
+	rec := httptest.NewRecorder()
+	h.HandleRestartStatus(rec, httptest.NewRequest("GET", "/api/components/restart", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.HandleRestartComponents(rec, httptest.NewRequest("POST", "/api/components/restart", nil))
+	require.Equal(t, http.StatusAccepted, rec.Code)
+
+	var started RestartStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &started))
+	require.Len(t, started.Agents, 1)
+
+	waitForRestart(t, r)
+
+	rec = httptest.NewRecorder()
+	h.HandleRestartStatus(rec, httptest.NewRequest("GET", "/api/components/restart", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var status RestartStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	require.Equal(t, RestartStateCompleted, status.State)
+}
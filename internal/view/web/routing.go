@@ -0,0 +1,71 @@
+package web
+
+import (
+	"fmt"
+	"slices"
+
+	"phobos.org.uk/agency/internal/api"
+)
+
+// Routing preference for an idle agent of the requested kind, best first.
+const (
+	routeTierConfigured = iota // Agent explicitly configures the requested tier
+	routeDefaultTiers          // Agent has no tier config and uses the built-in mapping
+	routeOtherTiers            // Agent configures other tiers; the requested one falls back to defaults
+)
+
+// agentMatchesKind reports whether an agent can run tasks of the given kind.
+// Agents that don't report a kind are treated as Claude agents.
+func agentMatchesKind(agent *ComponentStatus, agentKind string) bool {
+	if agentKind == api.AgentKindCodex {
+		return agent.AgentKind == api.AgentKindCodex
+	}
+	return agent.AgentKind == "" || agent.AgentKind == api.AgentKindClaude
+}
+
+// tierPreference ranks how well an agent's configured tiers fit a tier.
+func tierPreference(agent *ComponentStatus, tier string) int {
+	if len(agent.Tiers) == 0 {
+		return routeDefaultTiers
+	}
+	if slices.Contains(agent.Tiers, tier) {
+		return routeTierConfigured
+	}
+	return routeOtherTiers
+}
+
+// selectAgent picks an idle, healthy agent of the requested kind, preferring
+// agents that configure the requested tier. Agents are considered in
+// discovery (URL) order so ties are broken deterministically. Returns the
+// chosen agent and a human-readable reason, or nil if none is available.
+func selectAgent(agents []*ComponentStatus, agentKind, tier string) (*ComponentStatus, string) {
+	if agentKind == "" {
+		agentKind = api.AgentKindClaude
+	}
+	if tier == "" {
+		tier = api.TierStandard
+	}
+
+	var best *ComponentStatus
+	bestPref := routeOtherTiers + 1
+	for _, agent := range agents {
+		if agent.State != "idle" || agent.FailCount != 0 || agent.circuitOpen() || !agentMatchesKind(agent, agentKind) {
+			continue
+		}
+		if pref := tierPreference(agent, tier); pref < bestPref {
+			best, bestPref = agent, pref
+		}
+	}
+	if best == nil {
+		return nil, ""
+	}
+
+	switch bestPref {
+	case routeTierConfigured:
+		return best, fmt.Sprintf("idle %s agent configures tier %s", agentKind, tier)
+	case routeDefaultTiers:
+		return best, fmt.Sprintf("idle %s agent using default tier mapping for %s", agentKind, tier)
+	default:
+		return best, fmt.Sprintf("idle %s agent; no idle agent configures tier %s", agentKind, tier)
+	}
+}
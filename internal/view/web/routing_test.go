@@ -0,0 +1,89 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectAgent(t *testing.T) {
+	t.Parallel()
+
+	plain := &ComponentStatus{URL: "https://localhost:9000", State: "idle"}
+	heavy := &ComponentStatus{URL: "https://localhost:9001", State: "idle", AgentKind: "claude", Tiers: []string{"heavy"}}
+	fast := &ComponentStatus{URL: "https://localhost:9002", State: "idle", AgentKind: "claude", Tiers: []string{"fast"}}
+	codex := &ComponentStatus{URL: "https://localhost:9003", State: "idle", AgentKind: "codex"}
+	busy := &ComponentStatus{URL: "https://localhost:9004", State: "working", Tiers: []string{"standard"}}
+	failing := &ComponentStatus{URL: "https://localhost:9005", State: "idle", Tiers: []string{"standard"}, FailCount: 1}
+	tripped := &ComponentStatus{URL: "https://localhost:9006", State: "idle", Tiers: []string{"standard"}, Circuit: &CircuitStatus{State: CircuitOpen}}
+
+	tests := []struct {
+		name       string
+		agents     []*ComponentStatus
+		kind       string
+		tier       string
+		want       *ComponentStatus
+		wantReason string
+	}{
+		{"configured tier wins", []*ComponentStatus{plain, heavy}, "", "heavy", heavy, "idle claude agent configures tier heavy"},
+		{"default mapping before other tiers", []*ComponentStatus{fast, plain}, "claude", "heavy", plain, "idle claude agent using default tier mapping for heavy"},
+		{"other tiers as last resort", []*ComponentStatus{fast, busy, failing, tripped}, "", "", fast, "idle claude agent; no idle agent configures tier standard"},
+		{"kind is required", []*ComponentStatus{plain, heavy, codex}, "codex", "heavy", codex, "idle codex agent using default tier mapping for heavy"},
+		{"no matching kind", []*ComponentStatus{plain}, "codex", "", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, reason := selectAgent(tt.agents, tt.kind, tt.tier)
+			require.Equal(t, tt.want, got)
+			require.Equal(t, tt.wantReason, reason)
+		})
+	}
+}
+
+func TestDispatchRecordsRouteReason(t *testing.T) {
+	t.Parallel()
+
+	var hits []string
+	newAgent := func(name string) *httptest.Server {
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits = append(hits, name)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{"task_id": "task-" + name, "session_id": "session-" + name})
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	standard := newAgent("standard")
+	heavy := newAgent("heavy")
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	d.components[standard.URL] = &ComponentStatus{URL: standard.URL, Type: "agent", State: "idle", Tiers: []string{"standard"}}
+	d.components[heavy.URL] = &ComponentStatus{URL: heavy.URL, Type: "agent", State: "idle", Tiers: []string{"heavy"}}
+	d.mu.Unlock()
+
+	dispatcher := NewDispatcher(q, d, NewSessionStore())
+	dispatcher.trackInterval = time.Hour // Completion tracking is not under test
+	task, _, err := q.Add(QueueSubmitRequest{Prompt: "big job", Tier: "heavy"})
+	require.NoError(t, err)
+	dispatcher.dispatchNext()
+	require.Equal(t, []string{"heavy"}, hits)
+
+	h := NewQueueHandlers(q, d, NewSessionStore())
+	rec := httptest.NewRecorder()
+	h.HandleQueueTaskStatus(rec, httptest.NewRequest("GET", "/api/queue/"+task.QueueID, nil), task.QueueID)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var detail QueuedTaskDetail
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &detail))
+	require.Equal(t, heavy.URL, detail.AgentURL)
+	require.Equal(t, "idle claude agent configures tier heavy", detail.RouteReason)
+}
@@ -0,0 +1,211 @@
+package web
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"phobos.org.uk/agency/internal/api"
+)
+
+// DispatchWindowAnyTier is the tier name that makes a window apply to every tier.
+const DispatchWindowAnyTier = "*"
+
+// DispatchWindow is a daily time range, in the director's local time, during
+// which queued tasks of a tier may be dispatched. End before Start wraps past
+// midnight (e.g. 22:00-06:00).
+type DispatchWindow struct {
+	Tier  string        // Tier the window applies to, or DispatchWindowAnyTier
+	Start time.Duration // Offset from midnight
+	End   time.Duration // Offset from midnight
+}
+
+// ParseDispatchWindows parses a comma-separated list of tier=HH:MM-HH:MM
+// windows, e.g. "heavy=22:00-06:00,*=08:00-20:00".
+func ParseDispatchWindows(spec string) ([]DispatchWindow, error) {
+	var windows []DispatchWindow
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		tier, span, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("dispatch window %q must be tier=HH:MM-HH:MM", part)
+		}
+		tier = strings.TrimSpace(tier)
+		if tier != DispatchWindowAnyTier && !api.IsValidTier(tier) {
+			return nil, fmt.Errorf("dispatch window %q: tier must be fast, standard, heavy, or *", part)
+		}
+		startStr, endStr, ok := strings.Cut(span, "-")
+		if !ok {
+			return nil, fmt.Errorf("dispatch window %q must be tier=HH:MM-HH:MM", part)
+		}
+		start, err := parseClock(startStr)
+		if err != nil {
+			return nil, fmt.Errorf("dispatch window %q: %w", part, err)
+		}
+		end, err := parseClock(endStr)
+		if err != nil {
+			return nil, fmt.Errorf("dispatch window %q: %w", part, err)
+		}
+		if start == end {
+			return nil, fmt.Errorf("dispatch window %q is empty", part)
+		}
+		windows = append(windows, DispatchWindow{Tier: tier, Start: start, End: end})
+	}
+	return windows, nil
+}
+
+// parseClock parses HH:MM into an offset from midnight.
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (want HH:MM)", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// contains reports whether now falls inside the window.
+func (w DispatchWindow) contains(now time.Time) bool {
+	offset := now.Sub(midnight(now))
+	if w.Start < w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// nextStart returns the first time after now that the window opens.
+func (w DispatchWindow) nextStart(now time.Time) time.Time {
+	start := midnight(now).Add(w.Start)
+	if !start.After(now) {
+		start = midnight(now).AddDate(0, 0, 1).Add(w.Start)
+	}
+	return start
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// windowOpensAt returns when a task of the given tier may next be dispatched,
+// or the zero time if it may be dispatched now. Tiers with no matching
+// windows are never restricted.
+func windowOpensAt(windows []DispatchWindow, tier string, now time.Time) time.Time {
+	if tier == "" {
+		tier = api.TierStandard
+	}
+	var opens time.Time
+	for _, w := range windows {
+		if w.Tier != tier && w.Tier != DispatchWindowAnyTier {
+			continue
+		}
+		if w.contains(now) {
+			return time.Time{}
+		}
+		if next := w.nextStart(now); opens.IsZero() || next.Before(opens) {
+			opens = next
+		}
+	}
+	return opens
+}
+
+// dispatchRateLimiter enforces a maximum number of dispatches per rolling
+// hour. It is only touched by the dispatch loop.
+type dispatchRateLimiter struct {
+	recent []time.Time // Dispatch times within the last hour, oldest first
+}
+
+// opensAt returns when the next dispatch is allowed under limit, or the zero
+// time if one is allowed now. A limit of 0 means unlimited.
+func (l *dispatchRateLimiter) opensAt(limit int, now time.Time) time.Time {
+	if limit <= 0 {
+		return time.Time{}
+	}
+	cutoff := now.Add(-time.Hour)
+	for len(l.recent) > 0 && !l.recent[0].After(cutoff) {
+		l.recent = l.recent[1:]
+	}
+	if len(l.recent) < limit {
+		return time.Time{}
+	}
+	return l.recent[len(l.recent)-limit].Add(time.Hour)
+}
+
+// record notes a dispatch at now.
+func (l *dispatchRateLimiter) record(now time.Time) {
+	l.recent = append(l.recent, now)
+}
+
+// DefaultSourceWeight is the fair-share weight of sources without one set.
+const DefaultSourceWeight = 1
+
+// queueSourceDefault groups tasks submitted without a source.
+const queueSourceDefault = "queue"
+
+// ParseSourceWeights parses a comma-separated list of source=weight pairs,
+// e.g. "web=4,cli=4,scheduler=1". Weights are positive integers.
+func ParseSourceWeights(spec string) (map[string]int, error) {
+	weights := map[string]int{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		source, weightStr, ok := strings.Cut(part, "=")
+		source = strings.TrimSpace(source)
+		if !ok || source == "" {
+			return nil, fmt.Errorf("source weight %q must be source=weight", part)
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(weightStr))
+		if err != nil || weight < 1 {
+			return nil, fmt.Errorf("source weight %q: weight must be a positive integer", part)
+		}
+		weights[source] = weight
+	}
+	return weights, nil
+}
+
+// sourceKey is the source a task is scheduled under.
+func sourceKey(task *QueuedTask) string {
+	if task.Source == "" {
+		return queueSourceDefault
+	}
+	return task.Source
+}
+
+// sourceWeight returns the configured weight of source.
+func sourceWeight(weights map[string]int, source string) int {
+	if w, ok := weights[source]; ok {
+		return w
+	}
+	return DefaultSourceWeight
+}
+
+// fairScheduler shares dispatches between sources in proportion to their
+// weights using start-time fair queueing. A source's next task is tagged
+// with the later of the virtual time and the finish tag of the source's last
+// dispatch; the lowest tag goes next. A source that had nothing queued
+// starts at the virtual time, so it banks no credit while idle and a source
+// flooding the queue only gets its share while others have work waiting.
+// It is only touched by the dispatch loop.
+type fairScheduler struct {
+	vtime  float64
+	finish map[string]float64 // Finish tag of each source's last dispatch
+}
+
+// startTag returns the tag source's next task would be dispatched at.
+func (f *fairScheduler) startTag(source string) float64 {
+	return max(f.vtime, f.finish[source])
+}
+
+// record notes a dispatch for source.
+func (f *fairScheduler) record(source string, weight int) {
+	if f.finish == nil {
+		f.finish = make(map[string]float64)
+	}
+	start := f.startTag(source)
+	f.finish[source] = start + 1/float64(weight)
+	f.vtime = start
+}
@@ -0,0 +1,105 @@
+package web
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDispatchWindows(t *testing.T) {
+	t.Parallel()
+
+	windows, err := ParseDispatchWindows("heavy=22:00-06:00, *=08:30-20:00")
+	require.NoError(t, err)
+	require.Equal(t, []DispatchWindow{
+		{Tier: "heavy", Start: 22 * time.Hour, End: 6 * time.Hour},
+		{Tier: "*", Start: 8*time.Hour + 30*time.Minute, End: 20 * time.Hour},
+	}, windows)
+
+	windows, err = ParseDispatchWindows("")
+	require.NoError(t, err)
+	require.Empty(t, windows)
+
+	for _, spec := range []string{"heavy", "huge=22:00-06:00", "heavy=22:00", "heavy=25:00-06:00", "heavy=06:00-06:00"} {
+		_, err := ParseDispatchWindows(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestWindowOpensAt(t *testing.T) {
+	t.Parallel()
+
+	windows := []DispatchWindow{{Tier: "heavy", Start: 22 * time.Hour, End: 6 * time.Hour}}
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.Local)
+
+	// Outside the window: opens at 22:00 the same day
+	require.Equal(t, day.Add(22*time.Hour), windowOpensAt(windows, "heavy", day.Add(12*time.Hour)))
+	// Inside the window on either side of midnight
+	require.True(t, windowOpensAt(windows, "heavy", day.Add(23*time.Hour)).IsZero())
+	require.True(t, windowOpensAt(windows, "heavy", day.Add(5*time.Hour)).IsZero())
+	// Closes at 06:00
+	require.Equal(t, day.Add(22*time.Hour), windowOpensAt(windows, "heavy", day.Add(6*time.Hour)))
+	// Other tiers (including the standard default) are unrestricted
+	require.True(t, windowOpensAt(windows, "", day.Add(12*time.Hour)).IsZero())
+
+	// A wildcard window applies to every tier; the earliest opening wins
+	windows = append(windows, DispatchWindow{Tier: "*", Start: 13 * time.Hour, End: 14 * time.Hour})
+	require.Equal(t, day.Add(13*time.Hour), windowOpensAt(windows, "heavy", day.Add(12*time.Hour)))
+	require.Equal(t, day.AddDate(0, 0, 1).Add(13*time.Hour), windowOpensAt(windows, "fast", day.Add(15*time.Hour)))
+}
+
+func TestDispatchRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	var l dispatchRateLimiter
+	start := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	require.True(t, l.opensAt(0, start).IsZero()) // Unlimited
+	require.True(t, l.opensAt(2, start).IsZero())
+	l.record(start)
+	l.record(start.Add(10 * time.Minute))
+
+	require.Equal(t, start.Add(time.Hour), l.opensAt(2, start.Add(20*time.Minute)))
+	require.True(t, l.opensAt(2, start.Add(time.Hour)).IsZero())
+	require.Len(t, l.recent, 1)
+}
+
+func TestParseSourceWeights(t *testing.T) {
+	t.Parallel()
+
+	weights, err := ParseSourceWeights("web=4, cli=4,scheduler=1")
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"web": 4, "cli": 4, "scheduler": 1}, weights)
+	require.Equal(t, 4, sourceWeight(weights, "web"))
+	require.Equal(t, DefaultSourceWeight, sourceWeight(weights, "github"))
+
+	weights, err = ParseSourceWeights("")
+	require.NoError(t, err)
+	require.Empty(t, weights)
+
+	for _, spec := range []string{"web", "=2", "web=0", "web=-1", "web=fast"} {
+		_, err := ParseSourceWeights(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestFairScheduler(t *testing.T) {
+	t.Parallel()
+
+	var f fairScheduler
+	require.Zero(t, f.startTag("web"))
+
+	// Weight 3 gets three dispatches for each of weight 1's
+	f.record("scheduler", 1)
+	require.Equal(t, 1.0, f.startTag("scheduler"))
+	for range 3 {
+		require.Less(t, f.startTag("web"), f.startTag("scheduler"))
+		f.record("web", 3)
+	}
+	require.InDelta(t, 1.0, f.startTag("web"), 1e-9)
+
+	// A source that was idle starts at the virtual time rather than zero
+	f.record("scheduler", 1)
+	require.InDelta(t, 1.0, f.startTag("cli"), 1e-9)
+}
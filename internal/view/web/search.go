@@ -0,0 +1,183 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/history"
+)
+
+// Search limits
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 200
+	searchFetchTimeout = 10 * time.Second
+)
+
+// Relevance of a search result: an exact ID beats a match in the prompt,
+// which beats a match only the agent could see (in the task's output).
+const (
+	searchScoreOutput = 1
+	searchScorePrompt = 2
+	searchScoreID     = 3
+)
+
+// SearchResult is a task found by GET /api/search.
+type SearchResult struct {
+	TaskID        string    `json:"task_id"`
+	SessionID     string    `json:"session_id,omitempty"`
+	AgentURL      string    `json:"agent_url"`
+	AgentID       string    `json:"agent_id,omitempty"`
+	State         string    `json:"state"`
+	PromptPreview string    `json:"prompt_preview"`
+	Time          time.Time `json:"time"`   // Completion time, or the session's last update for tasks not yet in history
+	Source        string    `json:"source"` // "history" or "session"
+	Score         int       `json:"score"`  // Higher is more relevant
+
+	AgencyPrompt *history.PromptStamp `json:"agency_prompt,omitempty"` // Agency prompt the task ran with, from history
+}
+
+// SearchError records an agent whose history couldn't be searched.
+type SearchError struct {
+	AgentURL string `json:"agent_url"`
+	Error    string `json:"error"`
+}
+
+// SearchResponse is returned by GET /api/search.
+type SearchResponse struct {
+	Query     string         `json:"query"`
+	Results   []SearchResult `json:"results"` // Most relevant first, then newest
+	Truncated bool           `json:"truncated,omitempty"`
+	Errors    []SearchError  `json:"errors,omitempty"`
+}
+
+// HandleSearch finds tasks matching ?q= across every discovered agent's
+// history and the director's sessions, so a task can be found without
+// knowing which agent ran it. ?limit= caps the results (default 50, at
+// most 200).
+func (h *Handlers) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "q is required")
+		return
+	}
+	limit, err := api.ParseIntParam(r.URL.Query().Get("limit"), 1, maxSearchLimit, defaultSearchLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "limit "+err.Error())
+		return
+	}
+
+	client := createHTTPClient(searchFetchTimeout, h.authToken)
+	agents := h.discovery.Agents()
+	found := make([][]SearchResult, len(agents))
+	errs := make([]error, len(agents))
+	var wg sync.WaitGroup
+	for i, agent := range agents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			found[i], errs[i] = searchAgentHistory(client, agent, query, limit)
+		}()
+	}
+	wg.Wait()
+
+	resp := SearchResponse{Query: query, Results: []SearchResult{}}
+	seen := make(map[string]bool)
+	for i, results := range found {
+		if errs[i] != nil {
+			resp.Errors = append(resp.Errors, SearchError{AgentURL: agents[i].URL, Error: errs[i].Error()})
+			continue
+		}
+		for _, result := range results {
+			seen[result.AgentURL+" "+result.TaskID] = true
+			resp.Results = append(resp.Results, result)
+		}
+	}
+
+	// Sessions add tasks still running, and those of agents that are gone
+	for _, m := range h.sessionStore.FindTasks(query) {
+		if seen[m.AgentURL+" "+m.Task.TaskID] {
+			continue
+		}
+		resp.Results = append(resp.Results, SearchResult{
+			TaskID:        m.Task.TaskID,
+			SessionID:     m.SessionID,
+			AgentURL:      m.AgentURL,
+			State:         m.Task.State,
+			PromptPreview: truncateUTF8(m.Task.Prompt, history.PreviewLength),
+			Time:          m.UpdatedAt,
+			Source:        "session",
+			Score:         searchScore(query, m.Task.TaskID, m.SessionID, m.Task.Prompt),
+		})
+	}
+
+	sort.SliceStable(resp.Results, func(i, j int) bool {
+		a, b := resp.Results[i], resp.Results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.Time.After(b.Time)
+	})
+	if len(resp.Results) > limit {
+		resp.Results = resp.Results[:limit]
+		resp.Truncated = true
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// searchAgentHistory runs a history query on one agent.
+func searchAgentHistory(client *http.Client, agent *ComponentStatus, query string, limit int) ([]SearchResult, error) {
+	params := url.Values{"q": {query}, "limit": {fmt.Sprint(limit)}}
+	resp, err := client.Get(agent.URL + "/history?" + params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("searching history: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("searching history: status %d", resp.StatusCode)
+	}
+	var list history.ListResult
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("decoding history: %w", err)
+	}
+
+	results := make([]SearchResult, 0, len(list.Entries))
+	for _, e := range list.Entries {
+		agentID := e.AgentID
+		if agentID == "" {
+			agentID = agent.AgentID
+		}
+		results = append(results, SearchResult{
+			TaskID:        e.TaskID,
+			SessionID:     e.SessionID,
+			AgentURL:      agent.URL,
+			AgentID:       agentID,
+			State:         e.State,
+			PromptPreview: e.PromptPreview,
+			Time:          e.CompletedAt,
+			Source:        "history",
+			Score:         searchScore(query, e.TaskID, e.SessionID, e.PromptPreview),
+			AgencyPrompt:  e.AgencyPrompt,
+		})
+	}
+	return results, nil
+}
+
+// searchScore rates how well a task matches query. The agent also matches
+// the full prompt and output, which the director only sees a preview of.
+func searchScore(query, taskID, sessionID, prompt string) int {
+	if strings.EqualFold(query, taskID) || strings.EqualFold(query, sessionID) {
+		return searchScoreID
+	}
+	if strings.Contains(strings.ToLower(prompt), strings.ToLower(query)) {
+		return searchScorePrompt
+	}
+	return searchScoreOutput
+}
@@ -0,0 +1,77 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/history"
+)
+
+func TestHandleSearch(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	var query string
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/status":
+			json.NewEncoder(w).Encode(map[string]any{"type": "agent", "state": "idle", "agent_id": "agent-a"})
+		case "/history":
+			query = r.URL.Query().Get("q")
+			json.NewEncoder(w).Encode(history.ListResult{Entries: []history.EntrySummary{
+				// Matched on its output, which only the agent searches
+				{TaskID: "task-1", SessionID: "s-1", State: "completed", PromptPreview: "tidy up", CompletedAt: now.Add(-time.Minute),
+					AgencyPrompt: &history.PromptStamp{File: "claude-prod.md", Hash: "3f2a9c"}},
+				{TaskID: "task-2", SessionID: "s-2", State: "failed", PromptPreview: "fix the Flaky test", CompletedAt: now.Add(-time.Hour)},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(agent.Close)
+
+	d := NewDiscovery(DiscoveryConfig{})
+	d.checkPort(extractPort(t, agent.URL))
+	agentURL := d.Agents()[0].URL
+	h := newTestHandlers(t, d, "test")
+	h.sessionStore.AddTask("s-2", agentURL, "task-2", "failed", "fix the flaky test")
+	h.sessionStore.AddTask("s-3", agentURL, "task-3", "working", "flaky test again")
+	h.sessionStore.AddTask("s-4", agentURL, "task-4", "working", "unrelated")
+
+	w := httptest.NewRecorder()
+	h.HandleSearch(w, httptest.NewRequest("GET", "/api/search?q=flaky", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Equal(t, "flaky", query)
+
+	var resp SearchResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Empty(t, resp.Errors)
+	var ids []string
+	for _, r := range resp.Results {
+		require.Equal(t, agentURL, r.AgentURL)
+		ids = append(ids, r.TaskID+"/"+r.Source)
+	}
+	// Prompt matches first, newest first; task-2 is reported once, from history
+	require.Equal(t, []string{"task-3/session", "task-2/history", "task-1/history"}, ids)
+	require.Equal(t, "agent-a", resp.Results[1].AgentID)
+	require.Equal(t, "claude-prod.md", resp.Results[2].AgencyPrompt.File)
+
+	w = httptest.NewRecorder()
+	h.HandleSearch(w, httptest.NewRequest("GET", "/api/search?q=task-1", nil))
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, "task-1", resp.Results[0].TaskID, "an exact ID ranks first")
+
+	w = httptest.NewRecorder()
+	h.HandleSearch(w, httptest.NewRequest("GET", "/api/search?q=flaky&limit=1", nil))
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Results, 1)
+	require.True(t, resp.Truncated)
+
+	w = httptest.NewRecorder()
+	h.HandleSearch(w, httptest.NewRequest("GET", "/api/search", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
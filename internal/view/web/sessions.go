@@ -1,7 +1,9 @@
 package web
 
 import (
+	"encoding/json"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -21,6 +23,7 @@ type Session struct {
 	Source    string        `json:"source,omitempty"`     // "web", "scheduler", "cli"
 	SourceJob string        `json:"source_job,omitempty"` // Job name for scheduler
 	Archived  bool          `json:"archived,omitempty"`   // Whether session is archived
+	Seq       int           `json:"seq"`                  // Bumped for every task submitted to the session
 	CreatedAt time.Time     `json:"created_at"`
 	UpdatedAt time.Time     `json:"updated_at"`
 }
@@ -29,6 +32,7 @@ type Session struct {
 type SessionStore struct {
 	mu       sync.RWMutex
 	sessions map[string]*Session
+	events   *EventBus // Told of each change, after the lock is released (optional)
 }
 
 // NewSessionStore creates a new session store
@@ -38,6 +42,31 @@ func NewSessionStore() *SessionStore {
 	}
 }
 
+// SetEventBus sets the bus told when a session changes
+func (s *SessionStore) SetEventBus(bus *EventBus) {
+	s.events = bus
+}
+
+// updated publishes a change to a session. Called without the lock held.
+func (s *SessionStore) updated(sessionID string) {
+	s.events.Publish(Event{Type: EventSessionUpdated, SessionID: sessionID})
+}
+
+// Snapshot returns every session, archived ones included, as JSON for backups
+func (s *SessionStore) Snapshot() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		result = append(result, session)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return json.MarshalIndent(map[string]any{"sessions": result}, "", "  ")
+}
+
 // Get retrieves a session by ID
 func (s *SessionStore) Get(id string) (*Session, bool) {
 	s.mu.RLock()
@@ -67,6 +96,7 @@ func (s *SessionStore) GetAll() []*Session {
 
 // AddTask adds a task to a session, creating the session if it doesn't exist
 func (s *SessionStore) AddTask(sessionID, agentURL, taskID, state, prompt string, opts ...AddTaskOption) {
+	defer s.updated(sessionID) // Deferred first, so it runs after the unlock
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -87,6 +117,11 @@ func (s *SessionStore) AddTask(sessionID, agentURL, taskID, state, prompt string
 			CreatedAt: now,
 		}
 		s.sessions[sessionID] = session
+	} else if !options.seqClaimed {
+		session.Seq++
+	}
+	if session.Seq == 0 {
+		session.Seq = 1
 	}
 
 	session.Tasks = append(session.Tasks, SessionTask{
@@ -99,8 +134,9 @@ func (s *SessionStore) AddTask(sessionID, agentURL, taskID, state, prompt string
 
 // addTaskOptions holds optional parameters for AddTask
 type addTaskOptions struct {
-	source    string
-	sourceJob string
+	source     string
+	sourceJob  string
+	seqClaimed bool
 }
 
 // AddTaskOption is a functional option for AddTask
@@ -120,44 +156,151 @@ func WithSourceJob(sourceJob string) AddTaskOption {
 	}
 }
 
-// UpdateTaskState updates the state of a specific task in a session
-func (s *SessionStore) UpdateTaskState(sessionID, taskID, state string) bool {
+// WithSeqClaimed marks a task whose submission already bumped the session's
+// seq through ClaimSeq
+func WithSeqClaimed() AddTaskOption {
+	return func(o *addTaskOptions) {
+		o.seqClaimed = true
+	}
+}
+
+// ClaimSeq bumps a session's seq for a task being submitted to it, before
+// the task is recorded with AddTask. If expected is set and the session has
+// moved on from it, nothing changes and ok is false. Returns the session's
+// seq; sessions the director hasn't seen have nothing to conflict with and
+// report 0.
+func (s *SessionStore) ClaimSeq(sessionID string, expected *int) (seq int, ok bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	session, exists := s.sessions[sessionID]
+	if !exists {
+		return 0, true
+	}
+	if expected != nil && *expected != session.Seq {
+		return session.Seq, false
+	}
+	session.Seq++
+	return session.Seq, true
+}
+
+// UpdateTaskState updates the state of a specific task in a session
+func (s *SessionStore) UpdateTaskState(sessionID, taskID, state string) bool {
+	s.mu.Lock()
 	session, ok := s.sessions[sessionID]
 	if !ok {
+		s.mu.Unlock()
 		return false
 	}
 
+	found := false
 	for i := range session.Tasks {
 		if session.Tasks[i].TaskID == taskID {
 			session.Tasks[i].State = state
 			session.UpdatedAt = time.Now()
-			return true
+			found = true
+			break
 		}
 	}
-	return false
+	s.mu.Unlock()
+
+	if found {
+		s.updated(sessionID)
+	}
+	return found
 }
 
 // Delete removes a session
 func (s *SessionStore) Delete(id string) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	_, ok := s.sessions[id]
 	delete(s.sessions, id)
+	s.mu.Unlock()
+
+	if ok {
+		s.updated(id)
+	}
 }
 
 // Archive marks a session as archived (hidden from UI but kept in storage)
 func (s *SessionStore) Archive(id string) bool {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	session, ok := s.sessions[id]
-	if !ok {
-		return false
+	if ok {
+		session.Archived = true
+		session.UpdatedAt = time.Now()
+	}
+	s.mu.Unlock()
+
+	if ok {
+		s.updated(id)
+	}
+	return ok
+}
+
+// RebindAgent moves all sessions bound to oldURL over to newURL.
+// Returns the number of sessions updated.
+func (s *SessionStore) RebindAgent(oldURL, newURL string) int {
+	s.mu.Lock()
+	var moved []string
+	for _, session := range s.sessions {
+		if session.AgentURL == oldURL {
+			session.AgentURL = newURL
+			moved = append(moved, session.ID)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, id := range moved {
+		s.updated(id)
+	}
+	return len(moved)
+}
+
+// SessionTaskMatch is a session task found by FindTasks.
+type SessionTaskMatch struct {
+	SessionID string
+	AgentURL  string
+	Task      SessionTask
+	UpdatedAt time.Time // The session's last update
+}
+
+// FindTasks returns the tasks, including archived sessions', whose prompt,
+// task ID or session ID contains query, ignoring case.
+func (s *SessionStore) FindTasks(query string) []SessionTaskMatch {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query = strings.ToLower(query)
+	var matches []SessionTaskMatch
+	for _, session := range s.sessions {
+		sessionMatch := strings.Contains(strings.ToLower(session.ID), query)
+		for _, task := range session.Tasks {
+			if sessionMatch || strings.Contains(strings.ToLower(task.TaskID), query) ||
+				strings.Contains(strings.ToLower(task.Prompt), query) {
+				matches = append(matches, SessionTaskMatch{
+					SessionID: session.ID,
+					AgentURL:  session.AgentURL,
+					Task:      task,
+					UpdatedAt: session.UpdatedAt,
+				})
+			}
+		}
 	}
+	return matches
+}
+
+// AgentForTask returns the agent URL of the session holding taskID.
+func (s *SessionStore) AgentForTask(taskID string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	session.Archived = true
-	session.UpdatedAt = time.Now()
-	return true
+	for _, session := range s.sessions {
+		for _, task := range session.Tasks {
+			if task.TaskID == taskID {
+				return session.AgentURL, true
+			}
+		}
+	}
+	return "", false
 }
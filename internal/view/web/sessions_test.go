@@ -696,3 +696,54 @@ func TestArchiveAlreadyArchivedSession(t *testing.T) {
 	// Should succeed (idempotent)
 	require.Equal(t, http.StatusOK, rec.Code)
 }
+
+func TestSessionStoreRebindAgent(t *testing.T) {
+	t.Parallel()
+
+	store := NewSessionStore()
+	store.AddTask("session-1", "https://localhost:9000", "task-1", "completed", "prompt 1")
+	store.AddTask("session-2", "https://localhost:9000", "task-2", "working", "prompt 2")
+	store.AddTask("session-3", "https://localhost:9001", "task-3", "working", "prompt 3")
+
+	n := store.RebindAgent("https://localhost:9000", "https://localhost:9005")
+	require.Equal(t, 2, n)
+
+	sess1, _ := store.Get("session-1")
+	sess2, _ := store.Get("session-2")
+	sess3, _ := store.Get("session-3")
+	require.Equal(t, "https://localhost:9005", sess1.AgentURL)
+	require.Equal(t, "https://localhost:9005", sess2.AgentURL)
+	require.Equal(t, "https://localhost:9001", sess3.AgentURL)
+}
+
+func TestSessionStoreSeq(t *testing.T) {
+	t.Parallel()
+
+	store := NewSessionStore()
+	seq, ok := store.ClaimSeq("session-1", nil)
+	require.True(t, ok, "unknown sessions have nothing to conflict with")
+	require.Zero(t, seq)
+
+	store.AddTask("session-1", "http://agent:9000", "task-1", "working", "first")
+	session, _ := store.Get("session-1")
+	require.Equal(t, 1, session.Seq)
+
+	store.AddTask("session-1", "http://agent:9000", "task-2", "working", "second")
+	session, _ = store.Get("session-1")
+	require.Equal(t, 2, session.Seq)
+
+	stale := 1
+	seq, ok = store.ClaimSeq("session-1", &stale)
+	require.False(t, ok)
+	require.Equal(t, 2, seq)
+
+	current := 2
+	seq, ok = store.ClaimSeq("session-1", &current)
+	require.True(t, ok)
+	require.Equal(t, 3, seq)
+
+	store.AddTask("session-1", "http://agent:9000", "task-3", "working", "third", WithSeqClaimed())
+	session, _ = store.Get("session-1")
+	require.Equal(t, 3, session.Seq)
+	require.Len(t, session.Tasks, 3)
+}
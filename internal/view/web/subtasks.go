@@ -0,0 +1,344 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"phobos.org.uk/agency/internal/api"
+)
+
+// Subtask limits
+const (
+	maxSubtasksPerParent = 20
+	maxSubtaskDepth      = 2   // Subtasks may spawn subtasks, but no deeper
+	maxFinishedParents   = 100 // Parents whose subtasks all finished, kept for status queries
+	subtaskSource        = "subtask"
+)
+
+// SubtaskRequest is the body of POST /api/queue/{id}/subtasks.
+type SubtaskRequest struct {
+	Prompt         string            `json:"prompt"`
+	Tier           string            `json:"tier,omitempty"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"`
+	AgentKind      string            `json:"agent_kind,omitempty"` // Default: the parent's
+	Env            map[string]string `json:"env,omitempty"`
+	api.RunnerOptions
+}
+
+// Subtask is a child task as reported to its parent.
+type Subtask struct {
+	QueueID       string `json:"queue_id"`
+	State         string `json:"state"`
+	PromptPreview string `json:"prompt_preview"`
+	TaskID        string `json:"task_id,omitempty"`
+	AgentURL      string `json:"agent_url,omitempty"`
+	SessionID     string `json:"session_id,omitempty"`
+	Error         string `json:"error,omitempty"` // Why the queue failed the subtask, if it did
+}
+
+// SubtaskStatus aggregates a parent's subtasks.
+type SubtaskStatus struct {
+	ParentQueueID string    `json:"parent_queue_id"`
+	Total         int       `json:"total"`
+	Pending       int       `json:"pending"`   // Waiting in the queue
+	Running       int       `json:"running"`   // Dispatching or working
+	Completed     int       `json:"completed"` // Finished successfully
+	Failed        int       `json:"failed"`    // Failed, cancelled or expired
+	Done          bool      `json:"done"`      // Every subtask has finished
+	Subtasks      []Subtask `json:"subtasks"`
+}
+
+// Subtasks lets a running queued task decompose its work by queueing child
+// tasks. Each dispatched task is given the director URL, its queue ID and a
+// token in its environment; the token is an HMAC of the queue ID under a key
+// kept in the queue directory, so it authorizes that task (and only it) to
+// spawn and check on its subtasks. Children run in new sessions and record
+// their parent's task ID in their agent history.
+type Subtasks struct {
+	mu          sync.Mutex
+	queue       *WorkQueue
+	key         []byte
+	directorURL string                // How agents reach the director
+	children    map[string][]*Subtask // Subtasks by parent queue ID, in spawn order
+	byQueueID   map[string]*Subtask
+	depth       map[string]int // Depth of each subtask's queue ID (1 = child of a top-level task)
+	finished    []string       // Parents whose subtasks all finished, oldest first
+}
+
+// NewSubtasks creates the subtask API for queue. The token key is read from
+// keyPath, or created there on first use. directorURL is how a task's agent
+// process reaches the director.
+func NewSubtasks(queue *WorkQueue, keyPath, directorURL string) (*Subtasks, error) {
+	key, err := loadOrCreateKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	s := &Subtasks{
+		queue:       queue,
+		key:         key,
+		directorURL: strings.TrimRight(directorURL, "/"),
+		children:    make(map[string][]*Subtask),
+		byQueueID:   make(map[string]*Subtask),
+		depth:       make(map[string]int),
+	}
+	// Subtasks still queued from before a restart stay linked to their
+	// parent, at the depth they were spawned at
+	for _, task := range queue.GetAll() {
+		if task.ParentQueueID == "" {
+			continue
+		}
+		depth := task.SubtaskDepth
+		if depth == 0 {
+			// Queued before depths were recorded; count the ancestors
+			// still in the queue
+			depth = 1
+			for p := queue.Get(task.ParentQueueID); p != nil && p.ParentQueueID != "" && depth < maxSubtaskDepth; p = queue.Get(p.ParentQueueID) {
+				depth++
+			}
+		}
+		s.trackUnlocked(task, depth)
+	}
+	return s, nil
+}
+
+// loadOrCreateKey reads a hex key from path, writing a new random one if
+// the file doesn't exist.
+func loadOrCreateKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) < 32 {
+			return nil, fmt.Errorf("subtask key %s is invalid", path)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading subtask key: %w", err)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generating subtask key: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("writing subtask key: %w", err)
+	}
+	return key, nil
+}
+
+// token returns the subtask token of the queued task queueID.
+func (s *Subtasks) token(queueID string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(queueID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// authorized reports whether r carries the subtask token of queueID.
+func (s *Subtasks) authorized(r *http.Request, queueID string) bool {
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(given), []byte(s.token(queueID))) == 1
+}
+
+// TaskEnv returns the environment that lets task spawn subtasks. It is the
+// dispatcher's task env function.
+func (s *Subtasks) TaskEnv(task *QueuedTask) map[string]string {
+	return map[string]string{
+		api.EnvDirectorURL:  s.directorURL,
+		api.EnvQueueID:      task.QueueID,
+		api.EnvSubtaskToken: s.token(task.QueueID),
+	}
+}
+
+// trackUnlocked starts tracking task as a subtask at depth.
+func (s *Subtasks) trackUnlocked(task *QueuedTask, depth int) {
+	sub := &Subtask{
+		QueueID:       task.QueueID,
+		State:         string(task.State),
+		PromptPreview: truncateUTF8(task.Prompt, 100),
+	}
+	s.children[task.ParentQueueID] = append(s.children[task.ParentQueueID], sub)
+	s.byQueueID[task.QueueID] = sub
+	s.depth[task.QueueID] = depth
+}
+
+// Spawn queues a subtask of the running task parentQueueID.
+func (s *Subtasks) Spawn(parentQueueID string, req SubtaskRequest) (*QueuedTask, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parent := s.queue.Get(parentQueueID)
+	if parent == nil || parent.State != TaskStateWorking {
+		return nil, 0, errParentNotRunning
+	}
+	depth := s.depth[parentQueueID] + 1
+	if depth > maxSubtaskDepth {
+		return nil, 0, fmt.Errorf("subtasks can only be nested %d deep", maxSubtaskDepth)
+	}
+	if len(s.children[parentQueueID]) >= maxSubtasksPerParent {
+		return nil, 0, fmt.Errorf("a task can spawn at most %d subtasks", maxSubtasksPerParent)
+	}
+
+	agentKind := req.AgentKind
+	if agentKind == "" {
+		agentKind = parent.AgentKind
+	}
+	task, position, err := s.queue.Add(QueueSubmitRequest{
+		Prompt:         req.Prompt,
+		Tier:           req.Tier,
+		TimeoutSeconds: req.TimeoutSeconds,
+		Env:            req.Env,
+		Source:         subtaskSource,
+		SourceJob:      parentQueueID,
+		AgentKind:      agentKind,
+		RunnerOptions:  req.RunnerOptions,
+		ParentQueueID:  parentQueueID,
+		ParentTaskID:   parent.TaskID,
+		SubtaskDepth:   depth,
+		RequestID:      parent.RequestID, // Subtasks are traced with the request that started their parent
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	s.trackUnlocked(task, depth)
+	fmt.Fprintf(os.Stderr, "subtask: %s spawned %s\n", parentQueueID, task.QueueID)
+	return task, position, nil
+}
+
+// errParentNotRunning rejects subtasks of tasks that aren't running.
+var errParentNotRunning = errors.New("parent task is not running")
+
+// TaskFinished records the outcome of a subtask, if task is one. It is
+// called for task.finished events.
+func (s *Subtasks) TaskFinished(task *QueuedTask, state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.byQueueID[task.QueueID]
+	if !ok {
+		return
+	}
+	sub.State = state
+	sub.TaskID = task.TaskID
+	sub.AgentURL = task.AgentURL
+	sub.SessionID = task.SessionID
+	if state != string(TaskStateCompleted) {
+		sub.Error = task.LastError
+	}
+
+	parentID := task.ParentQueueID
+	for _, sibling := range s.children[parentID] {
+		if !isTerminalState(sibling.State) {
+			return
+		}
+	}
+	s.finished = append(s.finished, parentID)
+	for len(s.finished) > maxFinishedParents {
+		s.forgetUnlocked(s.finished[0])
+		s.finished = s.finished[1:]
+	}
+}
+
+// forgetUnlocked stops tracking the subtasks of parentID.
+func (s *Subtasks) forgetUnlocked(parentID string) {
+	for _, sub := range s.children[parentID] {
+		delete(s.byQueueID, sub.QueueID)
+		delete(s.depth, sub.QueueID)
+	}
+	delete(s.children, parentID)
+}
+
+// Status aggregates the subtasks of parentQueueID, with the live state of
+// those still in the queue.
+func (s *Subtasks) Status(parentQueueID string) SubtaskStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := SubtaskStatus{ParentQueueID: parentQueueID, Subtasks: []Subtask{}}
+	for _, sub := range s.children[parentQueueID] {
+		c := *sub
+		if task := s.queue.Get(c.QueueID); task != nil {
+			c.State = string(task.State)
+			c.TaskID = task.TaskID
+			c.AgentURL = task.AgentURL
+			c.SessionID = task.SessionID
+		}
+		switch c.State {
+		case string(TaskStatePending), string(TaskStateHeld):
+			status.Pending++
+		case string(TaskStateDispatching), string(TaskStateWorking):
+			status.Running++
+		case string(TaskStateCompleted):
+			status.Completed++
+		default:
+			status.Failed++
+		}
+		status.Subtasks = append(status.Subtasks, c)
+	}
+	status.Total = len(status.Subtasks)
+	status.Done = status.Pending+status.Running == 0
+	return status
+}
+
+// HandleSpawn handles POST /api/queue/{id}/subtasks. The caller must be the
+// running task id, authenticated by its subtask token.
+func (s *Subtasks) HandleSpawn(w http.ResponseWriter, r *http.Request, parentQueueID string) {
+	if !s.authorized(r, parentQueueID) {
+		writeError(w, http.StatusUnauthorized, api.ErrorUnauthorized, "missing or invalid subtask token")
+		return
+	}
+
+	var req SubtaskRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Prompt == "" {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "prompt is required")
+		return
+	}
+	if req.Tier != "" && !api.IsValidTier(req.Tier) {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "tier must be fast, standard, or heavy")
+		return
+	}
+	if req.AgentKind != "" && !api.IsValidAgentKind(req.AgentKind) {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "agent_kind must be claude or codex")
+		return
+	}
+
+	task, position, err := s.Spawn(parentQueueID, req)
+	switch {
+	case err == ErrQueueFull:
+		writeError(w, http.StatusServiceUnavailable, api.ErrorQueueFull,
+			fmt.Sprintf("Queue is at capacity (%d tasks)", s.queue.Config().MaxSize))
+		return
+	case err == errParentNotRunning:
+		writeError(w, http.StatusConflict, api.ErrorValidation, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, QueueSubmitResponse{
+		QueueID:  task.QueueID,
+		Position: position,
+		State:    string(task.State),
+	})
+}
+
+// HandleStatus handles GET /api/queue/{id}/subtasks, authenticated like
+// HandleSpawn.
+func (s *Subtasks) HandleStatus(w http.ResponseWriter, r *http.Request, parentQueueID string) {
+	if !s.authorized(r, parentQueueID) {
+		writeError(w, http.StatusUnauthorized, api.ErrorUnauthorized, "missing or invalid subtask token")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Status(parentQueueID))
+}
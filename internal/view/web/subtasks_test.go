@@ -0,0 +1,226 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/api"
+)
+
+// newTestSubtasks returns a subtask API over a fresh queue, with one task
+// dispatched and working.
+func newTestSubtasks(t *testing.T) (*Subtasks, *WorkQueue, *QueuedTask) {
+	t.Helper()
+	dir := t.TempDir()
+	q, err := NewWorkQueue(QueueConfig{Dir: dir})
+	require.NoError(t, err)
+	s, err := NewSubtasks(q, filepath.Join(dir, "subtask.key"), "http://127.0.0.1:8081")
+	require.NoError(t, err)
+
+	parent, _, err := q.Add(QueueSubmitRequest{Prompt: "split this up", AgentKind: "codex"})
+	require.NoError(t, err)
+	q.SetDispatched(parent, "https://localhost:9000", "task-parent", "session-parent", "test")
+	return s, q, parent
+}
+
+// subtaskRequest builds a subtask API request carrying token.
+func subtaskRequest(method, queueID, token, body string) *http.Request {
+	req := httptest.NewRequest(method, "/api/queue/"+queueID+"/subtasks", bytes.NewBufferString(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestSubtaskSpawnAndStatus(t *testing.T) {
+	t.Parallel()
+
+	s, q, parent := newTestSubtasks(t)
+	env := s.TaskEnv(parent)
+	require.Equal(t, "http://127.0.0.1:8081", env[api.EnvDirectorURL])
+	require.Equal(t, parent.QueueID, env[api.EnvQueueID])
+	token := env[api.EnvSubtaskToken]
+
+	// The token only authorizes its own task
+	rec := httptest.NewRecorder()
+	s.HandleSpawn(rec, subtaskRequest("POST", parent.QueueID, "", `{"prompt": "a"}`), parent.QueueID)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	other, _, err := q.Add(QueueSubmitRequest{Prompt: "other"})
+	require.NoError(t, err)
+	rec = httptest.NewRecorder()
+	s.HandleSpawn(rec, subtaskRequest("POST", other.QueueID, token, `{"prompt": "a"}`), other.QueueID)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	var ids []string
+	for _, prompt := range []string{"part one", "part two"} {
+		rec = httptest.NewRecorder()
+		s.HandleSpawn(rec, subtaskRequest("POST", parent.QueueID, token, `{"prompt": "`+prompt+`"}`), parent.QueueID)
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+		var resp QueueSubmitResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		ids = append(ids, resp.QueueID)
+	}
+
+	child := q.Get(ids[0])
+	require.Equal(t, subtaskSource, child.Source)
+	require.Equal(t, parent.QueueID, child.ParentQueueID)
+	require.Equal(t, "task-parent", child.ParentTaskID)
+	require.Equal(t, "codex", child.AgentKind, "agent kind defaults to the parent's")
+	require.Empty(t, child.SessionID, "subtasks run in new sessions")
+
+	// One child finishes, the other is still queued
+	q.SetDispatched(child, "https://localhost:9001", "task-child", "session-child", "test")
+	q.Remove(child)
+	s.TaskFinished(child, "completed")
+
+	status := s.Status(parent.QueueID)
+	require.Equal(t, 2, status.Total)
+	require.Equal(t, 1, status.Completed)
+	require.Equal(t, 1, status.Pending)
+	require.False(t, status.Done)
+	require.Equal(t, "task-child", status.Subtasks[0].TaskID)
+
+	second, _ := q.Cancel(ids[1])
+	s.TaskFinished(second, "cancelled")
+
+	rec = httptest.NewRecorder()
+	s.HandleStatus(rec, subtaskRequest("GET", parent.QueueID, token, ""), parent.QueueID)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	require.True(t, status.Done)
+	require.Equal(t, 1, status.Failed)
+	require.Equal(t, "cancelled", status.Subtasks[1].State)
+}
+
+func TestSubtaskLimits(t *testing.T) {
+	t.Parallel()
+
+	s, q, parent := newTestSubtasks(t)
+
+	// Only running tasks spawn subtasks
+	waiting, _, err := q.Add(QueueSubmitRequest{Prompt: "not started"})
+	require.NoError(t, err)
+	_, _, err = s.Spawn(waiting.QueueID, SubtaskRequest{Prompt: "a"})
+	require.ErrorIs(t, err, errParentNotRunning)
+
+	// Nesting stops at maxSubtaskDepth
+	id := parent.QueueID
+	for depth := 1; depth <= maxSubtaskDepth; depth++ {
+		child, _, err := s.Spawn(id, SubtaskRequest{Prompt: "deeper"})
+		require.NoError(t, err)
+		q.SetDispatched(child, "https://localhost:9000", "task-"+child.QueueID, "", "test")
+		id = child.QueueID
+	}
+	_, _, err = s.Spawn(id, SubtaskRequest{Prompt: "too deep"})
+	require.Error(t, err)
+
+	for i := 1; i < maxSubtasksPerParent; i++ {
+		_, _, err = s.Spawn(parent.QueueID, SubtaskRequest{Prompt: "more"})
+		require.NoError(t, err)
+	}
+	_, _, err = s.Spawn(parent.QueueID, SubtaskRequest{Prompt: "one too many"})
+	require.Error(t, err)
+
+	for _, body := range []string{`{}`, `{"prompt": "a", "tier": "huge"}`, `{"prompt": "a", "agent_kind": "gpt"}`} {
+		rec := httptest.NewRecorder()
+		s.HandleSpawn(rec, subtaskRequest("POST", parent.QueueID, s.token(parent.QueueID), body), parent.QueueID)
+		require.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+}
+
+func TestSubtaskKeySurvivesRestart(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	q, err := NewWorkQueue(QueueConfig{Dir: dir})
+	require.NoError(t, err)
+	keyPath := filepath.Join(dir, "subtask.key")
+	first, err := NewSubtasks(q, keyPath, "")
+	require.NoError(t, err)
+
+	parent, _, err := q.Add(QueueSubmitRequest{Prompt: "parent"})
+	require.NoError(t, err)
+	q.SetDispatched(parent, "https://localhost:9000", "task-parent", "", "test")
+	child, _, err := first.Spawn(parent.QueueID, SubtaskRequest{Prompt: "child"})
+	require.NoError(t, err)
+	q.SetDispatched(child, "https://localhost:9000", "task-child", "", "test")
+	grandchild, _, err := first.Spawn(child.QueueID, SubtaskRequest{Prompt: "grandchild"})
+	require.NoError(t, err)
+
+	// Tokens stay valid and queued children stay linked across a restart
+	q2, err := NewWorkQueue(QueueConfig{Dir: dir})
+	require.NoError(t, err)
+	second, err := NewSubtasks(q2, keyPath, "")
+	require.NoError(t, err)
+	require.Equal(t, first.token(parent.QueueID), second.token(parent.QueueID))
+	require.Equal(t, 1, second.Status(parent.QueueID).Total)
+
+	// ...and keep their depth, so the nesting limit still holds
+	q2.SetDispatched(q2.Get(grandchild.QueueID), "https://localhost:9000", "task-grandchild", "", "test")
+	_, _, err = second.Spawn(grandchild.QueueID, SubtaskRequest{Prompt: "too deep"})
+	require.ErrorContains(t, err, "nested")
+}
+
+func TestDispatchGivesTaskSubtaskEnv(t *testing.T) {
+	t.Parallel()
+
+	var got struct {
+		Env          map[string]string `json:"env"`
+		ParentTaskID string            `json:"parent_task_id"`
+	}
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"task_id": "task-child", "session_id": "session-child"})
+	}))
+	t.Cleanup(agent.Close)
+
+	s, q, parent := newTestSubtasks(t)
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	d.mu.Lock()
+	d.components[agent.URL] = &ComponentStatus{URL: agent.URL, Type: "agent", State: "idle"}
+	d.mu.Unlock()
+	dispatcher := NewDispatcher(q, d, NewSessionStore())
+	dispatcher.trackInterval = time.Hour // Completion tracking is not under test
+	dispatcher.SetTaskEnvFunc(s.TaskEnv)
+
+	child, _, err := s.Spawn(parent.QueueID, SubtaskRequest{Prompt: "child", AgentKind: "claude", Env: map[string]string{"FOO": "bar"}})
+	require.NoError(t, err)
+	dispatcher.dispatchNext()
+
+	require.Equal(t, "task-parent", got.ParentTaskID)
+	require.Equal(t, "bar", got.Env["FOO"])
+	require.Equal(t, child.QueueID, got.Env[api.EnvQueueID])
+	require.Equal(t, s.token(child.QueueID), got.Env[api.EnvSubtaskToken])
+	require.NotContains(t, child.Env, api.EnvQueueID, "the queued task's own env is left alone")
+}
+
+func TestSubtaskRouteSkipsSessionAuth(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	authStore, err := NewAuthStore(filepath.Join(tmpDir, "auth.json"), "password")
+	require.NoError(t, err)
+	d, err := New(&Config{AuthStore: authStore, QueueDir: filepath.Join(tmpDir, "queue")}, "test")
+	require.NoError(t, err)
+	router := d.Router()
+
+	// The subtask token is the authentication, so a bad one is a 401...
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, subtaskRequest("GET", "queue-1", "wrong", ""))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, subtaskRequest("GET", "queue-1", d.subtasks.token("queue-1"), ""))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// ...while the rest of the queue API still needs a session
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/queue/queue-1", nil))
+	require.NotEqual(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,120 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"phobos.org.uk/agency/internal/api"
+	"phobos.org.uk/agency/internal/history"
+)
+
+// errTaskNotInHistory is returned when no agent has a history entry for a task.
+var errTaskNotInHistory = errors.New("task not found in any agent's history")
+
+// TaskComparison is returned by GET /api/compare: the diff of two tasks'
+// outputs and file changes, and the agents they ran on.
+type TaskComparison struct {
+	*history.Comparison
+	AgentA string `json:"agent_a"`
+	AgentB string `json:"agent_b"`
+}
+
+// HandleCompareTasks diffs the results of ?task_a= and ?task_b=, typically
+// the same prompt run before and after a tweak. The tasks may have run on
+// different agents; each is looked up on ?agent_a= / ?agent_b= if given,
+// otherwise on its session's agent and then every discovered agent.
+func (h *Handlers) HandleCompareTasks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	taskA, taskB := query.Get("task_a"), query.Get("task_b")
+	if taskA == "" || taskB == "" {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "task_a and task_b query parameters are required")
+		return
+	}
+	for _, agentURL := range []string{query.Get("agent_a"), query.Get("agent_b")} {
+		if agentURL == "" {
+			continue
+		}
+		if _, ok := h.requireDiscoveredAgent(w, agentURL); !ok {
+			return
+		}
+	}
+
+	client := createHTTPClient(10*time.Second, h.authToken)
+	entryA, agentA, err := h.findHistoryEntry(client, taskA, query.Get("agent_a"))
+	if err != nil {
+		writeCompareError(w, taskA, err)
+		return
+	}
+	entryB, agentB, err := h.findHistoryEntry(client, taskB, query.Get("agent_b"))
+	if err != nil {
+		writeCompareError(w, taskB, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, TaskComparison{
+		Comparison: history.CompareEntries(entryA, entryB),
+		AgentA:     agentA,
+		AgentB:     agentB,
+	})
+}
+
+// findHistoryEntry fetches a task's full history entry from agentURL, or if
+// that is empty, from the first agent that has it.
+func (h *Handlers) findHistoryEntry(client *http.Client, taskID, agentURL string) (*history.Entry, string, error) {
+	candidates := []string{agentURL}
+	if agentURL == "" {
+		candidates = nil
+		if sessionAgent, ok := h.sessionStore.AgentForTask(taskID); ok {
+			candidates = append(candidates, sessionAgent)
+		}
+		for _, agent := range h.discovery.Agents() {
+			if len(candidates) == 0 || agent.URL != candidates[0] {
+				candidates = append(candidates, agent.URL)
+			}
+		}
+	}
+
+	var lastErr error = errTaskNotInHistory
+	for _, candidate := range candidates {
+		entry, err := fetchHistoryEntry(client, candidate, taskID)
+		if err == nil {
+			return entry, candidate, nil
+		}
+		if !errors.Is(err, errTaskNotInHistory) {
+			lastErr = err
+		}
+	}
+	return nil, "", lastErr
+}
+
+// fetchHistoryEntry reads one full history entry from an agent.
+func fetchHistoryEntry(client *http.Client, agentURL, taskID string) (*history.Entry, error) {
+	resp, err := client.Get(agentURL + "/history/" + url.PathEscape(taskID))
+	if err != nil {
+		return nil, fmt.Errorf("fetching history from %s: %w", agentURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errTaskNotInHistory
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching history from %s: status %d", agentURL, resp.StatusCode)
+	}
+	var entry history.Entry
+	if err := json.NewDecoder(resp.Body).Decode(&entry); err != nil {
+		return nil, fmt.Errorf("decoding history from %s: %w", agentURL, err)
+	}
+	return &entry, nil
+}
+
+func writeCompareError(w http.ResponseWriter, taskID string, err error) {
+	if errors.Is(err, errTaskNotInHistory) {
+		writeError(w, http.StatusNotFound, api.ErrorNotFound, fmt.Sprintf("Task %s not found in any agent's history", taskID))
+		return
+	}
+	writeError(w, http.StatusBadGateway, api.ErrorAgentError, err.Error())
+}
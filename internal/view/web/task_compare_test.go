@@ -0,0 +1,69 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"phobos.org.uk/agency/internal/history"
+)
+
+func TestHandleCompareTasks(t *testing.T) {
+	t.Parallel()
+
+	newAgent := func(entries map[string]history.Entry) *httptest.Server {
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/status" {
+				json.NewEncoder(w).Encode(map[string]any{"type": "agent", "state": "idle"})
+				return
+			}
+			entry, ok := entries[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(entry)
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	agentA := newAgent(map[string]history.Entry{
+		"/history/task-a": {TaskID: "task-a", State: "completed", Output: "one\ntwo",
+			FileChanges: []history.FileChange{{Path: "main.go", Additions: 1, Diff: "+x"}}},
+	})
+	agentB := newAgent(map[string]history.Entry{
+		"/history/task-b": {TaskID: "task-b", State: "completed", Output: "one\n2",
+			FileChanges: []history.FileChange{{Path: "main.go", Additions: 1, Diff: "+y"}}},
+	})
+
+	d := NewDiscovery(DiscoveryConfig{})
+	d.checkPort(extractPort(t, agentA.URL))
+	d.checkPort(extractPort(t, agentB.URL))
+	h := newTestHandlers(t, d, "test")
+
+	w := httptest.NewRecorder()
+	h.HandleCompareTasks(w, httptest.NewRequest("GET", "/api/compare?task_a=task-a&task_b=task-b", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var cmp TaskComparison
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &cmp))
+	require.Equal(t, "task-a", cmp.A.TaskID)
+	require.Equal(t, "task-b", cmp.B.TaskID)
+	require.Equal(t, fmt.Sprintf("https://localhost:%d", extractPort(t, agentA.URL)), cmp.AgentA)
+	require.Equal(t, fmt.Sprintf("https://localhost:%d", extractPort(t, agentB.URL)), cmp.AgentB)
+	require.Equal(t, 1, cmp.Output.Additions)
+	require.Equal(t, 1, cmp.Output.Deletions)
+	require.Len(t, cmp.FileChanges, 1)
+	require.Equal(t, history.ArtifactChanged, cmp.FileChanges[0].Status)
+
+	w = httptest.NewRecorder()
+	h.HandleCompareTasks(w, httptest.NewRequest("GET", "/api/compare?task_a=task-a&task_b=missing", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	h.HandleCompareTasks(w, httptest.NewRequest("GET", "/api/compare?task_a=task-a", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
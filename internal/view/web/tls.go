@@ -1,8 +1,14 @@
 package web
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
+	"strings"
 
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
 	"phobos.org.uk/agency/internal/tlsutil"
 )
 
@@ -11,6 +17,44 @@ type TLSConfig struct {
 	CertFile     string
 	KeyFile      string
 	AutoGenerate bool
+	ACME         ACMEConfig // Obtain certificates from an ACME CA instead of the files
+}
+
+// ACMEConfig obtains and renews certificates from an ACME CA such as Let's
+// Encrypt, for a web view exposed on a real hostname.
+type ACMEConfig struct {
+	Domains      []string // Hostnames to obtain certificates for (empty = disabled)
+	Email        string   // Contact address for the CA account (optional)
+	CacheDir     string   // Account key and certificates
+	DirectoryURL string   // ACME directory (default: Let's Encrypt production)
+	HTTPAddr     string   // Address answering HTTP-01 challenges, e.g. :80 (empty = TLS-ALPN-01 only, which needs port 443)
+}
+
+// Enabled reports whether certificates come from ACME.
+func (c ACMEConfig) Enabled() bool {
+	return len(c.Domains) > 0
+}
+
+// manager returns the autocert manager for c.
+func (c ACMEConfig) manager() (*autocert.Manager, error) {
+	for _, domain := range c.Domains {
+		if domain == "" || strings.EqualFold(domain, "localhost") || net.ParseIP(domain) != nil {
+			return nil, fmt.Errorf("ACME domain %q must be a public hostname", domain)
+		}
+	}
+	if c.CacheDir == "" {
+		return nil, fmt.Errorf("ACME cache directory is required")
+	}
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(c.Domains...),
+		Cache:      autocert.DirCache(c.CacheDir),
+		Email:      c.Email,
+	}
+	if c.DirectoryURL != "" {
+		m.Client = &acme.Client{DirectoryURL: c.DirectoryURL}
+	}
+	return m, nil
 }
 
 // EnsureTLSCert checks if certificates exist and generates them if AutoGenerate is true
@@ -33,3 +77,31 @@ func EnsureTLSCert(cfg TLSConfig) error {
 
 	return tlsutil.GenerateSelfSignedCert(cfg.CertFile, cfg.KeyFile, "Agency Web Director")
 }
+
+// serverTLSConfig returns the web view's TLS config. Certificates come from
+// ACME if configured, else from the cert files, which are reloaded when they
+// change until ctx is cancelled. The returned manager is nil without ACME.
+func serverTLSConfig(ctx context.Context, cfg TLSConfig) (*tls.Config, *autocert.Manager, error) {
+	if cfg.ACME.Enabled() {
+		m, err := cfg.ACME.manager()
+		if err != nil {
+			return nil, nil, err
+		}
+		tlsCfg := m.TLSConfig()
+		tlsCfg.MinVersion = tls.VersionTLS12
+		return tlsCfg, m, nil
+	}
+
+	if err := EnsureTLSCert(cfg); err != nil {
+		return nil, nil, err
+	}
+	certs, err := tlsutil.NewCertReloader(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	go certs.Watch(ctx, tlsutil.DefaultCertCheckInterval)
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}, nil, nil
+}
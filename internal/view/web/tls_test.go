@@ -0,0 +1,56 @@
+package web
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerTLSConfigFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tlsCfg, manager, err := serverTLSConfig(ctx, TLSConfig{
+		CertFile:     filepath.Join(dir, "cert.pem"),
+		KeyFile:      filepath.Join(dir, "key.pem"),
+		AutoGenerate: true,
+	})
+	require.NoError(t, err)
+	require.Nil(t, manager)
+
+	cert, err := tlsCfg.GetCertificate(nil)
+	require.NoError(t, err)
+	require.NotNil(t, cert)
+}
+
+func TestServerTLSConfigACME(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		acme    ACMEConfig
+		wantErr string
+	}{
+		{"public hostname", ACMEConfig{Domains: []string{"agency.example.com"}, CacheDir: t.TempDir()}, ""},
+		{"localhost", ACMEConfig{Domains: []string{"localhost"}, CacheDir: t.TempDir()}, "must be a public hostname"},
+		{"ip address", ACMEConfig{Domains: []string{"192.0.2.1"}, CacheDir: t.TempDir()}, "must be a public hostname"},
+		{"no cache dir", ACMEConfig{Domains: []string{"agency.example.com"}}, "cache directory is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tlsCfg, manager, err := serverTLSConfig(context.Background(), TLSConfig{ACME: tt.acme})
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, manager)
+			require.Contains(t, tlsCfg.NextProtos, "acme-tls/1")
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238 defaults, which authenticator apps assume)
+const (
+	TOTPDigits        = 6
+	TOTPPeriod        = 30 * time.Second
+	TOTPSkew          = 1 // Steps either side of now that are accepted
+	TOTPIssuer        = "Agency"
+	RecoveryCodeCount = 10
+	recoveryCodeLen   = 8 // Base32 characters, shown as XXXX-XXXX
+	totpSecretBytes   = 20
+
+	// Wrong codes in a row before a client is locked out of logging in
+	TOTPMaxFailures = 5
+	TOTPLockout     = 15 * time.Minute
+)
+
+var (
+	errTOTPEnabled    = errors.New("two-factor authentication is already enabled")
+	errTOTPNotEnabled = errors.New("two-factor authentication is not enabled")
+	errTOTPNoPending  = errors.New("no two-factor enrollment in progress")
+	errTOTPInvalid    = errors.New("invalid two-factor code")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// totpState is the persisted two-factor configuration. The secret has to be
+// kept in the clear to compute codes; the store file is 0600.
+type totpState struct {
+	Secret        string    `json:"secret"`
+	EnabledAt     time.Time `json:"enabled_at"`
+	RecoveryCodes []string  `json:"recovery_codes"` // Hashes of unused recovery codes
+	LastStep      int64     `json:"last_step"`      // Last accepted time step, to block replays
+}
+
+// TOTPEnabled reports whether logins require a second factor.
+func (s *AuthStore) TOTPEnabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.totp != nil
+}
+
+// TOTPStatus reports whether two-factor auth is enabled, how many recovery
+// codes remain, and whether an enrollment is waiting for confirmation.
+func (s *AuthStore) TOTPStatus() (enabled bool, recoveryCodes int, pending bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.totp != nil {
+		return true, len(s.totp.RecoveryCodes), false
+	}
+	return false, 0, s.pendingTOTP != ""
+}
+
+// BeginTOTPEnrollment generates a new secret to be confirmed with
+// ConfirmTOTPEnrollment. Starting again replaces any unconfirmed secret.
+func (s *AuthStore) BeginTOTPEnrollment() (string, error) {
+	raw := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("generating TOTP secret: %w", err)
+	}
+	secret := totpEncoding.EncodeToString(raw)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.totp != nil {
+		return "", errTOTPEnabled
+	}
+	s.pendingTOTP = secret
+	return secret, nil
+}
+
+// PendingTOTPSecret returns the secret of the enrollment in progress.
+func (s *AuthStore) PendingTOTPSecret() (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.pendingTOTP, s.pendingTOTP != ""
+}
+
+// ConfirmTOTPEnrollment enables two-factor auth once code matches the pending
+// secret. Returns the recovery codes in plaintext (only shown once).
+func (s *AuthStore) ConfirmTOTPEnrollment(code string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.totp != nil {
+		return nil, errTOTPEnabled
+	}
+	if s.pendingTOTP == "" {
+		return nil, errTOTPNoPending
+	}
+	step, ok := verifyTOTP(s.pendingTOTP, code, time.Now(), 0)
+	if !ok {
+		return nil, errTOTPInvalid
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	s.totp = &totpState{
+		Secret:        s.pendingTOTP,
+		EnabledAt:     time.Now(),
+		RecoveryCodes: hashes,
+		LastStep:      step,
+	}
+	s.pendingTOTP = ""
+	if err := s.saveUnlocked(); err != nil {
+		s.totp = nil
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP turns two-factor auth off after checking a current code or a
+// recovery code.
+func (s *AuthStore) DisableTOTP(code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.totp == nil {
+		return errTOTPNotEnabled
+	}
+	if !s.verifySecondFactorUnlocked(code) {
+		return errTOTPInvalid
+	}
+	s.totp = nil
+	return s.saveUnlocked()
+}
+
+// VerifySecondFactor checks a 6-digit TOTP code or an unused recovery code.
+// Accepted codes cannot be used again.
+func (s *AuthStore) VerifySecondFactor(code string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.totp == nil || !s.verifySecondFactorUnlocked(code) {
+		return false
+	}
+	s.saveUnlocked()
+	return true
+}
+
+// totpFailure tracks a client's wrong second-factor codes at login.
+type totpFailure struct {
+	count       int       // Wrong codes in a row
+	last        time.Time // Most recent wrong code
+	lockedUntil time.Time
+}
+
+// VerifyLoginSecondFactor is VerifySecondFactor for a login from ip. After
+// TOTPMaxFailures wrong codes in a row the ip is locked out for TOTPLockout,
+// during which codes are refused without being checked; retryAt reports when
+// the lockout ends.
+func (s *AuthStore) VerifyLoginSecondFactor(ip, code string) (ok bool, retryAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	f := s.totpFailures[ip]
+	if f != nil && now.Before(f.lockedUntil) {
+		return false, f.lockedUntil
+	}
+	if s.totp != nil && s.verifySecondFactorUnlocked(code) {
+		delete(s.totpFailures, ip)
+		s.saveUnlocked()
+		return true, time.Time{}
+	}
+
+	if s.totpFailures == nil {
+		s.totpFailures = make(map[string]*totpFailure)
+	}
+	// Forget clients that stopped trying, so the map stays small
+	for other, of := range s.totpFailures {
+		if now.Sub(of.last) > TOTPLockout && now.After(of.lockedUntil) {
+			delete(s.totpFailures, other)
+		}
+	}
+	if f = s.totpFailures[ip]; f == nil {
+		f = &totpFailure{}
+		s.totpFailures[ip] = f
+	}
+	f.count++
+	f.last = now
+	if f.count >= TOTPMaxFailures {
+		f.count = 0
+		f.lockedUntil = now.Add(TOTPLockout)
+		return false, f.lockedUntil
+	}
+	return false, time.Time{}
+}
+
+// verifySecondFactorUnlocked checks code and records its use.
+// Must be called with lock held.
+func (s *AuthStore) verifySecondFactorUnlocked(code string) bool {
+	code = strings.TrimSpace(code)
+	if len(code) == TOTPDigits {
+		step, ok := verifyTOTP(s.totp.Secret, code, time.Now(), s.totp.LastStep)
+		if ok {
+			s.totp.LastStep = step
+		}
+		return ok
+	}
+
+	code = normalizeRecoveryCode(code)
+	for i, hash := range s.totp.RecoveryCodes {
+		if verifyPairingCode(code, hash) {
+			s.totp.RecoveryCodes = append(s.totp.RecoveryCodes[:i:i], s.totp.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// totpCode computes the code for a time step (RFC 4226 dynamic truncation).
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for range TOTPDigits {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%mod)
+}
+
+// verifyTOTP checks code against the steps around now, rejecting steps at or
+// before lastStep. Returns the matching step.
+func verifyTOTP(secret, code string, now time.Time, lastStep int64) (int64, bool) {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(code) != TOTPDigits {
+		return 0, false
+	}
+	current := now.Unix() / int64(TOTPPeriod/time.Second)
+	for step := current - TOTPSkew; step <= current+TOTPSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpURI returns the otpauth:// URI authenticator apps enroll from.
+func totpURI(secret, account string) string {
+	u := url.URL{
+		Scheme: "otpauth",
+		Host:   "totp",
+		Path:   "/" + TOTPIssuer + ":" + account,
+		RawQuery: url.Values{
+			"secret": {secret},
+			"issuer": {TOTPIssuer},
+			"digits": {fmt.Sprint(TOTPDigits)},
+			"period": {fmt.Sprint(int(TOTPPeriod.Seconds()))},
+		}.Encode(),
+	}
+	return u.String()
+}
+
+// generateRecoveryCodes returns RecoveryCodeCount codes for display and
+// their hashes for storage.
+func generateRecoveryCodes() (codes, hashes []string, err error) {
+	for range RecoveryCodeCount {
+		raw := make([]byte, recoveryCodeLen)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, fmt.Errorf("generating recovery code: %w", err)
+		}
+		code := make([]byte, recoveryCodeLen)
+		for i := range code {
+			code[i] = base32Alphabet[raw[i]%32]
+		}
+		// Recovery codes are hashed like pairing codes
+		hash, err := hashPairingCode(string(code))
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, string(code[:4])+"-"+string(code[4:]))
+		hashes = append(hashes, hash)
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode accepts recovery codes typed in any case, with or
+// without the separator.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
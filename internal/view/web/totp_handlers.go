@@ -0,0 +1,121 @@
+package web
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"rsc.io/qr"
+)
+
+// TOTPStatusResponse describes the two-factor configuration
+type TOTPStatusResponse struct {
+	Enabled                bool `json:"enabled"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+	Pending                bool `json:"pending"` // Enrollment started but not confirmed
+}
+
+// TOTPEnrollResponse is returned when enrollment starts
+type TOTPEnrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"` // otpauth:// URI, also available as a QR code
+}
+
+// totpCodeRequest carries a TOTP or recovery code
+type totpCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// totpAccount names the dashboard in authenticator apps: the host it was
+// opened on, without the port
+func totpAccount(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.Host); err == nil {
+		return host
+	}
+	return r.Host
+}
+
+// HandleTOTPStatus reports whether two-factor auth is enabled
+func (h *Handlers) HandleTOTPStatus(w http.ResponseWriter, r *http.Request) {
+	enabled, remaining, pending := h.authStore.TOTPStatus()
+	writeJSON(w, http.StatusOK, TOTPStatusResponse{
+		Enabled:                enabled,
+		RecoveryCodesRemaining: remaining,
+		Pending:                pending,
+	})
+}
+
+// HandleTOTPEnroll starts two-factor enrollment with a new secret
+func (h *Handlers) HandleTOTPEnroll(w http.ResponseWriter, r *http.Request) {
+	secret, err := h.authStore.BeginTOTPEnrollment()
+	if errors.Is(err, errTOTPEnabled) {
+		writeError(w, http.StatusConflict, "totp_enabled", err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "generation_error", "Failed to generate secret")
+		return
+	}
+	writeJSON(w, http.StatusCreated, TOTPEnrollResponse{
+		Secret: secret,
+		URI:    totpURI(secret, totpAccount(r)),
+	})
+}
+
+// HandleTOTPQR renders the pending enrollment secret as an SVG QR code
+func (h *Handlers) HandleTOTPQR(w http.ResponseWriter, r *http.Request) {
+	secret, ok := h.authStore.PendingTOTPSecret()
+	if !ok {
+		writeError(w, http.StatusNotFound, "no_enrollment", errTOTPNoPending.Error())
+		return
+	}
+	qrCode, err := qr.Encode(totpURI(secret, totpAccount(r)), qr.M)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "qr_error", "Failed to render QR code: "+err.Error())
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Write(renderQRSVG(qrCode, ""))
+}
+
+// HandleTOTPConfirm enables two-factor auth once the first code checks out,
+// returning the recovery codes
+func (h *Handlers) HandleTOTPConfirm(w http.ResponseWriter, r *http.Request) {
+	var req totpCodeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	codes, err := h.authStore.ConfirmTOTPEnrollment(req.Code)
+	switch {
+	case errors.Is(err, errTOTPEnabled):
+		writeError(w, http.StatusConflict, "totp_enabled", err.Error())
+	case errors.Is(err, errTOTPNoPending):
+		writeError(w, http.StatusNotFound, "no_enrollment", err.Error())
+	case errors.Is(err, errTOTPInvalid):
+		writeError(w, http.StatusBadRequest, "invalid_totp", "Invalid code; check the authenticator app's clock")
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "save_error", "Failed to enable two-factor authentication")
+	default:
+		writeJSON(w, http.StatusOK, map[string]any{"enabled": true, "recovery_codes": codes})
+	}
+}
+
+// HandleTOTPDisable turns two-factor auth off given a current or recovery code
+func (h *Handlers) HandleTOTPDisable(w http.ResponseWriter, r *http.Request) {
+	var req totpCodeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	err := h.authStore.DisableTOTP(req.Code)
+	switch {
+	case errors.Is(err, errTOTPNotEnabled):
+		writeError(w, http.StatusConflict, "totp_not_enabled", err.Error())
+	case errors.Is(err, errTOTPInvalid):
+		writeError(w, http.StatusUnauthorized, "invalid_totp", "Invalid two-factor code")
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "save_error", "Failed to disable two-factor authentication")
+	default:
+		writeJSON(w, http.StatusOK, map[string]bool{"enabled": false})
+	}
+}
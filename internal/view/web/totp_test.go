@@ -0,0 +1,276 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// codeAt returns the TOTP code for secret offset steps from now
+func codeAt(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	key, err := totpEncoding.DecodeString(secret)
+	require.NoError(t, err)
+	return totpCode(key, time.Now().Unix()/int64(TOTPPeriod/time.Second)+offset)
+}
+
+// enableTestTOTP enrolls store and returns the secret and recovery codes
+func enableTestTOTP(t *testing.T, store *AuthStore) (string, []string) {
+	t.Helper()
+	secret, err := store.BeginTOTPEnrollment()
+	require.NoError(t, err)
+	codes, err := store.ConfirmTOTPEnrollment(codeAt(t, secret, 0))
+	require.NoError(t, err)
+	return secret, codes
+}
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	t.Parallel()
+
+	// RFC 6238 appendix B, SHA1, truncated to 6 digits
+	key := []byte("12345678901234567890")
+	require.Equal(t, "287082", totpCode(key, 59/30))
+	require.Equal(t, "081804", totpCode(key, 1111111109/30))
+	require.Equal(t, "005924", totpCode(key, 1234567890/30))
+	require.Equal(t, "279037", totpCode(key, 2000000000/30))
+}
+
+func TestTOTPEnrollment(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewAuthStore(filepath.Join(t.TempDir(), "auth.json"), "password")
+	require.NoError(t, err)
+	require.False(t, store.TOTPEnabled())
+
+	_, err = store.ConfirmTOTPEnrollment("123456")
+	require.ErrorIs(t, err, errTOTPNoPending)
+
+	secret, err := store.BeginTOTPEnrollment()
+	require.NoError(t, err)
+	enabled, _, pending := store.TOTPStatus()
+	require.False(t, enabled)
+	require.True(t, pending)
+
+	_, err = store.ConfirmTOTPEnrollment("000000x")
+	require.ErrorIs(t, err, errTOTPInvalid)
+	require.False(t, store.TOTPEnabled())
+
+	codes, err := store.ConfirmTOTPEnrollment(codeAt(t, secret, 0))
+	require.NoError(t, err)
+	require.Len(t, codes, RecoveryCodeCount)
+	require.True(t, store.TOTPEnabled())
+
+	enabled, remaining, pending := store.TOTPStatus()
+	require.True(t, enabled)
+	require.Equal(t, RecoveryCodeCount, remaining)
+	require.False(t, pending)
+
+	_, err = store.BeginTOTPEnrollment()
+	require.ErrorIs(t, err, errTOTPEnabled)
+
+	// Survives a restart
+	reloaded, err := NewAuthStore(store.filePath, "password")
+	require.NoError(t, err)
+	require.True(t, reloaded.TOTPEnabled())
+}
+
+func TestVerifySecondFactor(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewAuthStore(filepath.Join(t.TempDir(), "auth.json"), "password")
+	require.NoError(t, err)
+	secret, err := store.BeginTOTPEnrollment()
+	require.NoError(t, err)
+	first := codeAt(t, secret, 0)
+	recovery, err := store.ConfirmTOTPEnrollment(first)
+	require.NoError(t, err)
+
+	// The code used to confirm enrollment cannot be replayed
+	require.False(t, store.VerifySecondFactor(first))
+
+	next := codeAt(t, secret, 1)
+	require.True(t, store.VerifySecondFactor(next))
+	require.False(t, store.VerifySecondFactor(next))
+
+	require.False(t, store.VerifySecondFactor(codeAt(t, secret, 5)))
+	require.False(t, store.VerifySecondFactor(""))
+
+	// Recovery codes work once, in any case and without the dash
+	loose := strings.ToLower(strings.ReplaceAll(recovery[0], "-", ""))
+	require.True(t, store.VerifySecondFactor(loose))
+	require.False(t, store.VerifySecondFactor(recovery[0]))
+	_, remaining, _ := store.TOTPStatus()
+	require.Equal(t, RecoveryCodeCount-1, remaining)
+}
+
+func TestDisableTOTP(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewAuthStore(filepath.Join(t.TempDir(), "auth.json"), "password")
+	require.NoError(t, err)
+	require.ErrorIs(t, store.DisableTOTP("123456"), errTOTPNotEnabled)
+
+	_, recovery := enableTestTOTP(t, store)
+	require.ErrorIs(t, store.DisableTOTP("nope"), errTOTPInvalid)
+	require.NoError(t, store.DisableTOTP(recovery[3]))
+	require.False(t, store.TOTPEnabled())
+}
+
+func TestTOTPURI(t *testing.T) {
+	t.Parallel()
+
+	u, err := url.Parse(totpURI("JBSWY3DPEHPK3PXP", "dash.example"))
+	require.NoError(t, err)
+	require.Equal(t, "otpauth", u.Scheme)
+	require.Equal(t, "totp", u.Host)
+	require.Equal(t, "/Agency:dash.example", u.Path)
+	require.Equal(t, "JBSWY3DPEHPK3PXP", u.Query().Get("secret"))
+	require.Equal(t, "Agency", u.Query().Get("issuer"))
+}
+
+func TestHandleLoginRequiresTOTP(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewAuthStore(filepath.Join(t.TempDir(), "auth.json"), "password")
+	require.NoError(t, err)
+	h, err := NewHandlers(NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000}), "test", store, false)
+	require.NoError(t, err)
+	secret, _ := enableTestTOTP(t, store)
+
+	login := func(form string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		h.HandleLogin(rec, req)
+		return rec
+	}
+
+	rec := login("password=wrong")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Body.String(), "unauthorized")
+
+	rec = login("password=password")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Body.String(), "totp_required")
+
+	rec = login("password=password&totp_code=000000x")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Body.String(), "invalid_totp")
+
+	rec = login("password=password&totp_code=" + codeAt(t, secret, 1))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotEmpty(t, rec.Result().Cookies())
+}
+
+func TestHandleLoginTOTPLockout(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewAuthStore(filepath.Join(t.TempDir(), "auth.json"), "password")
+	require.NoError(t, err)
+	h, err := NewHandlers(NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000}), "test", store, false)
+	require.NoError(t, err)
+	secret, _ := enableTestTOTP(t, store)
+
+	login := func(ip, code string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/login", strings.NewReader("password=password&totp_code="+code))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		h.HandleLogin(rec, req)
+		return rec
+	}
+
+	for i := 1; i < TOTPMaxFailures; i++ {
+		rec := login("192.0.2.1", "000000x")
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+		require.Contains(t, rec.Body.String(), "invalid_totp")
+	}
+	rec := login("192.0.2.1", "000000x")
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Contains(t, rec.Body.String(), "totp_locked")
+	require.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+	// Even the right code is refused until the lockout ends
+	rec = login("192.0.2.1", codeAt(t, secret, 1))
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+	// Other clients are unaffected
+	rec = login("192.0.2.2", codeAt(t, secret, 1))
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestSessionMiddlewarePasswordTokenWithTOTP(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewAuthStore(filepath.Join(t.TempDir(), "auth.json"), "password")
+	require.NoError(t, err)
+	handler := SessionMiddleware(store, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func() int {
+		req := httptest.NewRequest("GET", "/api/status", nil)
+		req.Header.Set("Authorization", "Bearer password")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	require.Equal(t, http.StatusOK, request())
+	enableTestTOTP(t, store)
+	require.Equal(t, http.StatusUnauthorized, request())
+}
+
+func TestTOTPHandlers(t *testing.T) {
+	t.Parallel()
+
+	d := NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000})
+	h := newTestHandlers(t, d, "test")
+
+	post := func(handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest("POST", "/api/auth/totp", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := httptest.NewRecorder()
+	h.HandleTOTPQR(rec, httptest.NewRequest("GET", "/api/auth/totp/qr", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = post(h.HandleTOTPEnroll, "")
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Contains(t, rec.Body.String(), "otpauth://totp/")
+	secret, _ := h.authStore.PendingTOTPSecret()
+
+	rec = httptest.NewRecorder()
+	h.HandleTOTPQR(rec, httptest.NewRequest("GET", "/api/auth/totp/qr", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "image/svg+xml", rec.Header().Get("Content-Type"))
+
+	rec = post(h.HandleTOTPConfirm, `{"code":"000000x"}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = post(h.HandleTOTPConfirm, `{"code":"`+codeAt(t, secret, 0)+`"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "recovery_codes")
+
+	rec = httptest.NewRecorder()
+	h.HandleTOTPStatus(rec, httptest.NewRequest("GET", "/api/auth/totp", nil))
+	require.JSONEq(t, `{"enabled":true,"recovery_codes_remaining":10,"pending":false}`, rec.Body.String())
+
+	rec = post(h.HandleTOTPEnroll, "")
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = post(h.HandleTOTPDisable, `{"code":"123"}`)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = post(h.HandleTOTPDisable, `{"code":"`+codeAt(t, secret, 1)+`"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.False(t, h.authStore.TOTPEnabled())
+}
@@ -0,0 +1,151 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"phobos.org.uk/agency/internal/api"
+)
+
+// Upload limits
+const (
+	maxUploadBytes = 5 << 20 // Per image
+	maxUploads     = 50      // Kept at once; the oldest is dropped beyond this
+	uploadTTL      = time.Hour
+)
+
+// uploadExtensions names uploaded images by their detected type.
+var uploadExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"image/bmp":  ".bmp",
+}
+
+// Upload is an image uploaded ahead of the task that refers to it.
+type Upload struct {
+	ID          string    `json:"upload_id"`
+	Name        string    `json:"name"` // File name in the task's attachments directory
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	ExpiresAt   time.Time `json:"expires_at"`
+
+	data []byte
+}
+
+// Uploads holds images pasted into the dashboard's task form until the task
+// is submitted, when they become attachments written into the session
+// workdir by the agent. Uploads are kept in memory and expire after an hour.
+type Uploads struct {
+	mu    sync.Mutex
+	byID  map[string]*Upload
+	order []string // IDs, oldest first
+	now   func() time.Time
+}
+
+// NewUploads creates an empty upload store.
+func NewUploads() *Uploads {
+	return &Uploads{
+		byID: make(map[string]*Upload),
+		now:  time.Now,
+	}
+}
+
+// Add stores an image and returns its upload. Only image types are
+// accepted.
+func (u *Uploads) Add(data []byte) (*Upload, error) {
+	contentType := http.DetectContentType(data)
+	ext, ok := uploadExtensions[contentType]
+	if !ok {
+		return nil, fmt.Errorf("uploads must be PNG, JPEG, GIF, WebP or BMP images, got %s", contentType)
+	}
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	id := hex.EncodeToString(raw)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.expireLocked()
+	if len(u.order) >= maxUploads {
+		delete(u.byID, u.order[0])
+		u.order = u.order[1:]
+	}
+	upload := &Upload{
+		ID:          "upload-" + id,
+		Name:        "pasted-" + id[:8] + ext,
+		ContentType: contentType,
+		Size:        len(data),
+		ExpiresAt:   u.now().Add(uploadTTL),
+		data:        data,
+	}
+	u.byID[upload.ID] = upload
+	u.order = append(u.order, upload.ID)
+	return upload, nil
+}
+
+// Attachments returns the uploads with the given IDs as task attachments.
+// Uploads stay available until they expire, so a submission that fails can
+// be retried.
+func (u *Uploads) Attachments(ids []string) ([]api.Attachment, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.expireLocked()
+	attachments := make([]api.Attachment, 0, len(ids))
+	for _, id := range ids {
+		upload, ok := u.byID[id]
+		if !ok {
+			return nil, fmt.Errorf("upload %q not found or expired", id)
+		}
+		attachments = append(attachments, api.Attachment{Name: upload.Name, Data: upload.data})
+	}
+	return attachments, nil
+}
+
+// expireLocked drops expired uploads. Callers hold u.mu.
+func (u *Uploads) expireLocked() {
+	now := u.now()
+	for len(u.order) > 0 {
+		upload := u.byID[u.order[0]]
+		if upload != nil && now.Before(upload.ExpiresAt) {
+			return
+		}
+		delete(u.byID, u.order[0])
+		u.order = u.order[1:]
+	}
+}
+
+// HandleUpload handles POST /api/uploads. The body is the raw image, as
+// pasted from the clipboard; the response names the upload for the task's
+// uploads list.
+func (u *Uploads) HandleUpload(w http.ResponseWriter, r *http.Request) {
+	// Plain forms can't send an image type, so this also keeps other sites out
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "image/") {
+		writeError(w, http.StatusUnsupportedMediaType, api.ErrorValidation, "Content-Type must be an image type")
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxUploadBytes))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, api.ErrorReadError,
+			fmt.Sprintf("Uploads are limited to %d bytes", maxUploadBytes))
+		return
+	}
+	if len(data) == 0 {
+		writeError(w, http.StatusBadRequest, api.ErrorValidation, "upload body is empty")
+		return
+	}
+	upload, err := u.Add(data)
+	if err != nil {
+		writeError(w, http.StatusUnsupportedMediaType, api.ErrorValidation, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, upload)
+}
@@ -0,0 +1,102 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestUploadHandler(t *testing.T) {
+	t.Parallel()
+
+	u := NewUploads()
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		wantStatus  int
+	}{
+		{"png", "image/png", testPNG, http.StatusCreated},
+		{"form post", "application/x-www-form-urlencoded", testPNG, http.StatusUnsupportedMediaType},
+		{"not an image", "image/png", []byte("hello"), http.StatusUnsupportedMediaType},
+		{"empty", "image/png", nil, http.StatusBadRequest},
+		{"too big", "image/png", append(testPNG, make([]byte, maxUploadBytes)...), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest("POST", "/api/uploads", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			u.HandleUpload(w, req)
+			require.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+			var upload Upload
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &upload))
+			require.True(t, strings.HasPrefix(upload.ID, "upload-"))
+			require.True(t, strings.HasSuffix(upload.Name, ".png"))
+			require.Equal(t, "image/png", upload.ContentType)
+		})
+	}
+}
+
+func TestUploadsExpire(t *testing.T) {
+	t.Parallel()
+
+	u := NewUploads()
+	now := time.Now()
+	u.now = func() time.Time { return now }
+
+	upload, err := u.Add(testPNG)
+	require.NoError(t, err)
+	attachments, err := u.Attachments([]string{upload.ID})
+	require.NoError(t, err)
+	require.Equal(t, upload.Name, attachments[0].Name)
+	require.Equal(t, testPNG, attachments[0].Data)
+
+	now = now.Add(uploadTTL)
+	_, err = u.Attachments([]string{upload.ID})
+	require.ErrorContains(t, err, "not found or expired")
+}
+
+func TestTaskSubmitResolvesUploads(t *testing.T) {
+	t.Parallel()
+
+	q, err := NewWorkQueue(QueueConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	h := NewQueueHandlers(q, NewDiscovery(DiscoveryConfig{PortStart: 50000, PortEnd: 50000}), NewSessionStore())
+	uploads := NewUploads()
+	h.SetUploads(uploads)
+	upload, err := uploads.Add(testPNG)
+	require.NoError(t, err)
+
+	submit := func(ids ...string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(TaskSubmitRequest{Prompt: "What is wrong in this screenshot?", Uploads: ids})
+		w := httptest.NewRecorder()
+		h.HandleTaskSubmitViaQueue(w, httptest.NewRequest("POST", "/api/task", bytes.NewReader(body)))
+		return w
+	}
+
+	w := submit("upload-missing")
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = submit(upload.ID)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var resp struct {
+		QueueID string `json:"queue_id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	task := q.Get(resp.QueueID)
+	require.Len(t, task.Attachments, 1)
+	require.Equal(t, upload.Name, task.Attachments[0].Name)
+}